@@ -0,0 +1,34 @@
+/*
+	This file supports batches of key puts and deletes that span data instances of a repo.
+*/
+
+package datastore
+
+import (
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// BatchOp is a put or delete of a key in a data instance within a repo-level batch.  In
+// JSON, the value is base64-encoded.
+type BatchOp struct {
+	Instance dvid.InstanceName
+	Op       string // "put" or "delete"
+	Key      string
+	Value    []byte
+}
+
+// BatchOpApplier is implemented by data types whose key puts and deletes can be part of a
+// repo-level batch.
+type BatchOpApplier interface {
+	// StageBatchOps adds the operations, in order, to the batch under the given context and
+	// then calls commit, which either commits the batch or stages operations of other
+	// instances sharing it.  Conflicting writes to the instance are held off until commit
+	// returns.  If an operation is bad, commit is not called.  The operations are subject
+	// to the instance's write limits and recorded as mutations by the given user.
+	StageBatchOps(ctx *VersionedCtx, batch storage.Batch, ops []BatchOp, user string, commit func() error) error
+
+	// ApplyBatchOps applies the operations, in order, through the instance's own write path
+	// when they needn't be committed with those of other instances.
+	ApplyBatchOps(ctx *VersionedCtx, ops []BatchOp, user string) error
+}
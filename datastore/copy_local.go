@@ -9,6 +9,7 @@
 package datastore
 
 import (
+	"bytes"
 	"fmt"
 	"sync"
 	"time"
@@ -18,6 +19,9 @@ import (
 	"github.com/janelia-flyem/go/go-humanize"
 )
 
+// copyBatchSize is the number of flattened key-value pairs written per PutRange when copying.
+const copyBatchSize = 1000
+
 type txStats struct {
 	// num key-value pairs
 	numKV uint64
@@ -149,22 +153,185 @@ func MigrateInstance(uuid dvid.UUID, source dvid.InstanceName, oldStore dvid.Sto
 	return nil
 }
 
+// SwitchInstanceStore copies all key-value pairs of a data instance, across all versions,
+// from its current store to another configured store, verifies both stores hold the same
+// number of keys for the instance, and then switches the instance to the new store.  The
+// instance is read-only during the migration so concurrent writes can't be lost.  If resume
+// is non-nil, only keys past it are copied, so an interrupted migration can be continued
+// from the last key logged.  The instance's data is left in the old store, and the TOML
+// configuration must assign the instance to the new store before the server restarts.
+func SwitchInstanceStore(uuid dvid.UUID, name dvid.InstanceName, newStore dvid.Store, resume storage.Key) error {
+	if manager == nil {
+		return ErrManagerNotInitialized
+	}
+	d, err := manager.getDataByUUIDName(uuid, name)
+	if err != nil {
+		return err
+	}
+	oldStore, err := d.KVStore()
+	if err != nil {
+		return err
+	}
+	oldKV, ok := oldStore.(storage.OrderedKeyValueDB)
+	if !ok {
+		return fmt.Errorf("unable to migrate data %q from store %s which isn't ordered kv store", name, oldStore)
+	}
+	newKV, ok := newStore.(storage.OrderedKeyValueDB)
+	if !ok {
+		return fmt.Errorf("unable to migrate data %q to store %s which isn't ordered kv store", name, newStore)
+	}
+	if oldKV == newKV {
+		return fmt.Errorf("data %q already uses store %s", name, newStore)
+	}
+
+	ro, ok := d.(readOnlySetter)
+	if !ok {
+		return fmt.Errorf("data %q can't be made read-only during migration", name)
+	}
+	if !ro.IsReadOnly() {
+		ro.setReadOnly(true)
+		defer ro.setReadOnly(false)
+	}
+
+	ctx := storage.NewDataContext(d, 0)
+	minKey, maxKey := ctx.KeyRange()
+	begKey := minKey
+	if resume != nil {
+		if bytes.Compare(resume, minKey) < 0 || bytes.Compare(resume, maxKey) > 0 {
+			return fmt.Errorf("resume key %x is outside the key range of data %q", resume, name)
+		}
+		begKey = append(append(storage.Key{}, resume...), 0)
+	}
+	dvid.Infof("Migrating data %q from store %s to store %s ...\n", name, oldKV, newKV)
+
+	var copied int
+	var lastKey storage.Key
+	var putErr error
+	ch := make(chan *storage.KeyValue, 1000)
+	cancel := make(chan struct{})
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			kv := <-ch
+			if kv == nil {
+				return
+			}
+			if putErr = newKV.RawPut(kv.K, kv.V); putErr != nil {
+				close(cancel)
+				return
+			}
+			copied++
+			lastKey = kv.K
+			if copied%(100*copyBatchSize) == 0 {
+				dvid.Infof("Migrated %d key-value pairs of data %q, resumable after key %x\n", copied, name, lastKey)
+			}
+		}
+	}()
+	if err = oldKV.RawRangeQuery(begKey, maxKey, false, ch, cancel); err != nil {
+		return fmt.Errorf("migration of data %q stopped after key %x: %v", name, lastKey, err)
+	}
+	wg.Wait()
+	if putErr != nil {
+		return fmt.Errorf("migration of data %q stopped after key %x: %v", name, lastKey, putErr)
+	}
+
+	oldCount, err := countKeys(oldKV, minKey, maxKey)
+	if err != nil {
+		return err
+	}
+	newCount, err := countKeys(newKV, minKey, maxKey)
+	if err != nil {
+		return err
+	}
+	if oldCount != newCount {
+		return fmt.Errorf("data %q has %d keys in store %s but %d keys in store %s after migration, not switching stores", name, oldCount, oldKV, newCount, newKV)
+	}
+	d.SetKVStore(newStore)
+	dvid.Infof("Switched data %q to store %s after copying %d key-value pairs.  Assign the data to this store in the configuration before restarting.\n", name, newKV, copied)
+	return nil
+}
+
+// readOnlySetter is implemented by data that can be made read-only at runtime.
+type readOnlySetter interface {
+	IsReadOnly() bool
+	setReadOnly(bool)
+}
+
+// countKeys returns the number of keys in the given range of a store.
+func countKeys(db storage.OrderedKeyValueDB, minKey, maxKey storage.Key) (int, error) {
+	var n int
+	ch := make(chan *storage.KeyValue, 1000)
+	done := make(chan struct{})
+	go func() {
+		for kv := <-ch; kv != nil; kv = <-ch {
+			n++
+		}
+		close(done)
+	}()
+	err := db.RawRangeQuery(minKey, maxKey, true, ch, nil)
+	if err != nil {
+		return 0, err
+	}
+	<-done
+	return n, nil
+}
+
 // CopyInstance copies a data instance locally, perhaps to a different storage
 // engine if the new instance uses a different backend per a data instance-specific configuration.
 // (See sample config.example.toml file in root dvid source directory.)
 func CopyInstance(uuid dvid.UUID, source, target dvid.InstanceName, c dvid.Config) error {
+	ic, err := newInstanceCopy(uuid, source, target, c)
+	if err != nil {
+		return err
+	}
+	return ic.copy()
+}
+
+// CloneInstance creates a new data instance with the properties of the source instance
+// and then, in the background, copies the source's key-value pairs as seen from the given
+// version.  The clone has no history, and its data is stored at the given version.  Progress
+// and completion are logged.
+func CloneInstance(uuid dvid.UUID, source, target dvid.InstanceName) error {
+	c := dvid.NewConfig()
+	c.Set("transmit", "flatten")
+	ic, err := newInstanceCopy(uuid, source, target, c)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := ic.copy(); err != nil {
+			dvid.Errorf("clone of data %q to %q failed: %v\n", source, target, err)
+		}
+	}()
+	return nil
+}
+
+// instanceCopy holds a newly created target instance and what's needed to fill it from
+// a source instance.
+type instanceCopy struct {
+	uuid         dvid.UUID
+	d1, d2       dvid.Data
+	oldKV, newKV storage.OrderedKeyValueDB
+	filter       storage.Filter
+	flatten      bool
+}
+
+// newInstanceCopy creates the target instance of a local copy.
+func newInstanceCopy(uuid dvid.UUID, source, target dvid.InstanceName, c dvid.Config) (*instanceCopy, error) {
 	if manager == nil {
-		return ErrManagerNotInitialized
+		return nil, ErrManagerNotInitialized
 	}
 
 	if source == "" || target == "" {
-		return fmt.Errorf("both source and cloned name must be provided")
+		return nil, fmt.Errorf("both source and cloned name must be provided")
 	}
 
 	// Get any filter spec
 	fstxt, found, err := c.GetString("filter")
 	if err != nil {
-		return err
+		return nil, err
 	}
 	var fs storage.FilterSpec
 	if found {
@@ -174,7 +341,7 @@ func CopyInstance(uuid dvid.UUID, source, target dvid.InstanceName, c dvid.Confi
 	// Get flatten or not
 	transmit, found, err := c.GetString("transmit")
 	if err != nil {
-		return err
+		return nil, err
 	}
 	var flatten bool
 	if transmit == "flatten" {
@@ -184,42 +351,40 @@ func CopyInstance(uuid dvid.UUID, source, target dvid.InstanceName, c dvid.Confi
 	// Get the source data instance.
 	d1, err := manager.getDataByUUIDName(uuid, source)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Create the target instance.
 	t, err := TypeServiceByName(d1.TypeName())
 	if err != nil {
-		return err
+		return nil, err
 	}
 	d2, err := manager.newData(uuid, t, target, c)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Populate the new data instance properties from source.
 	copier, ok := d2.(PropertyCopier)
 	if ok {
 		if err := copier.CopyPropertiesFrom(d1, fs); err != nil {
-			return err
+			return nil, err
 		}
 		if err := SaveDataByUUID(uuid, d2); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	// We should be able to get the backing store (only ordered kv for now)
 	oldKV, err := GetOrderedKeyValueDB(d1)
 	if err != nil {
-		return fmt.Errorf("unable to get backing store for data %q: %v", d1.DataName(), err)
+		return nil, fmt.Errorf("unable to get backing store for data %q: %v", d1.DataName(), err)
 	}
 	newKV, err := GetOrderedKeyValueDB(d2)
 	if err != nil {
-		return fmt.Errorf("unable to get backing store for data %q: %v", d2.DataName(), err)
+		return nil, fmt.Errorf("unable to get backing store for data %q: %v", d2.DataName(), err)
 	}
 
-	dvid.Infof("Copying data %q (%s) to data %q (%s)...\n", d1.DataName(), oldKV, d2.DataName(), newKV)
-
 	// See if this data instance implements a Send filter.
 	var filter storage.Filter
 	filterer, ok := d1.(storage.Filterer)
@@ -227,12 +392,16 @@ func CopyInstance(uuid dvid.UUID, source, target dvid.InstanceName, c dvid.Confi
 		var err error
 		filter, err = filterer.NewFilter(fs)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
+	return &instanceCopy{uuid, d1, d2, oldKV, newKV, filter, flatten}, nil
+}
 
-	// copy data with optional datatype-specific filtering.
-	return copyData(oldKV, newKV, d1, d2, uuid, filter, flatten)
+// copy copies data with optional datatype-specific filtering.
+func (ic *instanceCopy) copy() error {
+	dvid.Infof("Copying data %q (%s) to data %q (%s)...\n", ic.d1.DataName(), ic.oldKV, ic.d2.DataName(), ic.newKV)
+	return copyData(ic.oldKV, ic.newKV, ic.d1, ic.d2, ic.uuid, ic.filter, ic.flatten)
 }
 
 // copyData copies all key-value pairs pertinent to the given data instance d2.  If d2 is nil,
@@ -265,12 +434,26 @@ func copyData(oldKV, newKV storage.OrderedKeyValueDB, d1, d2 dvid.Data, uuid dvi
 	var bytesTotal, bytesSent uint64
 	keysOnly := false
 	if flatten {
-		// Start goroutine to receive flattened key-value pairs and store them.
+		// Start goroutine to receive flattened key-value pairs and store them in batches.
 		ch := make(chan *storage.TKeyValue, 1000)
 		go func() {
+			batch := make([]storage.TKeyValue, 0, copyBatchSize)
+			flush := func() {
+				if len(batch) == 0 {
+					return
+				}
+				if err := newKV.PutRange(dstCtx, batch); err != nil {
+					dvid.Errorf("can't put %d k/v pairs to destination instance %q: %v\n", len(batch), d2.DataName(), err)
+				}
+				batch = batch[:0]
+				if kvSent%(100*copyBatchSize) == 0 {
+					dvid.Infof("Copied %d of %d %q key-value pairs read so far to %q\n", kvSent, kvTotal, d1.DataName(), d2.DataName())
+				}
+			}
 			for {
 				tkv := <-ch
 				if tkv == nil {
+					flush()
 					wg.Done()
 					dvid.Infof("Copied %d %q key-value pairs (%s, out of %d kv pairs, %s) [flattened]\n",
 						kvSent, d1.DataName(), humanize.Bytes(bytesSent), kvTotal, humanize.Bytes(bytesTotal))
@@ -292,8 +475,9 @@ func copyData(oldKV, newKV storage.OrderedKeyValueDB, d1, d2 dvid.Data, uuid dvi
 				}
 				kvSent++
 				bytesSent += curBytes
-				if err := newKV.Put(dstCtx, tkv.K, tkv.V); err != nil {
-					dvid.Errorf("can't put k/v pair to destination instance %q: %v\n", d2.DataName(), err)
+				batch = append(batch, *tkv)
+				if len(batch) == copyBatchSize {
+					flush()
 				}
 				stats.addKV(tkv.K, tkv.V)
 			}
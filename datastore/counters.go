@@ -0,0 +1,174 @@
+/*
+	This file supports rebuilding the incrementally maintained key count of a data instance
+	from a full scan of its stored key-value pairs.
+*/
+
+package datastore
+
+import (
+	"sync"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// CountedKeyFilter is implemented by data types whose key counts only include some of
+// their type-specific keys, e.g., keys for user data but not internal metadata.
+type CountedKeyFilter interface {
+	CountsTKey(tk storage.TKey) bool
+}
+
+// Counters are the incrementally maintained usage values of a data instance.
+type Counters struct {
+	// Keys is the sum over versions of the keys each version added less the keys it
+	// deleted relative to what it inherited from its ancestors, as maintained by writes.
+	Keys uint64
+
+	// Bytes is the quota usage, the bytes written while a quota was set including those
+	// later deleted or overwritten.
+	Bytes uint64
+}
+
+// CountersRebuild reports the counters of a data instance before and after a rebuild,
+// and the bytes of keys and values currently stored across versions.
+type CountersRebuild struct {
+	Before      Counters
+	After       Counters
+	StoredBytes uint64
+}
+
+// RebuildCounters scans all stored key-value pairs of a data instance across versions,
+// recomputes its key count, and writes the corrected value to the metadata store.  Quota
+// usage counts bytes written rather than stored, which a scan can't recover, so it's
+// reported but unchanged.  Writes to the instance during the scan may not be reflected,
+// so this should be run while the instance is idle.
+func RebuildCounters(d dvid.Data) (*CountersRebuild, error) {
+	db, err := GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	filter, hasFilter := d.(CountedKeyFilter)
+	ctx := storage.NewDataContext(d, 0)
+
+	var storedBytes uint64
+	var scanErr error
+	versions := make(map[string]kvVersions)
+	ch := make(chan *storage.KeyValue, 1000)
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			kv := <-ch
+			if kv == nil {
+				return
+			}
+			tk, err := storage.TKeyFromKey(kv.K)
+			if err != nil {
+				if scanErr == nil {
+					scanErr = err
+				}
+				continue
+			}
+			if !kv.K.IsTombstone() {
+				storedBytes += uint64(len(tk) + len(kv.V))
+			}
+			if hasFilter && !filter.CountsTKey(tk) {
+				continue
+			}
+			v, err := ctx.VersionFromKey(kv.K)
+			if err != nil {
+				if scanErr == nil {
+					scanErr = err
+				}
+				continue
+			}
+			kvv, found := versions[string(tk)]
+			if !found {
+				kvv = make(kvVersions)
+				versions[string(tk)] = kvv
+			}
+			kvv[v] = kvvNode{kv: &storage.KeyValue{K: kv.K}}
+		}
+	}()
+
+	minKey, maxKey := ctx.KeyRange()
+	keysOnly := false
+	if err = db.RawRangeQuery(minKey, maxKey, keysOnly, ch, nil); err != nil {
+		return nil, err
+	}
+	wg.Wait()
+	if scanErr != nil {
+		return nil, scanErr
+	}
+
+	var count int64
+	for _, kvv := range versions {
+		delta, err := keyCountDelta(d, kvv)
+		if err != nil {
+			return nil, err
+		}
+		count += delta
+	}
+	if count < 0 {
+		count = 0
+	}
+
+	rebuild := &CountersRebuild{StoredBytes: storedBytes}
+	rebuild.After.Keys = uint64(count)
+	c := keyCounterFor(d)
+	c.Lock()
+	if err = c.load(); err == nil {
+		rebuild.Before.Keys = c.count
+		err = c.persist(rebuild.After.Keys)
+	}
+	c.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	q := quotaTrackerFor(d)
+	q.Lock()
+	defer q.Unlock()
+	if err = q.load(); err != nil {
+		return nil, err
+	}
+	rebuild.Before.Bytes = q.used
+	rebuild.After.Bytes = q.used
+	return rebuild, nil
+}
+
+// keyCountDelta returns how a key's entries change the key count as maintained by writes,
+// where each version with its own entry counts one if the key went from absent to present
+// relative to its ancestors and minus one for the reverse.
+func keyCountDelta(d dvid.Data, kvv kvVersions) (int64, error) {
+	if !d.Versioned() {
+		for _, n := range kvv {
+			if !n.kv.K.IsTombstone() {
+				return 1, nil
+			}
+		}
+		return 0, nil
+	}
+	var delta int64
+	for v, n := range kvv {
+		// resolve from the ancestors alone, on a copy since matching invalidates entries.
+		inherited := make(kvVersions, len(kvv))
+		for v2, n2 := range kvv {
+			if v2 != v {
+				inherited[v2] = kvvNode{kv: n2.kv}
+			}
+		}
+		kv, _, err := inherited.FindMatch(v)
+		if err != nil {
+			return 0, err
+		}
+		present := !n.kv.K.IsTombstone()
+		if present && kv == nil {
+			delta++
+		} else if !present && kv != nil {
+			delta--
+		}
+	}
+	return delta, nil
+}
@@ -14,6 +14,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/janelia-flyem/dvid/dvid"
@@ -86,6 +87,57 @@ func (vctx *VersionedCtx) VersionedKeyValue(values []*storage.KeyValue) (*storag
 	return kv, err
 }
 
+// ResolveTKey reads all versions of a type-specific key and returns the key-value pair
+// chosen by DAG resolution for this context's version, the version that supplied it, and
+// whether any version supplied it.  Unlike versioned Gets, a tombstone is returned if
+// the key was deleted, so clients can see which version deleted a key.
+func (vctx *VersionedCtx) ResolveTKey(db storage.OrderedKeyValueDB, tk storage.TKey) (kv *storage.KeyValue, v dvid.VersionID, found bool, err error) {
+	minKey, err := vctx.MinVersionKey(tk)
+	if err != nil {
+		return
+	}
+	maxKey, err := vctx.MaxVersionKey(tk)
+	if err != nil {
+		return
+	}
+
+	versionMap := make(kvVersions)
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	ch := make(chan *storage.KeyValue)
+	go func() {
+		defer wg.Done()
+		for {
+			kv := <-ch
+			if kv == nil {
+				return
+			}
+			vid, err := vctx.VersionFromKey(kv.K)
+			if err != nil {
+				dvid.Errorf("can't decode version of key %v: %v\n", kv.K, err)
+				continue
+			}
+			versionMap[vid] = kvvNode{kv: kv}
+		}
+	}()
+	keysOnly := false
+	if err = db.RawRangeQuery(minKey, maxKey, keysOnly, ch, nil); err != nil {
+		return
+	}
+	wg.Wait()
+
+	if kv, v, err = versionMap.FindMatch(vctx.VersionID()); err != nil {
+		return
+	}
+	if kv != nil {
+		return kv, v, true, nil
+	}
+	if n, inMap := versionMap[v]; inMap && !n.invalid && n.kv.K.IsTombstone() {
+		return n.kv, v, true, nil
+	}
+	return nil, 0, false, nil
+}
+
 // Head checks whether this the open head of the master branch
 func (vctx *VersionedCtx) Head() bool {
 
@@ -213,6 +265,24 @@ type DataService interface {
 	PushData(*PushSession) error
 }
 
+// SubpathMutationChecker is an interface for a DataService whose requests on an endpoint may
+// or may not be mutations depending on the URL path after the endpoint, e.g., a POST to
+// "keyvalues/exists" that only reads while other POSTs to "keyvalues" write.
+type SubpathMutationChecker interface {
+	// IsMutationSubrequest is like IsMutationRequest but also gets the URL path after the
+	// endpoint without surrounding slashes, e.g., "exists" for /api/node/483f/kv/keyvalues/exists.
+	IsMutationSubrequest(action, endpoint, subpath string) bool
+}
+
+// IsMutation returns true if the given HTTP method on the endpoint and path after it results
+// in mutations of the data, using IsMutationSubrequest if the data implements it.
+func IsMutation(d DataService, action, endpoint, subpath string) bool {
+	if checker, ok := d.(SubpathMutationChecker); ok {
+		return checker.IsMutationSubrequest(action, endpoint, subpath)
+	}
+	return d.IsMutationRequest(action, endpoint)
+}
+
 // TypeMigrator is an interface for a DataService that can migrate itself to another DataService.
 // A deprecated DataService implementation can implement this interface to auto-convert on metadata load.
 type TypeMigrator interface {
@@ -369,6 +439,9 @@ type Data struct {
 	// Checksum approach for serialized data.
 	checksum dvid.Checksum
 
+	// values smaller than this many bytes are stored without a checksum, 0 to always use it.
+	checksumMinSize uint64
+
 	// a list of the instances to which this data should be synced
 	syncNames []dvid.InstanceName // deprecated but used for legacy serialization
 	syncData  dvid.UUIDSet        // data UUIDs of syncs.
@@ -384,14 +457,87 @@ type Data struct {
 	kvStore  dvid.Store // key-value store
 	logStore dvid.Store // append-only log
 
+	// store alias set at creation that overrides the configured kv store assignment, if any.
+	storeAlias storage.Alias
+
 	// true if deleted (or in processing of deleting)
 	deleted bool
 
+	// true if all writes to this data's stores should be rejected.
+	readonly bool
+
+	// nonzero if HTTP writes are temporarily paused, e.g., during a backup.  Not persisted.
+	paused int32
+
+	// maximum bytes that can be written to this data's stores, or zero if unlimited.
+	quota uint64
+
+	// name of a registered codec used to encode values before compression, if any.
+	codec string
+
+	// comma-separated "<method>:<endpoint>" HTTP operations that are allowed, if set, and
+	// that are denied.
+	allowOps string
+	denyOps  string
+
 	// handle waiting based on operation ID.
 	opWG    map[uint64]*sync.WaitGroup
 	opWG_mu sync.RWMutex
 }
 
+// IsReadOnly returns true if writes to this data are rejected, either because the data
+// was configured read-only or because all stores have been set read-only.
+func (d *Data) IsReadOnly() bool {
+	return d.readonly || readOnlyStores
+}
+
+// IsPaused returns true if HTTP writes to this data are temporarily paused.
+func (d *Data) IsPaused() bool {
+	return atomic.LoadInt32(&d.paused) != 0
+}
+
+// SetPaused pauses or resumes HTTP writes to this data, e.g., to quiesce an instance
+// during a backup.  The pause state is kept in memory and cleared on restart.
+func (d *Data) SetPaused(on bool) {
+	var paused int32
+	if on {
+		paused = 1
+	}
+	atomic.StoreInt32(&d.paused, paused)
+}
+
+// setReadOnly sets whether writes to this data are rejected, e.g., during a migration.
+func (d *Data) setReadOnly(on bool) {
+	d.readonly = on
+}
+
+// Quota returns the maximum bytes that can be written to this data, or zero if unlimited.
+func (d *Data) Quota() uint64 {
+	return d.quota
+}
+
+// ChecksumMinSize returns the size in bytes below which values are stored without a
+// checksum, or zero if the checksum setting applies to all values.
+func (d *Data) ChecksumMinSize() uint64 {
+	return d.checksumMinSize
+}
+
+// ChecksumFor returns the checksum to use when serializing a value of the given size.
+// Since the checksum is recorded in each serialized value, reads verify only the values
+// that were stored with one.
+func (d *Data) ChecksumFor(size int) dvid.Checksum {
+	if uint64(size) < d.checksumMinSize {
+		return dvid.NoChecksum
+	}
+	return d.checksum
+}
+
+// Codec returns the name of the codec used to encode values of this data, or the empty
+// string if no codec is used.
+func (d *Data) Codec() string {
+	return d.codec
+}
+
 // IsDeleted returns true if data has been deleted or is deleting.
 func (d *Data) IsDeleted() bool {
 	return d.deleted
@@ -428,33 +574,49 @@ func (d *Data) MarshalJSON() ([]byte, error) {
 		logStore = "no mutation log set"
 	}
 	return json.Marshal(struct {
-		TypeName    dvid.TypeString
-		TypeURL     dvid.URLString
-		TypeVersion string
-		DataUUID    dvid.UUID
-		Name        dvid.InstanceName
-		RepoUUID    dvid.UUID
-		Compression string
-		Checksum    string
-		Syncs       []dvid.InstanceName
-		Versioned   bool
-		KVStore     string
-		LogStore    string
-		Tags        map[string]string
+		TypeName        dvid.TypeString
+		TypeURL         dvid.URLString
+		TypeVersion     string
+		DataUUID        dvid.UUID
+		Name            dvid.InstanceName
+		RepoUUID        dvid.UUID
+		Compression     string
+		Checksum        string
+		ChecksumMinSize uint64
+		Syncs           []dvid.InstanceName
+		Versioned       bool
+		ReadOnly        bool
+		Paused          bool
+		Quota           uint64
+		Codec           string
+		AllowOps        string
+		DenyOps         string
+		KVStore         string
+		StoreAlias      storage.Alias
+		LogStore        string
+		Tags            map[string]string
 	}{
-		TypeName:    d.typename,
-		TypeURL:     d.typeurl,
-		TypeVersion: d.typeversion,
-		DataUUID:    d.dataUUID,
-		Name:        d.name,
-		RepoUUID:    d.rootUUID,
-		Compression: d.compression.String(),
-		Checksum:    d.checksum.String(),
-		Syncs:       syncs,
-		Versioned:   !d.unversioned,
-		KVStore:     kvStore,
-		LogStore:    logStore,
-		Tags:        d.tags,
+		TypeName:        d.typename,
+		TypeURL:         d.typeurl,
+		TypeVersion:     d.typeversion,
+		DataUUID:        d.dataUUID,
+		Name:            d.name,
+		RepoUUID:        d.rootUUID,
+		Compression:     d.compression.String(),
+		Checksum:        d.checksum.String(),
+		ChecksumMinSize: d.checksumMinSize,
+		Syncs:           syncs,
+		Versioned:       !d.unversioned,
+		ReadOnly:        d.IsReadOnly(),
+		Paused:          d.IsPaused(),
+		Quota:           d.quota,
+		Codec:           d.codec,
+		AllowOps:        d.allowOps,
+		DenyOps:         d.denyOps,
+		KVStore:         kvStore,
+		StoreAlias:      d.storeAlias,
+		LogStore:        logStore,
+		Tags:            d.tags,
 	})
 }
 
@@ -503,16 +665,25 @@ func NewDataService(t TypeService, rootUUID dvid.UUID, id dvid.InstanceID, name
 		syncData:    dvid.UUIDSet{},
 		unversioned: false,
 	}
+	s, found, err := c.GetString("StoreAlias")
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		data.storeAlias = storage.Alias(s)
+	}
 	if err := data.ModifyConfig(c); err != nil {
 		return nil, err
 	}
 
 	// Cache assigned store and/or log.
-	var err error
-	data.kvStore, err = storage.GetAssignedStore(name, rootUUID, data.tags, t.GetTypeName())
+	data.kvStore, err = assignedStore(data)
 	if err != nil {
 		return nil, err
 	}
+	if err := t.GetStorageRequirements().Check(data.kvStore); err != nil {
+		return nil, fmt.Errorf("can't use store for data %q: %v", name, err)
+	}
 	data.logStore, err = storage.GetAssignedLog(name, rootUUID, data.tags, t.GetTypeName())
 	if err != nil {
 		return nil, err
@@ -547,6 +718,11 @@ func (d *Data) Tags() map[string]string { return d.tags }
 
 func (d *Data) Versioned() bool { return !d.unversioned }
 
+// StoreAlias returns the store set at creation to back this data, which is "default",
+// "metadata", or the alias of a configured store, or the empty string if the store
+// assigned in the configuration is used.
+func (d *Data) StoreAlias() storage.Alias { return d.storeAlias }
+
 func (d *Data) KVStore() (dvid.Store, error) {
 	if d.kvStore == nil {
 		return storage.DefaultKVStore()
@@ -685,6 +861,27 @@ func (d *Data) GobDecode(b []byte) error {
 	if err := dec.Decode(&(d.tags)); err != nil {
 		dvid.Infof("Serialization of data %q had no tags.  Skipping reading of tags.\n", d.name)
 	}
+	if err := dec.Decode(&(d.readonly)); err != nil {
+		d.readonly = false
+	}
+	if err := dec.Decode(&(d.quota)); err != nil {
+		d.quota = 0
+	}
+	if err := dec.Decode(&(d.codec)); err != nil {
+		d.codec = ""
+	}
+	if err := dec.Decode(&(d.allowOps)); err != nil {
+		d.allowOps = ""
+	}
+	if err := dec.Decode(&(d.denyOps)); err != nil {
+		d.denyOps = ""
+	}
+	if err := dec.Decode(&(d.checksumMinSize)); err != nil {
+		d.checksumMinSize = 0
+	}
+	if err := dec.Decode(&(d.storeAlias)); err != nil {
+		d.storeAlias = ""
+	}
 	return nil
 }
 
@@ -731,6 +928,27 @@ func (d *Data) GobEncode() ([]byte, error) {
 	if err := enc.Encode(d.tags); err != nil {
 		return nil, err
 	}
+	if err := enc.Encode(d.readonly); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(d.quota); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(d.codec); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(d.allowOps); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(d.denyOps); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(d.checksumMinSize); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(d.storeAlias); err != nil {
+		return nil, err
+	}
 	return buf.Bytes(), nil
 }
 
@@ -746,7 +964,14 @@ func (d *Data) Equals(d2 *Data) bool {
 		d.rootUUID != d2.rootUUID ||
 		d.compression != d2.compression ||
 		d.checksum != d2.checksum ||
+		d.checksumMinSize != d2.checksumMinSize ||
+		d.storeAlias != d2.storeAlias ||
 		len(d.tags) != len(d2.tags) ||
+		d.readonly != d2.readonly ||
+		d.quota != d2.quota ||
+		d.codec != d2.codec ||
+		d.allowOps != d2.allowOps ||
+		d.denyOps != d2.denyOps ||
 		!d.syncData.Equals(d2.syncData) {
 		return false
 	}
@@ -858,6 +1083,28 @@ func (d *Data) ModifyConfig(config dvid.Config) error {
 		}
 	}
 
+	// Set minimum value size for checksums
+	s, found, err = config.GetString("ChecksumMinSize")
+	if err != nil {
+		return err
+	}
+	if found {
+		minSize, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Illegal setting for 'ChecksumMinSize' (needs to be # bytes): %s", s)
+		}
+		d.checksumMinSize = minSize
+	}
+
+	// The backing store can only be chosen at creation.
+	s, found, err = config.GetString("StoreAlias")
+	if err != nil {
+		return err
+	}
+	if found && storage.Alias(s) != d.storeAlias {
+		return fmt.Errorf("StoreAlias of data %q can only be set at creation", d.name)
+	}
+
 	// Set versioning
 	s, found, err = config.GetString("Versioned")
 	if err != nil {
@@ -875,6 +1122,64 @@ func (d *Data) ModifyConfig(config dvid.Config) error {
 		}
 	}
 
+	// Set read-only mode
+	readonly, found, err := config.GetBool("ReadOnly")
+	if err != nil {
+		return err
+	}
+	if found {
+		d.readonly = readonly
+	}
+
+	// Set write quota in bytes
+	s, found, err = config.GetString("Quota")
+	if err != nil {
+		return err
+	}
+	if found {
+		quota, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Illegal setting for 'Quota' (needs to be # bytes): %s", s)
+		}
+		d.quota = quota
+	}
+
+	// Set value codec
+	s, found, err = config.GetString("Codec")
+	if err != nil {
+		return err
+	}
+	if found {
+		if s != "" {
+			if _, err := dvid.GetCodecByName(s); err != nil {
+				return err
+			}
+		}
+		d.codec = s
+	}
+
+	// Set operation policy
+	s, found, err = config.GetString("AllowOps")
+	if err != nil {
+		return err
+	}
+	if found {
+		if _, err := parseOpList(s); err != nil {
+			return err
+		}
+		d.allowOps = s
+	}
+	s, found, err = config.GetString("DenyOps")
+	if err != nil {
+		return err
+	}
+	if found {
+		if _, err := parseOpList(s); err != nil {
+			return err
+		}
+		d.denyOps = s
+	}
+
 	// Check for tags
 	s, found, err = config.GetString("Tags")
 	if err != nil {
@@ -958,6 +1263,17 @@ func (d *Data) MutDelete(mutID uint64) {
 	d.opWG_mu.Unlock()
 }
 
+// isReadOnly returns true if the data instance or all stores are read-only.
+func isReadOnly(d dvid.Data) bool {
+	if readOnlyStores {
+		return true
+	}
+	ro, ok := d.(interface {
+		IsReadOnly() bool
+	})
+	return ok && ro.IsReadOnly()
+}
+
 // GetKeyValueDB returns a kv data store assigned to this data instance.
 // If the store is nil or not available, an error is returned.
 func GetKeyValueDB(d dvid.Data) (db storage.KeyValueDB, err error) {
@@ -973,9 +1289,36 @@ func GetKeyValueDB(d dvid.Data) (db storage.KeyValueDB, err error) {
 	if !ok {
 		return nil, fmt.Errorf("Store assigned to data %q (%s) is not a key-value db", d.DataName(), store)
 	}
+	if isReadOnly(d) {
+		db = storage.NewReadOnlyKeyValueDB(db)
+	} else if q := quotaFor(d); q != nil {
+		db = storage.NewQuotaKeyValueDB(db, q)
+	}
 	return
 }
 
+// assignedStore returns the store named by the data's StoreAlias or, if it has none, the
+// store assigned to the data in the configuration.  A store named by alias is used as is,
+// without any tiers, shards, fallback, or caching configured for the data.
+func assignedStore(d dvid.Data) (dvid.Store, error) {
+	var alias storage.Alias
+	if aliaser, ok := d.(interface {
+		StoreAlias() storage.Alias
+	}); ok {
+		alias = aliaser.StoreAlias()
+	}
+	switch alias {
+	case "":
+		return storage.GetAssignedStore(d.DataName(), d.RootUUID(), d.Tags(), d.TypeName())
+	case "default":
+		return storage.DefaultKVStore()
+	case "metadata":
+		return storage.MetaDataKVStore()
+	default:
+		return storage.GetStoreByAlias(alias)
+	}
+}
+
 // GetOrderedKeyValueDB returns the ordered kv data store assigned to this data instance.
 // If the store is nil or not available, an error is returned.
 func GetOrderedKeyValueDB(d dvid.Data) (db storage.OrderedKeyValueDB, err error) {
@@ -991,6 +1334,11 @@ func GetOrderedKeyValueDB(d dvid.Data) (db storage.OrderedKeyValueDB, err error)
 	if !ok {
 		return nil, fmt.Errorf("Store assigned to data %q (%s) is not an ordered key-value db: %v", d.DataName(), store, store)
 	}
+	if isReadOnly(d) {
+		db = storage.NewReadOnlyOrderedKeyValueDB(db)
+	} else if q := quotaFor(d); q != nil {
+		db = storage.NewQuotaOrderedKeyValueDB(db, q)
+	}
 	return
 }
 
@@ -1009,6 +1357,11 @@ func GetKeyValueBatcher(d dvid.Data) (db storage.KeyValueBatcher, err error) {
 	if !ok {
 		return nil, fmt.Errorf("Store assigned to data %q (%s) is not able to batch key-value ops", d.DataName(), store)
 	}
+	if isReadOnly(d) {
+		db = storage.ReadOnlyBatcher{}
+	} else if q := quotaFor(d); q != nil {
+		db = storage.NewQuotaBatcher(db, q)
+	}
 	return
 }
 
@@ -27,8 +27,17 @@ var (
 	// manager provides high-level repository management for DVID and is initialized
 	// on start.  Package functions provide a quick alias to this platform-specific repo manager.
 	manager *repoManager
+
+	// if true, all data instance stores reject writes.
+	readOnlyStores bool
 )
 
+// SetReadOnly sets whether all data instance stores reject writes regardless of
+// per-instance settings.
+func SetReadOnly(on bool) {
+	readOnlyStores = on
+}
+
 // Shutdown sends signal for all goroutines for data processing to be terminated.
 func Shutdown() {
 	if manager == nil {
@@ -235,6 +244,15 @@ func GetAncestry(v dvid.VersionID) ([]dvid.VersionID, error) {
 	return manager.getAncestry(v)
 }
 
+// GetAncestorVersions returns the given version and all its ancestors across all parents
+// of merged versions, unlike GetAncestry which only follows the first parent.
+func GetAncestorVersions(v dvid.VersionID) (map[dvid.VersionID]bool, error) {
+	if manager == nil {
+		return nil, ErrManagerNotInitialized
+	}
+	return versionClosure(v, GetParentsByVersion)
+}
+
 // LockedUUID returns true if a given UUID is locked.
 func LockedUUID(uuid dvid.UUID) (bool, error) {
 	if manager == nil {
@@ -321,6 +339,14 @@ func GetDataByUUIDName(uuid dvid.UUID, name dvid.InstanceName) (DataService, err
 	return manager.getDataByUUIDName(uuid, name)
 }
 
+// GetDataInstances returns the data services in the repo with the given UUID sorted by name.
+func GetDataInstances(uuid dvid.UUID) ([]DataService, error) {
+	if manager == nil {
+		return nil, ErrManagerNotInitialized
+	}
+	return manager.getDataInstances(uuid)
+}
+
 // GetDataByVersionName returns a data service given an instance name and version.
 func GetDataByVersionName(v dvid.VersionID, name dvid.InstanceName) (DataService, error) {
 	if manager == nil {
@@ -0,0 +1,189 @@
+/*
+	This file supports flattening the version history of a data instance so that
+	superseded key-value pairs of ancestor versions can be reclaimed.
+*/
+
+package datastore
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// FlattenStats reports the results of flattening a data instance.
+type FlattenStats struct {
+	Copied         int   // key-value pairs copied from ancestors into the flattened version
+	Deleted        int   // key-value pairs and tombstones deleted
+	BytesReclaimed int64 // bytes of deleted keys and values less bytes copied
+}
+
+// CacheClearer is a data instance that caches stored values, which must be cleared when
+// its stored data is changed outside the instance's own writes, e.g., by flattening.
+type CacheClearer interface {
+	ClearCache()
+}
+
+// versionClosure returns the given version and all versions reachable from it by
+// following the given function, e.g., getting parents or children.
+func versionClosure(v dvid.VersionID, next func(dvid.VersionID) ([]dvid.VersionID, error)) (map[dvid.VersionID]bool, error) {
+	closure := map[dvid.VersionID]bool{v: true}
+	queue := []dvid.VersionID{v}
+	for len(queue) != 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		versions, err := next(cur)
+		if err != nil {
+			return nil, err
+		}
+		for _, nv := range versions {
+			if !closure[nv] {
+				closure[nv] = true
+				queue = append(queue, nv)
+			}
+		}
+	}
+	return closure, nil
+}
+
+// FlattenInstance collapses the history of a versioned data instance into the version
+// with the given UUID.  Every key-value pair visible at that version is stored at it,
+// then all key-value pairs of its ancestors and its own tombstones are deleted, so the
+// version and its descendants read the same data while ancestors read nothing.  Since
+// other branches would lose data they inherit from the ancestors, flattening is refused
+// if any version in the repo is neither an ancestor nor a descendant of the version.
+// Writes to the instance during flattening may be lost, so this should be run while the
+// instance is idle.
+func FlattenInstance(uuid dvid.UUID, d dvid.Data) (*FlattenStats, error) {
+	if !d.Versioned() {
+		return nil, fmt.Errorf("data %q is unversioned so has no history to flatten", d.DataName())
+	}
+	v, err := VersionFromUUID(uuid)
+	if err != nil {
+		return nil, err
+	}
+	ancestors, err := versionClosure(v, GetParentsByVersion)
+	if err != nil {
+		return nil, err
+	}
+	delete(ancestors, v)
+	retained, err := versionClosure(v, GetChildrenByVersion)
+	if err != nil {
+		return nil, err
+	}
+	root, err := GetRepoRootVersion(v)
+	if err != nil {
+		return nil, err
+	}
+	all, err := versionClosure(root, GetChildrenByVersion)
+	if err != nil {
+		return nil, err
+	}
+	for other := range all {
+		if !ancestors[other] && !retained[other] {
+			otherUUID, err := UUIDFromVersion(other)
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("can't flatten data %q at %s since version %s is on another branch", d.DataName(), uuid, otherUUID)
+		}
+	}
+	stats := new(FlattenStats)
+	if len(ancestors) == 0 {
+		return stats, nil
+	}
+
+	db, err := GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+
+	// find the deletable keys and the type-specific keys with their own entry at the version.
+	var deletable []storage.Key
+	var scanErr error
+	own := make(map[string]struct{})
+	ctx := storage.NewDataContext(d, v)
+	ch := make(chan *storage.KeyValue, 1000)
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			kv := <-ch
+			if kv == nil {
+				return
+			}
+			if scanErr != nil {
+				continue
+			}
+			kvVersion, err := ctx.VersionFromKey(kv.K)
+			if err != nil {
+				scanErr = err
+				continue
+			}
+			switch {
+			case ancestors[kvVersion]:
+				deletable = append(deletable, kv.K)
+				stats.BytesReclaimed += int64(len(kv.K) + len(kv.V))
+			case kvVersion == v:
+				tk, err := storage.TKeyFromKey(kv.K)
+				if err != nil {
+					scanErr = err
+					continue
+				}
+				own[string(tk)] = struct{}{}
+				if kv.K.IsTombstone() {
+					deletable = append(deletable, kv.K)
+					stats.BytesReclaimed += int64(len(kv.K) + len(kv.V))
+				}
+			}
+		}
+	}()
+	minKey, maxKey := ctx.KeyRange()
+	keysOnly := false
+	if err = db.RawRangeQuery(minKey, maxKey, keysOnly, ch, nil); err != nil {
+		return nil, err
+	}
+	wg.Wait()
+	if scanErr != nil {
+		return nil, scanErr
+	}
+
+	// copy values inherited from ancestors before deleting anything.
+	vctx := NewVersionedCtx(d, v)
+	begKey, endKey := vctx.TKeyRange()
+	err = db.ProcessRange(vctx, begKey, endKey, &storage.ChunkOp{}, func(c *storage.Chunk) error {
+		if c == nil || c.TKeyValue == nil {
+			return nil
+		}
+		if _, found := own[string(c.K)]; found {
+			return nil
+		}
+		k := ctx.ConstructKeyVersion(c.K, v)
+		if err := db.RawPut(k, c.V); err != nil {
+			return err
+		}
+		stats.Copied++
+		stats.BytesReclaimed -= int64(len(k) + len(c.V))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error copying inherited values of data %q: %v", d.DataName(), err)
+	}
+
+	if cc, ok := d.(CacheClearer); ok {
+		defer cc.ClearCache()
+	}
+	for _, k := range deletable {
+		if err := db.RawDelete(k); err != nil {
+			return stats, err
+		}
+		stats.Deleted++
+	}
+	if _, err := RebuildCounters(d); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
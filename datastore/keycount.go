@@ -0,0 +1,121 @@
+/*
+	This file supports per-instance key limits, where the number of keys in a data instance
+	is maintained incrementally in the metadata store.
+*/
+
+package datastore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// keyCounter tracks the number of keys in a data instance.
+type keyCounter struct {
+	sync.Mutex
+	d      dvid.Data
+	loaded bool
+	count  uint64
+}
+
+var (
+	keyCountMu  sync.Mutex
+	keyCounters = make(map[dvid.UUID]*keyCounter)
+)
+
+func keyCounterFor(d dvid.Data) *keyCounter {
+	keyCountMu.Lock()
+	defer keyCountMu.Unlock()
+	c, found := keyCounters[d.DataUUID()]
+	if !found {
+		c = &keyCounter{d: d}
+		keyCounters[d.DataUUID()] = c
+	}
+	return c
+}
+
+func (c *keyCounter) tkey() storage.TKey {
+	return storage.NewTKey(keyCountKey, []byte(c.d.DataUUID()))
+}
+
+// load gets the persisted count if it hasn't been loaded.  Must be called with lock held.
+func (c *keyCounter) load() error {
+	if c.loaded {
+		return nil
+	}
+	db, err := storage.MetaDataKVStore()
+	if err != nil {
+		return err
+	}
+	var ctx storage.MetadataContext
+	value, err := db.Get(ctx, c.tkey())
+	if err != nil {
+		return err
+	}
+	if len(value) == 8 {
+		c.count = binary.LittleEndian.Uint64(value)
+	}
+	c.loaded = true
+	return nil
+}
+
+// persist stores a count.  Must be called with lock held.
+func (c *keyCounter) persist(count uint64) error {
+	db, err := storage.MetaDataKVStore()
+	if err != nil {
+		return err
+	}
+	value := make([]byte, 8)
+	binary.LittleEndian.PutUint64(value, count)
+	var ctx storage.MetadataContext
+	if err := db.Put(ctx, c.tkey(), value); err != nil {
+		return err
+	}
+	c.count = count
+	return nil
+}
+
+// AddKeys adds n new keys to the data's key count.  If maxKeys is nonzero and the count
+// would exceed it, the count is unchanged and an error wrapping storage.ErrQuotaExceeded
+// is returned.
+func AddKeys(d dvid.Data, n, maxKeys uint64) error {
+	c := keyCounterFor(d)
+	c.Lock()
+	defer c.Unlock()
+	if err := c.load(); err != nil {
+		return err
+	}
+	if maxKeys != 0 && c.count+n > maxKeys {
+		return fmt.Errorf("%w: data %q is limited to %d keys", storage.ErrQuotaExceeded, d.DataName(), maxKeys)
+	}
+	return c.persist(c.count + n)
+}
+
+// RemoveKeys subtracts n deleted keys from the data's key count.
+func RemoveKeys(d dvid.Data, n uint64) error {
+	c := keyCounterFor(d)
+	c.Lock()
+	defer c.Unlock()
+	if err := c.load(); err != nil {
+		return err
+	}
+	if n > c.count {
+		n = c.count
+	}
+	return c.persist(c.count - n)
+}
+
+// GetKeyCount returns the number of keys counted for the data.
+func GetKeyCount(d dvid.Data) (uint64, error) {
+	c := keyCounterFor(d)
+	c.Lock()
+	defer c.Unlock()
+	if err := c.load(); err != nil {
+		return 0, err
+	}
+	return c.count, nil
+}
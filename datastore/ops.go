@@ -0,0 +1,55 @@
+/*
+	This file supports per-instance policies that allow or deny HTTP operations, i.e.,
+	combinations of HTTP methods and endpoints.
+*/
+
+package datastore
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseOpList returns the method and endpoint of each operation in a comma-separated list
+// of "<method>:<endpoint>" operations, e.g., "DELETE:key,GET:keyrangevalues", where either
+// can be "*" to match anything.
+func parseOpList(list string) ([][2]string, error) {
+	var ops [][2]string
+	for _, op := range strings.Split(list, ",") {
+		op = strings.TrimSpace(op)
+		if op == "" {
+			continue
+		}
+		parts := strings.Split(op, ":")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("bad operation %q, expected <method>:<endpoint>, e.g., DELETE:key", op)
+		}
+		ops = append(ops, [2]string{strings.ToLower(parts[0]), parts[1]})
+	}
+	return ops, nil
+}
+
+// opListMatches returns true if any operation in the list matches the method and endpoint.
+func opListMatches(list, method, endpoint string) bool {
+	ops, err := parseOpList(list)
+	if err != nil {
+		return false
+	}
+	method = strings.ToLower(method)
+	for _, op := range ops {
+		if (op[0] == "*" || op[0] == method) && (op[1] == "*" || op[1] == endpoint) {
+			return true
+		}
+	}
+	return false
+}
+
+// OperationAllowed returns true if the HTTP method on the endpoint is allowed by the
+// instance's operation policy.  If AllowOps is set, only matching operations are allowed,
+// and operations matching DenyOps are never allowed.
+func (d *Data) OperationAllowed(method, endpoint string) bool {
+	if d.allowOps != "" && !opListMatches(d.allowOps, method, endpoint) {
+		return false
+	}
+	return !opListMatches(d.denyOps, method, endpoint)
+}
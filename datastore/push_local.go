@@ -494,7 +494,7 @@ func (p *pusher) readRepo(m *repoTxMsg) (map[dvid.VersionID]struct{}, error) {
 		}
 
 		// check if we have an assigned store for this data instance.
-		store, err := storage.GetAssignedStore(d.DataName(), d.RootUUID(), d.Tags(), d.TypeName())
+		store, err := assignedStore(d)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,137 @@
+/*
+	This file supports per-instance write quotas, where the bytes written to a data instance
+	are tracked in the metadata store and writes are rejected once the quota is exceeded.
+*/
+
+package datastore
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// quotaUsageStride is the number of bytes persisted ahead of actual quota usage, so usage
+// need not be persisted on every write.  After a restart, usage can be overcounted by up
+// to the stride.
+const quotaUsageStride = 1 << 20
+
+type quotaLimiter interface {
+	Quota() uint64
+}
+
+// quotaTracker tracks bytes written to a data instance.
+type quotaTracker struct {
+	sync.Mutex
+	d         dvid.Data
+	loaded    bool
+	used      uint64
+	persisted uint64
+}
+
+var (
+	quotaMu       sync.Mutex
+	quotaTrackers = make(map[dvid.UUID]*quotaTracker)
+)
+
+// quotaFor returns the quota tracker for the data or nil if the data has no quota.
+func quotaFor(d dvid.Data) *quotaTracker {
+	limiter, ok := d.(quotaLimiter)
+	if !ok || limiter.Quota() == 0 {
+		return nil
+	}
+	return quotaTrackerFor(d)
+}
+
+// quotaTrackerFor returns the quota tracker for the data whether or not it has a quota.
+func quotaTrackerFor(d dvid.Data) *quotaTracker {
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+	q, found := quotaTrackers[d.DataUUID()]
+	if !found {
+		q = &quotaTracker{d: d}
+		quotaTrackers[d.DataUUID()] = q
+	}
+	return q
+}
+
+func (q *quotaTracker) tkey() storage.TKey {
+	return storage.NewTKey(quotaUsageKey, []byte(q.d.DataUUID()))
+}
+
+// load gets the persisted usage if it hasn't been loaded.  Must be called with lock held.
+func (q *quotaTracker) load() error {
+	if q.loaded {
+		return nil
+	}
+	db, err := storage.MetaDataKVStore()
+	if err != nil {
+		return err
+	}
+	var ctx storage.MetadataContext
+	value, err := db.Get(ctx, q.tkey())
+	if err != nil {
+		return err
+	}
+	if len(value) == 8 {
+		q.used = binary.LittleEndian.Uint64(value)
+		q.persisted = q.used
+	}
+	q.loaded = true
+	return nil
+}
+
+// persist stores a usage value.  Must be called with lock held.
+func (q *quotaTracker) persist(used uint64) error {
+	db, err := storage.MetaDataKVStore()
+	if err != nil {
+		return err
+	}
+	value := make([]byte, 8)
+	binary.LittleEndian.PutUint64(value, used)
+	var ctx storage.MetadataContext
+	if err := db.Put(ctx, q.tkey(), value); err != nil {
+		return err
+	}
+	q.persisted = used
+	return nil
+}
+
+// Reserve records bytes written or returns storage.ErrQuotaExceeded if the write
+// would exceed the data's quota.  Implements storage.QuotaReserver.
+func (q *quotaTracker) Reserve(bytes uint64) error {
+	q.Lock()
+	defer q.Unlock()
+	if err := q.load(); err != nil {
+		return err
+	}
+	if limiter, ok := q.d.(quotaLimiter); ok {
+		if quota := limiter.Quota(); quota != 0 && q.used+bytes > quota {
+			return storage.ErrQuotaExceeded
+		}
+	}
+	q.used += bytes
+	if q.used > q.persisted {
+		if err := q.persist(q.used + quotaUsageStride); err != nil {
+			dvid.Errorf("unable to persist quota usage for data %q: %v\n", q.d.DataName(), err)
+		}
+	}
+	return nil
+}
+
+// GetQuotaUsage returns the write quota in bytes for the data, where zero is unlimited,
+// and the number of bytes written while the quota was set.
+func GetQuotaUsage(d dvid.Data) (quota, used uint64, err error) {
+	q := quotaFor(d)
+	if q == nil {
+		return 0, 0, nil
+	}
+	q.Lock()
+	defer q.Unlock()
+	if err = q.load(); err != nil {
+		return
+	}
+	return d.(quotaLimiter).Quota(), q.used, nil
+}
@@ -0,0 +1,113 @@
+/*
+	This file supports streaming all stored key-value pairs of a data instance, with full
+	keys across all versions, so another DVID server can replicate the instance.
+*/
+
+package datastore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// WriteRawRange streams the full keys, and values unless keysOnly, of a data instance in
+// key order.  If after is non-nil, the stream begins with the first key past it, so an
+// interrupted stream can be resumed from the last key received.  Each key and value is
+// preceded by its length in bytes as a little-endian uint32:
+//
+//	<key1 length><key1 bytes><value1 length><value1 bytes><key2 length>...
+//
+// Full keys include the instance ID and local version IDs of this server, so a receiver
+// must map them to its own IDs.  Returns the number of key-value pairs written.
+func WriteRawRange(w io.Writer, d dvid.Data, after storage.Key, keysOnly bool) (int, error) {
+	db, err := GetOrderedKeyValueDB(d)
+	if err != nil {
+		return 0, err
+	}
+	ctx := storage.NewDataContext(d, 0)
+	minKey, maxKey := ctx.KeyRange()
+	if after != nil {
+		if bytes.Compare(after, minKey) < 0 || bytes.Compare(after, maxKey) > 0 {
+			return 0, fmt.Errorf("resume key %x is outside the key range of data %q", after, d.DataName())
+		}
+		minKey = append(append(storage.Key{}, after...), 0)
+	}
+
+	var n int
+	var writeErr error
+	ch := make(chan *storage.KeyValue, 1000)
+	cancel := make(chan struct{})
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		lenBuf := make([]byte, 4)
+		writeBytes := func(b []byte) error {
+			binary.LittleEndian.PutUint32(lenBuf, uint32(len(b)))
+			if _, err := w.Write(lenBuf); err != nil {
+				return err
+			}
+			_, err := w.Write(b)
+			return err
+		}
+		for {
+			kv := <-ch
+			if kv == nil {
+				return
+			}
+			if writeErr = writeBytes(kv.K); writeErr == nil && !keysOnly {
+				writeErr = writeBytes(kv.V)
+			}
+			if writeErr != nil {
+				close(cancel)
+				return
+			}
+			n++
+		}
+	}()
+	if err = db.RawRangeQuery(minKey, maxKey, keysOnly, ch, cancel); err != nil {
+		return n, err
+	}
+	wg.Wait()
+	return n, writeErr
+}
+
+// ReadRawRange reads a stream written by WriteRawRange, sending each key-value pair to
+// the given function.
+func ReadRawRange(r io.Reader, keysOnly bool, f func(*storage.KeyValue) error) error {
+	lenBuf := make([]byte, 4)
+	readBytes := func() ([]byte, error) {
+		if _, err := io.ReadFull(r, lenBuf); err != nil {
+			return nil, err
+		}
+		b := make([]byte, binary.LittleEndian.Uint32(lenBuf))
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	for {
+		k, err := readBytes()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("bad key in raw range stream: %v", err)
+		}
+		kv := &storage.KeyValue{K: k}
+		if !keysOnly {
+			if kv.V, err = readBytes(); err != nil {
+				return fmt.Errorf("bad value for key %x in raw range stream: %v", k, err)
+			}
+		}
+		if err = f(kv); err != nil {
+			return err
+		}
+	}
+}
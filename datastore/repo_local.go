@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -54,6 +55,8 @@ const (
 	formatKey
 	ServerLockKey // name of key for locking metadata globally
 	mutidKey
+	quotaUsageKey
+	keyCountKey
 )
 
 // Config specifies new instance and mutation ID generation
@@ -535,8 +538,7 @@ func (m *repoManager) loadVersion0() error {
 			m.dataByUUID[dataservice.DataUUID()] = dataservice
 
 			// Cache the assigned store.
-			typename := dataservice.TypeName()
-			store, err := storage.GetAssignedStore(dataname, dataservice.RootUUID(), dataservice.Tags(), typename)
+			store, err := assignedStore(dataservice)
 			if err != nil {
 				return err
 			}
@@ -1912,6 +1914,31 @@ func (m *repoManager) getDataByUUIDName(uuid dvid.UUID, name dvid.InstanceName)
 	return data, nil
 }
 
+func (m *repoManager) getDataInstances(uuid dvid.UUID) ([]DataService, error) {
+	r, err := m.repoFromUUID(uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	r.RLock()
+	instances := make([]DataService, 0, len(r.data))
+	for _, data := range r.data {
+		if !data.IsDeleted() {
+			instances = append(instances, data)
+		}
+	}
+	r.RUnlock()
+	sort.Sort(dataByName(instances))
+	return instances, nil
+}
+
+// dataByName sorts data services by instance name.
+type dataByName []DataService
+
+func (d dataByName) Len() int           { return len(d) }
+func (d dataByName) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d dataByName) Less(i, j int) bool { return d[i].DataName() < d[j].DataName() }
+
 func (m *repoManager) getDataByVersionName(v dvid.VersionID, name dvid.InstanceName) (DataService, error) {
 	r, err := m.repoFromVersion(v)
 	if err != nil {
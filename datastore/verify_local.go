@@ -0,0 +1,125 @@
+// +build !clustered,!gcloud
+
+/*
+	This file contains local server code to verify that every key of a data instance
+	references a version in the repo DAG, with optional purging of orphaned-version keys.
+*/
+
+package datastore
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// VersionReport summarizes a scan of a data instance's keys for orphaned versions,
+// i.e., versions that are not in the repo DAG.
+type VersionReport struct {
+	DataName    dvid.InstanceName
+	KeysScanned uint64
+	Orphaned    map[dvid.VersionID]uint64 // # keys for each orphaned version
+	Purged      uint64
+}
+
+func (r VersionReport) String() string {
+	if len(r.Orphaned) == 0 {
+		return fmt.Sprintf("Data %q: scanned %d keys, no orphaned versions found", r.DataName, r.KeysScanned)
+	}
+	var versions []int
+	for v := range r.Orphaned {
+		versions = append(versions, int(v))
+	}
+	sort.Ints(versions)
+	s := fmt.Sprintf("Data %q: scanned %d keys, found keys with %d orphaned versions:", r.DataName, r.KeysScanned, len(versions))
+	for _, v := range versions {
+		s += fmt.Sprintf(" version %d (%d keys)", v, r.Orphaned[dvid.VersionID(v)])
+	}
+	if r.Purged != 0 {
+		s += fmt.Sprintf("; purged %d keys", r.Purged)
+	}
+	return s
+}
+
+// VerifyVersions scans all keys of a data instance and reports keys whose embedded
+// version is not in the repo DAG, which can happen after an incomplete branch deletion.
+// By default it only reports.  If purge is true, the orphaned keys are deleted, which
+// requires the repo passcode if one was set.
+func VerifyVersions(uuid dvid.UUID, name dvid.InstanceName, purge bool, passcode string) (*VersionReport, error) {
+	if manager == nil {
+		return nil, ErrManagerNotInitialized
+	}
+	r, err := manager.repoFromUUID(uuid)
+	if err != nil {
+		return nil, err
+	}
+	d, err := manager.getDataByUUIDName(uuid, name)
+	if err != nil {
+		return nil, err
+	}
+	if purge {
+		r.RLock()
+		badPasscode := r.passcode != "" && r.passcode != passcode
+		r.RUnlock()
+		if badPasscode {
+			return nil, fmt.Errorf("incorrect passcode for repo %s: required to purge orphaned versions", r.uuid)
+		}
+	}
+	db, err := GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := make(map[dvid.VersionID]struct{})
+	r.dag.RLock()
+	for v := range r.dag.nodes {
+		valid[v] = struct{}{}
+	}
+	r.dag.RUnlock()
+
+	report := &VersionReport{DataName: name, Orphaned: make(map[dvid.VersionID]uint64)}
+	var orphaned []storage.Key
+	ch := make(chan *storage.KeyValue, 1000)
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			kv := <-ch
+			if kv == nil {
+				return
+			}
+			report.KeysScanned++
+			_, v, _, err := storage.DataKeyToLocalIDs(kv.K)
+			if err != nil {
+				dvid.Errorf("verifying versions of data %q: %v\n", name, err)
+				continue
+			}
+			if _, found := valid[v]; !found {
+				report.Orphaned[v]++
+				if purge {
+					orphaned = append(orphaned, kv.K)
+				}
+			}
+		}
+	}()
+
+	ctx := storage.NewDataContext(d, 0)
+	minKey, maxKey := ctx.KeyRange()
+	keysOnly := true
+	if err = db.RawRangeQuery(minKey, maxKey, keysOnly, ch, nil); err != nil {
+		return nil, err
+	}
+	wg.Wait()
+
+	for _, k := range orphaned {
+		if err := db.RawDelete(k); err != nil {
+			return report, err
+		}
+		report.Purged++
+	}
+	return report, nil
+}
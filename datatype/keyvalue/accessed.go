@@ -0,0 +1,110 @@
+/*
+	This file supports optional, approximate last-access timestamps for keys, so external
+	processes can find rarely read keys to move to cheaper storage.
+*/
+
+package keyvalue
+
+import (
+	"sort"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// maxAccessedEntries is the number of recently recorded reads remembered in memory before
+// the memory is cleared, which at worst causes an extra timestamp write per key.
+const maxAccessedEntries = 100000
+
+// recordAccess stores the current time as the last-access time of a key if the instance
+// tracks accesses and the last recorded access by this server is older than the
+// AccessInterval.  Errors are only logged since they shouldn't fail the read.
+func (d *Data) recordAccess(ctx storage.Context, keyStr string) {
+	if d.AccessInterval <= 0 {
+		return
+	}
+	now := time.Now()
+	ck := d.cacheKey(ctx, keyStr)
+	d.accessedMu.Lock()
+	if last, found := d.accessed[ck]; found && now.Sub(last) < d.AccessInterval {
+		d.accessedMu.Unlock()
+		return
+	}
+	if d.accessed == nil || len(d.accessed) >= maxAccessedEntries {
+		d.accessed = make(map[coalescedKey]time.Time)
+	}
+	d.accessed[ck] = now
+	d.accessedMu.Unlock()
+
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err == nil {
+		err = storage.Unmetered(db).Put(ctx, NewAccessedTKey(keyStr), encodeTimestamp(now))
+	}
+	if err != nil {
+		dvid.Errorf("keyvalue %q: unable to record access of key %q: %v\n", d.DataName(), keyStr, err)
+	}
+}
+
+// deleteAccessed removes the last-access timestamp of a key.
+func (d *Data) deleteAccessed(ctx storage.Context, db storage.OrderedKeyValueDB, keyStr string) error {
+	d.forgetAccess(ctx, keyStr)
+	return db.Delete(ctx, NewAccessedTKey(keyStr))
+}
+
+// forgetAccess removes the remembered last access of a key, so the next read records it.
+func (d *Data) forgetAccess(ctx storage.Context, keyStr string) {
+	d.accessedMu.Lock()
+	delete(d.accessed, d.cacheKey(ctx, keyStr))
+	d.accessedMu.Unlock()
+}
+
+// KeyAccess is the approximate last-access time of a key, which is zero if the key hasn't
+// been read since access tracking was enabled.
+type KeyAccess struct {
+	Key      string
+	Accessed time.Time
+}
+
+// GetColdKeys returns the keys that haven't been read since the given time, in order of
+// increasing last-access time with never-read keys first.  Since accesses are only
+// recorded once per AccessInterval, times are accurate to within the interval.
+func (d *Data) GetColdKeys(ctx storage.Context, before time.Time) ([]KeyAccess, error) {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	accessed := make(map[string]time.Time)
+	first, last := storage.PrefixRange(keyAccessed, nil)
+	err = db.ProcessRange(ctx, first, last, nil, func(c *storage.Chunk) error {
+		if c == nil || c.TKeyValue == nil {
+			return nil
+		}
+		keyStr, err := DecodeAccessedTKey(c.K)
+		if err != nil {
+			return err
+		}
+		if accessed[keyStr], err = decodeTimestamp(c.V); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	keys, err := d.GetKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var cold []KeyAccess
+	for _, keyStr := range keys {
+		t := accessed[keyStr]
+		if t.Before(before) {
+			cold = append(cold, KeyAccess{Key: keyStr, Accessed: t})
+		}
+	}
+	sort.SliceStable(cold, func(i, j int) bool { return cold[i].Accessed.Before(cold[j].Accessed) })
+	return cold, nil
+}
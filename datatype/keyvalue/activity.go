@@ -0,0 +1,48 @@
+/*
+	This file supports logging structured activity events for HTTP requests to kafka, so
+	consumers of the activity topic get the same schema for every keyvalue operation.
+*/
+
+package keyvalue
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// activityWriter counts the bytes written in a response.
+type activityWriter struct {
+	http.ResponseWriter
+	bytes int64
+}
+
+func (w *activityWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// startActivity begins an activity event for a request on an endpoint, e.g., "key", if
+// kafka is available and the event is sampled.  It returns the writer to use for the
+// response and a function that logs the event once the request is handled.  Since the
+// event replaces the server's generic activity message, that message is never sent.
+func (d *Data) startActivity(uuid dvid.UUID, w http.ResponseWriter, r *http.Request, endpoint string) (http.ResponseWriter, func()) {
+	server.MarkActivityLogged(r)
+	if !server.KafkaAvailable() || !storage.ActivityEventSampled(r.Method) {
+		return w, func() {}
+	}
+	op := strings.ToUpper(r.Method) + " " + endpoint
+	event := storage.NewActivityEvent(op).ForData(uuid, d.DataName(), d.TypeName()).WithUser(r.URL.Query().Get("u"))
+	aw := &activityWriter{ResponseWriter: w}
+	return aw, func() {
+		bytesIn := r.ContentLength
+		if bytesIn < 0 {
+			bytesIn = 0
+		}
+		event.WithBytes(bytesIn + aw.bytes).Done().Log()
+	}
+}
@@ -0,0 +1,262 @@
+/*
+	This file supports atomic read-modify-writes of JSON values through a small set of
+	bounded operations, e.g., appending to an array, so clients can avoid racing
+	GET-modify-POST cycles.
+*/
+
+package keyvalue
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+const (
+	// MaxApplyOps is the maximum number of operations in one read-modify-write.
+	MaxApplyOps = 16
+
+	// MaxApplyPathDepth is the maximum number of fields in the path of an operation.
+	MaxApplyPathDepth = 16
+
+	// MaxApplyValueSize is the maximum size of the current and resulting values of a
+	// read-modify-write.
+	MaxApplyValueSize = 1 << 20
+)
+
+// ApplyOp is an operation of a read-modify-write of a JSON value.  Path is a dot-separated
+// path of object fields, e.g., "stats.count", where an empty path is the whole value.
+// Missing objects along the path are created.
+type ApplyOp struct {
+	Op    string          // "append", "increment", or "set"
+	Path  string          `json:",omitempty"`
+	Value json.RawMessage `json:",omitempty"` // appended or set value
+	By    json.Number     `json:",omitempty"` // amount of an increment, 1 if not given
+}
+
+// applyFunc transforms the JSON value at the path of an operation, where nil is a missing
+// value or null.
+type applyFunc func(v interface{}) (interface{}, error)
+
+// compiledOp is a checked operation.
+type compiledOp struct {
+	fields []string
+	apply  applyFunc
+}
+
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("more than one JSON value")
+	}
+	return v, nil
+}
+
+// addNumbers adds JSON numbers, as integers if both are integers that don't overflow.
+func addNumbers(a, b json.Number) (json.Number, error) {
+	ai, aErr := a.Int64()
+	bi, bErr := b.Int64()
+	if aErr == nil && bErr == nil {
+		sum := ai + bi
+		if (sum > ai) == (bi > 0) {
+			return json.Number(strconv.FormatInt(sum, 10)), nil
+		}
+	}
+	af, err := a.Float64()
+	if err != nil {
+		return "", err
+	}
+	bf, err := b.Float64()
+	if err != nil {
+		return "", err
+	}
+	sum := af + bf
+	if math.IsInf(sum, 0) {
+		return "", fmt.Errorf("increment of %s by %s overflows", a, b)
+	}
+	return json.Number(strconv.FormatFloat(sum, 'g', -1, 64)), nil
+}
+
+// compileApplyOps checks the operations and returns them ready to apply.
+func compileApplyOps(ops []ApplyOp) ([]compiledOp, error) {
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("no operations given")
+	}
+	if len(ops) > MaxApplyOps {
+		return nil, fmt.Errorf("%d operations given, more than the maximum of %d", len(ops), MaxApplyOps)
+	}
+	compiled := make([]compiledOp, len(ops))
+	for i, op := range ops {
+		op := op
+		var fields []string
+		if op.Path != "" {
+			fields = strings.Split(op.Path, ".")
+		}
+		if len(fields) > MaxApplyPathDepth {
+			return nil, fmt.Errorf("path %q has more than the maximum of %d fields", op.Path, MaxApplyPathDepth)
+		}
+		var operand interface{}
+		switch op.Op {
+		case "append", "set":
+			if len(op.Value) == 0 {
+				return nil, fmt.Errorf("%s operation on path %q requires a value", op.Op, op.Path)
+			}
+			var err error
+			if operand, err = decodeJSON(op.Value); err != nil {
+				return nil, fmt.Errorf("bad value for %s operation on path %q: %v", op.Op, op.Path, err)
+			}
+		case "increment":
+			if op.By != "" {
+				if _, err := op.By.Float64(); err != nil {
+					return nil, fmt.Errorf("bad increment %q on path %q", op.By, op.Path)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unknown operation %q, must be \"append\", \"increment\", or \"set\"", op.Op)
+		}
+
+		var apply applyFunc
+		switch op.Op {
+		case "append":
+			apply = func(v interface{}) (interface{}, error) {
+				switch t := v.(type) {
+				case nil:
+					return []interface{}{operand}, nil
+				case []interface{}:
+					return append(t, operand), nil
+				}
+				return nil, fmt.Errorf("can't append to non-array at path %q", op.Path)
+			}
+		case "increment":
+			by := op.By
+			if by == "" {
+				by = "1"
+			}
+			apply = func(v interface{}) (interface{}, error) {
+				switch t := v.(type) {
+				case nil:
+					return by, nil
+				case json.Number:
+					return addNumbers(t, by)
+				}
+				return nil, fmt.Errorf("can't increment non-number at path %q", op.Path)
+			}
+		case "set":
+			apply = func(v interface{}) (interface{}, error) {
+				return operand, nil
+			}
+		}
+		compiled[i] = compiledOp{fields: fields, apply: apply}
+	}
+	return compiled, nil
+}
+
+// applyAt applies the function to the value at the path of fields within v, creating
+// missing objects, and returns the modified v.
+func applyAt(v interface{}, fields []string, apply applyFunc) (interface{}, error) {
+	if len(fields) == 0 {
+		return apply(v)
+	}
+	var obj map[string]interface{}
+	switch t := v.(type) {
+	case nil:
+		obj = make(map[string]interface{})
+	case map[string]interface{}:
+		obj = t
+	default:
+		return nil, fmt.Errorf("field %q isn't within an object", fields[0])
+	}
+	child, err := applyAt(obj[fields[0]], fields[1:], apply)
+	if err != nil {
+		return nil, err
+	}
+	obj[fields[0]] = child
+	return obj, nil
+}
+
+// ApplyToValue applies the operations in order to a JSON value, where an empty value is
+// null, and returns the resulting JSON.  Objects in the result have their fields sorted.
+func ApplyToValue(value []byte, ops []ApplyOp) ([]byte, error) {
+	compiled, err := compileApplyOps(ops)
+	if err != nil {
+		return nil, err
+	}
+	return applyCompiled(value, compiled)
+}
+
+func applyCompiled(value []byte, compiled []compiledOp) ([]byte, error) {
+	if len(value) > MaxApplyValueSize {
+		return nil, fmt.Errorf("value has %d bytes, more than the maximum of %d for read-modify-writes", len(value), MaxApplyValueSize)
+	}
+	var v interface{}
+	if len(value) != 0 {
+		var err error
+		if v, err = decodeJSON(value); err != nil {
+			return nil, fmt.Errorf("only JSON values can be modified: %v", err)
+		}
+	}
+	for _, op := range compiled {
+		var err error
+		if v, err = applyAt(v, op.fields, op.apply); err != nil {
+			return nil, err
+		}
+	}
+	result, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) > MaxApplyValueSize {
+		return nil, fmt.Errorf("result has %d bytes, more than the maximum of %d for read-modify-writes", len(result), MaxApplyValueSize)
+	}
+	return result, nil
+}
+
+// ApplyData atomically applies the operations to the JSON value of a key, or to null if the
+// key doesn't exist, and stores and returns the result.  Writes are held off between the
+// read and the write so concurrent read-modify-writes of a key don't lose updates.  Since
+// buffered puts aren't held off, instances that coalesce writes return an error.
+func (d *Data) ApplyData(ctx storage.Context, keyStr string, ops []ApplyOp) ([]byte, error) {
+	if d.coalesceInterval() > 0 {
+		return nil, fmt.Errorf("keyvalue %q coalesces writes so can't atomically modify values", d.DataName())
+	}
+	compiled, err := compileApplyOps(ops)
+	if err != nil {
+		return nil, err
+	}
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	// hold off writes, which take indexMu for reading, and avoid calls that flush
+	// buffered writes while it's held.
+	d.indexMu.Lock()
+	defer d.indexMu.Unlock()
+	value, _, err := d.GetData(ctx, keyStr)
+	if err != nil {
+		return nil, err
+	}
+	result, err := applyCompiled(value, compiled)
+	if err != nil {
+		return nil, err
+	}
+	serialization, err := d.encodeValue(result)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.putSerialization(ctx, db, keyStr, result, serialization); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,132 @@
+/*
+	This file supports an opt-in audit log of the puts and deletes of an instance, kept in
+	the append-only log store so mutations can be queried later by key or time.
+*/
+
+package keyvalue
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// auditEntryType is the log entry type of audit records.
+const auditEntryType = 1
+
+// AuditRecord is a put or delete of a key recorded in the audit log.
+type AuditRecord struct {
+	Time  time.Time
+	User  string `json:",omitempty"`
+	Op    string // "put" or "delete"
+	Key   string
+	Bytes int // bytes of the put value, 0 for deletes
+}
+
+// AuditQuery selects audit records.  Zero values select all records.
+type AuditQuery struct {
+	Key   string
+	Since time.Time // records at or after this time
+	Until time.Time // records before this time
+}
+
+// match returns true if the record is selected by the query.
+func (q AuditQuery) match(rec AuditRecord) bool {
+	if q.Key != "" && rec.Key != q.Key {
+		return false
+	}
+	if !q.Since.IsZero() && rec.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !rec.Time.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// auditor records the mutations of a request at a version in the audit log.  A nil
+// auditor, returned if the instance doesn't keep an audit log, records nothing.
+type auditor struct {
+	d    *Data
+	uuid dvid.UUID
+	user string
+}
+
+// newAuditor returns an auditor for the mutations of a request, or nil if the instance
+// doesn't keep an audit log.
+func (d *Data) newAuditor(uuid dvid.UUID, r *http.Request) *auditor {
+	return d.auditorFor(uuid, r.URL.Query().Get("u"))
+}
+
+// auditorFor returns an auditor for mutations by the given user, or nil if the instance
+// doesn't keep an audit log.
+func (d *Data) auditorFor(uuid dvid.UUID, user string) *auditor {
+	if !d.AuditLog {
+		return nil
+	}
+	return &auditor{d: d, uuid: uuid, user: user}
+}
+
+func (a *auditor) put(keyStr string, numBytes int) {
+	a.record("put", keyStr, numBytes)
+}
+
+func (a *auditor) delete(keyStr string) {
+	a.record("delete", keyStr, 0)
+}
+
+// record appends a mutation to the audit log.  Since the mutation has already been
+// applied, failures are logged rather than returned.
+func (a *auditor) record(op, keyStr string, numBytes int) {
+	if a == nil {
+		return
+	}
+	log := a.d.GetWriteLog()
+	if log == nil {
+		dvid.Errorf("unable to audit %s of key %q in keyvalue %q: no log store\n", op, keyStr, a.d.DataName())
+		return
+	}
+	data, err := json.Marshal(AuditRecord{Time: time.Now(), User: a.user, Op: op, Key: keyStr, Bytes: numBytes})
+	if err != nil {
+		dvid.Errorf("unable to audit %s of key %q in keyvalue %q: %v\n", op, keyStr, a.d.DataName(), err)
+		return
+	}
+	msg := storage.LogMessage{EntryType: auditEntryType, Data: data}
+	if err := log.Append(a.d.DataUUID(), a.uuid, msg); err != nil {
+		dvid.Errorf("unable to audit %s of key %q in keyvalue %q: %v\n", op, keyStr, a.d.DataName(), err)
+	}
+}
+
+// GetAuditRecords returns the audit records of mutations at the given version selected by
+// the query, in the order they were recorded.
+func (d *Data) GetAuditRecords(uuid dvid.UUID, q AuditQuery) ([]AuditRecord, error) {
+	if !d.AuditLog {
+		return nil, fmt.Errorf("keyvalue %q does not keep an audit log; set AuditLog", d.DataName())
+	}
+	log := d.GetReadLog()
+	if log == nil {
+		return nil, fmt.Errorf("no log store readable for keyvalue %q", d.DataName())
+	}
+	msgs, err := log.ReadAll(d.DataUUID(), uuid)
+	if err != nil {
+		return nil, err
+	}
+	records := []AuditRecord{}
+	for _, msg := range msgs {
+		if msg.EntryType != auditEntryType {
+			continue
+		}
+		var rec AuditRecord
+		if err := json.Unmarshal(msg.Data, &rec); err != nil {
+			return nil, fmt.Errorf("bad audit record in keyvalue %q: %v", d.DataName(), err)
+		}
+		if q.match(rec) {
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
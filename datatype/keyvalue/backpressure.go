@@ -0,0 +1,70 @@
+/*
+	This file supports limiting the number of writes in progress on an instance, so sustained
+	write overload is pushed back to clients instead of exhausting server memory.
+*/
+
+package keyvalue
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// WriteLimitRetryAfter is the number of seconds rejected writes are told to wait before
+// retrying via the "Retry-After" header.
+const WriteLimitRetryAfter = 1
+
+// Behaviors when MaxPendingWrites writes are already in progress.
+const (
+	WriteOverloadReject = "reject" // respond with 503 and Retry-After
+	WriteOverloadBlock  = "block"  // wait until another write finishes
+)
+
+// writeSlots returns the semaphore limiting writes in progress, replacing it if the
+// limit has been changed, or nil if writes are unlimited.
+func (d *Data) writeSlots() chan struct{} {
+	if d.MaxPendingWrites <= 0 {
+		return nil
+	}
+	d.writeSlotsMu.Lock()
+	defer d.writeSlotsMu.Unlock()
+	if d.writeSlotsCh == nil || cap(d.writeSlotsCh) != d.MaxPendingWrites {
+		d.writeSlotsCh = make(chan struct{}, d.MaxPendingWrites)
+	}
+	return d.writeSlotsCh
+}
+
+// acquireWrite reserves one of the instance's MaxPendingWrites slots for a write request,
+// blocking or rejecting the request with status code 503 depending on the WriteOverload
+// setting if all are in use.  If it returns nil, the request was rejected and the caller
+// should return.  Otherwise the returned function must be called when the write is done.
+func (d *Data) acquireWrite(w http.ResponseWriter) (release func()) {
+	release, err := d.reserveWrite()
+	if err != nil {
+		w.Header().Set("Retry-After", strconv.Itoa(WriteLimitRetryAfter))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return nil
+	}
+	return release
+}
+
+// reserveWrite reserves a write slot like acquireWrite but returns an error if the write
+// is rejected, for writes that aren't made by a request of their own.
+func (d *Data) reserveWrite() (release func(), err error) {
+	slots := d.writeSlots()
+	if slots == nil {
+		return func() {}, nil
+	}
+	release = func() { <-slots }
+	if d.WriteOverload == WriteOverloadBlock {
+		slots <- struct{}{}
+		return release, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return release, nil
+	default:
+		return nil, fmt.Errorf("keyvalue %q already has %d writes in progress, retry later", d.DataName(), cap(slots))
+	}
+}
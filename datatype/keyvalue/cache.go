@@ -0,0 +1,160 @@
+/*
+	This file supports an optional in-memory LRU cache of values so frequently read keys
+	don't require a store read.
+*/
+
+package keyvalue
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// CacheStats gives the value cache statistics of a keyvalue instance.
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+	Bytes   int // bytes of cached values
+}
+
+type cachedValue struct {
+	key   coalescedKey
+	value []byte
+	raw   *RawEncoding
+}
+
+// valueCache is an LRU cache of values keyed by version and key.  Each invalidation
+// advances a generation so reads that started before a write can't cache stale values.
+type valueCache struct {
+	mu       sync.Mutex
+	maxBytes int
+	lru      *list.List // front is most recently used
+	entries  map[coalescedKey]*list.Element
+	gen      uint64
+	stats    CacheStats
+}
+
+func newValueCache(maxBytes int) *valueCache {
+	return &valueCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[coalescedKey]*list.Element),
+	}
+}
+
+// get returns a cached value and its encoding if stored as sent, if any, and the
+// generation to pass to add on a miss.
+func (c *valueCache) get(k coalescedKey) (value []byte, raw *RawEncoding, found bool, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, found := c.entries[k]; found {
+		c.lru.MoveToFront(elem)
+		c.stats.Hits++
+		cv := elem.Value.(*cachedValue)
+		return cv.value, cv.raw, true, c.gen
+	}
+	c.stats.Misses++
+	return nil, nil, false, c.gen
+}
+
+// add caches a value read at the given generation unless there has been an invalidation
+// since then.
+func (c *valueCache) add(k coalescedKey, value []byte, raw *RawEncoding, gen uint64) {
+	if len(value) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if elem, found := c.entries[k]; found {
+		c.removeElement(elem)
+	}
+	c.entries[k] = c.lru.PushFront(&cachedValue{k, value, raw})
+	c.stats.Entries++
+	c.stats.Bytes += len(value)
+	for c.stats.Bytes > c.maxBytes {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+func (c *valueCache) removeElement(elem *list.Element) {
+	cv := c.lru.Remove(elem).(*cachedValue)
+	delete(c.entries, cv.key)
+	c.stats.Entries--
+	c.stats.Bytes -= len(cv.value)
+}
+
+// remove invalidates the cached value of a key.
+func (c *valueCache) remove(k coalescedKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	if elem, found := c.entries[k]; found {
+		c.removeElement(elem)
+	}
+}
+
+// clear invalidates all cached values.
+func (c *valueCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.lru.Init()
+	c.entries = make(map[coalescedKey]*list.Element)
+	c.stats.Entries = 0
+	c.stats.Bytes = 0
+}
+
+// getCache returns the instance's value cache, creating or resizing it to the
+// instance's CacheSize, or nil if caching is disabled.
+func (d *Data) getCache() *valueCache {
+	d.cacheMu.Lock()
+	defer d.cacheMu.Unlock()
+	maxBytes := d.CacheSize * dvid.Mega
+	if maxBytes <= 0 {
+		d.cache = nil
+	} else if d.cache == nil || d.cache.maxBytes != maxBytes {
+		d.cache = newValueCache(maxBytes)
+	}
+	return d.cache
+}
+
+// cacheKey returns the cache key for a key read in the given context.  Writes to an
+// unversioned instance are seen by all versions, so its values are cached once.
+func (d *Data) cacheKey(ctx storage.Context, keyStr string) coalescedKey {
+	if !d.Versioned() {
+		return coalescedKey{0, keyStr}
+	}
+	return coalescedKey{ctx.VersionID(), keyStr}
+}
+
+// uncache invalidates any cached value of a key in the given context.
+func (d *Data) uncache(ctx storage.Context, keyStr string) {
+	if c := d.getCache(); c != nil {
+		c.remove(d.cacheKey(ctx, keyStr))
+	}
+}
+
+// ClearCache invalidates all cached values of the instance.
+func (d *Data) ClearCache() {
+	if c := d.getCache(); c != nil {
+		c.clear()
+	}
+}
+
+// GetCacheStats returns the value cache statistics of the instance.
+func (d *Data) GetCacheStats() CacheStats {
+	c := d.getCache()
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
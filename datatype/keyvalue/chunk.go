@@ -0,0 +1,183 @@
+/*
+	This file supports storage of values larger than a backend's maximum value size, where
+	large values are split across chunk keys and the key holds a manifest of the chunks.
+*/
+
+package keyvalue
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// chunkManifestMarker is the first byte of a stored value that is a manifest of chunks.
+// Like dedupRefMarker, it can't be confused with a serialized value.
+const chunkManifestMarker = 0x02
+
+// chunk manifests are the marker, an 8-byte generation, a 4-byte chunk count, and the
+// 8-byte size of the reassembled serialization.
+const chunkManifestSize = 1 + 8 + 4 + 8
+
+type chunkManifest struct {
+	generation uint64 // distinguishes chunks of different writes to the same key
+	numChunks  uint32
+	size       uint64
+}
+
+func encodeChunkManifest(m chunkManifest) []byte {
+	buf := make([]byte, chunkManifestSize)
+	buf[0] = chunkManifestMarker
+	binary.LittleEndian.PutUint64(buf[1:9], m.generation)
+	binary.LittleEndian.PutUint32(buf[9:13], m.numChunks)
+	binary.LittleEndian.PutUint64(buf[13:21], m.size)
+	return buf
+}
+
+// decodeChunkManifest returns the manifest in stored data or false if the data isn't a manifest.
+func decodeChunkManifest(data []byte) (m chunkManifest, ok bool) {
+	if len(data) != chunkManifestSize || data[0] != chunkManifestMarker {
+		return
+	}
+	m.generation = binary.LittleEndian.Uint64(data[1:9])
+	m.numChunks = binary.LittleEndian.Uint32(data[9:13])
+	m.size = binary.LittleEndian.Uint64(data[13:21])
+	return m, true
+}
+
+var lastChunkGeneration uint64
+
+// nextChunkGeneration returns a unique, increasing generation based on the current time.
+func nextChunkGeneration() uint64 {
+	for {
+		last := atomic.LoadUint64(&lastChunkGeneration)
+		gen := uint64(time.Now().UnixNano())
+		if gen <= last {
+			gen = last + 1
+		}
+		if atomic.CompareAndSwapUint64(&lastChunkGeneration, last, gen) {
+			return gen
+		}
+	}
+}
+
+// NewChunkTKey returns the type-specific key for a chunk of a large value of "key".
+func NewChunkTKey(key string, generation uint64, index uint32) storage.TKey {
+	ibytes := make([]byte, len(key)+1+8+4)
+	copy(ibytes, key)
+	binary.BigEndian.PutUint64(ibytes[len(key)+1:], generation)
+	binary.BigEndian.PutUint32(ibytes[len(key)+9:], index)
+	return storage.NewTKey(keyChunk, ibytes)
+}
+
+// putValue adds the put of a serialized value to the batch, splitting it into chunks if it
+// exceeds the instance's ChunkSize, and returns the value stored under the key.  Any chunks
+// of the key's previously stored value, given by old, are deleted.
+func (d *Data) putValue(batch storage.Batch, keyStr string, tk storage.TKey, serialization, old []byte) (stored []byte) {
+	d.deleteChunks(batch, keyStr, old)
+	if d.ChunkSize <= 0 || len(serialization) <= d.ChunkSize {
+		batch.Put(tk, serialization)
+		return serialization
+	}
+	m := chunkManifest{
+		generation: nextChunkGeneration(),
+		numChunks:  uint32((len(serialization) + d.ChunkSize - 1) / d.ChunkSize),
+		size:       uint64(len(serialization)),
+	}
+	for i := uint32(0); i < m.numChunks; i++ {
+		start := int(i) * d.ChunkSize
+		end := start + d.ChunkSize
+		if end > len(serialization) {
+			end = len(serialization)
+		}
+		batch.Put(NewChunkTKey(keyStr, m.generation, i), serialization[start:end])
+	}
+	stored = encodeChunkManifest(m)
+	batch.Put(tk, stored)
+	return stored
+}
+
+// deleteChunks adds deletes of any chunks referenced by the stored data to the batch.
+func (d *Data) deleteChunks(batch storage.Batch, keyStr string, stored []byte) {
+	m, ok := decodeChunkManifest(stored)
+	if !ok {
+		return
+	}
+	for i := uint32(0); i < m.numChunks; i++ {
+		batch.Delete(NewChunkTKey(keyStr, m.generation, i))
+	}
+}
+
+// deleteAllChunks deletes the chunks referenced by the stored data of each key.
+func (d *Data) deleteAllChunks(ctx storage.Context, db storage.OrderedKeyValueDB, stored map[string][]byte) error {
+	batcher, ok := db.(storage.KeyValueBatcher)
+	if !ok {
+		return fmt.Errorf("keyvalue %q chunking requires a batch-capable store", d.DataName())
+	}
+	batch := batcher.NewBatch(ctx)
+	for keyStr, data := range stored {
+		d.deleteChunks(batch, keyStr, data)
+	}
+	return batch.Commit()
+}
+
+// putChunked atomically puts a serialized value that may be chunked, removing chunks of
+// any previous value and updating the last-modified timestamp if tracked.
+func (d *Data) putChunked(ctx storage.Context, db storage.OrderedKeyValueDB, keyStr string, tk storage.TKey, serialization []byte) error {
+	batcher, ok := db.(storage.KeyValueBatcher)
+	if !ok {
+		return fmt.Errorf("keyvalue %q chunking requires a batch-capable store", d.DataName())
+	}
+	old, err := db.Get(ctx, tk)
+	if err != nil {
+		return err
+	}
+	batch := batcher.NewBatch(ctx)
+	d.putValue(batch, keyStr, tk, serialization, old)
+	if d.TrackModified {
+		modTK, err := NewModifiedTKey(keyStr)
+		if err != nil {
+			return err
+		}
+		storage.PutUnmetered(batch, modTK, encodeTimestamp(time.Now()))
+	}
+	return batch.Commit()
+}
+
+// deleteChunked atomically deletes a key and the chunks of its value.
+func (d *Data) deleteChunked(ctx storage.Context, db storage.OrderedKeyValueDB, keyStr string, tk storage.TKey) error {
+	batcher, ok := db.(storage.KeyValueBatcher)
+	if !ok {
+		return fmt.Errorf("keyvalue %q chunking requires a batch-capable store", d.DataName())
+	}
+	old, err := db.Get(ctx, tk)
+	if err != nil {
+		return err
+	}
+	batch := batcher.NewBatch(ctx)
+	d.deleteChunks(batch, keyStr, old)
+	batch.Delete(tk)
+	return batch.Commit()
+}
+
+// reassembleChunks returns the serialization stored across the chunks of a manifest.
+func (d *Data) reassembleChunks(ctx storage.Context, db storage.OrderedKeyValueDB, keyStr string, m chunkManifest) ([]byte, error) {
+	serialization := make([]byte, 0, m.size)
+	for i := uint32(0); i < m.numChunks; i++ {
+		chunk, err := db.Get(ctx, NewChunkTKey(keyStr, m.generation, i))
+		if err != nil {
+			return nil, err
+		}
+		if chunk == nil {
+			return nil, fmt.Errorf("missing chunk %d of %d for key %q", i, m.numChunks, keyStr)
+		}
+		serialization = append(serialization, chunk...)
+	}
+	if uint64(len(serialization)) != m.size {
+		return nil, fmt.Errorf("chunks of key %q have %d bytes, expected %d", keyStr, len(serialization), m.size)
+	}
+	return serialization, nil
+}
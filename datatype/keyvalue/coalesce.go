@@ -0,0 +1,133 @@
+/*
+	This file supports optional coalescing of rapid writes to the same key, where puts are
+	buffered in memory and only the latest value of each key is written on an interval.
+*/
+
+package keyvalue
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+type coalescedKey struct {
+	v   dvid.VersionID
+	key string
+}
+
+type coalescedWrite struct {
+	ctx   storage.Context
+	value []byte
+	seq   uint64 // distinguishes a buffered write from later writes of the same key
+}
+
+// checkCoalesce returns an error if writes are coalesced along with a limit that can't be
+// enforced on buffered writes, since a write rejected at flush can only be logged.
+func (p *Properties) checkCoalesce(name dvid.InstanceName, quota uint64) error {
+	if p.CoalesceInterval == 0 {
+		return nil
+	}
+	if p.MaxKeys != 0 {
+		return fmt.Errorf("keyvalue %q can't set both CoalesceInterval and MaxKeys", name)
+	}
+	if quota != 0 {
+		return fmt.Errorf("keyvalue %q can't set both CoalesceInterval and Quota", name)
+	}
+	return nil
+}
+
+// coalesceInterval returns how long puts are buffered, or zero if writes aren't coalesced.
+func (d *Data) coalesceInterval() time.Duration {
+	d.coalesceMu.Lock()
+	defer d.coalesceMu.Unlock()
+	return d.CoalesceInterval
+}
+
+// bufferWrite holds the latest value of a key until the next flush.  It returns false
+// without buffering if writes are no longer coalesced, so the caller must write the value.
+func (d *Data) bufferWrite(ctx storage.Context, keyStr string, value []byte) bool {
+	d.coalesceMu.Lock()
+	defer d.coalesceMu.Unlock()
+	if d.CoalesceInterval <= 0 {
+		return false
+	}
+	if d.coalesced == nil {
+		d.coalesced = make(map[coalescedKey]coalescedWrite)
+	}
+	d.coalesceSeq++
+	d.coalesced[coalescedKey{ctx.VersionID(), keyStr}] = coalescedWrite{ctx, value, d.coalesceSeq}
+	return true
+}
+
+// bufferedValue returns the buffered value of a key, if any.
+func (d *Data) bufferedValue(ctx storage.Context, keyStr string) (value []byte, found bool) {
+	d.coalesceMu.Lock()
+	w, found := d.coalesced[coalescedKey{ctx.VersionID(), keyStr}]
+	d.coalesceMu.Unlock()
+	return w.value, found
+}
+
+// flushWrites writes all buffered values to the store.  Each value stays buffered until
+// it is written, so reads during a flush never miss it, and is then dropped unless the key
+// was put again in the meantime.  Since the puts that were buffered have already returned,
+// write errors are logged.
+func (d *Data) flushWrites() {
+	d.flushMu.Lock()
+	defer d.flushMu.Unlock()
+
+	d.coalesceMu.Lock()
+	pending := make(map[coalescedKey]coalescedWrite, len(d.coalesced))
+	for k, w := range d.coalesced {
+		pending[k] = w
+	}
+	d.coalesceMu.Unlock()
+
+	for k, w := range pending {
+		if err := d.writeData(w.ctx, k.key, w.value, nil, nil, nil); err != nil {
+			dvid.Errorf("keyvalue %q: unable to flush buffered write of key %q: %v\n", d.DataName(), k.key, err)
+		}
+		d.coalesceMu.Lock()
+		if cur, found := d.coalesced[k]; found && cur.seq == w.seq {
+			delete(d.coalesced, k)
+		}
+		d.coalesceMu.Unlock()
+	}
+}
+
+func (d *Data) startFlusher() {
+	d.coalesceMu.Lock()
+	defer d.coalesceMu.Unlock()
+	d.flushOnce.Do(func() {
+		d.flushDone = make(chan struct{})
+		go d.flushWritesLoop(d.flushDone)
+	})
+}
+
+// flushWritesLoop flushes buffered writes on each interval.  If writes stop being
+// coalesced, it flushes what remains and exits so a later positive interval restarts it.
+func (d *Data) flushWritesLoop(done <-chan struct{}) {
+	for {
+		interval := d.coalesceInterval()
+		if interval <= 0 {
+			d.flushWrites()
+			d.coalesceMu.Lock()
+			if d.CoalesceInterval <= 0 {
+				d.flushOnce = sync.Once{}
+				d.coalesceMu.Unlock()
+				return
+			}
+			d.coalesceMu.Unlock()
+			continue
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+			d.flushWrites()
+		}
+	}
+}
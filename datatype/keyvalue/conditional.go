@@ -0,0 +1,129 @@
+/*
+	This file supports deletes that only proceed if a key's value hasn't changed since the
+	client read it, using entity tags or last-modified times, and writes that only create
+	absent keys.
+*/
+
+package keyvalue
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// ErrPreconditionFailed is returned when a conditional delete finds the key has changed.
+var ErrPreconditionFailed = errors.New("key does not match the given precondition")
+
+// ErrKeyExists is returned when a create-only write finds the key already exists.
+var ErrKeyExists = errors.New("key already exists")
+
+// ValueETag returns the strong entity tag of a value, which is its quoted, hex-encoded MD5.
+func ValueETag(value []byte) string {
+	sum := md5.Sum(value)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// Precondition is the state a key must have for a conditional delete to proceed.  The
+// zero value has no conditions.
+type Precondition struct {
+	// IfMatch, if non-empty, is a comma-separated list of entity tags, one of which must
+	// match the current value, or "*" to match any existing value, as in the HTTP If-Match
+	// header.
+	IfMatch string
+
+	// IfUnmodifiedSince, if non-zero, is a time the key must not have been modified
+	// after, as in the HTTP If-Unmodified-Since header.  Requires TrackModified.
+	IfUnmodifiedSince time.Time
+}
+
+// matchesETag returns true if a list of entity tags from an If-Match header includes the
+// tag of the value.  Weak tags are compared by their opaque part.
+func matchesETag(ifMatch string, value []byte) bool {
+	etag := ValueETag(value)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteDataIf deletes a key-value pair only if it satisfies the precondition, returning
+// ErrPreconditionFailed otherwise.  Writes are held off between the check and the delete
+// so the key can't change in between.
+func (d *Data) DeleteDataIf(ctx storage.Context, keyStr string, cond Precondition) error {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	tk, err := NewTKey(keyStr)
+	if err != nil {
+		return err
+	}
+	defer d.uncache(ctx, keyStr)
+	// hold off writes, which take indexMu for reading, and avoid calls that flush
+	// buffered writes while it's held.
+	d.indexMu.Lock()
+	defer d.indexMu.Unlock()
+	if cond.IfMatch != "" {
+		value, found, err := d.GetData(ctx, keyStr)
+		if err != nil {
+			return err
+		}
+		if !found || !matchesETag(cond.IfMatch, value) {
+			return ErrPreconditionFailed
+		}
+	}
+	if !cond.IfUnmodifiedSince.IsZero() {
+		if !d.TrackModified {
+			return fmt.Errorf("keyvalue %q does not track last-modified times; set TrackModified for If-Unmodified-Since", d.DataName())
+		}
+		modified, found, err := getModified(ctx, db, keyStr)
+		if err != nil {
+			return err
+		}
+		// HTTP dates have one-second resolution.
+		if found && modified.Truncate(time.Second).After(cond.IfUnmodifiedSince) {
+			return ErrPreconditionFailed
+		}
+	}
+	return d.deleteData(ctx, db, keyStr, tk)
+}
+
+// PutDataIfAbsent puts a key-value only if the key doesn't exist, returning ErrKeyExists
+// otherwise.  Writes are held off between the check and the put, so of concurrent creates
+// of a key, exactly one succeeds, e.g., for leader election flags.
+func (d *Data) PutDataIfAbsent(ctx storage.Context, keyStr string, value []byte) error {
+	serialization, err := d.encodeValue(value)
+	if err != nil {
+		return err
+	}
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	tk, err := NewTKey(keyStr)
+	if err != nil {
+		return err
+	}
+	d.indexMu.Lock()
+	defer d.indexMu.Unlock()
+	exists, err := keyExists(ctx, db, tk)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrKeyExists
+	}
+	return d.putSerialization(ctx, db, keyStr, value, serialization)
+}
@@ -0,0 +1,126 @@
+/*
+	This file supports deduplicated storage of values, where identical payloads are stored
+	once under their content hash and keys hold references to the payload.
+*/
+
+package keyvalue
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// dedupRefMarker is the first byte of a stored value that references a deduplicated payload.
+// The low three bits of a dvid.SerializationFormat byte are 0b000 or 0b100, so this and the
+// other marker values 0x02, 0x03, and 0x05 can't be confused with a serialized value.
+const dedupRefMarker = 0x01
+
+const dedupRefSize = 1 + sha256.Size
+
+func encodeDedupRef(hash []byte) []byte {
+	ref := make([]byte, dedupRefSize)
+	ref[0] = dedupRefMarker
+	copy(ref[1:], hash)
+	return ref
+}
+
+func isDedupRef(data []byte) bool {
+	return len(data) == dedupRefSize && data[0] == dedupRefMarker
+}
+
+// resolveValue returns the serialized value for the stored data of a key, following a
+// reference to a deduplicated payload or reassembling chunks if necessary.
+func (d *Data) resolveValue(ctx storage.Context, db storage.OrderedKeyValueDB, keyStr string, data []byte) ([]byte, error) {
+	if m, ok := decodeChunkManifest(data); ok {
+		return d.reassembleChunks(ctx, db, keyStr, m)
+	}
+	if !isDedupRef(data) {
+		return data, nil
+	}
+	payload, err := db.Get(ctx, NewDedupTKey(data[1:]))
+	if err != nil {
+		return nil, err
+	}
+	if payload == nil {
+		return nil, fmt.Errorf("missing deduplicated payload %x", data[1:])
+	}
+	return payload, nil
+}
+
+// PutDedupData puts a key-value where the value is stored once per unique content and
+// the key holds a reference to that payload.  Values no larger than the instance's
+// InlineSize are stored directly under the key, and values larger than its ChunkSize are
+// chunked instead of deduplicated.
+func (d *Data) PutDedupData(ctx storage.Context, keyStr string, value []byte) error {
+	d.flushWrites()
+	if len(value) <= d.InlineSize || len(value) == 0 || (d.ChunkSize > 0 && len(value) > d.ChunkSize) {
+		return d.PutData(ctx, keyStr, value)
+	}
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	batcher, ok := db.(storage.KeyValueBatcher)
+	if !ok {
+		return fmt.Errorf("keyvalue %q dedup import requires a batch-capable store", d.DataName())
+	}
+	tk, err := NewTKey(keyStr)
+	if err != nil {
+		return err
+	}
+	d.indexMu.RLock()
+	defer d.indexMu.RUnlock()
+	var oldEntry indexEntry
+	if d.IndexField != "" {
+		if oldEntry, err = d.storedIndexEntry(ctx, db, keyStr, tk); err != nil {
+			return err
+		}
+	}
+	defer d.uncache(ctx, keyStr)
+	err = d.withKeyLimit(ctx, db, map[string]bool{keyStr: true}, func() error {
+		return d.putDedupRef(ctx, db, batcher, keyStr, tk, value)
+	})
+	if err == nil && d.IndexField != "" {
+		err = d.updateIndex(ctx, db, keyStr, oldEntry, value)
+	}
+	return err
+}
+
+// putDedupRef writes the key's reference and, if not already stored, the payload.
+func (d *Data) putDedupRef(ctx storage.Context, db storage.OrderedKeyValueDB, batcher storage.KeyValueBatcher, keyStr string, tk storage.TKey, value []byte) error {
+	hash := sha256.Sum256(value)
+	payloadTK := NewDedupTKey(hash[:])
+
+	batch := batcher.NewBatch(ctx)
+	existing, err := db.Get(ctx, payloadTK)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		serialization, err := d.encodeValue(value)
+		if err != nil {
+			return err
+		}
+		batch.Put(payloadTK, serialization)
+	}
+	if d.ChunkSize > 0 {
+		old, err := db.Get(ctx, tk)
+		if err != nil {
+			return err
+		}
+		d.deleteChunks(batch, keyStr, old)
+	}
+	batch.Put(tk, encodeDedupRef(hash[:]))
+	if d.TrackModified {
+		modTK, err := NewModifiedTKey(keyStr)
+		if err != nil {
+			return err
+		}
+		storage.PutUnmetered(batch, modTK, encodeTimestamp(time.Now()))
+	}
+	return batch.Commit()
+}
@@ -0,0 +1,338 @@
+/*
+	This file supports compression of small values with a dictionary trained from sampled
+	values of the instance, which shrinks homogeneous small values that compress poorly
+	on their own.
+*/
+
+package keyvalue
+
+import (
+	"bytes"
+	"compress/flate"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// dictValueMarker is the first byte of a serialization compressed with a trained
+// dictionary.  Like dedupRefMarker, it can't be confused with a serialized value.
+const dictValueMarker = 0x05
+
+const (
+	// MaxCompressionDictSize is the maximum size of a trained dictionary, which is the
+	// window of DEFLATE compression.
+	MaxCompressionDictSize = 32 * 1024
+
+	// DefaultCompressionDictSize is the default size of a trained dictionary.
+	DefaultCompressionDictSize = 16 * 1024
+
+	// DefaultDictSamples is the default number of values sampled to train a dictionary.
+	DefaultDictSamples = 1000
+
+	// DefaultDictMaxValueSize is the default size of the largest values sampled for training
+	// and compressed with the dictionary.
+	DefaultDictMaxValueSize = 4096
+)
+
+// dictSegmentSize is the length of the segments of sampled values that are chosen for the
+// dictionary, and dictGramSize is the length of the substrings counted across samples to
+// score segments.
+const (
+	dictSegmentSize = 32
+	dictGramSize    = 8
+)
+
+// compressionDicts are the trained dictionaries of an instance, which are kept in the
+// instance's metadata after its properties.  Dictionaries are never removed so values
+// compressed with earlier dictionaries still decode.
+type compressionDicts struct {
+	Current      uint32 // ID of the dictionary used for new values, 0 if none
+	MaxValueSize int    // values up to this size are compressed with the current dictionary
+	Dicts        map[uint32][]byte
+}
+
+// DictTrainingOptions are the settings for training a compression dictionary.
+type DictTrainingOptions struct {
+	Size         int // maximum bytes of the dictionary
+	Samples      int // maximum number of values sampled
+	MaxValueSize int // only values up to this size are sampled and later compressed
+}
+
+// CompressionDictInfo describes a trained compression dictionary.
+type CompressionDictInfo struct {
+	ID           uint32
+	Size         int
+	Current      bool
+	Samples      int `json:",omitempty"` // values sampled, only given after training
+	MaxValueSize int `json:",omitempty"` // only given for the current dictionary
+}
+
+// compressionDict returns the dictionary with the given ID or nil if there is none.
+func (d *Data) compressionDict(id uint32) []byte {
+	d.dictMu.RLock()
+	defer d.dictMu.RUnlock()
+	return d.dicts.Dicts[id]
+}
+
+// GetCompressionDicts describes the instance's trained dictionaries in ID order.
+func (d *Data) GetCompressionDicts() []CompressionDictInfo {
+	d.dictMu.RLock()
+	defer d.dictMu.RUnlock()
+	infos := []CompressionDictInfo{}
+	for id, dict := range d.dicts.Dicts {
+		info := CompressionDictInfo{ID: id, Size: len(dict), Current: id == d.dicts.Current}
+		if info.Current {
+			info.MaxValueSize = d.dicts.MaxValueSize
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// TrainCompressionDict samples values visible in the given context, trains a dictionary
+// from them, and makes it the dictionary used to compress new values up to
+// opts.MaxValueSize.  Existing values are not rewritten.  The instance's metadata is saved
+// with the new dictionary.
+func (d *Data) TrainCompressionDict(ctx *datastore.VersionedCtx, opts DictTrainingOptions) (*CompressionDictInfo, error) {
+	if opts.Size <= 0 || opts.Size > MaxCompressionDictSize {
+		return nil, fmt.Errorf("dictionary size must be between 1 and %d bytes, got %d", MaxCompressionDictSize, opts.Size)
+	}
+	if opts.Samples <= 0 || opts.MaxValueSize <= 0 {
+		return nil, fmt.Errorf("dictionary training needs a positive number of samples and maximum value size")
+	}
+
+	// reservoir sample the small values with a fixed seed so training is repeatable.
+	var samples [][]byte
+	var seen int
+	rng := rand.New(rand.NewSource(1))
+	err := d.ProcessKeyValues(ctx, func(key string, value []byte) error {
+		if len(value) == 0 || len(value) > opts.MaxValueSize {
+			return nil
+		}
+		seen++
+		if len(samples) < opts.Samples {
+			samples = append(samples, value)
+		} else if i := rng.Intn(seen); i < opts.Samples {
+			samples[i] = value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) < 2 {
+		return nil, fmt.Errorf("need at least 2 non-empty values of at most %d bytes to train a dictionary, found %d", opts.MaxValueSize, len(samples))
+	}
+	dict := trainDict(samples, opts.Size)
+	if len(dict) == 0 {
+		return nil, fmt.Errorf("sampled values share no content to build a dictionary from")
+	}
+
+	d.dictMu.Lock()
+	var id uint32
+	for existing := range d.dicts.Dicts {
+		if existing > id {
+			id = existing
+		}
+	}
+	id++
+	if d.dicts.Dicts == nil {
+		d.dicts.Dicts = make(map[uint32][]byte)
+	}
+	d.dicts.Dicts[id] = dict
+	d.dicts.Current = id
+	d.dicts.MaxValueSize = opts.MaxValueSize
+	d.dictMu.Unlock()
+
+	if err := datastore.SaveDataByVersion(ctx.VersionID(), d); err != nil {
+		return nil, err
+	}
+	return &CompressionDictInfo{ID: id, Size: len(dict), Current: true, Samples: len(samples), MaxValueSize: opts.MaxValueSize}, nil
+}
+
+// StopCompressionDict stops compressing new values with a dictionary.  Dictionaries are
+// kept so existing values still decode.
+func (d *Data) StopCompressionDict(ctx *datastore.VersionedCtx) error {
+	d.dictMu.Lock()
+	d.dicts.Current = 0
+	d.dictMu.Unlock()
+	return datastore.SaveDataByVersion(ctx.VersionID(), d)
+}
+
+// dictSegment is a candidate segment of a sampled value with its score, the summed sample
+// counts of its substrings not already covered by the dictionary.
+type dictSegment struct {
+	data  []byte
+	score int
+}
+
+type segmentHeap []dictSegment
+
+func (h segmentHeap) Len() int            { return len(h) }
+func (h segmentHeap) Less(i, j int) bool  { return h[i].score > h[j].score }
+func (h segmentHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *segmentHeap) Push(x interface{}) { *h = append(*h, x.(dictSegment)) }
+func (h *segmentHeap) Pop() interface{} {
+	old := *h
+	seg := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return seg
+}
+
+func gramHash(gram []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(gram)
+	return h.Sum64()
+}
+
+// segmentScore sums the counts of the distinct substrings of a segment.
+func segmentScore(seg []byte, counts map[uint64]int) int {
+	var score int
+	scored := make(map[uint64]bool)
+	for i := 0; i+dictGramSize <= len(seg); i++ {
+		g := gramHash(seg[i : i+dictGramSize])
+		if !scored[g] {
+			scored[g] = true
+			score += counts[g]
+		}
+	}
+	return score
+}
+
+// trainDict builds a dictionary of at most size bytes from the segments of the samples
+// whose substrings occur in the most samples.  Each chosen segment's substrings stop
+// counting toward later segments so the dictionary covers varied content.  The best
+// segments are placed at the end of the dictionary, closest to the compressed data.
+func trainDict(samples [][]byte, size int) []byte {
+	// count the number of samples each substring occurs in.
+	counts := make(map[uint64]int)
+	for _, sample := range samples {
+		inSample := make(map[uint64]bool)
+		for i := 0; i+dictGramSize <= len(sample); i++ {
+			g := gramHash(sample[i : i+dictGramSize])
+			if !inSample[g] {
+				inSample[g] = true
+				counts[g]++
+			}
+		}
+	}
+	// substrings in only one sample don't help compress other values.
+	for g, n := range counts {
+		if n < 2 {
+			delete(counts, g)
+		}
+	}
+
+	var h segmentHeap
+	for _, sample := range samples {
+		for beg := 0; beg < len(sample); beg += dictSegmentSize / 2 {
+			end := beg + dictSegmentSize
+			if end > len(sample) {
+				end = len(sample)
+			}
+			seg := sample[beg:end]
+			if score := segmentScore(seg, counts); score > 0 {
+				h = append(h, dictSegment{data: seg, score: score})
+			}
+			if end == len(sample) {
+				break
+			}
+		}
+	}
+	heap.Init(&h)
+
+	// greedily take the best segment, rescoring lazily as chosen substrings are removed.
+	var chosen [][]byte
+	var total int
+	for h.Len() > 0 && total < size {
+		seg := heap.Pop(&h).(dictSegment)
+		if score := segmentScore(seg.data, counts); score < seg.score {
+			if score > 0 {
+				seg.score = score
+				heap.Push(&h, seg)
+			}
+			continue
+		}
+		if total+len(seg.data) > size {
+			seg.data = seg.data[:size-total]
+		}
+		chosen = append(chosen, seg.data)
+		total += len(seg.data)
+		for i := 0; i+dictGramSize <= len(seg.data); i++ {
+			delete(counts, gramHash(seg.data[i:i+dictGramSize]))
+		}
+	}
+	dict := make([]byte, 0, total)
+	for i := len(chosen) - 1; i >= 0; i-- {
+		dict = append(dict, chosen[i]...)
+	}
+	return dict
+}
+
+// encodeWithDict serializes a value without compression and compresses the serialization
+// with the current dictionary, returning the marker, the dictionary ID, and the compressed
+// serialization.  If there is no current dictionary, the value is too large, or the
+// dictionary doesn't shrink it, ok is false.
+func (d *Data) encodeWithDict(value []byte) (serialization []byte, ok bool, err error) {
+	d.dictMu.RLock()
+	id, maxSize := d.dicts.Current, d.dicts.MaxValueSize
+	dict := d.dicts.Dicts[id]
+	d.dictMu.RUnlock()
+	if id == 0 || len(value) == 0 || len(value) > maxSize {
+		return nil, false, nil
+	}
+	var uncompressed dvid.Compression // zero value is no compression
+	inner, err := dvid.SerializeDataWithCodec(value, d.Codec(), uncompressed, d.ChecksumFor(len(value)))
+	if err != nil {
+		return nil, false, fmt.Errorf("Unable to serialize data: %v\n", err)
+	}
+	var header [5]byte
+	header[0] = dictValueMarker
+	binary.LittleEndian.PutUint32(header[1:], id)
+	var buf bytes.Buffer
+	buf.Write(header[:])
+	w, err := flate.NewWriterDict(&buf, flate.BestCompression, dict)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err = w.Write(inner); err != nil {
+		return nil, false, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, false, err
+	}
+	if buf.Len() >= len(inner) {
+		return nil, false, nil
+	}
+	return buf.Bytes(), true, nil
+}
+
+// decodeDictValue returns the decompressed serialization of data compressed with a
+// dictionary, or ok false if data wasn't compressed with one.
+func (d *Data) decodeDictValue(data []byte) (inner []byte, ok bool, err error) {
+	if len(data) == 0 || data[0] != dictValueMarker {
+		return nil, false, nil
+	}
+	if len(data) < 5 {
+		return nil, false, fmt.Errorf("truncated dictionary-compressed value")
+	}
+	id := binary.LittleEndian.Uint32(data[1:5])
+	dict := d.compressionDict(id)
+	if dict == nil {
+		return nil, false, fmt.Errorf("value compressed with unknown dictionary %d", id)
+	}
+	r := flate.NewReaderDict(bytes.NewReader(data[5:]), dict)
+	defer r.Close()
+	if inner, err = ioutil.ReadAll(r); err != nil {
+		return nil, false, fmt.Errorf("unable to decompress value with dictionary %d: %v", id, err)
+	}
+	return inner, true, nil
+}
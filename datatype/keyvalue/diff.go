@@ -0,0 +1,259 @@
+/*
+	This file supports comparing two values, e.g., of two keys or of a key at two versions,
+	returning a unified line diff for text and the first differing offset for binary data.
+*/
+
+package keyvalue
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// DiffContextLines is the number of unchanged lines shown around changes in a unified diff.
+const DiffContextLines = 3
+
+// maxDiffEdits is the maximum number of inserted and deleted lines for which a line diff
+// is computed, which bounds its memory and time.  Values with more changes are summarized.
+const maxDiffEdits = 2000
+
+// diffLine is a line of a diff: unchanged (' '), deleted from a ('-'), or inserted from b ('+').
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// isText returns true if the value should be compared line by line.
+func isText(value []byte) bool {
+	return utf8.Valid(value) && bytes.IndexByte(value, 0) < 0
+}
+
+// splitLines splits text into lines that keep their trailing newline.
+func splitLines(value []byte) []string {
+	var lines []string
+	for len(value) != 0 {
+		i := bytes.IndexByte(value, '\n') + 1
+		if i == 0 {
+			i = len(value)
+		}
+		lines = append(lines, string(value[:i]))
+		value = value[i:]
+	}
+	return lines
+}
+
+// diffLines returns the shortest edit script of lines transforming a into b, using Myers'
+// algorithm, or false if it would take more than maxDiffEdits edits.
+func diffLines(a, b []string) ([]diffLine, bool) {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int // furthest x for each diagonal k in [-d, d] after d edits
+	found := false
+	for d := 0; d <= max && d <= maxDiffEdits && !found; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+			}
+		}
+		snapshot := make([]int, 2*d+1)
+		copy(snapshot, v[offset-d:offset+d+1])
+		trace = append(trace, snapshot)
+	}
+	if !found {
+		return nil, false
+	}
+
+	// backtrack from the end through the saved paths.
+	var reversed []diffLine
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := prev[prevK+d-1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, diffLine{' ', a[x]})
+		}
+		if x == prevX {
+			y--
+			reversed = append(reversed, diffLine{'+', b[y]})
+		} else {
+			x--
+			reversed = append(reversed, diffLine{'-', a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		reversed = append(reversed, diffLine{' ', a[x]})
+	}
+	lines := make([]diffLine, len(reversed))
+	for i, line := range reversed {
+		lines[len(reversed)-1-i] = line
+	}
+	return lines, true
+}
+
+// writeUnifiedDiff writes the diff lines as hunks of a unified diff.
+func writeUnifiedDiff(w io.Writer, labelA, labelB string, lines []diffLine) error {
+	var changes []int
+	for i, line := range lines {
+		if line.op != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "--- %s\n+++ %s\n", labelA, labelB); err != nil {
+		return err
+	}
+	for c := 0; c < len(changes); {
+		// extend the hunk while the next change is within the context of the last.
+		last := c
+		for last+1 < len(changes) && changes[last+1]-changes[last] <= 2*DiffContextLines {
+			last++
+		}
+		beg := changes[c] - DiffContextLines
+		if beg < 0 {
+			beg = 0
+		}
+		end := changes[last] + DiffContextLines + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+		var aBefore, bBefore, aCount, bCount int
+		for i, line := range lines[:end] {
+			inHunk := i >= beg
+			if line.op != '+' {
+				if inHunk {
+					aCount++
+				} else {
+					aBefore++
+				}
+			}
+			if line.op != '-' {
+				if inHunk {
+					bCount++
+				} else {
+					bBefore++
+				}
+			}
+		}
+		aStart, bStart := aBefore+1, bBefore+1
+		if aCount == 0 {
+			aStart = aBefore
+		}
+		if bCount == 0 {
+			bStart = bBefore
+		}
+		if _, err := fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount); err != nil {
+			return err
+		}
+		for _, line := range lines[beg:end] {
+			text := line.text
+			if !strings.HasSuffix(text, "\n") {
+				text += "\n\\ No newline at end of file\n"
+			}
+			if _, err := fmt.Fprintf(w, "%c%s", line.op, text); err != nil {
+				return err
+			}
+		}
+		c = last + 1
+	}
+	return nil
+}
+
+// WriteValueDiff writes the differences between two values, labeled for a diff header.
+// If both are text, a unified diff is written, and otherwise, the first offset at which
+// they differ.  Nothing is written if the values are identical.
+func WriteValueDiff(w io.Writer, labelA, labelB string, a, b []byte) error {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	if isText(a) && isText(b) {
+		lines, ok := diffLines(splitLines(a), splitLines(b))
+		if ok {
+			return writeUnifiedDiff(w, labelA, labelB, lines)
+		}
+	}
+	offset := 0
+	for offset < len(a) && offset < len(b) && a[offset] == b[offset] {
+		offset++
+	}
+	if isText(a) && isText(b) {
+		_, err := fmt.Fprintf(w, "Values %s and %s differ at offset %d (%d and %d bytes) with too many changes for a line diff\n", labelA, labelB, offset, len(a), len(b))
+		return err
+	}
+	_, err := fmt.Fprintf(w, "Binary values %s and %s differ at offset %d (%d and %d bytes)\n", labelA, labelB, offset, len(a), len(b))
+	return err
+}
+
+// handleCompare writes the differences between the values of the "a" and "b" keys, which
+// can be read at the "aversion" and "bversion" ancestors of the requested version.  A
+// missing key is compared as an empty value labeled "/dev/null", but it is an error if
+// both are missing.
+func (d *Data) handleCompare(w http.ResponseWriter, r *http.Request, ctx *datastore.VersionedCtx, uuid dvid.UUID) (keyA, keyB string, err error) {
+	query := r.URL.Query()
+	keyA, keyB = query.Get("a"), query.Get("b")
+	if keyA == "" {
+		return "", "", fmt.Errorf("compare requires a key in the \"a\" query string")
+	}
+	if keyB == "" {
+		keyB = keyA
+	}
+	var values [2][]byte
+	var labels [2]string
+	var found [2]bool
+	for i, side := range []struct{ key, version string }{{keyA, query.Get("aversion")}, {keyB, query.Get("bversion")}} {
+		sideCtx, version := ctx, string(uuid)
+		if side.version != "" {
+			if sideCtx, err = d.AncestorCtx(ctx, side.version); err != nil {
+				return
+			}
+			version = side.version
+		}
+		if values[i], found[i], err = d.GetData(sideCtx, side.key); err != nil {
+			return
+		}
+		labels[i] = side.key + "@" + version
+		if !found[i] {
+			labels[i] = "/dev/null"
+		}
+	}
+	if !found[0] && !found[1] {
+		return "", "", fmt.Errorf("neither key %q nor key %q exists at the compared versions", keyA, keyB)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	err = WriteValueDiff(w, labels[0], labels[1], values[0], values[1])
+	return
+}
@@ -0,0 +1,312 @@
+/*
+	This file supports a read-only scan that reports keys sharing identical values and the
+	space that deduplicating them would reclaim.
+*/
+
+package keyvalue
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// DefaultDuplicateGroups is the default number of duplicate groups listed in a report.
+const DefaultDuplicateGroups = 100
+
+// MaxDuplicateGroupKeys is the maximum number of keys listed for each duplicate group.
+const MaxDuplicateGroupKeys = 100
+
+// duplicateScanMemRecords is the number of scanned values held in memory before they are
+// spilled to partitioned temporary files.
+var duplicateScanMemRecords = 1 << 20
+
+// numDuplicatePartitions is the number of temporary files, partitioned by the first byte
+// of the content hash, that scanned values are spilled to.
+const numDuplicatePartitions = 256
+
+// DuplicateGroup is a value shared by more than one key.
+type DuplicateGroup struct {
+	Hash             string   // hex-encoded SHA-256 of the value
+	Size             uint64   // stored bytes of one copy of the value
+	Count            int      // number of keys with the value
+	ReclaimableBytes uint64   // stored bytes saved if the value were stored once
+	Keys             []string // up to MaxDuplicateGroupKeys of the keys, in sorted order
+}
+
+// DuplicateReport summarizes the values shared by more than one key.
+type DuplicateReport struct {
+	Values           uint64 // number of non-empty values scanned
+	DuplicateGroups  uint64 // number of values shared by more than one key
+	DuplicateKeys    uint64 // number of keys whose value is shared with another key
+	ReclaimableBytes uint64 // total stored bytes saved if each shared value were stored once
+
+	// Groups holds the duplicate groups with the most reclaimable bytes.
+	Groups []DuplicateGroup
+}
+
+// dupRecord is a scanned key with the hash of its value.
+type dupRecord struct {
+	hash [sha256.Size]byte
+	size uint64
+	ref  bool // stored as a reference to a deduplicated payload
+	key  string
+}
+
+// dupScanner groups scanned records by hash, holding at most duplicateScanMemRecords in
+// memory and spilling the rest to temporary files partitioned by hash.
+type dupScanner struct {
+	report    *DuplicateReport
+	maxGroups int
+	records   []dupRecord
+	dir       string
+	files     []*os.File
+	writers   []*bufio.Writer
+}
+
+func (s *dupScanner) add(rec dupRecord) error {
+	s.report.Values++
+	s.records = append(s.records, rec)
+	if len(s.records) >= duplicateScanMemRecords {
+		return s.spill()
+	}
+	return nil
+}
+
+// spill writes the in-memory records to the partition files, creating them if necessary.
+func (s *dupScanner) spill() error {
+	if s.files == nil {
+		dir, err := ioutil.TempDir("", "dvid-duplicates-")
+		if err != nil {
+			return err
+		}
+		s.dir = dir
+		for i := 0; i < numDuplicatePartitions; i++ {
+			f, err := os.Create(filepath.Join(dir, fmt.Sprintf("%03d", i)))
+			if err != nil {
+				return err
+			}
+			s.files = append(s.files, f)
+			s.writers = append(s.writers, bufio.NewWriter(f))
+		}
+	}
+	var buf [2*binary.MaxVarintLen64 + 1]byte
+	for _, rec := range s.records {
+		w := s.writers[rec.hash[0]]
+		n := binary.PutUvarint(buf[:], rec.size)
+		if rec.ref {
+			buf[n] = 1
+		} else {
+			buf[n] = 0
+		}
+		n++
+		n += binary.PutUvarint(buf[n:], uint64(len(rec.key)))
+		if _, err := w.Write(rec.hash[:]); err != nil {
+			return err
+		}
+		if _, err := w.Write(buf[:n]); err != nil {
+			return err
+		}
+		if _, err := w.WriteString(rec.key); err != nil {
+			return err
+		}
+	}
+	s.records = s.records[:0]
+	return nil
+}
+
+// readPartition returns the records spilled to a partition file.
+func readPartition(f *os.File) ([]dupRecord, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(f)
+	var records []dupRecord
+	for {
+		var rec dupRecord
+		if _, err := io.ReadFull(r, rec.hash[:]); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		ref, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		keyLen, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		key := make([]byte, keyLen)
+		if _, err := io.ReadFull(r, key); err != nil {
+			return nil, err
+		}
+		rec.size, rec.ref, rec.key = size, ref == 1, string(key)
+		records = append(records, rec)
+	}
+}
+
+// group adds the groups of records with identical hashes to the report, keeping only the
+// groups with the most reclaimable bytes.
+func (s *dupScanner) group(records []dupRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		return string(records[i].hash[:]) < string(records[j].hash[:])
+	})
+	for beg := 0; beg < len(records); {
+		end := beg + 1
+		for end < len(records) && records[end].hash == records[beg].hash {
+			end++
+		}
+		if end-beg > 1 {
+			// keys referencing a deduplicated payload already share one stored copy.
+			var copies, refs uint64
+			var keys []string
+			for _, rec := range records[beg:end] {
+				if rec.ref {
+					refs++
+				} else {
+					copies++
+				}
+				keys = append(keys, rec.key)
+			}
+			if refs != 0 {
+				copies++
+			}
+			grp := DuplicateGroup{
+				Hash:             hex.EncodeToString(records[beg].hash[:]),
+				Size:             records[beg].size,
+				Count:            end - beg,
+				ReclaimableBytes: (copies - 1) * records[beg].size,
+			}
+			sort.Strings(keys)
+			if len(keys) > MaxDuplicateGroupKeys {
+				keys = keys[:MaxDuplicateGroupKeys]
+			}
+			grp.Keys = keys
+			s.report.DuplicateGroups++
+			s.report.DuplicateKeys += uint64(grp.Count)
+			s.report.ReclaimableBytes += grp.ReclaimableBytes
+			s.report.Groups = append(s.report.Groups, grp)
+		}
+		beg = end
+	}
+	sort.Slice(s.report.Groups, func(i, j int) bool {
+		gi, gj := s.report.Groups[i], s.report.Groups[j]
+		if gi.ReclaimableBytes != gj.ReclaimableBytes {
+			return gi.ReclaimableBytes > gj.ReclaimableBytes
+		}
+		return gi.Hash < gj.Hash
+	})
+	if len(s.report.Groups) > s.maxGroups {
+		s.report.Groups = s.report.Groups[:s.maxGroups]
+	}
+}
+
+// finish groups all scanned records and removes any temporary files.
+func (s *dupScanner) finish() error {
+	if s.files == nil {
+		s.group(s.records)
+		return nil
+	}
+	if err := s.spill(); err != nil {
+		return err
+	}
+	for i, f := range s.files {
+		if err := s.writers[i].Flush(); err != nil {
+			return err
+		}
+		records, err := readPartition(f)
+		if err != nil {
+			return err
+		}
+		s.group(records)
+	}
+	return nil
+}
+
+func (s *dupScanner) close() {
+	for _, f := range s.files {
+		f.Close()
+	}
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+	}
+}
+
+// GetDuplicates scans all values visible in the given context and reports the keys that
+// share identical non-empty values, listing up to maxGroups of the groups with the most
+// reclaimable bytes.  Values are compared by the SHA-256 of their content, as for
+// deduplicated writes, and sizes are those of their stored serializations.  Keys already
+// referencing the same deduplicated payload are reported but add no reclaimable bytes.
+func (d *Data) GetDuplicates(ctx storage.Context, maxGroups int) (*DuplicateReport, error) {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	s := &dupScanner{report: &DuplicateReport{Groups: []DuplicateGroup{}}, maxGroups: maxGroups}
+	defer s.close()
+	dedupSizes := make(map[string]uint64)
+	first, last := storage.PrefixRange(keyStandard, nil)
+	err = db.ProcessRange(ctx, first, last, nil, func(c *storage.Chunk) error {
+		if c == nil || c.TKeyValue == nil {
+			return nil
+		}
+		keyStr, err := DecodeTKey(c.K)
+		if err != nil {
+			return err
+		}
+		rec := dupRecord{key: keyStr}
+		if isDedupRef(c.V) {
+			// the reference holds the hash of the value, so only the payload size is read.
+			hash := string(c.V[1:])
+			size, found := dedupSizes[hash]
+			if !found {
+				payload, err := db.Get(ctx, NewDedupTKey(c.V[1:]))
+				if err != nil {
+					return err
+				}
+				size = uint64(len(payload))
+				dedupSizes[hash] = size
+			}
+			copy(rec.hash[:], c.V[1:])
+			rec.size, rec.ref = size, true
+			return s.add(rec)
+		}
+		data, err := d.resolveValue(ctx, db, keyStr, c.V)
+		if err != nil {
+			return err
+		}
+		value, err := d.decodeValue(data)
+		if err != nil {
+			return err
+		}
+		if len(value) == 0 {
+			return nil
+		}
+		rec.hash = sha256.Sum256(value)
+		rec.size = uint64(len(data))
+		return s.add(rec)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.finish(); err != nil {
+		return nil, err
+	}
+	return s.report, nil
+}
@@ -0,0 +1,156 @@
+/*
+	This file supports checking the existence and stored sizes of many keys without
+	reading their values.
+*/
+
+package keyvalue
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// keyExists returns true if the given key is stored, using an existence check if the
+// store supports one and a full read otherwise.
+func keyExists(ctx storage.Context, db storage.OrderedKeyValueDB, tk storage.TKey) (bool, error) {
+	if checker, ok := db.(storage.KeyValueChecker); ok {
+		return checker.Exists(ctx, tk)
+	}
+	data, err := db.Get(ctx, tk)
+	if err != nil {
+		return false, err
+	}
+	return data != nil, nil
+}
+
+// KeysExist returns a slice parallel to keys that is true for each key that exists.
+func (d *Data) KeysExist(ctx storage.Context, keys []string) ([]bool, error) {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	found := make([]bool, len(keys))
+	for i, keyStr := range keys {
+		tk, err := NewTKey(keyStr)
+		if err != nil {
+			return nil, err
+		}
+		if found[i], err = keyExists(ctx, db, tk); err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
+
+// handleKeysExist reads a JSON list of keys and writes a parallel JSON list of booleans.
+func (d *Data) handleKeysExist(w http.ResponseWriter, r *http.Request, ctx storage.Context) (numKeys int, err error) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return 0, err
+	}
+	var keys []string
+	if err = json.Unmarshal(data, &keys); err != nil {
+		return 0, fmt.Errorf("expected JSON list of keys: %v", err)
+	}
+	found, err := d.KeysExist(ctx, keys)
+	if err != nil {
+		return len(keys), err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	jsonBytes, err := json.Marshal(found)
+	if err != nil {
+		return len(keys), err
+	}
+	_, err = w.Write(jsonBytes)
+	return len(keys), err
+}
+
+// KeyStat gives the existence, stored size, and last-modified time of a key.
+type KeyStat struct {
+	Found    bool
+	Size     int        `json:",omitempty"` // bytes of the stored serialization
+	Modified *time.Time `json:",omitempty"` // only if the instance tracks modification
+}
+
+// storedSize returns the bytes of the serialization stored for a key without reading
+// chunks, which are described by the key's manifest.
+func (d *Data) storedSize(ctx storage.Context, db storage.OrderedKeyValueDB, data []byte) (int, error) {
+	if m, ok := decodeChunkManifest(data); ok {
+		return int(m.size), nil
+	}
+	if isDedupRef(data) {
+		payload, err := db.Get(ctx, NewDedupTKey(data[1:]))
+		if err != nil {
+			return 0, err
+		}
+		return len(payload), nil
+	}
+	return len(data), nil
+}
+
+// StatKeys returns a slice parallel to keys giving the stat of each key.
+func (d *Data) StatKeys(ctx storage.Context, keys []string) ([]KeyStat, error) {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]KeyStat, len(keys))
+	for i, keyStr := range keys {
+		tk, err := NewTKey(keyStr)
+		if err != nil {
+			return nil, err
+		}
+		data, err := db.Get(ctx, tk)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+		stats[i].Found = true
+		if stats[i].Size, err = d.storedSize(ctx, db, data); err != nil {
+			return nil, err
+		}
+		if d.TrackModified {
+			modified, found, err := d.GetModified(ctx, keyStr)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				stats[i].Modified = &modified
+			}
+		}
+	}
+	return stats, nil
+}
+
+// handleStatKeys reads a JSON list of keys and writes a parallel JSON list of stats.
+func (d *Data) handleStatKeys(w http.ResponseWriter, r *http.Request, ctx storage.Context) (numKeys int, err error) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return 0, err
+	}
+	var keys []string
+	if err = json.Unmarshal(data, &keys); err != nil {
+		return 0, fmt.Errorf("expected JSON list of keys: %v", err)
+	}
+	stats, err := d.StatKeys(ctx, keys)
+	if err != nil {
+		return len(keys), err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	jsonBytes, err := json.Marshal(stats)
+	if err != nil {
+		return len(keys), err
+	}
+	_, err = w.Write(jsonBytes)
+	return len(keys), err
+}
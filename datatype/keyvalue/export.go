@@ -0,0 +1,207 @@
+/*
+	This file supports streaming export of all key-value pairs as newline-delimited JSON,
+	optionally gzip-compressed on the fly.
+*/
+
+package keyvalue
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// ProcessKeys sends each key of the instance to the function f in key order without
+// reading any values.
+func (d *Data) ProcessKeys(ctx storage.Context, f func(key string) error) error {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	return processKeysInRange(ctx, db, storage.MinTKey(keyStandard), storage.MaxTKey(keyStandard), f)
+}
+
+// processKeysInRange sends each key with a type-specific key in the range [first, last] to
+// the function f in key order as keys are read, without reading any values.
+func processKeysInRange(ctx storage.Context, db storage.OrderedKeyValueDB, first, last storage.TKey, f func(key string) error) error {
+	ch := make(storage.KeyChan, 1000)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- db.SendKeysInRange(ctx, first, last, ch)
+	}()
+
+	// keep receiving after an error so the sender is never blocked.
+	var processErr error
+	for k := range ch {
+		if k == nil {
+			break
+		}
+		if processErr != nil {
+			continue
+		}
+		tk, err := storage.TKeyFromKey(k)
+		if err != nil {
+			processErr = err
+			continue
+		}
+		keyStr, err := DecodeTKey(tk)
+		if err != nil {
+			processErr = err
+			continue
+		}
+		processErr = f(keyStr)
+	}
+	if err := <-errCh; err != nil {
+		return err
+	}
+	return processErr
+}
+
+// ProcessKeyValues sends each key-value pair of the instance to the function f in key order.
+func (d *Data) ProcessKeyValues(ctx storage.Context, f func(key string, value []byte) error) error {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	return d.processKeyValues(ctx, db, storage.MinTKey(keyStandard), storage.MaxTKey(keyStandard), "", f)
+}
+
+// isCompressed returns true if the value starts with the magic number of a gzip or zstd
+// stream, so compressing it again gains little beyond undoing its base64 encoding.
+func isCompressed(value []byte) bool {
+	return bytes.HasPrefix(value, []byte{0x1f, 0x8b}) || bytes.HasPrefix(value, []byte{0x28, 0xb5, 0x2f, 0xfd})
+}
+
+// gzipExportWriter gzip-compresses an export stream as a series of gzip members, which
+// decompress as one stream.  Lines holding already-compressed values are written in
+// members with Huffman-only compression, which shrinks their base64 encoding without the
+// cost of searching for repeats that compressed data doesn't have.
+type gzipExportWriter struct {
+	w     io.Writer
+	zw    *gzip.Writer
+	level int
+}
+
+// writeLine compresses a line, starting a new member if the line needs a different
+// compression level than the current member.
+func (ew *gzipExportWriter) writeLine(line []byte, compressed bool) error {
+	level := gzip.DefaultCompression
+	if compressed {
+		level = gzip.HuffmanOnly
+	}
+	if ew.zw == nil || level != ew.level {
+		if err := ew.close(); err != nil {
+			return err
+		}
+		zw, err := gzip.NewWriterLevel(ew.w, level)
+		if err != nil {
+			return err
+		}
+		ew.zw, ew.level = zw, level
+	}
+	_, err := ew.zw.Write(line)
+	return err
+}
+
+// close ends the current member, if any.
+func (ew *gzipExportWriter) close() error {
+	if ew.zw == nil {
+		return nil
+	}
+	err := ew.zw.Close()
+	ew.zw = nil
+	return err
+}
+
+// exportCompression returns true if an export should be gzip-compressed, either because
+// the "compress" query string is "gzip" or, if it isn't given, because the request
+// accepts gzip encoding.
+func exportCompression(r *http.Request) (bool, error) {
+	switch compress := r.URL.Query().Get("compress"); compress {
+	case "":
+		return dvid.SupportsGzipEncoding(r), nil
+	case "gzip":
+		return true, nil
+	case "none":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unsupported export compression %q, must be \"gzip\" or \"none\"", compress)
+	}
+}
+
+// handleExportNDJSON streams all key-value pairs as one JSON object per line, where values
+// are base64-encoded.  If the "values" query string is "false", only keys are written.
+// The stream is gzip-compressed as given by exportCompression.
+func (d *Data) handleExportNDJSON(w http.ResponseWriter, r *http.Request, ctx *datastore.VersionedCtx) (numKeys int, err error) {
+	compress, err := exportCompression(r)
+	if err != nil {
+		return 0, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	var ew *gzipExportWriter
+	if compress {
+		ew = &gzipExportWriter{w: w}
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	writeLine := func(compressed bool) (err error) {
+		if ew != nil {
+			err = ew.writeLine(buf.Bytes(), compressed)
+		} else {
+			_, err = w.Write(buf.Bytes())
+		}
+		buf.Reset()
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	if r.URL.Query().Get("values") == "false" {
+		err = d.ProcessKeys(ctx, func(key string) error {
+			numKeys++
+			if err := enc.Encode(struct {
+				Key string `json:"key"`
+			}{key}); err != nil {
+				return err
+			}
+			return writeLine(false)
+		})
+	} else {
+		err = d.ProcessKeyValues(ctx, func(key string, value []byte) error {
+			numKeys++
+			if err := enc.Encode(struct {
+				Key   string `json:"key"`
+				Value []byte `json:"value"`
+			}{key, value}); err != nil {
+				return err
+			}
+			return writeLine(isCompressed(value))
+		})
+	}
+	if err != nil && numKeys == 0 {
+		w.Header().Del("Content-Encoding")
+		return 0, err
+	}
+	if ew != nil {
+		// an empty export is still a valid gzip stream.
+		if numKeys == 0 {
+			err = ew.writeLine(nil, false)
+		}
+		if zerr := ew.close(); zerr != nil && err == nil {
+			err = zerr
+		}
+	}
+	if err != nil && numKeys > 0 {
+		// the response has already started so the error can't be returned as a status code.
+		dvid.Errorf("export of data %q stopped after %d keys: %v\n", d.DataName(), numKeys, err)
+		return numKeys, nil
+	}
+	return numKeys, err
+}
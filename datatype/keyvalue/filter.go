@@ -0,0 +1,97 @@
+/*
+	This file supports filtering values of range reads with simple built-in predicates
+	evaluated on the server, so selective extractions don't transfer every value.
+*/
+
+package keyvalue
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ValueFilter is a conjunction of predicates on values.  A nil filter matches all values.
+type ValueFilter struct {
+	MinSize     int    // minimum value size in bytes
+	MaxSize     int    // maximum value size in bytes, or -1 if unlimited
+	ValuePrefix []byte // values must begin with these bytes if non-nil
+
+	// If JSONField is set, values must be JSON objects whose field, given as a dot-separated
+	// path for nested objects, equals JSONValue.
+	JSONField string
+	JSONValue interface{}
+}
+
+// parseValueFilter returns the filter given by the "minsize", "maxsize", "valueprefix",
+// "jsonfield", and "jsonvalue" query strings, or nil if none are given.
+func parseValueFilter(query url.Values) (*ValueFilter, error) {
+	filter := &ValueFilter{MaxSize: -1}
+	var found bool
+	if s := query.Get("minsize"); s != "" {
+		size, err := strconv.Atoi(s)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("bad minsize %q: must be a non-negative integer", s)
+		}
+		filter.MinSize, found = size, true
+	}
+	if s := query.Get("maxsize"); s != "" {
+		size, err := strconv.Atoi(s)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("bad maxsize %q: must be a non-negative integer", s)
+		}
+		filter.MaxSize, found = size, true
+	}
+	if _, ok := query["valueprefix"]; ok {
+		filter.ValuePrefix, found = []byte(query.Get("valueprefix")), true
+	}
+	field, value := query.Get("jsonfield"), query.Get("jsonvalue")
+	if field != "" {
+		if _, ok := query["jsonvalue"]; !ok {
+			return nil, fmt.Errorf("jsonfield requires a jsonvalue to compare against")
+		}
+		filter.JSONField, found = field, true
+		if err := json.Unmarshal([]byte(value), &filter.JSONValue); err != nil {
+			filter.JSONValue = value // not JSON so compare as a string
+		}
+	} else if value != "" {
+		return nil, fmt.Errorf("jsonvalue requires a jsonfield")
+	}
+	if !found {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// Match returns true if the value satisfies all predicates of the filter.
+func (f *ValueFilter) Match(value []byte) bool {
+	if f == nil {
+		return true
+	}
+	if len(value) < f.MinSize || (f.MaxSize >= 0 && len(value) > f.MaxSize) {
+		return false
+	}
+	if f.ValuePrefix != nil && !bytes.HasPrefix(value, f.ValuePrefix) {
+		return false
+	}
+	if f.JSONField == "" {
+		return true
+	}
+	var v interface{}
+	if err := json.Unmarshal(value, &v); err != nil {
+		return false
+	}
+	for _, name := range strings.Split(f.JSONField, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if v, ok = obj[name]; !ok {
+			return false
+		}
+	}
+	return jsonEqual(v, f.JSONValue)
+}
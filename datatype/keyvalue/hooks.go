@@ -0,0 +1,146 @@
+/*
+	This file supports registrable hooks that transform values on write and reverse the
+	transformation on read, e.g., to encrypt values at rest.
+*/
+
+package keyvalue
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// ValueHook transforms the values of keyvalue instances configured to use it.  Write is
+// applied before serialization and Read must reverse it after deserialization.  Hooks
+// are given the instance so per-instance settings, e.g., encryption keys, can be looked
+// up by the instance's data UUID.  Since deduplicated payloads can be shared across keys,
+// transformations can't depend on the key.
+type ValueHook interface {
+	// Name returns the name used to configure instances with the hook.
+	Name() string
+
+	Write(d *Data, value []byte) ([]byte, error)
+	Read(d *Data, value []byte) ([]byte, error)
+}
+
+var (
+	valueHooksMu sync.RWMutex
+	valueHooks   = make(map[string]ValueHook)
+)
+
+// RegisterValueHook makes a hook available to keyvalue instances.  It is typically called
+// from the init() of the package implementing the hook.
+func RegisterValueHook(h ValueHook) error {
+	valueHooksMu.Lock()
+	defer valueHooksMu.Unlock()
+	if _, found := valueHooks[h.Name()]; found {
+		return fmt.Errorf("keyvalue value hook %q is already registered", h.Name())
+	}
+	valueHooks[h.Name()] = h
+	return nil
+}
+
+// getValueHooks returns the registered hooks for a comma-separated list of hook names.
+func getValueHooks(names string) ([]ValueHook, error) {
+	if names == "" {
+		return nil, nil
+	}
+	valueHooksMu.RLock()
+	defer valueHooksMu.RUnlock()
+	var hooks []ValueHook
+	for _, name := range strings.Split(names, ",") {
+		h, found := valueHooks[strings.TrimSpace(name)]
+		if !found {
+			return nil, fmt.Errorf("no keyvalue value hook %q has been registered", name)
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, nil
+}
+
+// encodeValue applies the instance's hooks in order and serializes the result.
+func (d *Data) encodeValue(value []byte) ([]byte, error) {
+	return d.encodeValueAs(value, nil, nil)
+}
+
+// encodeValueAs validates the value against any JSONSchema setting, applies the instance's
+// hooks in order, and serializes the result, or if raw is non-nil, stores the result as is
+// with the given encoding.  If compress is non-nil, it overrides the instance's compression.
+func (d *Data) encodeValueAs(value []byte, raw *RawEncoding, compress *dvid.Compression) ([]byte, error) {
+	if raw == nil || raw.ContentEncoding == "" {
+		if err := d.ValidateValue(value); err != nil {
+			return nil, err
+		}
+	}
+	if len(value) != 0 && d.ValueHooks != "" {
+		hooks, err := getValueHooks(d.ValueHooks)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range hooks {
+			if value, err = h.Write(d, value); err != nil {
+				return nil, fmt.Errorf("value hook %q failed on write: %v", h.Name(), err)
+			}
+		}
+	}
+	if raw != nil {
+		return encodeRawValue(*raw, value)
+	}
+	if compress == nil {
+		serialization, ok, err := d.encodeWithDict(value)
+		if err != nil || ok {
+			return serialization, err
+		}
+	}
+	compression := d.Compression()
+	if compress != nil {
+		compression = *compress
+	}
+	serialization, err := dvid.SerializeDataWithCodec(value, d.Codec(), compression, d.ChecksumFor(len(value)))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to serialize data: %v\n", err)
+	}
+	return serialization, nil
+}
+
+// decodeValue deserializes a stored value and applies the instance's hooks in reverse order.
+func (d *Data) decodeValue(data []byte) ([]byte, error) {
+	value, _, err := d.decodeValueAs(data)
+	return value, err
+}
+
+// decodeValueAs deserializes a stored value and applies the instance's hooks in reverse
+// order.  If the value was stored as is, its encoding is returned.
+func (d *Data) decodeValueAs(data []byte) (value []byte, raw *RawEncoding, err error) {
+	inner, compressed, err := d.decodeDictValue(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if compressed {
+		data = inner
+	}
+	if raw, value, err = decodeRawValue(data); err != nil {
+		return nil, nil, err
+	}
+	if raw == nil {
+		if value, _, err = dvid.DeserializeData(data, true); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(value) == 0 || d.ValueHooks == "" {
+		return value, raw, nil
+	}
+	hooks, err := getValueHooks(d.ValueHooks)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if value, err = hooks[i].Read(d, value); err != nil {
+			return nil, nil, fmt.Errorf("value hook %q failed on read: %v", hooks[i].Name(), err)
+		}
+	}
+	return value, raw, nil
+}
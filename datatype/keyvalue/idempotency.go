@@ -0,0 +1,189 @@
+/*
+	This file supports idempotent writes, where a retried POST carrying the same
+	Idempotency-Key header as an earlier successful POST isn't applied again.
+*/
+
+package keyvalue
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// IdempotencyKeyHeader is the request header giving a client-chosen key for a write, so
+// retries of the write within the IdempotencyWindow aren't applied again.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// DefaultIdempotencyWindow is the default duration idempotency keys are remembered.
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// ErrIdempotencyConflict is returned when an idempotency key is reused for a different
+// write within the window.
+var ErrIdempotencyConflict = errors.New("idempotency key was already used for a different write")
+
+// idempotency records are the 8-byte time of the write in Unix nanoseconds followed by
+// the MD5 fingerprint of the write.
+func encodeIdempotencyRecord(written time.Time, fingerprint [md5.Size]byte) []byte {
+	buf := make([]byte, 8+md5.Size)
+	binary.LittleEndian.PutUint64(buf[:8], uint64(written.UnixNano()))
+	copy(buf[8:], fingerprint[:])
+	return buf
+}
+
+func decodeIdempotencyRecord(data []byte) (written time.Time, fingerprint [md5.Size]byte, err error) {
+	if len(data) != 8+md5.Size {
+		err = fmt.Errorf("bad keyvalue idempotency record with %d bytes", len(data))
+		return
+	}
+	written = time.Unix(0, int64(binary.LittleEndian.Uint64(data[:8])))
+	copy(fingerprint[:], data[8:])
+	return
+}
+
+// writeFingerprint returns a hash identifying the write of a value to a key, so reuse of
+// an idempotency key for another write can be detected.
+func writeFingerprint(keyStr string, value []byte) [md5.Size]byte {
+	h := md5.New()
+	h.Write([]byte(keyStr))
+	h.Write([]byte{0})
+	h.Write(value)
+	var fingerprint [md5.Size]byte
+	copy(fingerprint[:], h.Sum(nil))
+	return fingerprint
+}
+
+// idempotencyWindow returns the duration idempotency keys are remembered.
+func (d *Data) idempotencyWindow() time.Duration {
+	if d.IdempotencyWindow <= 0 {
+		return DefaultIdempotencyWindow
+	}
+	return d.IdempotencyWindow
+}
+
+// PutDataIdempotent calls put to write a value to a key unless a write of the same value
+// to the same key with the given idempotency key succeeded within the IdempotencyWindow,
+// in which case replayed is true and put isn't called.  Reusing an idempotency key for a
+// different write within the window returns ErrIdempotencyConflict.
+func (d *Data) PutDataIdempotent(ctx storage.Context, idemKey, keyStr string, value []byte, put func() error) (replayed bool, err error) {
+	if idemKey == "" {
+		return false, fmt.Errorf("empty idempotency key")
+	}
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return false, err
+	}
+	d.startIdempotencyPurger()
+	tk := NewIdempotencyTKey(idemKey)
+	fingerprint := writeFingerprint(keyStr, value)
+
+	d.idempotencyMu.Lock()
+	defer d.idempotencyMu.Unlock()
+	data, err := db.Get(ctx, tk)
+	if err != nil {
+		return false, err
+	}
+	if data != nil {
+		written, stored, err := decodeIdempotencyRecord(data)
+		if err != nil {
+			return false, err
+		}
+		if time.Since(written) <= d.idempotencyWindow() {
+			if stored != fingerprint {
+				return false, ErrIdempotencyConflict
+			}
+			return true, nil
+		}
+	}
+	if err = put(); err != nil {
+		return false, err
+	}
+	return false, storage.Unmetered(db).Put(ctx, tk, encodeIdempotencyRecord(time.Now(), fingerprint))
+}
+
+// PurgeIdempotencyRecords removes all idempotency records across all versions that were
+// written before the given cutoff time.  Returns the number of purged records.
+func (d *Data) PurgeIdempotencyRecords(cutoff time.Time) (purged int, err error) {
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx := storage.NewDataContext(d, 0)
+	var expired []storage.Key
+	ch := make(chan *storage.KeyValue, 100)
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			kv := <-ch
+			if kv == nil {
+				return
+			}
+			if kv.K.IsTombstone() {
+				continue
+			}
+			written, _, err := decodeIdempotencyRecord(kv.V)
+			if err != nil {
+				dvid.Errorf("keyvalue %q: %v\n", d.DataName(), err)
+				continue
+			}
+			if written.Before(cutoff) {
+				expired = append(expired, kv.K)
+			}
+		}
+	}()
+
+	minKey, maxKey := ctx.TKeyClassRange(keyIdempotency)
+	keysOnly := false
+	if err = db.RawRangeQuery(minKey, maxKey, keysOnly, ch, nil); err != nil {
+		return 0, err
+	}
+	wg.Wait()
+
+	for _, k := range expired {
+		if err = db.RawDelete(k); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// startIdempotencyPurger launches the background purging of expired idempotency records
+// once the instance receives an idempotent write.
+func (d *Data) startIdempotencyPurger() {
+	d.idempotencyOnce.Do(func() {
+		d.idempotencyDone = make(chan struct{})
+		go d.purgeIdempotencyLoop(d.idempotencyDone)
+	})
+}
+
+func (d *Data) purgeIdempotencyLoop(done <-chan struct{}) {
+	for {
+		window := d.idempotencyWindow()
+		interval := window / 10
+		if interval > maxPurgeInterval {
+			interval = maxPurgeInterval
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+			purged, err := d.PurgeIdempotencyRecords(time.Now().Add(-window))
+			if err != nil {
+				dvid.Errorf("error purging idempotency records of keyvalue %q: %v\n", d.DataName(), err)
+			} else if purged > 0 {
+				dvid.Infof("Purged %d idempotency records of keyvalue %q\n", purged, d.DataName())
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+/*
+	This file supports an optional secondary index of a JSON field of values, so keys can
+	be looked up by the field's value without scanning all values.
+*/
+
+package keyvalue
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// indexedField returns the indexed field of a JSON value as a string.  If the value isn't
+// JSON or the field is missing or isn't a string, number, or boolean, found is false.
+func (d *Data) indexedField(value []byte) (field string, found bool) {
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return "", false
+	}
+	for _, name := range strings.Split(d.IndexField, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if v, ok = obj[name]; !ok {
+			return "", false
+		}
+	}
+	switch fv := v.(type) {
+	case string:
+		field = fv
+	case json.Number:
+		field = fv.String()
+	case bool:
+		field = fmt.Sprintf("%t", fv)
+	default:
+		return "", false
+	}
+	// zero bytes separate field values from keys in the index.
+	if strings.IndexByte(field, 0) >= 0 {
+		return "", false
+	}
+	return field, true
+}
+
+// indexEntry is the indexed field value of a key, if any.
+type indexEntry struct {
+	field string
+	found bool
+}
+
+// valueIndexEntry returns the index entry for a value, where a nil value has no entry.
+func (d *Data) valueIndexEntry(value []byte) indexEntry {
+	if value == nil {
+		return indexEntry{}
+	}
+	field, found := d.indexedField(value)
+	return indexEntry{field, found}
+}
+
+// storedIndexEntry returns the index entry of the value stored for a key.
+func (d *Data) storedIndexEntry(ctx storage.Context, db storage.OrderedKeyValueDB, keyStr string, tk storage.TKey) (indexEntry, error) {
+	data, err := db.Get(ctx, tk)
+	if err != nil || data == nil {
+		return indexEntry{}, err
+	}
+	if data, err = d.resolveValue(ctx, db, keyStr, data); err != nil {
+		return indexEntry{}, err
+	}
+	value, err := d.decodeValue(data)
+	if err != nil {
+		return indexEntry{}, fmt.Errorf("unable to deserialize data for key %q: %v", keyStr, err)
+	}
+	return d.valueIndexEntry(value), nil
+}
+
+// updateIndex replaces the old index entry of a key with one for its new value, where a
+// nil value removes the entry.
+func (d *Data) updateIndex(ctx storage.Context, db storage.OrderedKeyValueDB, keyStr string, old indexEntry, value []byte) error {
+	entry := d.valueIndexEntry(value)
+	if entry == old {
+		return nil
+	}
+	if old.found {
+		if err := db.Delete(ctx, NewIndexTKey(old.field, keyStr)); err != nil {
+			return err
+		}
+	}
+	if entry.found {
+		return storage.Unmetered(db).Put(ctx, NewIndexTKey(entry.field, keyStr), []byte{})
+	}
+	return nil
+}
+
+// batchIndex adds to a batch the replacement of the old index entry of a key with one
+// for its new value, where a nil value removes the entry.  Returns the new entry.
+func (d *Data) batchIndex(batch storage.Batch, keyStr string, old indexEntry, value []byte) indexEntry {
+	entry := d.valueIndexEntry(value)
+	if entry == old {
+		return entry
+	}
+	if old.found {
+		batch.Delete(NewIndexTKey(old.field, keyStr))
+	}
+	if entry.found {
+		storage.PutUnmetered(batch, NewIndexTKey(entry.field, keyStr), []byte{})
+	}
+	return entry
+}
+
+// GetIndexedKeys returns the keys, in order, whose values have the given indexed field value.
+func (d *Data) GetIndexedKeys(ctx storage.Context, field, fieldValue string) ([]string, error) {
+	if d.IndexField == "" {
+		return nil, fmt.Errorf("keyvalue %q has no secondary index; set IndexField at creation", d.DataName())
+	}
+	if field != d.IndexField {
+		return nil, fmt.Errorf("keyvalue %q indexes field %q, not %q", d.DataName(), d.IndexField, field)
+	}
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	// keys with the field value all lie between value+0 and value+1.
+	first := storage.NewTKey(keyIndex, append([]byte(fieldValue), 0))
+	last := storage.NewTKey(keyIndex, append([]byte(fieldValue), 1))
+	tks, err := db.KeysInRange(ctx, first, last)
+	if err != nil {
+		return nil, err
+	}
+	keyList := []string{}
+	for _, tk := range tks {
+		_, keyStr, err := DecodeIndexTKey(tk)
+		if err != nil {
+			return nil, err
+		}
+		keyList = append(keyList, keyStr)
+	}
+	return keyList, nil
+}
@@ -5,6 +5,7 @@
 package keyvalue
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/janelia-flyem/dvid/datastore"
@@ -20,13 +21,55 @@ const (
 
 	// the byte id for a standard key of a keyvalue
 	keyStandard = 177
+
+	// the byte id for a soft-deleted key of a keyvalue, which holds the deletion
+	// timestamp and the original value until purged.
+	keyTombstone = 178
+
+	// the byte id for a deduplicated value payload keyed by its content hash.
+	keyDedup = 179
+
+	// the byte id for the last-modified timestamp of a key.
+	keyModified = 180
+
+	// the byte id for a chunk of a value too large to store under a single key.
+	keyChunk = 181
+
+	// the byte id for a secondary index entry mapping an indexed field value to a key.
+	keyIndex = 182
+
+	// the byte id for the record of a write made with an idempotency key.
+	keyIdempotency = 183
+
+	// the byte id for the approximate last-access timestamp of a key.
+	keyAccessed = 184
+
+	// the byte id for the custom metadata of a key.
+	keyMeta = 185
 )
 
 // DescribeTKeyClass returns a string explanation of what a particular TKeyClass
 // is used for.  Implements the datastore.TKeyClassDescriber interface.
 func (d *Data) DescribeTKeyClass(tkc storage.TKeyClass) string {
-	if tkc == keyStandard {
+	switch tkc {
+	case keyStandard:
 		return "keyvalue generic key"
+	case keyTombstone:
+		return "keyvalue soft-deleted key"
+	case keyDedup:
+		return "keyvalue deduplicated value"
+	case keyModified:
+		return "keyvalue last-modified timestamp"
+	case keyChunk:
+		return "keyvalue chunk of large value"
+	case keyIndex:
+		return "keyvalue secondary index entry"
+	case keyIdempotency:
+		return "keyvalue idempotent write record"
+	case keyAccessed:
+		return "keyvalue last-access timestamp"
+	case keyMeta:
+		return "keyvalue custom key metadata"
 	}
 	return "unknown keyvalue key"
 }
@@ -51,3 +94,90 @@ func DecodeTKey(tk storage.TKey) (string, error) {
 	}
 	return string(ibytes[:sz]), nil
 }
+
+// NewDedupTKey returns the type-specific key for a deduplicated payload with the given hash.
+func NewDedupTKey(hash []byte) storage.TKey {
+	return storage.NewTKey(keyDedup, hash)
+}
+
+// NewTombstoneTKey returns the type-specific key for a soft-deleted "key".
+func NewTombstoneTKey(key string) (storage.TKey, error) {
+	return storage.NewTKey(keyTombstone, append([]byte(key), 0)), nil
+}
+
+// DecodeTombstoneTKey returns the string key used for a soft-deleted keyvalue.
+func DecodeTombstoneTKey(tk storage.TKey) (string, error) {
+	ibytes, err := tk.ClassBytes(keyTombstone)
+	if err != nil {
+		return "", err
+	}
+	sz := len(ibytes) - 1
+	if sz <= 0 {
+		return "", fmt.Errorf("empty key")
+	}
+	if ibytes[sz] != 0 {
+		return "", fmt.Errorf("expected 0 byte ending key of keyvalue tombstone key, got %d", ibytes[sz])
+	}
+	return string(ibytes[:sz]), nil
+}
+
+// NewModifiedTKey returns the type-specific key for the last-modified timestamp of "key".
+func NewModifiedTKey(key string) (storage.TKey, error) {
+	return storage.NewTKey(keyModified, append([]byte(key), 0)), nil
+}
+
+// NewAccessedTKey returns the type-specific key for the last-access timestamp of "key".
+func NewAccessedTKey(key string) storage.TKey {
+	return storage.NewTKey(keyAccessed, append([]byte(key), 0))
+}
+
+// NewMetaTKey returns the type-specific key for the custom metadata of "key".
+func NewMetaTKey(key string) storage.TKey {
+	return storage.NewTKey(keyMeta, append([]byte(key), 0))
+}
+
+// DecodeAccessedTKey returns the string key of a last-access timestamp.
+func DecodeAccessedTKey(tk storage.TKey) (string, error) {
+	ibytes, err := tk.ClassBytes(keyAccessed)
+	if err != nil {
+		return "", err
+	}
+	sz := len(ibytes) - 1
+	if sz < 0 || ibytes[sz] != 0 {
+		return "", fmt.Errorf("expected 0 byte ending key of keyvalue last-access key")
+	}
+	return string(ibytes[:sz]), nil
+}
+
+// NewIdempotencyTKey returns the type-specific key for the record of a write made with
+// the given idempotency key.
+func NewIdempotencyTKey(idemKey string) storage.TKey {
+	return storage.NewTKey(keyIdempotency, append([]byte(idemKey), 0))
+}
+
+// NewIndexTKey returns the type-specific key for the index entry of "key" under an
+// indexed field value.
+func NewIndexTKey(fieldValue, key string) storage.TKey {
+	ibytes := make([]byte, 0, len(fieldValue)+len(key)+2)
+	ibytes = append(ibytes, fieldValue...)
+	ibytes = append(ibytes, 0)
+	ibytes = append(ibytes, key...)
+	return storage.NewTKey(keyIndex, append(ibytes, 0))
+}
+
+// DecodeIndexTKey returns the indexed field value and key of an index entry.
+func DecodeIndexTKey(tk storage.TKey) (fieldValue, key string, err error) {
+	ibytes, err := tk.ClassBytes(keyIndex)
+	if err != nil {
+		return "", "", err
+	}
+	sz := len(ibytes) - 1
+	if sz <= 0 || ibytes[sz] != 0 {
+		return "", "", fmt.Errorf("expected 0 byte ending key of keyvalue index key")
+	}
+	sep := bytes.IndexByte(ibytes, 0)
+	if sep == sz {
+		return "", "", fmt.Errorf("no separator between field value and key in keyvalue index key")
+	}
+	return string(ibytes[:sep]), string(ibytes[sep+1 : sz]), nil
+}
@@ -5,13 +5,20 @@ package keyvalue
 
 import (
 	"archive/tar"
+	"bufio"
 	"bytes"
+	"encoding/binary"
 	"encoding/gob"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/janelia-flyem/dvid/datastore"
@@ -54,10 +61,134 @@ $ dvid repo <UUID> new keyvalue <data name> <settings...>
 				   versioned data, distribution (push/pull) of unversioned data is not defined 
 				   at this time.
 
+	SoftDelete     Set to "true" or "1" if deleted keys should be kept as tombstones that can
+				   be recovered via the "undelete" endpoint until purged.
+
+	SoftDeleteWindow  Duration, e.g., "72h", that soft-deleted keys are recoverable before
+				   being purged by a background job.  Default is 168h (one week).
+
+	TrackModified  Set to "true" or "1" to store a last-modified timestamp with each key, which
+				   is returned in the "Last-Modified" header of GET /key and can be refreshed
+				   via the "touch" endpoint.  Each write also writes the timestamp.
+
+	AccessInterval  Duration, e.g., "1h", enabling approximate last-access (read) times of
+				   keys, which are recorded at most once per interval per key so reads stay
+				   cheap.  The "coldkeys" endpoint lists keys not read since a given time,
+				   e.g., for moving them to cheaper storage.  Default is 0, which doesn't
+				   track accesses.
+
+	MaxKeys        Maximum number of keys in the instance, where 0 (default) is unlimited.
+				   Writes of new keys beyond the limit are rejected with status code 507,
+				   while overwrites of existing keys are allowed.  Keys are counted across
+				   all versions as they are written and deleted while the limit is set.
+
+	CoalesceInterval  Duration, e.g., "500ms", that puts are buffered in memory before being
+				   written, so only the latest value of a rapidly updated key reaches the
+				   store.  Reads see buffered values, and range reads, deletes, and shutdown
+				   flush the buffer.  Buffered writes are lost if the server crashes, and
+				   write errors are only logged, so it can't be set along with MaxKeys or
+				   Quota.  Default is 0, which writes immediately.
+
+	ChunkSize      Maximum bytes of a stored value, where 0 (default) is unlimited.  Larger
+				   values are transparently split across chunk keys on writes and reassembled
+				   on reads, so values can exceed a backend's maximum value size.  Chunks of
+				   overwritten or deleted values are removed, although values overwritten
+				   after ChunkSize is reset to 0 leave their chunks behind.
+
+	Passthrough    Set to "true" or "1" to store POSTed values of single keys exactly as sent,
+				   as with the "raw=true" query string of POST /key.  Values stored as sent
+				   are flagged, so instances can mix them with serialized values.
+
+	InlineSize     Values of at most this many bytes are stored directly under their keys
+				   instead of as references to deduplicated payloads on "dedup=true" POSTs,
+				   so reading them needs no additional payload read.  Default is 0, which
+				   deduplicates all non-empty values.  Values written without "dedup=true"
+				   are always stored directly under their keys.
+
+	CacheSize      Megabytes of recently read values to cache in memory, where 0 (default)
+				   disables caching.  Values are cached per version and invalidated when
+				   written or deleted through this server, so other servers sharing the
+				   store shouldn't write to the instance.  Hits and misses are reported
+				   in the "Cache" section of the info endpoint.
+
+	MaxScanTime    Duration, e.g., "30s", after which GET /keyrangevalues stops scanning and
+				   returns the key-values read so far with a continuation key, so huge
+				   ranges can't hold store iterators indefinitely.  Default is 0, which
+				   is unlimited.
+
+	MaxPendingWrites  Maximum number of write requests (POSTs and DELETEs of keys, POSTs of
+				   keyvalues, transactions, swaps, renames, touches, undeletes, and
+				   merges, and prefix and range deletes) in progress at once, where 0
+				   (default) is unlimited.
+				   Additional writes are handled according to WriteOverload.
+
+	WriteOverload  "reject" (default) to respond to writes beyond MaxPendingWrites with
+				   status code 503 and a "Retry-After" header, so clients slow down, or
+				   "block" to have them wait until an earlier write finishes.
+
+	IdempotencyWindow  Duration, e.g., "1h", that the "Idempotency-Key" headers of POSTs
+				   are remembered, so retries within the window aren't applied again.
+				   Default is 24h.
+
+	Templates      "stored" to allow GET /key to render JSON values as HTML through Go templates
+				   stored as values of other keys, or "inline" to also allow templates given
+				   in the request.  Default is empty, which disables rendering.  Since
+				   templates can loop, only allow inline templates from trusted clients.
+
+	JSONSchema     JSON Schema text that every value written must match, e.g.,
+				   {"type": "object", "required": ["owner"]}.  Writes of values that aren't
+				   JSON or don't match are rejected with status code 400 and the JSON
+				   Pointer path of the failing part of the value.  Supports the keywords
+				   type, enum, properties, required, additionalProperties, items, minimum,
+				   maximum, minLength, maxLength, minItems, maxItems, and pattern.  Values
+				   stored as sent with a "Content-Encoding" are not validated.
+
+	IndexField     Dot-separated path of a JSON field, e.g., "owner.name", whose value is
+				   indexed on each write so keys can be found via the "index" endpoint.
+				   Only string, number, and boolean fields of JSON values are indexed.
+				   Keys written before the instance is created with an index aren't indexed.
+
+	ValueHooks     Comma-separated names of value hooks registered by other packages, e.g.,
+				   for encryption at rest, that transform values in order before they are
+				   stored and in reverse order when read.  Hooks apply to all keys of the
+				   instance and must be registered whenever the instance is used.
+
+	AuditLog       Set to "true" or "1" to record each put and delete of keys via HTTP, with
+				   the user given by the "u" query string, the key, time, and value size,
+				   in the log store, e.g., filelog.  Records are kept per version and can
+				   be read via the "audit" endpoint.  Each write also appends to the log.
+
 $ dvid -stdin node <UUID> <data name> put <key> < data
 
 	Puts stdin data into the keyvalue data instance under the given key.
 
+$ dvid node <UUID> <data name> version-bytes
+
+	Scans all stored key-values of the instance and reports, in JSON, the number of
+	key-values and stored bytes each version of the repo added, in breadth-first order
+	from the root.  Since a version's key-values are the keys written or deleted in that
+	version, this shows the storage growth contributed by each commit.  Versions with
+	stored data that are no longer in the DAG are listed last without a UUID.
+
+$ dvid node <UUID> <data name> verify-keys
+
+	Scans all stored keys of the instance, across all versions, without reading values and
+	checks that each decodes with the current key format, e.g., after a change to key
+	encoding.  Reports, in JSON, the number of keys scanned, the number of keys and
+	soft-deleted keys decoded, and the number that failed along with up to 100 samples
+	giving the hex-encoded storage key, its version, and the decoding error:
+
+	{
+	    "Scanned": 1032,
+	    "Decoded": 1000,
+	    "Failed": 1,
+	    "Samples": [
+	        { "Key": "...", "VersionID": 1, "Error": "empty key" }
+	    ]
+	}
+
+	Failures indicate keys written with a mismatched format or corruption.
+
 	
 	------------------
 
@@ -81,7 +212,20 @@ POST <api URL>/node/<UUID>/<data name>/info
 
 	GET <api URL>/node/3f8c/stuff/info
 
-	Returns JSON with configuration settings.
+	Returns JSON with configuration settings.  The "Serialization" section gives the
+	effective settings used to store values, so clients reading raw stored bytes can
+	decode them:
+
+	"Serialization": {
+		"Compression": "lz4",       // "none", "snappy", "lz4", "gzip", or "jpeg"
+		"CompressionLevel": -1,
+		"Checksum": "none",         // "none" or "crc32", which gzip already includes
+		"ChecksumMinSize": 0,       // values smaller than this # of bytes have no checksum
+		"Codec": "",                // name of value codec, if any
+		"Format": 128,              // leading format byte of stored values
+		"Versioned": true,
+		"MaxValueSize": 0           // bytes stored under one key before chunking, 0 if unlimited
+	}
 
 	Arguments:
 
@@ -94,12 +238,366 @@ GET  <api URL>/node/<UUID>/<data name>/keys
 
 	[key1, key2, ...]
 
-GET  <api URL>/node/<UUID>/<data name>/keyrange/<key1>/<key2>
+	If the request has an "Accept: application/octet-stream" header, keys are instead returned
+	in a compact binary format where each key is preceded by its length in bytes as a
+	little-endian uint32:
+
+	<key1 length><key1 bytes><key2 length><key2 bytes>...
+
+	As a safeguard against enormous responses, the server's maxListKeys setting limits
+	the keys returned, by default to 1000000 keys.  If keys were cut, the response has
+	the headers "X-Truncated: true", "X-Truncated-Reason: key limit", and "X-Next-Key" with
+	the path-escaped first key not returned, which can be used as 'key1' of a "keyrange"
+	request to continue the listing.
+
+GET  <api URL>/node/<UUID>/<data name>/keys/list?prefix=<prefix>&delimiter=<delimiter>
+
+	Lists keys one level below a prefix, treating the delimiter within keys as a hierarchy
+	separator like object store bucket listings.  Keys beginning with the prefix that have
+	no delimiter past the prefix are returned in "Keys", while the remaining keys are
+	collapsed into their distinct prefixes through the first delimiter past the prefix,
+	returned in "CommonPrefixes".  For example, with keys "a.txt", "img/1.png", "img/2.png",
+	and "img/raw/3.tif":
+
+	GET <api URL>/node/3f8c/stuff/keys/list?prefix=img/&delimiter=/
+
+	{
+		"Keys": ["img/1.png", "img/2.png"],
+		"CommonPrefixes": ["img/raw/"]
+	}
+
+	Query-string Options:
+
+	prefix        Only list keys beginning with this string.  Default is all keys.
+	delimiter     Hierarchy separator, e.g., "/".  If empty, all keys with the prefix are
+	                listed and there are no common prefixes.
+
+GET  <api URL>/node/<UUID>/<data name>/keys/counts?delimiter=<delimiter>[&begin=<key1>][&end=<key2>]
+
+	Counts the keys in a range by their top-level prefix through the first delimiter, like
+	a histogram of key namespaces, e.g., to see which prefixes dominate an instance.  With
+	keys "a.txt", "img/1.png", "img/2.png", "img/raw/3.tif", and "docs/x.md":
+
+	GET <api URL>/node/3f8c/stuff/keys/counts?delimiter=/
+
+	{
+		"Prefixes": [{"Prefix": "docs/", "Count": 1}, {"Prefix": "img/", "Count": 3}],
+		"Unprefixed": 1,
+		"Total": 5
+	}
+
+	Prefixes are listed in key order, and "Unprefixed" counts keys without the delimiter.
+	Since every key in the range is read, the scan is a throttled operation and returns
+	status code 503 if the server is already running its maximum number of throttled
+	operations.
+
+	Query-string Options:
+
+	delimiter     Namespace separator, e.g., "/".  Required.
+	begin         First key of the range, inclusive.  Default is the first key.
+	end           Last key of the range, inclusive.  Default is the last key.
+
+POST <api URL>/node/<UUID>/<data name>/keys/swap?a=<key1>&b=<key2>[&missing=empty]
+
+	Atomically exchanges the values of two keys, e.g., "active" and "staging" configs, by
+	reading both values and writing them swapped in a single batch commit.  Other writes
+	to the instance are held off during the swap.  Values are moved as stored, so they
+	keep any raw encoding or compression level they were posted with.
+
+	Query-string Options:
+
+	a, b          The keys to swap.
+	missing       "error" (default) fails the swap if either key doesn't exist, while
+	              "empty" treats a missing key as having an empty value.
+
+POST <api URL>/node/<UUID>/<data name>/keys/rename?from=<prefix1>&to=<prefix2>
+
+	Renames all keys beginning with one prefix so they begin with another, e.g., from "v1/"
+	to "v2/", and returns the outcome in JSON format:
+
+	{"Renamed": 12, "Skipped": 1, "DryRun": false, "Conflicts": ["v2/a"]}
+
+	"Conflicts" lists destination keys that already existed.  Keys are renamed in batches
+	of 1000, each putting the new keys and deleting the old ones in one commit, so a rename
+	of at most 1000 keys is atomic if the store supports atomic batches.  Custom key
+	metadata moves with the keys, and writes to the instance are held off during the
+	rename.
+
+	Query-string Options:
+
+	from, to      Non-empty prefixes, neither of which may begin with the other.
+	conflict      Handling of destination keys that already exist: "error" (default)
+	              fails the rename before any key is renamed, "skip" leaves both keys
+	              unchanged, and "overwrite" replaces the destination value.
+	dryrun        If "true", nothing is renamed and the renames that would be made are
+	              also returned in "Renames" as {"From": "v1/a", "To": "v2/a"} objects.
+
+GET  <api URL>/node/<UUID>/<data name>/keyrange/<key1>/<key2>[?step=<N>]
 
 	Returns all keys between 'key1' and 'key2' for this data instance in JSON format:
 
 	[key1, key2, ...]
 
+	As with the "keys" endpoint, an "Accept: application/octet-stream" header returns
+	length-prefixed binary keys, and the server's maxListKeys limit applies.
+
+	Arguments:
+
+	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of keyvalue data instance.
+	key1          Lexicographically lowest alphanumeric key in range.
+	key2          Lexicographically highest alphanumeric key in range.
+
+	GET Query-string Options:
+
+	step          If given, only every Nth key is returned, starting with the first key in
+	              the range, e.g., for a cheap preview of a large keyspace.  The step must
+	              be a positive integer.  Sampling only reduces the response: every key in
+	              the range is still read from the store, so a sampled request costs about
+	              as much storage time as an unsampled one.
+
+DEL  <api URL>/node/<UUID>/<data name>/keyrange/<key1>/<key2>?match=<condition>[&dryrun=true]
+
+	Deletes keys between 'key1' and 'key2' only if their values match the given condition
+	and returns the matched keys in JSON format:
+
+	[key1, key2, ...]
+
+	Unlike a blind range delete, each value in the range must be read and checked, so this
+	is more expensive for large ranges.  Deletions are committed in atomic batches.
+
+	Arguments:
+
+	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of keyvalue data instance.
+	key1          Lexicographically lowest alphanumeric key in range.
+	key2          Lexicographically highest alphanumeric key in range.
+
+	Query-string Options:
+
+	match         "empty" deletes keys with empty values.  "value" deletes keys whose value
+	              equals the "value" query string.
+	value         The value to match when match=value.
+	dryrun        If "true", returns the keys that would be deleted without deleting them.
+
+DEL  <api URL>/node/<UUID>/<data name>/keys/prefix/<prefix>[?dryrun=true]
+
+	Deletes all keys beginning with the prefix, e.g., "tmp/", at the given version and
+	returns the number of keys deleted in JSON format:
+
+	{"Count": 12, "DryRun": false}
+
+	As with conditional range deletes, deletions are committed in atomic batches.
+
+	Arguments:
+
+	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of keyvalue data instance.
+	prefix        Non-empty prefix of keys to delete, which may contain "/".
+
+	Query-string Options:
+
+	dryrun        If "true", nothing is deleted and the keys that would be deleted are also
+	              returned in "Keys".
+
+GET  <api URL>/node/<UUID>/<data name>/index/<field>/<value>
+
+	Returns all keys whose values have the given value for the indexed JSON field in JSON
+	format:
+
+	[key1, key2, ...]
+
+	The instance must have been created with the IndexField setting, and numbers and
+	booleans are matched by their JSON text, e.g., "42" or "true".
+
+	Arguments:
+
+	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of keyvalue data instance.
+	field         The indexed field, which must match the IndexField setting.
+	value         The field value to look up.
+
+GET  <api URL>/node/<UUID>/<data name>/coldkeys?age=<duration>
+
+	Returns the keys that haven't been read within the given duration, e.g., "720h", in
+	JSON format, ordered from least recently read with never-read keys first:
+
+	[{"Key": "a", "Accessed": "0001-01-01T00:00:00Z"}, {"Key": "b", "Accessed": "2024-03-01T12:00:00Z"}, ...]
+
+	Requires the instance to have been created with the AccessInterval setting, and access
+	times are only accurate to within that interval.  Keys not read since access tracking
+	was enabled have a zero "Accessed" time.
+
+	Query-string Options:
+
+	age           Minimum time since the last read of returned keys.  Default is 0, which
+	              returns all keys.
+
+GET  <api URL>/node/<UUID>/<data name>/sizes[?format=prometheus]
+
+	Scans all values at the given version and returns the histogram of their stored sizes
+	in bytes, after serialization and compression, in JSON format:
+
+	{
+		"Buckets": [{"UpperBound": 0, "Count": 2}, {"UpperBound": 1, "Count": 2}, ...],
+		"Count": 1024,
+		"Sum": 52428800
+	}
+
+	Buckets have power-of-two upper bounds and, as with Prometheus histograms, cumulative
+	counts.  Chunked and deduplicated values are counted at their full size.  Since every
+	key is read, the scan is a throttled operation and returns status code 503 if the server
+	is already running its maximum number of throttled operations.
+
+	Query-string Options:
+
+	format        If "prometheus", the histogram is returned in the Prometheus text format
+	              as the metric "dvid_keyvalue_value_size_bytes".
+
+GET  <api URL>/node/<UUID>/<data name>/audit[?key=<key>&since=<time>&until=<time>]
+
+	Returns JSON of the audit records of puts and deletes of keys at the given version, in
+	the order they were made.  The instance must have been created with AuditLog enabled.
+
+	[
+		{"Time": "2026-10-16T09:30:00.123Z", "User": "alice", "Op": "put", "Key": "a", "Bytes": 512},
+		{"Time": "2026-10-16T09:31:12.004Z", "User": "bob", "Op": "delete", "Key": "a", "Bytes": 0}
+	]
+
+	Records cover POSTs and DELETEs of the "key" endpoint including "apply", POSTs of
+	"keyvalues" and "txn", and DELETEs of "keyrange" and "keys/prefix".
+
+	Query-string Options:
+
+	key           Only return records of this key.
+	since         RFC 3339 time, e.g., "2026-10-16T09:00:00Z", of the earliest records.
+	until         RFC 3339 time before which records are returned.
+
+GET  <api URL>/node/<UUID>/<data name>/duplicates[?groups=<N>]
+
+	Scans all values at the given version and reports the keys that share identical
+	non-empty values, and the space that storing each shared value once, e.g., via
+	"dedup=true" POSTs, would reclaim, in JSON format:
+
+	{
+		"Values": 1024,
+		"DuplicateGroups": 2,
+		"DuplicateKeys": 5,
+		"ReclaimableBytes": 3072,
+		"Groups": [
+			{
+				"Hash": "9f86d081...",
+				"Size": 1024,
+				"Count": 3,
+				"ReclaimableBytes": 2048,
+				"Keys": ["a", "b", "c"]
+			},
+			...
+		]
+	}
+
+	Values are compared by their SHA-256 content hash, and sizes are those stored after
+	serialization and compression.  Keys already referencing the same deduplicated payload
+	add no reclaimable bytes.  Groups are listed by most reclaimable bytes with up to 100
+	keys each.  The scan is read-only, but since every key is read, it is a throttled
+	operation and returns status code 503 if the server is already running its maximum
+	number of throttled operations.  Hashes of large instances are spilled to temporary
+	files rather than held in memory.
+
+	Query-string Options:
+
+	groups        Maximum number of duplicate groups listed.  Default is 100.
+
+GET    <api URL>/node/<UUID>/<data name>/dictionary
+POST   <api URL>/node/<UUID>/<data name>/dictionary[?size=<bytes>&samples=<N>&maxvaluesize=<bytes>]
+DELETE <api URL>/node/<UUID>/<data name>/dictionary
+
+	Manages a compression dictionary trained from the instance's values, which greatly
+	improves compression of many small, similar values, e.g., JSON annotations, that
+	compress poorly on their own.  A POST samples values at the given version, trains a
+	DEFLATE dictionary of content shared across the samples, stores it in the instance's
+	metadata, and compresses subsequent writes of values up to "maxvaluesize" bytes with it
+	in place of the instance's compression.  It returns the new dictionary:
+
+	{ "ID": 2, "Size": 16384, "Current": true, "Samples": 1000, "MaxValueSize": 4096 }
+
+	Each compressed value records the ID of its dictionary, and earlier dictionaries are
+	kept, so values still decode after retraining.  Existing values aren't rewritten.
+	Values are only compressed with the dictionary if it makes them smaller, and writes
+	with a "level" or "raw" query string don't use it.  A DELETE stops compressing new
+	values with a dictionary.  A GET lists the trained dictionaries:
+
+	[ { "ID": 1, "Size": 16384, "Current": false }, { "ID": 2, "Size": 16384, "Current": true, "MaxValueSize": 4096 } ]
+
+	Since training reads every value, a POST is a throttled operation and returns status
+	code 503 if the server is already running its maximum number of throttled operations.
+
+	POST Query-string Options:
+
+	size          Maximum bytes of the dictionary, up to 32768.  Default is 16384.
+	samples       Maximum number of values sampled for training.  Default is 1000.
+	maxvaluesize  Only values of at most this many bytes are sampled and compressed with
+	              the dictionary.  Default is 4096.
+
+GET  <api URL>/node/<UUID>/<data name>/compare?a=<key1>[&b=<key2>][&aversion=<UUID>][&bversion=<UUID>]
+
+	Returns the differences between the values of two keys, or of one key at two versions,
+	as plain text so both values don't have to be downloaded.  If both values are text, a
+	unified diff with 3 lines of context is returned, labeled with "<key>@<version>":
+
+	--- mykey@3f8c
+	+++ mykey@99ef
+	@@ -1,3 +1,3 @@
+	 {
+	-  "status": "pending"
+	+  "status": "done"
+	 }
+
+	Binary values, or text with too many changes for a line diff, only give the first byte
+	offset at which the values differ.  Nothing is returned if the values are identical.  A
+	missing key is compared as an empty value labeled "/dev/null", but it is an error if both
+	keys are missing.
+
+	Query-string Options:
+
+	a             The first key.
+	b             The second key.  Default is the first key, e.g., to compare versions.
+	aversion      UUID of an ancestor of the requested version at which to read the first
+	              key.  Default is the requested version.
+	bversion      UUID of an ancestor version at which to read the second key.
+
+GET  <api URL>/node/<UUID>/<data name>/reindex
+POST <api URL>/node/<UUID>/<data name>/reindex[?after=<key>]
+
+	A POST rebuilds the secondary index of the IndexField setting at the given version in
+	the background, e.g., after IndexField is set on an instance that already has keys.
+	All values are scanned in key order and indexed in batches, then index entries that
+	no longer match stored values are removed.  Writes are held off only while each batch
+	is processed.  A GET returns the progress of the latest reindex in JSON format:
+
+	{"Running": true, "Phase": "index", "LastKey": "key1", "Indexed": 1000, "Pruned": 0}
+
+	If a reindex is interrupted, e.g., by a server restart, it can be resumed by passing
+	the last reported key as "after".
+
+	Arguments:
+
+	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of keyvalue data instance.
+
+	Query-string Options:
+
+	after         Only keys after this key are indexed.
+
+GET  <api URL>/node/<UUID>/<data name>/keyrangevalues/<key1>/<key2>?<options>
+
+	Streams all key-value pairs between 'key1' and 'key2' for this data instance.  If a
+	prefix is given, only keys that also begin with the prefix are returned.  The prefix
+	is checked during iteration and, if more restrictive than the given range, is used to
+	tighten the scan so non-matching keys are skipped cheaply.
+
+	By default, the response is a KeyValues protobuf3 serialization (see "keyvalues" below).
+
 	Arguments:
 
 	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
@@ -107,6 +605,61 @@ GET  <api URL>/node/<UUID>/<data name>/keyrange/<key1>/<key2>
 	key1          Lexicographically lowest alphanumeric key in range.
 	key2          Lexicographically highest alphanumeric key in range.
 
+	GET Query-string Options:
+
+	prefix        Only return keys beginning with this string, e.g., "mesh_".
+	json          If set to "true", the response will be a JSON object with keys mapped
+	              to values.  All values must be valid JSON or an error will be returned.
+	jsontar       If set to "true", the response will be a tarfile with keys as file names.
+	maxbytes      Stop before the total bytes of returned values would exceed this budget,
+	              although at least one key-value is returned if any are in range.  If
+	              the range was cut short, the response has the header "X-Truncated: true"
+	              and an "X-Next-Key" header with the path-escaped first key not returned,
+	              which can be used as 'key1' of the next request.
+	maxtime       Stop scanning after this duration, e.g., "10s", returning the key-values
+	              read so far as with maxbytes.  The instance's MaxScanTime setting, if
+	              any, is used if it is shorter.  The limit that cut the range short is
+	              given by an "X-Truncated-Reason" header of "byte limit" or "time limit".
+
+	Values can be filtered on the server so only matching key-values are returned.  Every
+	value in the range must still be read, so this is an O(N) scan of the range that only
+	saves network transfer.  With maxbytes or maxtime, the byte budget counts only matching
+	values while "X-Next-Key" may follow keys that were scanned but didn't match.  All given
+	filters must match:
+
+	minsize       Only return values of at least this many bytes.
+	maxsize       Only return values of at most this many bytes.
+	valueprefix   Only return values beginning with these bytes, where any byte can be
+	              percent-encoded, e.g., "%89PNG".
+	jsonfield     Only return JSON object values whose field, given as a dot-separated path
+	              for nested objects, e.g., "meta.status", equals jsonvalue.  Values that
+	              aren't JSON objects don't match.
+	jsonvalue     The value the jsonfield must equal, given as JSON, e.g., "42", "true", or
+	              "\"done\"", or as a plain string if it isn't valid JSON.
+
+GET <api URL>/node/<UUID>/<data name>/export/ndjson[?values=false&compress=gzip]
+
+	Streams all key-value pairs in key order as newline-delimited JSON, one object per line
+	with a base64-encoded value:
+
+	{"key":"key1","value":"dmFsdWUx"}
+	{"key":"key2","value":"dmFsdWUy"}
+
+	Pairs are read and written incrementally so memory use is bounded regardless of the
+	number of keys.  If an error occurs after streaming has started, the output is cut
+	short and the error is logged.
+
+	GET Query-string Options:
+
+	values        If set to "false", only keys are written, e.g., {"key":"key1"}.
+	compress      "gzip" compresses the stream on the fly with "Content-Encoding: gzip" and
+	              "none" doesn't compress it.  If not given, the stream is compressed if the
+	              request's "Accept-Encoding" header includes "gzip".  Lines of values that
+	              are already gzip- or zstd-compressed are written in separate gzip members
+	              with Huffman-only compression, which shrinks their base64 encoding without
+	              compressing them again, so clients must accept concatenated gzip members
+	              as most gzip readers do.
+
 GET  <api URL>/node/<UUID>/<data name>/key/<key>
 POST <api URL>/node/<UUID>/<data name>/key/<key>
 DEL  <api URL>/node/<UUID>/<data name>/key/<key> 
@@ -123,6 +676,34 @@ DEL  <api URL>/node/<UUID>/<data name>/key/<key>
 	The "Content-type" of the HTTP response (and usually the request) are
 	"application/octet-stream" for arbitrary binary data.
 
+	If the server is configured with "serverTiming = true", GET and POST responses have a
+	"Server-Timing" header with the durations of request phases, e.g.,
+	"storage;dur=1.204, deserialize;dur=0.113, total;dur=1.350" for a GET.
+
+	To detect corruption in transit, a POST may include a "Content-MD5" header with the
+	base64-encoded MD5 of the body or an "X-Dvid-Checksum" header with its hexadecimal
+	CRC32 (IEEE) checksum.  If the received body doesn't match, the value isn't stored and
+	a 400 status is returned.  GET responses include both headers for the returned value.
+
+	GET responses also have an "ETag" header identifying the value.  To avoid deleting a key
+	that was concurrently updated, a DELETE may include an "If-Match" header with the ETag
+	of the value last read, or "*" to require any value, and/or an "If-Unmodified-Since"
+	header if the instance has TrackModified enabled.  The key is only deleted if it still
+	matches, with writes held off between the check and the delete, and status code 412 is
+	returned otherwise.
+
+	To make retries of a POST safe, a client may include an "Idempotency-Key" header with a
+	unique string, e.g., a UUID.  A later POST with the same header, key, and value within
+	the instance's IdempotencyWindow returns success without writing again and has an
+	"Idempotent-Replayed: true" header.  Reusing the header for a different key or value
+	within the window returns status code 409.
+
+	Custom metadata may be stored with a key by including headers prefixed with
+	"X-DVID-Meta-" in a POST, e.g., "X-DVID-Meta-Source: segmentation-v2".  The total size
+	of the metadata names and values is limited to 8 KB.  Each POST replaces the key's
+	metadata, so a POST without metadata headers removes it, as does a DELETE.  GETs of the
+	key return the metadata headers along with the value.
+
 	Arguments:
 
 	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
@@ -137,6 +718,213 @@ DEL  <api URL>/node/<UUID>/<data name>/key/<key>
 		"UUID": <UUID on which POST was done>
 	}
 
+	GET Query-string Options:
+
+	version       UUID of the version, which must be the requested node or one of its
+	              ancestors, whose value is returned, e.g., to compare a key's value with
+	              its value in an earlier version.
+	explain       If "true", instead of the value, returns JSON describing which version
+	              supplied the key's value when resolving the key through the version DAG:
+
+	              {
+	                  "Key": "myfile.dat",
+	                  "Found": true,
+	                  "Deleted": false,
+	                  "UUID": "28841c8277e044a7b187dda03e18da13",
+	                  "VersionID": 3
+	              }
+
+	              "Found" is false if no ancestor version has the key, and "Deleted" is true
+	              if the closest ancestor with the key deleted it.
+	template      Key whose value is a Go html/template used to render the key's JSON value
+	              as "text/html", e.g., for a dashboard.  Requires the Templates setting.
+	              Templates have only the builtin functions, output is limited to 1 MB, and
+	              values that aren't JSON return an error.  Templates can't define or call
+	              templates, nest range actions, or range over anything but fields of the
+	              value.
+	templatetext  Template text to render the value with, only allowed if the Templates
+	              setting is "inline".
+	transform     Returns the value transformed to another representation, streamed where
+	              possible.  Transformed values have no ETag or payload checksum.  Status
+	              code 400 is returned for other transforms or values they don't apply to.
+	                "gzip"          gzip-compressed value as "application/gzip"
+	                "gunzip"        decompressed value of a gzipped value
+	                "base64"        standard base64 encoding of the value as "text/plain"
+	                "json-pretty"   JSON value indented with two spaces
+	                "json-compact"  JSON value with insignificant whitespace removed
+	tier          Storage tier that answers the read, bypassing the value cache and without
+	              falling back to other tiers: "primary" (default) or, if the instance's
+	              store has a read fallback, "fallback".  Status code 400 is returned for
+	              tiers not configured for the instance.
+
+	POST Query-string Options:
+
+	raw           If "true", the value is stored exactly as sent, without the instance's
+	              compression and checksum, along with the request's "Content-Type" and
+	              "Content-Encoding" headers, which are returned with the value on GETs.
+	              This is the default for instances created with Passthrough enabled.
+	level         Compression level from 1 (fastest) to 9 (smallest) used for this value
+	              instead of the instance's CompressionLevel, e.g., to trade ratio for speed
+	              on bulk ingest or the reverse for archival writes.  Only allowed for
+	              instances with "gzip" compression and not with "raw".  Values are read
+	              the same regardless of the level they were written with.
+	ifabsent      If "true", the value is only written if the key doesn't exist, and status
+	              code 409 is returned otherwise.  Of concurrent create-only POSTs of a key,
+	              exactly one succeeds, e.g., for "create once" initialization or leader
+	              election flags.
+
+	If the instance was created with SoftDelete enabled, a DELETE moves the value to a
+	tombstone that is excluded from all GETs and key listings but can be recovered using
+	the "undelete" endpoint below until the SoftDeleteWindow has elapsed.
+
+POST <api URL>/node/<UUID>/<data name>/key/<key>/touch
+
+	Sets the last-modified timestamp of an existing key to the current time without rewriting
+	its value, e.g., for lease or heartbeat patterns.  Requires the instance to have been
+	created with TrackModified enabled.  Returns status code 404 if the key doesn't exist.
+
+	Arguments:
+
+	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of keyvalue data instance.
+	key           An alphanumeric key.
+
+POST <api URL>/node/<UUID>/<data name>/key/<key>/apply
+
+	Atomically modifies the JSON value of a key with a JSON list of operations applied in
+	order and returns the resulting value, which is stored.  If the key doesn't exist, the
+	operations are applied to null.  Writes are held off between reading and writing the
+	value, so concurrent modifications of a key aren't lost as with GET then POST.  Instances
+	with a CoalesceInterval reject this endpoint since buffered puts can't be held off.
+
+	[
+		{"Op": "append", "Path": "events", "Value": {"type": "start"}},
+		{"Op": "increment", "Path": "stats.count", "By": 2},
+		{"Op": "set", "Path": "owner", "Value": "alice"}
+	]
+
+	Operations:
+
+	append        Appends "Value" to the array at "Path", creating the array if missing.
+	increment     Adds the number "By", 1 if not given, to the number at "Path", where a
+	              missing number is 0.
+	set           Sets the value at "Path" to "Value".
+
+	"Path" is a dot-separated path of object fields, where missing objects are created and
+	an empty path is the whole value.  There can be at most 16 operations with paths of at
+	most 16 fields, and the current and resulting values must be at most 1 MB.  Objects in
+	the result have their fields sorted.  Status code 400 is returned and nothing is stored
+	if any operation fails.
+
+	Arguments:
+
+	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of keyvalue data instance.
+	key           An alphanumeric key.
+
+GET <api URL>/node/<UUID>/<data name>/key/<key>/meta
+
+	Returns the custom metadata stored with a key from "X-DVID-Meta-" POST headers as a JSON
+	object mapping each name, without the prefix and in canonical header form, to its value:
+
+	{ "Source": "segmentation-v2", "Owner": "flyem" }
+
+	Returns an empty object if the key has no metadata and status code 404 if the key
+	doesn't exist.
+
+	Arguments:
+
+	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of keyvalue data instance.
+	key           An alphanumeric key.
+
+GET  <api URL>/node/<UUID>/<data name>/key/<key>/raw
+POST <api URL>/node/<UUID>/<data name>/key/<key>/raw
+
+	Gets or puts the stored serialization of a key's value, i.e., the bytes kept by the
+	storage engine with DVID's serialization framing, compression, and checksum intact,
+	instead of the value itself.  A GET returns status code 404 if the key doesn't exist.
+	A POST stores the body as is after checking that it can be deserialized, so
+	serializations from GETs can be copied exactly to another instance, e.g., for
+	replication, or inspected for debugging.  Chunked and deduplicated values are returned
+	as the full serialization they were stored from.
+
+	Serializations are specific to DVID's storage format and the instance's settings, e.g.,
+	codec and value hooks, and aren't portable across changes to either.
+
+	Arguments:
+
+	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of keyvalue data instance.
+	key           An alphanumeric key.
+
+POST <api URL>/node/<UUID>/<data name>/key/<key>/undelete
+
+	Recovers a soft-deleted key-value pair if it is still within the instance's recovery
+	window.  Returns status code 404 if no recoverable tombstone exists for the key and
+	an error if the key has since been written.
+
+	Arguments:
+
+	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of keyvalue data instance.
+	key           An alphanumeric key.
+
+POST <api URL>/node/<UUID>/<data name>/merge
+
+	Resolves this instance's keys in the unlocked version UUID, which must be a merge of two
+	branches, e.g., a child created by POST /api/repo/{uuid}/merge.  The first parent of the
+	merge is the "ours" branch and the second is "theirs".  The request body gives a conflict
+	policy:
+
+	{ "Policy": "error" }
+
+	Keys written on both branches since they diverged are explicitly stored in the merged
+	version through the usual write path, along with their custom metadata.  If their values
+	differ, the policy determines the result: "ours" or "theirs" take the value of that
+	branch, while "error" (the default) writes nothing when there are any conflicting keys.
+	The response lists the resolved and conflicting keys:
+
+	{ "Resolved": ["key1", "key2", "key3"], "Conflicts": ["key1", "key2"] }
+
+	If the merge is prevented by conflicts, status code 409 is returned and "Resolved" is
+	omitted.
+
+	Arguments:
+
+	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of keyvalue data instance.
+
+POST <api URL>/node/<UUID>/<data name>/txn
+
+	Applies a list of put and delete operations as a single transaction, where either all
+	operations are applied or none are.  The operations are applied in order and expect
+	a JSON body with base64-encoded values for puts:
+
+	[
+		{ "Op": "put", "Key": "key1", "Value": "aGVsbG8=" },
+		{ "Op": "delete", "Key": "key2" },
+		...
+	]
+
+	All operations are committed in one batch.  Stores with atomic batches, e.g., leveldb
+	variants, guarantee all-or-nothing behavior.  Other stores like cloud or network-backed
+	stores apply the batch on a best-effort basis, so a failure during commit can leave
+	some operations applied.  Any invalid operation causes the entire transaction to be
+	rejected before anything is committed.
+
+	Transactions will be logged as a Kafka JSON message with the following format:
+	{ 
+		"Action": "txnkv",
+		"Keys": [<key1>, <key2>, ...],
+		"UUID": <UUID on which POST was done>
+	}
+
+	Arguments:
+
+	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of keyvalue data instance.
+
 GET <api URL>/node/<UUID>/<data name>/keyvalues[?jsontar=true]
 POST <api URL>/node/<UUID>/<data name>/keyvalues
 
@@ -160,7 +948,20 @@ POST <api URL>/node/<UUID>/<data name>/keyvalues
 	For GET, the query body must include a Keys serialization and a KeyValues serialization is
 	returned.
 
-	For POST, the query body must include a KeyValues serialization.
+	For POST, the query body must include a KeyValues serialization.  As with POSTs to the
+	"key" endpoint, a "Content-MD5" or "X-Dvid-Checksum" header is verified against the body
+	and nothing is stored on mismatch.  Without either header, key-values are stored as
+	they're read, so large imports aren't held in memory, and a malformed serialization
+	returns an error after storing the key-values before it.
+
+	If "dedup=true" is given for a POST, values are content-hashed and each unique payload
+	is stored once with keys holding references to it.  This can greatly reduce storage
+	for highly redundant datasets, e.g., many empty blocks.  Reads transparently follow
+	references at the cost of one additional key-value read per deduplicated key.  Values
+	no larger than the instance's InlineSize setting are stored directly under their keys.
+	Payloads are not reference counted: deleting or overwriting a deduplicated key leaves
+	its payload in place, so unreferenced payloads are only reclaimed when the data
+	instance is deleted.
 	
 	POSTs will be logged as a series of Kafka JSON messages, each with the format equivalent
 	to the single POST /key:
@@ -176,10 +977,64 @@ POST <api URL>/node/<UUID>/<data name>/keyvalues
 	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
 	data name     Name of keyvalue data instance.
 
+	POST Query-string Options:
+
+	dedup		If set to "true", store each unique value once and reference it from keys.
+
 	GET Query-string Options:
 
 	jsontar		If set to any value for GET, query body must be JSON array of string keys
 				and the returned data will be a tarfile with keys as file names.
+
+POST <api URL>/node/<UUID>/<data name>/keyvalues/exists
+
+	Checks whether each of a list of keys exists without reading the values.  The query body
+	must be a JSON array of string keys, and the response is a JSON array of booleans in the
+	same order, e.g., POST ["a", "b"] might return [true, false].
+
+	Arguments:
+
+	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of keyvalue data instance.
+
+POST <api URL>/node/<UUID>/<data name>/keyvalues/stream
+
+	Returns the values of a list of keys as a single binary stream, the most compact bulk
+	read format for clients that process values sequentially.  The query body must be a
+	JSON array of string keys, e.g., ["a", "b"], and the response has one record per key
+	in request order.  Each record is:
+
+	<key length><key bytes><value length><value bytes>
+
+	where lengths are 4-byte little-endian unsigned integers.  A key that isn't found has
+	a value length of 0xFFFFFFFF and no value bytes, so it can be distinguished from an
+	empty value, which has a value length of 0.
+
+	Arguments:
+
+	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of keyvalue data instance.
+
+POST <api URL>/node/<UUID>/<data name>/keyvalues/stat
+
+	Returns the existence and stored size of each of a list of keys, so clients can
+	reconcile their copies in one request.  The query body must be a JSON array of string
+	keys, and the response is a JSON array of objects in the same order, e.g., POST
+	["a", "b"] might return:
+
+	[
+		{ "Found": true, "Size": 1034, "Modified": "2020-03-01T12:00:00.000000001Z" },
+		{ "Found": false }
+	]
+
+	"Size" is the number of bytes of the stored value after the instance's compression and
+	checksum.  Values split into chunks are sized from their chunk manifest without reading
+	the chunks.  "Modified" is only given if the instance was created with TrackModified.
+
+	Arguments:
+
+	UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of keyvalue data instance.
 `
 
 func init() {
@@ -217,7 +1072,28 @@ func (dtype *Type) NewDataService(uuid dvid.UUID, id dvid.InstanceID, name dvid.
 	if err != nil {
 		return nil, err
 	}
-	return &Data{basedata}, nil
+	data := &Data{Data: basedata}
+	if data.StoreAlias() != "" {
+		if _, err := datastore.GetOrderedKeyValueDB(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := data.Properties.setByConfig(c); err != nil {
+		return nil, err
+	}
+	if err := data.checkCoalesce(data.DataName(), data.Quota()); err != nil {
+		return nil, err
+	}
+	if data.AuditLog && data.GetWriteLog() == nil {
+		return nil, fmt.Errorf("AuditLog requires a log store for keyvalue %q", name)
+	}
+	if data.SoftDelete {
+		data.startPurger()
+	}
+	if data.CoalesceInterval > 0 {
+		data.startFlusher()
+	}
+	return data, nil
 }
 
 func (dtype *Type) Help() string {
@@ -237,264 +1113,1352 @@ func GetByUUIDName(uuid dvid.UUID, name dvid.InstanceName) (*Data, error) {
 	return data, nil
 }
 
-// Data embeds the datastore's Data and extends it with keyvalue properties (none for now).
-type Data struct {
-	*datastore.Data
-}
+// DefaultSoftDeleteWindow is the default duration soft-deleted keys can be recovered.
+const DefaultSoftDeleteWindow = 7 * 24 * time.Hour
 
-func (d *Data) Equals(d2 *Data) bool {
-	if !d.Data.Equals(d2.Data) {
-		return false
-	}
-	return true
-}
+// Properties are additional properties for keyvalue data instances.
+type Properties struct {
+	// SoftDelete, if true, moves deleted values to tombstones that can be recovered.
+	SoftDelete bool
 
-func (d *Data) MarshalJSON() ([]byte, error) {
-	return json.Marshal(struct {
-		Base     *datastore.Data
-		Extended struct{}
-	}{
-		d.Data,
-		struct{}{},
-	})
+	// SoftDeleteWindow is the duration tombstones are kept before being purged.
+	SoftDeleteWindow time.Duration
+
+	// TrackModified, if true, stores a last-modified timestamp for each key.
+	TrackModified bool
+
+	// AccessInterval, if nonzero, enables last-access times of keys, recorded at most
+	// once per interval per key.
+	AccessInterval time.Duration
+
+	// MaxKeys, if nonzero, is the maximum number of keys allowed in the instance.
+	MaxKeys uint64
+
+	// ChunkSize, if nonzero, is the maximum bytes stored under one key, with larger values
+	// split across chunk keys.
+	ChunkSize int
+
+	// Passthrough, if true, stores values POSTed to single keys exactly as sent.
+	Passthrough bool
+
+	// InlineSize is the largest value stored directly under its key, rather than as a
+	// reference to a deduplicated payload, on deduplicated writes.
+	InlineSize int
+
+	// CoalesceInterval, if nonzero, is how long puts are buffered in memory, so only the
+	// latest value of a rapidly updated key is written.
+	CoalesceInterval time.Duration
+
+	// CacheSize, if nonzero, is the megabytes of recently read values cached in memory.
+	CacheSize int
+
+	// MaxScanTime, if nonzero, is how long a range read of key-values scans before
+	// returning partial results.
+	MaxScanTime time.Duration
+
+	// IdempotencyWindow is the duration idempotency keys of writes are remembered.
+	IdempotencyWindow time.Duration
+
+	// MaxPendingWrites, if nonzero, is the maximum number of write requests in progress.
+	MaxPendingWrites int
+
+	// WriteOverload is "reject" or "block", the handling of writes beyond MaxPendingWrites.
+	WriteOverload string
+
+	// Templates is "stored" or "inline" if JSON values can be rendered through templates
+	// stored in keys or also given in requests, or empty if rendering is disabled.
+	Templates string
+
+	// JSONSchema, if non-empty, is a JSON Schema that written values must match.
+	JSONSchema string
+
+	// IndexField, if non-empty, is the dot-separated path of a JSON field of values that
+	// is indexed so keys can be looked up by the field's value.
+	IndexField string
+
+	// ValueHooks is a comma-separated list of registered value hooks applied in order to
+	// values before serialization and in reverse order after deserialization.
+	ValueHooks string
+
+	// AuditLog, if true, records each put and delete of keys via HTTP in the log store.
+	AuditLog bool
 }
 
-func (d *Data) GobDecode(b []byte) error {
-	buf := bytes.NewBuffer(b)
-	dec := gob.NewDecoder(buf)
-	if err := dec.Decode(&(d.Data)); err != nil {
+func (p *Properties) setByConfig(c dvid.Config) error {
+	softDelete, found, err := c.GetBool("SoftDelete")
+	if err != nil {
 		return err
 	}
-	return nil
-}
-
-func (d *Data) GobEncode() ([]byte, error) {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	if err := enc.Encode(d.Data); err != nil {
-		return nil, err
+	if found {
+		p.SoftDelete = softDelete
 	}
-	return buf.Bytes(), nil
-}
-
-func (d *Data) GetKeysInRange(ctx storage.Context, keyBeg, keyEnd string) ([]string, error) {
-	db, err := datastore.GetOrderedKeyValueDB(d)
+	trackModified, found, err := c.GetBool("TrackModified")
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	// Compute first and last key for range
-	first, err := NewTKey(keyBeg)
+	if found {
+		p.TrackModified = trackModified
+	}
+	passthrough, found, err := c.GetBool("Passthrough")
 	if err != nil {
-		return nil, err
+		return err
 	}
-	last, err := NewTKey(keyEnd)
+	if found {
+		p.Passthrough = passthrough
+	}
+	auditLog, found, err := c.GetBool("AuditLog")
 	if err != nil {
-		return nil, err
+		return err
 	}
-	keys, err := db.KeysInRange(ctx, first, last)
+	if found {
+		p.AuditLog = auditLog
+	}
+	maxKeys, found, err := c.GetInt("MaxKeys")
 	if err != nil {
-		fmt.Printf("Error detected at GetKeysInRange level: %v\n", err)
-		return nil, err
+		return err
 	}
-	keyList := []string{}
-	for _, key := range keys {
-		keyStr, err := DecodeTKey(key)
-		if err != nil {
-			return nil, err
+	if found {
+		if maxKeys < 0 {
+			return fmt.Errorf("MaxKeys must be non-negative, got %d", maxKeys)
 		}
-		keyList = append(keyList, keyStr)
+		p.MaxKeys = uint64(maxKeys)
 	}
-	return keyList, nil
-}
-
-func (d *Data) GetKeys(ctx storage.Context) ([]string, error) {
-	db, err := datastore.GetOrderedKeyValueDB(d)
+	chunkSize, found, err := c.GetInt("ChunkSize")
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	// Compute first and last key for range
-	first := storage.MinTKey(keyStandard)
-	last := storage.MaxTKey(keyStandard)
-	keys, err := db.KeysInRange(ctx, first, last)
+	if found {
+		if chunkSize < 0 {
+			return fmt.Errorf("ChunkSize must be non-negative, got %d", chunkSize)
+		}
+		p.ChunkSize = chunkSize
+	}
+	inlineSize, found, err := c.GetInt("InlineSize")
 	if err != nil {
-		return nil, err
+		return err
 	}
-	keyList := []string{}
-	for _, key := range keys {
-		keyStr, err := DecodeTKey(key)
-		if err != nil {
-			return nil, err
+	if found {
+		if inlineSize < 0 {
+			return fmt.Errorf("InlineSize must be non-negative, got %d", inlineSize)
 		}
-		keyList = append(keyList, keyStr)
+		p.InlineSize = inlineSize
 	}
-	return keyList, nil
-}
-
-// GetData gets a value using a key
-func (d *Data) GetData(ctx storage.Context, keyStr string) ([]byte, bool, error) {
-	db, err := datastore.GetOrderedKeyValueDB(d)
+	maxPending, found, err := c.GetInt("MaxPendingWrites")
 	if err != nil {
-		return nil, false, err
+		return err
 	}
-	tk, err := NewTKey(keyStr)
+	if found {
+		if maxPending < 0 {
+			return fmt.Errorf("MaxPendingWrites must be non-negative, got %d", maxPending)
+		}
+		p.MaxPendingWrites = maxPending
+	}
+	overload, found, err := c.GetString("WriteOverload")
 	if err != nil {
-		return nil, false, err
+		return err
 	}
-	data, err := db.Get(ctx, tk)
+	if found {
+		overload = strings.ToLower(overload)
+		if overload != WriteOverloadReject && overload != WriteOverloadBlock {
+			return fmt.Errorf("WriteOverload must be %q or %q, got %q", WriteOverloadReject, WriteOverloadBlock, overload)
+		}
+		p.WriteOverload = overload
+	}
+	cacheSize, found, err := c.GetInt("CacheSize")
 	if err != nil {
-		return nil, false, fmt.Errorf("Error in retrieving key '%s': %v", keyStr, err)
+		return err
 	}
-	if data == nil {
-		return nil, false, nil
+	if found {
+		if cacheSize < 0 {
+			return fmt.Errorf("CacheSize must be non-negative, got %d", cacheSize)
+		}
+		p.CacheSize = cacheSize
 	}
-	uncompress := true
-	value, _, err := dvid.DeserializeData(data, uncompress)
+	intervalStr, found, err := c.GetString("CoalesceInterval")
 	if err != nil {
-		return nil, false, fmt.Errorf("Unable to deserialize data for key '%s': %v\n", keyStr, err)
+		return err
 	}
-	return value, true, nil
-}
-
-// PutData puts a key-value at a given uuid
-func (d *Data) PutData(ctx storage.Context, keyStr string, value []byte) error {
-	db, err := datastore.GetOrderedKeyValueDB(d)
+	if found {
+		interval, err := time.ParseDuration(intervalStr)
+		if err != nil {
+			return fmt.Errorf("bad CoalesceInterval %q: %v", intervalStr, err)
+		}
+		if interval < 0 {
+			return fmt.Errorf("CoalesceInterval must be non-negative, got %q", intervalStr)
+		}
+		p.CoalesceInterval = interval
+	}
+	accessStr, found, err := c.GetString("AccessInterval")
 	if err != nil {
 		return err
 	}
-	serialization, err := dvid.SerializeData(value, d.Compression(), d.Checksum())
+	if found {
+		accessInterval, err := time.ParseDuration(accessStr)
+		if err != nil {
+			return fmt.Errorf("bad AccessInterval %q: %v", accessStr, err)
+		}
+		if accessInterval < 0 {
+			return fmt.Errorf("AccessInterval must be non-negative, got %q", accessStr)
+		}
+		p.AccessInterval = accessInterval
+	}
+	scanTimeStr, found, err := c.GetString("MaxScanTime")
 	if err != nil {
-		return fmt.Errorf("Unable to serialize data: %v\n", err)
+		return err
 	}
-	tk, err := NewTKey(keyStr)
+	if found {
+		scanTime, err := time.ParseDuration(scanTimeStr)
+		if err != nil {
+			return fmt.Errorf("bad MaxScanTime %q: %v", scanTimeStr, err)
+		}
+		if scanTime < 0 {
+			return fmt.Errorf("MaxScanTime must be non-negative, got %q", scanTimeStr)
+		}
+		p.MaxScanTime = scanTime
+	}
+	idemWindowStr, found, err := c.GetString("IdempotencyWindow")
 	if err != nil {
 		return err
 	}
-	return db.Put(ctx, tk, serialization)
-}
-
-// DeleteData deletes a key-value pair
-func (d *Data) DeleteData(ctx storage.Context, keyStr string) error {
-	db, err := datastore.GetOrderedKeyValueDB(d)
+	if found {
+		idemWindow, err := time.ParseDuration(idemWindowStr)
+		if err != nil {
+			return fmt.Errorf("bad IdempotencyWindow %q: %v", idemWindowStr, err)
+		}
+		if idemWindow <= 0 {
+			return fmt.Errorf("IdempotencyWindow must be positive, got %q", idemWindowStr)
+		}
+		p.IdempotencyWindow = idemWindow
+	}
+	hookNames, found, err := c.GetString("ValueHooks")
 	if err != nil {
 		return err
 	}
-	tk, err := NewTKey(keyStr)
+	if found {
+		if _, err := getValueHooks(hookNames); err != nil {
+			return err
+		}
+		p.ValueHooks = hookNames
+	}
+	templates, found, err := c.GetString("Templates")
 	if err != nil {
 		return err
 	}
-	return db.Delete(ctx, tk)
-}
-
-// put handles a PUT command-line request.
-func (d *Data) put(cmd datastore.Request, reply *datastore.Response) error {
-	if len(cmd.Command) < 5 {
-		return fmt.Errorf("The key name must be specified after 'put'")
+	if found {
+		templates = strings.ToLower(templates)
+		if templates != "" && templates != TemplatesStored && templates != TemplatesInline {
+			return fmt.Errorf("Templates must be empty, %q, or %q, got %q", TemplatesStored, TemplatesInline, templates)
+		}
+		p.Templates = templates
 	}
-	if len(cmd.Input) == 0 {
-		return fmt.Errorf("No data was passed into standard input")
+	schemaText, found, err := c.GetString("JSONSchema")
+	if err != nil {
+		return err
 	}
-	var uuidStr, dataName, cmdStr, keyStr string
-	cmd.CommandArgs(1, &uuidStr, &dataName, &cmdStr, &keyStr)
-
-	_, versionID, err := datastore.MatchingUUID(uuidStr)
+	if found {
+		if schemaText != "" {
+			if _, err := parseJSONSchema(schemaText); err != nil {
+				return err
+			}
+		}
+		p.JSONSchema = schemaText
+	}
+	indexField, found, err := c.GetString("IndexField")
 	if err != nil {
 		return err
 	}
-
-	// Store data
-	if !d.Versioned() {
-		// Map everything to root version.
-		versionID, err = datastore.GetRepoRootVersion(versionID)
+	if found {
+		p.IndexField = indexField
+	}
+	windowStr, found, err := c.GetString("SoftDeleteWindow")
+	if err != nil {
+		return err
+	}
+	if found {
+		window, err := time.ParseDuration(windowStr)
 		if err != nil {
-			return err
+			return fmt.Errorf("bad SoftDeleteWindow %q: %v", windowStr, err)
 		}
+		if window <= 0 {
+			return fmt.Errorf("SoftDeleteWindow must be positive, got %q", windowStr)
+		}
+		p.SoftDeleteWindow = window
 	}
-	ctx := datastore.NewVersionedCtx(d, versionID)
-	if err = d.PutData(ctx, keyStr, cmd.Input); err != nil {
-		return fmt.Errorf("Error on put to key %q for keyvalue %q: %v\n", keyStr, d.DataName(), err)
-	}
-
-	reply.Output = []byte(fmt.Sprintf("Put %d bytes into key %q for keyvalue %q, uuid %s\n",
-		len(cmd.Input), keyStr, d.DataName(), uuidStr))
 	return nil
 }
 
-// JSONString returns the JSON for this Data's configuration
-func (d *Data) JSONString() (jsonStr string, err error) {
-	m, err := json.Marshal(d)
-	if err != nil {
-		return "", err
-	}
-	return string(m), nil
-}
+// Data embeds the datastore's Data and extends it with keyvalue properties.
+type Data struct {
+	*datastore.Data
+	Properties
 
-// --- DataService interface ---
+	purgeOnce sync.Once
+	purgeDone chan struct{}
 
-func (d *Data) Help() string {
-	return fmt.Sprintf(helpMessage)
+	shutdownOnce sync.Once // closes the done channels of background goroutines
+
+	keyCountMu sync.Mutex // serializes writes that change the key count under MaxKeys
+
+	coalesceMu  sync.Mutex // protects coalesced, coalesceSeq, flushOnce, flushDone, and changes to CoalesceInterval
+	coalesced   map[coalescedKey]coalescedWrite
+	coalesceSeq uint64
+	flushMu     sync.Mutex // serializes flushes of coalesced writes
+	flushOnce   sync.Once
+	flushDone   chan struct{}
+
+	cacheMu sync.Mutex // protects cache
+	cache   *valueCache
+
+	indexMu       sync.RWMutex // held for reading by writes, for writing by reindexes, conditional deletes and creates, and swaps
+	reindexMu     sync.Mutex   // protects reindexStatus
+	reindexStatus ReindexStatus
+
+	idempotencyMu   sync.Mutex // serializes idempotent writes so retries see earlier records
+	idempotencyOnce sync.Once
+	idempotencyDone chan struct{}
+
+	writeSlotsMu sync.Mutex // protects writeSlotsCh
+	writeSlotsCh chan struct{}
+
+	schemaMu   sync.Mutex // protects the parsed JSONSchema
+	schemaText string
+	schema     *jsonSchema
+
+	accessedMu sync.Mutex // protects accessed
+	accessed   map[coalescedKey]time.Time
+
+	dictMu sync.RWMutex // protects dicts
+	dicts  compressionDicts
 }
 
-// DoRPC acts as a switchboard for RPC commands.
-func (d *Data) DoRPC(request datastore.Request, reply *datastore.Response) error {
-	switch request.TypeCommand() {
-	case "put":
-		return d.put(request, reply)
-	default:
-		return fmt.Errorf("Unknown command.  Data '%s' [%s] does not support '%s' command.",
-			d.DataName(), d.TypeName(), request.TypeCommand())
+func (d *Data) Equals(d2 *Data) bool {
+	if !d.Data.Equals(d2.Data) {
+		return false
 	}
+	return d.Properties == d2.Properties
 }
 
-// ServeHTTP handles all incoming HTTP requests for this data.
-func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) {
-	timedLog := dvid.NewTimeLog()
+// SerializationInfo describes how values are encoded when stored, so clients that request
+// raw stored bytes can decode them.
+type SerializationInfo struct {
+	Compression      string // "none", "snappy", "lz4", "gzip", or "jpeg"
+	CompressionLevel int
+	Checksum         string // "none" or "crc32"
+	ChecksumMinSize  uint64 // bytes below which values are stored without a checksum
+	Codec            string // name of the value codec or empty if none
+	Format           uint8  // leading format byte of each stored value
+	Versioned        bool
+	MaxValueSize     int // maximum bytes stored under one key before chunking, 0 if unlimited
+
+	// CompressionDict is the ID of the trained dictionary that compresses values of at
+	// most DictMaxValueSize bytes, or 0 if none.
+	CompressionDict  uint32 `json:",omitempty"`
+	DictMaxValueSize int    `json:",omitempty"`
+}
 
-	// Break URL request into arguments
-	url := r.URL.Path[len(server.WebAPIPath):]
-	parts := strings.Split(url, "/")
-	if len(parts[len(parts)-1]) == 0 {
-		parts = parts[:len(parts)-1]
+// serializationInfo returns the effective settings used by PutData to serialize values.
+func (d *Data) serializationInfo() SerializationInfo {
+	compression := d.Compression()
+	format := dvid.StoredSerializationFormat(compression, d.Checksum(), d.Codec())
+	_, checksum := dvid.DecodeSerializationFormat(format)
+	info := SerializationInfo{
+		CompressionLevel: int(compression.Level()),
+		Codec:            d.Codec(),
+		ChecksumMinSize:  d.ChecksumMinSize(),
+		Format:           uint8(format),
+		Versioned:        d.Versioned(),
+		MaxValueSize:     d.ChunkSize,
 	}
-
-	if len(parts) < 4 {
-		server.BadRequest(w, r, "incomplete API specification")
-		return
+	d.dictMu.RLock()
+	if d.dicts.Current != 0 {
+		info.CompressionDict, info.DictMaxValueSize = d.dicts.Current, d.dicts.MaxValueSize
 	}
+	d.dictMu.RUnlock()
+	switch compression.Format() {
+	case dvid.Uncompressed:
+		info.Compression = "none"
+	case dvid.Snappy:
+		info.Compression = "snappy"
+	case dvid.LZ4:
+		info.Compression = "lz4"
+	case dvid.Gzip:
+		info.Compression = "gzip"
+	case dvid.JPEG:
+		info.Compression = "jpeg"
+	default:
+		info.Compression = "unknown"
+	}
+	switch checksum {
+	case dvid.NoChecksum:
+		info.Checksum = "none"
+	case dvid.CRC32:
+		info.Checksum = "crc32"
+	default:
+		info.Checksum = "unknown"
+	}
+	return info
+}
 
-	var comment string
-	action := strings.ToLower(r.Method)
-
-	switch parts[3] {
-	case "help":
-		w.Header().Set("Content-Type", "text/plain")
-		fmt.Fprintln(w, d.Help())
-		return
+func (d *Data) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Base          *datastore.Data
+		Extended      Properties
+		Serialization SerializationInfo
+		Cache         CacheStats
+	}{
+		d.Data,
+		d.Properties,
+		d.serializationInfo(),
+		d.GetCacheStats(),
+	})
+}
 
-	case "info":
-		jsonStr, err := d.JSONString()
-		if err != nil {
-			server.BadRequest(w, r, err)
-			return
+func (d *Data) GobDecode(b []byte) error {
+	buf := bytes.NewBuffer(b)
+	dec := gob.NewDecoder(buf)
+	if err := dec.Decode(&(d.Data)); err != nil {
+		return err
+	}
+	// Instances stored before extended properties were added only have the base data.
+	if err := dec.Decode(&(d.Properties)); err != nil {
+		if err == io.EOF {
+			return nil
 		}
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, jsonStr)
-		return
+		return err
+	}
+	// Likewise, instances stored before dictionary compression have no dictionaries.
+	if err := dec.Decode(&(d.dicts)); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
 
-	case "keys":
-		keyList, err := d.GetKeys(ctx)
-		if err != nil {
-			server.BadRequest(w, r, err)
-			return
-		}
-		jsonBytes, err := json.Marshal(keyList)
-		if err != nil {
-			server.BadRequest(w, r, err)
-			return
-		}
+func (d *Data) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(d.Data); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(d.Properties); err != nil {
+		return nil, err
+	}
+	d.dictMu.RLock()
+	defer d.dictMu.RUnlock()
+	if err := enc.Encode(d.dicts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ModifyConfig modifies the base and keyvalue-specific configuration.
+func (d *Data) ModifyConfig(config dvid.Config) error {
+	// stored values can only be read with the hooks they were written with.
+	hookNames, found, err := config.GetString("ValueHooks")
+	if err != nil {
+		return err
+	}
+	if found && hookNames != d.ValueHooks {
+		return fmt.Errorf("ValueHooks of keyvalue %q can only be set at creation", d.DataName())
+	}
+	if err := d.Data.ModifyConfig(config); err != nil {
+		return err
+	}
+	// validate the new properties on a copy so a rejected config leaves the instance as is.
+	props := d.Properties
+	if err := props.setByConfig(config); err != nil {
+		return err
+	}
+	if err := props.checkCoalesce(d.DataName(), d.Quota()); err != nil {
+		return err
+	}
+	d.coalesceMu.Lock()
+	d.Properties = props
+	d.coalesceMu.Unlock()
+	if d.SoftDelete {
+		d.startPurger()
+	}
+	if d.CoalesceInterval > 0 {
+		d.startFlusher()
+	} else {
+		d.flushWrites()
+	}
+	return nil
+}
+
+func (d *Data) GetKeysInRange(ctx storage.Context, keyBeg, keyEnd string) ([]string, error) {
+	return d.getKeysInRange(ctx, keyBeg, keyEnd, 0)
+}
+
+// getKeysInRange returns the keys in the range [keyBeg, keyEnd], stopping the scan once
+// max+1 keys are found if max is positive.
+func (d *Data) getKeysInRange(ctx storage.Context, keyBeg, keyEnd string, max int) ([]string, error) {
+	// Compute first and last key for range
+	first, err := NewTKey(keyBeg)
+	if err != nil {
+		return nil, err
+	}
+	last, err := NewTKey(keyEnd)
+	if err != nil {
+		return nil, err
+	}
+	return d.listKeys(ctx, first, last, max)
+}
+
+func (d *Data) GetKeys(ctx storage.Context) ([]string, error) {
+	return d.listKeys(ctx, storage.MinTKey(keyStandard), storage.MaxTKey(keyStandard), 0)
+}
+
+// errKeyLimit stops a key scan once more keys than a listing's limit have been found.
+var errKeyLimit = errors.New("key listing limit reached")
+
+// listKeys returns the keys in the type-specific key range [first, last].  If max is
+// positive, the scan stops once max+1 keys are found, so a listing can be cut to max keys
+// and marked as cut without reading every key in the range.
+func (d *Data) listKeys(ctx storage.Context, first, last storage.TKey, max int) ([]string, error) {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	keyList := []string{}
+	if max <= 0 {
+		keys, err := db.KeysInRange(ctx, first, last)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			keyStr, err := DecodeTKey(key)
+			if err != nil {
+				return nil, err
+			}
+			keyList = append(keyList, keyStr)
+		}
+		return keyList, nil
+	}
+	err = db.ProcessRange(ctx, first, last, nil, func(c *storage.Chunk) error {
+		if c == nil || c.TKeyValue == nil {
+			return nil
+		}
+		keyStr, err := DecodeTKey(c.K)
+		if err != nil {
+			return err
+		}
+		keyList = append(keyList, keyStr)
+		if len(keyList) > max {
+			return errKeyLimit
+		}
+		return nil
+	})
+	if err != nil && err != errKeyLimit {
+		return nil, err
+	}
+	return keyList, nil
+}
+
+// ProcessKeyValuesInRange sends each key-value pair with a key in the range [keyBeg, keyEnd]
+// and beginning with the given prefix to the function f.  The prefix is checked during
+// iteration and, where more restrictive than the given range, tightens the scan bounds.
+// An empty prefix matches all keys.
+func (d *Data) ProcessKeyValuesInRange(ctx storage.Context, keyBeg, keyEnd, prefix string, f func(key string, value []byte) error) error {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	first, err := NewTKey(keyBeg)
+	if err != nil {
+		return err
+	}
+	last, err := NewTKey(keyEnd)
+	if err != nil {
+		return err
+	}
+	if prefix != "" {
+		prefixBeg, prefixEnd := storage.PrefixRange(keyStandard, []byte(prefix))
+		if bytes.Compare(prefixBeg, first) > 0 {
+			first = prefixBeg
+		}
+		if bytes.Compare(prefixEnd, last) < 0 {
+			last = prefixEnd
+		}
+		if bytes.Compare(first, last) > 0 {
+			return nil
+		}
+	}
+	return d.processKeyValues(ctx, db, first, last, prefix, f)
+}
+
+// processKeyValues sends each key-value pair with a type-specific key in the range
+// [first, last] and beginning with the given prefix to the function f.
+func (d *Data) processKeyValues(ctx storage.Context, db storage.OrderedKeyValueDB, first, last storage.TKey, prefix string, f func(key string, value []byte) error) error {
+	return db.ProcessRange(ctx, first, last, nil, func(c *storage.Chunk) error {
+		if c == nil || c.TKeyValue == nil {
+			return nil
+		}
+		keyStr, err := DecodeTKey(c.K)
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(keyStr, prefix) {
+			return nil
+		}
+		if c.V == nil {
+			return f(keyStr, nil)
+		}
+		data, err := d.resolveValue(ctx, db, keyStr, c.V)
+		if err != nil {
+			return fmt.Errorf("unable to resolve data for key %q: %v", keyStr, err)
+		}
+		value, err := d.decodeValue(data)
+		if err != nil {
+			return fmt.Errorf("unable to deserialize data for key %q: %v", keyStr, err)
+		}
+		return f(keyStr, value)
+	})
+}
+
+// errBudgetReached stops a range scan once the byte or time budget has been used.
+var errBudgetReached = errors.New("range budget reached")
+
+// Reasons a range read was cut short by its budget.
+const (
+	TruncatedByteLimit = "byte limit"
+	TruncatedTimeLimit = "time limit"
+	TruncatedKeyLimit  = "key limit"
+)
+
+// GetKeyValuesInRangeWithBudget returns key-value pairs as in ProcessKeyValuesInRange,
+// keeping only values matched by the filter if it isn't nil, but stops before the
+// accumulated value bytes would exceed maxBytes or once maxDuration has elapsed, where
+// either limit is ignored if zero.  At least one pair is scanned so paging always makes
+// progress.  If the range was cut short, truncated gives the limit reached and next is the
+// first key not scanned, which can be used as the beginning key of the next request.
+func (d *Data) GetKeyValuesInRangeWithBudget(ctx storage.Context, keyBeg, keyEnd, prefix string, filter *ValueFilter, maxBytes int, maxDuration time.Duration) (kvs []*KeyValue, next, truncated string, err error) {
+	var deadline time.Time
+	if maxDuration > 0 {
+		deadline = time.Now().Add(maxDuration)
+	}
+	var total, scanned int
+	err = d.ProcessKeyValuesInRange(ctx, keyBeg, keyEnd, prefix, func(key string, value []byte) error {
+		matched := filter.Match(value)
+		if scanned > 0 {
+			if matched && len(kvs) > 0 && maxBytes > 0 && total+len(value) > maxBytes {
+				truncated = TruncatedByteLimit
+			} else if !deadline.IsZero() && time.Now().After(deadline) {
+				truncated = TruncatedTimeLimit
+			}
+			if truncated != "" {
+				next = key
+				return errBudgetReached
+			}
+		}
+		scanned++
+		if !matched {
+			return nil
+		}
+		total += len(value)
+		kvs = append(kvs, &KeyValue{Key: key, Value: value})
+		return nil
+	})
+	if err == errBudgetReached {
+		err = nil
+	}
+	return
+}
+
+// DeleteKeysInRangeIf deletes keys in the range [keyBeg, keyEnd] whose values satisfy the given
+// predicate and returns the matched keys.  Since each value must be read, this is more expensive
+// than a blind range delete.  If dryRun is true, nothing is deleted.
+func (d *Data) DeleteKeysInRangeIf(ctx storage.Context, keyBeg, keyEnd string, pred func(key string, value []byte) bool, dryRun bool) ([]string, error) {
+	first, err := NewTKey(keyBeg)
+	if err != nil {
+		return nil, err
+	}
+	last, err := NewTKey(keyEnd)
+	if err != nil {
+		return nil, err
+	}
+	return d.deleteKeysIf(ctx, first, last, pred, dryRun)
+}
+
+// DeleteKeysWithPrefix deletes all keys beginning with the given non-empty prefix and
+// returns the deleted keys.  If dryRun is true, nothing is deleted.
+func (d *Data) DeleteKeysWithPrefix(ctx storage.Context, prefix string, dryRun bool) ([]string, error) {
+	if prefix == "" {
+		return nil, fmt.Errorf("prefix delete requires a non-empty prefix")
+	}
+	first, last := storage.PrefixRange(keyStandard, []byte(prefix))
+	matchAll := func(key string, value []byte) bool { return true }
+	return d.deleteKeysIf(ctx, first, last, matchAll, dryRun)
+}
+
+// deleteKeysIf deletes keys in the type-specific key range [first, last] whose values
+// satisfy the given predicate and returns the matched keys.
+func (d *Data) deleteKeysIf(ctx storage.Context, first, last storage.TKey, pred func(key string, value []byte) bool, dryRun bool) ([]string, error) {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	d.indexMu.RLock()
+	defer d.indexMu.RUnlock()
+	// chunked holds the manifests of matched values stored in chunks, and indexed holds
+	// the indexed field values of matched values.
+	chunked := make(map[string][]byte)
+	indexed := make(map[string]indexEntry)
+	valuePred := func(kv *storage.TKeyValue) (bool, error) {
+		keyStr, err := DecodeTKey(kv.K)
+		if err != nil {
+			return false, err
+		}
+		data, err := d.resolveValue(ctx, db, keyStr, kv.V)
+		if err != nil {
+			return false, err
+		}
+		value, err := d.decodeValue(data)
+		if err != nil {
+			return false, fmt.Errorf("unable to deserialize data for key %q: %v", keyStr, err)
+		}
+		matched := pred(keyStr, value)
+		if _, isChunked := decodeChunkManifest(kv.V); matched && isChunked {
+			chunked[keyStr] = kv.V
+		}
+		if matched && d.IndexField != "" {
+			indexed[keyStr] = d.valueIndexEntry(value)
+		}
+		return matched, nil
+	}
+	if d.MaxKeys != 0 && !dryRun {
+		d.keyCountMu.Lock()
+		defer d.keyCountMu.Unlock()
+	}
+	if !dryRun {
+		defer d.ClearCache()
+	}
+	// removeKeys updates the key count for the given number of deleted keys, noting any
+	// error in that along with an earlier error of the delete.
+	removeKeys := func(n int, deleteErr error) error {
+		if d.MaxKeys == 0 || dryRun || n == 0 {
+			return deleteErr
+		}
+		err := datastore.RemoveKeys(d, uint64(n))
+		switch {
+		case err == nil:
+			return deleteErr
+		case deleteErr == nil:
+			return err
+		default:
+			return fmt.Errorf("%v (also unable to update key count: %v)", deleteErr, err)
+		}
+	}
+	// soft-deleted keys need their values moved to tombstones, so delete individually.
+	matched, err := storage.DeleteRangeIf(ctx, db, first, last, valuePred, dryRun || d.SoftDelete)
+	if err != nil {
+		// keys deleted before the failure are gone, so the count must reflect them.
+		return nil, removeKeys(len(matched), err)
+	}
+	if !d.SoftDelete {
+		if err = removeKeys(len(matched), nil); err != nil {
+			return nil, err
+		}
+	}
+	if len(chunked) != 0 && !dryRun && !d.SoftDelete {
+		if err = d.deleteAllChunks(ctx, db, chunked); err != nil {
+			return nil, err
+		}
+	}
+	// softDeleted counts keys moved to tombstones, whose removal from the key count is
+	// noted even if a later step fails.
+	var softDeleted int
+	keyList := make([]string, len(matched))
+	for i, tk := range matched {
+		if keyList[i], err = DecodeTKey(tk); err != nil {
+			return nil, removeKeys(softDeleted, err)
+		}
+		if d.SoftDelete && !dryRun {
+			if err = d.softDelete(ctx, db, keyList[i], tk); err != nil {
+				return nil, removeKeys(softDeleted, err)
+			}
+			softDeleted++
+		}
+		if d.TrackModified && !dryRun {
+			if err = d.deleteModified(ctx, db, keyList[i]); err != nil {
+				return nil, removeKeys(softDeleted, err)
+			}
+		}
+		if d.AccessInterval > 0 && !dryRun {
+			if err = d.deleteAccessed(ctx, db, keyList[i]); err != nil {
+				return nil, removeKeys(softDeleted, err)
+			}
+		}
+		if !dryRun {
+			if err = d.deleteKeyMetadata(ctx, db, keyList[i]); err != nil {
+				return nil, removeKeys(softDeleted, err)
+			}
+		}
+		if entry, found := indexed[keyList[i]]; found && !dryRun {
+			if err = d.updateIndex(ctx, db, keyList[i], entry, nil); err != nil {
+				return nil, removeKeys(softDeleted, err)
+			}
+		}
+	}
+	if err = removeKeys(softDeleted, nil); err != nil {
+		return nil, err
+	}
+	return keyList, nil
+}
+
+// GetData gets a value using a key
+func (d *Data) GetData(ctx storage.Context, keyStr string) ([]byte, bool, error) {
+	return d.getData(ctx, keyStr, nil)
+}
+
+// AncestorCtx returns a context for reading as of the version given by a UUID string,
+// which must be the version of the given context or one of its ancestors.
+func (d *Data) AncestorCtx(ctx *datastore.VersionedCtx, uuidStr string) (*datastore.VersionedCtx, error) {
+	uuid, v, err := datastore.MatchingUUID(uuidStr)
+	if err != nil {
+		return nil, fmt.Errorf("bad version %q: %v", uuidStr, err)
+	}
+	ancestors, err := datastore.GetAncestorVersions(ctx.VersionID())
+	if err != nil {
+		return nil, err
+	}
+	if !ancestors[v] {
+		return nil, fmt.Errorf("version %s is not an ancestor of the requested node", uuid)
+	}
+	return datastore.NewVersionedCtx(d, v), nil
+}
+
+// getData gets a value using a key, marking the storage and deserialization phases on
+// the given timing, which can be nil.
+func (d *Data) getData(ctx storage.Context, keyStr string, timing *server.ServerTiming) ([]byte, bool, error) {
+	value, _, found, err := d.getDataAs(ctx, keyStr, timing)
+	return value, found, err
+}
+
+// getDataAs gets a value using a key as getData, also returning its encoding if the value
+// was stored as sent.
+func (d *Data) getDataAs(ctx storage.Context, keyStr string, timing *server.ServerTiming) ([]byte, *RawEncoding, bool, error) {
+	value, raw, found, err := d.readDataAs(ctx, keyStr, timing)
+	if found {
+		d.recordAccess(ctx, keyStr)
+	}
+	return value, raw, found, err
+}
+
+// readDataAs gets a value and, if stored as sent, its encoding without recording an access.
+func (d *Data) readDataAs(ctx storage.Context, keyStr string, timing *server.ServerTiming) ([]byte, *RawEncoding, bool, error) {
+	if value, found := d.bufferedValue(ctx, keyStr); found {
+		return value, nil, true, nil
+	}
+	cache := d.getCache()
+	var cacheGen uint64
+	if cache != nil {
+		var value []byte
+		var raw *RawEncoding
+		var found bool
+		if value, raw, found, cacheGen = cache.get(d.cacheKey(ctx, keyStr)); found {
+			return value, raw, true, nil
+		}
+	}
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	tk, err := NewTKey(keyStr)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	data, err := db.Get(ctx, tk)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("Error in retrieving key '%s': %v", keyStr, err)
+	}
+	if data == nil {
+		return nil, nil, false, nil
+	}
+	if data, err = d.resolveValue(ctx, db, keyStr, data); err != nil {
+		return nil, nil, false, fmt.Errorf("Error in resolving key '%s': %v", keyStr, err)
+	}
+	timing.Mark("storage")
+	value, raw, err := d.decodeValueAs(data)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("Unable to deserialize data for key '%s': %v\n", keyStr, err)
+	}
+	timing.Mark("deserialize")
+	if cache != nil {
+		cache.add(d.cacheKey(ctx, keyStr), value, raw, cacheGen)
+	}
+	return value, raw, true, nil
+}
+
+// KeyExplanation describes which version supplied a key's value in a versioned read.
+type KeyExplanation struct {
+	Key       string
+	Found     bool           // true if some ancestor version has a value or deletion of the key
+	Deleted   bool           // true if the supplying version deleted the key
+	UUID      dvid.UUID      `json:",omitempty"`
+	VersionID dvid.VersionID // local ID of the supplying version if found
+}
+
+// ExplainKey returns the version whose value or deletion of a key was chosen when
+// resolving the key through the version DAG for the context's version.
+func (d *Data) ExplainKey(ctx *datastore.VersionedCtx, keyStr string) (*KeyExplanation, error) {
+	d.flushWrites()
+	if !ctx.Versioned() {
+		return nil, fmt.Errorf("keyvalue %q is unversioned so keys are not resolved through versions", d.DataName())
+	}
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	tk, err := NewTKey(keyStr)
+	if err != nil {
+		return nil, err
+	}
+	kv, v, found, err := ctx.ResolveTKey(db, tk)
+	if err != nil {
+		return nil, fmt.Errorf("Error in resolving versions of key %q: %v", keyStr, err)
+	}
+	explanation := &KeyExplanation{Key: keyStr, Found: found}
+	if found {
+		explanation.Deleted = kv.K.IsTombstone()
+		explanation.VersionID = v
+		if explanation.UUID, err = datastore.UUIDFromVersion(v); err != nil {
+			return nil, err
+		}
+	}
+	return explanation, nil
+}
+
+// PutData puts a key-value at a given uuid.  If the instance coalesces writes, the value
+// is buffered and written on the next flush.
+func (d *Data) PutData(ctx storage.Context, keyStr string, value []byte) error {
+	return d.putData(ctx, keyStr, value, nil)
+}
+
+// putData puts a key-value, marking the serialization and storage phases on the given
+// timing, which can be nil.
+func (d *Data) putData(ctx storage.Context, keyStr string, value []byte, timing *server.ServerTiming) error {
+	if d.coalesceInterval() > 0 {
+		// validate before buffering since errors at flush can only be logged.
+		if err := d.ValidateValue(value); err != nil {
+			return err
+		}
+		if d.bufferWrite(ctx, keyStr, value) {
+			timing.Mark("buffer")
+			return nil
+		}
+	}
+	return d.writeData(ctx, keyStr, value, nil, nil, timing)
+}
+
+// writeData puts a key-value directly to the store, marking phases on the given timing,
+// which can be nil.  If raw is non-nil, the value is stored as sent with that encoding,
+// and if compress is non-nil, it overrides the instance's compression.
+func (d *Data) writeData(ctx storage.Context, keyStr string, value []byte, raw *RawEncoding, compress *dvid.Compression, timing *server.ServerTiming) error {
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	serialization, err := d.encodeValueAs(value, raw, compress)
+	if err != nil {
+		return err
+	}
+	timing.Mark("serialize")
+	return d.storeSerialization(ctx, db, keyStr, value, serialization, timing)
+}
+
+// storeSerialization puts the serialization of a key's value, which is needed for any
+// index, marking the storage phase on the given timing, which can be nil.
+func (d *Data) storeSerialization(ctx storage.Context, db storage.OrderedKeyValueDB, keyStr string, value, serialization []byte, timing *server.ServerTiming) error {
+	d.indexMu.RLock()
+	defer d.indexMu.RUnlock()
+	err := d.putSerialization(ctx, db, keyStr, value, serialization)
+	timing.Mark("storage")
+	return err
+}
+
+// putSerialization puts the serialization of a key's value as storeSerialization.  The
+// caller must hold indexMu.
+func (d *Data) putSerialization(ctx storage.Context, db storage.OrderedKeyValueDB, keyStr string, value, serialization []byte) error {
+	tk, err := NewTKey(keyStr)
+	if err != nil {
+		return err
+	}
+	var oldEntry indexEntry
+	if d.IndexField != "" {
+		if oldEntry, err = d.storedIndexEntry(ctx, db, keyStr, tk); err != nil {
+			return err
+		}
+	}
+	defer d.uncache(ctx, keyStr)
+	err = d.withKeyLimit(ctx, db, map[string]bool{keyStr: true}, func() error {
+		if d.ChunkSize > 0 {
+			return d.putChunked(ctx, db, keyStr, tk, serialization)
+		}
+		if d.TrackModified {
+			return d.putWithModified(ctx, db, keyStr, tk, serialization)
+		}
+		return db.Put(ctx, tk, serialization)
+	})
+	if err == nil && d.IndexField != "" {
+		err = d.updateIndex(ctx, db, keyStr, oldEntry, value)
+	}
+	return err
+}
+
+// DeleteData deletes a key-value pair.  If the instance uses soft-delete, the value is
+// moved to a tombstone that can be recovered via UndeleteData.
+func (d *Data) DeleteData(ctx storage.Context, keyStr string) error {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	tk, err := NewTKey(keyStr)
+	if err != nil {
+		return err
+	}
+	defer d.uncache(ctx, keyStr)
+	d.indexMu.RLock()
+	defer d.indexMu.RUnlock()
+	return d.deleteData(ctx, db, keyStr, tk)
+}
+
+// deleteData deletes a key-value pair and its index and last-modified entries.  The caller
+// must hold indexMu.
+func (d *Data) deleteData(ctx storage.Context, db storage.OrderedKeyValueDB, keyStr string, tk storage.TKey) error {
+	if d.IndexField != "" {
+		oldEntry, err := d.storedIndexEntry(ctx, db, keyStr, tk)
+		if err != nil {
+			return err
+		}
+		if err = d.updateIndex(ctx, db, keyStr, oldEntry, nil); err != nil {
+			return err
+		}
+	}
+	return d.withKeyLimit(ctx, db, map[string]bool{keyStr: false}, func() error {
+		if d.TrackModified {
+			if err := d.deleteModified(ctx, db, keyStr); err != nil {
+				return err
+			}
+		}
+		if d.AccessInterval > 0 {
+			if err := d.deleteAccessed(ctx, db, keyStr); err != nil {
+				return err
+			}
+		}
+		if err := d.deleteKeyMetadata(ctx, db, keyStr); err != nil {
+			return err
+		}
+		if d.SoftDelete {
+			return d.softDelete(ctx, db, keyStr, tk)
+		}
+		if d.ChunkSize > 0 {
+			return d.deleteChunked(ctx, db, keyStr, tk)
+		}
+		return db.Delete(ctx, tk)
+	})
+}
+
+// put handles a PUT command-line request.
+func (d *Data) put(cmd datastore.Request, reply *datastore.Response) error {
+	if len(cmd.Command) < 5 {
+		return fmt.Errorf("The key name must be specified after 'put'")
+	}
+	if len(cmd.Input) == 0 {
+		return fmt.Errorf("No data was passed into standard input")
+	}
+	var uuidStr, dataName, cmdStr, keyStr string
+	cmd.CommandArgs(1, &uuidStr, &dataName, &cmdStr, &keyStr)
+
+	_, versionID, err := datastore.MatchingUUID(uuidStr)
+	if err != nil {
+		return err
+	}
+
+	// Store data
+	if !d.Versioned() {
+		// Map everything to root version.
+		versionID, err = datastore.GetRepoRootVersion(versionID)
+		if err != nil {
+			return err
+		}
+	}
+	ctx := datastore.NewVersionedCtx(d, versionID)
+	if err = d.PutData(ctx, keyStr, cmd.Input); err != nil {
+		return fmt.Errorf("Error on put to key %q for keyvalue %q: %v\n", keyStr, d.DataName(), err)
+	}
+
+	reply.Output = []byte(fmt.Sprintf("Put %d bytes into key %q for keyvalue %q, uuid %s\n",
+		len(cmd.Input), keyStr, d.DataName(), uuidStr))
+	return nil
+}
+
+// versionBytes handles a "version-bytes" command-line request.
+func (d *Data) versionBytes(cmd datastore.Request, reply *datastore.Response) error {
+	var uuidStr, dataName, cmdStr string
+	cmd.CommandArgs(1, &uuidStr, &dataName, &cmdStr)
+
+	_, versionID, err := datastore.MatchingUUID(uuidStr)
+	if err != nil {
+		return err
+	}
+	report, err := d.GetVersionBytes(versionID)
+	if err != nil {
+		return fmt.Errorf("Error getting version bytes of keyvalue %q: %v", d.DataName(), err)
+	}
+	jsonBytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	reply.Output = append(jsonBytes, '\n')
+	return nil
+}
+
+// verifyKeys handles a "verify-keys" command-line request.
+func (d *Data) verifyKeys(cmd datastore.Request, reply *datastore.Response) error {
+	report, err := d.VerifyKeys()
+	if err != nil {
+		return fmt.Errorf("Error verifying keys of keyvalue %q: %v", d.DataName(), err)
+	}
+	jsonBytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	reply.Output = append(jsonBytes, '\n')
+	return nil
+}
+
+// JSONString returns the JSON for this Data's configuration
+func (d *Data) JSONString() (jsonStr string, err error) {
+	m, err := json.Marshal(d)
+	if err != nil {
+		return "", err
+	}
+	return string(m), nil
+}
+
+// --- DataService interface ---
+
+func (d *Data) Help() string {
+	return fmt.Sprintf(helpMessage)
+}
+
+// DoRPC acts as a switchboard for RPC commands.
+func (d *Data) DoRPC(request datastore.Request, reply *datastore.Response) error {
+	switch request.TypeCommand() {
+	case "put":
+		return d.put(request, reply)
+	case "version-bytes":
+		return d.versionBytes(request, reply)
+	case "verify-keys":
+		return d.verifyKeys(request, reply)
+	default:
+		return fmt.Errorf("Unknown command.  Data '%s' [%s] does not support '%s' command.",
+			d.DataName(), d.TypeName(), request.TypeCommand())
+	}
+}
+
+// ServeHTTP handles all incoming HTTP requests for this data.
+func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) {
+	timedLog := dvid.NewTimeLog()
+
+	// Break URL request into arguments
+	url := r.URL.Path[len(server.WebAPIPath):]
+	parts := strings.Split(url, "/")
+	if len(parts[len(parts)-1]) == 0 {
+		parts = parts[:len(parts)-1]
+	}
+
+	if len(parts) < 4 {
+		server.BadRequest(w, r, "incomplete API specification")
+		return
+	}
+
+	w, logActivity := d.startActivity(uuid, w, r, parts[3])
+	defer logActivity()
+	audit := d.newAuditor(uuid, r)
+
+	var comment string
+	action := strings.ToLower(r.Method)
+
+	switch parts[3] {
+	case "help":
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintln(w, d.Help())
+		return
+
+	case "info":
+		jsonStr, err := d.JSONString()
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, string(jsonBytes))
+		fmt.Fprintf(w, jsonStr)
+		return
+
+	case "keys":
+		if len(parts) > 4 && parts[4] == "swap" {
+			if action != "post" {
+				server.BadRequest(w, r, "keys/swap endpoint only supports POST")
+				return
+			}
+			release := d.acquireWrite(w)
+			if release == nil {
+				return
+			}
+			defer release()
+			query := r.URL.Query()
+			keyA, keyB := query.Get("a"), query.Get("b")
+			if keyA == "" || keyB == "" {
+				server.BadRequest(w, r, "keys/swap requires keys in the \"a\" and \"b\" query strings")
+				return
+			}
+			var missingAsEmpty bool
+			switch query.Get("missing") {
+			case "", "error":
+			case "empty":
+				missingAsEmpty = true
+			default:
+				server.BadRequest(w, r, "keys/swap \"missing\" must be \"error\" or \"empty\", got %q", query.Get("missing"))
+				return
+			}
+			if err := d.SwapData(ctx, keyA, keyB, missingAsEmpty); err != nil {
+				badWrite(w, r, err, "POST /keys/swap on data %q: %v", d.DataName(), err)
+				return
+			}
+			comment = fmt.Sprintf("HTTP POST keys/swap of %q and %q on data %q", keyA, keyB, d.DataName())
+			break
+		}
+		if len(parts) > 4 && parts[4] == "rename" {
+			if action != "post" {
+				server.BadRequest(w, r, "keys/rename endpoint only supports POST")
+				return
+			}
+			release := d.acquireWrite(w)
+			if release == nil {
+				return
+			}
+			defer release()
+			query := r.URL.Query()
+			from, to := query.Get("from"), query.Get("to")
+			conflict := query.Get("conflict")
+			if conflict == "" {
+				conflict = RenameConflictError
+			}
+			dryRun := query.Get("dryrun") == "true"
+			result, err := d.RenameKeysWithPrefix(ctx, from, to, conflict, dryRun)
+			if err != nil {
+				badWrite(w, r, err, "POST /keys/rename on data %q: %v", d.DataName(), err)
+				return
+			}
+			if !dryRun {
+				for _, rename := range result.Renames {
+					audit.delete(rename.From)
+					audit.put(rename.To, rename.bytes)
+				}
+				result.Renames = nil
+			}
+			jsonBytes, err := json.Marshal(result)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, string(jsonBytes))
+			comment = fmt.Sprintf("HTTP POST keys/rename %q to %q (conflict %s, dryrun %t): %d renamed, %d skipped",
+				from, to, conflict, dryRun, result.Renamed, result.Skipped)
+			break
+		}
+		if len(parts) > 5 && parts[4] == "prefix" {
+			if action != "delete" {
+				server.BadRequest(w, r, "keys/prefix endpoint only supports DELETE")
+				return
+			}
+			release := d.acquireWrite(w)
+			if release == nil {
+				return
+			}
+			defer release()
+			// use the unsplit URL so a trailing "/" is kept in the prefix.
+			prefix := strings.SplitN(url, "/", 6)[5]
+			dryRun := r.URL.Query().Get("dryrun") == "true"
+			keyList, err := d.DeleteKeysWithPrefix(ctx, prefix, dryRun)
+			if err != nil {
+				server.BadRequest(w, r, "DELETE /keys/prefix on data %q: %v", d.DataName(), err)
+				return
+			}
+			result := PrefixDeleteResult{Count: len(keyList), DryRun: dryRun}
+			if dryRun {
+				result.Keys = keyList
+			} else {
+				for _, key := range keyList {
+					audit.delete(key)
+				}
+			}
+			jsonBytes, err := json.Marshal(result)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, string(jsonBytes))
+			comment = fmt.Sprintf("HTTP DELETE keys/prefix %q (dryrun %t): %d keys", prefix, dryRun, len(keyList))
+			break
+		}
+		if len(parts) > 4 && parts[4] == "counts" {
+			if server.ThrottledHTTP(w) {
+				return
+			}
+			defer server.ThrottledOpDone()
+			query := r.URL.Query()
+			counts, err := d.CountKeysByPrefix(ctx, query.Get("begin"), query.Get("end"), query.Get("delimiter"))
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			jsonBytes, err := json.Marshal(counts)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, string(jsonBytes))
+			comment = fmt.Sprintf("HTTP GET keys/counts with delimiter %q: %d keys in %d prefixes",
+				query.Get("delimiter"), counts.Total, len(counts.Prefixes))
+			break
+		}
+		if len(parts) > 4 && parts[4] == "list" {
+			prefix, delimiter := r.URL.Query().Get("prefix"), r.URL.Query().Get("delimiter")
+			listing, err := d.ListKeys(ctx, prefix, delimiter)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			jsonBytes, err := json.Marshal(listing)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, string(jsonBytes))
+			comment = fmt.Sprintf("HTTP GET keys/list with prefix %q and delimiter %q: %d keys, %d common prefixes",
+				prefix, delimiter, len(listing.Keys), len(listing.CommonPrefixes))
+			break
+		}
+		keyList, err := d.listKeys(ctx, storage.MinTKey(keyStandard), storage.MaxTKey(keyStandard), server.MaxListKeys)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		keyList = limitKeyList(w, keyList)
+		if err := writeKeyList(w, r, keyList); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
 		comment = "HTTP GET keys"
 
 	case "keyrange":
@@ -503,54 +2467,646 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			return
 		}
 
-		// Return JSON list of keys
-		keyBeg := parts[4]
-		keyEnd := parts[5]
-		keyList, err := d.GetKeysInRange(ctx, keyBeg, keyEnd)
-		if err != nil {
-			server.BadRequest(w, r, err)
+		keyBeg := parts[4]
+		keyEnd := parts[5]
+		if action == "delete" {
+			release := d.acquireWrite(w)
+			if release == nil {
+				return
+			}
+			defer release()
+			keyList, err := d.handleConditionalDelete(r, ctx, keyBeg, keyEnd)
+			if err != nil {
+				server.BadRequest(w, r, "DELETE /keyrange on data %q: %v", d.DataName(), err)
+				return
+			}
+			if r.URL.Query().Get("dryrun") != "true" {
+				for _, key := range keyList {
+					audit.delete(key)
+				}
+			}
+			jsonBytes, err := json.Marshal(keyList)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, string(jsonBytes))
+			comment = fmt.Sprintf("HTTP DELETE keyrange [%q, %q]: %d keys matched (%s)", keyBeg, keyEnd, len(keyList), url)
+			break
+		}
+
+		// Return list of keys, or every step-th key if sampling
+		var keyList []string
+		var err error
+		stepStr := r.URL.Query().Get("step")
+		if stepStr != "" {
+			step, convErr := strconv.Atoi(stepStr)
+			if convErr != nil || step < 1 {
+				server.BadRequest(w, r, "keyrange step must be a positive integer, got %q", stepStr)
+				return
+			}
+			keyList, err = d.sampleKeysInRange(ctx, keyBeg, keyEnd, step, server.MaxListKeys)
+		} else {
+			keyList, err = d.getKeysInRange(ctx, keyBeg, keyEnd, server.MaxListKeys)
+		}
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		keyList = limitKeyList(w, keyList)
+		if err := writeKeyList(w, r, keyList); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if stepStr != "" {
+			comment = fmt.Sprintf("HTTP GET keyrange [%q, %q] sampled every %s keys", keyBeg, keyEnd, stepStr)
+		} else {
+			comment = fmt.Sprintf("HTTP GET keyrange [%q, %q]", keyBeg, keyEnd)
+		}
+
+	case "index":
+		if len(parts) < 6 {
+			server.BadRequest(w, r, "expect field and value to follow 'index' endpoint")
+			return
+		}
+		if action != "get" {
+			server.BadRequest(w, r, "index endpoint only supports GET")
+			return
+		}
+		field, fieldValue := parts[4], parts[5]
+		keyList, err := d.GetIndexedKeys(ctx, field, fieldValue)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if err := writeKeyList(w, r, keyList); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		comment = fmt.Sprintf("HTTP GET index %q = %q: %d keys", field, fieldValue, len(keyList))
+
+	case "coldkeys":
+		if action != "get" {
+			server.BadRequest(w, r, "coldkeys endpoint only supports GET")
+			return
+		}
+		if d.AccessInterval <= 0 {
+			server.BadRequest(w, r, "keyvalue %q does not track accesses; set AccessInterval", d.DataName())
+			return
+		}
+		before := time.Now()
+		if ageStr := r.URL.Query().Get("age"); ageStr != "" {
+			age, err := time.ParseDuration(ageStr)
+			if err != nil {
+				server.BadRequest(w, r, "bad age %q: %v", ageStr, err)
+				return
+			}
+			before = before.Add(-age)
+		}
+		cold, err := d.GetColdKeys(ctx, before)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		jsonBytes, err := json.Marshal(cold)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, string(jsonBytes))
+		comment = fmt.Sprintf("HTTP GET coldkeys of keyvalue %q: %d keys", d.DataName(), len(cold))
+
+	case "dictionary":
+		switch action {
+		case "get":
+			jsonBytes, err := json.Marshal(d.GetCompressionDicts())
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, string(jsonBytes))
+			comment = fmt.Sprintf("HTTP GET dictionaries of keyvalue %q", d.DataName())
+		case "post":
+			opts := DictTrainingOptions{
+				Size:         DefaultCompressionDictSize,
+				Samples:      DefaultDictSamples,
+				MaxValueSize: DefaultDictMaxValueSize,
+			}
+			queryStrings := r.URL.Query()
+			for name, setting := range map[string]*int{"size": &opts.Size, "samples": &opts.Samples, "maxvaluesize": &opts.MaxValueSize} {
+				if str := queryStrings.Get(name); str != "" {
+					var err error
+					if *setting, err = strconv.Atoi(str); err != nil {
+						server.BadRequest(w, r, "bad %s query string %q", name, str)
+						return
+					}
+				}
+			}
+			if server.ThrottledHTTP(w) {
+				return
+			}
+			defer server.ThrottledOpDone()
+			info, err := d.TrainCompressionDict(ctx, opts)
+			if err != nil {
+				badWrite(w, r, err, err)
+				return
+			}
+			jsonBytes, err := json.Marshal(info)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, string(jsonBytes))
+			comment = fmt.Sprintf("HTTP POST trained dictionary %d of %d bytes from %d values of keyvalue %q", info.ID, info.Size, info.Samples, d.DataName())
+		case "delete":
+			if err := d.StopCompressionDict(ctx); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			comment = fmt.Sprintf("HTTP DELETE current dictionary of keyvalue %q", d.DataName())
+		default:
+			server.BadRequest(w, r, "dictionary endpoint only supports GET, POST, and DELETE")
+			return
+		}
+
+	case "sizes":
+		if action != "get" {
+			server.BadRequest(w, r, "sizes endpoint only supports GET")
+			return
+		}
+		if server.ThrottledHTTP(w) {
+			return
+		}
+		defer server.ThrottledOpDone()
+		hist, err := d.GetSizeHistogram(ctx)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if r.URL.Query().Get("format") == "prometheus" {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			if err := hist.WritePrometheus(w, "dvid_keyvalue_value_size_bytes", string(d.DataName())); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+		} else {
+			jsonBytes, err := json.Marshal(hist)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, string(jsonBytes))
+		}
+		comment = fmt.Sprintf("HTTP GET sizes of keyvalue %q: %d values, %d bytes", d.DataName(), hist.Count, hist.Sum)
+
+	case "audit":
+		if action != "get" {
+			server.BadRequest(w, r, "audit endpoint only supports GET")
+			return
+		}
+		query := r.URL.Query()
+		q := AuditQuery{Key: query.Get("key")}
+		var err error
+		if sinceStr := query.Get("since"); sinceStr != "" {
+			if q.Since, err = time.Parse(time.RFC3339, sinceStr); err != nil {
+				server.BadRequest(w, r, "bad since time %q: %v", sinceStr, err)
+				return
+			}
+		}
+		if untilStr := query.Get("until"); untilStr != "" {
+			if q.Until, err = time.Parse(time.RFC3339, untilStr); err != nil {
+				server.BadRequest(w, r, "bad until time %q: %v", untilStr, err)
+				return
+			}
+		}
+		records, err := d.GetAuditRecords(uuid, q)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		jsonBytes, err := json.Marshal(records)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, string(jsonBytes))
+		comment = fmt.Sprintf("HTTP GET audit of keyvalue %q: %d records", d.DataName(), len(records))
+
+	case "duplicates":
+		if action != "get" {
+			server.BadRequest(w, r, "duplicates endpoint only supports GET")
+			return
+		}
+		maxGroups := DefaultDuplicateGroups
+		if groupsStr := r.URL.Query().Get("groups"); groupsStr != "" {
+			var err error
+			if maxGroups, err = strconv.Atoi(groupsStr); err != nil || maxGroups < 0 {
+				server.BadRequest(w, r, "bad groups query string %q", groupsStr)
+				return
+			}
+		}
+		if server.ThrottledHTTP(w) {
+			return
+		}
+		defer server.ThrottledOpDone()
+		report, err := d.GetDuplicates(ctx, maxGroups)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		jsonBytes, err := json.Marshal(report)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, string(jsonBytes))
+		comment = fmt.Sprintf("HTTP GET duplicates of keyvalue %q: %d groups, %d bytes reclaimable", d.DataName(), report.DuplicateGroups, report.ReclaimableBytes)
+
+	case "compare":
+		if action != "get" {
+			server.BadRequest(w, r, "compare endpoint only supports GET")
+			return
+		}
+		keyA, keyB, err := d.handleCompare(w, r, ctx, uuid)
+		if err != nil {
+			server.BadRequest(w, r, "GET /compare on data %q: %v", d.DataName(), err)
+			return
+		}
+		comment = fmt.Sprintf("HTTP GET compare of keys %q and %q on keyvalue %q", keyA, keyB, d.DataName())
+
+	case "reindex":
+		switch action {
+		case "get":
+			jsonBytes, err := json.Marshal(d.GetReindexStatus())
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, string(jsonBytes))
+			comment = "HTTP GET reindex status"
+		case "post":
+			after := r.URL.Query().Get("after")
+			if err := d.StartReindex(ctx, after); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{%q: "Started reindex of %s"}`, "result", d.DataName())
+			comment = fmt.Sprintf("HTTP POST reindex after key %q", after)
+		default:
+			server.BadRequest(w, r, "reindex endpoint only supports GET and POST")
+			return
+		}
+
+	case "keyrangevalues":
+		if len(parts) < 6 {
+			server.BadRequest(w, r, "expect beginning and end keys to follow 'keyrangevalues' endpoint")
+			return
+		}
+		keyBeg := parts[4]
+		keyEnd := parts[5]
+		prefix := r.URL.Query().Get("prefix")
+		numKeys, err := d.handleKeyRangeValues(w, r, ctx, keyBeg, keyEnd, prefix)
+		if err != nil {
+			server.BadRequest(w, r, "GET /keyrangevalues on data %q: %v", d.DataName(), err)
+			return
+		}
+		comment = fmt.Sprintf("HTTP GET keyrangevalues [%q, %q] with prefix %q: %d keys, data %q", keyBeg, keyEnd, prefix, numKeys, d.DataName())
+
+	case "keyvalues":
+		if len(parts) > 4 && parts[4] == "exists" {
+			if action != "post" {
+				server.BadRequest(w, r, "keyvalues/exists endpoint only supports POST")
+				return
+			}
+			numKeys, err := d.handleKeysExist(w, r, ctx)
+			if err != nil {
+				server.BadRequest(w, r, "POST /keyvalues/exists on %d keys, data %q: %v", numKeys, d.DataName(), err)
+				return
+			}
+			comment = fmt.Sprintf("HTTP POST keyvalues/exists on %d keys, data %q", numKeys, d.DataName())
+			break
+		}
+		if len(parts) > 4 && parts[4] == "stream" {
+			if action != "post" {
+				server.BadRequest(w, r, "keyvalues/stream endpoint only supports POST")
+				return
+			}
+			numKeys, err := d.handleStreamKeyValues(w, r, ctx)
+			if err != nil {
+				server.BadRequest(w, r, "POST /keyvalues/stream on %d keys, data %q: %v", numKeys, d.DataName(), err)
+				return
+			}
+			comment = fmt.Sprintf("HTTP POST keyvalues/stream on %d keys, data %q", numKeys, d.DataName())
+			break
+		}
+		if len(parts) > 4 && parts[4] == "stat" {
+			if action != "post" {
+				server.BadRequest(w, r, "keyvalues/stat endpoint only supports POST")
+				return
+			}
+			numKeys, err := d.handleStatKeys(w, r, ctx)
+			if err != nil {
+				server.BadRequest(w, r, "POST /keyvalues/stat on %d keys, data %q: %v", numKeys, d.DataName(), err)
+				return
+			}
+			comment = fmt.Sprintf("HTTP POST keyvalues/stat on %d keys, data %q", numKeys, d.DataName())
+			break
+		}
+		switch action {
+		case "get":
+			numKeys, writtenBytes, err := d.handleKeyValues(w, r, uuid, ctx)
+			if err != nil {
+				server.BadRequest(w, r, "GET /keyvalues on %d keys, data %q: %v", numKeys, d.DataName(), err)
+				return
+			}
+			comment = fmt.Sprintf("HTTP GET keyvalues on %d keys, %d bytes, data %q", numKeys, writtenBytes, d.DataName())
+		case "post":
+			release := d.acquireWrite(w)
+			if release == nil {
+				return
+			}
+			defer release()
+			if err := d.handleIngest(r, uuid, ctx, audit); err != nil {
+				badWrite(w, r, err, err)
+				return
+			}
+			comment = fmt.Sprintf("HTTP POST keyvalues on data %q", d.DataName())
+		default:
+			server.BadRequest(w, r, "key endpoint does not support %q HTTP verb", action)
+			return
+		}
+
+	case "export":
+		if len(parts) < 5 || parts[4] != "ndjson" {
+			server.BadRequest(w, r, "expect format 'ndjson' to follow 'export' endpoint")
+			return
+		}
+		if action != "get" {
+			server.BadRequest(w, r, "export endpoint only supports GET")
+			return
+		}
+		numKeys, err := d.handleExportNDJSON(w, r, ctx)
+		if err != nil {
+			server.BadRequest(w, r, "GET /export/ndjson on data %q: %v", d.DataName(), err)
+			return
+		}
+		comment = fmt.Sprintf("HTTP GET export/ndjson on data %q: %d keys", d.DataName(), numKeys)
+
+	case "merge":
+		if action != "post" {
+			server.BadRequest(w, r, "merge endpoint only supports POST")
+			return
+		}
+		release := d.acquireWrite(w)
+		if release == nil {
+			return
+		}
+		defer release()
+		result, err := d.handleMerge(w, r, uuid)
+		if err != nil {
+			badWrite(w, r, err, "POST /merge on data %q: %v", d.DataName(), err)
+			return
+		}
+		comment = fmt.Sprintf("HTTP POST merge on data %q: %d keys resolved, %d conflicts", d.DataName(), len(result.Resolved), len(result.Conflicts))
+
+	case "txn":
+		if action != "post" {
+			server.BadRequest(w, r, "txn endpoint only supports POST")
+			return
+		}
+		release := d.acquireWrite(w)
+		if release == nil {
+			return
+		}
+		defer release()
+		var ops []TxnOp
+		if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+			server.BadRequest(w, r, "POST /txn on data %q requires JSON list of operations: %v", d.DataName(), err)
+			return
+		}
+		if err := d.ApplyTransaction(ctx, ops); err != nil {
+			badWrite(w, r, err, "POST /txn on data %q failed: %v", d.DataName(), err)
+			return
+		}
+		keys := make([]string, len(ops))
+		for i, op := range ops {
+			keys[i] = op.Key
+			if op.Op == "delete" {
+				audit.delete(op.Key)
+			} else {
+				audit.put(op.Key, len(op.Value))
+			}
+		}
+		msginfo := map[string]interface{}{
+			"Action":    "txnkv",
+			"Keys":      keys,
+			"UUID":      string(uuid),
+			"Timestamp": time.Now().String(),
+		}
+		jsonmsg, _ := json.Marshal(msginfo)
+		if err := d.ProduceKafkaMsg(jsonmsg); err != nil {
+			dvid.Errorf("Error on sending keyvalue txn op to kafka: %v\n", err)
+		}
+		comment = fmt.Sprintf("HTTP POST txn of %d operations on data %q", len(ops), d.DataName())
+
+	case "key":
+		if len(parts) < 5 {
+			server.BadRequest(w, r, "expect key string to follow 'key' endpoint")
+			return
+		}
+		keyStr := parts[4]
+
+		if len(parts) > 5 && parts[5] == "touch" {
+			if action != "post" {
+				server.BadRequest(w, r, "touch endpoint only supports POST")
+				return
+			}
+			release := d.acquireWrite(w)
+			if release == nil {
+				return
+			}
+			defer release()
+			found, err := d.TouchData(ctx, keyStr)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			if !found {
+				http.Error(w, fmt.Sprintf("Key %q not found", keyStr), http.StatusNotFound)
+				return
+			}
+			timedLog.Infof("HTTP POST touch key %q of keyvalue %q (%s)", keyStr, d.DataName(), url)
+			return
+		}
+
+		if len(parts) > 5 && parts[5] == "raw" {
+			switch action {
+			case "get":
+				data, found, err := d.GetSerialization(ctx, keyStr)
+				if err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+				if !found {
+					http.Error(w, fmt.Sprintf("Key %q not found", keyStr), http.StatusNotFound)
+					return
+				}
+				w.Header().Set("Content-Type", "application/octet-stream")
+				if _, err := w.Write(data); err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+				timedLog.Infof("HTTP GET raw serialization of key %q of keyvalue %q: %d bytes (%s)", keyStr, d.DataName(), len(data), url)
+			case "post":
+				release := d.acquireWrite(w)
+				if release == nil {
+					return
+				}
+				defer release()
+				data, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+				if err := d.PutSerialization(ctx, keyStr, data); err != nil {
+					badWrite(w, r, err, err)
+					return
+				}
+				audit.put(keyStr, len(data))
+				timedLog.Infof("HTTP POST raw serialization of key %q of keyvalue %q: %d bytes (%s)", keyStr, d.DataName(), len(data), url)
+			default:
+				server.BadRequest(w, r, "raw key endpoint only supports GET and POST")
+			}
 			return
 		}
-		jsonBytes, err := json.Marshal(keyList)
-		if err != nil {
-			server.BadRequest(w, r, err)
+
+		if len(parts) > 5 && parts[5] == "apply" {
+			if action != "post" {
+				server.BadRequest(w, r, "apply endpoint only supports POST")
+				return
+			}
+			release := d.acquireWrite(w)
+			if release == nil {
+				return
+			}
+			defer release()
+			var ops []ApplyOp
+			if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+				server.BadRequest(w, r, "POST /key/%s/apply requires JSON list of operations: %v", keyStr, err)
+				return
+			}
+			result, err := d.ApplyData(ctx, keyStr, ops)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			audit.put(keyStr, len(result))
+			w.Header().Set("Content-Type", "application/json")
+			if _, err := w.Write(result); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			timedLog.Infof("HTTP POST apply of %d operations to key %q of keyvalue %q (%s)", len(ops), keyStr, d.DataName(), url)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, string(jsonBytes))
-		comment = fmt.Sprintf("HTTP GET keyrange [%q, %q]", keyBeg, keyEnd)
 
-	case "keyvalues":
-		switch action {
-		case "get":
-			numKeys, writtenBytes, err := d.handleKeyValues(w, r, uuid, ctx)
+		if len(parts) > 5 && parts[5] == "meta" {
+			if action != "get" {
+				server.BadRequest(w, r, "meta endpoint only supports GET")
+				return
+			}
+			meta, found, err := d.GetKeyMetadata(ctx, keyStr)
 			if err != nil {
-				server.BadRequest(w, r, "GET /keyvalues on %d keys, data %q: %v", numKeys, d.DataName(), err)
+				server.BadRequest(w, r, err)
 				return
 			}
-			comment = fmt.Sprintf("HTTP GET keyvalues on %d keys, %d bytes, data %q", numKeys, writtenBytes, d.DataName())
-		case "post":
-			if err := d.handleIngest(r, uuid, ctx); err != nil {
+			if !found {
+				http.Error(w, fmt.Sprintf("Key %q not found", keyStr), http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(meta); err != nil {
 				server.BadRequest(w, r, err)
 				return
 			}
-			comment = fmt.Sprintf("HTTP POST keyvalues on data %q", d.DataName())
-		default:
-			server.BadRequest(w, r, "key endpoint does not support %q HTTP verb", action)
+			timedLog.Infof("HTTP GET metadata of key %q of keyvalue %q (%s)", keyStr, d.DataName(), url)
 			return
 		}
 
-	case "key":
-		if len(parts) < 5 {
-			server.BadRequest(w, r, "expect key string to follow 'key' endpoint")
+		if len(parts) > 5 && parts[5] == "undelete" {
+			if action != "post" {
+				server.BadRequest(w, r, "undelete endpoint only supports POST")
+				return
+			}
+			release := d.acquireWrite(w)
+			if release == nil {
+				return
+			}
+			defer release()
+			found, err := d.UndeleteData(ctx, keyStr)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			if !found {
+				http.Error(w, fmt.Sprintf("No recoverable deleted key %q", keyStr), http.StatusNotFound)
+				return
+			}
+			timedLog.Infof("HTTP POST undelete key %q of keyvalue %q (%s)", keyStr, d.DataName(), url)
 			return
 		}
-		keyStr := parts[4]
 
 		switch action {
 		case "get":
+			ctx := ctx
+			if versionStr := r.URL.Query().Get("version"); versionStr != "" {
+				versionCtx, err := d.AncestorCtx(ctx, versionStr)
+				if err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+				ctx = versionCtx
+			}
+			transform := r.URL.Query().Get("transform")
+			if _, found := valueTransforms[transform]; transform != "" && !found {
+				server.BadRequest(w, r, "unsupported transform %q, must be one of %v", transform, ValueTransforms())
+				return
+			}
+			if r.URL.Query().Get("explain") == "true" {
+				explanation, err := d.ExplainKey(ctx, keyStr)
+				if err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				if err := json.NewEncoder(w).Encode(explanation); err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+				comment = fmt.Sprintf("HTTP GET key %q explanation of keyvalue %q (%s)", keyStr, d.DataName(), url)
+				break
+			}
+
 			// Return value of single key
-			value, found, err := d.GetData(ctx, keyStr)
+			timing := server.NewServerTiming()
+			var value []byte
+			var raw *RawEncoding
+			var found bool
+			var err error
+			if tier := r.URL.Query().Get("tier"); tier != "" {
+				value, raw, found, err = d.GetDataFromTier(ctx, keyStr, tier)
+			} else {
+				value, raw, found, err = d.getDataAs(ctx, keyStr, timing)
+			}
 			if err != nil {
 				server.BadRequest(w, r, err)
 				return
@@ -559,6 +3115,51 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 				http.Error(w, fmt.Sprintf("Key %q not found", keyStr), http.StatusNotFound)
 				return
 			}
+			templateKey, templateText := r.URL.Query().Get("template"), r.URL.Query().Get("templatetext")
+			if templateKey != "" || templateText != "" {
+				if err := d.renderValue(w, ctx, value, templateKey, templateText); err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+				comment = fmt.Sprintf("HTTP GET key %q of keyvalue %q rendered as HTML (%s)", keyStr, d.DataName(), url)
+				break
+			}
+			meta, err := d.storedKeyMetadata(ctx, keyStr)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			meta.SetHeader(w.Header())
+			if d.TrackModified {
+				modified, found, err := d.GetModified(ctx, keyStr)
+				if err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+				if found {
+					w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+				}
+			}
+			if transform != "" {
+				timing.SetHeader(w)
+				if err := writeTransformed(w, transform, value); err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+				comment = fmt.Sprintf("HTTP GET key %q of keyvalue %q with %s transform (%s)", keyStr, d.DataName(), transform, url)
+				break
+			}
+			w.Header().Set("ETag", ValueETag(value))
+			if raw != nil {
+				if raw.ContentType != "" {
+					w.Header().Set("Content-Type", raw.ContentType)
+				}
+				if raw.ContentEncoding != "" {
+					w.Header().Set("Content-Encoding", raw.ContentEncoding)
+				}
+			}
+			server.SetPayloadChecksum(w, value)
+			timing.SetHeader(w)
 			if value != nil || len(value) > 0 {
 				_, err = w.Write(value)
 				if err != nil {
@@ -570,38 +3171,138 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			comment = fmt.Sprintf("HTTP GET key %q of keyvalue %q: %d bytes (%s)", keyStr, d.DataName(), len(value), url)
 
 		case "delete":
-			if err := d.DeleteData(ctx, keyStr); err != nil {
+			release := d.acquireWrite(w)
+			if release == nil {
+				return
+			}
+			defer release()
+			cond := Precondition{IfMatch: r.Header.Get("If-Match")}
+			if since := r.Header.Get("If-Unmodified-Since"); since != "" {
+				t, err := http.ParseTime(since)
+				if err != nil {
+					server.BadRequest(w, r, "bad If-Unmodified-Since header %q: %v", since, err)
+					return
+				}
+				cond.IfUnmodifiedSince = t
+			}
+			var err error
+			if cond != (Precondition{}) {
+				err = d.DeleteDataIf(ctx, keyStr, cond)
+			} else {
+				err = d.DeleteData(ctx, keyStr)
+			}
+			if err == ErrPreconditionFailed {
+				http.Error(w, fmt.Sprintf("Key %q: %v", keyStr, err), http.StatusPreconditionFailed)
+				return
+			}
+			if err != nil {
 				server.BadRequest(w, r, err)
 				return
 			}
+			audit.delete(keyStr)
 			comment = fmt.Sprintf("HTTP DELETE data with key %q of keyvalue %q (%s)", keyStr, d.DataName(), url)
 
 		case "post":
+			release := d.acquireWrite(w)
+			if release == nil {
+				return
+			}
+			defer release()
+			timing := server.NewServerTiming()
 			data, err := ioutil.ReadAll(r.Body)
 			if err != nil {
 				server.BadRequest(w, r, err)
 				return
 			}
+			timing.Mark("read")
+			if err := server.VerifyPayloadChecksum(r, data); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			meta, err := MetadataFromHeader(r.Header)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
 
-			go func() {
-				msginfo := map[string]interface{}{
-					"Action":    "postkv",
-					"Key":       keyStr,
-					"Bytes":     len(data),
-					"UUID":      string(uuid),
-					"Timestamp": time.Now().String(),
+			putValue := func() error {
+				levelStr, ifAbsent := r.URL.Query().Get("level"), r.URL.Query().Get("ifabsent") == "true"
+				if d.Passthrough || r.URL.Query().Get("raw") == "true" {
+					if levelStr != "" {
+						return fmt.Errorf("compression level can't be set for values stored as sent")
+					}
+					if ifAbsent {
+						return fmt.Errorf("create-only writes aren't supported for values stored as sent")
+					}
+					raw := RawEncoding{
+						ContentType:     r.Header.Get("Content-Type"),
+						ContentEncoding: r.Header.Get("Content-Encoding"),
+					}
+					return d.PutRawData(ctx, keyStr, data, raw)
 				}
-				jsonmsg, _ := json.Marshal(msginfo)
-				if err = d.ProduceKafkaMsg(jsonmsg); err != nil {
-					dvid.Errorf("Error on sending keyvalue POST op to kafka: %v\n", err)
+				if ifAbsent {
+					if levelStr != "" {
+						return fmt.Errorf("compression level can't be set for create-only writes")
+					}
+					return d.PutDataIfAbsent(ctx, keyStr, data)
 				}
-			}()
-
-			err = d.PutData(ctx, keyStr, data)
-			if err != nil {
-				server.BadRequest(w, r, err)
+				if levelStr != "" {
+					return d.putDataWithLevel(ctx, keyStr, data, levelStr, timing)
+				}
+				return d.putData(ctx, keyStr, data, timing)
+			}
+			// metadata is written only with the value so a replayed write leaves both as is.
+			put := func() error {
+				if err := putValue(); err != nil {
+					return err
+				}
+				return d.PutKeyMetadata(ctx, keyStr, meta)
+			}
+			var replayed bool
+			if idemKey := r.Header.Get(IdempotencyKeyHeader); idemKey != "" {
+				replayed, err = d.PutDataIdempotent(ctx, idemKey, keyStr, data, put)
+				if err == ErrIdempotencyConflict {
+					http.Error(w, fmt.Sprintf("%s %q: %v", IdempotencyKeyHeader, idemKey, err), http.StatusConflict)
+					return
+				}
+				if err == ErrKeyExists {
+					http.Error(w, fmt.Sprintf("Key %q: %v", keyStr, err), http.StatusConflict)
+					return
+				}
+				if err != nil {
+					badWrite(w, r, err, err)
+					return
+				}
+				if replayed {
+					w.Header().Set("Idempotent-Replayed", "true")
+				} else {
+					audit.put(keyStr, len(data))
+				}
+			} else if err := put(); err == ErrKeyExists {
+				http.Error(w, fmt.Sprintf("Key %q: %v", keyStr, err), http.StatusConflict)
+				return
+			} else if err != nil {
+				badWrite(w, r, err, err)
 				return
+			} else {
+				audit.put(keyStr, len(data))
 			}
+			if !replayed {
+				go func() {
+					msginfo := map[string]interface{}{
+						"Action":    "postkv",
+						"Key":       keyStr,
+						"Bytes":     len(data),
+						"UUID":      string(uuid),
+						"Timestamp": time.Now().String(),
+					}
+					jsonmsg, _ := json.Marshal(msginfo)
+					if err := d.ProduceKafkaMsg(jsonmsg); err != nil {
+						dvid.Errorf("Error on sending keyvalue POST op to kafka: %v\n", err)
+					}
+				}()
+			}
+			timing.SetHeader(w)
 			comment = fmt.Sprintf("HTTP POST keyvalue '%s': %d bytes (%s)\n", d.DataName(), len(data), url)
 		default:
 			server.BadRequest(w, r, "key endpoint does not support %q HTTP verb", action)
@@ -616,6 +3317,204 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 	timedLog.Infof(comment)
 }
 
+// limitKeyList cuts a key listing, scanned for at most one more key than the server's
+// MaxListKeys, to that limit.  If keys were cut, the
+// "X-Truncated" and "X-Truncated-Reason" headers are set along with an "X-Next-Key"
+// header giving the path-escaped first key not listed.
+func limitKeyList(w http.ResponseWriter, keyList []string) []string {
+	if server.MaxListKeys <= 0 || len(keyList) <= server.MaxListKeys {
+		return keyList
+	}
+	w.Header().Set("X-Truncated", "true")
+	w.Header().Set("X-Truncated-Reason", TruncatedKeyLimit)
+	w.Header().Set("X-Next-Key", url.PathEscape(keyList[server.MaxListKeys]))
+	return keyList[:server.MaxListKeys]
+}
+
+// writeKeyList writes a list of keys as JSON or, if the request accepts
+// "application/octet-stream", as binary keys each prefixed by its length as a
+// little-endian uint32.
+func writeKeyList(w http.ResponseWriter, r *http.Request, keyList []string) error {
+	if strings.Contains(r.Header.Get("Accept"), "application/octet-stream") {
+		var size int
+		for _, key := range keyList {
+			size += 4 + len(key)
+		}
+		buf := make([]byte, size)
+		var pos int
+		for _, key := range keyList {
+			binary.LittleEndian.PutUint32(buf[pos:pos+4], uint32(len(key)))
+			pos += 4
+			pos += copy(buf[pos:], key)
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, err := w.Write(buf)
+		return err
+	}
+	jsonBytes, err := json.Marshal(keyList)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(jsonBytes)
+	return err
+}
+
+// PrefixDeleteResult is the response of a prefix delete.
+type PrefixDeleteResult struct {
+	Count  int
+	DryRun bool
+	Keys   []string `json:",omitempty"` // only returned for dry runs
+}
+
+// handleConditionalDelete deletes keys in a range whose values match the "match" query string.
+func (d *Data) handleConditionalDelete(r *http.Request, ctx *datastore.VersionedCtx, keyBeg, keyEnd string) ([]string, error) {
+	queryStrings := r.URL.Query()
+	dryRun := queryStrings.Get("dryrun") == "true"
+	var pred func(key string, value []byte) bool
+	switch queryStrings.Get("match") {
+	case "empty":
+		pred = func(key string, value []byte) bool {
+			return len(value) == 0
+		}
+	case "value":
+		target := []byte(queryStrings.Get("value"))
+		pred = func(key string, value []byte) bool {
+			return bytes.Equal(value, target)
+		}
+	case "":
+		return nil, fmt.Errorf("conditional delete requires a \"match\" query string")
+	default:
+		return nil, fmt.Errorf("unknown match condition %q", queryStrings.Get("match"))
+	}
+	return d.DeleteKeysInRangeIf(ctx, keyBeg, keyEnd, pred, dryRun)
+}
+
+func (d *Data) handleKeyRangeValues(w http.ResponseWriter, r *http.Request, ctx *datastore.VersionedCtx, keyBeg, keyEnd, prefix string) (numKeys int, err error) {
+	queryStrings := r.URL.Query()
+	filter, err := parseValueFilter(queryStrings)
+	if err != nil {
+		return 0, err
+	}
+	process := func(f func(key string, value []byte) error) error {
+		return d.ProcessKeyValuesInRange(ctx, keyBeg, keyEnd, prefix, func(key string, value []byte) error {
+			if !filter.Match(value) {
+				return nil
+			}
+			return f(key, value)
+		})
+	}
+	var maxBytes int
+	if maxBytesStr := queryStrings.Get("maxbytes"); maxBytesStr != "" {
+		if maxBytes, err = strconv.Atoi(maxBytesStr); err != nil || maxBytes <= 0 {
+			return 0, fmt.Errorf("bad maxbytes %q: must be a positive integer", maxBytesStr)
+		}
+	}
+	maxDuration := d.MaxScanTime
+	if maxTimeStr := queryStrings.Get("maxtime"); maxTimeStr != "" {
+		maxTime, err := time.ParseDuration(maxTimeStr)
+		if err != nil || maxTime <= 0 {
+			return 0, fmt.Errorf("bad maxtime %q: must be a positive duration, e.g., \"10s\"", maxTimeStr)
+		}
+		if maxDuration == 0 || maxTime < maxDuration {
+			maxDuration = maxTime
+		}
+	}
+	if maxBytes > 0 || maxDuration > 0 {
+		kvs, next, truncated, err := d.GetKeyValuesInRangeWithBudget(ctx, keyBeg, keyEnd, prefix, filter, maxBytes, maxDuration)
+		if err != nil {
+			return 0, err
+		}
+		if truncated != "" {
+			w.Header().Set("X-Truncated", "true")
+			w.Header().Set("X-Truncated-Reason", truncated)
+			w.Header().Set("X-Next-Key", url.PathEscape(next))
+		}
+		process = func(f func(key string, value []byte) error) error {
+			for _, kv := range kvs {
+				if err := f(kv.Key, kv.Value); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	switch {
+	case queryStrings.Get("jsontar") == "true":
+		tw := tar.NewWriter(w)
+		w.Header().Set("Content-type", "application/tar")
+		err = process(func(key string, value []byte) error {
+			hdr := &tar.Header{
+				Name: key,
+				Size: int64(len(value)),
+				Mode: 0755,
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err := tw.Write(value); err != nil {
+				return err
+			}
+			numKeys++
+			return nil
+		})
+		if err != nil {
+			return
+		}
+		err = tw.Close()
+
+	case queryStrings.Get("json") == "true":
+		w.Header().Set("Content-type", "application/json")
+		if _, err = fmt.Fprintf(w, "{"); err != nil {
+			return
+		}
+		err = process(func(key string, value []byte) error {
+			if !json.Valid(value) {
+				return fmt.Errorf("value for key %q is not valid JSON", key)
+			}
+			keyJSON, err := json.Marshal(key)
+			if err != nil {
+				return err
+			}
+			if numKeys > 0 {
+				if _, err := fmt.Fprintf(w, ","); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintf(w, "%s:%s", keyJSON, value); err != nil {
+				return err
+			}
+			numKeys++
+			return nil
+		})
+		if err != nil {
+			return
+		}
+		_, err = fmt.Fprintf(w, "}")
+
+	default: // protobuf3 by default
+		var kvs KeyValues
+		err = process(func(key string, value []byte) error {
+			kvs.Kvs = append(kvs.Kvs, &KeyValue{
+				Key:   key,
+				Value: value,
+			})
+			return nil
+		})
+		if err != nil {
+			return
+		}
+		numKeys = len(kvs.Kvs)
+		var serialization []byte
+		if serialization, err = kvs.Marshal(); err != nil {
+			return
+		}
+		w.Header().Set("Content-type", "application/octet-stream")
+		_, err = w.Write(serialization)
+	}
+	return
+}
+
 func (d *Data) handleKeyValues(w http.ResponseWriter, r *http.Request, uuid dvid.UUID, ctx *datastore.VersionedCtx) (numKeys, writtenBytes int, err error) {
 	jsontar := (r.URL.Query().Get("jsontar") != "")
 	var data []byte
@@ -694,20 +3593,102 @@ func (d *Data) handleKeyValues(w http.ResponseWriter, r *http.Request, uuid dvid
 	return
 }
 
-func (d *Data) handleIngest(r *http.Request, uuid dvid.UUID, ctx *datastore.VersionedCtx) error {
-	data, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		return err
+// badWrite writes an error message for a failed write like server.BadRequest, but with
+// status code 507 if the write would exceed the instance's quota or MaxKeys.
+func badWrite(w http.ResponseWriter, r *http.Request, err error, format interface{}, args ...interface{}) {
+	if errors.Is(err, storage.ErrQuotaExceeded) {
+		server.InsufficientStorage(w, r, format, args...)
+		return
 	}
-	var kvs KeyValues
-	if err := kvs.Unmarshal(data); err != nil {
-		return err
+	server.BadRequest(w, r, format, args...)
+}
+
+// readKeyValues calls f on each KeyValue of a KeyValues serialization read from r, so
+// only one key-value is decoded in memory at a time.  Unknown fields are skipped as in
+// protobuf decoding.
+func readKeyValues(r io.Reader, f func(kv *KeyValue) error) error {
+	br := bufio.NewReader(r)
+	for {
+		tag, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("bad KeyValues serialization: %v", err)
+		}
+		field, wireType := tag>>3, tag&7
+		switch wireType {
+		case 0:
+			if _, err = binary.ReadUvarint(br); err != nil {
+				return fmt.Errorf("bad KeyValues serialization: %v", err)
+			}
+		case 1, 5:
+			size := int64(8)
+			if wireType == 5 {
+				size = 4
+			}
+			if _, err = io.CopyN(ioutil.Discard, br, size); err != nil {
+				return fmt.Errorf("bad KeyValues serialization: %v", err)
+			}
+		case 2:
+			length, err := binary.ReadUvarint(br)
+			if err != nil {
+				return fmt.Errorf("bad KeyValues serialization: %v", err)
+			}
+			if field != 1 {
+				if _, err = io.CopyN(ioutil.Discard, br, int64(length)); err != nil {
+					return fmt.Errorf("bad KeyValues serialization: %v", err)
+				}
+				continue
+			}
+			// read without trusting the length for allocation, since it's from the client.
+			data, err := ioutil.ReadAll(io.LimitReader(br, int64(length)))
+			if err != nil {
+				return err
+			}
+			if uint64(len(data)) != length {
+				return fmt.Errorf("bad KeyValues serialization: %v", io.ErrUnexpectedEOF)
+			}
+			var kv KeyValue
+			if err = kv.Unmarshal(data); err != nil {
+				return fmt.Errorf("bad KeyValue serialization: %v", err)
+			}
+			if err = f(&kv); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("bad KeyValues serialization: unsupported wire type %d", wireType)
+		}
+	}
+}
+
+// handleIngest stores the key-values of a KeyValues serialization in the request body.
+// Key-values are stored as they're read so large imports aren't held in memory, unless
+// the request has a checksum header, in which case the body is verified before storing.
+func (d *Data) handleIngest(r *http.Request, uuid dvid.UUID, ctx *datastore.VersionedCtx, audit *auditor) error {
+	body := io.Reader(r.Body)
+	if r.Header.Get("Content-MD5") != "" || r.Header.Get(server.ChecksumHeader) != "" {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		if err := server.VerifyPayloadChecksum(r, data); err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
 	}
-	for _, kv := range kvs.Kvs {
-		err = d.PutData(ctx, kv.Key, kv.Value)
+	dedup := r.URL.Query().Get("dedup") == "true"
+	return readKeyValues(body, func(kv *KeyValue) error {
+		var err error
+		if dedup {
+			err = d.PutDedupData(ctx, kv.Key, kv.Value)
+		} else {
+			err = d.PutData(ctx, kv.Key, kv.Value)
+		}
 		if err != nil {
 			return err
 		}
+		audit.put(kv.Key, len(kv.Value))
 
 		msginfo := map[string]interface{}{
 			"Action":    "postkv",
@@ -720,6 +3701,6 @@ func (d *Data) handleIngest(r *http.Request, uuid dvid.UUID, ctx *datastore.Vers
 		if err = d.ProduceKafkaMsg(jsonmsg); err != nil {
 			dvid.Errorf("Error on sending keyvalue POST op to kafka: %v\n", err)
 		}
-	}
-	return nil
+		return nil
+	})
 }
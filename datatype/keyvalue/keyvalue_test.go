@@ -3,18 +3,31 @@ package keyvalue
 import (
 	"archive/tar"
 	"bytes"
+	"compress/gzip"
+	"crypto/md5"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/janelia-flyem/dvid/datastore"
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/server"
+	"github.com/janelia-flyem/dvid/storage"
 )
 
 var (
@@ -231,10 +244,4363 @@ func TestKeyvalueRequests(t *testing.T) {
 	testRequest(t, uuid, versionID, "mykeyvalue")
 }
 
+func TestKeyvalueRangeValuesPrefix(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "prefixtest", dvid.Config{})
+
+	values := map[string]string{
+		"a1":      `{"a": 1}`,
+		"mesh_10": `{"mesh": 10}`,
+		"mesh_20": `{"mesh": 20}`,
+		"meshy":   `{"meshy": 1}`,
+		"roi_1":   `{"roi": 1}`,
+		"zebra":   `{"zebra": 1}`,
+	}
+	for key, value := range values {
+		keyreq := fmt.Sprintf("%snode/%s/prefixtest/key/%s", server.WebAPIPath, uuid, key)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader(value))
+	}
+
+	rangereq := fmt.Sprintf("%snode/%s/prefixtest/keyrangevalues/a/z?json=true&prefix=mesh_", server.WebAPIPath, uuid)
+	returnValue := server.TestHTTP(t, "GET", rangereq, nil)
+	var retrieved map[string]interface{}
+	if err := json.Unmarshal(returnValue, &retrieved); err != nil {
+		t.Fatalf("Bad keyrangevalues unmarshal: %v\n%s\n", err, string(returnValue))
+	}
+	if len(retrieved) != 2 {
+		t.Fatalf("Expected 2 mesh_ keys, got %d: %s\n", len(retrieved), string(returnValue))
+	}
+	for _, key := range []string{"mesh_10", "mesh_20"} {
+		if _, found := retrieved[key]; !found {
+			t.Errorf("Expected key %q in keyrangevalues response: %s\n", key, string(returnValue))
+		}
+	}
+
+	// Range narrower than prefix should still restrict results.
+	rangereq = fmt.Sprintf("%snode/%s/prefixtest/keyrangevalues/mesh_15/z?json=true&prefix=mesh", server.WebAPIPath, uuid)
+	returnValue = server.TestHTTP(t, "GET", rangereq, nil)
+	retrieved = nil
+	if err := json.Unmarshal(returnValue, &retrieved); err != nil {
+		t.Fatalf("Bad keyrangevalues unmarshal: %v\n%s\n", err, string(returnValue))
+	}
+	if len(retrieved) != 2 {
+		t.Fatalf("Expected 2 keys (mesh_20, meshy), got %d: %s\n", len(retrieved), string(returnValue))
+	}
+
+	// Default protobuf response
+	rangereq = fmt.Sprintf("%snode/%s/prefixtest/keyrangevalues/a/zz?prefix=roi", server.WebAPIPath, uuid)
+	returnValue = server.TestHTTP(t, "GET", rangereq, nil)
+	var kvs KeyValues
+	if err := kvs.Unmarshal(returnValue); err != nil {
+		t.Fatalf("unable to unmarshal keyrangevalues protobuf: %v\n", err)
+	}
+	if len(kvs.Kvs) != 1 || kvs.Kvs[0].Key != "roi_1" || string(kvs.Kvs[0].Value) != values["roi_1"] {
+		t.Errorf("bad protobuf keyrangevalues response: %v\n", kvs)
+	}
+}
+
+func TestKeyvalueRangeValuesBudget(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "budget", dvid.Config{})
+
+	values := map[string]string{
+		"a": strings.Repeat("a", 10),
+		"b": strings.Repeat("b", 100),
+		"c": strings.Repeat("c", 10),
+		"d": strings.Repeat("d", 10),
+	}
+	for key, value := range values {
+		keyreq := fmt.Sprintf("%snode/%s/budget/key/%s", server.WebAPIPath, uuid, key)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader(value))
+	}
+
+	// Page through the range, always getting at least one key even if over budget.
+	expected := [][]string{{"a"}, {"b"}, {"c", "d"}}
+	keyBeg := "a"
+	for page, keys := range expected {
+		rangereq := fmt.Sprintf("%snode/%s/budget/keyrangevalues/%s/z?maxbytes=25", server.WebAPIPath, uuid, keyBeg)
+		resp := server.TestHTTPResponse(t, "GET", rangereq, nil)
+		var kvs KeyValues
+		if err := kvs.Unmarshal(resp.Body.Bytes()); err != nil {
+			t.Fatalf("unable to unmarshal keyrangevalues protobuf: %v\n", err)
+		}
+		if len(kvs.Kvs) != len(keys) {
+			t.Fatalf("page %d: expected keys %v, got %v\n", page, keys, kvs.Kvs)
+		}
+		for i, key := range keys {
+			if kvs.Kvs[i].Key != key || string(kvs.Kvs[i].Value) != values[key] {
+				t.Errorf("page %d: expected key %q, got %q\n", page, key, kvs.Kvs[i].Key)
+			}
+		}
+		last := page == len(expected)-1
+		if truncated := resp.Header().Get("X-Truncated") == "true"; truncated == last {
+			t.Errorf("page %d: bad truncation marker %q\n", page, resp.Header().Get("X-Truncated"))
+		}
+		keyBeg = resp.Header().Get("X-Next-Key")
+	}
+
+	rangereq := fmt.Sprintf("%snode/%s/budget/keyrangevalues/a/z?maxbytes=0", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", rangereq, nil)
+
+	// a time limit that has passed after the first key still returns that key.
+	rangereq = fmt.Sprintf("%snode/%s/budget/keyrangevalues/a/z?maxtime=1ns", server.WebAPIPath, uuid)
+	resp := server.TestHTTPResponse(t, "GET", rangereq, nil)
+	var kvs KeyValues
+	if err := kvs.Unmarshal(resp.Body.Bytes()); err != nil {
+		t.Fatalf("unable to unmarshal keyrangevalues protobuf: %v\n", err)
+	}
+	if len(kvs.Kvs) != 1 || kvs.Kvs[0].Key != "a" {
+		t.Errorf("expected only first key before time limit, got %v\n", kvs.Kvs)
+	}
+	if reason := resp.Header().Get("X-Truncated-Reason"); reason != TruncatedTimeLimit {
+		t.Errorf("expected truncation reason %q, got %q\n", TruncatedTimeLimit, reason)
+	}
+	if next := resp.Header().Get("X-Next-Key"); next != "b" {
+		t.Errorf("expected next key %q after time limit, got %q\n", "b", next)
+	}
+
+	// the instance's MaxScanTime applies without a query string.
+	config := dvid.NewConfig()
+	config.Set("MaxScanTime", "1ns")
+	server.CreateTestInstance(t, uuid, "keyvalue", "timed", config)
+	for key, value := range values {
+		keyreq := fmt.Sprintf("%snode/%s/timed/key/%s", server.WebAPIPath, uuid, key)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader(value))
+	}
+	rangereq = fmt.Sprintf("%snode/%s/timed/keyrangevalues/a/z", server.WebAPIPath, uuid)
+	resp = server.TestHTTPResponse(t, "GET", rangereq, nil)
+	if reason := resp.Header().Get("X-Truncated-Reason"); reason != TruncatedTimeLimit {
+		t.Errorf("expected MaxScanTime truncation, got reason %q\n", reason)
+	}
+}
+
+func TestKeyvalueClone(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "original", dvid.Config{})
+
+	values := map[string]string{"a": "1", "b": "2", "c": "3"}
+	for key, value := range values {
+		keyreq := fmt.Sprintf("%snode/%s/original/key/%s", server.WebAPIPath, uuid, key)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader(value))
+	}
+	delreq := fmt.Sprintf("%snode/%s/original/key/c", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "DELETE", delreq, nil)
+
+	clonereq := fmt.Sprintf("%srepo/%s/instance/original/clone", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", clonereq, nil)
+	server.TestHTTP(t, "POST", clonereq+"?to=copied", nil)
+	server.TestBadHTTP(t, "POST", clonereq+"?to=copied", nil)
+
+	// The copy is done in the background, so wait for the cloned keys.
+	keysreq := fmt.Sprintf("%snode/%s/copied/keys", server.WebAPIPath, uuid)
+	var keys []string
+	for tries := 0; tries < 50; tries++ {
+		if err := json.Unmarshal(server.TestHTTP(t, "GET", keysreq, nil), &keys); err != nil {
+			t.Fatalf("bad keys response: %v\n", err)
+		}
+		if len(keys) == 2 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Fatalf("expected cloned keys [a b], got %v\n", keys)
+	}
+	for _, key := range keys {
+		keyreq := fmt.Sprintf("%snode/%s/copied/key/%s", server.WebAPIPath, uuid, key)
+		if value := server.TestHTTP(t, "GET", keyreq, nil); string(value) != values[key] {
+			t.Errorf("expected cloned key %q to have value %q, got %q\n", key, values[key], string(value))
+		}
+	}
+}
+
+func TestKeyvalueSwitchStore(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "migrated", dvid.Config{})
+	for i := 0; i < 10; i++ {
+		keyreq := fmt.Sprintf("%snode/%s/migrated/key/key%d", server.WebAPIPath, uuid, i)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader(fmt.Sprintf("value%d", i)))
+	}
+	if err := datastore.Commit(uuid, "first", nil); err != nil {
+		t.Fatalf("commit failed: %v\n", err)
+	}
+	child, err := datastore.NewVersion(uuid, "second", "", nil)
+	if err != nil {
+		t.Fatalf("can't create child version: %v\n", err)
+	}
+	keyreq := fmt.Sprintf("%snode/%s/migrated/key/key3", server.WebAPIPath, child)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("changed"))
+
+	dir, err := ioutil.TempDir("", "dvid-test-migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var c dvid.Config
+	c.SetAll(map[string]interface{}{"path": dir, "testing": true})
+	newStore, _, err := storage.NewStore(dvid.StoreConfig{Config: c, Engine: "basholeveldb"})
+	if err != nil {
+		t.Fatalf("can't create destination store: %v\n", err)
+	}
+	defer newStore.Close()
+
+	if err := datastore.SwitchInstanceStore(uuid, "migrated", newStore, nil); err != nil {
+		t.Fatalf("migration failed: %v\n", err)
+	}
+	d, err := GetByUUIDName(uuid, "migrated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store, err := d.KVStore(); err != nil || store != newStore {
+		t.Fatalf("expected instance switched to new store, got %v (%v)\n", store, err)
+	}
+	if err := datastore.SwitchInstanceStore(uuid, "migrated", newStore, nil); err == nil {
+		t.Errorf("expected error migrating to the store already in use\n")
+	}
+
+	// all versions are readable from the new store, which accepts writes.
+	check := func(version dvid.UUID, key, expected string) {
+		keyreq := fmt.Sprintf("%snode/%s/migrated/key/%s", server.WebAPIPath, version, key)
+		if got := string(server.TestHTTP(t, "GET", keyreq, nil)); got != expected {
+			t.Errorf("expected %q for key %q in version %s, got %q\n", expected, key, version, got)
+		}
+	}
+	check(uuid, "key3", "value3")
+	check(child, "key3", "changed")
+	check(child, "key9", "value9")
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("after migration"))
+	check(child, "key3", "after migration")
+}
+
+func TestKeyvalueExplain(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "explained", dvid.Config{})
+
+	keyreq := fmt.Sprintf("%snode/%s/explained/key/a", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("root value"))
+	if err := datastore.Commit(uuid, "root", nil); err != nil {
+		t.Fatalf("unable to commit root: %v\n", err)
+	}
+	uuid2, err := datastore.NewVersion(uuid, "child", "", nil)
+	if err != nil {
+		t.Fatalf("unable to create child version: %v\n", err)
+	}
+
+	explain := func(u dvid.UUID, key string) KeyExplanation {
+		req := fmt.Sprintf("%snode/%s/explained/key/%s?explain=true", server.WebAPIPath, u, key)
+		var explanation KeyExplanation
+		if err := json.Unmarshal(server.TestHTTP(t, "GET", req, nil), &explanation); err != nil {
+			t.Fatalf("bad explain response: %v\n", err)
+		}
+		return explanation
+	}
+
+	explanation := explain(uuid2, "a")
+	if !explanation.Found || explanation.Deleted || explanation.UUID != uuid {
+		t.Errorf("expected key in child to be supplied by root %s, got %v\n", uuid, explanation)
+	}
+	if explanation = explain(uuid2, "missing"); explanation.Found {
+		t.Errorf("expected missing key to be unresolved, got %v\n", explanation)
+	}
+
+	keyreq2 := fmt.Sprintf("%snode/%s/explained/key/a", server.WebAPIPath, uuid2)
+	server.TestHTTP(t, "DELETE", keyreq2, nil)
+	explanation = explain(uuid2, "a")
+	if !explanation.Found || !explanation.Deleted || explanation.UUID != uuid2 {
+		t.Errorf("expected key to be deleted in child %s, got %v\n", uuid2, explanation)
+	}
+	if explanation = explain(uuid, "a"); explanation.Deleted || explanation.UUID != uuid {
+		t.Errorf("expected root to still supply key, got %v\n", explanation)
+	}
+}
+
+func TestKeyvalueGetAtVersion(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "history", dvid.Config{})
+
+	keyreq := fmt.Sprintf("%snode/%s/history/key/a", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("root value"))
+	if err := datastore.Commit(uuid, "root", nil); err != nil {
+		t.Fatalf("unable to commit root: %v\n", err)
+	}
+	uuid2, err := datastore.NewVersion(uuid, "child", "", nil)
+	if err != nil {
+		t.Fatalf("unable to create child version: %v\n", err)
+	}
+	keyreq2 := fmt.Sprintf("%snode/%s/history/key/a", server.WebAPIPath, uuid2)
+	server.TestHTTP(t, "POST", keyreq2, strings.NewReader("child value"))
+
+	if value := string(server.TestHTTP(t, "GET", keyreq2, nil)); value != "child value" {
+		t.Errorf("expected child value, got %q\n", value)
+	}
+	if value := string(server.TestHTTP(t, "GET", keyreq2+"?version="+string(uuid), nil)); value != "root value" {
+		t.Errorf("expected root value when reading child at root version, got %q\n", value)
+	}
+	server.TestBadHTTP(t, "GET", keyreq+"?version="+string(uuid2), nil)
+	server.TestBadHTTP(t, "GET", keyreq2+"?version=notaversion", nil)
+}
+
+func TestKeyvalueSoftDelete(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, versionID := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("SoftDelete", "true")
+	config.Set("SoftDeleteWindow", "1h")
+	server.CreateTestInstance(t, uuid, "keyvalue", "softdel", config)
+
+	keyreq := fmt.Sprintf("%snode/%s/softdel/key/mykey", server.WebAPIPath, uuid)
+	value := "some annotation"
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader(value))
+	server.TestHTTP(t, "DELETE", keyreq, nil)
+
+	// deleted key should not be visible to GETs or listings.
+	server.TestBadHTTP(t, "GET", keyreq, nil)
+	keysreq := fmt.Sprintf("%snode/%s/softdel/keys", server.WebAPIPath, uuid)
+	returnValue := server.TestHTTP(t, "GET", keysreq, nil)
+	if string(returnValue) != "[]" {
+		t.Errorf("Expected no keys after soft-delete, got %s\n", string(returnValue))
+	}
+
+	undeletereq := fmt.Sprintf("%snode/%s/softdel/key/mykey/undelete", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", undeletereq, nil)
+	returnValue = server.TestHTTP(t, "GET", keyreq, nil)
+	if string(returnValue) != value {
+		t.Errorf("Expected undeleted value %q, got %q\n", value, string(returnValue))
+	}
+
+	// tombstone is gone after undelete.
+	server.TestBadHTTP(t, "POST", undeletereq, nil)
+
+	// expired tombstones should be purged and unrecoverable.
+	server.TestHTTP(t, "DELETE", keyreq, nil)
+	kv, err := GetByUUIDName(uuid, "softdel")
+	if err != nil {
+		t.Fatalf("unable to get keyvalue instance: %v\n", err)
+	}
+	purged, err := kv.PurgeTombstones(time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("error purging tombstones: %v\n", err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected 1 purged tombstone, got %d\n", purged)
+	}
+	server.TestBadHTTP(t, "POST", undeletereq, nil)
+
+	// a tombstone rewritten by a later delete isn't purged for the earlier expiry.
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader(value))
+	server.TestHTTP(t, "DELETE", keyreq, nil)
+	cutoff := time.Now()
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader(value))
+	server.TestHTTP(t, "DELETE", keyreq, nil)
+	tombTK, err := NewTombstoneTKey("mykey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := datastore.GetOrderedKeyValueDB(kv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := storage.NewDataContext(kv, versionID)
+	removed, err := kv.purgeTombstone(ctx, db, ctx.ConstructKey(tombTK), cutoff)
+	if err != nil {
+		t.Fatalf("error purging tombstone: %v\n", err)
+	}
+	if removed {
+		t.Errorf("expected tombstone of later delete to be kept\n")
+	}
+	server.TestHTTP(t, "POST", undeletereq, nil)
+
+	// shutting down more than once is allowed.
+	wg := new(sync.WaitGroup)
+	wg.Add(2)
+	kv.Shutdown(wg)
+	kv.Shutdown(wg)
+	wg.Wait()
+}
+
+func TestReadKeyValues(t *testing.T) {
+	var kvs KeyValues
+	for i := 0; i < 5; i++ {
+		kvs.Kvs = append(kvs.Kvs, &KeyValue{Key: fmt.Sprintf("key%d", i), Value: bytes.Repeat([]byte{byte(i)}, 1000*i)})
+	}
+	data, err := kvs.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read []*KeyValue
+	err = readKeyValues(bytes.NewReader(data), func(kv *KeyValue) error {
+		read = append(read, kv)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to read key-values: %v\n", err)
+	}
+	if len(read) != len(kvs.Kvs) {
+		t.Fatalf("expected %d key-values, got %d\n", len(kvs.Kvs), len(read))
+	}
+	for i, kv := range read {
+		if kv.Key != kvs.Kvs[i].Key || !bytes.Equal(kv.Value, kvs.Kvs[i].Value) {
+			t.Errorf("key-value %d: expected key %q, got %q\n", i, kvs.Kvs[i].Key, kv.Key)
+		}
+	}
+
+	read = nil
+	err = readKeyValues(bytes.NewReader(data[:len(data)-10]), func(kv *KeyValue) error {
+		read = append(read, kv)
+		return nil
+	})
+	if err == nil || len(read) != len(kvs.Kvs)-1 {
+		t.Errorf("expected error after %d key-values of truncated serialization, got %d (err %v)\n", len(kvs.Kvs)-1, len(read), err)
+	}
+}
+
+func TestKeyvalueDedupIngest(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "deduptest", dvid.Config{})
+
+	empty := make([]byte, 1000)
+	kvs := KeyValues{
+		Kvs: []*KeyValue{
+			{Key: "block1", Value: empty},
+			{Key: "block2", Value: empty},
+			{Key: "block3", Value: []byte("unique")},
+		},
+	}
+	serialization, err := kvs.Marshal()
+	if err != nil {
+		t.Fatalf("unable to serialize KeyValues: %v\n", err)
+	}
+	ingestreq := fmt.Sprintf("%snode/%s/deduptest/keyvalues?dedup=true", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", ingestreq, bytes.NewBuffer(serialization))
+
+	for _, kv := range kvs.Kvs {
+		keyreq := fmt.Sprintf("%snode/%s/deduptest/key/%s", server.WebAPIPath, uuid, kv.Key)
+		returnValue := server.TestHTTP(t, "GET", keyreq, nil)
+		if !bytes.Equal(returnValue, kv.Value) {
+			t.Errorf("bad deduplicated value for key %q: got %d bytes, expected %d\n", kv.Key, len(returnValue), len(kv.Value))
+		}
+	}
+
+	rangereq := fmt.Sprintf("%snode/%s/deduptest/keyrangevalues/a/z", server.WebAPIPath, uuid)
+	returnValue := server.TestHTTP(t, "GET", rangereq, nil)
+	var retrieved KeyValues
+	if err := retrieved.Unmarshal(returnValue); err != nil {
+		t.Fatalf("unable to unmarshal keyrangevalues protobuf: %v\n", err)
+	}
+	if len(retrieved.Kvs) != 3 {
+		t.Fatalf("expected 3 keys from keyrangevalues, got %d\n", len(retrieved.Kvs))
+	}
+	for i, kv := range retrieved.Kvs {
+		if kv.Key != kvs.Kvs[i].Key || !bytes.Equal(kv.Value, kvs.Kvs[i].Value) {
+			t.Errorf("bad keyrangevalues result for key %q\n", kv.Key)
+		}
+	}
+
+	// keys listing should not include deduplicated payloads.
+	keysreq := fmt.Sprintf("%snode/%s/deduptest/keys", server.WebAPIPath, uuid)
+	returnValue = server.TestHTTP(t, "GET", keysreq, nil)
+	if string(returnValue) != `["block1","block2","block3"]` {
+		t.Errorf("bad keys after dedup ingest: %s\n", string(returnValue))
+	}
+}
+
+func TestKeyvalueDedupInline(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, versionID := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("InlineSize", "16")
+	server.CreateTestInstance(t, uuid, "keyvalue", "inlinetest", config)
+
+	kvs := KeyValues{
+		Kvs: []*KeyValue{
+			{Key: "large", Value: make([]byte, 1000)},
+			{Key: "small", Value: []byte("tiny")},
+		},
+	}
+	serialization, err := kvs.Marshal()
+	if err != nil {
+		t.Fatalf("unable to serialize KeyValues: %v\n", err)
+	}
+	ingestreq := fmt.Sprintf("%snode/%s/inlinetest/keyvalues?dedup=true", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", ingestreq, bytes.NewBuffer(serialization))
+
+	d, err := GetByUUIDName(uuid, "inlinetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := datastore.NewVersionedCtx(d, versionID)
+	for _, kv := range kvs.Kvs {
+		tk, err := NewTKey(kv.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, err := db.Get(ctx, tk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inline := len(kv.Value) <= d.InlineSize; isDedupRef(stored) == inline {
+			t.Errorf("expected key %q inline %t, got stored data %v\n", kv.Key, inline, stored)
+		}
+		keyreq := fmt.Sprintf("%snode/%s/inlinetest/key/%s", server.WebAPIPath, uuid, kv.Key)
+		if returnValue := server.TestHTTP(t, "GET", keyreq, nil); !bytes.Equal(returnValue, kv.Value) {
+			t.Errorf("bad value for key %q: got %d bytes, expected %d\n", kv.Key, len(returnValue), len(kv.Value))
+		}
+	}
+}
+
+func TestKeyvalueCache(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("CacheSize", "1")
+	server.CreateTestInstance(t, uuid, "keyvalue", "cached", config)
+	d, err := GetByUUIDName(uuid, "cached")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyreq := fmt.Sprintf("%snode/%s/cached/key/mykey", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("first"))
+	for i := 0; i < 2; i++ {
+		if got := string(server.TestHTTP(t, "GET", keyreq, nil)); got != "first" {
+			t.Errorf("expected cached value %q, got %q\n", "first", got)
+		}
+	}
+	if stats := d.GetCacheStats(); stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("expected 1 hit, 1 miss, and 1 entry, got %v\n", stats)
+	}
+
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("second"))
+	if got := string(server.TestHTTP(t, "GET", keyreq, nil)); got != "second" {
+		t.Errorf("expected overwritten value %q, got %q\n", "second", got)
+	}
+
+	// values cached for a version must not be served for its child.
+	if err := datastore.Commit(uuid, "parent", nil); err != nil {
+		t.Fatalf("unable to commit: %v\n", err)
+	}
+	child, err := datastore.NewVersion(uuid, "child", "", nil)
+	if err != nil {
+		t.Fatalf("unable to create child: %v\n", err)
+	}
+	childreq := fmt.Sprintf("%snode/%s/cached/key/mykey", server.WebAPIPath, child)
+	server.TestHTTP(t, "POST", childreq, strings.NewReader("child"))
+	if got := string(server.TestHTTP(t, "GET", childreq, nil)); got != "child" {
+		t.Errorf("expected child value %q, got %q\n", "child", got)
+	}
+	if got := string(server.TestHTTP(t, "GET", keyreq, nil)); got != "second" {
+		t.Errorf("expected parent value %q, got %q\n", "second", got)
+	}
+
+	server.TestHTTP(t, "DELETE", childreq, nil)
+	server.TestBadHTTP(t, "GET", childreq, nil)
+}
+
+func TestRepoInstances(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "kvB", dvid.Config{})
+	config := dvid.NewConfig()
+	config.Set("versioned", "false")
+	server.CreateTestInstance(t, uuid, "keyvalue", "kvA", config)
+
+	apiStr := fmt.Sprintf("%srepo/%s/instances", server.WebAPIPath, uuid)
+	returnValue := server.TestHTTP(t, "GET", apiStr, nil)
+	var instances []struct {
+		Name      dvid.InstanceName
+		TypeName  dvid.TypeString
+		Versioned bool
+	}
+	if err := json.Unmarshal(returnValue, &instances); err != nil {
+		t.Fatalf("Bad instances unmarshal: %v\n%s\n", err, string(returnValue))
+	}
+	if len(instances) != 2 {
+		t.Fatalf("Expected 2 instances, got %d: %s\n", len(instances), string(returnValue))
+	}
+	if instances[0].Name != "kvA" || instances[1].Name != "kvB" {
+		t.Errorf("Expected instances sorted by name, got %s\n", string(returnValue))
+	}
+	if instances[0].TypeName != TypeName || instances[0].Versioned {
+		t.Errorf("Bad description of unversioned keyvalue instance: %v\n", instances[0])
+	}
+}
+
+func TestKeyvalueConditionalRangeDelete(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "conddel", dvid.Config{})
+
+	values := map[string]string{
+		"k1": "",
+		"k2": "keep",
+		"k3": "",
+		"k4": "stale",
+		"z1": "",
+	}
+	for key, value := range values {
+		keyreq := fmt.Sprintf("%snode/%s/conddel/key/%s", server.WebAPIPath, uuid, key)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader(value))
+	}
+
+	// dry run should report matches without deleting.
+	delreq := fmt.Sprintf("%snode/%s/conddel/keyrange/k0/k9?match=empty&dryrun=true", server.WebAPIPath, uuid)
+	returnValue := server.TestHTTP(t, "DELETE", delreq, nil)
+	if string(returnValue) != `["k1","k3"]` {
+		t.Errorf("bad dry-run conditional delete response: %s\n", string(returnValue))
+	}
+	keysreq := fmt.Sprintf("%snode/%s/conddel/keys", server.WebAPIPath, uuid)
+	returnValue = server.TestHTTP(t, "GET", keysreq, nil)
+	if string(returnValue) != `["k1","k2","k3","k4","z1"]` {
+		t.Errorf("dry-run conditional delete changed keys: %s\n", string(returnValue))
+	}
+
+	delreq = fmt.Sprintf("%snode/%s/conddel/keyrange/k0/k9?match=empty", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "DELETE", delreq, nil)
+	delreq = fmt.Sprintf("%snode/%s/conddel/keyrange/k0/k9?match=value&value=stale", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "DELETE", delreq, nil)
+	returnValue = server.TestHTTP(t, "GET", keysreq, nil)
+	if string(returnValue) != `["k2","z1"]` {
+		t.Errorf("bad keys after conditional delete: %s\n", string(returnValue))
+	}
+
+	delreq = fmt.Sprintf("%snode/%s/conddel/keyrange/k0/k9", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "DELETE", delreq, nil)
+}
+
+func TestKeyvaluePrefixDelete(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "prefixdel", dvid.Config{})
+
+	for _, key := range []string{"tmp", "tmp/a", "tmp/b", "tmpx", "zzz"} {
+		keyreq := fmt.Sprintf("%snode/%s/prefixdel/key/%s", server.WebAPIPath, uuid, key)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader("value"))
+	}
+
+	// dry run should report matches without deleting.
+	delreq := fmt.Sprintf("%snode/%s/prefixdel/keys/prefix/tmp/?dryrun=true", server.WebAPIPath, uuid)
+	returnValue := server.TestHTTP(t, "DELETE", delreq, nil)
+	if string(returnValue) != `{"Count":2,"DryRun":true,"Keys":["tmp/a","tmp/b"]}` {
+		t.Errorf("bad dry-run prefix delete response: %s\n", string(returnValue))
+	}
+	keysreq := fmt.Sprintf("%snode/%s/prefixdel/keys", server.WebAPIPath, uuid)
+	returnValue = server.TestHTTP(t, "GET", keysreq, nil)
+	if string(returnValue) != `["tmp","tmp/a","tmp/b","tmpx","zzz"]` {
+		t.Errorf("dry-run prefix delete changed keys: %s\n", string(returnValue))
+	}
+
+	delreq = fmt.Sprintf("%snode/%s/prefixdel/keys/prefix/tmp/", server.WebAPIPath, uuid)
+	returnValue = server.TestHTTP(t, "DELETE", delreq, nil)
+	if string(returnValue) != `{"Count":2,"DryRun":false}` {
+		t.Errorf("bad prefix delete response: %s\n", string(returnValue))
+	}
+	returnValue = server.TestHTTP(t, "GET", keysreq, nil)
+	if string(returnValue) != `["tmp","tmpx","zzz"]` {
+		t.Errorf("bad keys after prefix delete: %s\n", string(returnValue))
+	}
+
+	delreq = fmt.Sprintf("%snode/%s/prefixdel/keys/prefix/tmp", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "DELETE", delreq, nil)
+	returnValue = server.TestHTTP(t, "GET", keysreq, nil)
+	if string(returnValue) != `["zzz"]` {
+		t.Errorf("bad keys after second prefix delete: %s\n", string(returnValue))
+	}
+	server.TestBadHTTP(t, "GET", delreq, nil)
+}
+
+func TestKeyvalueReadOnly(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, versionID := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("ReadOnly", "true")
+	server.CreateTestInstance(t, uuid, "keyvalue", "archived", config)
+
+	keyreq := fmt.Sprintf("%snode/%s/archived/key/mykey", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", keyreq, strings.NewReader("some data"))
+	server.TestBadHTTP(t, "DELETE", keyreq, nil)
+
+	// writes bypassing HTTP should still be rejected by the store.
+	kv, err := GetByUUIDName(uuid, "archived")
+	if err != nil {
+		t.Fatalf("unable to get keyvalue instance: %v\n", err)
+	}
+	ctx := datastore.NewVersionedCtx(kv, versionID)
+	if err := kv.PutData(ctx, "mykey", []byte("some data")); err != storage.ErrReadOnly {
+		t.Errorf("expected read-only error on put, got %v\n", err)
+	}
+	if err := kv.DeleteData(ctx, "mykey"); err != storage.ErrReadOnly {
+		t.Errorf("expected read-only error on delete, got %v\n", err)
+	}
+
+	inforeq := fmt.Sprintf("%snode/%s/archived/info", server.WebAPIPath, uuid)
+	returnValue := server.TestHTTP(t, "GET", inforeq, nil)
+	var info struct {
+		Base struct {
+			ReadOnly bool
+		}
+	}
+	if err := json.Unmarshal(returnValue, &info); err != nil {
+		t.Fatalf("bad info unmarshal: %v\n", err)
+	}
+	if !info.Base.ReadOnly {
+		t.Errorf("expected read-only in instance info: %s\n", string(returnValue))
+	}
+}
+
 type resolveResp struct {
 	Child dvid.UUID `json:"child"`
 }
 
+func TestVerifyVersions(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, versionID := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "versioned", dvid.Config{})
+
+	kv, err := GetByUUIDName(uuid, "versioned")
+	if err != nil {
+		t.Fatalf("unable to get keyvalue instance: %v\n", err)
+	}
+	ctx := datastore.NewVersionedCtx(kv, versionID)
+	if err := kv.PutData(ctx, "good", []byte("some data")); err != nil {
+		t.Fatalf("unable to put data: %v\n", err)
+	}
+
+	// add a key with a version that isn't in the repo DAG.
+	db, err := datastore.GetOrderedKeyValueDB(kv)
+	if err != nil {
+		t.Fatalf("unable to get store: %v\n", err)
+	}
+	tk, err := NewTKey("orphan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphanV := versionID + 100
+	if err := db.RawPut(ctx.ConstructKeyVersion(tk, orphanV), []byte("lost data")); err != nil {
+		t.Fatalf("unable to put orphaned key: %v\n", err)
+	}
+
+	report, err := datastore.VerifyVersions(uuid, "versioned", false, "")
+	if err != nil {
+		t.Fatalf("unable to verify versions: %v\n", err)
+	}
+	if report.KeysScanned != 2 || len(report.Orphaned) != 1 || report.Orphaned[orphanV] != 1 || report.Purged != 0 {
+		t.Errorf("bad report-only verification: %s\n", report)
+	}
+
+	report, err = datastore.VerifyVersions(uuid, "versioned", true, "")
+	if err != nil {
+		t.Fatalf("unable to verify and purge versions: %v\n", err)
+	}
+	if report.Purged != 1 {
+		t.Errorf("expected 1 purged key, got %s\n", report)
+	}
+	report, err = datastore.VerifyVersions(uuid, "versioned", false, "")
+	if err != nil {
+		t.Fatalf("unable to verify versions: %v\n", err)
+	}
+	if report.KeysScanned != 1 || len(report.Orphaned) != 0 {
+		t.Errorf("expected no orphaned keys after purge: %s\n", report)
+	}
+	value, found, err := kv.GetData(ctx, "good")
+	if err != nil {
+		t.Fatalf("unable to get data after purge: %v\n", err)
+	}
+	if !found || string(value) != "some data" {
+		t.Errorf("expected valid key to survive purge, got %q\n", string(value))
+	}
+}
+
+func TestKeyvalueBinaryKeys(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "binkeys", dvid.Config{})
+
+	keys := []string{"a", "b%c", "long key with \"quotes\""}
+	for _, key := range keys {
+		keyreq := fmt.Sprintf("%snode/%s/binkeys/key/%s", server.WebAPIPath, uuid, url.PathEscape(key))
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader("data"))
+	}
+
+	keysreq := fmt.Sprintf("%snode/%s/binkeys/keys", server.WebAPIPath, uuid)
+	req, err := http.NewRequest("GET", keysreq, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/octet-stream")
+	w := httptest.NewRecorder()
+	server.ServeSingleHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("bad status %d for binary keys request: %s\n", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/octet-stream" {
+		t.Errorf("expected binary content type, got %q\n", ct)
+	}
+	var got []string
+	buf := w.Body.Bytes()
+	for len(buf) >= 4 {
+		size := int(binary.LittleEndian.Uint32(buf[0:4]))
+		got = append(got, string(buf[4:4+size]))
+		buf = buf[4+size:]
+	}
+	if len(buf) != 0 || len(got) != len(keys) {
+		t.Fatalf("bad binary key list: got %v\n", got)
+	}
+	for i, key := range keys {
+		if got[i] != key {
+			t.Errorf("expected key %d to be %q, got %q\n", i, key, got[i])
+		}
+	}
+
+	// JSON remains the default.
+	var jsonKeys []string
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", keysreq, nil), &jsonKeys); err != nil {
+		t.Fatalf("bad JSON keys: %v\n", err)
+	}
+	if len(jsonKeys) != len(keys) {
+		t.Errorf("expected %d JSON keys, got %v\n", len(keys), jsonKeys)
+	}
+}
+
+func TestKeyvalueQuota(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("Quota", "100")
+	server.CreateTestInstance(t, uuid, "keyvalue", "limited", config)
+
+	keyreq := fmt.Sprintf("%snode/%s/limited/key/small", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("some data"))
+
+	keyreq = fmt.Sprintf("%snode/%s/limited/key/big", server.WebAPIPath, uuid)
+	resp := server.TestHTTPResponse(t, "POST", keyreq, bytes.NewReader(make([]byte, 200)))
+	if resp.Code != http.StatusInsufficientStorage {
+		t.Errorf("expected status %d for write beyond quota, got %d\n", http.StatusInsufficientStorage, resp.Code)
+	}
+
+	quotareq := fmt.Sprintf("%snode/%s/limited/quota", server.WebAPIPath, uuid)
+	var usage struct {
+		Quota uint64
+		Used  uint64
+	}
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", quotareq, nil), &usage); err != nil {
+		t.Fatalf("bad quota JSON: %v\n", err)
+	}
+	if usage.Quota != 100 {
+		t.Errorf("expected quota of 100 bytes, got %d\n", usage.Quota)
+	}
+	if usage.Used == 0 || usage.Used > 100 {
+		t.Errorf("expected bytes used for only the small key, got %d\n", usage.Used)
+	}
+}
+
+func TestKeyvalueQuotaBookkeeping(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("Quota", "1000")
+	config.Set("AccessInterval", "1ns")
+	config.Set("SoftDelete", "true")
+	config.Set("TrackModified", "true")
+	server.CreateTestInstance(t, uuid, "keyvalue", "metered", config)
+
+	kv, err := GetByUUIDName(uuid, "metered")
+	if err != nil {
+		t.Fatalf("unable to get keyvalue instance: %v\n", err)
+	}
+	quotaUsed := func() uint64 {
+		_, used, err := datastore.GetQuotaUsage(kv)
+		if err != nil {
+			t.Fatalf("unable to get quota usage: %v\n", err)
+		}
+		return used
+	}
+	keyreq := fmt.Sprintf("%snode/%s/metered/key/mykey", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("some data"))
+	written := quotaUsed()
+	if written == 0 {
+		t.Fatalf("expected write to be charged to the quota\n")
+	}
+
+	// reads record access times and deletes write tombstones, neither charged to the quota.
+	for i := 0; i < 10; i++ {
+		server.TestHTTP(t, "GET", keyreq, nil)
+		time.Sleep(time.Millisecond)
+	}
+	server.TestHTTP(t, "DELETE", keyreq, nil)
+	if used := quotaUsed(); used != written {
+		t.Errorf("expected reads and deletes to leave quota usage at %d bytes, got %d\n", written, used)
+	}
+}
+
+func TestKeyvalueMaxKeys(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("MaxKeys", "2")
+	server.CreateTestInstance(t, uuid, "keyvalue", "capped", config)
+
+	keyreq := func(key string) string {
+		return fmt.Sprintf("%snode/%s/capped/key/%s", server.WebAPIPath, uuid, key)
+	}
+	server.TestHTTP(t, "POST", keyreq("a"), strings.NewReader("first"))
+	server.TestHTTP(t, "POST", keyreq("b"), strings.NewReader("second"))
+
+	resp := server.TestHTTPResponse(t, "POST", keyreq("c"), strings.NewReader("third"))
+	if resp.Code != http.StatusInsufficientStorage {
+		t.Errorf("expected status %d for key beyond limit, got %d\n", http.StatusInsufficientStorage, resp.Code)
+	}
+	txnreq := fmt.Sprintf("%snode/%s/capped/txn", server.WebAPIPath, uuid)
+	resp = server.TestHTTPResponse(t, "POST", txnreq, strings.NewReader(`[{"Op": "put", "Key": "c", "Value": "AQID"}]`))
+	if resp.Code != http.StatusInsufficientStorage {
+		t.Errorf("expected status %d for transaction beyond limit, got %d\n", http.StatusInsufficientStorage, resp.Code)
+	}
+	server.TestHTTP(t, "POST", keyreq("a"), strings.NewReader("overwritten"))
+
+	server.TestHTTP(t, "DELETE", keyreq("b"), nil)
+	server.TestHTTP(t, "POST", keyreq("c"), strings.NewReader("third"))
+	if data := server.TestHTTP(t, "GET", keyreq("c"), nil); string(data) != "third" {
+		t.Errorf("expected key c after deletion freed a slot, got %q\n", string(data))
+	}
+}
+
+func TestKeyvalueChunking(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, versionID := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("ChunkSize", "64")
+	server.CreateTestInstance(t, uuid, "keyvalue", "chunked", config)
+
+	kv, err := GetByUUIDName(uuid, "chunked")
+	if err != nil {
+		t.Fatalf("unable to get keyvalue instance: %v\n", err)
+	}
+	db, err := datastore.GetOrderedKeyValueDB(kv)
+	if err != nil {
+		t.Fatalf("unable to get store: %v\n", err)
+	}
+	ctx := datastore.NewVersionedCtx(kv, versionID)
+	numChunks := func() int {
+		tks, err := db.KeysInRange(ctx, storage.MinTKey(keyChunk), storage.MaxTKey(keyChunk))
+		if err != nil {
+			t.Fatalf("unable to get chunk keys: %v\n", err)
+		}
+		return len(tks)
+	}
+
+	big := make([]byte, 300)
+	if _, err := rand.Read(big); err != nil {
+		t.Fatal(err)
+	}
+	keyreq := fmt.Sprintf("%snode/%s/chunked/key/big", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, bytes.NewReader(big))
+	if data := server.TestHTTP(t, "GET", keyreq, nil); !bytes.Equal(data, big) {
+		t.Errorf("expected chunked value of %d bytes, got %d bytes\n", len(big), len(data))
+	}
+	if n := numChunks(); n < 5 {
+		t.Errorf("expected value to be split into at least 5 chunks, got %d\n", n)
+	}
+
+	rangereq := fmt.Sprintf("%snode/%s/chunked/keyrange/a/z", server.WebAPIPath, uuid)
+	var keys []string
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", rangereq, nil), &keys); err != nil {
+		t.Fatalf("bad keyrange JSON: %v\n", err)
+	}
+	if len(keys) != 1 || keys[0] != "big" {
+		t.Errorf("expected only the logical key in range, got %v\n", keys)
+	}
+
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("small"))
+	if data := server.TestHTTP(t, "GET", keyreq, nil); string(data) != "small" {
+		t.Errorf("expected overwritten value, got %q\n", string(data))
+	}
+	if n := numChunks(); n != 0 {
+		t.Errorf("expected chunks to be removed on overwrite, got %d\n", n)
+	}
+
+	server.TestHTTP(t, "POST", keyreq, bytes.NewReader(big))
+	server.TestHTTP(t, "DELETE", keyreq, nil)
+	if n := numChunks(); n != 0 {
+		t.Errorf("expected chunks to be removed on delete, got %d\n", n)
+	}
+}
+
+func TestKeyvalueCoalesce(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, versionID := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("CoalesceInterval", "1h")
+	server.CreateTestInstance(t, uuid, "keyvalue", "coalesced", config)
+
+	kv, err := GetByUUIDName(uuid, "coalesced")
+	if err != nil {
+		t.Fatalf("unable to get keyvalue instance: %v\n", err)
+	}
+	db, err := datastore.GetOrderedKeyValueDB(kv)
+	if err != nil {
+		t.Fatalf("unable to get store: %v\n", err)
+	}
+	ctx := datastore.NewVersionedCtx(kv, versionID)
+	tk, err := NewTKey("counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyreq := fmt.Sprintf("%snode/%s/coalesced/key/counter", server.WebAPIPath, uuid)
+	for i := 0; i < 100; i++ {
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader(fmt.Sprintf("%d", i)))
+	}
+	if data := server.TestHTTP(t, "GET", keyreq, nil); string(data) != "99" {
+		t.Errorf("expected buffered value 99, got %q\n", string(data))
+	}
+	if stored, err := db.Get(ctx, tk); err != nil || stored != nil {
+		t.Errorf("expected no write to store before flush, got %v (err %v)\n", stored, err)
+	}
+
+	rangereq := fmt.Sprintf("%snode/%s/coalesced/keyrange/a/z", server.WebAPIPath, uuid)
+	var keys []string
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", rangereq, nil), &keys); err != nil {
+		t.Fatalf("bad keyrange JSON: %v\n", err)
+	}
+	if len(keys) != 1 || keys[0] != "counter" {
+		t.Errorf("expected range read to see flushed key, got %v\n", keys)
+	}
+	if stored, err := db.Get(ctx, tk); err != nil || stored == nil {
+		t.Errorf("expected flushed value in store, got err %v\n", err)
+	}
+	if data := server.TestHTTP(t, "GET", keyreq, nil); string(data) != "99" {
+		t.Errorf("expected flushed value 99, got %q\n", string(data))
+	}
+
+	for _, limit := range []string{"MaxKeys", "Quota"} {
+		config := dvid.NewConfig()
+		config.Set("CoalesceInterval", "1h")
+		config.Set(limit, "10")
+		if _, err := datastore.NewData(uuid, kvtype, dvid.InstanceName("limited"+limit), config); err == nil {
+			t.Errorf("expected error creating coalesced instance with %s\n", limit)
+		}
+	}
+}
+
+func TestKeyvalueCoalesceFlusher(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, versionID := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("CoalesceInterval", "10ms")
+	server.CreateTestInstance(t, uuid, "keyvalue", "flushed", config)
+
+	kv, err := GetByUUIDName(uuid, "flushed")
+	if err != nil {
+		t.Fatalf("unable to get keyvalue instance: %v\n", err)
+	}
+	db, err := datastore.GetOrderedKeyValueDB(kv)
+	if err != nil {
+		t.Fatalf("unable to get store: %v\n", err)
+	}
+	ctx := datastore.NewVersionedCtx(kv, versionID)
+	storedValue := func(key string) []byte {
+		tk, err := NewTKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, err := db.Get(ctx, tk)
+		if err != nil {
+			t.Fatalf("unable to get key %q from store: %v\n", key, err)
+		}
+		return stored
+	}
+	waitStored := func(key string) bool {
+		for i := 0; i < 200; i++ {
+			if storedValue(key) != nil {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	keyreq := fmt.Sprintf("%snode/%s/flushed/key/a", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("value"))
+	if !waitStored("a") {
+		t.Errorf("expected buffered write of new instance to be flushed without a read\n")
+	}
+
+	// a rejected config must not change the instance.
+	config = dvid.NewConfig()
+	config.Set("MaxKeys", "10")
+	if err := kv.ModifyConfig(config); err == nil {
+		t.Errorf("expected error setting MaxKeys on coalesced instance\n")
+	}
+	if kv.MaxKeys != 0 {
+		t.Errorf("expected rejected config to leave MaxKeys unset, got %d\n", kv.MaxKeys)
+	}
+
+	// turning off coalescing writes puts directly and a positive interval restarts flushing.
+	config = dvid.NewConfig()
+	config.Set("CoalesceInterval", "0s")
+	if err := kv.ModifyConfig(config); err != nil {
+		t.Fatalf("unable to turn off coalescing: %v\n", err)
+	}
+	keyreq = fmt.Sprintf("%snode/%s/flushed/key/b", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("value"))
+	if storedValue("b") == nil {
+		t.Errorf("expected direct write with coalescing off\n")
+	}
+	config.Set("CoalesceInterval", "10ms")
+	if err := kv.ModifyConfig(config); err != nil {
+		t.Fatalf("unable to turn on coalescing: %v\n", err)
+	}
+	keyreq = fmt.Sprintf("%snode/%s/flushed/key/c", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("value"))
+	if !waitStored("c") {
+		t.Errorf("expected buffered write to be flushed after coalescing turned back on\n")
+	}
+}
+
+func TestKeyvalueRebuildCounters(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("MaxKeys", "10")
+	server.CreateTestInstance(t, uuid, "keyvalue", "counted", config)
+
+	for _, key := range []string{"a", "b", "c"} {
+		keyreq := fmt.Sprintf("%snode/%s/counted/key/%s", server.WebAPIPath, uuid, key)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader("value"))
+	}
+	kv, err := GetByUUIDName(uuid, "counted")
+	if err != nil {
+		t.Fatalf("unable to get keyvalue instance: %v\n", err)
+	}
+	if err := datastore.AddKeys(kv, 5, 0); err != nil {
+		t.Fatalf("unable to add drift to key count: %v\n", err)
+	}
+
+	rebuildreq := fmt.Sprintf("%srepo/%s/instance/counted/rebuild-counters", server.WebAPIPath, uuid)
+	var rebuild datastore.CountersRebuild
+	if err := json.Unmarshal(server.TestHTTP(t, "POST", rebuildreq, nil), &rebuild); err != nil {
+		t.Fatalf("bad rebuild JSON: %v\n", err)
+	}
+	if rebuild.Before.Keys != 8 || rebuild.After.Keys != 3 {
+		t.Errorf("expected key count rebuilt from 8 to 3, got %v\n", rebuild)
+	}
+	if rebuild.StoredBytes == 0 {
+		t.Errorf("expected stored bytes, got %v\n", rebuild)
+	}
+	if count, err := datastore.GetKeyCount(kv); err != nil || count != 3 {
+		t.Errorf("expected persisted key count of 3, got %d (err %v)\n", count, err)
+	}
+}
+
+func TestKeyvalueRebuildCountersVersioned(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("MaxKeys", "10")
+	config.Set("Quota", "1000000")
+	server.CreateTestInstance(t, uuid, "keyvalue", "versioned", config)
+
+	keyreq := func(node dvid.UUID, key string) string {
+		return fmt.Sprintf("%snode/%s/versioned/key/%s", server.WebAPIPath, node, key)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		server.TestHTTP(t, "POST", keyreq(uuid, key), strings.NewReader("value"))
+	}
+	server.TestHTTP(t, "POST", keyreq(uuid, "b"), strings.NewReader("overwritten"))
+	server.TestHTTP(t, "DELETE", keyreq(uuid, "c"), nil)
+	if err := datastore.Commit(uuid, "parent", nil); err != nil {
+		t.Fatalf("commit failed: %v\n", err)
+	}
+	child, err := datastore.NewVersion(uuid, "child", "", nil)
+	if err != nil {
+		t.Fatalf("can't create child version: %v\n", err)
+	}
+	server.TestHTTP(t, "POST", keyreq(child, "d"), strings.NewReader("value"))
+	server.TestHTTP(t, "POST", keyreq(child, "b"), strings.NewReader("changed"))
+	server.TestHTTP(t, "DELETE", keyreq(child, "a"), nil)
+	server.TestHTTP(t, "POST", keyreq(child, "c"), strings.NewReader("restored"))
+
+	kv, err := GetByUUIDName(uuid, "versioned")
+	if err != nil {
+		t.Fatalf("unable to get keyvalue instance: %v\n", err)
+	}
+	count, err := datastore.GetKeyCount(kv)
+	if err != nil {
+		t.Fatalf("unable to get key count: %v\n", err)
+	}
+	_, used, err := datastore.GetQuotaUsage(kv)
+	if err != nil {
+		t.Fatalf("unable to get quota usage: %v\n", err)
+	}
+	if count != 3 {
+		t.Errorf("expected incremental key count of 3, got %d\n", count)
+	}
+
+	rebuildreq := fmt.Sprintf("%srepo/%s/instance/versioned/rebuild-counters", server.WebAPIPath, uuid)
+	var rebuild datastore.CountersRebuild
+	if err := json.Unmarshal(server.TestHTTP(t, "POST", rebuildreq, nil), &rebuild); err != nil {
+		t.Fatalf("bad rebuild JSON: %v\n", err)
+	}
+	if rebuild.Before != rebuild.After || rebuild.After.Keys != count || rebuild.After.Bytes != used {
+		t.Errorf("expected rebuild to leave %d keys and %d bytes used unchanged, got %v\n", count, used, rebuild)
+	}
+	if after, err := datastore.GetKeyCount(kv); err != nil || after != count {
+		t.Errorf("expected persisted key count of %d, got %d (err %v)\n", count, after, err)
+	}
+	if _, after, err := datastore.GetQuotaUsage(kv); err != nil || after != used {
+		t.Errorf("expected quota usage of %d, got %d (err %v)\n", used, after, err)
+	}
+}
+
+func TestKeyvalueOperationPolicy(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("DenyOps", "DELETE:key,GET:keyrangevalues")
+	server.CreateTestInstance(t, uuid, "keyvalue", "guarded", config)
+	config = dvid.NewConfig()
+	config.Set("AllowOps", "GET:*")
+	server.CreateTestInstance(t, uuid, "keyvalue", "getonly", config)
+
+	keyreq := fmt.Sprintf("%snode/%s/guarded/key/mykey", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("value"))
+	if got := string(server.TestHTTP(t, "GET", keyreq, nil)); got != "value" {
+		t.Errorf("expected allowed GET to return %q, got %q\n", "value", got)
+	}
+	denied := []struct {
+		method, url string
+	}{
+		{"DELETE", keyreq},
+		{"GET", fmt.Sprintf("%snode/%s/guarded/keyrangevalues/a/z", server.WebAPIPath, uuid)},
+		{"POST", fmt.Sprintf("%snode/%s/getonly/key/mykey", server.WebAPIPath, uuid)},
+	}
+	for _, req := range denied {
+		if resp := server.TestHTTPResponse(t, req.method, req.url, strings.NewReader("value")); resp.Code != http.StatusForbidden {
+			t.Errorf("expected %s %s to be forbidden, got status %d\n", req.method, req.url, resp.Code)
+		}
+	}
+	server.TestHTTP(t, "GET", fmt.Sprintf("%snode/%s/getonly/keys", server.WebAPIPath, uuid), nil)
+}
+
+func TestKeyvalueRawValues(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, versionID := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("Compression", "lz4")
+	server.CreateTestInstance(t, uuid, "keyvalue", "rawvals", config)
+
+	encoded := []byte{0x1f, 0x8b, 0x08, 0x00, 0x01, 0x02, 0x03}
+	rawreq := fmt.Sprintf("%snode/%s/rawvals/key/archive?raw=true", server.WebAPIPath, uuid)
+	req, err := http.NewRequest("POST", rawreq, bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	server.ServeSingleHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("bad status %d for raw POST: %s\n", w.Code, w.Body.String())
+	}
+	keyreq := fmt.Sprintf("%snode/%s/rawvals/key/plain", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("serialized"))
+
+	d, err := GetByUUIDName(uuid, "rawvals")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk, err := NewTKey("archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := db.Get(datastore.NewVersionedCtx(d, versionID), tk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) == 0 || stored[0] != rawValueMarker || !bytes.HasSuffix(stored, encoded) {
+		t.Errorf("expected value stored as sent with raw marker, got %v\n", stored)
+	}
+
+	req, err = http.NewRequest("GET", fmt.Sprintf("%snode/%s/rawvals/key/archive", server.WebAPIPath, uuid), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	server.ServeSingleHTTP(w, req)
+	if !bytes.Equal(w.Body.Bytes(), encoded) {
+		t.Errorf("expected raw value returned verbatim, got %v\n", w.Body.Bytes())
+	}
+	if ct, ce := w.Header().Get("Content-Type"), w.Header().Get("Content-Encoding"); ct != "application/json" || ce != "gzip" {
+		t.Errorf("expected recorded content type and encoding, got %q and %q\n", ct, ce)
+	}
+	if got := string(server.TestHTTP(t, "GET", keyreq, nil)); got != "serialized" {
+		t.Errorf("expected serialized value %q in mixed instance, got %q\n", "serialized", got)
+	}
+
+	// renamed raw values keep their encoding.
+	renamereq := fmt.Sprintf("%snode/%s/rawvals/keys/rename?from=arch&to=old-arch", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", renamereq, nil)
+	req, err = http.NewRequest("GET", fmt.Sprintf("%snode/%s/rawvals/key/old-archive", server.WebAPIPath, uuid), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	server.ServeSingleHTTP(w, req)
+	if !bytes.Equal(w.Body.Bytes(), encoded) {
+		t.Errorf("expected renamed raw value returned verbatim, got %v\n", w.Body.Bytes())
+	}
+	if ct, ce := w.Header().Get("Content-Type"), w.Header().Get("Content-Encoding"); ct != "application/json" || ce != "gzip" {
+		t.Errorf("expected renamed value to keep content type and encoding, got %q and %q\n", ct, ce)
+	}
+
+	// swapped raw values keep their encoding.
+	swapreq := fmt.Sprintf("%snode/%s/rawvals/keys/swap?a=old-archive&b=plain", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", swapreq, nil)
+	req, err = http.NewRequest("GET", keyreq, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	server.ServeSingleHTTP(w, req)
+	if !bytes.Equal(w.Body.Bytes(), encoded) {
+		t.Errorf("expected swapped raw value returned verbatim, got %v\n", w.Body.Bytes())
+	}
+	if ct, ce := w.Header().Get("Content-Type"), w.Header().Get("Content-Encoding"); ct != "application/json" || ce != "gzip" {
+		t.Errorf("expected swapped value to keep content type and encoding, got %q and %q\n", ct, ce)
+	}
+	oldreq := fmt.Sprintf("%snode/%s/rawvals/key/old-archive", server.WebAPIPath, uuid)
+	if got := string(server.TestHTTP(t, "GET", oldreq, nil)); got != "serialized" {
+		t.Errorf("expected swapped serialized value %q, got %q\n", "serialized", got)
+	}
+}
+
+func TestKeyvaluePayloadChecksum(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "checked", dvid.Config{})
+
+	keyreq := fmt.Sprintf("%snode/%s/checked/key/doc", server.WebAPIPath, uuid)
+	post := func(body string, header, checksum string) int {
+		req, err := http.NewRequest("POST", keyreq, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(header, checksum)
+		w := httptest.NewRecorder()
+		server.ServeSingleHTTP(w, req)
+		return w.Code
+	}
+	sum := md5.Sum([]byte("original"))
+	if code := post("original", "Content-MD5", base64.StdEncoding.EncodeToString(sum[:])); code != http.StatusOK {
+		t.Fatalf("expected POST with matching Content-MD5 to succeed, got %d\n", code)
+	}
+	if code := post("corrupted", "Content-MD5", base64.StdEncoding.EncodeToString(sum[:])); code != http.StatusBadRequest {
+		t.Errorf("expected POST with mismatched Content-MD5 to fail, got %d\n", code)
+	}
+	if code := post("corrupted", "X-Dvid-Checksum", "deadbeef"); code != http.StatusBadRequest {
+		t.Errorf("expected POST with mismatched checksum to fail, got %d\n", code)
+	}
+
+	req, err := http.NewRequest("GET", keyreq, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	server.ServeSingleHTTP(w, req)
+	if w.Body.String() != "original" {
+		t.Fatalf("expected rejected POSTs not to be stored, got %q\n", w.Body.String())
+	}
+	if got := w.Header().Get("Content-MD5"); got != base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Errorf("expected Content-MD5 of returned value, got %q\n", got)
+	}
+	checksum := w.Header().Get("X-Dvid-Checksum")
+	if code := post("original", "X-Dvid-Checksum", checksum); code != http.StatusOK {
+		t.Errorf("expected POST with checksum %q returned by GET to succeed, got %d\n", checksum, code)
+	}
+}
+
+func TestKeyvalueIdempotentPost(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "idem", dvid.Config{})
+
+	keyreq := fmt.Sprintf("%snode/%s/idem/key/a", server.WebAPIPath, uuid)
+	post := func(value, idemKey string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", keyreq, strings.NewReader(value))
+		if err != nil {
+			t.Fatalf("unsuccessful making request: %v\n", err)
+		}
+		req.Header.Set(IdempotencyKeyHeader, idemKey)
+		w := httptest.NewRecorder()
+		server.ServeSingleHTTP(w, req)
+		return w
+	}
+
+	if w := post("first", "req-1"); w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("bad response to first idempotent POST: %d %v\n", w.Code, w.Header())
+	}
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("second"))
+
+	// a retry shouldn't overwrite the later value.
+	if w := post("first", "req-1"); w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("expected replayed response to retried POST, got %d %v\n", w.Code, w.Header())
+	}
+	if value := string(server.TestHTTP(t, "GET", keyreq, nil)); value != "second" {
+		t.Errorf("retried POST was applied again, got value %q\n", value)
+	}
+	if w := post("other", "req-1"); w.Code != http.StatusConflict {
+		t.Errorf("expected conflict on reused idempotency key, got %d\n", w.Code)
+	}
+	if w := post("third", "req-2"); w.Code != http.StatusOK {
+		t.Errorf("bad response to new idempotent POST: %d\n", w.Code)
+	}
+	if value := string(server.TestHTTP(t, "GET", keyreq, nil)); value != "third" {
+		t.Errorf("expected new idempotency key to write, got value %q\n", value)
+	}
+
+	kv, err := GetByUUIDName(uuid, "idem")
+	if err != nil {
+		t.Fatalf("can't get keyvalue instance: %v\n", err)
+	}
+	purged, err := kv.PurgeIdempotencyRecords(time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("error purging idempotency records: %v\n", err)
+	}
+	if purged != 2 {
+		t.Errorf("expected 2 purged idempotency records, got %d\n", purged)
+	}
+	if w := post("first", "req-1"); w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("expected purged idempotency key to write again, got %d %v\n", w.Code, w.Header())
+	}
+}
+
+func TestKeyvalueSizeHistogram(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "sized", dvid.Config{})
+
+	for i, size := range []int{0, 10, 100, 1000} {
+		keyreq := fmt.Sprintf("%snode/%s/sized/key/k%d", server.WebAPIPath, uuid, i)
+		value := make([]byte, size)
+		if _, err := rand.Read(value); err != nil {
+			t.Fatalf("can't make random value: %v\n", err)
+		}
+		server.TestHTTP(t, "POST", keyreq, bytes.NewBuffer(value))
+	}
+
+	if sizeBucket(0) != 0 || sizeBucket(1) != 1 || sizeBucket(2) != 2 || sizeBucket(3) != 3 || sizeBucket(4) != 3 || sizeBucket(5) != 4 {
+		t.Errorf("bad size buckets\n")
+	}
+
+	sizesreq := fmt.Sprintf("%snode/%s/sized/sizes", server.WebAPIPath, uuid)
+	var hist SizeHistogram
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", sizesreq, nil), &hist); err != nil {
+		t.Fatalf("bad sizes response: %v\n", err)
+	}
+	if hist.Count != 4 || len(hist.Buckets) == 0 {
+		t.Fatalf("bad size histogram: %v\n", hist)
+	}
+	last := hist.Buckets[len(hist.Buckets)-1]
+	if last.Count != 4 || last.UpperBound < 1000 || last.UpperBound >= 4096 {
+		t.Errorf("expected last bucket to hold the largest value, got %v\n", hist.Buckets)
+	}
+	for i := 1; i < len(hist.Buckets); i++ {
+		if hist.Buckets[i].Count < hist.Buckets[i-1].Count {
+			t.Errorf("expected cumulative bucket counts, got %v\n", hist.Buckets)
+		}
+	}
+
+	text := string(server.TestHTTP(t, "GET", sizesreq+"?format=prometheus", nil))
+	if !strings.Contains(text, `dvid_keyvalue_value_size_bytes_bucket{instance="sized",le="+Inf"} 4`) ||
+		!strings.Contains(text, `dvid_keyvalue_value_size_bytes_count{instance="sized"} 4`) {
+		t.Errorf("bad prometheus size histogram:\n%s\n", text)
+	}
+}
+
+func TestKeyvalueConditionalDelete(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("TrackModified", "true")
+	server.CreateTestInstance(t, uuid, "keyvalue", "conditional", config)
+
+	keyreq := fmt.Sprintf("%snode/%s/conditional/key/a", server.WebAPIPath, uuid)
+	del := func(header, value string) int {
+		req, err := http.NewRequest("DELETE", keyreq, nil)
+		if err != nil {
+			t.Fatalf("unsuccessful making request: %v\n", err)
+		}
+		req.Header.Set(header, value)
+		w := httptest.NewRecorder()
+		server.ServeSingleHTTP(w, req)
+		return w.Code
+	}
+	get := func() *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", keyreq, nil)
+		if err != nil {
+			t.Fatalf("unsuccessful making request: %v\n", err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeSingleHTTP(w, req)
+		return w
+	}
+
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("first"))
+	etag := get().Header().Get("ETag")
+	if etag != ValueETag([]byte("first")) {
+		t.Fatalf("expected ETag of value, got %q\n", etag)
+	}
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("second"))
+	if code := del("If-Match", etag); code != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 deleting concurrently updated key, got %d\n", code)
+	}
+	if w := get(); w.Code != http.StatusOK || w.Body.String() != "second" {
+		t.Errorf("key deleted despite failed precondition: %d %q\n", w.Code, w.Body.String())
+	}
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	if code := del("If-Unmodified-Since", past); code != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 deleting key modified since, got %d\n", code)
+	}
+	if code := del("If-Match", get().Header().Get("ETag")); code != http.StatusOK {
+		t.Errorf("expected delete with matching ETag to succeed, got %d\n", code)
+	}
+	if w := get(); w.Code != http.StatusNotFound {
+		t.Errorf("expected key to be deleted, got %d\n", w.Code)
+	}
+	if code := del("If-Match", "*"); code != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 deleting missing key with If-Match, got %d\n", code)
+	}
+
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("third"))
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if code := del("If-Unmodified-Since", future); code != http.StatusOK {
+		t.Errorf("expected delete of unmodified key to succeed, got %d\n", code)
+	}
+}
+
+func TestKeyvalueWriteLimit(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("MaxPendingWrites", "1")
+	server.CreateTestInstance(t, uuid, "keyvalue", "limited", config)
+	kv, err := GetByUUIDName(uuid, "limited")
+	if err != nil {
+		t.Fatalf("can't get keyvalue instance: %v\n", err)
+	}
+
+	// hold the only write slot so a POST is rejected.
+	release := kv.acquireWrite(httptest.NewRecorder())
+	if release == nil {
+		t.Fatalf("expected first write to get a slot\n")
+	}
+	keyreq := fmt.Sprintf("%snode/%s/limited/key/a", server.WebAPIPath, uuid)
+	req, err := http.NewRequest("POST", keyreq, strings.NewReader("value"))
+	if err != nil {
+		t.Fatalf("unsuccessful making request: %v\n", err)
+	}
+	w := httptest.NewRecorder()
+	server.ServeSingleHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 503 with Retry-After on overloaded write, got %d %v\n", w.Code, w.Header())
+	}
+	writes := []struct {
+		method, endpoint string
+	}{
+		{"POST", "keys/swap?a=a&b=b&missing=empty"},
+		{"POST", "keys/rename?from=a&to=b"},
+		{"DELETE", "keys/prefix/a"},
+		{"DELETE", "keyrange/a/z"},
+		{"DELETE", "key/a"},
+		{"POST", "key/a/touch"},
+	}
+	for _, write := range writes {
+		writereq := fmt.Sprintf("%snode/%s/limited/%s", server.WebAPIPath, uuid, write.endpoint)
+		if resp := server.TestHTTPResponse(t, write.method, writereq, nil); resp.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected 503 on overloaded %s %s, got %d\n", write.method, write.endpoint, resp.Code)
+		}
+	}
+
+	release()
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("value"))
+	if value := string(server.TestHTTP(t, "GET", keyreq, nil)); value != "value" {
+		t.Errorf("expected write after slot released, got %q\n", value)
+	}
+
+	// in block mode, a write waits for the slot instead.
+	kv.WriteOverload = WriteOverloadBlock
+	release = kv.acquireWrite(httptest.NewRecorder())
+	done := make(chan struct{})
+	go func() {
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader("blocked"))
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Errorf("expected write to block while slot is held\n")
+	case <-time.After(100 * time.Millisecond):
+	}
+	release()
+	<-done
+	if value := string(server.TestHTTP(t, "GET", keyreq, nil)); value != "blocked" {
+		t.Errorf("expected blocked write to complete, got %q\n", value)
+	}
+}
+
+func TestKeyvalueVersionBytes(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "growth", dvid.Config{})
+
+	for _, key := range []string{"a", "b"} {
+		keyreq := fmt.Sprintf("%snode/%s/growth/key/%s", server.WebAPIPath, uuid, key)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader("root value"))
+	}
+	if err := datastore.Commit(uuid, "root", nil); err != nil {
+		t.Fatalf("unable to commit root: %v\n", err)
+	}
+	uuid2, err := datastore.NewVersion(uuid, "child", "", nil)
+	if err != nil {
+		t.Fatalf("unable to create child version: %v\n", err)
+	}
+	keyreq := fmt.Sprintf("%snode/%s/growth/key/a", server.WebAPIPath, uuid2)
+	server.TestHTTP(t, "DELETE", keyreq, nil)
+	keyreq = fmt.Sprintf("%snode/%s/growth/key/c", server.WebAPIPath, uuid2)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("a much longer child value"))
+
+	kv, err := GetByUUIDName(uuid, "growth")
+	if err != nil {
+		t.Fatalf("can't get keyvalue instance: %v\n", err)
+	}
+	v2, err := datastore.VersionFromUUID(uuid2)
+	if err != nil {
+		t.Fatalf("can't get child version: %v\n", err)
+	}
+	report, err := kv.GetVersionBytes(v2)
+	if err != nil {
+		t.Fatalf("error getting version bytes: %v\n", err)
+	}
+	if len(report) != 2 || report[0].UUID != uuid || report[1].UUID != uuid2 {
+		t.Fatalf("expected root then child in report, got %v\n", report)
+	}
+	if report[0].Keys != 2 || report[0].Tombstones != 0 || report[0].Bytes == 0 {
+		t.Errorf("bad root version bytes: %v\n", report[0])
+	}
+	if report[1].Keys != 2 || report[1].Tombstones != 1 || report[1].Bytes == 0 {
+		t.Errorf("bad child version bytes: %v\n", report[1])
+	}
+}
+
+func TestKeyvalueVerifyKeys(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "verified", dvid.Config{})
+
+	for _, key := range []string{"a", "b"} {
+		keyreq := fmt.Sprintf("%snode/%s/verified/key/%s", server.WebAPIPath, uuid, key)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader("root value"))
+	}
+	if err := datastore.Commit(uuid, "root", nil); err != nil {
+		t.Fatalf("unable to commit root: %v\n", err)
+	}
+	uuid2, err := datastore.NewVersion(uuid, "child", "", nil)
+	if err != nil {
+		t.Fatalf("unable to create child version: %v\n", err)
+	}
+	keyreq := fmt.Sprintf("%snode/%s/verified/key/a", server.WebAPIPath, uuid2)
+	server.TestHTTP(t, "DELETE", keyreq, nil)
+	keyreq = fmt.Sprintf("%snode/%s/verified/key/c", server.WebAPIPath, uuid2)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("child value"))
+
+	kv, err := GetByUUIDName(uuid, "verified")
+	if err != nil {
+		t.Fatalf("can't get keyvalue instance: %v\n", err)
+	}
+	report, err := kv.VerifyKeys()
+	if err != nil {
+		t.Fatalf("error verifying keys: %v\n", err)
+	}
+	if report.Scanned != 4 || report.Decoded != 4 || report.Failed != 0 || len(report.Samples) != 0 {
+		t.Errorf("expected 4 keys decoded without failures, got %+v\n", report)
+	}
+
+	// write keys in a mismatched format directly to the store.
+	v2, err := datastore.VersionFromUUID(uuid2)
+	if err != nil {
+		t.Fatalf("can't get child version: %v\n", err)
+	}
+	db, err := datastore.GetOrderedKeyValueDB(kv)
+	if err != nil {
+		t.Fatalf("can't get store: %v\n", err)
+	}
+	ctx := datastore.NewVersionedCtx(kv, v2)
+	if err := db.Put(ctx, storage.NewTKey(keyStandard, []byte("unterminated")), []byte("x")); err != nil {
+		t.Fatalf("unable to put bad key: %v\n", err)
+	}
+	if err := db.Put(ctx, storage.NewTKey(99, []byte("unknown")), []byte("x")); err != nil {
+		t.Fatalf("unable to put bad key: %v\n", err)
+	}
+	if report, err = kv.VerifyKeys(); err != nil {
+		t.Fatalf("error verifying keys: %v\n", err)
+	}
+	if report.Scanned != 6 || report.Decoded != 4 || report.Failed != 2 || len(report.Samples) != 2 {
+		t.Fatalf("expected 2 failed keys, got %+v\n", report)
+	}
+	for _, failure := range report.Samples {
+		if failure.VersionID != v2 || failure.Key == "" || failure.Error == "" {
+			t.Errorf("bad key decode failure sample: %+v\n", failure)
+		}
+	}
+}
+
+func TestKeyvalueJSONSchema(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("JSONSchema", `{
+		"type": "object",
+		"required": ["owner"],
+		"properties": {
+			"owner": {
+				"type": "object",
+				"properties": {"name": {"type": "string", "minLength": 1}}
+			},
+			"status": {"enum": ["active", "retired"]},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+			"count": {"type": "integer", "minimum": 0}
+		},
+		"additionalProperties": false
+	}`)
+	server.CreateTestInstance(t, uuid, "keyvalue", "schema", config)
+
+	keyreq := fmt.Sprintf("%snode/%s/schema/key/a", server.WebAPIPath, uuid)
+	valid := `{"owner": {"name": "bob"}, "status": "active", "tags": ["x"], "count": 3}`
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader(valid))
+
+	tests := map[string]string{
+		`{"owner": {"name": 42}}`:                "/owner/name",
+		`{"status": "active"}`:                   "/",
+		`{"owner": {}, "status": "unknown"}`:     "/status",
+		`{"owner": {}, "tags": ["x", 2]}`:        "/tags/1",
+		`{"owner": {}, "tags": ["x", "y", "z"]}`: "/tags",
+		`{"owner": {}, "count": 1.5}`:            "/count",
+		`{"owner": {}, "count": -1}`:             "/count",
+		`{"owner": {}, "extra": true}`:           "/",
+		`not json`:                               "/",
+	}
+	for value, path := range tests {
+		req, err := http.NewRequest("POST", keyreq, strings.NewReader(value))
+		if err != nil {
+			t.Fatalf("unsuccessful making request: %v\n", err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeSingleHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected value %s to be rejected, got status %d\n", value, w.Code)
+			continue
+		}
+		if !strings.Contains(w.Body.String(), fmt.Sprintf("at %q", path)) {
+			t.Errorf("expected rejection of %s at path %q, got %s\n", value, path, w.Body.String())
+		}
+	}
+	if value := string(server.TestHTTP(t, "GET", keyreq, nil)); value != valid {
+		t.Errorf("rejected writes changed value to %s\n", value)
+	}
+
+	if _, err := parseJSONSchema(`{"type": "object", "pattern": "["}`); err == nil {
+		t.Errorf("expected error parsing schema with bad pattern\n")
+	}
+}
+
+func TestKeyvalueColdKeys(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("AccessInterval", "1h")
+	server.CreateTestInstance(t, uuid, "keyvalue", "tiered", config)
+
+	for _, key := range []string{"a", "b", "c"} {
+		keyreq := fmt.Sprintf("%snode/%s/tiered/key/%s", server.WebAPIPath, uuid, key)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader("value"))
+	}
+	before := time.Now()
+	keyreq := fmt.Sprintf("%snode/%s/tiered/key/b", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "GET", keyreq, nil)
+
+	kv, err := GetByUUIDName(uuid, "tiered")
+	if err != nil {
+		t.Fatalf("can't get keyvalue instance: %v\n", err)
+	}
+	v, err := datastore.VersionFromUUID(uuid)
+	if err != nil {
+		t.Fatalf("can't get version: %v\n", err)
+	}
+	ctx := datastore.NewVersionedCtx(kv, v)
+	cold, err := kv.GetColdKeys(ctx, before)
+	if err != nil {
+		t.Fatalf("error getting cold keys: %v\n", err)
+	}
+	if len(cold) != 2 || cold[0].Key != "a" || cold[1].Key != "c" || !cold[0].Accessed.IsZero() {
+		t.Errorf("expected unread keys a and c to be cold, got %v\n", cold)
+	}
+
+	coldreq := fmt.Sprintf("%snode/%s/tiered/coldkeys", server.WebAPIPath, uuid)
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", coldreq, nil), &cold); err != nil {
+		t.Fatalf("bad coldkeys response: %v\n", err)
+	}
+	if len(cold) != 3 || cold[2].Key != "b" || cold[2].Accessed.Before(before) {
+		t.Errorf("expected read key b to be listed last with its access time, got %v\n", cold)
+	}
+	server.TestBadHTTP(t, "GET", coldreq+"?age=bad", nil)
+
+	// deleted keys lose their access times.
+	server.TestHTTP(t, "DELETE", keyreq, nil)
+	tk := NewAccessedTKey("b")
+	db, err := datastore.GetOrderedKeyValueDB(kv)
+	if err != nil {
+		t.Fatalf("can't get store: %v\n", err)
+	}
+	if data, err := db.Get(ctx, tk); err != nil || data != nil {
+		t.Errorf("expected access time of deleted key to be removed, got %v, %v\n", data, err)
+	}
+
+	// so do keys deleted in transactions and by prefix.
+	for _, key := range []string{"a", "c"} {
+		keyreq := fmt.Sprintf("%snode/%s/tiered/key/%s", server.WebAPIPath, uuid, key)
+		server.TestHTTP(t, "GET", keyreq, nil)
+	}
+	txnreq := fmt.Sprintf("%snode/%s/tiered/txn", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", txnreq, strings.NewReader(`[{"Op": "delete", "Key": "a"}]`))
+	if _, err := kv.DeleteKeysWithPrefix(ctx, "c", false); err != nil {
+		t.Fatalf("error deleting prefix: %v\n", err)
+	}
+	for _, key := range []string{"a", "c"} {
+		if data, err := db.Get(ctx, NewAccessedTKey(key)); err != nil || data != nil {
+			t.Errorf("expected access time of deleted key %q to be removed, got %v, %v\n", key, data, err)
+		}
+	}
+}
+
+func TestKeyvalueTemplate(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("Templates", "stored")
+	server.CreateTestInstance(t, uuid, "keyvalue", "views", config)
+
+	keyreq := func(key string) string {
+		return fmt.Sprintf("%snode/%s/views/key/%s", server.WebAPIPath, uuid, key)
+	}
+	server.TestHTTP(t, "POST", keyreq("status"), strings.NewReader(`{"name": "<b>", "jobs": [1, 2]}`))
+	server.TestHTTP(t, "POST", keyreq("statusview"), strings.NewReader(`<p>{{.name}}: {{len .jobs}} jobs</p>`))
+	server.TestHTTP(t, "POST", keyreq("plain"), strings.NewReader("not json"))
+
+	req, err := http.NewRequest("GET", keyreq("status")+"?template=statusview", nil)
+	if err != nil {
+		t.Fatalf("unsuccessful making request: %v\n", err)
+	}
+	w := httptest.NewRecorder()
+	server.ServeSingleHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("bad rendered response: %d %v\n", w.Code, w.Header())
+	}
+	if w.Body.String() != "<p>&lt;b&gt;: 2 jobs</p>" {
+		t.Errorf("bad rendered value: %s\n", w.Body.String())
+	}
+
+	server.TestBadHTTP(t, "GET", keyreq("plain")+"?template=statusview", nil)
+	server.TestBadHTTP(t, "GET", keyreq("status")+"?template=missing", nil)
+	server.TestBadHTTP(t, "GET", keyreq("status")+"?templatetext="+url.QueryEscape("{{.name}}"), nil)
+
+	var buf bytes.Buffer
+	items := `{"a": [` + strings.Repeat("0,", 1999) + `0]}`
+	if err := RenderTemplate(&buf, `{{range .a}}`+strings.Repeat("x", 1000)+`{{end}}`, []byte(items)); err == nil {
+		t.Errorf("expected error rendering template with too much output\n")
+	}
+	// templates whose execution isn't bounded by the value are refused before running.
+	unbounded := []string{
+		`{{range .a}}{{range $.a}}{{range $.a}}{{end}}{{end}}{{end}}`,
+		`{{range 1000000000}}{{end}}`,
+		`{{define "loop"}}{{template "loop" .}}{{template "loop" .}}{{end}}{{template "loop" .}}`,
+	}
+	for _, text := range unbounded {
+		if err := RenderTemplate(&buf, text, []byte(items)); err == nil {
+			t.Errorf("expected template %q to be refused\n", text)
+		}
+	}
+	if err := RenderTemplate(&buf, `{{.name}}`, []byte(`{"name": "inline"}`)); err != nil || buf.String() != "inline" {
+		t.Errorf("bad inline render %q: %v\n", buf.String(), err)
+	}
+}
+
+func TestKeyvalueTransform(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "transforms", dvid.Config{})
+
+	keyreq := func(key string) string {
+		return fmt.Sprintf("%snode/%s/transforms/key/%s", server.WebAPIPath, uuid, key)
+	}
+	value := `{"name": "mito",   "ids": [1, 2]}`
+	server.TestHTTP(t, "POST", keyreq("doc"), strings.NewReader(value))
+	server.TestHTTP(t, "POST", keyreq("plain"), strings.NewReader("not json"))
+
+	get := func(key, transform string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", keyreq(key)+"?transform="+transform, nil)
+		if err != nil {
+			t.Fatalf("unsuccessful making request: %v\n", err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeSingleHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("bad %s transform response: %d %s\n", transform, w.Code, w.Body.String())
+		}
+		if w.Header().Get("ETag") != "" {
+			t.Errorf("expected no ETag on %s transformed value\n", transform)
+		}
+		return w
+	}
+
+	w := get("doc", "json-compact")
+	if w.Body.String() != `{"name":"mito","ids":[1,2]}` || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("bad compacted value %q: %v\n", w.Body.String(), w.Header())
+	}
+	w = get("doc", "json-pretty")
+	if w.Body.String() != "{\n  \"name\": \"mito\",\n  \"ids\": [\n    1,\n    2\n  ]\n}" {
+		t.Errorf("bad pretty-printed value %q\n", w.Body.String())
+	}
+	w = get("doc", "base64")
+	if w.Body.String() != base64.StdEncoding.EncodeToString([]byte(value)) {
+		t.Errorf("bad base64 value %q\n", w.Body.String())
+	}
+	w = get("doc", "gzip")
+	if w.Header().Get("Content-Type") != "application/gzip" {
+		t.Errorf("bad gzip content type: %v\n", w.Header())
+	}
+	gzipped := w.Body.Bytes()
+	zr, err := gzip.NewReader(bytes.NewReader(gzipped))
+	if err != nil {
+		t.Fatalf("gzip transform didn't return gzipped value: %v\n", err)
+	}
+	if unzipped, err := ioutil.ReadAll(zr); err != nil || string(unzipped) != value {
+		t.Errorf("bad gzipped value %q: %v\n", unzipped, err)
+	}
+
+	server.TestHTTP(t, "POST", keyreq("zipped"), bytes.NewReader(gzipped))
+	if w = get("zipped", "gunzip"); w.Body.String() != value {
+		t.Errorf("bad gunzipped value %q\n", w.Body.String())
+	}
+
+	server.TestBadHTTP(t, "GET", keyreq("doc")+"?transform=uppercase", nil)
+	server.TestBadHTTP(t, "GET", keyreq("plain")+"?transform=json-pretty", nil)
+	server.TestBadHTTP(t, "GET", keyreq("plain")+"?transform=gunzip", nil)
+}
+
+func TestKeyvalueAuditLog(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("AuditLog", "true")
+	server.CreateTestInstance(t, uuid, "keyvalue", "audited", config)
+	server.CreateTestInstance(t, uuid, "keyvalue", "unaudited", dvid.Config{})
+
+	keyreq := func(key string) string {
+		return fmt.Sprintf("%snode/%s/audited/key/%s", server.WebAPIPath, uuid, key)
+	}
+	start := time.Now()
+	server.TestHTTP(t, "POST", keyreq("a")+"?u=alice", strings.NewReader("hello"))
+	server.TestHTTP(t, "POST", keyreq("b")+"?u=alice", strings.NewReader("world!"))
+	txnreq := fmt.Sprintf("%snode/%s/audited/txn?u=carol", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", txnreq, strings.NewReader(`[{"Op": "put", "Key": "c", "Value": "AQID"}, {"Op": "delete", "Key": "b"}]`))
+	server.TestHTTP(t, "DELETE", keyreq("a")+"?u=bob", nil)
+
+	getAudit := func(query string) []AuditRecord {
+		auditreq := fmt.Sprintf("%snode/%s/audited/audit%s", server.WebAPIPath, uuid, query)
+		var records []AuditRecord
+		if err := json.Unmarshal(server.TestHTTP(t, "GET", auditreq, nil), &records); err != nil {
+			t.Fatalf("couldn't unmarshal audit records: %v\n", err)
+		}
+		return records
+	}
+	records := getAudit("")
+	expected := []AuditRecord{
+		{User: "alice", Op: "put", Key: "a", Bytes: 5},
+		{User: "alice", Op: "put", Key: "b", Bytes: 6},
+		{User: "carol", Op: "put", Key: "c", Bytes: 3},
+		{User: "carol", Op: "delete", Key: "b"},
+		{User: "bob", Op: "delete", Key: "a"},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d audit records, got %v\n", len(expected), records)
+	}
+	for i, rec := range records {
+		if rec.Time.Before(start.Add(-time.Second)) || rec.Time.After(time.Now()) {
+			t.Errorf("bad time for audit record %d: %v\n", i, rec)
+		}
+		rec.Time = time.Time{}
+		if rec != expected[i] {
+			t.Errorf("expected audit record %d to be %v, got %v\n", i, expected[i], rec)
+		}
+	}
+
+	if records = getAudit("?key=b"); len(records) != 2 || records[0].Op != "put" || records[1].Op != "delete" {
+		t.Errorf("bad audit records for key b: %v\n", records)
+	}
+	future := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+	if records = getAudit("?since=" + future); len(records) != 0 {
+		t.Errorf("expected no audit records since the future, got %v\n", records)
+	}
+	if records = getAudit("?until=" + future); len(records) != len(expected) {
+		t.Errorf("expected all audit records until the future, got %v\n", records)
+	}
+
+	server.TestBadHTTP(t, "GET", fmt.Sprintf("%snode/%s/audited/audit?since=yesterday", server.WebAPIPath, uuid), nil)
+	server.TestBadHTTP(t, "GET", fmt.Sprintf("%snode/%s/unaudited/audit", server.WebAPIPath, uuid), nil)
+}
+
+func TestKeyvalueApply(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "counters", dvid.Config{})
+
+	applyreq := func(key string) string {
+		return fmt.Sprintf("%snode/%s/counters/key/%s/apply", server.WebAPIPath, uuid, key)
+	}
+	keyreq := fmt.Sprintf("%snode/%s/counters/key/doc", server.WebAPIPath, uuid)
+
+	ops := `[{"Op": "append", "Path": "events", "Value": {"type": "start"}},
+		{"Op": "increment", "Path": "stats.count", "By": 2},
+		{"Op": "set", "Path": "owner", "Value": "alice"}]`
+	result := server.TestHTTP(t, "POST", applyreq("doc"), strings.NewReader(ops))
+	expected := `{"events":[{"type":"start"}],"owner":"alice","stats":{"count":2}}`
+	if string(result) != expected {
+		t.Errorf("expected apply result %s, got %s\n", expected, result)
+	}
+	if value := server.TestHTTP(t, "GET", keyreq, nil); string(value) != expected {
+		t.Errorf("expected stored value %s, got %s\n", expected, value)
+	}
+
+	// concurrent increments and appends shouldn't lose updates.
+	numApplies := 20
+	wg := new(sync.WaitGroup)
+	for i := 0; i < numApplies; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ops := fmt.Sprintf(`[{"Op": "increment", "Path": "stats.count"}, {"Op": "append", "Path": "events", "Value": %d}]`, i)
+			server.TestHTTP(t, "POST", applyreq("doc"), strings.NewReader(ops))
+		}(i)
+	}
+	wg.Wait()
+	var doc struct {
+		Events []interface{}
+		Stats  struct{ Count int }
+	}
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", keyreq, nil), &doc); err != nil {
+		t.Fatalf("couldn't unmarshal modified value: %v\n", err)
+	}
+	if doc.Stats.Count != 2+numApplies || len(doc.Events) != 1+numApplies {
+		t.Errorf("expected count %d and %d events after concurrent applies, got %v\n", 2+numApplies, 1+numApplies, doc)
+	}
+
+	// failed operations store nothing.
+	before := server.TestHTTP(t, "GET", keyreq, nil)
+	server.TestBadHTTP(t, "POST", applyreq("doc"), strings.NewReader(`[{"Op": "set", "Path": "x", "Value": 1}, {"Op": "append", "Path": "owner", "Value": 1}]`))
+	server.TestBadHTTP(t, "POST", applyreq("doc"), strings.NewReader(`[{"Op": "eval", "Path": "owner"}]`))
+	server.TestBadHTTP(t, "POST", applyreq("doc"), strings.NewReader(`[{"Op": "increment", "Path": "owner"}]`))
+	if after := server.TestHTTP(t, "GET", keyreq, nil); !bytes.Equal(before, after) {
+		t.Errorf("failed apply changed value from %s to %s\n", before, after)
+	}
+	tooMany := "[" + strings.Repeat(`{"Op": "increment"},`, MaxApplyOps) + `{"Op": "increment"}]`
+	server.TestBadHTTP(t, "POST", applyreq("count"), strings.NewReader(tooMany))
+
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/counters/key/plain", server.WebAPIPath, uuid), strings.NewReader("not json"))
+	server.TestBadHTTP(t, "POST", applyreq("plain"), strings.NewReader(`[{"Op": "increment"}]`))
+}
+
+func TestKeyvalueApplyCoalesced(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("CoalesceInterval", "1h")
+	server.CreateTestInstance(t, uuid, "keyvalue", "coalesced", config)
+
+	keyreq := fmt.Sprintf("%snode/%s/coalesced/key/doc", server.WebAPIPath, uuid)
+	applyreq := keyreq + "/apply"
+
+	// applies can't be atomic with buffered puts, so they're rejected rather than having
+	// their results overwritten by the next flush.
+	numOps := 20
+	wg := new(sync.WaitGroup)
+	for i := 0; i < numOps; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			server.TestHTTP(t, "POST", keyreq, strings.NewReader(fmt.Sprintf(`{"put":%d}`, i)))
+		}(i)
+		go func() {
+			defer wg.Done()
+			resp := server.TestHTTPResponse(t, "POST", applyreq, strings.NewReader(`[{"Op": "set", "Path": "applied", "Value": true}]`))
+			if resp.Code != http.StatusBadRequest {
+				t.Errorf("expected apply to coalesced instance to be rejected, got status %d\n", resp.Code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	kv, err := GetByUUIDName(uuid, "coalesced")
+	if err != nil {
+		t.Fatalf("unable to get keyvalue instance: %v\n", err)
+	}
+	kv.flushWrites()
+	var doc map[string]interface{}
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", keyreq, nil), &doc); err != nil {
+		t.Fatalf("couldn't unmarshal value: %v\n", err)
+	}
+	if _, found := doc["applied"]; found || len(doc) != 1 {
+		t.Errorf("expected only a put value after flush, got %v\n", doc)
+	}
+}
+
+func TestKeyvalueReadTier(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "tiered", dvid.Config{})
+
+	keyreq := fmt.Sprintf("%snode/%s/tiered/key/mykey", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("some data"))
+
+	returnValue := server.TestHTTP(t, "GET", keyreq+"?tier=primary", nil)
+	if string(returnValue) != "some data" {
+		t.Errorf("expected value %q from primary tier, got %q\n", "some data", returnValue)
+	}
+	missing := fmt.Sprintf("%snode/%s/tiered/key/missing?tier=primary", server.WebAPIPath, uuid)
+	req, err := http.NewRequest("GET", missing, nil)
+	if err != nil {
+		t.Fatalf("unsuccessful making request: %v\n", err)
+	}
+	w := httptest.NewRecorder()
+	server.ServeSingleHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for missing key read from primary tier, got %d\n", w.Code)
+	}
+
+	// the test store has no read fallback.
+	server.TestBadHTTP(t, "GET", keyreq+"?tier=fallback", nil)
+	server.TestBadHTTP(t, "GET", keyreq+"?tier=bogus", nil)
+}
+
+func TestKeyvalueRenamePrefix(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "renames", dvid.Config{})
+
+	keyreq := func(key string) string {
+		return fmt.Sprintf("%snode/%s/renames/key/%s", server.WebAPIPath, uuid, key)
+	}
+	req, err := http.NewRequest("POST", keyreq("v1/a"), strings.NewReader("A"))
+	if err != nil {
+		t.Fatalf("unsuccessful making request: %v\n", err)
+	}
+	req.Header.Set(KeyMetadataPrefix+"Owner", "alice")
+	w := httptest.NewRecorder()
+	server.ServeSingleHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("bad POST with metadata: %d %s\n", w.Code, w.Body.String())
+	}
+	server.TestHTTP(t, "POST", keyreq("v1/b"), strings.NewReader("B"))
+	server.TestHTTP(t, "POST", keyreq("v1/c"), strings.NewReader("C"))
+	server.TestHTTP(t, "POST", keyreq("v2/b"), strings.NewReader("old B"))
+	server.TestHTTP(t, "POST", keyreq("other"), strings.NewReader("X"))
+
+	renamereq := func(from, to, query string) string {
+		return fmt.Sprintf("%snode/%s/renames/keys/rename?from=%s&to=%s%s", server.WebAPIPath, uuid, from, to, query)
+	}
+	rename := func(from, to, query string) PrefixRenameResult {
+		var result PrefixRenameResult
+		if err := json.Unmarshal(server.TestHTTP(t, "POST", renamereq(from, to, query), nil), &result); err != nil {
+			t.Fatalf("couldn't decode rename response: %v\n", err)
+		}
+		return result
+	}
+
+	result := rename("v1/", "v2/", "&dryrun=true")
+	if !result.DryRun || result.Renamed != 3 || len(result.Renames) != 3 || len(result.Conflicts) != 1 || result.Conflicts[0] != "v2/b" {
+		t.Errorf("bad dry run result: %v\n", result)
+	}
+	if result.Renames[0].From != "v1/a" || result.Renames[0].To != "v2/a" {
+		t.Errorf("bad dry run rename: %v\n", result.Renames[0])
+	}
+	server.TestBadHTTP(t, "POST", renamereq("v1/", "v2/", ""), nil)
+	server.TestBadHTTP(t, "POST", renamereq("v1/", "v1/x", "&conflict=skip"), nil)
+	server.TestBadHTTP(t, "POST", renamereq("v1/", "v2/", "&conflict=bogus"), nil)
+	if value := server.TestHTTP(t, "GET", keyreq("v1/a"), nil); string(value) != "A" {
+		t.Errorf("expected failed rename to leave key, got %q\n", value)
+	}
+
+	result = rename("v1/", "v2/", "&conflict=skip")
+	if result.DryRun || result.Renamed != 2 || result.Skipped != 1 || len(result.Renames) != 0 {
+		t.Errorf("bad rename result: %v\n", result)
+	}
+	req, err = http.NewRequest("GET", keyreq("v2/a"), nil)
+	if err != nil {
+		t.Fatalf("unsuccessful making request: %v\n", err)
+	}
+	w = httptest.NewRecorder()
+	server.ServeSingleHTTP(w, req)
+	if w.Body.String() != "A" || w.Header().Get(KeyMetadataPrefix+"Owner") != "alice" {
+		t.Errorf("expected renamed key with metadata, got %q: %v\n", w.Body.String(), w.Header())
+	}
+	server.TestBadHTTP(t, "GET", keyreq("v1/a"), nil)
+	if value := server.TestHTTP(t, "GET", keyreq("v2/b"), nil); string(value) != "old B" {
+		t.Errorf("expected skipped destination to be unchanged, got %q\n", value)
+	}
+	if value := server.TestHTTP(t, "GET", keyreq("v1/b"), nil); string(value) != "B" {
+		t.Errorf("expected skipped source to be unchanged, got %q\n", value)
+	}
+
+	result = rename("v1/", "v2/", "&conflict=overwrite")
+	if result.Renamed != 1 || len(result.Conflicts) != 1 {
+		t.Errorf("bad overwriting rename result: %v\n", result)
+	}
+	if value := server.TestHTTP(t, "GET", keyreq("v2/b"), nil); string(value) != "B" {
+		t.Errorf("expected overwritten destination, got %q\n", value)
+	}
+	if value := server.TestHTTP(t, "GET", keyreq("other"), nil); string(value) != "X" {
+		t.Errorf("expected key outside prefix to be unchanged, got %q\n", value)
+	}
+}
+
+func TestKeyvalueKeyrangeStep(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "sampled", dvid.Config{})
+
+	for i := 0; i < 10; i++ {
+		keyreq := fmt.Sprintf("%snode/%s/sampled/key/k%d", server.WebAPIPath, uuid, i)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader("value"))
+	}
+	rangereq := fmt.Sprintf("%snode/%s/sampled/keyrange/k1/k9", server.WebAPIPath, uuid)
+	var keys []string
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", rangereq+"?step=3", nil), &keys); err != nil {
+		t.Fatalf("couldn't decode sampled keys: %v\n", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"k1", "k4", "k7"}) {
+		t.Errorf("expected every third key, got %v\n", keys)
+	}
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", rangereq+"?step=1", nil), &keys); err != nil {
+		t.Fatalf("couldn't decode sampled keys: %v\n", err)
+	}
+	if len(keys) != 9 {
+		t.Errorf("expected all 9 keys with step 1, got %v\n", keys)
+	}
+	server.TestBadHTTP(t, "GET", rangereq+"?step=0", nil)
+	server.TestBadHTTP(t, "GET", rangereq+"?step=many", nil)
+}
+
+func TestKeyvaluePauseWrites(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "paused", dvid.Config{})
+	keyreq := fmt.Sprintf("%snode/%s/paused/key/a", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("before"))
+
+	pausereq := fmt.Sprintf("%snode/%s/paused/pause", server.WebAPIPath, uuid)
+	if resp := string(server.TestHTTP(t, "POST", pausereq, nil)); resp != `{"Paused": true}` {
+		t.Errorf("unexpected pause response: %s\n", resp)
+	}
+	req, err := http.NewRequest("POST", keyreq, strings.NewReader("during"))
+	if err != nil {
+		t.Fatalf("unsuccessful making request: %v\n", err)
+	}
+	w := httptest.NewRecorder()
+	server.ServeSingleHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 503 with Retry-After on paused write, got %d %v\n", w.Code, w.Header())
+	}
+	if value := string(server.TestHTTP(t, "GET", keyreq, nil)); value != "before" {
+		t.Errorf("expected reads while paused, got %q\n", value)
+	}
+	inforeq := fmt.Sprintf("%snode/%s/paused/info", server.WebAPIPath, uuid)
+	var info struct {
+		Base struct {
+			Paused bool
+		}
+	}
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", inforeq, nil), &info); err != nil {
+		t.Fatalf("can't decode info: %v\n", err)
+	}
+	if !info.Base.Paused {
+		t.Errorf("expected info to show instance paused\n")
+	}
+
+	resumereq := fmt.Sprintf("%snode/%s/paused/resume", server.WebAPIPath, uuid)
+	if resp := string(server.TestHTTP(t, "POST", resumereq, nil)); resp != `{"Paused": false}` {
+		t.Errorf("unexpected resume response: %s\n", resp)
+	}
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("after"))
+	if value := string(server.TestHTTP(t, "GET", keyreq, nil)); value != "after" {
+		t.Errorf("expected write after resume, got %q\n", value)
+	}
+}
+
+func TestKeyvalueChecksumMinSize(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, versionID := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("Compression", "none")
+	config.Set("Checksum", "crc32")
+	config.Set("ChecksumMinSize", "100")
+	server.CreateTestInstance(t, uuid, "keyvalue", "checksummed", config)
+	kv, err := GetByUUIDName(uuid, "checksummed")
+	if err != nil {
+		t.Fatalf("unable to get keyvalue instance: %v\n", err)
+	}
+	db, err := datastore.GetOrderedKeyValueDB(kv)
+	if err != nil {
+		t.Fatalf("unable to get store: %v\n", err)
+	}
+	ctx := datastore.NewVersionedCtx(kv, versionID)
+
+	values := map[string]string{
+		"small": "tiny",
+		"large": strings.Repeat("x", 100),
+	}
+	for keyStr, value := range values {
+		keyreq := fmt.Sprintf("%snode/%s/checksummed/key/%s", server.WebAPIPath, uuid, keyStr)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader(value))
+		if got := string(server.TestHTTP(t, "GET", keyreq, nil)); got != value {
+			t.Errorf("expected key %q value %q, got %q\n", keyStr, value, got)
+		}
+
+		tk, _ := NewTKey(keyStr)
+		data, err := db.Get(ctx, tk)
+		if err != nil {
+			t.Fatalf("unable to get stored value: %v\n", err)
+		}
+		_, checksum := dvid.DecodeSerializationFormat(dvid.SerializationFormat(data[0]))
+		var expected dvid.Checksum = dvid.CRC32
+		if keyStr == "small" {
+			expected = dvid.NoChecksum
+		}
+		if checksum != expected {
+			t.Errorf("expected key %q stored with checksum %s, got %s\n", keyStr, expected, checksum)
+		}
+
+		// a corrupted value is only detected if it was stored with a checksum.
+		data[len(data)-1] ^= 0xff
+		_, _, err = dvid.DeserializeData(data, true)
+		if keyStr == "large" && err == nil {
+			t.Errorf("expected checksum error on corrupted large value\n")
+		} else if keyStr == "small" && err != nil {
+			t.Errorf("expected no checksum verification of small value, got %v\n", err)
+		}
+	}
+
+	var info struct {
+		Base struct {
+			ChecksumMinSize uint64
+		}
+	}
+	inforeq := fmt.Sprintf("%snode/%s/checksummed/info", server.WebAPIPath, uuid)
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", inforeq, nil), &info); err != nil {
+		t.Fatalf("can't decode info: %v\n", err)
+	}
+	if info.Base.ChecksumMinSize != 100 {
+		t.Errorf("expected ChecksumMinSize 100 in info, got %d\n", info.Base.ChecksumMinSize)
+	}
+}
+
+func TestKeyvalueRangeFilter(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "filtered", dvid.Config{})
+
+	values := map[string]string{
+		"a": `{"status": "done", "meta": {"count": 3}}`,
+		"b": `{"status": "pending", "meta": {"count": 4}}`,
+		"c": `{"status": "done", "meta": {"count": 4}}`,
+		"d": "not json at all, but quite long",
+		"e": "x",
+	}
+	for key, value := range values {
+		keyreq := fmt.Sprintf("%snode/%s/filtered/key/%s", server.WebAPIPath, uuid, key)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader(value))
+	}
+
+	tests := map[string][]string{
+		"jsonfield=status&jsonvalue=done":                  {"a", "c"},
+		"jsonfield=status&jsonvalue=%22done%22":            {"a", "c"},
+		"jsonfield=meta.count&jsonvalue=4":                 {"b", "c"},
+		"jsonfield=meta.count&jsonvalue=4&valueprefix=%7B": {"b", "c"},
+		"valueprefix=not":                                  {"d"},
+		"maxsize=1":                                        {"e"},
+		"minsize=2&maxsize=40":                             {"a", "c", "d"},
+		"jsonfield=meta.count&jsonvalue=4&maxbytes=1":      {"b"},
+	}
+	for query, expected := range tests {
+		rangereq := fmt.Sprintf("%snode/%s/filtered/keyrangevalues/a/z?%s", server.WebAPIPath, uuid, query)
+		var kvs KeyValues
+		if err := kvs.Unmarshal(server.TestHTTP(t, "GET", rangereq, nil)); err != nil {
+			t.Fatalf("unable to unmarshal keyrangevalues protobuf: %v\n", err)
+		}
+		var keys []string
+		for _, kv := range kvs.Kvs {
+			if string(kv.Value) != values[kv.Key] {
+				t.Errorf("query %q: bad value for key %q: %q\n", query, kv.Key, string(kv.Value))
+			}
+			keys = append(keys, kv.Key)
+		}
+		if strings.Join(keys, ",") != strings.Join(expected, ",") {
+			t.Errorf("query %q: expected keys %v, got %v\n", query, expected, keys)
+		}
+	}
+
+	// paging with a filter continues after the last scanned key.
+	rangereq := fmt.Sprintf("%snode/%s/filtered/keyrangevalues/a/z?jsonfield=meta.count&jsonvalue=4&maxbytes=1", server.WebAPIPath, uuid)
+	req, err := http.NewRequest("GET", rangereq, nil)
+	if err != nil {
+		t.Fatalf("unsuccessful making request: %v\n", err)
+	}
+	w := httptest.NewRecorder()
+	server.ServeSingleHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("X-Next-Key") != "c" {
+		t.Errorf("expected next key \"c\" on filtered page, got %d %v\n", w.Code, w.Header())
+	}
+
+	badreq := fmt.Sprintf("%snode/%s/filtered/keyrangevalues/a/z?jsonvalue=4", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", badreq, nil)
+	badreq = fmt.Sprintf("%snode/%s/filtered/keyrangevalues/a/z?minsize=-1", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", badreq, nil)
+}
+
+func TestKeyvalueStoreAlias(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("StoreAlias", "metadata")
+	server.CreateTestInstance(t, uuid, "keyvalue", "indexed", config)
+	kv, err := GetByUUIDName(uuid, "indexed")
+	if err != nil {
+		t.Fatalf("unable to get keyvalue instance: %v\n", err)
+	}
+	if kv.StoreAlias() != "metadata" {
+		t.Errorf("expected StoreAlias %q, got %q\n", "metadata", kv.StoreAlias())
+	}
+	store, err := kv.KVStore()
+	if err != nil {
+		t.Fatalf("unable to get store: %v\n", err)
+	}
+	metadata, err := storage.MetaDataKVStore()
+	if err != nil {
+		t.Fatalf("unable to get metadata store: %v\n", err)
+	}
+	if store != metadata {
+		t.Errorf("expected instance backed by metadata store %s, got %s\n", metadata, store)
+	}
+
+	keyreq := fmt.Sprintf("%snode/%s/indexed/key/a", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("value"))
+	if value := string(server.TestHTTP(t, "GET", keyreq, nil)); value != "value" {
+		t.Errorf("expected value from aliased store, got %q\n", value)
+	}
+
+	var info struct {
+		Base struct {
+			StoreAlias string
+		}
+	}
+	inforeq := fmt.Sprintf("%snode/%s/indexed/info", server.WebAPIPath, uuid)
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", inforeq, nil), &info); err != nil {
+		t.Fatalf("can't decode info: %v\n", err)
+	}
+	if info.Base.StoreAlias != "metadata" {
+		t.Errorf("expected StoreAlias in info, got %q\n", info.Base.StoreAlias)
+	}
+
+	config = dvid.NewConfig()
+	config.Set("StoreAlias", "default")
+	if err := kv.ModifyConfig(config); err == nil {
+		t.Errorf("expected error changing StoreAlias after creation\n")
+	}
+
+	config = dvid.NewConfig()
+	config.Set("StoreAlias", "no-such-store")
+	if _, err := datastore.NewData(uuid, kvtype, "badstore", config); err == nil {
+		t.Errorf("expected error creating instance with unknown store alias\n")
+	}
+}
+
+func TestKeyvalueCompare(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "reviewed", dvid.Config{})
+
+	keyreq := fmt.Sprintf("%snode/%s/reviewed/key/doc", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("{\n  \"status\": \"pending\"\n}\n"))
+	if err := datastore.Commit(uuid, "root", nil); err != nil {
+		t.Fatalf("unable to commit root: %v\n", err)
+	}
+	uuid2, err := datastore.NewVersion(uuid, "child", "", nil)
+	if err != nil {
+		t.Fatalf("unable to create child version: %v\n", err)
+	}
+	keyreq2 := fmt.Sprintf("%snode/%s/reviewed/key/", server.WebAPIPath, uuid2)
+	server.TestHTTP(t, "POST", keyreq2+"doc", strings.NewReader("{\n  \"status\": \"done\"\n}\n"))
+	server.TestHTTP(t, "POST", keyreq2+"bin1", bytes.NewReader([]byte{0, 1, 2, 3}))
+	server.TestHTTP(t, "POST", keyreq2+"bin2", bytes.NewReader([]byte{0, 1, 5, 3}))
+
+	comparereq := fmt.Sprintf("%snode/%s/reviewed/compare", server.WebAPIPath, uuid2)
+	diff := string(server.TestHTTP(t, "GET", comparereq+"?a=doc&aversion="+string(uuid), nil))
+	expected := fmt.Sprintf("--- doc@%s\n+++ doc@%s\n@@ -1,3 +1,3 @@\n {\n-  \"status\": \"pending\"\n+  \"status\": \"done\"\n }\n", uuid, uuid2)
+	if diff != expected {
+		t.Errorf("expected version diff:\n%s\ngot:\n%s\n", expected, diff)
+	}
+	if diff := string(server.TestHTTP(t, "GET", comparereq+"?a=doc&b=doc", nil)); diff != "" {
+		t.Errorf("expected no diff of identical values, got %q\n", diff)
+	}
+	diff = string(server.TestHTTP(t, "GET", comparereq+"?a=bin1&b=bin2", nil))
+	expected = fmt.Sprintf("Binary values bin1@%s and bin2@%s differ at offset 2 (4 and 4 bytes)\n", uuid2, uuid2)
+	if diff != expected {
+		t.Errorf("expected binary summary %q, got %q\n", expected, diff)
+	}
+	diff = string(server.TestHTTP(t, "GET", comparereq+"?a=missing&b=doc", nil))
+	if !strings.HasPrefix(diff, "--- /dev/null\n+++ doc@") || !strings.Contains(diff, "@@ -0,0 +1,3 @@") {
+		t.Errorf("expected diff against /dev/null for missing key, got:\n%s\n", diff)
+	}
+
+	server.TestBadHTTP(t, "GET", comparereq+"?a=missing&b=alsomissing", nil)
+	server.TestBadHTTP(t, "GET", comparereq+"?b=doc", nil)
+	server.TestBadHTTP(t, "GET", comparereq+"?a=doc&bversion=notaversion", nil)
+}
+
+func TestKeyvalueDuplicates(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "duptest", dvid.Config{})
+
+	shared := bytes.Repeat([]byte("shared"), 100)
+	keyreq := fmt.Sprintf("%snode/%s/duptest/key/", server.WebAPIPath, uuid)
+	for _, key := range []string{"c", "a", "b"} {
+		server.TestHTTP(t, "POST", keyreq+key, bytes.NewReader(shared))
+	}
+	server.TestHTTP(t, "POST", keyreq+"unique", strings.NewReader("only once"))
+	server.TestHTTP(t, "POST", keyreq+"empty1", nil)
+	server.TestHTTP(t, "POST", keyreq+"empty2", nil)
+
+	// two keys referencing one deduplicated payload and a third storing the same value.
+	deduped := bytes.Repeat([]byte("deduped"), 50)
+	kvs := KeyValues{Kvs: []*KeyValue{{Key: "ref1", Value: deduped}, {Key: "ref2", Value: deduped}}}
+	serialization, err := kvs.Marshal()
+	if err != nil {
+		t.Fatalf("unable to serialize KeyValues: %v\n", err)
+	}
+	ingestreq := fmt.Sprintf("%snode/%s/duptest/keyvalues?dedup=true", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", ingestreq, bytes.NewBuffer(serialization))
+	server.TestHTTP(t, "POST", keyreq+"plain", bytes.NewReader(deduped))
+
+	dupreq := fmt.Sprintf("%snode/%s/duptest/duplicates", server.WebAPIPath, uuid)
+	var report DuplicateReport
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", dupreq, nil), &report); err != nil {
+		t.Fatalf("unable to unmarshal duplicates report: %v\n", err)
+	}
+	if report.Values != 7 || report.DuplicateGroups != 2 || report.DuplicateKeys != 6 {
+		t.Fatalf("expected 7 values with 2 groups of 6 keys, got %+v\n", report)
+	}
+	groupKeys := map[string]DuplicateGroup{}
+	for _, grp := range report.Groups {
+		groupKeys[strings.Join(grp.Keys, ",")] = grp
+	}
+	grp, found := groupKeys["a,b,c"]
+	if !found || grp.Count != 3 || grp.ReclaimableBytes != 2*grp.Size {
+		t.Errorf("bad duplicate group for shared value: %+v\n", report.Groups)
+	}
+	grp, found = groupKeys["plain,ref1,ref2"]
+	if !found || grp.Count != 3 || grp.ReclaimableBytes != grp.Size {
+		t.Errorf("bad duplicate group for deduplicated value: %+v\n", report.Groups)
+	}
+	if report.ReclaimableBytes != report.Groups[0].ReclaimableBytes+report.Groups[1].ReclaimableBytes {
+		t.Errorf("bad total reclaimable bytes: %+v\n", report)
+	}
+
+	// spilling to temporary files should give the same report.
+	oldMemRecords := duplicateScanMemRecords
+	duplicateScanMemRecords = 2
+	defer func() { duplicateScanMemRecords = oldMemRecords }()
+	var spilled DuplicateReport
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", dupreq, nil), &spilled); err != nil {
+		t.Fatalf("unable to unmarshal duplicates report: %v\n", err)
+	}
+	if !reflect.DeepEqual(report, spilled) {
+		t.Errorf("expected spilled scan report %+v, got %+v\n", report, spilled)
+	}
+
+	var limited DuplicateReport
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", dupreq+"?groups=1", nil), &limited); err != nil {
+		t.Fatalf("unable to unmarshal duplicates report: %v\n", err)
+	}
+	if len(limited.Groups) != 1 || limited.DuplicateGroups != 2 || !reflect.DeepEqual(limited.Groups[0], report.Groups[0]) {
+		t.Errorf("expected only the largest group with groups=1, got %+v\n", limited)
+	}
+	server.TestBadHTTP(t, "GET", dupreq+"?groups=x", nil)
+}
+
+func TestKeyvalueCompressionLevel(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, versionID := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("Compression", "gzip")
+	server.CreateTestInstance(t, uuid, "keyvalue", "gzipped", config)
+	kv, err := GetByUUIDName(uuid, "gzipped")
+	if err != nil {
+		t.Fatalf("unable to get keyvalue instance: %v\n", err)
+	}
+	db, err := datastore.GetOrderedKeyValueDB(kv)
+	if err != nil {
+		t.Fatalf("unable to get store: %v\n", err)
+	}
+	ctx := datastore.NewVersionedCtx(kv, versionID)
+
+	var value bytes.Buffer
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&value, "segment %d merged into %d\n", i*7919%1000, i*104729%100)
+	}
+	keyreq := fmt.Sprintf("%snode/%s/gzipped/key/", server.WebAPIPath, uuid)
+	stored := make(map[string]int)
+	for _, level := range []string{"1", "9"} {
+		server.TestHTTP(t, "POST", keyreq+"level"+level+"?level="+level, bytes.NewReader(value.Bytes()))
+		if got := server.TestHTTP(t, "GET", keyreq+"level"+level, nil); !bytes.Equal(got, value.Bytes()) {
+			t.Errorf("bad value read back after POST at level %s\n", level)
+		}
+		tk, _ := NewTKey("level" + level)
+		data, err := db.Get(ctx, tk)
+		if err != nil {
+			t.Fatalf("unable to get stored value: %v\n", err)
+		}
+		stored[level] = len(data)
+	}
+	if stored["9"] >= stored["1"] {
+		t.Errorf("expected level 9 to store fewer bytes than level 1, got %d and %d\n", stored["9"], stored["1"])
+	}
+
+	for _, query := range []string{"?level=0", "?level=10", "?level=300", "?level=fast", "?raw=true&level=5"} {
+		server.TestBadHTTP(t, "POST", keyreq+"bad"+query, strings.NewReader("value"))
+	}
+	server.CreateTestInstance(t, uuid, "keyvalue", "lz4ed", dvid.Config{})
+	lz4req := fmt.Sprintf("%snode/%s/lz4ed/key/mykey?level=5", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", lz4req, strings.NewReader("value"))
+}
+
+func TestKeyvalueRawSerialization(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, versionID := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("Checksum", "crc32")
+	server.CreateTestInstance(t, uuid, "keyvalue", "source", config)
+	server.CreateTestInstance(t, uuid, "keyvalue", "replica", config)
+	kv, err := GetByUUIDName(uuid, "source")
+	if err != nil {
+		t.Fatalf("unable to get keyvalue instance: %v\n", err)
+	}
+	db, err := datastore.GetOrderedKeyValueDB(kv)
+	if err != nil {
+		t.Fatalf("unable to get store: %v\n", err)
+	}
+
+	value := bytes.Repeat([]byte("replicate me "), 100)
+	keyreq := fmt.Sprintf("%snode/%s/source/key/mykey", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, bytes.NewReader(value))
+	serialization := server.TestHTTP(t, "GET", keyreq+"/raw", nil)
+	tk, _ := NewTKey("mykey")
+	stored, err := db.Get(datastore.NewVersionedCtx(kv, versionID), tk)
+	if err != nil {
+		t.Fatalf("unable to get stored value: %v\n", err)
+	}
+	if !bytes.Equal(serialization, stored) {
+		t.Errorf("expected raw GET to return the %d stored bytes, got %d bytes\n", len(stored), len(serialization))
+	}
+	if bytes.Equal(serialization, value) {
+		t.Errorf("expected raw GET to return the serialization, not the value\n")
+	}
+
+	replicareq := fmt.Sprintf("%snode/%s/replica/key/mykey", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", replicareq+"/raw", bytes.NewReader(serialization))
+	if got := server.TestHTTP(t, "GET", replicareq, nil); !bytes.Equal(got, value) {
+		t.Errorf("bad value after raw POST: got %d bytes, expected %d\n", len(got), len(value))
+	}
+	if got := server.TestHTTP(t, "GET", replicareq+"/raw", nil); !bytes.Equal(got, serialization) {
+		t.Errorf("expected raw POST to store serialization as is\n")
+	}
+
+	corrupted := append([]byte{}, serialization...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	server.TestBadHTTP(t, "POST", replicareq+"/raw", bytes.NewReader(corrupted))
+	server.TestBadHTTP(t, "POST", replicareq+"/raw", bytes.NewReader(encodeDedupRef(make([]byte, sha256.Size))))
+	server.TestBadHTTP(t, "GET", fmt.Sprintf("%snode/%s/source/key/missing/raw", server.WebAPIPath, uuid), nil)
+	server.TestBadHTTP(t, "DELETE", keyreq+"/raw", nil)
+}
+
+func TestKeyvalueKeyCounts(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "namespaces", dvid.Config{})
+
+	var kvs KeyValues
+	for _, key := range []string{"a.txt", "img/1.png", "img/2.png", "img/raw/3.tif", "docs/x.md"} {
+		kvs.Kvs = append(kvs.Kvs, &KeyValue{Key: key, Value: []byte(key)})
+	}
+	serialization, err := kvs.Marshal()
+	if err != nil {
+		t.Fatalf("unable to serialize KeyValues: %v\n", err)
+	}
+	ingestreq := fmt.Sprintf("%snode/%s/namespaces/keyvalues", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", ingestreq, bytes.NewBuffer(serialization))
+
+	countsreq := fmt.Sprintf("%snode/%s/namespaces/keys/counts", server.WebAPIPath, uuid)
+	var counts PrefixCounts
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", countsreq+"?delimiter=/", nil), &counts); err != nil {
+		t.Fatalf("unable to unmarshal prefix counts: %v\n", err)
+	}
+	expected := PrefixCounts{
+		Prefixes:   []PrefixCount{{Prefix: "docs/", Count: 1}, {Prefix: "img/", Count: 3}},
+		Unprefixed: 1,
+		Total:      5,
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expected prefix counts %+v, got %+v\n", expected, counts)
+	}
+
+	counts = PrefixCounts{}
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", countsreq+"?delimiter=.&begin=b&end=img/2.png", nil), &counts); err != nil {
+		t.Fatalf("unable to unmarshal prefix counts: %v\n", err)
+	}
+	expected = PrefixCounts{
+		Prefixes:   []PrefixCount{{Prefix: "docs/x.", Count: 1}, {Prefix: "img/1.", Count: 1}, {Prefix: "img/2.", Count: 1}},
+		Unprefixed: 0,
+		Total:      3,
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expected prefix counts in range %+v, got %+v\n", expected, counts)
+	}
+	server.TestBadHTTP(t, "GET", countsreq, nil)
+}
+
+func TestKeyvalueCreateIfAbsent(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "locks", dvid.Config{})
+
+	// of concurrent creates, exactly one should win.
+	keyreq := fmt.Sprintf("%snode/%s/locks/key/leader", server.WebAPIPath, uuid)
+	const contenders = 20
+	codes := make(chan int, contenders)
+	var wg sync.WaitGroup
+	for i := 0; i < contenders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req, err := http.NewRequest("POST", keyreq+"?ifabsent=true", strings.NewReader(fmt.Sprintf("node%d", i)))
+			if err != nil {
+				t.Errorf("unable to create request: %v\n", err)
+				return
+			}
+			w := httptest.NewRecorder()
+			server.ServeSingleHTTP(w, req)
+			codes <- w.Code
+		}(i)
+	}
+	wg.Wait()
+	close(codes)
+	var won, conflicts int
+	for code := range codes {
+		switch code {
+		case http.StatusOK:
+			won++
+		case http.StatusConflict:
+			conflicts++
+		default:
+			t.Errorf("unexpected status code %d for create-only POST\n", code)
+		}
+	}
+	if won != 1 || conflicts != contenders-1 {
+		t.Errorf("expected 1 winning create and %d conflicts, got %d and %d\n", contenders-1, won, conflicts)
+	}
+	winner := string(server.TestHTTP(t, "GET", keyreq, nil))
+	if !strings.HasPrefix(winner, "node") {
+		t.Errorf("expected value of winning create, got %q\n", winner)
+	}
+
+	// the key can be recreated once deleted, and plain POSTs still overwrite.
+	server.TestHTTP(t, "DELETE", keyreq, nil)
+	server.TestHTTP(t, "POST", keyreq+"?ifabsent=true", strings.NewReader("again"))
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("overwrite"))
+	if value := string(server.TestHTTP(t, "GET", keyreq, nil)); value != "overwrite" {
+		t.Errorf("expected overwritten value, got %q\n", value)
+	}
+	server.TestBadHTTP(t, "POST", keyreq+"?ifabsent=true&raw=true", strings.NewReader("raw"))
+}
+
+func TestKeyvalueMaxListKeys(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "capped", dvid.Config{})
+	keyreq := fmt.Sprintf("%snode/%s/capped/key/", server.WebAPIPath, uuid)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		server.TestHTTP(t, "POST", keyreq+key, strings.NewReader(key))
+	}
+
+	oldMax := server.MaxListKeys
+	if oldMax != server.DefaultMaxListKeys {
+		t.Errorf("expected default key listing limit %d, got %d\n", server.DefaultMaxListKeys, oldMax)
+	}
+	server.MaxListKeys = 3
+	defer func() { server.MaxListKeys = oldMax }()
+
+	keysreq := fmt.Sprintf("%snode/%s/capped/keys", server.WebAPIPath, uuid)
+	resp := server.TestHTTPResponse(t, "GET", keysreq, nil)
+	if body := resp.Body.String(); body != `["a","b","c"]` {
+		t.Errorf("expected capped key listing, got %s\n", body)
+	}
+	if resp.Header().Get("X-Truncated") != "true" || resp.Header().Get("X-Truncated-Reason") != TruncatedKeyLimit {
+		t.Errorf("expected truncation headers, got %v\n", resp.Header())
+	}
+	next := resp.Header().Get("X-Next-Key")
+	if next != "d" {
+		t.Fatalf("expected next key \"d\", got %q\n", next)
+	}
+	rangereq := fmt.Sprintf("%snode/%s/capped/keyrange/%s/z", server.WebAPIPath, uuid, next)
+	resp = server.TestHTTPResponse(t, "GET", rangereq, nil)
+	if body := resp.Body.String(); body != `["d"]` || resp.Header().Get("X-Truncated") != "" {
+		t.Errorf("expected rest of listing without truncation, got %s (%v)\n", body, resp.Header())
+	}
+
+	samplereq := fmt.Sprintf("%snode/%s/capped/keyrange/a/z?step=1", server.WebAPIPath, uuid)
+	resp = server.TestHTTPResponse(t, "GET", samplereq, nil)
+	if body := resp.Body.String(); body != `["a","b","c"]` || resp.Header().Get("X-Next-Key") != "d" {
+		t.Errorf("expected capped sampled listing, got %s (%v)\n", body, resp.Header())
+	}
+}
+
+func TestKeyvalueKeyMetadata(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, versionID := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "files", dvid.Config{})
+
+	keyreq := fmt.Sprintf("%snode/%s/files/key/report", server.WebAPIPath, uuid)
+	post := func(body string, header map[string]string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", keyreq, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("unable to create request: %v\n", err)
+		}
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		server.ServeSingleHTTP(w, req)
+		return w
+	}
+	getMeta := func() map[string]string {
+		var meta map[string]string
+		if err := json.Unmarshal(server.TestHTTP(t, "GET", keyreq+"/meta", nil), &meta); err != nil {
+			t.Fatalf("bad metadata JSON: %v\n", err)
+		}
+		return meta
+	}
+
+	if w := post("v1", nil); w.Code != http.StatusOK {
+		t.Fatalf("POST without metadata returned status %d\n", w.Code)
+	}
+	if meta := getMeta(); len(meta) != 0 {
+		t.Errorf("expected no metadata, got %v\n", meta)
+	}
+
+	w := post("v2", map[string]string{"X-DVID-Meta-Source": "segmentation-v2", "X-Dvid-Meta-owner": "flyem"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST with metadata returned status %d\n", w.Code)
+	}
+	expected := map[string]string{"Source": "segmentation-v2", "Owner": "flyem"}
+	if meta := getMeta(); !reflect.DeepEqual(meta, expected) {
+		t.Errorf("expected metadata %v, got %v\n", expected, meta)
+	}
+	req, _ := http.NewRequest("GET", keyreq, nil)
+	w = httptest.NewRecorder()
+	server.ServeSingleHTTP(w, req)
+	if w.Body.String() != "v2" {
+		t.Errorf("expected value \"v2\", got %q\n", w.Body.String())
+	}
+	if got := w.Header().Get("X-DVID-Meta-Source"); got != "segmentation-v2" {
+		t.Errorf("expected echoed Source metadata, got %q\n", got)
+	}
+	if got := w.Header().Get("X-DVID-Meta-Owner"); got != "flyem" {
+		t.Errorf("expected echoed Owner metadata, got %q\n", got)
+	}
+
+	// a POST without metadata removes it while one with metadata replaces it.
+	post("v3", nil)
+	if meta := getMeta(); len(meta) != 0 {
+		t.Errorf("expected metadata removed, got %v\n", meta)
+	}
+	post("v4", map[string]string{"X-DVID-Meta-Stage": "final"})
+	expected = map[string]string{"Stage": "final"}
+	if meta := getMeta(); !reflect.DeepEqual(meta, expected) {
+		t.Errorf("expected metadata replaced by %v, got %v\n", expected, meta)
+	}
+
+	// oversized metadata is rejected without writing the value.
+	w = post("v5", map[string]string{"X-DVID-Meta-Big": strings.Repeat("x", MaxKeyMetadataBytes)})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for oversized metadata, got %d\n", w.Code)
+	}
+	if value := string(server.TestHTTP(t, "GET", keyreq, nil)); value != "v4" {
+		t.Errorf("expected value \"v4\" after rejected POST, got %q\n", value)
+	}
+
+	// deleting the key removes its metadata.
+	server.TestHTTP(t, "DELETE", keyreq, nil)
+	server.TestBadHTTP(t, "GET", keyreq+"/meta", nil)
+	post("v6", nil)
+	if meta := getMeta(); len(meta) != 0 {
+		t.Errorf("expected no metadata after delete, got %v\n", meta)
+	}
+
+	// deleting the key in a transaction removes its metadata.
+	post("v7", map[string]string{"X-DVID-Meta-Stage": "final"})
+	txnreq := fmt.Sprintf("%snode/%s/files/txn", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", txnreq, strings.NewReader(`[{"Op": "delete", "Key": "report"}]`))
+	kv, err := GetByUUIDName(uuid, "files")
+	if err != nil {
+		t.Fatalf("unable to get keyvalue instance: %v\n", err)
+	}
+	ctx := datastore.NewVersionedCtx(kv, versionID)
+	if meta, err := kv.storedKeyMetadata(ctx, "report"); err != nil || meta != nil {
+		t.Errorf("expected no metadata after transaction delete, got %v (err %v)\n", meta, err)
+	}
+
+	// a replayed idempotent POST leaves the metadata written with the value.
+	idem := map[string]string{IdempotencyKeyHeader: "meta-1", "X-DVID-Meta-Stage": "draft"}
+	if w := post("v8", idem); w.Code != http.StatusOK {
+		t.Fatalf("idempotent POST returned status %d\n", w.Code)
+	}
+	idem["X-DVID-Meta-Stage"] = "final"
+	if w := post("v8", idem); w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("expected replayed POST, got %d %v\n", w.Code, w.Header())
+	}
+	expected = map[string]string{"Stage": "draft"}
+	if meta := getMeta(); !reflect.DeepEqual(meta, expected) {
+		t.Errorf("expected metadata %v kept after replay, got %v\n", expected, meta)
+	}
+}
+
+func TestKeyvalueRepoBatch(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "left", dvid.Config{})
+	server.CreateTestInstance(t, uuid, "keyvalue", "right", dvid.Config{})
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/right/key/old", server.WebAPIPath, uuid), strings.NewReader("stale"))
+
+	batchreq := fmt.Sprintf("%srepo/%s/batch", server.WebAPIPath, uuid)
+	doBatch := func(req server.BatchRequest) server.BatchResponse {
+		body, err := json.Marshal(req)
+		if err != nil {
+			t.Fatalf("unable to marshal batch: %v\n", err)
+		}
+		var resp server.BatchResponse
+		if err := json.Unmarshal(server.TestHTTP(t, "POST", batchreq, bytes.NewReader(body)), &resp); err != nil {
+			t.Fatalf("bad batch response: %v\n", err)
+		}
+		if len(resp.Results) != len(req.Operations) {
+			t.Fatalf("expected %d results, got %v\n", len(req.Operations), resp)
+		}
+		return resp
+	}
+	getValue := func(name, key string) (string, bool) {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("%snode/%s/%s/key/%s", server.WebAPIPath, uuid, name, key), nil)
+		w := httptest.NewRecorder()
+		server.ServeSingleHTTP(w, req)
+		return w.Body.String(), w.Code == http.StatusOK
+	}
+
+	// best-effort batch where one instance doesn't exist.
+	resp := doBatch(server.BatchRequest{Operations: []datastore.BatchOp{
+		{Instance: "left", Op: "put", Key: "a", Value: []byte("left a")},
+		{Instance: "missing", Op: "put", Key: "a", Value: []byte("lost")},
+		{Instance: "right", Op: "delete", Key: "old"},
+		{Instance: "right", Op: "put", Key: "a", Value: []byte("right a")},
+	}})
+	if resp.Applied != 3 || resp.Failed != 1 || resp.Results[1].Applied || resp.Results[1].Error == "" {
+		t.Errorf("expected only the missing instance's operation to fail, got %+v\n", resp)
+	}
+	for i, result := range resp.Results {
+		if i != 1 && !result.Applied {
+			t.Errorf("expected operation %d applied, got %+v\n", i, result)
+		}
+	}
+	if value, found := getValue("left", "a"); !found || value != "left a" {
+		t.Errorf("expected left key a written, got %q (found %t)\n", value, found)
+	}
+	if value, found := getValue("right", "a"); !found || value != "right a" {
+		t.Errorf("expected right key a written, got %q (found %t)\n", value, found)
+	}
+	if _, found := getValue("right", "old"); found {
+		t.Errorf("expected right key old deleted\n")
+	}
+
+	// an atomic batch with a bad operation applies nothing.
+	resp = doBatch(server.BatchRequest{Atomic: true, Operations: []datastore.BatchOp{
+		{Instance: "left", Op: "put", Key: "b", Value: []byte("left b")},
+		{Instance: "right", Op: "frob", Key: "b"},
+	}})
+	if resp.Applied != 0 || resp.Failed != 2 {
+		t.Errorf("expected atomic batch with bad op to fail entirely, got %+v\n", resp)
+	}
+	if _, found := getValue("left", "b"); found {
+		t.Errorf("expected left key b not written by failed atomic batch\n")
+	}
+
+	// an atomic batch across instances in the same store.
+	resp = doBatch(server.BatchRequest{Atomic: true, Operations: []datastore.BatchOp{
+		{Instance: "right", Op: "put", Key: "b", Value: []byte("right b")},
+		{Instance: "left", Op: "put", Key: "b", Value: []byte("left b")},
+		{Instance: "left", Op: "delete", Key: "a"},
+	}})
+	if resp.Applied != 3 || resp.Failed != 0 {
+		t.Fatalf("expected atomic batch applied, got %+v\n", resp)
+	}
+	if value, found := getValue("left", "b"); !found || value != "left b" {
+		t.Errorf("expected left key b written, got %q (found %t)\n", value, found)
+	}
+	if value, found := getValue("right", "b"); !found || value != "right b" {
+		t.Errorf("expected right key b written, got %q (found %t)\n", value, found)
+	}
+	if _, found := getValue("left", "a"); found {
+		t.Errorf("expected left key a deleted\n")
+	}
+
+	// paused instances fail without blocking others.
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/right/pause", server.WebAPIPath, uuid), nil)
+	resp = doBatch(server.BatchRequest{Operations: []datastore.BatchOp{
+		{Instance: "right", Op: "put", Key: "c", Value: []byte("right c")},
+		{Instance: "left", Op: "put", Key: "c", Value: []byte("left c")},
+	}})
+	if resp.Applied != 1 || resp.Results[0].Applied || !resp.Results[1].Applied {
+		t.Errorf("expected only the paused instance's operation to fail, got %+v\n", resp)
+	}
+	server.TestBadHTTP(t, "POST", batchreq, strings.NewReader(`{"Operations": []}`))
+}
+
+func TestKeyvalueRepoBatchWritePath(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("Quota", "1000000")
+	config.Set("AuditLog", "true")
+	config.Set("MaxPendingWrites", "1")
+	server.CreateTestInstance(t, uuid, "keyvalue", "metered", config)
+	config = dvid.NewConfig()
+	config.Set("Quota", "1000000")
+	server.CreateTestInstance(t, uuid, "keyvalue", "othermetered", config)
+
+	keyreq := fmt.Sprintf("%snode/%s/metered/key/a", server.WebAPIPath, uuid)
+	req, err := http.NewRequest("POST", keyreq, strings.NewReader("posted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-DVID-Meta-Stage", "draft")
+	w := httptest.NewRecorder()
+	server.ServeSingleHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST with metadata returned status %d\n", w.Code)
+	}
+
+	batchreq := fmt.Sprintf("%srepo/%s/batch?u=dana", server.WebAPIPath, uuid)
+	doBatch := func(req server.BatchRequest) server.BatchResponse {
+		body, err := json.Marshal(req)
+		if err != nil {
+			t.Fatalf("unable to marshal batch: %v\n", err)
+		}
+		var resp server.BatchResponse
+		if err := json.Unmarshal(server.TestHTTP(t, "POST", batchreq, bytes.NewReader(body)), &resp); err != nil {
+			t.Fatalf("bad batch response: %v\n", err)
+		}
+		return resp
+	}
+
+	// atomic batches work across instances with their own quotas.
+	resp := doBatch(server.BatchRequest{Atomic: true, Operations: []datastore.BatchOp{
+		{Instance: "metered", Op: "put", Key: "a", Value: []byte("batched")},
+		{Instance: "othermetered", Op: "put", Key: "a", Value: []byte("batched")},
+	}})
+	if resp.Applied != 2 || resp.Failed != 0 {
+		t.Fatalf("expected atomic batch across metered instances applied, got %+v\n", resp)
+	}
+	if value := string(server.TestHTTP(t, "GET", keyreq, nil)); value != "batched" {
+		t.Errorf("expected batched value, got %q\n", value)
+	}
+
+	// batch puts replace metadata like POSTs without it and are audited.
+	var meta map[string]string
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", keyreq+"/meta", nil), &meta); err != nil {
+		t.Fatalf("bad metadata JSON: %v\n", err)
+	}
+	if len(meta) != 0 {
+		t.Errorf("expected batch put to remove metadata, got %v\n", meta)
+	}
+	var records []AuditRecord
+	auditreq := fmt.Sprintf("%snode/%s/metered/audit?key=a", server.WebAPIPath, uuid)
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", auditreq, nil), &records); err != nil {
+		t.Fatalf("couldn't unmarshal audit records: %v\n", err)
+	}
+	if len(records) != 2 || records[1].User != "dana" || records[1].Op != "put" || records[1].Bytes != len("batched") {
+		t.Errorf("expected audited batch put, got %v\n", records)
+	}
+
+	// batches take write slots like other writes.
+	kv, err := GetByUUIDName(uuid, "metered")
+	if err != nil {
+		t.Fatalf("can't get keyvalue instance: %v\n", err)
+	}
+	release := kv.acquireWrite(httptest.NewRecorder())
+	if release == nil {
+		t.Fatalf("expected to get the write slot\n")
+	}
+	for _, atomic := range []bool{false, true} {
+		resp = doBatch(server.BatchRequest{Atomic: atomic, Operations: []datastore.BatchOp{
+			{Instance: "metered", Op: "put", Key: "b", Value: []byte("blocked")},
+		}})
+		if resp.Applied != 0 || resp.Failed != 1 {
+			t.Errorf("expected batch (atomic %t) rejected while write slot held, got %+v\n", atomic, resp)
+		}
+	}
+	release()
+}
+
+func TestKeyvalueCompressionDict(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, versionID := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "annotations", dvid.Config{})
+
+	annotation := func(i int) string {
+		return fmt.Sprintf(`{"body_id": %d, "status": "Traced", "user": "annotator%d", "comment": "checked for merge errors", "class": "Tm%d"}`, 1000000+i*37, i%7, i%13)
+	}
+	keyreq := fmt.Sprintf("%snode/%s/annotations/key/", server.WebAPIPath, uuid)
+	for i := 0; i < 200; i++ {
+		server.TestHTTP(t, "POST", fmt.Sprintf("%sa%03d", keyreq, i), strings.NewReader(annotation(i)))
+	}
+
+	dictreq := fmt.Sprintf("%snode/%s/annotations/dictionary", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", dictreq+"?size=100000", nil)
+	var info CompressionDictInfo
+	if err := json.Unmarshal(server.TestHTTP(t, "POST", dictreq+"?size=4096&samples=100", nil), &info); err != nil {
+		t.Fatalf("bad dictionary training response: %v\n", err)
+	}
+	if info.ID != 1 || !info.Current || info.Samples != 100 || info.Size == 0 || info.Size > 4096 {
+		t.Fatalf("unexpected trained dictionary: %+v\n", info)
+	}
+
+	kv, err := GetByUUIDName(uuid, "annotations")
+	if err != nil {
+		t.Fatalf("can't get keyvalue instance: %v\n", err)
+	}
+	db, err := datastore.GetOrderedKeyValueDB(kv)
+	if err != nil {
+		t.Fatalf("can't get store: %v\n", err)
+	}
+	ctx := datastore.NewVersionedCtx(kv, versionID)
+	stored := func(key string) []byte {
+		tk, err := NewTKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := db.Get(ctx, tk)
+		if err != nil {
+			t.Fatalf("can't get stored value of key %q: %v\n", key, err)
+		}
+		return data
+	}
+
+	// new small values are compressed with the dictionary and still read back.
+	value := annotation(5000)
+	server.TestHTTP(t, "POST", keyreq+"new", strings.NewReader(value))
+	data := stored("new")
+	if len(data) == 0 || data[0] != dictValueMarker {
+		t.Fatalf("expected value compressed with dictionary, got % x\n", data)
+	}
+	plain, err := dvid.SerializeDataWithCodec([]byte(value), kv.Codec(), kv.Compression(), kv.ChecksumFor(len(value)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) >= len(plain) {
+		t.Errorf("expected dictionary to shrink value, got %d bytes vs %d without\n", len(data), len(plain))
+	}
+	if got := string(server.TestHTTP(t, "GET", keyreq+"new", nil)); got != value {
+		t.Errorf("expected %q, got %q\n", value, got)
+	}
+	big := strings.Repeat(annotation(1), 100)
+	server.TestHTTP(t, "POST", keyreq+"big", strings.NewReader(big))
+	if data := stored("big"); len(data) != 0 && data[0] == dictValueMarker {
+		t.Errorf("expected value over maxvaluesize not compressed with dictionary\n")
+	}
+
+	// values compressed with an earlier dictionary still decode after retraining and reload.
+	if err := json.Unmarshal(server.TestHTTP(t, "POST", dictreq+"?size=2048", nil), &info); err != nil {
+		t.Fatalf("bad dictionary training response: %v\n", err)
+	}
+	if info.ID != 2 || !info.Current {
+		t.Fatalf("expected retrained dictionary 2, got %+v\n", info)
+	}
+	server.TestHTTP(t, "POST", keyreq+"newer", strings.NewReader(annotation(6000)))
+	datastore.CloseReopenTest()
+	for key, expected := range map[string]string{"new": value, "newer": annotation(6000), "a007": annotation(7)} {
+		if got := string(server.TestHTTP(t, "GET", keyreq+key, nil)); got != expected {
+			t.Errorf("key %q after reload: expected %q, got %q\n", key, expected, got)
+		}
+	}
+
+	// stopping the dictionary keeps earlier ones for decoding.
+	server.TestHTTP(t, "DELETE", dictreq, nil)
+	var dicts []CompressionDictInfo
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", dictreq, nil), &dicts); err != nil {
+		t.Fatalf("bad dictionary list: %v\n", err)
+	}
+	if len(dicts) != 2 || dicts[0].ID != 1 || dicts[1].ID != 2 || dicts[0].Current || dicts[1].Current {
+		t.Errorf("expected 2 dictionaries not in use, got %+v\n", dicts)
+	}
+	server.TestHTTP(t, "POST", keyreq+"after", strings.NewReader(annotation(7000)))
+	if got := string(server.TestHTTP(t, "GET", keyreq+"newer", nil)); got != annotation(6000) {
+		t.Errorf("expected %q, got %q\n", annotation(6000), got)
+	}
+	kv, err = GetByUUIDName(uuid, "annotations")
+	if err != nil {
+		t.Fatalf("can't get keyvalue instance: %v\n", err)
+	}
+	if db, err = datastore.GetOrderedKeyValueDB(kv); err != nil {
+		t.Fatalf("can't get store: %v\n", err)
+	}
+	ctx = datastore.NewVersionedCtx(kv, versionID)
+	if data := stored("after"); len(data) != 0 && data[0] == dictValueMarker {
+		t.Errorf("expected value written after DELETE not compressed with dictionary\n")
+	}
+}
+
+func TestKeyvalueListKeys(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "bucket", dvid.Config{})
+	var kvs KeyValues
+	for _, key := range []string{"a.txt", "img/1.png", "img/2.png", "img/raw/3.tif", "img/raw/4.tif", "img/thumbs/1.png"} {
+		kvs.Kvs = append(kvs.Kvs, &KeyValue{Key: key, Value: []byte(key)})
+	}
+	serialization, err := kvs.Marshal()
+	if err != nil {
+		t.Fatalf("unable to serialize KeyValues: %v\n", err)
+	}
+	ingestreq := fmt.Sprintf("%snode/%s/bucket/keyvalues", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", ingestreq, bytes.NewBuffer(serialization))
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"delimiter=/", `{"Keys":["a.txt"],"CommonPrefixes":["img/"]}`},
+		{"prefix=img/&delimiter=/", `{"Keys":["img/1.png","img/2.png"],"CommonPrefixes":["img/raw/","img/thumbs/"]}`},
+		{"prefix=img/raw/", `{"Keys":["img/raw/3.tif","img/raw/4.tif"],"CommonPrefixes":[]}`},
+		{"prefix=none/&delimiter=/", `{"Keys":[],"CommonPrefixes":[]}`},
+	}
+	for _, tc := range tests {
+		listreq := fmt.Sprintf("%snode/%s/bucket/keys/list?%s", server.WebAPIPath, uuid, tc.query)
+		if got := string(server.TestHTTP(t, "GET", listreq, nil)); got != tc.expected {
+			t.Errorf("listing %q: expected %s, got %s\n", tc.query, tc.expected, got)
+		}
+	}
+}
+
+func TestKeyvalueRawRange(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "replicated", dvid.Config{})
+	for _, key := range []string{"a", "b", "c"} {
+		keyreq := fmt.Sprintf("%snode/%s/replicated/key/%s", server.WebAPIPath, uuid, key)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader("value-"+key))
+	}
+
+	readRange := func(query string, keysOnly bool) []*storage.KeyValue {
+		rangereq := fmt.Sprintf("%srepo/%s/instance/replicated/rawrange%s", server.WebAPIPath, uuid, query)
+		var kvs []*storage.KeyValue
+		err := datastore.ReadRawRange(bytes.NewReader(server.TestHTTP(t, "GET", rangereq, nil)), keysOnly, func(kv *storage.KeyValue) error {
+			kvs = append(kvs, kv)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to read raw range stream: %v\n", err)
+		}
+		return kvs
+	}
+	kvs := readRange("", false)
+	if len(kvs) != 3 {
+		t.Fatalf("expected 3 raw key-value pairs, got %d\n", len(kvs))
+	}
+	for i, key := range []string{"a", "b", "c"} {
+		tk, err := storage.TKeyFromKey(kvs[i].K)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keyStr, err := DecodeTKey(tk); err != nil || keyStr != key {
+			t.Errorf("expected raw key %d to be %q, got %q (%v)\n", i, key, keyStr, err)
+		}
+		if len(kvs[i].V) == 0 {
+			t.Errorf("expected stored value for raw key %q\n", key)
+		}
+	}
+
+	resumed := readRange(fmt.Sprintf("?after=%x&keysonly=true", kvs[0].K), true)
+	if len(resumed) != 2 || !bytes.Equal(resumed[0].K, kvs[1].K) || resumed[0].V != nil {
+		t.Errorf("expected 2 keys without values resuming after first key, got %v\n", resumed)
+	}
+}
+
+func TestKeyvalueFlatten(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "history", dvid.Config{})
+	for _, key := range []string{"a", "b", "c"} {
+		keyreq := fmt.Sprintf("%snode/%s/history/key/%s", server.WebAPIPath, uuid, key)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader("root-"+key))
+	}
+	if err := datastore.Commit(uuid, "root", nil); err != nil {
+		t.Fatalf("unable to commit root: %v\n", err)
+	}
+	uuid2, err := datastore.NewVersion(uuid, "child", "", nil)
+	if err != nil {
+		t.Fatalf("unable to create child version: %v\n", err)
+	}
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/history/key/a", server.WebAPIPath, uuid2), strings.NewReader("child-a"))
+	server.TestHTTP(t, "DELETE", fmt.Sprintf("%snode/%s/history/key/b", server.WebAPIPath, uuid2), nil)
+
+	// flattens require confirmation and aren't done while writes are paused.
+	flattenreq := fmt.Sprintf("%srepo/%s/instance/history/flatten", server.WebAPIPath, uuid2)
+	server.TestBadHTTP(t, "POST", flattenreq, nil)
+	flattenreq += "?imsure=true"
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/history/pause", server.WebAPIPath, uuid2), nil)
+	if resp := server.TestHTTPResponse(t, "POST", flattenreq, nil); resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected paused flatten to return 503, got %d\n", resp.Code)
+	}
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/history/resume", server.WebAPIPath, uuid2), nil)
+
+	var stats datastore.FlattenStats
+	if err := json.Unmarshal(server.TestHTTP(t, "POST", flattenreq, nil), &stats); err != nil {
+		t.Fatalf("bad flatten JSON: %v\n", err)
+	}
+	if stats.Copied != 1 || stats.Deleted != 4 || stats.BytesReclaimed <= 0 {
+		t.Errorf("expected c copied and 3 root values plus 1 tombstone deleted, got %v\n", stats)
+	}
+
+	expected := map[string]string{"a": "child-a", "c": "root-c"}
+	for key, value := range expected {
+		keyreq := fmt.Sprintf("%snode/%s/history/key/%s", server.WebAPIPath, uuid2, key)
+		if got := string(server.TestHTTP(t, "GET", keyreq, nil)); got != value {
+			t.Errorf("expected %q for key %q after flatten, got %q\n", value, key, got)
+		}
+	}
+	keyreq := fmt.Sprintf("%snode/%s/history/key/b", server.WebAPIPath, uuid2)
+	if resp := server.TestHTTPResponse(t, "GET", keyreq, nil); resp.Code != http.StatusNotFound {
+		t.Errorf("expected deleted key to stay deleted after flatten, got %d\n", resp.Code)
+	}
+	keysreq := fmt.Sprintf("%snode/%s/history/keys", server.WebAPIPath, uuid)
+	if got := strings.TrimSpace(string(server.TestHTTP(t, "GET", keysreq, nil))); got != "[]" {
+		t.Errorf("expected no keys at flattened ancestor, got %s\n", got)
+	}
+
+	// flattening at the root is refused once there's another branch.
+	if _, err := datastore.NewVersion(uuid, "sibling", "other", nil); err != nil {
+		t.Fatalf("unable to create sibling version: %v\n", err)
+	}
+	server.TestBadHTTP(t, "POST", flattenreq, nil)
+}
+
+func TestKeyvalueMergeBranches(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "branched", dvid.Config{})
+	put := func(u dvid.UUID, key, value string) {
+		keyreq := fmt.Sprintf("%snode/%s/branched/key/%s", server.WebAPIPath, u, key)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader(value))
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		put(uuid, key, "root-"+key)
+	}
+	if err := datastore.Commit(uuid, "root", nil); err != nil {
+		t.Fatalf("unable to commit root: %v\n", err)
+	}
+	ours, err := datastore.NewVersion(uuid, "ours", "", nil)
+	if err != nil {
+		t.Fatalf("unable to create branch: %v\n", err)
+	}
+	theirs, err := datastore.NewVersion(uuid, "theirs", "theirs", nil)
+	if err != nil {
+		t.Fatalf("unable to create branch: %v\n", err)
+	}
+	put(ours, "a", "ours-a")
+	put(ours, "b", "ours-b")
+	put(theirs, "a", "theirs-a")
+	put(theirs, "c", "theirs-c")
+	for _, u := range []dvid.UUID{ours, theirs} {
+		if err := datastore.Commit(u, "branch", nil); err != nil {
+			t.Fatalf("unable to commit branch: %v\n", err)
+		}
+	}
+
+	// keys are only resolved in an unlocked merge of two versions.
+	server.TestBadHTTP(t, "POST", fmt.Sprintf("%snode/%s/branched/merge", server.WebAPIPath, ours), nil)
+	merged, err := datastore.Merge([]dvid.UUID{ours, theirs}, "merge", datastore.MergeConflictFree)
+	if err != nil {
+		t.Fatalf("unable to merge branches: %v\n", err)
+	}
+
+	// merges are writes, so they're refused while writes are paused.
+	mergereq := fmt.Sprintf("%snode/%s/branched/merge", server.WebAPIPath, merged)
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/branched/pause", server.WebAPIPath, merged), nil)
+	resp := server.TestHTTPResponse(t, "POST", mergereq, nil)
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected paused merge to return 503, got %d\n", resp.Code)
+	}
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/branched/resume", server.WebAPIPath, merged), nil)
+
+	resp = server.TestHTTPResponse(t, "POST", mergereq, nil)
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("expected conflicting merge to return 409, got %d\n", resp.Code)
+	}
+	var result MergeResult
+	if err := json.Unmarshal(resp.Body.Bytes(), &result); err != nil {
+		t.Fatalf("bad merge JSON: %v\n", err)
+	}
+	if len(result.Resolved) != 0 || len(result.Conflicts) != 1 || result.Conflicts[0] != "a" {
+		t.Errorf("expected conflict on key a and no resolved keys, got %v\n", result)
+	}
+
+	body := `{"Policy": "theirs"}`
+	if err := json.Unmarshal(server.TestHTTP(t, "POST", mergereq, strings.NewReader(body)), &result); err != nil {
+		t.Fatalf("bad merge JSON: %v\n", err)
+	}
+	if len(result.Resolved) != 1 || result.Resolved[0] != "a" {
+		t.Fatalf("expected key a resolved, got %v\n", result)
+	}
+	expected := map[string]string{"a": "theirs-a", "b": "ours-b", "c": "theirs-c"}
+	for key, value := range expected {
+		keyreq := fmt.Sprintf("%snode/%s/branched/key/%s", server.WebAPIPath, merged, key)
+		if got := string(server.TestHTTP(t, "GET", keyreq, nil)); got != value {
+			t.Errorf("expected merged %q for key %q, got %q\n", value, key, got)
+		}
+	}
+}
+
+func TestKeyvalueExportNDJSON(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "exported", dvid.Config{})
+
+	expected := map[string]string{"a": "first", "b": "second", "c": "third"}
+	for key, value := range expected {
+		keyreq := fmt.Sprintf("%snode/%s/exported/key/%s", server.WebAPIPath, uuid, key)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader(value))
+	}
+
+	exportreq := fmt.Sprintf("%snode/%s/exported/export/ndjson", server.WebAPIPath, uuid)
+	lines := strings.Split(strings.TrimSpace(string(server.TestHTTP(t, "GET", exportreq, nil))), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %d: %v\n", len(expected), len(lines), lines)
+	}
+	for i, line := range lines {
+		var record struct {
+			Key   string
+			Value []byte
+		}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("bad NDJSON line %q: %v\n", line, err)
+		}
+		if record.Key != string('a'+rune(i)) || string(record.Value) != expected[record.Key] {
+			t.Errorf("bad line %d: %q\n", i, line)
+		}
+	}
+
+	lines = strings.Split(strings.TrimSpace(string(server.TestHTTP(t, "GET", exportreq+"?values=false", nil))), "\n")
+	if len(lines) != len(expected) || lines[0] != `{"key":"a"}` {
+		t.Errorf("bad keys-only export: %v\n", lines)
+	}
+
+	// compressed exports decompress to the uncompressed export, including lines of
+	// already-compressed values written in their own gzip members.
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	zw.Write([]byte(strings.Repeat("compressible ", 100)))
+	zw.Close()
+	keyreq := fmt.Sprintf("%snode/%s/exported/key/d", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, bytes.NewReader(gzipped.Bytes()))
+	keyreq = fmt.Sprintf("%snode/%s/exported/key/e", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("fifth"))
+	uncompressed := server.TestHTTP(t, "GET", exportreq+"?compress=none", nil)
+	exportGzip := func(query string, acceptGzip bool) []byte {
+		req, err := http.NewRequest("GET", exportreq+query, nil)
+		if err != nil {
+			t.Fatalf("unsuccessful making request: %v\n", err)
+		}
+		if acceptGzip {
+			req.Header.Set("Accept-Encoding", "gzip")
+		}
+		w := httptest.NewRecorder()
+		server.ServeSingleHTTP(w, req)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatalf("bad compressed export response: %d %v\n", w.Code, w.Header())
+		}
+		zr, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("bad gzip stream: %v\n", err)
+		}
+		data, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("bad gzip stream: %v\n", err)
+		}
+		return data
+	}
+	if data := exportGzip("?compress=gzip", false); !bytes.Equal(data, uncompressed) {
+		t.Errorf("expected compressed export %q, got %q\n", uncompressed, data)
+	}
+	if data := exportGzip("", true); !bytes.Equal(data, uncompressed) {
+		t.Errorf("expected export compressed by Accept-Encoding %q, got %q\n", uncompressed, data)
+	}
+	server.TestBadHTTP(t, "GET", exportreq+"?compress=zstd", nil)
+
+	server.CreateTestInstance(t, uuid, "keyvalue", "emptyexport", dvid.Config{})
+	exportreq = fmt.Sprintf("%snode/%s/emptyexport/export/ndjson", server.WebAPIPath, uuid)
+	if data := exportGzip("?compress=gzip", false); len(data) != 0 {
+		t.Errorf("expected empty compressed export, got %q\n", data)
+	}
+}
+
+// testHook adds a fixed amount to each byte of a value.
+type testHook struct {
+	name  string
+	shift byte
+}
+
+func (h testHook) Name() string { return h.name }
+
+func (h testHook) Write(d *Data, value []byte) ([]byte, error) {
+	out := make([]byte, len(value))
+	for i, b := range value {
+		out[i] = b + h.shift
+	}
+	return out, nil
+}
+
+func (h testHook) Read(d *Data, value []byte) ([]byte, error) {
+	out := make([]byte, len(value))
+	for i, b := range value {
+		out[i] = b - h.shift
+	}
+	return out, nil
+}
+
+// testAppendHook appends a marker byte so hook order is observable.
+type testAppendHook struct{}
+
+func (testAppendHook) Name() string { return "append-test" }
+
+func (testAppendHook) Write(d *Data, value []byte) ([]byte, error) {
+	return append(append([]byte{}, value...), '!'), nil
+}
+
+func (testAppendHook) Read(d *Data, value []byte) ([]byte, error) {
+	if len(value) == 0 || value[len(value)-1] != '!' {
+		return nil, fmt.Errorf("missing marker")
+	}
+	return value[:len(value)-1], nil
+}
+
+func init() {
+	RegisterValueHook(testHook{"shift-test", 1})
+	RegisterValueHook(testAppendHook{})
+}
+
+func TestKeyvalueValueHooks(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, versionID := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("ValueHooks", "append-test,shift-test")
+	server.CreateTestInstance(t, uuid, "keyvalue", "hooked", config)
+
+	keyreq := fmt.Sprintf("%snode/%s/hooked/key/secret", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("abc"))
+	if value := string(server.TestHTTP(t, "GET", keyreq, nil)); value != "abc" {
+		t.Errorf("expected hooks to be reversed on read, got %q\n", value)
+	}
+
+	kv, err := GetByUUIDName(uuid, "hooked")
+	if err != nil {
+		t.Fatalf("unable to get keyvalue instance: %v\n", err)
+	}
+	db, err := datastore.GetOrderedKeyValueDB(kv)
+	if err != nil {
+		t.Fatalf("unable to get store: %v\n", err)
+	}
+	tk, _ := NewTKey("secret")
+	data, err := db.Get(datastore.NewVersionedCtx(kv, versionID), tk)
+	if err != nil {
+		t.Fatalf("unable to get stored value: %v\n", err)
+	}
+	stored, _, err := dvid.DeserializeData(data, true)
+	if err != nil {
+		t.Fatalf("unable to deserialize stored value: %v\n", err)
+	}
+	if string(stored) != "bcd\"" {
+		t.Errorf("expected hooks applied in order before storage, got %q\n", string(stored))
+	}
+
+	config = dvid.NewConfig()
+	config.Set("ValueHooks", "")
+	if err := kv.ModifyConfig(config); err == nil {
+		t.Errorf("expected error changing hooks after creation\n")
+	}
+
+	config = dvid.NewConfig()
+	config.Set("ValueHooks", "unregistered")
+	var props Properties
+	if err := props.setByConfig(config); err == nil {
+		t.Errorf("expected error configuring unregistered hook\n")
+	}
+}
+
+func TestKeyvalueSerializationInfo(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("Compression", "lz4")
+	config.Set("Checksum", "crc32")
+	config.Set("ChunkSize", "1024")
+	server.CreateTestInstance(t, uuid, "keyvalue", "described", config)
+
+	inforeq := fmt.Sprintf("%snode/%s/described/info", server.WebAPIPath, uuid)
+	var info struct {
+		Serialization SerializationInfo
+	}
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", inforeq, nil), &info); err != nil {
+		t.Fatalf("bad info JSON: %v\n", err)
+	}
+	got := info.Serialization
+	if got.Compression != "lz4" || got.Checksum != "crc32" || !got.Versioned || got.MaxValueSize != 1024 {
+		t.Errorf("unexpected serialization info: %+v\n", got)
+	}
+	compression, _ := dvid.NewCompression(dvid.LZ4, dvid.DefaultCompression)
+	if format := dvid.EncodeSerializationFormat(compression, dvid.CRC32); got.Format != uint8(format) {
+		t.Errorf("expected format byte %d, got %d\n", format, got.Format)
+	}
+}
+
+func TestKeyvalueStatKeys(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("TrackModified", "true")
+	config.Set("ChunkSize", "64")
+	server.CreateTestInstance(t, uuid, "keyvalue", "statted", config)
+
+	large := make([]byte, 200)
+	if _, err := rand.Read(large); err != nil {
+		t.Fatal(err)
+	}
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/statted/key/small", server.WebAPIPath, uuid), strings.NewReader("abc"))
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/statted/key/large", server.WebAPIPath, uuid), bytes.NewReader(large))
+
+	statreq := fmt.Sprintf("%snode/%s/statted/keyvalues/stat", server.WebAPIPath, uuid)
+	var stats []KeyStat
+	if err := json.Unmarshal(server.TestHTTP(t, "POST", statreq, strings.NewReader(`["small", "large", "missing"]`)), &stats); err != nil {
+		t.Fatalf("bad stat JSON: %v\n", err)
+	}
+	if len(stats) != 3 {
+		t.Fatalf("expected 3 stats, got %v\n", stats)
+	}
+	if !stats[0].Found || stats[0].Size < 3 || stats[0].Size >= 64 || stats[0].Modified == nil {
+		t.Errorf("bad stat for small key: %v\n", stats[0])
+	}
+	if !stats[1].Found || stats[1].Size < len(large) || stats[1].Modified == nil {
+		t.Errorf("bad stat for chunked key: %v\n", stats[1])
+	}
+	if stats[2].Found || stats[2].Size != 0 || stats[2].Modified != nil {
+		t.Errorf("bad stat for missing key: %v\n", stats[2])
+	}
+}
+
+func TestKeyvalueStream(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "streamed", dvid.Config{})
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/streamed/key/a", server.WebAPIPath, uuid), strings.NewReader("first value"))
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/streamed/key/b", server.WebAPIPath, uuid), strings.NewReader("second"))
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/streamed/key/empty", server.WebAPIPath, uuid), strings.NewReader(""))
+
+	streamreq := fmt.Sprintf("%snode/%s/streamed/keyvalues/stream", server.WebAPIPath, uuid)
+	stream := server.TestHTTP(t, "POST", streamreq, strings.NewReader(`["b", "missing", "a", "empty"]`))
+
+	expected := []struct {
+		key, value string
+		found      bool
+	}{
+		{"b", "second", true},
+		{"missing", "", false},
+		{"a", "first value", true},
+		{"empty", "", true},
+	}
+	buf := bytes.NewBuffer(stream)
+	for _, exp := range expected {
+		var keyLen, valueLen uint32
+		if err := binary.Read(buf, binary.LittleEndian, &keyLen); err != nil {
+			t.Fatalf("can't read key length for %q: %v\n", exp.key, err)
+		}
+		if key := string(buf.Next(int(keyLen))); key != exp.key {
+			t.Fatalf("expected key %q, got %q\n", exp.key, key)
+		}
+		if err := binary.Read(buf, binary.LittleEndian, &valueLen); err != nil {
+			t.Fatalf("can't read value length for %q: %v\n", exp.key, err)
+		}
+		if !exp.found {
+			if valueLen != 0xFFFFFFFF {
+				t.Errorf("expected missing marker for key %q, got length %d\n", exp.key, valueLen)
+			}
+			continue
+		}
+		if value := string(buf.Next(int(valueLen))); value != exp.value {
+			t.Errorf("expected value %q for key %q, got %q\n", exp.value, exp.key, value)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected end of stream, got %d more bytes\n", buf.Len())
+	}
+}
+
+func TestKeyvalueKeysExist(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "present", dvid.Config{})
+
+	for _, key := range []string{"a", "c"} {
+		keyreq := fmt.Sprintf("%snode/%s/present/key/%s", server.WebAPIPath, uuid, key)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader("value-"+key))
+	}
+
+	existsreq := fmt.Sprintf("%snode/%s/present/keyvalues/exists", server.WebAPIPath, uuid)
+	returnValue := server.TestHTTP(t, "POST", existsreq, strings.NewReader(`["a","b","c"]`))
+	var found []bool
+	if err := json.Unmarshal(returnValue, &found); err != nil {
+		t.Fatalf("couldn't unmarshal exists response %q: %v\n", string(returnValue), err)
+	}
+	expected := []bool{true, false, true}
+	if len(found) != len(expected) {
+		t.Fatalf("expected %d results, got %v\n", len(expected), found)
+	}
+	for i := range expected {
+		if found[i] != expected[i] {
+			t.Errorf("expected exists results %v, got %v\n", expected, found)
+			break
+		}
+	}
+
+	resp := server.TestHTTPResponse(t, "GET", existsreq, nil)
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("expected GET on exists endpoint to fail, got %d\n", resp.Code)
+	}
+}
+
+func TestKeyvalueBulkReadsOnCommittedNode(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "committed", dvid.Config{})
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/committed/key/a", server.WebAPIPath, uuid), strings.NewReader("value"))
+	if err := datastore.Commit(uuid, "root", nil); err != nil {
+		t.Fatalf("unable to commit root: %v\n", err)
+	}
+
+	keysreq := func(endpoint string) string {
+		return fmt.Sprintf("%snode/%s/committed/keyvalues/%s", server.WebAPIPath, uuid, endpoint)
+	}
+	var found []bool
+	if err := json.Unmarshal(server.TestHTTP(t, "POST", keysreq("exists"), strings.NewReader(`["a","b"]`)), &found); err != nil {
+		t.Fatalf("bad exists response: %v\n", err)
+	}
+	if len(found) != 2 || !found[0] || found[1] {
+		t.Errorf("bad exists results on committed node: %v\n", found)
+	}
+	var stats []KeyStat
+	if err := json.Unmarshal(server.TestHTTP(t, "POST", keysreq("stat"), strings.NewReader(`["a"]`)), &stats); err != nil {
+		t.Fatalf("bad stat response: %v\n", err)
+	}
+	if len(stats) != 1 || !stats[0].Found {
+		t.Errorf("bad stat results on committed node: %v\n", stats)
+	}
+	if stream := server.TestHTTP(t, "POST", keysreq("stream"), strings.NewReader(`["a"]`)); !bytes.Contains(stream, []byte("value")) {
+		t.Errorf("bad stream on committed node: %q\n", stream)
+	}
+
+	// writes through keyvalues are still rejected on committed nodes.
+	server.TestBadHTTP(t, "POST", keysreq(""), strings.NewReader(""))
+}
+
+func TestKeyvalueSecondaryIndex(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("IndexField", "owner.name")
+	server.CreateTestInstance(t, uuid, "keyvalue", "people", config)
+
+	values := map[string]string{
+		"a": `{"owner": {"name": "alice"}, "size": 1}`,
+		"b": `{"owner": {"name": "bob"}}`,
+		"c": `{"owner": {"name": "alice"}}`,
+		"d": `not json`,
+	}
+	for key, value := range values {
+		keyreq := fmt.Sprintf("%snode/%s/people/key/%s", server.WebAPIPath, uuid, key)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader(value))
+	}
+
+	lookup := func(value string, expected []string) {
+		indexreq := fmt.Sprintf("%snode/%s/people/index/owner.name/%s", server.WebAPIPath, uuid, value)
+		returnValue := server.TestHTTP(t, "GET", indexreq, nil)
+		var keys []string
+		if err := json.Unmarshal(returnValue, &keys); err != nil {
+			t.Fatalf("couldn't unmarshal index response %q: %v\n", string(returnValue), err)
+		}
+		if len(keys) != len(expected) {
+			t.Fatalf("expected keys %v for %q, got %v\n", expected, value, keys)
+		}
+		for i := range expected {
+			if keys[i] != expected[i] {
+				t.Fatalf("expected keys %v for %q, got %v\n", expected, value, keys)
+			}
+		}
+	}
+	lookup("alice", []string{"a", "c"})
+	lookup("bob", []string{"b"})
+	lookup("carol", []string{})
+
+	// overwrites move the key to its new field value.
+	keyreq := fmt.Sprintf("%snode/%s/people/key/a", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader(`{"owner": {"name": "bob"}}`))
+	lookup("alice", []string{"c"})
+	lookup("bob", []string{"a", "b"})
+
+	// deletes remove the key from the index.
+	server.TestHTTP(t, "DELETE", keyreq, nil)
+	lookup("bob", []string{"b"})
+
+	// transactions maintain the index within the batch, where e is {"owner": {"name": "carol"}}.
+	txnreq := fmt.Sprintf("%snode/%s/people/txn", server.WebAPIPath, uuid)
+	txn := `[{"Op": "put", "Key": "e", "Value": "eyJvd25lciI6IHsibmFtZSI6ICJjYXJvbCJ9fQ=="}, {"Op": "delete", "Key": "c"}]`
+	server.TestHTTP(t, "POST", txnreq, strings.NewReader(txn))
+	lookup("alice", []string{})
+	lookup("carol", []string{"e"})
+
+	badreq := fmt.Sprintf("%snode/%s/people/index/size/1", server.WebAPIPath, uuid)
+	resp := server.TestHTTPResponse(t, "GET", badreq, nil)
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("expected lookup of unindexed field to fail, got %d\n", resp.Code)
+	}
+}
+
+func TestKeyvalueReindex(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "people", dvid.Config{})
+
+	values := map[string]string{
+		"a": `{"owner": {"name": "alice"}, "team": "red"}`,
+		"b": `{"owner": {"name": "bob"}, "team": "blue"}`,
+		"c": `{"owner": {"name": "alice"}, "team": "red"}`,
+	}
+	for key, value := range values {
+		keyreq := fmt.Sprintf("%snode/%s/people/key/%s", server.WebAPIPath, uuid, key)
+		server.TestHTTP(t, "POST", keyreq, strings.NewReader(value))
+	}
+
+	reindexreq := fmt.Sprintf("%snode/%s/people/reindex", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", reindexreq, nil)
+
+	kv, err := GetByUUIDName(uuid, "people")
+	if err != nil {
+		t.Fatalf("unable to get keyvalue instance: %v\n", err)
+	}
+	reindex := func(field string) ReindexStatus {
+		config := dvid.NewConfig()
+		config.Set("IndexField", field)
+		if err := kv.ModifyConfig(config); err != nil {
+			t.Fatalf("unable to set IndexField: %v\n", err)
+		}
+		server.TestHTTP(t, "POST", reindexreq, nil)
+		for i := 0; i < 100; i++ {
+			var status ReindexStatus
+			if err := json.Unmarshal(server.TestHTTP(t, "GET", reindexreq, nil), &status); err != nil {
+				t.Fatalf("couldn't unmarshal reindex status: %v\n", err)
+			}
+			if !status.Running {
+				return status
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("reindex of %q didn't finish\n", field)
+		return ReindexStatus{}
+	}
+	lookup := func(field, value string, expected []string) {
+		indexreq := fmt.Sprintf("%snode/%s/people/index/%s/%s", server.WebAPIPath, uuid, field, value)
+		var keys []string
+		if err := json.Unmarshal(server.TestHTTP(t, "GET", indexreq, nil), &keys); err != nil {
+			t.Fatalf("couldn't unmarshal index response: %v\n", err)
+		}
+		if len(keys) != len(expected) {
+			t.Fatalf("expected keys %v for %s=%q, got %v\n", expected, field, value, keys)
+		}
+		for i := range expected {
+			if keys[i] != expected[i] {
+				t.Fatalf("expected keys %v for %s=%q, got %v\n", expected, field, value, keys)
+			}
+		}
+	}
+
+	status := reindex("owner.name")
+	if status.Error != "" || status.Indexed != 3 || status.Pruned != 0 || status.LastKey != "c" {
+		t.Fatalf("unexpected reindex status: %v\n", status)
+	}
+	lookup("owner.name", "alice", []string{"a", "c"})
+	lookup("owner.name", "bob", []string{"b"})
+
+	// entries of the previously indexed field are pruned.
+	status = reindex("team")
+	if status.Error != "" || status.Indexed != 3 || status.Pruned != 3 {
+		t.Fatalf("unexpected reindex status: %v\n", status)
+	}
+	lookup("team", "red", []string{"a", "c"})
+	lookup("team", "alice", []string{})
+
+	// writes after a reindex keep the index current.
+	keyreq := fmt.Sprintf("%snode/%s/people/key/b", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader(`{"team": "red"}`))
+	lookup("team", "red", []string{"a", "b", "c"})
+	lookup("team", "blue", []string{})
+}
+
+func TestKeyvalueTransaction(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "txnkv", dvid.Config{})
+
+	keyreq := fmt.Sprintf("%snode/%s/txnkv/key/group1", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("annotation"))
+
+	// move the annotation between groups.
+	txnreq := fmt.Sprintf("%snode/%s/txnkv/txn", server.WebAPIPath, uuid)
+	ops := `[{"Op": "put", "Key": "group2", "Value": "YW5ub3RhdGlvbg=="}, {"Op": "delete", "Key": "group1"}]`
+	server.TestHTTP(t, "POST", txnreq, strings.NewReader(ops))
+
+	server.TestBadHTTP(t, "GET", keyreq, nil)
+	keyreq2 := fmt.Sprintf("%snode/%s/txnkv/key/group2", server.WebAPIPath, uuid)
+	if value := server.TestHTTP(t, "GET", keyreq2, nil); string(value) != "annotation" {
+		t.Errorf("expected moved value %q, got %q\n", "annotation", string(value))
+	}
+
+	// a bad operation should reject the entire transaction.
+	ops = `[{"Op": "put", "Key": "group3", "Value": "YQ=="}, {"Op": "rename", "Key": "group2"}]`
+	server.TestBadHTTP(t, "POST", txnreq, strings.NewReader(ops))
+	keyreq3 := fmt.Sprintf("%snode/%s/txnkv/key/group3", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", keyreq3, nil)
+}
+
+func TestKeyvalueSwap(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "swapped", dvid.Config{})
+
+	keyreq := func(key string) string {
+		return fmt.Sprintf("%snode/%s/swapped/key/%s", server.WebAPIPath, uuid, key)
+	}
+	server.TestHTTP(t, "POST", keyreq("active"), strings.NewReader("blue"))
+	server.TestHTTP(t, "POST", keyreq("staging"), strings.NewReader("green"))
+
+	swapreq := fmt.Sprintf("%snode/%s/swapped/keys/swap?a=active&b=staging", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", swapreq, nil)
+	if value := string(server.TestHTTP(t, "GET", keyreq("active"), nil)); value != "green" {
+		t.Errorf("expected swapped active value %q, got %q\n", "green", value)
+	}
+	if value := string(server.TestHTTP(t, "GET", keyreq("staging"), nil)); value != "blue" {
+		t.Errorf("expected swapped staging value %q, got %q\n", "blue", value)
+	}
+
+	swapreq = fmt.Sprintf("%snode/%s/swapped/keys/swap?a=active&b=missing", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", swapreq, nil)
+	if value := string(server.TestHTTP(t, "GET", keyreq("active"), nil)); value != "green" {
+		t.Errorf("failed swap changed active value to %q\n", value)
+	}
+	server.TestHTTP(t, "POST", swapreq+"&missing=empty", nil)
+	if value := string(server.TestHTTP(t, "GET", keyreq("missing"), nil)); value != "green" {
+		t.Errorf("expected missing key to get active value, got %q\n", value)
+	}
+	if value := string(server.TestHTTP(t, "GET", keyreq("active"), nil)); value != "" {
+		t.Errorf("expected active key to get empty value, got %q\n", value)
+	}
+
+	swapreq = fmt.Sprintf("%snode/%s/swapped/keys/swap?a=active&b=active", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", swapreq, nil)
+}
+
+func TestKeyvalueTouch(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, versionID := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("TrackModified", "true")
+	server.CreateTestInstance(t, uuid, "keyvalue", "leases", config)
+
+	touchreq := fmt.Sprintf("%snode/%s/leases/key/lease1/touch", server.WebAPIPath, uuid)
+	resp := server.TestHTTPResponse(t, "POST", touchreq, nil)
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("expected touch of missing key to return 404, got %d\n", resp.Code)
+	}
+
+	keyreq := fmt.Sprintf("%snode/%s/leases/key/lease1", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", keyreq, strings.NewReader("holder"))
+	resp = server.TestHTTPResponse(t, "GET", keyreq, nil)
+	if resp.Header().Get("Last-Modified") == "" {
+		t.Errorf("expected Last-Modified header on GET of tracked key\n")
+	}
+
+	kv, err := GetByUUIDName(uuid, "leases")
+	if err != nil {
+		t.Fatalf("unable to get keyvalue instance: %v\n", err)
+	}
+	ctx := datastore.NewVersionedCtx(kv, versionID)
+	written, found, err := kv.GetModified(ctx, "lease1")
+	if err != nil || !found {
+		t.Fatalf("expected last-modified for written key: %v\n", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	server.TestHTTP(t, "POST", touchreq, nil)
+	touched, found, err := kv.GetModified(ctx, "lease1")
+	if err != nil || !found {
+		t.Fatalf("expected last-modified for touched key: %v\n", err)
+	}
+	if !touched.After(written) {
+		t.Errorf("expected touch to advance last-modified from %s, got %s\n", written, touched)
+	}
+	if value := server.TestHTTP(t, "GET", keyreq, nil); string(value) != "holder" {
+		t.Errorf("expected touch to leave value unchanged, got %q\n", string(value))
+	}
+}
+
 func TestKeyvalueUnversioned(t *testing.T) {
 	if err := server.OpenTest(); err != nil {
 		t.Fatalf("can't open test server: %v\n", err)
@@ -0,0 +1,55 @@
+/*
+	This file supports overriding the compression level of the instance's compression for
+	individual writes, e.g., faster compression for bulk ingest.
+*/
+
+package keyvalue
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// compressionWithLevel returns the instance's compression with the given level, which
+// must be from 1 (fastest) to 9 (smallest).  Only gzip compression supports levels.
+func (d *Data) compressionWithLevel(level dvid.CompressionLevel) (dvid.Compression, error) {
+	format := d.Compression().Format()
+	if format != dvid.Gzip {
+		return dvid.Compression{}, fmt.Errorf("compression level can't be set for keyvalue %q with %s", d.DataName(), format)
+	}
+	if level < dvid.BestSpeed || level > dvid.BestCompression {
+		return dvid.Compression{}, fmt.Errorf("compression level must be between %d and %d, not %d", dvid.BestSpeed, dvid.BestCompression, level)
+	}
+	return dvid.NewCompression(format, level)
+}
+
+// PutDataWithLevel puts a key-value compressed at the given level instead of the
+// instance's compression level.  Since the compression format is unchanged, the value is
+// read like any other.  Values are written directly even if the instance coalesces writes.
+func (d *Data) PutDataWithLevel(ctx storage.Context, keyStr string, value []byte, level dvid.CompressionLevel) error {
+	compress, err := d.compressionWithLevel(level)
+	if err != nil {
+		return err
+	}
+	d.flushWrites()
+	return d.writeData(ctx, keyStr, value, nil, &compress, nil)
+}
+
+// putDataWithLevel puts a key-value compressed at the level given by a "level" query
+// string, marking phases on the given timing, which can be nil.
+func (d *Data) putDataWithLevel(ctx storage.Context, keyStr string, value []byte, levelStr string, timing *server.ServerTiming) error {
+	level, err := strconv.ParseInt(levelStr, 10, 8)
+	if err != nil {
+		return fmt.Errorf("bad compression level %q: %v", levelStr, err)
+	}
+	compress, err := d.compressionWithLevel(dvid.CompressionLevel(level))
+	if err != nil {
+		return err
+	}
+	d.flushWrites()
+	return d.writeData(ctx, keyStr, value, nil, &compress, timing)
+}
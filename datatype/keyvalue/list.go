@@ -0,0 +1,126 @@
+/*
+	This file supports listing keys one level below a prefix, treating a delimiter within
+	keys as a hierarchy separator like object store listings, and counting keys by their
+	top-level prefix.
+*/
+
+package keyvalue
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// KeyListing gives the keys one level below a prefix.
+type KeyListing struct {
+	Keys           []string // keys with the prefix and no delimiter past it
+	CommonPrefixes []string // distinct key prefixes through the first delimiter past the prefix
+}
+
+// ListKeys returns, in order, the keys beginning with the prefix that have no delimiter
+// past the prefix, and the distinct prefixes of the remaining keys through the first
+// delimiter past the prefix.  An empty delimiter lists all keys with the prefix.
+func (d *Data) ListKeys(ctx storage.Context, prefix, delimiter string) (*KeyListing, error) {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	first, last := storage.PrefixRange(keyStandard, []byte(prefix))
+	tks, err := db.KeysInRange(ctx, first, last)
+	if err != nil {
+		return nil, err
+	}
+	listing := &KeyListing{Keys: []string{}, CommonPrefixes: []string{}}
+	for _, tk := range tks {
+		keyStr, err := DecodeTKey(tk)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(keyStr, prefix) {
+			continue
+		}
+		pos := -1
+		if delimiter != "" {
+			pos = strings.Index(keyStr[len(prefix):], delimiter)
+		}
+		if pos < 0 {
+			listing.Keys = append(listing.Keys, keyStr)
+			continue
+		}
+		// keys are ordered, so keys sharing a common prefix are adjacent.
+		common := keyStr[:len(prefix)+pos+len(delimiter)]
+		n := len(listing.CommonPrefixes)
+		if n == 0 || listing.CommonPrefixes[n-1] != common {
+			listing.CommonPrefixes = append(listing.CommonPrefixes, common)
+		}
+	}
+	return listing, nil
+}
+
+// PrefixCount is the number of keys sharing a top-level prefix.
+type PrefixCount struct {
+	Prefix string // key prefix through the first delimiter
+	Count  uint64
+}
+
+// PrefixCounts summarizes the keys in a range by their top-level prefix.
+type PrefixCounts struct {
+	Prefixes   []PrefixCount // counts of keys by prefix, in key order
+	Unprefixed uint64        // number of keys without the delimiter
+	Total      uint64        // number of keys in the range
+}
+
+// CountKeysByPrefix scans the keys between keyBeg and keyEnd, inclusive, and counts them
+// by their prefix through the first delimiter.  An empty keyBeg or keyEnd leaves that end
+// of the range unbounded.
+func (d *Data) CountKeysByPrefix(ctx storage.Context, keyBeg, keyEnd, delimiter string) (*PrefixCounts, error) {
+	if delimiter == "" {
+		return nil, fmt.Errorf("counting keys by prefix requires a delimiter")
+	}
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	first, last := storage.PrefixRange(keyStandard, nil)
+	if keyBeg != "" {
+		if first, err = NewTKey(keyBeg); err != nil {
+			return nil, err
+		}
+	}
+	if keyEnd != "" {
+		if last, err = NewTKey(keyEnd); err != nil {
+			return nil, err
+		}
+	}
+	tks, err := db.KeysInRange(ctx, first, last)
+	if err != nil {
+		return nil, err
+	}
+	counts := &PrefixCounts{Prefixes: []PrefixCount{}}
+	for _, tk := range tks {
+		keyStr, err := DecodeTKey(tk)
+		if err != nil {
+			return nil, err
+		}
+		counts.Total++
+		pos := strings.Index(keyStr, delimiter)
+		if pos < 0 {
+			counts.Unprefixed++
+			continue
+		}
+		// keys are ordered, so keys sharing a prefix are adjacent.
+		prefix := keyStr[:pos+len(delimiter)]
+		n := len(counts.Prefixes)
+		if n == 0 || counts.Prefixes[n-1].Prefix != prefix {
+			counts.Prefixes = append(counts.Prefixes, PrefixCount{Prefix: prefix})
+			n++
+		}
+		counts.Prefixes[n-1].Count++
+	}
+	return counts, nil
+}
@@ -0,0 +1,68 @@
+/*
+	This file supports an optional limit on the number of keys in an instance, where the
+	key count is maintained incrementally in the metadata store.
+*/
+
+package keyvalue
+
+import (
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// withKeyLimit calls write, which should leave each given key present or absent as given
+// by final, and updates the instance's key count.  If the instance has a MaxKeys limit
+// and write would add keys beyond it, write is not called and an error wrapping
+// storage.ErrQuotaExceeded is returned.  Overwrites of existing keys are always allowed.
+func (d *Data) withKeyLimit(ctx storage.Context, db storage.OrderedKeyValueDB, final map[string]bool, write func() error) error {
+	if d.MaxKeys == 0 {
+		return write()
+	}
+	d.keyCountMu.Lock()
+	defer d.keyCountMu.Unlock()
+
+	var added, removed uint64
+	for keyStr, present := range final {
+		tk, err := NewTKey(keyStr)
+		if err != nil {
+			return err
+		}
+		data, err := db.Get(ctx, tk)
+		if err != nil {
+			return err
+		}
+		existed := data != nil
+		if present && !existed {
+			added++
+		} else if !present && existed {
+			removed++
+		}
+	}
+	if added > removed {
+		if err := datastore.AddKeys(d, added-removed, d.MaxKeys); err != nil {
+			return err
+		}
+	}
+	if err := write(); err != nil {
+		if added > removed {
+			if err2 := datastore.RemoveKeys(d, added-removed); err2 != nil {
+				return fmt.Errorf("%w (also unable to restore key count: %v)", err, err2)
+			}
+		}
+		return err
+	}
+	if removed > added {
+		return datastore.RemoveKeys(d, removed-added)
+	}
+	return nil
+}
+
+// CountsTKey returns true for the type-specific keys of user key-value pairs, so rebuilt key
+// counts exclude internal keys like tombstones and chunks.  Implements the
+// datastore.CountedKeyFilter interface.
+func (d *Data) CountsTKey(tk storage.TKey) bool {
+	class, err := tk.Class()
+	return err == nil && class == keyStandard
+}
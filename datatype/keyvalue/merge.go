@@ -0,0 +1,304 @@
+/*
+	This file supports merging two branches of a versioned keyvalue instance into a new
+	version, resolving keys changed on both branches with a conflict policy.
+*/
+
+package keyvalue
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// MergePolicy determines how keys with different values on both merged branches are resolved.
+type MergePolicy string
+
+const (
+	MergeOurs   MergePolicy = "ours"   // conflicting keys take the value of the first branch
+	MergeTheirs MergePolicy = "theirs" // conflicting keys take the value of the second branch
+	MergeError  MergePolicy = "error"  // any conflicting key prevents the merge
+)
+
+// MergeResult describes the resolution of keys written on both branches of a merge.  If
+// the merge was prevented by conflicts, Resolved is empty.
+type MergeResult struct {
+	Resolved  []string `json:",omitempty"` // keys written to the merged version
+	Conflicts []string // keys with different values on both branches
+}
+
+// mergeConflict holds the values of a key with different values on both branches.
+type mergeConflict struct {
+	key          string
+	ours, theirs []byte // nil if deleted
+}
+
+// branchVersions returns the versions that are ancestors of v, including v, but not of other.
+func branchVersions(v, other dvid.VersionID) (map[dvid.VersionID]bool, error) {
+	branch, err := datastore.GetAncestorVersions(v)
+	if err != nil {
+		return nil, err
+	}
+	common, err := datastore.GetAncestorVersions(other)
+	if err != nil {
+		return nil, err
+	}
+	for cv := range common {
+		delete(branch, cv)
+	}
+	return branch, nil
+}
+
+// MergeVersions resolves the keys of a merged version, e.g., one created by a repo-level
+// conflict-free merge, whose two parents are branches "ours" and "theirs" in parent order.
+// Any key written on both branches since they diverged is explicitly stored in the merged
+// version, where keys with different values on each branch are resolved by the policy.
+// The winning values and their custom metadata are written through the instance's usual
+// write path, so index entries and last-modified timestamps are kept, and the writes are
+// audited for the given user.  If the policy is MergeError and there are conflicting keys,
+// nothing is written.
+func (d *Data) MergeVersions(merged dvid.UUID, policy MergePolicy, user string) (*MergeResult, error) {
+	switch policy {
+	case MergeOurs, MergeTheirs, MergeError:
+	default:
+		return nil, fmt.Errorf("merge policy must be %q, %q, or %q, not %q", MergeOurs, MergeTheirs, MergeError, policy)
+	}
+	if !d.Versioned() {
+		return nil, fmt.Errorf("keyvalue %q is unversioned so has no branches to merge", d.DataName())
+	}
+	d.flushWrites()
+	mergedV, err := datastore.VersionFromUUID(merged)
+	if err != nil {
+		return nil, err
+	}
+	parents, err := datastore.GetParentsByVersion(mergedV)
+	if err != nil {
+		return nil, err
+	}
+	if len(parents) != 2 {
+		return nil, fmt.Errorf("version %s has %d parents so isn't a merge of two branches", merged, len(parents))
+	}
+	oursV, theirsV := parents[0], parents[1]
+	oursOnly, err := branchVersions(oursV, theirsV)
+	if err != nil {
+		return nil, err
+	}
+	theirsOnly, err := branchVersions(theirsV, oursV)
+	if err != nil {
+		return nil, err
+	}
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	batcher, ok := db.(storage.KeyValueBatcher)
+	if !ok {
+		return nil, fmt.Errorf("keyvalue %q merges require a batch-capable store", d.DataName())
+	}
+
+	// find type-specific keys written on both branches from a scan of all stored keys,
+	// which are ordered by type-specific key and then version.
+	var both []storage.TKey
+	var scanErr error
+	baseCtx := storage.NewDataContext(d, 0)
+	ch := make(chan *storage.KeyValue, 1000)
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var curTK storage.TKey
+		var inOurs, inTheirs bool
+		for {
+			kv := <-ch
+			var tk storage.TKey
+			var v dvid.VersionID
+			if kv != nil && scanErr == nil {
+				if tk, scanErr = storage.TKeyFromKey(kv.K); scanErr == nil {
+					v, scanErr = baseCtx.VersionFromKey(kv.K)
+				}
+			}
+			if kv == nil || !bytes.Equal(tk, curTK) {
+				if inOurs && inTheirs {
+					both = append(both, curTK)
+				}
+				if kv == nil {
+					return
+				}
+				curTK, inOurs, inTheirs = tk, false, false
+			}
+			inOurs = inOurs || oursOnly[v]
+			inTheirs = inTheirs || theirsOnly[v]
+		}
+	}()
+	minKey, maxKey := baseCtx.KeyRange()
+	keysOnly := true
+	if err = db.RawRangeQuery(minKey, maxKey, keysOnly, ch, nil); err != nil {
+		return nil, err
+	}
+	wg.Wait()
+	if scanErr != nil {
+		return nil, scanErr
+	}
+
+	oursCtx := datastore.NewVersionedCtx(d, oursV)
+	theirsCtx := datastore.NewVersionedCtx(d, theirsV)
+	result := &MergeResult{Conflicts: []string{}}
+	var keys []string
+	var conflicts []mergeConflict
+	for _, tk := range both {
+		if class, err := tk.Class(); err != nil || class != keyStandard {
+			continue
+		}
+		keyStr, err := DecodeTKey(tk)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, keyStr)
+		oursValue, oursFound, err := d.GetData(oursCtx, keyStr)
+		if err != nil {
+			return nil, err
+		}
+		theirsValue, theirsFound, err := d.GetData(theirsCtx, keyStr)
+		if err != nil {
+			return nil, err
+		}
+		if oursFound == theirsFound && bytes.Equal(oursValue, theirsValue) {
+			continue
+		}
+		result.Conflicts = append(result.Conflicts, keyStr)
+		if !oursFound {
+			oursValue = nil
+		}
+		if !theirsFound {
+			theirsValue = nil
+		}
+		conflicts = append(conflicts, mergeConflict{keyStr, oursValue, theirsValue})
+	}
+	if policy == MergeError && len(conflicts) != 0 {
+		return result, nil
+	}
+
+	// read all winning values and metadata as stored, so they keep any raw encoding or
+	// compression level, before writing any of them.
+	winnerCtx := oursCtx
+	if policy == MergeTheirs {
+		winnerCtx = theirsCtx
+	}
+	ops := make([]TxnOp, len(keys))
+	metas := make([][]byte, len(keys))
+	for i, keyStr := range keys {
+		value, serialization, found, err := d.readStored(winnerCtx, db, keyStr)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			ops[i] = TxnOp{Op: "delete", Key: keyStr}
+			continue
+		}
+		ops[i] = TxnOp{Op: "put", Key: keyStr, Value: value, stored: serialization, dropMeta: true}
+		if metas[i], err = db.Get(winnerCtx, NewMetaTKey(keyStr)); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := datastore.NewVersionedCtx(d, mergedV)
+	batch := batcher.NewBatch(ctx)
+	commit := func() error {
+		// metadata of the winning values replaces any dropped by their puts.
+		for i, op := range ops {
+			if metas[i] != nil {
+				batch.Put(NewMetaTKey(op.Key), metas[i])
+			}
+		}
+		// index entries of the losing values were written on only one branch, so remove
+		// them and make sure the winning entries aren't hidden by a deletion on the losing
+		// branch.
+		if d.IndexField != "" {
+			for _, c := range conflicts {
+				winner, loser := c.ours, c.theirs
+				if policy == MergeTheirs {
+					winner, loser = c.theirs, c.ours
+				}
+				winnerEntry, loserEntry := d.valueIndexEntry(winner), d.valueIndexEntry(loser)
+				if loserEntry.found && loserEntry != winnerEntry {
+					batch.Delete(NewIndexTKey(loserEntry.field, c.key))
+				}
+				if winnerEntry.found {
+					storage.PutUnmetered(batch, NewIndexTKey(winnerEntry.field, c.key), []byte{})
+				}
+			}
+		}
+		return batch.Commit()
+	}
+	d.indexMu.RLock()
+	err = d.stageTransaction(ctx, db, batch, ops, commit)
+	d.indexMu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	audit := d.auditorFor(merged, user)
+	for _, op := range ops {
+		if op.Op == "delete" {
+			audit.delete(op.Key)
+		} else {
+			audit.put(op.Key, len(op.Value))
+		}
+	}
+	result.Resolved = keys
+	return result, nil
+}
+
+// handleMerge resolves the keys of the merged version of the request with the policy given
+// in the JSON request body.
+func (d *Data) handleMerge(w http.ResponseWriter, r *http.Request, uuid dvid.UUID) (*MergeResult, error) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	var req struct {
+		Policy MergePolicy
+	}
+	if len(data) != 0 {
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, fmt.Errorf("malformed JSON request in body: %v", err)
+		}
+	}
+	if req.Policy == "" {
+		req.Policy = MergeError
+	}
+	result, err := d.MergeVersions(uuid, req.Policy, r.URL.Query().Get("u"))
+	if err != nil {
+		return nil, err
+	}
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if req.Policy == MergeError && len(result.Conflicts) != 0 {
+		w.WriteHeader(http.StatusConflict)
+	}
+	_, err = w.Write(jsonBytes)
+	return result, err
+}
+
+// IsMutationSubrequest treats the POSTs of keyvalues/exists, keyvalues/stat, and
+// keyvalues/stream as reads since they only send keys in the request body.  Implements the
+// datastore.SubpathMutationChecker interface.
+func (d *Data) IsMutationSubrequest(action, endpoint, subpath string) bool {
+	if endpoint == "keyvalues" && strings.ToLower(action) == "post" {
+		switch strings.SplitN(subpath, "/", 2)[0] {
+		case "exists", "stat", "stream":
+			return false
+		}
+	}
+	return d.IsMutationRequest(action, endpoint)
+}
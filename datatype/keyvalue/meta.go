@@ -0,0 +1,141 @@
+/*
+	This file supports custom metadata for keys, sent as "X-DVID-Meta-" prefixed headers on
+	POSTs and returned as headers on GETs.
+*/
+
+package keyvalue
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// KeyMetadataPrefix is the prefix of request and response headers holding custom key
+// metadata, in canonical header form.
+const KeyMetadataPrefix = "X-Dvid-Meta-"
+
+// MaxKeyMetadataBytes is the maximum total size of the names and values of a key's custom
+// metadata.
+const MaxKeyMetadataBytes = 8192
+
+// KeyMetadata maps custom metadata names, in canonical header form without the
+// KeyMetadataPrefix, to their values.
+type KeyMetadata map[string]string
+
+// MetadataFromHeader returns the custom key metadata in the given headers or nil if there
+// is none.  Multiple values of a header are joined with commas.  An error is returned if
+// the metadata exceeds MaxKeyMetadataBytes.
+func MetadataFromHeader(h http.Header) (KeyMetadata, error) {
+	var meta KeyMetadata
+	var size int
+	for name, values := range h {
+		name = http.CanonicalHeaderKey(name)
+		if !strings.HasPrefix(name, KeyMetadataPrefix) || len(name) == len(KeyMetadataPrefix) {
+			continue
+		}
+		if meta == nil {
+			meta = make(KeyMetadata)
+		}
+		name = name[len(KeyMetadataPrefix):]
+		value := strings.Join(values, ",")
+		meta[name] = value
+		size += len(name) + len(value)
+	}
+	if size > MaxKeyMetadataBytes {
+		return nil, fmt.Errorf("key metadata has %d bytes, more than the maximum of %d", size, MaxKeyMetadataBytes)
+	}
+	return meta, nil
+}
+
+// SetHeader adds the metadata to the given headers with the KeyMetadataPrefix.
+func (meta KeyMetadata) SetHeader(h http.Header) {
+	for name, value := range meta {
+		h.Set(KeyMetadataPrefix+name, value)
+	}
+}
+
+// PutKeyMetadata replaces the custom metadata of a key, removing it if meta is empty.
+func (d *Data) PutKeyMetadata(ctx storage.Context, keyStr string, meta KeyMetadata) error {
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	if len(meta) == 0 {
+		return d.deleteKeyMetadata(ctx, db, keyStr)
+	}
+	var size int
+	for name, value := range meta {
+		size += len(name) + len(value)
+	}
+	if size > MaxKeyMetadataBytes {
+		return fmt.Errorf("key metadata has %d bytes, more than the maximum of %d", size, MaxKeyMetadataBytes)
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return db.Put(ctx, NewMetaTKey(keyStr), data)
+}
+
+// GetKeyMetadata returns the custom metadata of a key, which is empty if none was stored.
+// If the key doesn't exist, found is false.
+func (d *Data) GetKeyMetadata(ctx storage.Context, keyStr string) (meta KeyMetadata, found bool, err error) {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return
+	}
+	tk, err := NewTKey(keyStr)
+	if err != nil {
+		return
+	}
+	if found, err = keyExists(ctx, db, tk); err != nil || !found {
+		return
+	}
+	if meta, err = getKeyMetadata(ctx, db, keyStr); err != nil {
+		return
+	}
+	if meta == nil {
+		meta = KeyMetadata{}
+	}
+	return
+}
+
+// storedKeyMetadata returns the custom metadata of a key that's already been read, or nil
+// if there is none, without flushing buffered writes or checking the key exists.
+func (d *Data) storedKeyMetadata(ctx storage.Context, keyStr string) (KeyMetadata, error) {
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	return getKeyMetadata(ctx, db, keyStr)
+}
+
+// getKeyMetadata returns the stored custom metadata of a key or nil if there is none.
+func getKeyMetadata(ctx storage.Context, db storage.OrderedKeyValueDB, keyStr string) (KeyMetadata, error) {
+	data, err := db.Get(ctx, NewMetaTKey(keyStr))
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var meta KeyMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("bad metadata stored for key %q: %v", keyStr, err)
+	}
+	return meta, nil
+}
+
+// deleteKeyMetadata removes any custom metadata of a key.  It's checked first so deletes
+// of keys without metadata don't write tombstones for it.
+func (d *Data) deleteKeyMetadata(ctx storage.Context, db storage.OrderedKeyValueDB, keyStr string) error {
+	metaTK := NewMetaTKey(keyStr)
+	exists, err := keyExists(ctx, db, metaTK)
+	if err != nil || !exists {
+		return err
+	}
+	return db.Delete(ctx, metaTK)
+}
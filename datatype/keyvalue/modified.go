@@ -0,0 +1,114 @@
+/*
+	This file supports optional last-modified timestamps for keys, stored alongside
+	each key and updated on writes or touches.
+*/
+
+package keyvalue
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// timestamps are stored as 8-byte Unix nanoseconds.
+func encodeTimestamp(t time.Time) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(t.UnixNano()))
+	return buf
+}
+
+func decodeTimestamp(data []byte) (time.Time, error) {
+	if len(data) != 8 {
+		return time.Time{}, fmt.Errorf("bad keyvalue timestamp with %d bytes", len(data))
+	}
+	return time.Unix(0, int64(binary.LittleEndian.Uint64(data))), nil
+}
+
+// putWithModified atomically puts a serialized value and its last-modified timestamp.
+func (d *Data) putWithModified(ctx storage.Context, db storage.OrderedKeyValueDB, keyStr string, tk storage.TKey, serialization []byte) error {
+	batcher, ok := db.(storage.KeyValueBatcher)
+	if !ok {
+		return fmt.Errorf("keyvalue %q last-modified tracking requires a batch-capable store", d.DataName())
+	}
+	modTK, err := NewModifiedTKey(keyStr)
+	if err != nil {
+		return err
+	}
+	batch := batcher.NewBatch(ctx)
+	batch.Put(tk, serialization)
+	storage.PutUnmetered(batch, modTK, encodeTimestamp(time.Now()))
+	return batch.Commit()
+}
+
+// deleteModified removes the last-modified timestamp of a key.
+func (d *Data) deleteModified(ctx storage.Context, db storage.OrderedKeyValueDB, keyStr string) error {
+	modTK, err := NewModifiedTKey(keyStr)
+	if err != nil {
+		return err
+	}
+	return db.Delete(ctx, modTK)
+}
+
+// GetModified returns the last-modified time of a key.  If the instance doesn't track
+// modifications or the key was written before tracking was enabled, found is false.
+func (d *Data) GetModified(ctx storage.Context, keyStr string) (modified time.Time, found bool, err error) {
+	if !d.TrackModified {
+		return
+	}
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return
+	}
+	return getModified(ctx, db, keyStr)
+}
+
+// getModified returns the stored last-modified time of a key without flushing buffered
+// writes.
+func getModified(ctx storage.Context, db storage.OrderedKeyValueDB, keyStr string) (modified time.Time, found bool, err error) {
+	modTK, err := NewModifiedTKey(keyStr)
+	if err != nil {
+		return
+	}
+	data, err := db.Get(ctx, modTK)
+	if err != nil || data == nil {
+		return
+	}
+	if modified, err = decodeTimestamp(data); err != nil {
+		return
+	}
+	return modified, true, nil
+}
+
+// TouchData sets the last-modified time of an existing key to now without rewriting
+// its value.  If the key doesn't exist, found is false.
+func (d *Data) TouchData(ctx storage.Context, keyStr string) (found bool, err error) {
+	d.flushWrites()
+	if !d.TrackModified {
+		return false, fmt.Errorf("keyvalue %q does not track last-modified times; set TrackModified to touch keys", d.DataName())
+	}
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return false, err
+	}
+	tk, err := NewTKey(keyStr)
+	if err != nil {
+		return false, err
+	}
+	exists, err := keyExists(ctx, db, tk)
+	if err != nil || !exists {
+		return false, err
+	}
+	modTK, err := NewModifiedTKey(keyStr)
+	if err != nil {
+		return false, err
+	}
+	if err = storage.Unmetered(db).Put(ctx, modTK, encodeTimestamp(time.Now())); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,70 @@
+/*
+	This file supports values stored exactly as sent by clients that manage their own
+	encoding, bypassing DVID compression and checksums.
+*/
+
+package keyvalue
+
+import (
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// rawValueMarker is the first byte of a serialization holding a value stored as sent.
+// Like dedupRefMarker, it can't be confused with a serialized value.
+const rawValueMarker = 0x03
+
+// RawEncoding gives the HTTP content type and encoding of a value stored as sent, which
+// are returned with the value.
+type RawEncoding struct {
+	ContentType     string
+	ContentEncoding string
+}
+
+// encodeRawValue returns the marker, then the length-prefixed content type and encoding,
+// followed by the value.
+func encodeRawValue(raw RawEncoding, value []byte) ([]byte, error) {
+	if len(raw.ContentType) > 255 || len(raw.ContentEncoding) > 255 {
+		return nil, fmt.Errorf("content type and encoding of raw values must be at most 255 bytes")
+	}
+	buf := make([]byte, 0, 3+len(raw.ContentType)+len(raw.ContentEncoding)+len(value))
+	buf = append(buf, rawValueMarker, byte(len(raw.ContentType)))
+	buf = append(buf, raw.ContentType...)
+	buf = append(buf, byte(len(raw.ContentEncoding)))
+	buf = append(buf, raw.ContentEncoding...)
+	return append(buf, value...), nil
+}
+
+// decodeRawValue returns the encoding and value of a serialization stored as sent, or a
+// nil encoding if the serialization isn't a raw value.
+func decodeRawValue(data []byte) (raw *RawEncoding, value []byte, err error) {
+	if len(data) == 0 || data[0] != rawValueMarker {
+		return nil, nil, nil
+	}
+	pos := 1
+	field := func() (string, error) {
+		if pos >= len(data) || pos+1+int(data[pos]) > len(data) {
+			return "", fmt.Errorf("truncated raw value header")
+		}
+		s := string(data[pos+1 : pos+1+int(data[pos])])
+		pos += 1 + int(data[pos])
+		return s, nil
+	}
+	raw = new(RawEncoding)
+	if raw.ContentType, err = field(); err != nil {
+		return nil, nil, err
+	}
+	if raw.ContentEncoding, err = field(); err != nil {
+		return nil, nil, err
+	}
+	return raw, data[pos:], nil
+}
+
+// PutRawData puts a key-value where the value is stored and later returned exactly as
+// given, along with its content type and encoding, instead of being serialized with the
+// instance's compression and checksum.  Any value hooks are still applied.
+func (d *Data) PutRawData(ctx storage.Context, keyStr string, value []byte, raw RawEncoding) error {
+	d.flushWrites()
+	return d.writeData(ctx, keyStr, value, &raw, nil, nil)
+}
@@ -0,0 +1,174 @@
+/*
+	This file supports rebuilding the secondary index of a JSON value field from all stored
+	values, e.g., after an index is added to an instance that already has keys.
+*/
+
+package keyvalue
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// reindexBatchSize is the number of keys processed while index-updating writes are held off.
+const reindexBatchSize = 1000
+
+// ReindexStatus gives the progress of the latest reindex of an instance.
+type ReindexStatus struct {
+	Running bool
+	Phase   string // "index" while indexing values, then "prune" while removing stale entries
+	LastKey string // last key indexed, which can be used to resume an interrupted reindex
+	Indexed int    // keys whose values have an indexed field
+	Pruned  int    // stale index entries removed
+	Error   string `json:",omitempty"`
+}
+
+// errBatchFull stops a range scan once a batch of keys has been processed.
+var errBatchFull = errors.New("reindex batch full")
+
+// GetReindexStatus returns the progress of the latest reindex.
+func (d *Data) GetReindexStatus() ReindexStatus {
+	d.reindexMu.Lock()
+	defer d.reindexMu.Unlock()
+	return d.reindexStatus
+}
+
+func (d *Data) updateReindexStatus(f func(*ReindexStatus)) {
+	d.reindexMu.Lock()
+	f(&d.reindexStatus)
+	d.reindexMu.Unlock()
+}
+
+// StartReindex rebuilds the secondary index for the version of the given context in the
+// background, beginning with the first key past the given key if it is non-empty.
+func (d *Data) StartReindex(ctx storage.Context, after string) error {
+	if d.IndexField == "" {
+		return fmt.Errorf("keyvalue %q has no secondary index; set IndexField first", d.DataName())
+	}
+	d.reindexMu.Lock()
+	if d.reindexStatus.Running {
+		d.reindexMu.Unlock()
+		return fmt.Errorf("keyvalue %q is already being reindexed", d.DataName())
+	}
+	d.reindexStatus = ReindexStatus{Running: true, Phase: "index", LastKey: after}
+	d.reindexMu.Unlock()
+
+	go func() {
+		err := d.Reindex(ctx, after)
+		d.updateReindexStatus(func(s *ReindexStatus) {
+			s.Running = false
+			if err != nil {
+				s.Error = err.Error()
+			}
+		})
+		status := d.GetReindexStatus()
+		if err != nil {
+			dvid.Errorf("reindex of keyvalue %q stopped after key %q: %v\n", d.DataName(), status.LastKey, err)
+			return
+		}
+		dvid.Infof("Reindexed keyvalue %q field %q: %d keys indexed, %d stale entries pruned\n",
+			d.DataName(), d.IndexField, status.Indexed, status.Pruned)
+	}()
+	return nil
+}
+
+// Reindex writes the index entry of every key visible in the given context, beginning
+// with the first key past the given key if it is non-empty, then removes index entries
+// that don't match the current values.  Writes that update the index are held off while
+// each batch of keys is processed, so the index is consistent when it completes.
+func (d *Data) Reindex(ctx storage.Context, after string) error {
+	if d.IndexField == "" {
+		return fmt.Errorf("keyvalue %q has no secondary index; set IndexField first", d.DataName())
+	}
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+
+	_, last := storage.PrefixRange(keyStandard, nil)
+	for {
+		first, err := NewTKey(after)
+		if err != nil {
+			return err
+		}
+		var n int
+		d.indexMu.Lock()
+		err = d.processKeyValues(ctx, db, first, last, "", func(keyStr string, value []byte) error {
+			if keyStr == after {
+				return nil
+			}
+			if n == reindexBatchSize {
+				return errBatchFull
+			}
+			n++
+			after = keyStr
+			if entry := d.valueIndexEntry(value); entry.found {
+				if err := storage.Unmetered(db).Put(ctx, NewIndexTKey(entry.field, keyStr), []byte{}); err != nil {
+					return err
+				}
+				d.updateReindexStatus(func(s *ReindexStatus) { s.Indexed++ })
+			}
+			return nil
+		})
+		d.indexMu.Unlock()
+		if err != nil && err != errBatchFull {
+			return err
+		}
+		d.updateReindexStatus(func(s *ReindexStatus) { s.LastKey = after })
+		if err == nil {
+			break
+		}
+		dvid.Infof("Reindexing keyvalue %q: through key %q\n", d.DataName(), after)
+	}
+
+	d.updateReindexStatus(func(s *ReindexStatus) { s.Phase = "prune" })
+	indexFirst, indexLast := storage.PrefixRange(keyIndex, nil)
+	tks, err := db.KeysInRange(ctx, indexFirst, indexLast)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(tks); start += reindexBatchSize {
+		end := start + reindexBatchSize
+		if end > len(tks) {
+			end = len(tks)
+		}
+		d.indexMu.Lock()
+		err = d.pruneIndex(ctx, db, tks[start:end])
+		d.indexMu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneIndex deletes the given index entries that don't match the stored values.
+func (d *Data) pruneIndex(ctx storage.Context, db storage.OrderedKeyValueDB, tks []storage.TKey) error {
+	for _, tk := range tks {
+		fieldValue, keyStr, err := DecodeIndexTKey(tk)
+		if err != nil {
+			return err
+		}
+		keyTK, err := NewTKey(keyStr)
+		if err != nil {
+			return err
+		}
+		entry, err := d.storedIndexEntry(ctx, db, keyStr, keyTK)
+		if err != nil {
+			return err
+		}
+		if entry.found && entry.field == fieldValue {
+			continue
+		}
+		if err := db.Delete(ctx, tk); err != nil {
+			return err
+		}
+		d.updateReindexStatus(func(s *ReindexStatus) { s.Pruned++ })
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+/*
+	This file supports renaming all keys with a prefix to another prefix, e.g., to move a
+	namespace of keys from "v1/" to "v2/" without copying and deleting each key.
+*/
+
+package keyvalue
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// RenameBatchKeys is the number of keys renamed in each batch commit.  A rename of at most
+// this many keys is atomic if the store supports atomic batches.
+const RenameBatchKeys = 1000
+
+// Policies for renames whose destination key already exists.
+const (
+	RenameConflictError     = "error"     // fail the rename before any key is renamed
+	RenameConflictSkip      = "skip"      // leave the source and destination keys unchanged
+	RenameConflictOverwrite = "overwrite" // replace the destination value
+)
+
+// KeyRename is the renaming of a key.
+type KeyRename struct {
+	From string
+	To   string
+
+	bytes int // size of the renamed value, for auditing
+}
+
+// PrefixRenameResult is the response of a prefix rename.
+type PrefixRenameResult struct {
+	Renamed   int
+	Skipped   int
+	DryRun    bool
+	Conflicts []string    `json:",omitempty"` // destination keys that already existed
+	Renames   []KeyRename `json:",omitempty"`
+}
+
+// RenameKeysWithPrefix renames all keys beginning with the prefix from so they begin with
+// the prefix to instead.  Destination keys that already exist are handled by the conflict
+// policy, one of the RenameConflict constants.  Keys are renamed in batches of
+// RenameBatchKeys, each putting the new keys and deleting the old ones in one commit along
+// with any custom key metadata, and writes are held off during the rename.  The renames
+// made are returned, or if dryRun is true, nothing is renamed and the renames that would be
+// made are returned.
+func (d *Data) RenameKeysWithPrefix(ctx storage.Context, from, to, conflict string, dryRun bool) (*PrefixRenameResult, error) {
+	if from == "" || to == "" {
+		return nil, fmt.Errorf("prefix rename requires non-empty \"from\" and \"to\" prefixes")
+	}
+	if strings.HasPrefix(from, to) || strings.HasPrefix(to, from) {
+		return nil, fmt.Errorf("can't rename prefix %q to overlapping prefix %q", from, to)
+	}
+	switch conflict {
+	case RenameConflictError, RenameConflictSkip, RenameConflictOverwrite:
+	default:
+		return nil, fmt.Errorf("conflict policy must be %q, %q, or %q, got %q",
+			RenameConflictError, RenameConflictSkip, RenameConflictOverwrite, conflict)
+	}
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	batcher, ok := db.(storage.KeyValueBatcher)
+	if !ok && !dryRun {
+		return nil, fmt.Errorf("keyvalue %q renames require a batch-capable store", d.DataName())
+	}
+	d.indexMu.Lock()
+	defer d.indexMu.Unlock()
+
+	first, last := storage.PrefixRange(keyStandard, []byte(from))
+	tkeys, err := db.KeysInRange(ctx, first, last)
+	if err != nil {
+		return nil, err
+	}
+	result := &PrefixRenameResult{DryRun: dryRun}
+	var renames []KeyRename
+	conflicts := make(map[string]bool)
+	for _, tk := range tkeys {
+		keyStr, err := DecodeTKey(tk)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(keyStr, from) {
+			continue
+		}
+		rename := KeyRename{From: keyStr, To: to + keyStr[len(from):]}
+		toTK, err := NewTKey(rename.To)
+		if err != nil {
+			return nil, err
+		}
+		exists, err := keyExists(ctx, db, toTK)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			result.Conflicts = append(result.Conflicts, rename.To)
+			conflicts[rename.To] = true
+			if conflict == RenameConflictSkip {
+				result.Skipped++
+				continue
+			}
+		}
+		renames = append(renames, rename)
+	}
+	if dryRun {
+		result.Renamed = len(renames)
+		result.Renames = renames
+		return result, nil
+	}
+	if conflict == RenameConflictError && len(result.Conflicts) != 0 {
+		return nil, fmt.Errorf("%d destination keys already exist, e.g., %q; set conflict to %q or %q",
+			len(result.Conflicts), result.Conflicts[0], RenameConflictSkip, RenameConflictOverwrite)
+	}
+	for beg := 0; beg < len(renames); beg += RenameBatchKeys {
+		end := beg + RenameBatchKeys
+		if end > len(renames) {
+			end = len(renames)
+		}
+		if err := d.renameBatch(ctx, db, batcher, renames[beg:end], conflicts); err != nil {
+			return nil, fmt.Errorf("renamed %d of %d keys before error: %w", result.Renamed, len(renames), err)
+		}
+		result.Renamed += end - beg
+	}
+	result.Renames = renames
+	return result, nil
+}
+
+// renameBatch renames keys and moves their custom metadata in one batch commit, where
+// existing holds destination keys that already exist.  The caller must hold indexMu.
+func (d *Data) renameBatch(ctx storage.Context, db storage.OrderedKeyValueDB, batcher storage.KeyValueBatcher, renames []KeyRename, existing map[string]bool) error {
+	batch := batcher.NewBatch(ctx)
+	ops := make([]TxnOp, 0, 2*len(renames))
+	for i, rename := range renames {
+		value, raw, found, err := d.readDataAs(ctx, rename.From, nil)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		renames[i].bytes = len(value)
+		ops = append(ops, TxnOp{Op: "put", Key: rename.To, Value: value, raw: raw}, TxnOp{Op: "delete", Key: rename.From})
+		meta, err := db.Get(ctx, NewMetaTKey(rename.From))
+		if err != nil {
+			return err
+		}
+		if meta != nil {
+			batch.Put(NewMetaTKey(rename.To), meta)
+			batch.Delete(NewMetaTKey(rename.From))
+		} else if existing[rename.To] {
+			batch.Delete(NewMetaTKey(rename.To))
+		}
+	}
+	return d.stageTransaction(ctx, db, batch, ops, batch.Commit)
+}
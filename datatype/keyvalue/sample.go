@@ -0,0 +1,72 @@
+/*
+	This file supports sampling every Nth key of a range, e.g., to preview the keyspace of a
+	large instance without returning all of its keys.
+*/
+
+package keyvalue
+
+import (
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// GetSampledKeysInRange returns every step-th key between keyBeg and keyEnd, inclusive,
+// starting with the first key of the range.  Keys are counted as they are read so only the
+// sampled keys are held, but the whole range is still scanned.
+func (d *Data) GetSampledKeysInRange(ctx storage.Context, keyBeg, keyEnd string, step int) ([]string, error) {
+	return d.sampleKeysInRange(ctx, keyBeg, keyEnd, step, 0)
+}
+
+// sampleKeysInRange returns sampled keys as GetSampledKeysInRange, stopping the scan once
+// max+1 keys are sampled if max is positive.
+func (d *Data) sampleKeysInRange(ctx storage.Context, keyBeg, keyEnd string, step, max int) ([]string, error) {
+	if step < 1 {
+		return nil, fmt.Errorf("sampling step must be a positive integer, got %d", step)
+	}
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	first, err := NewTKey(keyBeg)
+	if err != nil {
+		return nil, err
+	}
+	last, err := NewTKey(keyEnd)
+	if err != nil {
+		return nil, err
+	}
+	keyList := []string{}
+	var n int
+	sample := func(key string) error {
+		if n%step == 0 {
+			keyList = append(keyList, key)
+			if max > 0 && len(keyList) > max {
+				return errKeyLimit
+			}
+		}
+		n++
+		return nil
+	}
+	if max <= 0 {
+		err = processKeysInRange(ctx, db, first, last, sample)
+	} else {
+		// a key-only scan can't be stopped early, so the limited scan reads the range's chunks.
+		err = db.ProcessRange(ctx, first, last, nil, func(c *storage.Chunk) error {
+			if c == nil || c.TKeyValue == nil {
+				return nil
+			}
+			keyStr, err := DecodeTKey(c.K)
+			if err != nil {
+				return err
+			}
+			return sample(keyStr)
+		})
+	}
+	if err != nil && err != errKeyLimit {
+		return nil, err
+	}
+	return keyList, nil
+}
@@ -0,0 +1,363 @@
+/*
+	This file supports validating JSON values against a JSON Schema set for an instance.
+	A commonly used subset of JSON Schema is supported: type, enum, properties, required,
+	additionalProperties, items, minimum, maximum, minLength, maxLength, minItems, maxItems,
+	and pattern.  Other keywords are ignored.
+*/
+
+package keyvalue
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// jsonSchema is a parsed JSON Schema or subschema.
+type jsonSchema struct {
+	Types                []string
+	Enum                 []interface{}
+	Properties           map[string]*jsonSchema
+	Required             []string
+	AdditionalProperties *jsonSchema // nil if any are allowed
+	NoAdditional         bool        // true if additionalProperties is false
+	Items                *jsonSchema
+	Minimum, Maximum     *float64
+	MinLength, MaxLength *int
+	MinItems, MaxItems   *int
+	Pattern              *regexp.Regexp
+}
+
+// SchemaError describes where a value doesn't match an instance's JSON Schema.
+type SchemaError struct {
+	Path    string // JSON Pointer to the failing part of the value, e.g., "/owner/name"
+	Message string
+}
+
+func (e *SchemaError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("value doesn't match JSON schema at %q: %s", path, e.Message)
+}
+
+// parseJSONSchema parses the JSON text of a schema.
+func parseJSONSchema(text string) (*jsonSchema, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(text), &v); err != nil {
+		return nil, fmt.Errorf("bad JSON schema: %v", err)
+	}
+	return compileSchema(v, "")
+}
+
+func compileSchema(v interface{}, path string) (*jsonSchema, error) {
+	if b, ok := v.(bool); ok {
+		if b {
+			return &jsonSchema{}, nil
+		}
+		return &jsonSchema{Enum: []interface{}{}}, nil // matches nothing
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("JSON schema at %q must be an object", path)
+	}
+	s := new(jsonSchema)
+	var err error
+	switch t := obj["type"].(type) {
+	case nil:
+	case string:
+		s.Types = []string{t}
+	case []interface{}:
+		for _, tv := range t {
+			name, ok := tv.(string)
+			if !ok {
+				return nil, fmt.Errorf("JSON schema at %q has non-string type", path)
+			}
+			s.Types = append(s.Types, name)
+		}
+	default:
+		return nil, fmt.Errorf("JSON schema at %q has bad type %v", path, t)
+	}
+	if enum, found := obj["enum"]; found {
+		if s.Enum, ok = enum.([]interface{}); !ok {
+			return nil, fmt.Errorf("JSON schema at %q has non-array enum", path)
+		}
+	}
+	if props, found := obj["properties"]; found {
+		propObj, ok := props.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("JSON schema at %q has non-object properties", path)
+		}
+		s.Properties = make(map[string]*jsonSchema, len(propObj))
+		for name, sub := range propObj {
+			if s.Properties[name], err = compileSchema(sub, path+"/properties/"+name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if req, found := obj["required"]; found {
+		names, ok := req.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("JSON schema at %q has non-array required", path)
+		}
+		for _, nv := range names {
+			name, ok := nv.(string)
+			if !ok {
+				return nil, fmt.Errorf("JSON schema at %q has non-string required property", path)
+			}
+			s.Required = append(s.Required, name)
+		}
+	}
+	switch ap := obj["additionalProperties"].(type) {
+	case nil:
+	case bool:
+		s.NoAdditional = !ap
+	default:
+		if s.AdditionalProperties, err = compileSchema(ap, path+"/additionalProperties"); err != nil {
+			return nil, err
+		}
+	}
+	if items, found := obj["items"]; found {
+		if s.Items, err = compileSchema(items, path+"/items"); err != nil {
+			return nil, err
+		}
+	}
+	numbers := map[string]**float64{"minimum": &s.Minimum, "maximum": &s.Maximum}
+	for name, dst := range numbers {
+		if nv, found := obj[name]; found {
+			f, ok := nv.(float64)
+			if !ok {
+				return nil, fmt.Errorf("JSON schema at %q has non-numeric %s", path, name)
+			}
+			*dst = &f
+		}
+	}
+	counts := map[string]**int{
+		"minLength": &s.MinLength, "maxLength": &s.MaxLength,
+		"minItems": &s.MinItems, "maxItems": &s.MaxItems,
+	}
+	for name, dst := range counts {
+		if nv, found := obj[name]; found {
+			f, ok := nv.(float64)
+			if !ok || f < 0 || f != float64(int(f)) {
+				return nil, fmt.Errorf("JSON schema at %q has bad %s, must be non-negative integer", path, name)
+			}
+			n := int(f)
+			*dst = &n
+		}
+	}
+	if pv, found := obj["pattern"]; found {
+		pattern, ok := pv.(string)
+		if !ok {
+			return nil, fmt.Errorf("JSON schema at %q has non-string pattern", path)
+		}
+		if s.Pattern, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("JSON schema at %q has bad pattern: %v", path, err)
+		}
+	}
+	return s, nil
+}
+
+// jsonType returns the JSON Schema type name of a decoded value.
+func jsonType(v interface{}) string {
+	switch tv := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := strconv.ParseInt(tv.String(), 10, 64); err == nil {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+// validateJSON returns a *SchemaError if the JSON value doesn't match the schema.
+func (s *jsonSchema) validateJSON(value []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return &SchemaError{Message: fmt.Sprintf("value isn't JSON: %v", err)}
+	}
+	return s.validate(v, "")
+}
+
+func (s *jsonSchema) validate(v interface{}, path string) error {
+	fail := func(format string, args ...interface{}) error {
+		return &SchemaError{Path: path, Message: fmt.Sprintf(format, args...)}
+	}
+	vType := jsonType(v)
+	if len(s.Types) != 0 {
+		var matched bool
+		for _, t := range s.Types {
+			if t == vType || (t == "number" && vType == "integer") {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fail("expected type %v, got %s", s.Types, vType)
+		}
+	}
+	if s.Enum != nil {
+		var matched bool
+		for _, e := range s.Enum {
+			if jsonEqual(v, e) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fail("value isn't one of the allowed enum values")
+		}
+	}
+	switch tv := v.(type) {
+	case json.Number:
+		f, err := tv.Float64()
+		if err != nil {
+			return fail("bad number %s", tv)
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			return fail("%s is less than minimum %g", tv, *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			return fail("%s is greater than maximum %g", tv, *s.Maximum)
+		}
+	case string:
+		n := utf8.RuneCountInString(tv)
+		if s.MinLength != nil && n < *s.MinLength {
+			return fail("string length %d is less than minLength %d", n, *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fail("string length %d is greater than maxLength %d", n, *s.MaxLength)
+		}
+		if s.Pattern != nil && !s.Pattern.MatchString(tv) {
+			return fail("string doesn't match pattern %q", s.Pattern.String())
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(tv) < *s.MinItems {
+			return fail("array has %d items, less than minItems %d", len(tv), *s.MinItems)
+		}
+		if s.MaxItems != nil && len(tv) > *s.MaxItems {
+			return fail("array has %d items, more than maxItems %d", len(tv), *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range tv {
+				if err := s.Items.validate(item, path+"/"+strconv.Itoa(i)); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, found := tv[name]; !found {
+				return fail("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(tv))
+		for name := range tv {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			sub, found := s.Properties[name]
+			if !found {
+				if s.NoAdditional {
+					return fail("additional property %q is not allowed", name)
+				}
+				sub = s.AdditionalProperties
+			}
+			if sub != nil {
+				if err := sub.validate(tv[name], path+"/"+name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// jsonEqual compares decoded JSON values, where numbers may be json.Number or float64.
+func jsonEqual(a, b interface{}) bool {
+	if na, ok := a.(json.Number); ok {
+		fa, err := na.Float64()
+		if err != nil {
+			return false
+		}
+		a = fa
+	}
+	switch tb := b.(type) {
+	case json.Number:
+		fb, err := tb.Float64()
+		if err != nil {
+			return false
+		}
+		b = fb
+	case []interface{}:
+		ta, ok := a.([]interface{})
+		if !ok || len(ta) != len(tb) {
+			return false
+		}
+		for i := range ta {
+			if !jsonEqual(ta[i], tb[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		ta, ok := a.(map[string]interface{})
+		if !ok || len(ta) != len(tb) {
+			return false
+		}
+		for k, vb := range tb {
+			va, found := ta[k]
+			if !found || !jsonEqual(va, vb) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// getSchema returns the parsed JSONSchema setting of the instance or nil if there is none.
+func (d *Data) getSchema() (*jsonSchema, error) {
+	if d.JSONSchema == "" {
+		return nil, nil
+	}
+	d.schemaMu.Lock()
+	defer d.schemaMu.Unlock()
+	if d.schema == nil || d.schemaText != d.JSONSchema {
+		schema, err := parseJSONSchema(d.JSONSchema)
+		if err != nil {
+			return nil, err
+		}
+		d.schema, d.schemaText = schema, d.JSONSchema
+	}
+	return d.schema, nil
+}
+
+// ValidateValue returns a *SchemaError if the instance has a JSONSchema setting and the
+// value doesn't match it.
+func (d *Data) ValidateValue(value []byte) error {
+	schema, err := d.getSchema()
+	if err != nil || schema == nil {
+		return err
+	}
+	return schema.validateJSON(value)
+}
@@ -0,0 +1,61 @@
+/*
+	This file supports reading and writing the stored serializations of values, with DVID's
+	framing, compression, and checksum intact, e.g., for exact-copy replication.
+*/
+
+package keyvalue
+
+import (
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// GetSerialization returns the stored serialization of a key's value without
+// deserializing it.  Chunked and deduplicated values are returned as the serialization
+// they were stored from, so the result can always be written with PutSerialization.
+func (d *Data) GetSerialization(ctx storage.Context, keyStr string) ([]byte, bool, error) {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, false, err
+	}
+	tk, err := NewTKey(keyStr)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := db.Get(ctx, tk)
+	if err != nil {
+		return nil, false, fmt.Errorf("Error in retrieving key %q: %v", keyStr, err)
+	}
+	if data == nil {
+		return nil, false, nil
+	}
+	if data, err = d.resolveValue(ctx, db, keyStr, data); err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// PutSerialization puts a key-value given the stored serialization of the value, e.g., as
+// returned by GetSerialization, which is written as is.  The serialization is rejected
+// if it can't be deserialized with the instance's settings.
+func (d *Data) PutSerialization(ctx storage.Context, keyStr string, serialization []byte) error {
+	if isDedupRef(serialization) {
+		return fmt.Errorf("serialization for key %q is a deduplication reference, not a value", keyStr)
+	}
+	if _, ok := decodeChunkManifest(serialization); ok {
+		return fmt.Errorf("serialization for key %q is a chunk manifest, not a value", keyStr)
+	}
+	value, err := d.decodeValue(serialization)
+	if err != nil {
+		return fmt.Errorf("bad serialization for key %q: %v", keyStr, err)
+	}
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	return d.storeSerialization(ctx, db, keyStr, value, serialization, nil)
+}
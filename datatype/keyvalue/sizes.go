@@ -0,0 +1,115 @@
+/*
+	This file supports a histogram of the stored sizes of values, e.g., for deciding whether
+	an instance would benefit from chunking or inline values.
+*/
+
+package keyvalue
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// SizeBucket is a bucket of a value size histogram.  As with Prometheus histograms,
+// counts are cumulative, so Count is the number of values of at most UpperBound bytes.
+type SizeBucket struct {
+	UpperBound uint64
+	Count      uint64
+}
+
+// SizeHistogram is the distribution of the stored sizes of values in power-of-two buckets.
+type SizeHistogram struct {
+	Buckets []SizeBucket
+	Count   uint64 // number of values
+	Sum     uint64 // total stored bytes of values
+}
+
+// sizeBucket returns the index of the smallest power-of-two bucket holding a size, where
+// bucket 0 holds empty values.  Sizes over 2^63 bytes share the last bucket.
+func sizeBucket(size uint64) int {
+	if size == 0 {
+		return 0
+	}
+	if size > 1<<63 {
+		return 64
+	}
+	return bits.Len64(size-1) + 1
+}
+
+// GetSizeHistogram scans all values visible in the given context and returns the
+// histogram of their stored, i.e., serialized and possibly compressed, sizes.  Chunked
+// and deduplicated values are counted at the size of their full serialization.
+func (d *Data) GetSizeHistogram(ctx storage.Context) (*SizeHistogram, error) {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	var counts [65]uint64
+	hist := new(SizeHistogram)
+	dedupSizes := make(map[string]uint64)
+	first, last := storage.PrefixRange(keyStandard, nil)
+	err = db.ProcessRange(ctx, first, last, nil, func(c *storage.Chunk) error {
+		if c == nil || c.TKeyValue == nil {
+			return nil
+		}
+		size := uint64(len(c.V))
+		if m, ok := decodeChunkManifest(c.V); ok {
+			size = m.size
+		} else if isDedupRef(c.V) {
+			hash := string(c.V[1:])
+			var found bool
+			if size, found = dedupSizes[hash]; !found {
+				payload, err := db.Get(ctx, NewDedupTKey(c.V[1:]))
+				if err != nil {
+					return err
+				}
+				size = uint64(len(payload))
+				dedupSizes[hash] = size
+			}
+		}
+		counts[sizeBucket(size)]++
+		hist.Count++
+		hist.Sum += size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	maxBucket := 0
+	for i, count := range counts {
+		if count != 0 {
+			maxBucket = i
+		}
+	}
+	var cumulative uint64
+	for i := 0; i <= maxBucket; i++ {
+		cumulative += counts[i]
+		var bound uint64
+		if i > 0 {
+			bound = 1 << uint(i-1)
+		}
+		hist.Buckets = append(hist.Buckets, SizeBucket{UpperBound: bound, Count: cumulative})
+	}
+	return hist, nil
+}
+
+// WritePrometheus writes the histogram in the Prometheus text exposition format with
+// the given metric name and instance label.
+func (h *SizeHistogram) WritePrometheus(w io.Writer, metric, instance string) error {
+	if _, err := fmt.Fprintf(w, "# TYPE %s histogram\n", metric); err != nil {
+		return err
+	}
+	for _, b := range h.Buckets {
+		if _, err := fmt.Fprintf(w, "%s_bucket{instance=%q,le=\"%d\"} %d\n", metric, instance, b.UpperBound, b.Count); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%s_bucket{instance=%q,le=\"+Inf\"} %d\n%s_sum{instance=%q} %d\n%s_count{instance=%q} %d\n",
+		metric, instance, h.Count, metric, instance, h.Sum, metric, instance, h.Count)
+	return err
+}
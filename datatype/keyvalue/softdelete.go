@@ -0,0 +1,313 @@
+/*
+	This file supports soft-deletion of keys, where deleted values are kept as tombstones
+	for a recovery window before being purged.
+*/
+
+package keyvalue
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// maxPurgeInterval is the longest time between checks for expired tombstones.
+const maxPurgeInterval = time.Hour
+
+// tombstone values are the 8-byte deletion time in Unix nanoseconds followed by the
+// original serialized value.
+func encodeTombstone(deleted time.Time, serialization []byte) []byte {
+	buf := make([]byte, 8+len(serialization))
+	binary.LittleEndian.PutUint64(buf[:8], uint64(deleted.UnixNano()))
+	copy(buf[8:], serialization)
+	return buf
+}
+
+func decodeTombstone(data []byte) (deleted time.Time, serialization []byte, err error) {
+	if len(data) < 8 {
+		err = fmt.Errorf("bad keyvalue tombstone with only %d bytes", len(data))
+		return
+	}
+	deleted = time.Unix(0, int64(binary.LittleEndian.Uint64(data[:8])))
+	serialization = data[8:]
+	return
+}
+
+// softDeleteWindow returns the duration soft-deleted keys are recoverable.
+func (d *Data) softDeleteWindow() time.Duration {
+	if d.SoftDeleteWindow <= 0 {
+		return DefaultSoftDeleteWindow
+	}
+	return d.SoftDeleteWindow
+}
+
+// softDelete atomically moves a key's value to a timestamped tombstone.
+func (d *Data) softDelete(ctx storage.Context, db storage.OrderedKeyValueDB, keyStr string, tk storage.TKey) error {
+	data, err := db.Get(ctx, tk)
+	if err != nil {
+		return fmt.Errorf("Error in retrieving key %q for deletion: %v", keyStr, err)
+	}
+	if data == nil {
+		return nil
+	}
+	tombTK, err := NewTombstoneTKey(keyStr)
+	if err != nil {
+		return err
+	}
+	batcher, ok := db.(storage.KeyValueBatcher)
+	if !ok {
+		return fmt.Errorf("keyvalue %q soft-delete requires a batch-capable store", d.DataName())
+	}
+	batch := batcher.NewBatch(ctx)
+	storage.PutUnmetered(batch, tombTK, encodeTombstone(time.Now(), data))
+	batch.Delete(tk)
+	return batch.Commit()
+}
+
+// UndeleteData recovers a soft-deleted key-value pair if it is within the recovery window.
+// If no recoverable tombstone exists, found is false.  It is an error to undelete a key
+// that has been written since its deletion.
+func (d *Data) UndeleteData(ctx storage.Context, keyStr string) (found bool, err error) {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return false, err
+	}
+	tombTK, err := NewTombstoneTKey(keyStr)
+	if err != nil {
+		return false, err
+	}
+	d.indexMu.RLock()
+	defer d.indexMu.RUnlock()
+	data, err := db.Get(ctx, tombTK)
+	if err != nil {
+		return false, fmt.Errorf("Error in retrieving deleted key %q: %v", keyStr, err)
+	}
+	if data == nil {
+		return false, nil
+	}
+	deleted, serialization, err := decodeTombstone(data)
+	if err != nil {
+		return false, err
+	}
+	if time.Since(deleted) > d.softDeleteWindow() {
+		return false, nil
+	}
+	tk, err := NewTKey(keyStr)
+	if err != nil {
+		return false, err
+	}
+	defer d.uncache(ctx, keyStr)
+	current, err := db.Get(ctx, tk)
+	if err != nil {
+		return false, err
+	}
+	if current != nil {
+		return false, fmt.Errorf("key %q has been written since deletion and cannot be undeleted", keyStr)
+	}
+	batcher, ok := db.(storage.KeyValueBatcher)
+	if !ok {
+		return false, fmt.Errorf("keyvalue %q undelete requires a batch-capable store", d.DataName())
+	}
+	err = d.withKeyLimit(ctx, db, map[string]bool{keyStr: true}, func() error {
+		batch := batcher.NewBatch(ctx)
+		batch.Put(tk, serialization)
+		batch.Delete(tombTK)
+		return batch.Commit()
+	})
+	if err != nil {
+		return false, err
+	}
+	if d.IndexField != "" {
+		entry, err := d.storedIndexEntry(ctx, db, keyStr, tk)
+		if err != nil {
+			return false, err
+		}
+		if entry.found {
+			if err = storage.Unmetered(db).Put(ctx, NewIndexTKey(entry.field, keyStr), []byte{}); err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// PurgeTombstones removes all soft-deleted keys across all versions that were deleted
+// before the given cutoff time.  Returns the number of purged tombstones.
+func (d *Data) PurgeTombstones(cutoff time.Time) (purged int, err error) {
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx := storage.NewDataContext(d, 0)
+	var expired []storage.Key
+	ch := make(chan *storage.KeyValue, 100)
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			kv := <-ch
+			if kv == nil {
+				return
+			}
+			if kv.K.IsTombstone() {
+				continue
+			}
+			deleted, _, err := decodeTombstone(kv.V)
+			if err != nil {
+				dvid.Errorf("keyvalue %q: %v\n", d.DataName(), err)
+				continue
+			}
+			if deleted.Before(cutoff) {
+				expired = append(expired, kv.K)
+			}
+		}
+	}()
+
+	minKey, maxKey := ctx.TKeyClassRange(keyTombstone)
+	keysOnly := false
+	if err = db.RawRangeQuery(minKey, maxKey, keysOnly, ch, nil); err != nil {
+		return 0, err
+	}
+	wg.Wait()
+
+	for _, k := range expired {
+		removed, err := d.purgeTombstone(ctx, db, k, cutoff)
+		if err != nil {
+			return purged, err
+		}
+		if removed {
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// purgeTombstone removes a tombstone and the chunks of its value if it still records a
+// deletion before the cutoff, since the key may have been undeleted or deleted again
+// after the scan.  Writes are held off between the check and the removal.
+func (d *Data) purgeTombstone(ctx *storage.DataContext, db storage.OrderedKeyValueDB, tombKey storage.Key, cutoff time.Time) (removed bool, err error) {
+	v, err := ctx.VersionFromKey(tombKey)
+	if err != nil {
+		return false, err
+	}
+	tombTK, err := storage.TKeyFromKey(tombKey)
+	if err != nil {
+		return false, err
+	}
+	d.indexMu.Lock()
+	defer d.indexMu.Unlock()
+	data, err := db.Get(storage.NewDataContext(d, v), tombTK)
+	if err != nil || data == nil {
+		return false, err
+	}
+	deleted, serialization, err := decodeTombstone(data)
+	if err != nil {
+		return false, err
+	}
+	if !deleted.Before(cutoff) {
+		return false, nil
+	}
+	if m, ok := decodeChunkManifest(serialization); ok {
+		chunkKeys, err := tombstoneChunkKeys(ctx, tombKey, m)
+		if err != nil {
+			return false, err
+		}
+		for _, k := range chunkKeys {
+			if err = db.RawDelete(k); err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, db.RawDelete(tombKey)
+}
+
+// tombstoneChunkKeys returns the full keys of the chunks of a soft-deleted value in the
+// version of its tombstone.  Chunks written in an ancestor version are left in place since
+// that version still references them.
+func tombstoneChunkKeys(ctx *storage.DataContext, tombKey storage.Key, m chunkManifest) ([]storage.Key, error) {
+	v, err := ctx.VersionFromKey(tombKey)
+	if err != nil {
+		return nil, err
+	}
+	tk, err := storage.TKeyFromKey(tombKey)
+	if err != nil {
+		return nil, err
+	}
+	keyStr, err := DecodeTombstoneTKey(tk)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]storage.Key, m.numChunks)
+	for i := range keys {
+		keys[i] = ctx.ConstructKeyVersion(NewChunkTKey(keyStr, m.generation, uint32(i)), v)
+	}
+	return keys, nil
+}
+
+// Initialize launches the background purging of expired tombstones if soft-delete is on
+// and the flushing of buffered writes if writes are coalesced.
+// Implements the datastore.Initializer interface.
+func (d *Data) Initialize() {
+	if d.SoftDelete {
+		d.startPurger()
+	}
+	if d.CoalesceInterval > 0 {
+		d.startFlusher()
+	}
+}
+
+// Shutdown stops any background purging and flushes buffered writes.  It can be called
+// more than once.  Implements the datastore.Shutdowner interface.
+func (d *Data) Shutdown(wg *sync.WaitGroup) {
+	d.shutdownOnce.Do(func() {
+		if d.purgeDone != nil {
+			close(d.purgeDone)
+		}
+		d.coalesceMu.Lock()
+		if d.flushDone != nil {
+			close(d.flushDone)
+		}
+		d.coalesceMu.Unlock()
+		if d.idempotencyDone != nil {
+			close(d.idempotencyDone)
+		}
+	})
+	d.flushWrites()
+	wg.Done()
+}
+
+func (d *Data) startPurger() {
+	d.purgeOnce.Do(func() {
+		d.purgeDone = make(chan struct{})
+		go d.purgeTombstonesLoop(d.purgeDone)
+	})
+}
+
+func (d *Data) purgeTombstonesLoop(done <-chan struct{}) {
+	for {
+		window := d.softDeleteWindow()
+		interval := window / 10
+		if interval > maxPurgeInterval {
+			interval = maxPurgeInterval
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+			purged, err := d.PurgeTombstones(time.Now().Add(-window))
+			if err != nil {
+				dvid.Errorf("error purging soft-deleted keys of keyvalue %q: %v\n", d.DataName(), err)
+			} else if purged > 0 {
+				dvid.Infof("Purged %d soft-deleted keys of keyvalue %q\n", purged, d.DataName())
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+/*
+	This file supports returning the values of many keys as one length-prefixed binary
+	stream, avoiding per-key requests and the encoding overhead of JSON or protobuf.
+*/
+
+package keyvalue
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// streamMissingValue is the value length written for a key that isn't found, which can't
+// be confused with the length of an empty value.
+const streamMissingValue = math.MaxUint32
+
+// WriteKeyValueStream writes a record for each key in the given order:
+//
+//	<key length><key bytes><value length><value bytes>
+//
+// where lengths are little-endian uint32.  Keys that aren't found have a value length
+// of 0xFFFFFFFF and no value bytes.
+func (d *Data) WriteKeyValueStream(w io.Writer, ctx storage.Context, keys []string) error {
+	lenBuf := make([]byte, 4)
+	writeLen := func(n uint32) error {
+		binary.LittleEndian.PutUint32(lenBuf, n)
+		_, err := w.Write(lenBuf)
+		return err
+	}
+	for _, keyStr := range keys {
+		value, found, err := d.GetData(ctx, keyStr)
+		if err != nil {
+			return err
+		}
+		if uint64(len(value)) >= streamMissingValue {
+			return fmt.Errorf("value of key %q is too large to stream", keyStr)
+		}
+		if err := writeLen(uint32(len(keyStr))); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, keyStr); err != nil {
+			return err
+		}
+		if !found {
+			if err := writeLen(streamMissingValue); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := writeLen(uint32(len(value))); err != nil {
+			return err
+		}
+		if _, err := w.Write(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleStreamKeyValues reads a JSON list of keys and writes their values as a binary
+// stream in request order.
+func (d *Data) handleStreamKeyValues(w http.ResponseWriter, r *http.Request, ctx storage.Context) (numKeys int, err error) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return 0, err
+	}
+	var keys []string
+	if err = json.Unmarshal(data, &keys); err != nil {
+		return 0, fmt.Errorf("expected JSON list of keys: %v", err)
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	bw := bufio.NewWriter(w)
+	if err = d.WriteKeyValueStream(bw, ctx, keys); err != nil {
+		return len(keys), err
+	}
+	return len(keys), bw.Flush()
+}
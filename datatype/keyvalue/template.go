@@ -0,0 +1,168 @@
+/*
+	This file supports rendering JSON values as HTML through Go templates, so an instance
+	can serve small views, e.g., dashboards, without a separate frontend.
+*/
+
+package keyvalue
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"text/template/parse"
+
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// Settings of Templates, which controls where templates for rendering values can come from.
+const (
+	TemplatesStored = "stored" // only templates stored as values of keys
+	TemplatesInline = "inline" // also templates given in the request
+)
+
+// MaxTemplateOutput is the maximum number of bytes a rendered template may produce.
+const MaxTemplateOutput = 1 << 20
+
+var errTemplateOutput = errors.New("rendered template exceeds maximum output size")
+
+// limitedBuffer is a buffer that fails writes beyond a maximum size.
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.max {
+		return 0, errTemplateOutput
+	}
+	return b.Buffer.Write(p)
+}
+
+// GetTemplate returns the template text stored as the value of a key.
+func (d *Data) GetTemplate(ctx storage.Context, keyStr string) (string, error) {
+	text, found, err := d.GetData(ctx, keyStr)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("template key %q not found", keyStr)
+	}
+	return string(text), nil
+}
+
+// renderValue writes a JSON value rendered as HTML through the template stored as the
+// value of templateKey or, if allowed by the Templates setting, given as templateText.
+func (d *Data) renderValue(w http.ResponseWriter, ctx storage.Context, value []byte, templateKey, templateText string) error {
+	switch {
+	case d.Templates == "":
+		return fmt.Errorf("keyvalue %q does not render templates; set Templates", d.DataName())
+	case templateText != "" && d.Templates != TemplatesInline:
+		return fmt.Errorf("keyvalue %q only renders stored templates", d.DataName())
+	case templateKey != "":
+		var err error
+		if templateText, err = d.GetTemplate(ctx, templateKey); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	if err := RenderTemplate(&buf, templateText, value); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// RenderTemplate executes the HTML template on a JSON value and writes the result.  The
+// template has no functions beyond the text/template builtins, and since its data is the
+// decoded JSON, it can't call into the server.  Templates that could run unbounded are
+// refused, as checked by checkTemplate.  Output is limited to MaxTemplateOutput bytes and
+// nothing is written if execution fails.
+func RenderTemplate(w io.Writer, templateText string, value []byte) error {
+	var data interface{}
+	if err := json.Unmarshal(value, &data); err != nil {
+		return fmt.Errorf("only JSON values can be rendered: %v", err)
+	}
+	tmpl, err := template.New("value").Parse(templateText)
+	if err != nil {
+		return fmt.Errorf("bad template: %v", err)
+	}
+	if err := checkTemplate(tmpl); err != nil {
+		return fmt.Errorf("bad template: %v", err)
+	}
+	out := &limitedBuffer{max: MaxTemplateOutput}
+	if err := tmpl.Execute(out, data); err != nil {
+		return fmt.Errorf("can't render template: %v", err)
+	}
+	_, err = w.Write(out.Bytes())
+	return err
+}
+
+// checkTemplate returns an error unless the template's execution time is bounded by the
+// sizes of the template and the value, since templates may come from any client.  It
+// refuses template definitions and calls, which allow recursion, ranges nested in ranges,
+// and ranges over anything but the value's data, e.g., integers.
+func checkTemplate(tmpl *template.Template) error {
+	if len(tmpl.Templates()) > 1 {
+		return fmt.Errorf("templates can't define other templates")
+	}
+	if tmpl.Tree == nil {
+		return nil
+	}
+	return checkTemplateNode(tmpl.Tree.Root, false)
+}
+
+func checkTemplateNode(node parse.Node, inRange bool) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkTemplateNode(child, inRange); err != nil {
+				return err
+			}
+		}
+	case *parse.TemplateNode:
+		return fmt.Errorf("templates can't call templates")
+	case *parse.IfNode:
+		return checkTemplateBranch(&n.BranchNode, inRange)
+	case *parse.WithNode:
+		return checkTemplateBranch(&n.BranchNode, inRange)
+	case *parse.RangeNode:
+		if inRange {
+			return fmt.Errorf("templates can't nest range actions")
+		}
+		if !rangesOverData(n.Pipe) {
+			return fmt.Errorf("templates can only range over fields of the value")
+		}
+		return checkTemplateBranch(&n.BranchNode, true)
+	}
+	return nil
+}
+
+func checkTemplateBranch(n *parse.BranchNode, inRange bool) error {
+	if err := checkTemplateNode(n.List, inRange); err != nil {
+		return err
+	}
+	return checkTemplateNode(n.ElseList, inRange)
+}
+
+// rangesOverData returns true if a range pipeline is just the value or a field of it, so
+// the number of iterations is bounded by the value's size.
+func rangesOverData(pipe *parse.PipeNode) bool {
+	if pipe == nil || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+	switch arg := pipe.Cmds[0].Args[0].(type) {
+	case *parse.DotNode, *parse.FieldNode:
+		return true
+	case *parse.VariableNode:
+		return len(arg.Ident) > 0 && arg.Ident[0] == "$"
+	}
+	return false
+}
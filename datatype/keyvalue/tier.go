@@ -0,0 +1,46 @@
+/*
+	This file supports directing reads of a key to one of the stores configured for the
+	instance, e.g., the primary store or its read fallback, to debug replication.
+*/
+
+package keyvalue
+
+import (
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// GetDataFromTier gets a value from the named storage tier of the instance, e.g.,
+// storage.PrimaryTier, also returning its encoding if the value was stored as sent.  The
+// value cache is bypassed and reads don't fall back to other tiers or record an access.
+func (d *Data) GetDataFromTier(ctx storage.Context, keyStr, tier string) ([]byte, *RawEncoding, bool, error) {
+	d.flushWrites()
+	store, err := d.KVStore()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	db, err := storage.GetReadTier(store, tier)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	tk, err := NewTKey(keyStr)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	data, err := db.Get(ctx, tk)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("Error in retrieving key '%s' from tier %q: %v", keyStr, tier, err)
+	}
+	if data == nil {
+		return nil, nil, false, nil
+	}
+	if data, err = d.resolveValue(ctx, db, keyStr, data); err != nil {
+		return nil, nil, false, fmt.Errorf("Error in resolving key '%s' from tier %q: %v", keyStr, tier, err)
+	}
+	value, raw, err := d.decodeValueAs(data)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("Unable to deserialize data for key '%s' from tier %q: %v\n", keyStr, tier, err)
+	}
+	return value, raw, true, nil
+}
@@ -0,0 +1,125 @@
+/*
+	This file supports returning values transformed to a requested representation on GET,
+	e.g., gzipped or pretty-printed JSON, so clients don't need to do it themselves.
+*/
+
+package keyvalue
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// valueTransform is a transform of a deserialized value.  Check, if given, is called before
+// anything is written so bad values are reported as request errors, and write streams the
+// transformed value.
+type valueTransform struct {
+	contentType string
+	check       func(value []byte) error
+	write       func(w io.Writer, value []byte) error
+}
+
+var valueTransforms = map[string]valueTransform{
+	"gzip": {
+		contentType: "application/gzip",
+		write: func(w io.Writer, value []byte) error {
+			zw := gzip.NewWriter(w)
+			if _, err := zw.Write(value); err != nil {
+				return err
+			}
+			return zw.Close()
+		},
+	},
+	"gunzip": {
+		contentType: "application/octet-stream",
+		check: func(value []byte) error {
+			if _, err := gzip.NewReader(bytes.NewReader(value)); err != nil {
+				return fmt.Errorf("value is not gzipped: %v", err)
+			}
+			return nil
+		},
+		write: func(w io.Writer, value []byte) error {
+			zr, err := gzip.NewReader(bytes.NewReader(value))
+			if err != nil {
+				return err
+			}
+			if _, err = io.Copy(w, zr); err != nil {
+				return err
+			}
+			return zr.Close()
+		},
+	},
+	"base64": {
+		contentType: "text/plain",
+		write: func(w io.Writer, value []byte) error {
+			enc := base64.NewEncoder(base64.StdEncoding, w)
+			if _, err := enc.Write(value); err != nil {
+				return err
+			}
+			return enc.Close()
+		},
+	},
+	"json-pretty": {
+		contentType: "application/json",
+		check:       checkJSONValue,
+		write: func(w io.Writer, value []byte) error {
+			var buf bytes.Buffer
+			if err := json.Indent(&buf, value, "", "  "); err != nil {
+				return err
+			}
+			_, err := buf.WriteTo(w)
+			return err
+		},
+	},
+	"json-compact": {
+		contentType: "application/json",
+		check:       checkJSONValue,
+		write: func(w io.Writer, value []byte) error {
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, value); err != nil {
+				return err
+			}
+			_, err := buf.WriteTo(w)
+			return err
+		},
+	},
+}
+
+func checkJSONValue(value []byte) error {
+	if !json.Valid(value) {
+		return fmt.Errorf("value is not valid JSON")
+	}
+	return nil
+}
+
+// ValueTransforms returns the names of the transforms that can be applied to values on GET.
+func ValueTransforms() []string {
+	names := make([]string, 0, len(valueTransforms))
+	for name := range valueTransforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeTransformed writes the value transformed by the named transform with its content
+// type.  Nothing is written if the transform isn't supported or doesn't apply to the value.
+func writeTransformed(w http.ResponseWriter, name string, value []byte) error {
+	t, found := valueTransforms[name]
+	if !found {
+		return fmt.Errorf("unsupported transform %q, must be one of %v", name, ValueTransforms())
+	}
+	if t.check != nil {
+		if err := t.check(value); err != nil {
+			return err
+		}
+	}
+	w.Header().Set("Content-Type", t.contentType)
+	return t.write(w, value)
+}
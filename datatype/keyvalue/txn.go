@@ -0,0 +1,305 @@
+/*
+	This file supports transactions of multiple key puts and deletes that are applied
+	in a single batch commit.
+*/
+
+package keyvalue
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// TxnOp is a put or delete of a key within a transaction.  In JSON, the value is
+// base64-encoded.
+type TxnOp struct {
+	Op    string // "put" or "delete"
+	Key   string
+	Value []byte
+
+	raw      *RawEncoding // if non-nil, a put stores the value as sent with this encoding
+	stored   []byte       // if non-nil, a put writes this serialization of the value as is
+	dropMeta bool         // if true, a put removes any custom metadata of the key
+}
+
+// ApplyTransaction applies all operations in order within a single batch commit, so
+// either all operations are applied or none are if the store supports atomic batches.
+// If the instance uses soft-delete, deletes move values to tombstones within the batch.
+func (d *Data) ApplyTransaction(ctx storage.Context, ops []TxnOp) error {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	batcher, ok := db.(storage.KeyValueBatcher)
+	if !ok {
+		return fmt.Errorf("keyvalue %q transactions require a batch-capable store", d.DataName())
+	}
+	d.indexMu.RLock()
+	defer d.indexMu.RUnlock()
+	return d.applyTransaction(ctx, db, batcher, ops)
+}
+
+// applyTransaction applies the operations in a single batch commit.  The caller must
+// hold indexMu.
+func (d *Data) applyTransaction(ctx storage.Context, db storage.OrderedKeyValueDB, batcher storage.KeyValueBatcher, ops []TxnOp) error {
+	batch := batcher.NewBatch(ctx)
+	return d.stageTransaction(ctx, db, batch, ops, batch.Commit)
+}
+
+// StageBatchOps adds the operations to a batch that may be shared with other instances and
+// calls commit.  The write takes one of the instance's write slots, and its mutations are
+// audited for the given user once commit succeeds.  Implements the
+// datastore.BatchOpApplier interface.
+func (d *Data) StageBatchOps(ctx *datastore.VersionedCtx, batch storage.Batch, ops []datastore.BatchOp, user string, commit func() error) error {
+	release, err := d.reserveWrite()
+	if err != nil {
+		return err
+	}
+	defer release()
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	d.indexMu.RLock()
+	err = d.stageTransaction(ctx, db, batch, batchTxnOps(ops), commit)
+	d.indexMu.RUnlock()
+	if err != nil {
+		return err
+	}
+	d.auditBatchOps(ctx, user, ops)
+	return nil
+}
+
+// ApplyBatchOps applies the operations as a transaction of the instance's own, taking one
+// of its write slots and auditing the mutations for the given user.  Implements the
+// datastore.BatchOpApplier interface.
+func (d *Data) ApplyBatchOps(ctx *datastore.VersionedCtx, ops []datastore.BatchOp, user string) error {
+	release, err := d.reserveWrite()
+	if err != nil {
+		return err
+	}
+	defer release()
+	if err = d.ApplyTransaction(ctx, batchTxnOps(ops)); err != nil {
+		return err
+	}
+	d.auditBatchOps(ctx, user, ops)
+	return nil
+}
+
+// batchTxnOps returns the transaction operations for operations of a repo-level batch,
+// where puts remove any custom metadata of their keys like a POST without metadata.
+func batchTxnOps(ops []datastore.BatchOp) []TxnOp {
+	txnOps := make([]TxnOp, len(ops))
+	for i, op := range ops {
+		txnOps[i] = TxnOp{Op: op.Op, Key: op.Key, Value: op.Value, dropMeta: true}
+	}
+	return txnOps
+}
+
+// auditBatchOps records the applied operations of a repo-level batch in the audit log.
+func (d *Data) auditBatchOps(ctx *datastore.VersionedCtx, user string, ops []datastore.BatchOp) {
+	if !d.AuditLog {
+		return
+	}
+	uuid, err := datastore.UUIDFromVersion(ctx.VersionID())
+	if err != nil {
+		dvid.Errorf("unable to audit batch of keyvalue %q: %v\n", d.DataName(), err)
+		return
+	}
+	audit := d.auditorFor(uuid, user)
+	for _, op := range ops {
+		if op.Op == "delete" {
+			audit.delete(op.Key)
+		} else {
+			audit.put(op.Key, len(op.Value))
+		}
+	}
+}
+
+// stageTransaction adds the operations to the batch and calls commit to commit it.  The
+// caller must hold indexMu.
+func (d *Data) stageTransaction(ctx storage.Context, db storage.OrderedKeyValueDB, batch storage.Batch, ops []TxnOp, commit func() error) error {
+	// pending holds values stored earlier in the transaction, with nil for deletes, so
+	// soft-deletes tombstone the latest value and chunks of replaced values are removed.
+	pending := make(map[string][]byte)
+	stored := func(keyStr string, tk storage.TKey) ([]byte, error) {
+		if data, found := pending[keyStr]; found {
+			return data, nil
+		}
+		return db.Get(ctx, tk)
+	}
+	// indexed holds the index entries of keys written earlier in the transaction.
+	indexed := make(map[string]indexEntry)
+	indexOld := func(keyStr string, tk storage.TKey) (indexEntry, error) {
+		if entry, found := indexed[keyStr]; found {
+			return entry, nil
+		}
+		return d.storedIndexEntry(ctx, db, keyStr, tk)
+	}
+	defer func() {
+		for _, op := range ops {
+			d.uncache(ctx, op.Key)
+		}
+	}()
+	now := time.Now()
+	for i, op := range ops {
+		tk, err := NewTKey(op.Key)
+		if err != nil {
+			return fmt.Errorf("operation %d: %v", i, err)
+		}
+		if d.IndexField != "" {
+			old, err := indexOld(op.Key, tk)
+			if err != nil {
+				return fmt.Errorf("operation %d: error retrieving key %q: %v", i, op.Key, err)
+			}
+			var value []byte
+			if op.Op == "put" {
+				value = op.Value
+			}
+			indexed[op.Key] = d.batchIndex(batch, op.Key, old, value)
+		}
+		switch op.Op {
+		case "put":
+			serialization := op.stored
+			if serialization == nil {
+				if serialization, err = d.encodeValueAs(op.Value, op.raw, nil); err != nil {
+					return fmt.Errorf("operation %d: %v", i, err)
+				}
+			}
+			var old []byte
+			if d.ChunkSize > 0 {
+				if old, err = stored(op.Key, tk); err != nil {
+					return fmt.Errorf("operation %d: error retrieving key %q: %v", i, op.Key, err)
+				}
+			}
+			pending[op.Key] = d.putValue(batch, op.Key, tk, serialization, old)
+			if op.dropMeta {
+				metaTK := NewMetaTKey(op.Key)
+				hasMeta, err := keyExists(ctx, db, metaTK)
+				if err != nil {
+					return fmt.Errorf("operation %d: error retrieving metadata of key %q: %v", i, op.Key, err)
+				}
+				if hasMeta {
+					batch.Delete(metaTK)
+				}
+			}
+			if d.TrackModified {
+				modTK, err := NewModifiedTKey(op.Key)
+				if err != nil {
+					return fmt.Errorf("operation %d: %v", i, err)
+				}
+				storage.PutUnmetered(batch, modTK, encodeTimestamp(now))
+			}
+		case "delete":
+			if d.SoftDelete || d.ChunkSize > 0 {
+				data, err := stored(op.Key, tk)
+				if err != nil {
+					return fmt.Errorf("operation %d: error retrieving key %q: %v", i, op.Key, err)
+				}
+				if !d.SoftDelete {
+					d.deleteChunks(batch, op.Key, data)
+				} else if data != nil {
+					tombTK, err := NewTombstoneTKey(op.Key)
+					if err != nil {
+						return fmt.Errorf("operation %d: %v", i, err)
+					}
+					storage.PutUnmetered(batch, tombTK, encodeTombstone(now, data))
+				}
+			}
+			batch.Delete(tk)
+			pending[op.Key] = nil
+			metaTK := NewMetaTKey(op.Key)
+			hasMeta, err := keyExists(ctx, db, metaTK)
+			if err != nil {
+				return fmt.Errorf("operation %d: error retrieving metadata of key %q: %v", i, op.Key, err)
+			}
+			if hasMeta {
+				batch.Delete(metaTK)
+			}
+			if d.AccessInterval > 0 {
+				batch.Delete(NewAccessedTKey(op.Key))
+				d.forgetAccess(ctx, op.Key)
+			}
+			if d.TrackModified {
+				modTK, err := NewModifiedTKey(op.Key)
+				if err != nil {
+					return fmt.Errorf("operation %d: %v", i, err)
+				}
+				batch.Delete(modTK)
+			}
+		default:
+			return fmt.Errorf("operation %d has unknown op %q, must be %q or %q", i, op.Op, "put", "delete")
+		}
+	}
+	final := make(map[string]bool, len(pending))
+	for keyStr, data := range pending {
+		final[keyStr] = data != nil
+	}
+	return d.withKeyLimit(ctx, db, final, commit)
+}
+
+// SwapData atomically exchanges the values of two keys in a single batch commit.  Writes
+// are held off between reading and writing the values, which are moved as stored so they
+// keep any raw encoding or compression level.  If a key doesn't exist, it is an error
+// unless missingAsEmpty is true, in which case the key is treated as having an empty value.
+func (d *Data) SwapData(ctx storage.Context, keyA, keyB string, missingAsEmpty bool) error {
+	if keyA == keyB {
+		return fmt.Errorf("can't swap key %q with itself", keyA)
+	}
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	batcher, ok := db.(storage.KeyValueBatcher)
+	if !ok {
+		return fmt.Errorf("keyvalue %q swaps require a batch-capable store", d.DataName())
+	}
+	d.indexMu.Lock()
+	defer d.indexMu.Unlock()
+	var values, serializations [2][]byte
+	for i, keyStr := range []string{keyA, keyB} {
+		value, serialization, found, err := d.readStored(ctx, db, keyStr)
+		if err != nil {
+			return err
+		}
+		if !found && !missingAsEmpty {
+			return fmt.Errorf("can't swap missing key %q", keyStr)
+		}
+		values[i], serializations[i] = value, serialization
+	}
+	ops := []TxnOp{
+		{Op: "put", Key: keyA, Value: values[1], stored: serializations[1]},
+		{Op: "put", Key: keyB, Value: values[0], stored: serializations[0]},
+	}
+	return d.applyTransaction(ctx, db, batcher, ops)
+}
+
+// readStored gets a key's value and its serialization as stored, following any chunks or
+// deduplicated payload, so the value can be written under another key without re-encoding.
+func (d *Data) readStored(ctx storage.Context, db storage.OrderedKeyValueDB, keyStr string) (value, serialization []byte, found bool, err error) {
+	tk, err := NewTKey(keyStr)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	data, err := db.Get(ctx, tk)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("Error in retrieving key '%s': %v", keyStr, err)
+	}
+	if data == nil {
+		return nil, nil, false, nil
+	}
+	if serialization, err = d.resolveValue(ctx, db, keyStr, data); err != nil {
+		return nil, nil, false, fmt.Errorf("Error in resolving key '%s': %v", keyStr, err)
+	}
+	if value, err = d.decodeValue(serialization); err != nil {
+		return nil, nil, false, fmt.Errorf("Unable to deserialize data for key '%s': %v\n", keyStr, err)
+	}
+	return value, serialization, true, nil
+}
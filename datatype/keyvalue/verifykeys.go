@@ -0,0 +1,112 @@
+/*
+	This file supports a read-only scan that checks every stored key of an instance decodes
+	with the current key format, e.g., after a change to key encoding.
+*/
+
+package keyvalue
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// MaxKeyDecodeSamples is the maximum number of failed keys listed in a key decode report.
+const MaxKeyDecodeSamples = 100
+
+// KeyDecodeFailure is a stored key that failed to decode.
+type KeyDecodeFailure struct {
+	Key       string // hex-encoded full storage key
+	VersionID dvid.VersionID
+	Error     string
+}
+
+// KeyDecodeReport summarizes a scan of all stored keys of an instance.
+type KeyDecodeReport struct {
+	Scanned uint64 // stored keys across all versions and key classes
+	Decoded uint64 // keys and soft-deleted keys that decoded to a key string
+	Failed  uint64 // keys that failed to decode
+
+	// Samples holds up to MaxKeyDecodeSamples of the failed keys in storage order.
+	Samples []KeyDecodeFailure
+}
+
+// decodeStoredKey checks that a full storage key of the instance decodes to a type-specific
+// key of a known class and, for classes holding a key string, returns whether it decoded to
+// one.
+func (d *Data) decodeStoredKey(k storage.Key) (decoded bool, err error) {
+	tk, err := storage.TKeyFromKey(k)
+	if err != nil {
+		return false, err
+	}
+	class, err := tk.Class()
+	if err != nil {
+		return false, err
+	}
+	switch class {
+	case keyStandard:
+		_, err = DecodeTKey(tk)
+		return err == nil, err
+	case keyTombstone:
+		_, err = DecodeTombstoneTKey(tk)
+		return err == nil, err
+	case keyAccessed:
+		_, err = DecodeAccessedTKey(tk)
+		return false, err
+	case keyProperties, keyDedup, keyModified, keyChunk, keyIndex, keyIdempotency, keyMeta:
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown keyvalue key class %d", class)
+}
+
+// VerifyKeys scans all stored keys of the instance, across all versions and key classes
+// including version tombstones, and reports those that don't decode with the current key
+// format, which would indicate a format mismatch or corruption.  Values aren't read.
+func (d *Data) VerifyKeys() (*KeyDecodeReport, error) {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := storage.NewDataContext(d, 0)
+	report := &KeyDecodeReport{Samples: []KeyDecodeFailure{}}
+	ch := make(chan *storage.KeyValue, 1000)
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			kv := <-ch
+			if kv == nil {
+				return
+			}
+			report.Scanned++
+			decoded, err := d.decodeStoredKey(kv.K)
+			if err == nil {
+				if decoded {
+					report.Decoded++
+				}
+				continue
+			}
+			report.Failed++
+			if len(report.Samples) < MaxKeyDecodeSamples {
+				failure := KeyDecodeFailure{Key: hex.EncodeToString(kv.K), Error: err.Error()}
+				failure.VersionID, _ = ctx.VersionFromKey(kv.K)
+				report.Samples = append(report.Samples, failure)
+			}
+		}
+	}()
+
+	minKey, maxKey := ctx.KeyRange()
+	keysOnly := true
+	if err = db.RawRangeQuery(minKey, maxKey, keysOnly, ch, nil); err != nil {
+		return nil, err
+	}
+	wg.Wait()
+	return report, nil
+}
@@ -0,0 +1,115 @@
+/*
+	This file supports reporting the stored bytes added by each version of an instance,
+	e.g., to decide which branches are worth flattening or pruning.
+*/
+
+package keyvalue
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// VersionBytes is the storage attributed to one version, which holds the key-value pairs
+// written or deleted in that version.
+type VersionBytes struct {
+	UUID       dvid.UUID `json:",omitempty"` // empty if the version is no longer in the DAG
+	VersionID  dvid.VersionID
+	Keys       int    // stored key-values of the version, including tombstones
+	Tombstones int    // deletions of keys stored in ancestor versions
+	Bytes      uint64 // stored bytes of full keys and values
+}
+
+// GetVersionBytes scans all stored key-values of the instance, across all of its key
+// classes, and attributes their bytes to the versions encoded in their keys.  Versions
+// are returned in breadth-first order from the root of the repo holding the given version,
+// followed by any versions with stored data that are no longer in the DAG.
+func (d *Data) GetVersionBytes(v dvid.VersionID) ([]VersionBytes, error) {
+	d.flushWrites()
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := storage.NewDataContext(d, 0)
+	stats := make(map[dvid.VersionID]*VersionBytes)
+	var scanErr error
+	ch := make(chan *storage.KeyValue, 1000)
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			kv := <-ch
+			if kv == nil {
+				return
+			}
+			kvVersion, err := ctx.VersionFromKey(kv.K)
+			if err != nil {
+				if scanErr == nil {
+					scanErr = err
+				}
+				continue
+			}
+			vb, found := stats[kvVersion]
+			if !found {
+				vb = &VersionBytes{VersionID: kvVersion}
+				stats[kvVersion] = vb
+			}
+			vb.Keys++
+			if kv.K.IsTombstone() {
+				vb.Tombstones++
+			}
+			vb.Bytes += uint64(len(kv.K) + len(kv.V))
+		}
+	}()
+
+	minKey, maxKey := ctx.KeyRange()
+	keysOnly := false
+	if err = db.RawRangeQuery(minKey, maxKey, keysOnly, ch, nil); err != nil {
+		return nil, err
+	}
+	wg.Wait()
+	if scanErr != nil {
+		return nil, scanErr
+	}
+
+	root, err := datastore.GetRepoRootVersion(v)
+	if err != nil {
+		return nil, err
+	}
+	var report []VersionBytes
+	visited := map[dvid.VersionID]bool{root: true}
+	for queue := []dvid.VersionID{root}; len(queue) != 0; queue = queue[1:] {
+		cur := queue[0]
+		vb, found := stats[cur]
+		if !found {
+			vb = &VersionBytes{VersionID: cur}
+		}
+		delete(stats, cur)
+		if vb.UUID, err = datastore.UUIDFromVersion(cur); err != nil {
+			return nil, err
+		}
+		report = append(report, *vb)
+		children, err := datastore.GetChildrenByVersion(cur)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			if !visited[child] {
+				visited[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+	var orphans []VersionBytes
+	for _, vb := range stats {
+		orphans = append(orphans, *vb)
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].VersionID < orphans[j].VersionID })
+	return append(report, orphans...), nil
+}
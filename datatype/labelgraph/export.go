@@ -0,0 +1,321 @@
+/*
+	This file supports export and import of a graph in GraphML or edge-list format for use
+	with network-analysis tools like Gephi or NetworkX.
+*/
+
+package labelgraph
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+const graphMLNamespace = "http://graphml.graphdrawing.org/xmlns"
+
+// GraphML key ids for vertex and edge weights.  Property keys have ids "v:<name>" for
+// vertices and "e:<name>" for edges.
+const (
+	graphMLVertexWeight = "vweight"
+	graphMLEdgeWeight   = "eweight"
+)
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr,omitempty"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// sortedProperties returns the property names of a graph element in order.
+func sortedProperties(props dvid.ElementProperties) []string {
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExportGraphML writes the graph as GraphML.  Vertex and edge weights are "weight"
+// attributes, and properties are string attributes holding base64-encoded values.
+func (d *Data) ExportGraphML(w io.Writer, ctx storage.Context, db storage.GraphDB) error {
+	vertices, err := db.GetVertices(ctx)
+	if err != nil {
+		return err
+	}
+	edges, err := db.GetEdges(ctx)
+	if err != nil {
+		return err
+	}
+	doc := graphML{Xmlns: graphMLNamespace}
+	doc.Keys = []graphMLKey{
+		{ID: graphMLVertexWeight, For: "node", Name: "weight", Type: "double"},
+		{ID: graphMLEdgeWeight, For: "edge", Name: "weight", Type: "double"},
+	}
+	doc.Graph.EdgeDefault = "undirected"
+	keys := make(map[string]bool)
+	addKey := func(id, kind, name string) {
+		if !keys[id] {
+			keys[id] = true
+			doc.Keys = append(doc.Keys, graphMLKey{ID: id, For: kind, Name: name, Type: "string"})
+		}
+	}
+	for _, vertex := range vertices {
+		node := graphMLNode{ID: strconv.FormatUint(uint64(vertex.Id), 10)}
+		node.Data = append(node.Data, graphMLData{graphMLVertexWeight, strconv.FormatFloat(vertex.Weight, 'g', -1, 64)})
+		for _, name := range sortedProperties(vertex.Properties) {
+			value, err := db.GetVertexProperty(ctx, vertex.Id, name)
+			if err != nil {
+				return fmt.Errorf("can't get property %q of vertex %d: %v", name, vertex.Id, err)
+			}
+			addKey("v:"+name, "node", name)
+			node.Data = append(node.Data, graphMLData{"v:" + name, base64.StdEncoding.EncodeToString(value)})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+	for _, e := range edges {
+		id1, id2 := e.Vertexpair.Vertex1, e.Vertexpair.Vertex2
+		edge := graphMLEdge{
+			Source: strconv.FormatUint(uint64(id1), 10),
+			Target: strconv.FormatUint(uint64(id2), 10),
+		}
+		edge.Data = append(edge.Data, graphMLData{graphMLEdgeWeight, strconv.FormatFloat(e.Weight, 'g', -1, 64)})
+		for _, name := range sortedProperties(e.Properties) {
+			value, err := db.GetEdgeProperty(ctx, id1, id2, name)
+			if err != nil {
+				return fmt.Errorf("can't get property %q of edge %d-%d: %v", name, id1, id2, err)
+			}
+			addKey("e:"+name, "edge", name)
+			edge.Data = append(edge.Data, graphMLData{"e:" + name, base64.StdEncoding.EncodeToString(value)})
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, edge)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(doc)
+}
+
+// ExportEdgeList writes a line "<vertex1> <vertex2> <weight>" for each edge.  The format
+// can't represent vertex weights, properties, or vertices without edges.
+func (d *Data) ExportEdgeList(w io.Writer, ctx storage.Context, db storage.GraphDB) error {
+	edges, err := db.GetEdges(ctx)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	for _, e := range edges {
+		if _, err := fmt.Fprintf(bw, "%d %d %s\n", e.Vertexpair.Vertex1, e.Vertexpair.Vertex2, strconv.FormatFloat(e.Weight, 'g', -1, 64)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// parseVertexID parses a decimal vertex ID.
+func parseVertexID(s string) (dvid.VertexID, error) {
+	id, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad vertex id %q, expected unsigned integer", s)
+	}
+	return dvid.VertexID(id), nil
+}
+
+// graphMLValue returns the bytes of a property value, which are base64-encoded for the
+// property keys of DVID exports and plain text for other keys, e.g., from other tools.
+func graphMLValue(keyID, s string) ([]byte, error) {
+	if strings.HasPrefix(keyID, "v:") || strings.HasPrefix(keyID, "e:") {
+		return base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	}
+	return []byte(s), nil
+}
+
+// ImportGraphML adds the vertices and edges of a GraphML document to the graph in one
+// transaction, overwriting the weights and given properties of existing vertices and edges.
+// Attributes named "weight" are used as weights and others are stored as properties.
+func (d *Data) ImportGraphML(r io.Reader, ctx storage.Context, db storage.GraphDB) (numVertices, numEdges int, err error) {
+	var doc graphML
+	if err = xml.NewDecoder(r).Decode(&doc); err != nil {
+		return 0, 0, fmt.Errorf("can't parse GraphML: %v", err)
+	}
+	keyNames := make(map[string]string, len(doc.Keys))
+	for _, key := range doc.Keys {
+		keyNames[key.ID] = key.Name
+	}
+	txn, err := db.BeginGraphTxn(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		if err != nil {
+			txn.Abort()
+		}
+	}()
+	parseData := func(data []graphMLData) (weight float64, props map[string][]byte, err error) {
+		props = make(map[string][]byte)
+		for _, datum := range data {
+			name, found := keyNames[datum.Key]
+			if !found {
+				name = datum.Key
+			}
+			if name == "weight" {
+				if weight, err = strconv.ParseFloat(strings.TrimSpace(datum.Value), 64); err != nil {
+					return 0, nil, fmt.Errorf("bad weight %q: %v", datum.Value, err)
+				}
+				continue
+			}
+			if props[name], err = graphMLValue(datum.Key, datum.Value); err != nil {
+				return 0, nil, fmt.Errorf("bad base64 value of property %q: %v", name, err)
+			}
+		}
+		return weight, props, nil
+	}
+	for _, node := range doc.Graph.Nodes {
+		id, err := parseVertexID(node.ID)
+		if err != nil {
+			return 0, 0, err
+		}
+		weight, props, err := parseData(node.Data)
+		if err != nil {
+			return 0, 0, fmt.Errorf("vertex %d: %v", id, err)
+		}
+		if err = txn.AddVertex(ctx, id, weight); err != nil {
+			return 0, 0, err
+		}
+		for name, value := range props {
+			if err = txn.SetVertexProperty(ctx, id, name, value); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	for _, edge := range doc.Graph.Edges {
+		id1, err := parseVertexID(edge.Source)
+		if err != nil {
+			return 0, 0, err
+		}
+		id2, err := parseVertexID(edge.Target)
+		if err != nil {
+			return 0, 0, err
+		}
+		weight, props, err := parseData(edge.Data)
+		if err != nil {
+			return 0, 0, fmt.Errorf("edge %d-%d: %v", id1, id2, err)
+		}
+		if err = txn.AddEdge(ctx, id1, id2, weight); err != nil {
+			return 0, 0, fmt.Errorf("can't add edge %d-%d, are both vertices given as nodes? %v", id1, id2, err)
+		}
+		for name, value := range props {
+			if err = txn.SetEdgeProperty(ctx, id1, id2, name, value); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	if err = txn.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return len(doc.Graph.Nodes), len(doc.Graph.Edges), nil
+}
+
+// ImportEdgeList adds edges from lines "<vertex1> <vertex2> [weight]" in one transaction,
+// creating vertices with zero weight if they don't exist.  Blank lines and lines beginning
+// with "#" are ignored.
+func (d *Data) ImportEdgeList(r io.Reader, ctx storage.Context, db storage.GraphDB) (numVertices, numEdges int, err error) {
+	txn, err := db.BeginGraphTxn(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		if err != nil {
+			txn.Abort()
+		}
+	}()
+	seen := make(map[dvid.VertexID]bool)
+	addVertex := func(id dvid.VertexID) error {
+		if seen[id] {
+			return nil
+		}
+		seen[id] = true
+		if _, err := db.GetVertex(ctx, id); err == nil {
+			return nil
+		}
+		numVertices++
+		return txn.AddVertex(ctx, id, 0)
+	}
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return 0, 0, fmt.Errorf("line %d: expected \"<vertex1> <vertex2> [weight]\", got %q", lineNum, line)
+		}
+		var ids [2]dvid.VertexID
+		for i := range ids {
+			if ids[i], err = parseVertexID(fields[i]); err != nil {
+				return 0, 0, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+			if err = addVertex(ids[i]); err != nil {
+				return 0, 0, err
+			}
+		}
+		var weight float64
+		if len(fields) == 3 {
+			if weight, err = strconv.ParseFloat(fields[2], 64); err != nil {
+				return 0, 0, fmt.Errorf("line %d: bad weight %q", lineNum, fields[2])
+			}
+		}
+		if err = txn.AddEdge(ctx, ids[0], ids[1], weight); err != nil {
+			return 0, 0, err
+		}
+		numEdges++
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+	if err = txn.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return numVertices, numEdges, nil
+}
@@ -157,6 +157,36 @@ DELETE  <api URL>/node/<UUID>/<data name>/subgraph
     unsafe        Disable check of incoming JSON file (since schema verification is slow currently).
                   Default false.
     
+GET  <api URL>/node/<UUID>/<data name>/export?format=<graphml|edgelist>
+
+    Returns the whole graph in a standard format for network-analysis tools like Gephi or
+    NetworkX.  The default "graphml" format returns GraphML with "weight" attributes for
+    vertex and edge weights and a string attribute per property holding its base64-encoded
+    value.  The "edgelist" format returns a line "<vertex1> <vertex2> <weight>" per edge,
+    which can't represent vertex weights, properties, or vertices without edges.
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of data to export.
+
+POST  <api URL>/node/<UUID>/<data name>/import?format=<graphml|edgelist>
+
+    Adds the vertices and edges in the request body, given in a format returned by the
+    "export" endpoint, in one transaction.  Weights and properties of existing vertices and
+    edges are overwritten.  GraphML attributes named "weight" are used as weights and others
+    are stored as properties.  Values of property keys with "v:" or "e:" ids, as in DVID
+    exports, are base64-decoded and other values are stored as given.  Edge-list lines are "<vertex1> <vertex2> [weight]", where vertices that don't
+    exist are created with zero weight, and blank lines or lines beginning with "#" are
+    ignored.  Returns JSON with the number of vertices and edges added:
+
+    { "Vertices": 2, "Edges": 1 }
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of data to import into.
+
 POST  <api URL>/node/<UUID>/<data name>/merge/[nohistory]
 
     Merge a list of vertices as specified by a vertex array called "vertices".
@@ -1358,6 +1388,55 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			server.BadRequest(w, r, err)
 			return
 		}
+	case "export":
+		if method != "get" {
+			server.BadRequest(w, r, "Only supports GETs")
+			return
+		}
+		if !d.setBusy() {
+			server.BadRequest(w, r, "Server busy with bulk transaction")
+			return
+		}
+		defer d.setNotBusy()
+		switch format := r.URL.Query().Get("format"); format {
+		case "", "graphml":
+			w.Header().Set("Content-Type", "application/xml")
+			err = d.ExportGraphML(w, ctx, db)
+		case "edgelist":
+			w.Header().Set("Content-Type", "text/plain")
+			err = d.ExportEdgeList(w, ctx, db)
+		default:
+			err = fmt.Errorf("unknown graph format %q, expected graphml or edgelist", format)
+		}
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+	case "import":
+		if method != "post" {
+			server.BadRequest(w, r, "Only supports POSTs")
+			return
+		}
+		if !d.setBusy() {
+			server.BadRequest(w, r, "Server busy with bulk transaction")
+			return
+		}
+		defer d.setNotBusy()
+		var numVertices, numEdges int
+		switch format := r.URL.Query().Get("format"); format {
+		case "", "graphml":
+			numVertices, numEdges, err = d.ImportGraphML(r.Body, ctx, db)
+		case "edgelist":
+			numVertices, numEdges, err = d.ImportEdgeList(r.Body, ctx, db)
+		default:
+			err = fmt.Errorf("unknown graph format %q, expected graphml or edgelist", format)
+		}
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"Vertices": %d, "Edges": %d}`, numVertices, numEdges)
 	case "neighbors":
 		if method != "get" {
 			server.BadRequest(w, r, "Only supports GETs")
@@ -180,3 +180,57 @@ func TestLabelgraphPostAndDelete(t *testing.T) {
 		t.Errorf("Bad ROI after ROI delete.  Should be %s got: %s\n", expectedResp, string(returnedData))
 	}
 }
+
+func TestLabelgraphExportImport(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	for _, name := range []dvid.InstanceName{"lg", "lg2"} {
+		if _, err := datastore.NewData(uuid, dtype, name, dvid.NewConfig()); err != nil {
+			t.Fatalf("Error creating new labelgraph instance %q: %v\n", name, err)
+		}
+	}
+	subgraphRequest := fmt.Sprintf("%snode/%s/lg/subgraph", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", subgraphRequest, getGraphJSON())
+	propertyRequest := fmt.Sprintf("%snode/%s/lg/property/1/color", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", propertyRequest, bytes.NewBufferString("red"))
+
+	exportRequest := fmt.Sprintf("%snode/%s/lg/export", server.WebAPIPath, uuid)
+	graphml := server.TestHTTP(t, "GET", exportRequest, nil)
+	if !bytes.Contains(graphml, []byte(`attr.name="color"`)) {
+		t.Errorf("expected exported GraphML to include vertex property key:\n%s\n", string(graphml))
+	}
+
+	// a deleted graph is restored by importing its GraphML export.
+	server.TestHTTP(t, "DELETE", subgraphRequest, nil)
+	importRequest := fmt.Sprintf("%snode/%s/lg/import", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", importRequest, bytes.NewReader(graphml))
+	retgraph, err := loadGraphJSON(server.TestHTTP(t, "GET", subgraphRequest, nil))
+	if err != nil {
+		t.Fatalf("Error on getting back JSON from subgraph GET: %v\n", err)
+	}
+	if !reflect.DeepEqual(retgraph, getTestGraph()) {
+		t.Errorf("Bad GraphML export/import roundtrip\nOriginal:\n%v\nReturned:\n%v\n", getTestGraph(), retgraph)
+	}
+	if color := server.TestHTTP(t, "GET", propertyRequest, nil); string(color) != "red" {
+		t.Errorf("expected imported vertex property %q, got %q\n", "red", string(color))
+	}
+
+	edgelist := server.TestHTTP(t, "GET", exportRequest+"?format=edgelist", nil)
+	if string(edgelist) != "1 2 10\n" {
+		t.Errorf("unexpected edge list: %q\n", string(edgelist))
+	}
+	importRequest = fmt.Sprintf("%snode/%s/lg2/import?format=edgelist", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", importRequest, bytes.NewBufferString("# comment\n1 2 10\n2 3\n"))
+	retgraph, err = loadGraphJSON(server.TestHTTP(t, "GET", fmt.Sprintf("%snode/%s/lg2/subgraph", server.WebAPIPath, uuid), nil))
+	if err != nil {
+		t.Fatalf("Error on getting back JSON from subgraph GET: %v\n", err)
+	}
+	if len(retgraph.Vertices) != 3 || len(retgraph.Edges) != 2 {
+		t.Errorf("expected 3 vertices and 2 edges from edge list import, got %v\n", retgraph)
+	}
+	server.TestBadHTTP(t, "POST", importRequest, bytes.NewBufferString("1 x\n"))
+}
@@ -0,0 +1,75 @@
+/*
+	This file supports pluggable value codecs that apply domain-specific encodings to data
+	before compression during serialization.
+*/
+
+package dvid
+
+import (
+	"fmt"
+	"sync"
+)
+
+// CodecID identifies a codec within serialized data.  Zero is reserved for no codec.
+type CodecID uint8
+
+// Codec is a domain-specific encoding of data, e.g., a specialized mesh encoding, that is
+// applied before any compression during serialization and reversed after decompression.
+type Codec interface {
+	// ID returns the identifier stored with each serialized value.  It must never change
+	// once data has been stored with the codec.
+	ID() CodecID
+
+	// Name returns the name used to configure data instances with the codec.
+	Name() string
+
+	Encode(data []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+var (
+	codecMu      sync.RWMutex
+	codecsByID   = make(map[CodecID]Codec)
+	codecsByName = make(map[string]Codec)
+)
+
+// RegisterCodec makes a codec available for serialization.  It is typically called from
+// the init() of the package implementing the codec.
+func RegisterCodec(c Codec) error {
+	if c.ID() == 0 {
+		return fmt.Errorf("codec %q can't use reserved codec ID 0", c.Name())
+	}
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	if existing, found := codecsByID[c.ID()]; found {
+		return fmt.Errorf("codec %q has same ID %d as registered codec %q", c.Name(), c.ID(), existing.Name())
+	}
+	if _, found := codecsByName[c.Name()]; found {
+		return fmt.Errorf("codec %q is already registered", c.Name())
+	}
+	codecsByID[c.ID()] = c
+	codecsByName[c.Name()] = c
+	return nil
+}
+
+// GetCodecByName returns the registered codec with the given name.
+func GetCodecByName(name string) (Codec, error) {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	c, found := codecsByName[name]
+	if !found {
+		return nil, fmt.Errorf("no codec %q has been registered", name)
+	}
+	return c, nil
+}
+
+// getCodec returns the registered codec with the given ID.
+func getCodec(id CodecID) (Codec, error) {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	c, found := codecsByID[id]
+	if !found {
+		return nil, fmt.Errorf("no codec with ID %d has been registered", id)
+	}
+	return c, nil
+}
@@ -167,16 +167,34 @@ func (checksum Checksum) String() string {
 }
 
 // SerializationFormat combines both compression and checksum methods.
-// First 3 bits specifies compression, next 2 bits is the checkum, and
-// the final 3 bits is reserved for future use.
+// First 3 bits specifies compression, next 2 bits is the checkum, the next bit
+// is set if a codec ID follows the format byte, and the final 2 bits are reserved
+// for future use.
 type SerializationFormat uint8
 
+// codecFormatFlag is set in a SerializationFormat if the data was encoded with a codec.
+const codecFormatFlag SerializationFormat = 0x04
+
 func EncodeSerializationFormat(compress Compression, checksum Checksum) SerializationFormat {
 	a := uint8(compress.format&0x07) << 5
 	b := uint8(checksum&0x03) << 3
 	return SerializationFormat(a | b)
 }
 
+// StoredSerializationFormat returns the format byte that leads data serialized with the
+// given settings, where a checksum is dropped for Gzip and a non-empty codec name sets the
+// codec flag.
+func StoredSerializationFormat(compress Compression, checksum Checksum, codecName string) SerializationFormat {
+	if compress.format == Gzip {
+		checksum = NoChecksum
+	}
+	format := EncodeSerializationFormat(compress, checksum)
+	if codecName != "" {
+		format |= codecFormatFlag
+	}
+	return format
+}
+
 func DecodeSerializationFormat(s SerializationFormat) (CompressionFormat, Checksum) {
 	format := CompressionFormat(s >> 5)
 	checksum := Checksum(s>>3) & 0x03
@@ -186,11 +204,30 @@ func DecodeSerializationFormat(s SerializationFormat) (CompressionFormat, Checks
 // SerializeData serializes a slice of bytes using optional compression, checksum.
 // Checksum will be ignored if the underlying compression already employs checksums, e.g., Gzip.
 func SerializeData(data []byte, compress Compression, checksum Checksum) ([]byte, error) {
+	return SerializeDataWithCodec(data, "", compress, checksum)
+}
+
+// SerializeDataWithCodec serializes a slice of bytes after encoding it with the named codec,
+// followed by optional compression, checksum.  If the codec name is empty, no codec is used.
+// The codec ID is stored with the serialization so DeserializeData can decode it.
+func SerializeDataWithCodec(data []byte, codecName string, compress Compression, checksum Checksum) ([]byte, error) {
 	if data == nil || len(data) == 0 {
 		return []byte{}, nil
 	}
 
 	var err error
+	var codecID CodecID
+	if codecName != "" {
+		codec, err := GetCodecByName(codecName)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = codec.Encode(data); err != nil {
+			return nil, fmt.Errorf("unable to encode data with codec %q: %v", codecName, err)
+		}
+		codecID = codec.ID()
+	}
+
 	var byteData []byte
 	switch compress.format {
 	case Uncompressed:
@@ -241,43 +278,50 @@ func SerializeData(data []byte, compress Compression, checksum Checksum) ([]byte
 		return nil, fmt.Errorf("Illegal compression (%s) during serialization", compress)
 	}
 
-	return SerializePrecompressedData(byteData, compress, checksum)
+	return serializePrecompressedData(byteData, codecID, compress, checksum)
 }
 
 // SerializePrecompressedData serializes a slice of bytes that have already been compressed
 // and adds DVID serialization for discerning optional compression and checksum.
 // Checksum will be ignored if the underlying compression already employs checksums, e.g., Gzip.
 func SerializePrecompressedData(data []byte, compress Compression, checksum Checksum) ([]byte, error) {
+	return serializePrecompressedData(data, 0, compress, checksum)
+}
+
+func serializePrecompressedData(data []byte, codecID CodecID, compress Compression, checksum Checksum) ([]byte, error) {
 	if data == nil || len(data) == 0 {
 		return []byte{}, nil
 	}
-	buf := make([]byte, 5+len(data))
+	buf := make([]byte, 6+len(data))
 
 	// Don't duplicate checksum if using Gzip, which already has checksum & length checks.
 	if compress.format == Gzip {
 		checksum = NoChecksum
 	}
 
-	// Store the requested compression and checksum
-	buf[0] = byte(EncodeSerializationFormat(compress, checksum))
+	// Store the requested compression and checksum, followed by any codec.
+	format := EncodeSerializationFormat(compress, checksum)
+	added := 1
+	if codecID != 0 {
+		format |= codecFormatFlag
+		buf[1] = byte(codecID)
+		added++
+	}
+	buf[0] = byte(format)
 
 	// Handle checksum if requested
-	added := 1
 	switch checksum {
 	case NoChecksum:
 	case CRC32:
 		crcChecksum := crc32.ChecksumIEEE(data)
-		binary.LittleEndian.PutUint32(buf[1:5], crcChecksum)
+		binary.LittleEndian.PutUint32(buf[added:added+4], crcChecksum)
 		added += 4
 	default:
 		return nil, fmt.Errorf("Illegal checksum (%s) in serialize.SerializeData()", checksum)
 	}
 
 	copy(buf[added:], data)
-	if added == 1 {
-		buf = buf[:1+len(data)]
-	}
-	return buf, nil
+	return buf[:added+len(data)], nil
 }
 
 // Serialize an arbitrary Go object using Gob encoding and optional compression, checksum.
@@ -294,8 +338,8 @@ func Serialize(object interface{}, compress Compression, checksum Checksum) ([]b
 	return SerializeData(buffer.Bytes(), compress, checksum)
 }
 
-// DeserializeData deserializes a slice of bytes using stored compression, checksum.
-// If uncompress parameter is false, the data is not uncompressed.
+// DeserializeData deserializes a slice of bytes using stored compression, checksum, and
+// any codec.  If uncompress parameter is false, the data is not uncompressed or decoded.
 func DeserializeData(s []byte, uncompress bool) ([]byte, CompressionFormat, error) {
 	if s == nil || len(s) == 0 {
 		return []byte{}, Uncompressed, nil
@@ -309,6 +353,35 @@ func DeserializeData(s []byte, uncompress bool) ([]byte, CompressionFormat, erro
 	}
 	compression, checksum := DecodeSerializationFormat(format)
 
+	// Get any codec.
+	var codecID CodecID
+	if format&codecFormatFlag != 0 {
+		if err := binary.Read(buffer, binary.LittleEndian, &codecID); err != nil {
+			return nil, 0, fmt.Errorf("Error reading codec: %v", err)
+		}
+	}
+	if !uncompress || codecID == 0 {
+		return decompressData(buffer, checksum, compression, uncompress)
+	}
+	codec, err := getCodec(codecID)
+	if err != nil {
+		return nil, 0, err
+	}
+	encoded, compression, err := decompressData(buffer, checksum, compression, uncompress)
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := codec.Decode(encoded)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to decode data with codec %q: %v", codec.Name(), err)
+	}
+	return data, compression, nil
+}
+
+// decompressData verifies any checksum and returns the remaining data in the buffer
+// with optional decompression.
+func decompressData(buffer *bytes.Buffer, checksum Checksum, compression CompressionFormat, uncompress bool) ([]byte, CompressionFormat, error) {
+
 	// Get any checksum.
 	var storedCrc32 uint32
 	switch checksum {
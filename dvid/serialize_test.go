@@ -112,6 +112,59 @@ func readData(t *testing.T, filepath string) []byte {
 	return data
 }
 
+// reverseCodec is a test codec that reverses the bytes of data.
+type reverseCodec struct{}
+
+func (c reverseCodec) ID() CodecID  { return 200 }
+func (c reverseCodec) Name() string { return "reverse" }
+
+func (c reverseCodec) Encode(data []byte) ([]byte, error) {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[len(data)-1-i] = b
+	}
+	return out, nil
+}
+
+func (c reverseCodec) Decode(data []byte) ([]byte, error) {
+	return c.Encode(data)
+}
+
+func TestCodecSerialization(t *testing.T) {
+	if err := RegisterCodec(reverseCodec{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterCodec(reverseCodec{}); err == nil {
+		t.Errorf("expected error registering duplicate codec\n")
+	}
+	data := []byte("some data to be encoded by a codec")
+	for _, format := range []CompressionFormat{Uncompressed, Snappy, LZ4, Gzip} {
+		for _, checksum := range []Checksum{NoChecksum, CRC32} {
+			compression, err := NewCompression(format, DefaultCompression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s, err := SerializeDataWithCodec(data, "reverse", compression, checksum)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format == Uncompressed && bytes.Contains(s, data) {
+				t.Errorf("expected codec to encode data, got %q\n", s)
+			}
+			out, _, err := DeserializeData(s, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out, data) {
+				t.Errorf("bad codec round trip with %s, %s: got %q\n", compression, checksum, out)
+			}
+		}
+	}
+	if _, err := SerializeDataWithCodec(data, "unknown", Compression{}, NoChecksum); err == nil {
+		t.Errorf("expected error serializing with unregistered codec\n")
+	}
+}
+
 func TestIncompressibleLZ4(t *testing.T) {
 	incompressibleData := make([]byte, 30)
 	for i := 0; i < 30; i++ {
@@ -0,0 +1,256 @@
+/*
+	This file supports repo-level batches of key puts and deletes that span data instances.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+	"github.com/zenazn/goji/web"
+)
+
+// MaxBatchOps is the maximum number of operations in a repo-level batch.
+const MaxBatchOps = 10000
+
+// BatchRequest is the body of a repo-level batch.
+type BatchRequest struct {
+	Atomic     bool
+	Operations []datastore.BatchOp
+}
+
+// BatchOpResult is the outcome of one operation of a repo-level batch.
+type BatchOpResult struct {
+	Instance dvid.InstanceName
+	Op       string
+	Key      string
+	Applied  bool
+	Error    string `json:",omitempty"`
+}
+
+// BatchResponse gives the outcome of each operation of a repo-level batch, in the order
+// of the request.
+type BatchResponse struct {
+	Atomic  bool
+	Applied int
+	Failed  int
+	Results []BatchOpResult
+}
+
+// batchGroup is the operations of a batch targeting one data instance.
+type batchGroup struct {
+	name    dvid.InstanceName
+	applier datastore.BatchOpApplier
+	ctx     *datastore.VersionedCtx
+	db      storage.OrderedKeyValueDB
+	batcher storage.KeyValueBatcher
+	indices []int // indices of the operations in the request
+	ops     []datastore.BatchOp
+	err     error
+}
+
+// prepare checks that the group's instance accepts the operations at the given version
+// and gets its store.
+func (g *batchGroup) prepare(uuid dvid.UUID) error {
+	data, err := datastore.GetDataByUUIDName(uuid, g.name)
+	if err != nil {
+		return err
+	}
+	var ok bool
+	if g.applier, ok = data.(datastore.BatchOpApplier); !ok {
+		return fmt.Errorf("data %q of type %q does not support batch operations", g.name, data.TypeName())
+	}
+	for _, op := range g.ops {
+		var method string
+		switch op.Op {
+		case "put":
+			method = "POST"
+		case "delete":
+			method = "DELETE"
+		default:
+			return fmt.Errorf("unknown op %q for key %q, must be %q or %q", op.Op, op.Key, "put", "delete")
+		}
+		if policy, ok := data.(interface {
+			OperationAllowed(method, endpoint string) bool
+		}); ok && !policy.OperationAllowed(method, "key") {
+			return fmt.Errorf("data %q does not allow %s on endpoint %q", g.name, method, "key")
+		}
+	}
+	if pauser, ok := data.(pausable); ok && pauser.IsPaused() {
+		return fmt.Errorf("writes to data %q are paused for maintenance", g.name)
+	}
+	if ro, ok := data.(interface {
+		IsReadOnly() bool
+	}); ok && ro.IsReadOnly() {
+		return fmt.Errorf("data %q is read-only", g.name)
+	}
+	v, err := datastore.VersionFromUUID(uuid)
+	if err != nil {
+		return err
+	}
+	if data.Versioned() {
+		locked, err := datastore.LockedUUID(uuid)
+		if err != nil {
+			return err
+		}
+		if !fullwrite && locked {
+			return fmt.Errorf("cannot write data %q on locked node %s", g.name, uuid)
+		}
+	} else if v, err = datastore.GetRepoRootVersion(v); err != nil {
+		return err
+	}
+	g.ctx = datastore.NewVersionedCtx(data, v)
+	if g.db, err = datastore.GetOrderedKeyValueDB(data); err != nil {
+		return err
+	}
+	if g.batcher, ok = g.db.(storage.KeyValueBatcher); !ok {
+		return fmt.Errorf("store of data %q does not support batches", g.name)
+	}
+	return nil
+}
+
+// apply applies the group's operations through its instance's own write path.
+func (g *batchGroup) apply(user string) error {
+	return g.applier.ApplyBatchOps(g.ctx, g.ops, user)
+}
+
+// sameStore returns true if the stores are the same, avoiding a panic when comparing
+// stores that aren't comparable.
+func sameStore(a, b storage.OrderedKeyValueDB) bool {
+	t := reflect.TypeOf(a)
+	return t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
+
+// applyAtomic stages the operations of all groups in one batch and commits it, so either
+// all operations are applied or none are.  Groups are staged in instance name order so
+// concurrent batches hold off writes to their instances in a consistent order.  Each
+// group's puts are charged to its own instance's quota, if any.
+func applyAtomic(groups []*batchGroup, user string) error {
+	sort.Slice(groups, func(i, j int) bool { return groups[i].name < groups[j].name })
+	db := storage.Unmetered(groups[0].db)
+	for _, g := range groups[1:] {
+		if !sameStore(storage.Unmetered(g.db), db) {
+			return fmt.Errorf("atomic batch requires all instances use the same store, but %q and %q don't", groups[0].name, g.name)
+		}
+	}
+	batcher, ok := db.(storage.KeyValueBatcher)
+	if !ok {
+		return fmt.Errorf("store of data %q does not support batches", groups[0].name)
+	}
+	batch := batcher.NewBatch(groups[0].ctx)
+	multi, ok := batch.(storage.MultiContextBatch)
+	if len(groups) > 1 && !ok {
+		return fmt.Errorf("store of data %q does not support atomic batches across instances", groups[0].name)
+	}
+	commit := batch.Commit
+	for i := len(groups) - 1; i >= 0; i-- {
+		g, next := groups[i], commit
+		commit = func() error {
+			if multi != nil {
+				multi.SetContext(g.ctx)
+			}
+			charged, reserve := storage.ChargedBatch(g.db, batch)
+			return g.applier.StageBatchOps(g.ctx, charged, g.ops, user, func() error {
+				if err := reserve(); err != nil {
+					return err
+				}
+				return next()
+			})
+		}
+	}
+	return commit()
+}
+
+func repoBatchHandler(c web.C, w http.ResponseWriter, r *http.Request) {
+	uuid := c.Env["uuid"].(dvid.UUID)
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, r, "bad batch JSON: %v", err)
+		return
+	}
+	if len(req.Operations) == 0 {
+		BadRequest(w, r, "batch has no operations")
+		return
+	}
+	if len(req.Operations) > MaxBatchOps {
+		BadRequest(w, r, "batch has %d operations, more than the maximum of %d", len(req.Operations), MaxBatchOps)
+		return
+	}
+
+	user := r.URL.Query().Get("u")
+	var groups []*batchGroup
+	byName := make(map[dvid.InstanceName]*batchGroup)
+	for i, op := range req.Operations {
+		g, found := byName[op.Instance]
+		if !found {
+			g = &batchGroup{name: op.Instance}
+			byName[op.Instance] = g
+			groups = append(groups, g)
+		}
+		g.indices = append(g.indices, i)
+		g.ops = append(g.ops, op)
+	}
+	for _, g := range groups {
+		g.err = g.prepare(uuid)
+	}
+
+	if req.Atomic {
+		var err error
+		for _, g := range groups {
+			if g.err != nil {
+				err = g.err
+				break
+			}
+		}
+		if err == nil {
+			err = applyAtomic(groups, user)
+		}
+		for _, g := range groups {
+			g.err = err
+		}
+	} else {
+		wg := new(sync.WaitGroup)
+		for _, g := range groups {
+			if g.err != nil {
+				continue
+			}
+			wg.Add(1)
+			go func(g *batchGroup) {
+				defer wg.Done()
+				g.err = g.apply(user)
+			}(g)
+		}
+		wg.Wait()
+	}
+
+	resp := BatchResponse{Atomic: req.Atomic, Results: make([]BatchOpResult, len(req.Operations))}
+	for _, g := range groups {
+		for j, i := range g.indices {
+			result := BatchOpResult{Instance: g.name, Op: g.ops[j].Op, Key: g.ops[j].Key, Applied: g.err == nil}
+			if g.err != nil {
+				result.Error = g.err.Error()
+				resp.Failed++
+			} else {
+				resp.Applied++
+			}
+			resp.Results[i] = result
+		}
+	}
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	dvid.Infof("Batch of %d operations on %d instances at node %s (atomic %t): %d applied, %d failed\n",
+		len(req.Operations), len(groups), uuid, req.Atomic, resp.Applied, resp.Failed)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonBytes))
+}
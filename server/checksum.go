@@ -0,0 +1,49 @@
+package server
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ChecksumHeader is a DVID-specific header giving the hexadecimal CRC32 (IEEE) checksum of
+// a payload, which is cheaper to compute than the standard Content-MD5 header.
+const ChecksumHeader = "X-Dvid-Checksum"
+
+// VerifyPayloadChecksum returns an error if the request has a Content-MD5 or DVID checksum
+// header that doesn't match the received body.  Requests without either header are not
+// checked, so clients opt in to verification of uploads.
+func VerifyPayloadChecksum(r *http.Request, body []byte) error {
+	if header := r.Header.Get("Content-MD5"); header != "" {
+		expected, err := base64.StdEncoding.DecodeString(header)
+		if err != nil {
+			return fmt.Errorf("bad Content-MD5 header %q, expected base64-encoded MD5: %v", header, err)
+		}
+		sum := md5.Sum(body)
+		if string(expected) != string(sum[:]) {
+			return fmt.Errorf("received %d bytes don't match Content-MD5 %q, payload may have been corrupted", len(body), header)
+		}
+	}
+	if header := r.Header.Get(ChecksumHeader); header != "" {
+		expected, err := strconv.ParseUint(strings.TrimPrefix(header, "0x"), 16, 32)
+		if err != nil {
+			return fmt.Errorf("bad %s header %q, expected hexadecimal CRC32: %v", ChecksumHeader, header, err)
+		}
+		if uint32(expected) != crc32.ChecksumIEEE(body) {
+			return fmt.Errorf("received %d bytes don't match %s %q, payload may have been corrupted", len(body), ChecksumHeader, header)
+		}
+	}
+	return nil
+}
+
+// SetPayloadChecksum sets the Content-MD5 and DVID checksum headers for a response body
+// so clients can verify what they receive.  It must be called before the body is written.
+func SetPayloadChecksum(w http.ResponseWriter, body []byte) {
+	sum := md5.Sum(body)
+	w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	w.Header().Set(ChecksumHeader, fmt.Sprintf("%08x", crc32.ChecksumIEEE(body)))
+}
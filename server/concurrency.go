@@ -0,0 +1,91 @@
+/*
+	This file supports limiting the number of concurrent requests of each client, so a
+	misbehaving client can't exhaust the server by opening many connections at once.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/zenazn/goji/web"
+)
+
+// ConcurrencyRetryAfter is the number of seconds clients are asked to wait before retrying
+// requests rejected for exceeding their concurrent request limit.
+const ConcurrencyRetryAfter = 1
+
+var (
+	// MaxConcurrentPerClient is the maximum number of requests from one client that are
+	// handled at once, where a client is an authenticated user or, for unauthenticated
+	// requests, a remote IP address.  Requests beyond the limit get status 429.  If not
+	// positive, there is no limit.
+	MaxConcurrentPerClient int
+
+	clientRequests   = make(map[string]int)
+	clientRequestsMu sync.Mutex
+)
+
+// requestClient returns the client a request is counted against: the user set in the
+// request environment by authentication or else the remote IP address.  The "u" query
+// string is not used since any client can set it.
+func requestClient(c *web.C, r *http.Request) string {
+	if user, ok := c.Env["user"].(string); ok && user != "" {
+		return "user " + user
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip " + host
+}
+
+// acquireClientRequest counts a request against the client's limit and returns false if
+// the client already has the maximum number of requests in progress.
+func acquireClientRequest(client string, max int) bool {
+	clientRequestsMu.Lock()
+	defer clientRequestsMu.Unlock()
+	if clientRequests[client] >= max {
+		return false
+	}
+	clientRequests[client]++
+	return true
+}
+
+func releaseClientRequest(client string) {
+	clientRequestsMu.Lock()
+	defer clientRequestsMu.Unlock()
+	if clientRequests[client] <= 1 {
+		delete(clientRequests, client)
+	} else {
+		clientRequests[client]--
+	}
+}
+
+// Middleware that rejects requests of clients that already have MaxConcurrentPerClient
+// requests in progress.
+func concurrencyHandler(c *web.C, h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		max := MaxConcurrentPerClient
+		if max <= 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		client := requestClient(c, r)
+		if !acquireClientRequest(client, max) {
+			msg := fmt.Sprintf("%s already has %d requests in progress, retry later", client, max)
+			dvid.Infof("Rejected %s %s: %s\n", r.Method, r.URL.Path, msg)
+			w.Header().Set("Retry-After", strconv.Itoa(ConcurrencyRetryAfter))
+			http.Error(w, msg, http.StatusTooManyRequests)
+			return
+		}
+		defer releaseClientRequest(client)
+		h.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,81 @@
+/*
+	This file supports draining in-flight HTTP requests on shutdown so active reads and
+	writes complete before storage is closed.
+*/
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// DefaultShutdownDrainSecs is the default seconds allowed for in-flight HTTP requests to
+// complete on shutdown.
+const DefaultShutdownDrainSecs = 30
+
+var (
+	// maximum time to wait for in-flight HTTP requests on shutdown; if not positive,
+	// connections are closed immediately.
+	shutdownDrainTimeout = DefaultShutdownDrainSecs * time.Second
+
+	// HTTP and HTTPS servers that should be drained on shutdown.
+	httpServers   []*http.Server
+	httpServersMu sync.Mutex
+
+	// number of HTTP requests currently being handled.
+	httpInFlight int64
+)
+
+// SetShutdownDrainTimeout sets the maximum time to wait for in-flight HTTP requests on
+// shutdown, where a non-positive duration closes connections immediately.
+func SetShutdownDrainTimeout(timeout time.Duration) {
+	shutdownDrainTimeout = timeout
+}
+
+// registerHTTPServer adds a server to those drained on shutdown.
+func registerHTTPServer(s *http.Server) {
+	httpServersMu.Lock()
+	httpServers = append(httpServers, s)
+	httpServersMu.Unlock()
+}
+
+// drainHTTP stops all registered servers from accepting new connections and waits up to
+// the timeout for in-flight requests to complete, after which remaining connections are
+// closed.
+func drainHTTP(timeout time.Duration) {
+	httpServersMu.Lock()
+	servers := httpServers
+	httpServers = nil
+	httpServersMu.Unlock()
+
+	inFlight := atomic.LoadInt64(&httpInFlight)
+	dvid.Infof("Draining %d in-flight HTTP requests with %s timeout...\n", inFlight, timeout)
+	if timeout < 0 {
+		timeout = 0
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	wg := new(sync.WaitGroup)
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s *http.Server) {
+			defer wg.Done()
+			if err := s.Shutdown(ctx); err != nil {
+				s.Close()
+			}
+		}(s)
+	}
+	wg.Wait()
+	remaining := atomic.LoadInt64(&httpInFlight)
+	if remaining > 0 {
+		dvid.Errorf("Drained %d HTTP requests but closed connections of %d still in flight\n", inFlight-remaining, remaining)
+	} else {
+		dvid.Infof("Drained %d in-flight HTTP requests\n", inFlight)
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDrainHTTP(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&httpInFlight, 1)
+		defer atomic.AddInt64(&httpInFlight, -1)
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &http.Server{Handler: handler}
+	registerHTTPServer(s)
+	go s.Serve(ln)
+
+	type result struct {
+		body string
+		err  error
+	}
+	resultCh := make(chan result)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/")
+		if err != nil {
+			resultCh <- result{err: err}
+			return
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resultCh <- result{string(body), err}
+	}()
+	<-started
+
+	drainHTTP(5 * time.Second)
+	if inFlight := atomic.LoadInt64(&httpInFlight); inFlight != 0 {
+		t.Errorf("expected no requests in flight after drain, got %d\n", inFlight)
+	}
+	res := <-resultCh
+	if res.err != nil || res.body != "done" {
+		t.Errorf("expected in-flight request to complete, got %q: %v\n", res.body, res.err)
+	}
+	if _, err := http.Get("http://" + ln.Addr().String() + "/"); err == nil {
+		t.Errorf("expected new connections to be refused after drain\n")
+	}
+}
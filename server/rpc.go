@@ -7,6 +7,7 @@
 package server
 
 import (
+	"encoding/hex"
 	"fmt"
 	"os"
 	"strconv"
@@ -67,6 +68,20 @@ DANGEROUS COMMANDS (only available via command line)
 		If "true", all versions are deleted for that class of keys, else if
 		"false" only the version corresponding to the given UUID is deleted.
 
+	repo <UUID> verify-versions <data name> <settings...>
+
+		Scans all keys of the given data instance and logs a report of keys whose
+		version is not in the repo DAG, e.g., after an incomplete branch deletion.
+		By default, nothing is modified.  Optional settings are "key=value" strings:
+
+		purge=true
+
+			Deletes all keys with orphaned versions.
+
+		passcode=<passcode>
+
+			The repo passcode, if any, which is required for purging.
+
 
 EXPERIMENTAL COMMANDS
 
@@ -95,6 +110,21 @@ EXPERIMENTAL COMMANDS
 			A transmit "flatten" will copy just the version specified and
 			flatten the key/values so there is no history.
 
+	repo <UUID> migrate-store <instance name> <new store config nickname> <settings...>
+
+		Copies all versions of a data instance from its current store to another store
+		given by its nickname in the TOML file, e.g., to move from leveldb to another
+		engine, then switches the instance to the new store if both stores hold the same
+		number of keys for the instance.  The instance is read-only during the migration.
+		Progress, including the last key copied, is logged.  Data is left in the old
+		store, and the TOML file must assign the instance to the new store before the
+		server is restarted.
+
+		resume=<hex key>
+
+			Only copies keys after the given key, e.g., the last key logged by an
+			interrupted migration.
+
 	repo <UUID> copy <source instance name> <clone instance name> <settings...>
     
         A local data instance copy with optional datatype-specific delimiter,
@@ -464,6 +494,32 @@ func handleCommand(cmd *datastore.Request) (reply *datastore.Response, err error
 			}()
 			reply.Text = fmt.Sprintf("Started migration of uuid %s data instance %q from old store %q...\n", uuid, source, oldStoreName)
 
+		case "migrate-store":
+			var source, newStoreName string
+			cmd.CommandArgs(3, &source, &newStoreName)
+			var store dvid.Store
+			store, err = storage.GetStoreByAlias(storage.Alias(newStoreName))
+			if err != nil {
+				return
+			}
+			var resume storage.Key
+			var resumeStr string
+			var found bool
+			if resumeStr, found, err = cmd.Settings().GetString("resume"); err != nil {
+				return
+			}
+			if found {
+				if resume, err = hex.DecodeString(resumeStr); err != nil {
+					return
+				}
+			}
+			go func() {
+				if err := datastore.SwitchInstanceStore(uuid, dvid.InstanceName(source), store, resume); err != nil {
+					dvid.Errorf("migrate-store error: %v\n", err)
+				}
+			}()
+			reply.Text = fmt.Sprintf("Started migration of uuid %s data instance %q to store %q...\n", uuid, source, newStoreName)
+
 		case "copy":
 			var source, target string
 			cmd.CommandArgs(3, &source, &target)
@@ -561,6 +617,32 @@ func handleCommand(cmd *datastore.Request) (reply *datastore.Response, err error
 			}()
 			reply.Text = fmt.Sprintf("Started deletion of type-specific key class %d for data instance %q, version %s (all versions = %t)\n", tkclass, dataname, uuid, allVersions)
 
+		case "verify-versions":
+			var dataname string
+			cmd.CommandArgs(3, &dataname)
+			config := cmd.Settings()
+			var purge bool
+			if purge, _, err = config.GetBool("purge"); err != nil {
+				return
+			}
+			var passcode string
+			if passcode, _, err = config.GetString("passcode"); err != nil {
+				return
+			}
+			if _, err = datastore.GetDataByUUIDName(uuid, dvid.InstanceName(dataname)); err != nil {
+				return
+			}
+			go func() {
+				report, err := datastore.VerifyVersions(uuid, dvid.InstanceName(dataname), purge, passcode)
+				if err != nil {
+					dvid.Errorf("verify-versions of data %q: %v\n", dataname, err)
+				}
+				if report != nil {
+					dvid.Infof("verify-versions: %s\n", report)
+				}
+			}()
+			reply.Text = fmt.Sprintf("Started version verification of data instance %q (purge = %t).  See log for report.\n", dataname, purge)
+
 		default:
 			err = fmt.Errorf("Unknown command: %q", cmd)
 			return
@@ -57,6 +57,9 @@ type Config interface {
 	// Set timing in HTTP header
 	AllowTiming() bool
 
+	// Add Server-Timing headers with request phase durations
+	ServerTiming() bool
+
 	// Kafka activity topic, empty if not configured
 	KafkaActivityTopic() string
 
@@ -69,10 +72,18 @@ func GetConfig() Config {
 	return config
 }
 
+// DefaultMaxListKeys is the default maximum number of keys returned by one key listing.
+const DefaultMaxListKeys = 1000000
+
 var (
 	// MaxDataRequest sets the limit on the amount of data that could be returned for a request
 	MaxDataRequest = int64(3) * dvid.Giga
 
+	// MaxListKeys is the maximum number of keys returned in one response of key listing
+	// endpoints, e.g., keyvalue "keys" and "keyrange", regardless of any limit given by
+	// the client.
+	MaxListKeys = DefaultMaxListKeys
+
 	// InteractiveOpsPer2Min gives the number of interactive-level requests
 	// received over the last 2 minutes.  This is useful for throttling "batch"
 	// operations on a single DVID server.  Note that this metric is an lower
@@ -239,12 +250,14 @@ func BlockOnInteractiveRequests(caller ...string) {
 func SetReadOnly(on bool) {
 	readonly = on
 	fullwrite = !on
+	datastore.SetReadOnly(readonly)
 }
 
 // SetFullWrite allows mutations on any version.
 func SetFullWrite(on bool) {
 	fullwrite = on
 	readonly = !on
+	datastore.SetReadOnly(readonly)
 }
 
 // AboutJSON returns a JSON string describing the properties of this server.
@@ -301,7 +314,9 @@ func About() string {
 	return text
 }
 
-// Shutdown handles graceful cleanup of server functions before exiting DVID.
+// Shutdown handles graceful cleanup of server functions before exiting DVID.  New HTTP
+// connections are refused while in-flight requests are given time to complete, after
+// which data instances, the kafka producer, and storage engines are shut down in turn.
 // This may not be so graceful if the chunk handler uses cgo since the interrupt
 // may be caught during cgo execution.
 func Shutdown() {
@@ -324,11 +339,12 @@ func Shutdown() {
 		}
 		time.Sleep(1 * time.Second)
 	}
-	dvid.Infof("Waiting 5 seconds for any HTTP requests to drain...\n")
-	time.Sleep(5 * time.Second)
+	drainHTTP(shutdownDrainTimeout)
 	datastore.Shutdown()
+	storage.ShutdownKafka()
 	dvid.BlockOnActiveCgo()
 	rpc.Shutdown()
+	storage.Shutdown()
 	dvid.Shutdown()
 	shutdownCh <- struct{}{}
 }
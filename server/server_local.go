@@ -17,7 +17,9 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/janelia-flyem/dvid/datastore"
 	"github.com/janelia-flyem/dvid/dvid"
@@ -126,6 +128,16 @@ func (c *tomlConfig) Initialize() error {
 	}
 
 	sc := c.Server
+	if sc.ReadOnly {
+		SetReadOnly(true)
+	}
+	if sc.ShutdownDrainSecs != 0 {
+		SetShutdownDrainTimeout(time.Duration(sc.ShutdownDrainSecs) * time.Second)
+	}
+	if sc.MaxListKeys > 0 {
+		MaxListKeys = sc.MaxListKeys
+	}
+	MaxConcurrentPerClient = sc.MaxConcurrentPerClient
 	if sc.StartWebhook == "" && sc.StartJaneliaConfig == "" {
 		return nil
 	}
@@ -270,6 +282,10 @@ func (c *tomlConfig) AllowTiming() bool {
 	return c.Server.AllowTiming
 }
 
+func (c *tomlConfig) ServerTiming() bool {
+	return c.Server.ServerTiming
+}
+
 func (c *tomlConfig) KafkaServers() []string {
 	if len(c.Kafka.Servers) != 0 {
 		return c.Kafka.Servers
@@ -345,6 +361,8 @@ type ServerConfig struct {
 	Note            string
 
 	AllowTiming        bool   // If true, returns * for Timing-Allow-Origin in response headers.
+	ServerTiming       bool   // If true, adds Server-Timing headers with request phase durations.
+	ReadOnly           bool   // If true, only GET and HEAD requests are accepted and all stores reject writes.
 	StartWebhook       string // http address that should be called when server is started up.
 	StartJaneliaConfig string // like StartWebhook, but with Janelia-specific behavior
 
@@ -354,6 +372,22 @@ type ServerConfig struct {
 	MutIDStart uint64 `toml:"min_mutation_id_start"`
 
 	InteractiveOpsBeforeBlock int // # of interactive ops in 2 min period before batch processing is blocked.  Zero value = no blocking.
+
+	TLS TLSConfig // If TLS.Address is set, HTTPS is served in addition to HTTP.
+
+	// ShutdownDrainSecs is the maximum seconds to wait for in-flight HTTP requests to
+	// complete on shutdown.  If zero, DefaultShutdownDrainSecs is used, and if negative,
+	// connections are closed immediately.
+	ShutdownDrainSecs int
+
+	// MaxListKeys is the maximum number of keys returned in one key listing response, e.g.,
+	// of keyvalue "keys" and "keyrange".  If not positive, DefaultMaxListKeys is used.
+	MaxListKeys int
+
+	// MaxConcurrentPerClient is the maximum number of requests from one authenticated
+	// user or, for unauthenticated requests, one IP address that are handled at once.
+	// Further requests get status 429.  If zero or negative, there is no limit.
+	MaxConcurrentPerClient int
 }
 
 // DatastoreConfig returns data instance configuration necessary to
@@ -375,6 +409,32 @@ type storeConfig map[string]interface{}
 type backendConfig struct {
 	Store storage.Alias
 	Log   storage.Alias
+
+	// Tiers maps type-specific key classes, given as decimal strings, to other stores.
+	Tiers map[string]storage.Alias
+
+	// Shards lists additional stores across which keys are distributed by consistent hash.
+	Shards []storage.Alias
+
+	// Fallback is an optional store, e.g., a read-only replica, used for reads that fail
+	// on the primary store.
+	Fallback storage.Alias
+}
+
+// TierMap returns the key class to store mapping for a backend.
+func (bc backendConfig) TierMap() (storage.TierMap, error) {
+	if len(bc.Tiers) == 0 {
+		return nil, nil
+	}
+	tiers := make(storage.TierMap, len(bc.Tiers))
+	for classStr, alias := range bc.Tiers {
+		class, err := strconv.ParseUint(strings.Trim(classStr, "\""), 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("bad key class %q in backend tiers: %v", classStr, err)
+		}
+		tiers[storage.TKeyClass(class)] = alias
+	}
+	return tiers, nil
 }
 
 type mirrorConfig struct {
@@ -418,6 +478,9 @@ func LoadConfig(filename string) (*tomlConfig, *storage.Backend, error) {
 	// Create the backend mapping.
 	backend.KVStore = make(storage.DataMap)
 	backend.LogStore = make(storage.DataMap)
+	backend.KVTiers = make(map[dvid.DataSpecifier]storage.TierMap)
+	backend.KVShards = make(map[dvid.DataSpecifier][]storage.Alias)
+	backend.KVFallback = make(storage.DataMap)
 	for k, v := range tc.Backend {
 		// lookup store config
 		_, found := backend.Stores[v.Store]
@@ -430,6 +493,32 @@ func LoadConfig(filename string) (*tomlConfig, *storage.Backend, error) {
 		if v.Log != "" {
 			backend.LogStore[spec] = v.Log
 		}
+		tiers, err := v.TierMap()
+		if err != nil {
+			return &tc, nil, fmt.Errorf("Backend for %q: %v", k, err)
+		}
+		for class, alias := range tiers {
+			if _, found := backend.Stores[alias]; !found {
+				return &tc, nil, fmt.Errorf("Backend for %q specifies unknown store %q for key class %d", k, alias, class)
+			}
+		}
+		if tiers != nil {
+			backend.KVTiers[spec] = tiers
+		}
+		for _, alias := range v.Shards {
+			if _, found := backend.Stores[alias]; !found {
+				return &tc, nil, fmt.Errorf("Backend for %q specifies unknown shard store %q", k, alias)
+			}
+		}
+		if len(v.Shards) != 0 {
+			backend.KVShards[spec] = v.Shards
+		}
+		if v.Fallback != "" {
+			if _, found := backend.Stores[v.Fallback]; !found {
+				return &tc, nil, fmt.Errorf("Backend for %q specifies unknown fallback store %q", k, v.Fallback)
+			}
+			backend.KVFallback[spec] = v.Fallback
+		}
 	}
 	defaultStore, found := backend.KVStore["default"]
 	if found {
@@ -479,8 +568,13 @@ func Serve() {
 	dvid.TimeInfof("Using web client files from %s\n", tc.Server.WebClient)
 	dvid.TimeInfof("Using %d of %d logical CPUs for DVID.\n", dvid.NumCPU, runtime.NumCPU())
 
-	// Launch the web server
+	// Launch the web servers
+	initRoutes()
 	go serveHTTP()
+	if tc.Server.TLS.IsAvailable() {
+		dvid.TimeInfof("Serving HTTPS on %s\n", tc.Server.TLS.Address)
+		go serveHTTPS(tc.Server.TLS)
+	}
 
 	// Launch the rpc server
 	go func() {
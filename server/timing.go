@@ -0,0 +1,53 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ServerTimingEnabled returns true if the server is configured to add Server-Timing
+// headers to responses.
+func ServerTimingEnabled() bool {
+	return config != nil && config.ServerTiming()
+}
+
+// ServerTiming records the durations of the phases of a request, e.g., storage reads
+// and deserialization, for a Server-Timing response header.  A nil *ServerTiming is
+// valid and records nothing, so handlers need not check whether timing is enabled.
+type ServerTiming struct {
+	start  time.Time
+	last   time.Time
+	phases []string
+}
+
+// NewServerTiming returns a ServerTiming starting now or nil if Server-Timing headers
+// are not enabled.
+func NewServerTiming() *ServerTiming {
+	if !ServerTimingEnabled() {
+		return nil
+	}
+	now := time.Now()
+	return &ServerTiming{start: now, last: now}
+}
+
+// Mark records the time since the previous mark, or the start, as the named phase.
+func (st *ServerTiming) Mark(name string) {
+	if st == nil {
+		return
+	}
+	now := time.Now()
+	st.phases = append(st.phases, fmt.Sprintf("%s;dur=%.3f", name, now.Sub(st.last).Seconds()*1000.0))
+	st.last = now
+}
+
+// SetHeader sets the Server-Timing header with the recorded phases and the total time
+// so far.  It must be called before the response body is written.
+func (st *ServerTiming) SetHeader(w http.ResponseWriter) {
+	if st == nil {
+		return
+	}
+	total := fmt.Sprintf("total;dur=%.3f", time.Since(st.start).Seconds()*1000.0)
+	w.Header().Set("Server-Timing", strings.Join(append(st.phases, total), ", "))
+}
@@ -0,0 +1,211 @@
+/*
+	This file supports serving HTTPS directly with certificates that are reloaded on change.
+*/
+
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// certCheckInterval is the minimum time between checks of certificate files for changes.
+const certCheckInterval = time.Minute
+
+// TLSConfig specifies HTTPS serving.  The plain HTTP server on the regular HTTP address
+// continues to be available with HTTP/1.1, e.g., for a local or trusted listener.
+type TLSConfig struct {
+	Address      string   // address for HTTPS, e.g., ":8443"
+	CertFile     string   // path to PEM-encoded certificate chain
+	KeyFile      string   // path to PEM-encoded private key
+	MinVersion   string   // minimum TLS version: "1.0", "1.1", "1.2" (default), or "1.3"
+	CipherSuites []string // optional cipher suite names, e.g., "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"
+
+	// DisableHTTP2, if true, serves HTTPS only with HTTP/1.1.  By default, clients can
+	// negotiate HTTP/2 and multiplex many requests over one connection.
+	DisableHTTP2 bool
+}
+
+// IsAvailable returns true if HTTPS should be served.
+func (c TLSConfig) IsAvailable() bool {
+	return c.Address != ""
+}
+
+// http2CipherSuites are the cipher suites of which HTTP/2 over TLS 1.2 requires at least one.
+var http2CipherSuites = map[uint16]bool{
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:   true,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256: true,
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// NewTLSConfig returns a crypto/tls configuration whose certificate is reloaded
+// whenever the certificate or key files change.
+func (c TLSConfig) NewTLSConfig() (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, fmt.Errorf("HTTPS requires both a certificate and key file")
+	}
+	reloader, err := newCertReloader(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if c.MinVersion != "" {
+		version, found := tlsVersions[c.MinVersion]
+		if !found {
+			return nil, fmt.Errorf("bad TLS minimum version %q, must be 1.0, 1.1, 1.2, or 1.3", c.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+	if len(c.CipherSuites) != 0 {
+		suites := make(map[string]uint16)
+		for _, suite := range tls.CipherSuites() {
+			suites[suite.Name] = suite.ID
+		}
+		for _, name := range c.CipherSuites {
+			id, found := suites[strings.TrimSpace(name)]
+			if !found {
+				return nil, fmt.Errorf("unknown or insecure TLS cipher suite %q", name)
+			}
+			tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+		}
+	}
+	if c.DisableHTTP2 {
+		tlsConfig.NextProtos = []string{"http/1.1"}
+		return tlsConfig, nil
+	}
+	if len(tlsConfig.CipherSuites) != 0 && tlsConfig.MinVersion < tls.VersionTLS13 {
+		var found bool
+		for _, id := range tlsConfig.CipherSuites {
+			if http2CipherSuites[id] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("HTTP/2 requires cipher suite TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 or TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256; add one or set DisableHTTP2")
+		}
+	}
+	tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	return tlsConfig, nil
+}
+
+// certReloader loads a certificate and reloads it if its files have been modified.
+type certReloader struct {
+	sync.Mutex
+	certFile, keyFile string
+	cert              *tls.Certificate
+	modTime           time.Time
+	lastCheck         time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, filename := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(filename)
+		if err != nil {
+			return latest, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load TLS certificate %q and key %q: %v", r.certFile, r.keyFile, err)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	r.lastCheck = time.Now()
+	return nil
+}
+
+// GetCertificate returns the current certificate, reloading it if its files have changed.
+// Errors on reload are logged and the previous certificate continues to be used.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.Lock()
+	defer r.Unlock()
+	if time.Since(r.lastCheck) < certCheckInterval {
+		return r.cert, nil
+	}
+	r.lastCheck = time.Now()
+	modTime, err := r.latestModTime()
+	if err != nil {
+		dvid.Errorf("unable to check TLS certificate files for changes: %v\n", err)
+		return r.cert, nil
+	}
+	if modTime.After(r.modTime) {
+		if err := r.load(modTime); err != nil {
+			dvid.Errorf("%v\n", err)
+		} else {
+			dvid.Infof("Reloaded TLS certificate %q\n", r.certFile)
+		}
+	}
+	return r.cert, nil
+}
+
+// newHTTPSServer returns a server for the handler over TLS that supports HTTP/2 unless
+// it is disabled.  Handlers work unchanged under HTTP/2, where each request is a stream.
+func newHTTPSServer(c TLSConfig, handler http.Handler) (*http.Server, error) {
+	tlsConfig, err := c.NewTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	s := &http.Server{
+		Addr:         c.Address,
+		Handler:      handler,
+		TLSConfig:    tlsConfig,
+		WriteTimeout: WriteTimeout,
+		ReadTimeout:  ReadTimeout,
+	}
+	if c.DisableHTTP2 {
+		// a non-nil, empty map keeps net/http from configuring HTTP/2.
+		s.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+	return s, nil
+}
+
+// serveHTTPS serves the same routes as the HTTP server over TLS.  Routes must already be set up.
+func serveHTTPS(c TLSConfig) {
+	s, err := newHTTPSServer(c, webMux)
+	if err != nil {
+		dvid.Criticalf("Could not start HTTPS server: %v\n", err)
+		return
+	}
+	registerHTTPServer(s)
+	dvid.Infof("Web server listening for HTTPS at %s (HTTP/2 disabled: %t) ...\n", c.Address, c.DisableHTTP2)
+	if err := s.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
+		dvid.Criticalf("HTTPS server error: %v\n", err)
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate and key with the given common name.
+func writeTestCert(t *testing.T, certFile, keyFile, name string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dvid-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "first")
+
+	c := TLSConfig{Address: ":0", CertFile: certFile, KeyFile: keyFile, MinVersion: "1.3"}
+	tlsConfig, err := c.NewTLSConfig()
+	if err != nil {
+		t.Fatalf("unable to create TLS config: %v\n", err)
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS13 {
+		t.Errorf("expected min version TLS 1.3, got %x\n", tlsConfig.MinVersion)
+	}
+
+	c.MinVersion = "2.0"
+	if _, err := c.NewTLSConfig(); err == nil {
+		t.Errorf("expected error on bad TLS min version\n")
+	}
+	c.MinVersion = ""
+	c.CipherSuites = []string{"TLS_NOT_A_CIPHER"}
+	if _, err := c.NewTLSConfig(); err == nil {
+		t.Errorf("expected error on unknown cipher suite\n")
+	}
+
+	// Rotate the certificate and make sure it's reloaded.
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestCert(t, certFile, keyFile, "second")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	reloader.lastCheck = time.Time{}
+	cert, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.Subject.CommonName != "second" {
+		t.Errorf("expected reloaded certificate, got %q\n", leaf.Subject.CommonName)
+	}
+}
+
+func TestHTTPSServerHTTP2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dvid-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "localhost")
+
+	c := TLSConfig{CertFile: certFile, KeyFile: keyFile, CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}}
+	if _, err := c.NewTLSConfig(); err == nil {
+		t.Errorf("expected error when cipher suites exclude those required by HTTP/2\n")
+	}
+	c.DisableHTTP2 = true
+	if _, err := c.NewTLSConfig(); err != nil {
+		t.Errorf("expected cipher suites allowed with HTTP/2 disabled: %v\n", err)
+	}
+	c.CipherSuites = nil
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	})
+	for _, disabled := range []bool{false, true} {
+		c.DisableHTTP2 = disabled
+		s, err := newHTTPSServer(c, handler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go s.ServeTLS(ln, "", "")
+
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			ForceAttemptHTTP2: true,
+		}}
+		resp, err := client.Get("https://" + ln.Addr().String() + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		proto, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "HTTP/2.0"
+		if disabled {
+			expected = "HTTP/1.1"
+		}
+		if string(proto) != expected || resp.Proto != expected {
+			t.Errorf("with HTTP/2 disabled %t, expected %s, got %s served and %s received\n", disabled, expected, proto, resp.Proto)
+		}
+		s.Close()
+	}
+}
@@ -7,6 +7,8 @@ package server
 
 import (
 	"bytes"
+	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -19,8 +21,10 @@ import (
 	"runtime"
 	"runtime/debug"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/janelia-flyem/dvid/datastore"
@@ -125,6 +129,24 @@ const webHelp = `
  	Returns JSON for groupcache statistics for this server.  See github.com/golang/groupcache package
 	Stats and CacheStats for MainCache and HotCache.
 
+ GET  /api/server/pool-stats
+
+	Returns JSON of connection pool statistics keyed by network-backed store.  For each store,
+	the number of requests, dialed connections, requests reusing pooled connections, currently
+	open connections, and recycles of idle connections due to the store's "pool_max_lifetime".
+
+ GET  /api/server/kafka-backlog[?format=prometheus]
+
+	Returns JSON of the failed kafka messages stored in the default log store awaiting replay,
+	keyed by kafka topic.  For each topic, the number of messages and the bytes of their data.
+	A growing backlog indicates a persistent problem producing to kafka.  Requires a default
+	log store that can count its topics, e.g., filelog.
+
+	Query-string Options:
+
+	format        If "prometheus", the backlog is returned as "dvid_kafka_failed_messages" and
+	                "dvid_kafka_failed_bytes" gauges in the Prometheus text format.
+
 POST  /api/server/settings
 
 	Sets server parameters.  Expects JSON to be posted with optional keys denoting parameters:
@@ -198,6 +220,25 @@ Repo-Level REST endpoints
 	Returns JSON for just the repository with given root UUID.  The UUID string can be
 	shortened as long as it is uniquely identifiable across the managed repositories.
 
+ GET  /api/repo/{uuid}/instances
+
+	Returns a JSON list of the data instances in the repository with given UUID, sorted
+	by name.  Each instance is described by its name, type, type version, data UUID, and
+	basic configuration:
+
+	[
+		{
+			"Name": "stuff",
+			"TypeName": "keyvalue",
+			"TypeVersion": "0.2",
+			"DataUUID": "8f2e...",
+			"Versioned": true,
+			"Compression": "LZ4 compression, level 3",
+			"Tags": {}
+		},
+		...
+	]
+
  POST /api/repo/{uuid}/instance
 
 	Creates a new instance of the given data type.  Expects configuration data in JSON
@@ -214,6 +255,35 @@ Repo-Level REST endpoints
 							(Applies to most instance types, but not all.)
 							Choices are: “none”, “snappy”, “lz4”, “gzip”, “jpeg”.
 							Where applicable, the compression level can be appended, e.g. "jpeg:80".
+	OPTIONAL "ReadOnly"     If "true" or "1", all writes to the instance's stores are rejected and
+							mutation requests return status code 403.  This is reflected in the
+							instance's info.
+	OPTIONAL "Quota"        Maximum # of bytes (keys and values) that can be written to the instance.
+							Writes beyond the quota are rejected and return status code 507.
+							Bytes written are tracked even across deletes and overwrites.
+							Internal bookkeeping, e.g., access times and tombstones, isn't charged.
+	OPTIONAL "AllowOps"     Comma-separated list of the only HTTP operations allowed on the instance,
+							each given as <method>:<endpoint>, e.g., "GET:*,POST:key", where "*"
+							matches any method or endpoint.  Other requests return status code
+							403.  By default all operations are allowed.
+	OPTIONAL "DenyOps"      Comma-separated list of HTTP operations, in the same format as AllowOps,
+							that return status code 403, e.g., "DELETE:*,GET:keyrangevalues" to
+							forbid deletes and expensive range scans.
+	OPTIONAL "Codec"        Name of a registered codec that encodes values before compression,
+							e.g., a domain-specific mesh encoding.  The codec is stored with each
+							value so reads decode correctly.  (Applies to keyvalue instances.)
+	OPTIONAL "StoreAlias"   Store backing the instance instead of the store assigned in the
+							configuration: "metadata", "default", or the alias of a store in the
+							configuration's [store] section.  Small-value instances, e.g., indices,
+							can be placed on the metadata store this way.  The store is used as is,
+							without configured tiers, shards, fallback, or caching, and must support
+							the interfaces required by the instance's type.  It can only be set at
+							creation and is shown as "StoreAlias" in the instance's info.
+	OPTIONAL "ChecksumMinSize"  Values smaller than this # of bytes are stored without a checksum,
+							while larger ones use the "Checksum" setting.  Whether a value has a
+							checksum is recorded with it, so reads only verify values stored with
+							one.  By default, all values use the "Checksum" setting.  (Applies to
+							keyvalue instances.)
 	OPTIONAL "Tags"         Can send list of tags as a series of equal statements separated by
 							commas, e.g., "type=meshes,stuff=something-something".  This will
 							create a tag "type" set to "meshes" and a tag "stuff" set to 
@@ -229,6 +299,104 @@ Repo-Level REST endpoints
 	}
 					  	  
 
+ POST /api/repo/{uuid}/batch[?u=<user>]
+
+	Applies puts and deletes of keys across data instances at version {uuid} in one request,
+	e.g., to update related keyvalue instances without a round trip for each.  Expects JSON
+	with up to 10,000 operations, where values are base64-encoded:
+
+	{
+		"Atomic": false,
+		"Operations": [
+			{ "Instance": "meshes", "Op": "put", "Key": "1234", "Value": "bWVzaA==" },
+			{ "Instance": "meshinfo", "Op": "delete", "Key": "1234" }
+		]
+	}
+
+	Operations are grouped by instance.  Each instance's operations are applied in order
+	as a single transaction, and the instances are applied concurrently, so without
+	"Atomic" the batch is best-effort: one instance's operations can fail, e.g., because
+	its writes are paused or an operation is denied by its policy, while others are
+	applied.  If "Atomic" is true, all operations are committed together or none are,
+	which requires that all instances use the same store and, for more than one instance,
+	that the store supports atomic batches across instances (currently basholeveldb).
+	Only data types supporting batches, e.g., keyvalue, can be targeted.  Operations are
+	written like the instance's own writes, so its pending write limit, quota, and audit
+	log apply, with the optional "u" query string naming the user for audit records.
+
+	Returns the result of each operation in request order along with totals:
+
+	{
+		"Atomic": false,
+		"Applied": 1,
+		"Failed": 1,
+		"Results": [
+			{ "Instance": "meshes", "Op": "put", "Key": "1234", "Applied": true },
+			{ "Instance": "meshinfo", "Op": "delete", "Key": "1234", "Applied": false,
+			  "Error": "writes to data \"meshinfo\" are paused for maintenance" }
+		]
+	}
+
+ POST /api/repo/{uuid}/instance/{name}/clone?to={new name}
+
+	Creates a new data instance with the given new name and the properties of the named
+	instance, then copies all key-value pairs of the named instance as seen from the
+	version {uuid} into the new instance.  The clone has no history and its data is stored
+	at version {uuid}.  The new instance is created before the response is returned, but
+	the copying is done in the background with progress and completion written to the log.
+
+ POST /api/repo/{uuid}/instance/{name}/rebuild-counters
+
+	Maintenance endpoint that scans all key-value pairs of the named instance across all
+	versions and rewrites its incrementally maintained key count, e.g., if it drifted due
+	to a crash.  The key count supports the "MaxKeys" setting of keyvalue instances and is
+	the sum over versions of keys each version added less keys it deleted relative to its
+	ancestors.  "Bytes" is the usage of the "Quota" setting of any instance, which counts
+	bytes written including those later deleted or overwritten, so it can't be recovered
+	by a scan and is left unchanged.  "StoredBytes" is the size of keys and values
+	currently stored across versions.  Since writes during the scan may not be counted,
+	this should be run while the instance is idle.  Returns the values before and after
+	the rebuild:
+
+	{
+		"Before": { "Keys": 1021, "Bytes": 2098176 },
+		"After": { "Keys": 1000, "Bytes": 2098176 },
+		"StoredBytes": 2048000
+	}
+
+ POST /api/repo/{uuid}/instance/{name}/flatten?imsure=true
+
+	Maintenance endpoint that collapses the version history of the named instance into
+	version {uuid} to reclaim space used by superseded values.  Every key-value pair seen
+	from version {uuid} is stored at that version, then all key-value pairs of its ancestors
+	are deleted.  Version {uuid} and its descendants read the same data as before, while
+	ancestor versions no longer have any data for the instance.  The flatten is refused if
+	the repo has a version that is neither an ancestor nor a descendant of {uuid}, since
+	that branch would lose the data it inherits.  Since ancestor data is permanently
+	deleted, the "imsure=true" query string is required.  Since writes during the flatten
+	may be lost, this should be run while the instance is idle, and it's refused with status
+	code 503 while the instance's writes are paused.  Returns the number of key-value pairs
+	copied and deleted and the net bytes reclaimed:
+
+	{ "Copied": 120, "Deleted": 4051, "BytesReclaimed": 8388608 }
+
+  GET /api/repo/{uuid}/instance/{name}/rawrange[?after={hex key}&keysonly=true]
+
+	Streams all stored key-value pairs of the named instance across all versions in full
+	key order, so another DVID server can replicate the instance.  Each full key and value
+	is preceded by its length in bytes as a little-endian uint32:
+
+	<key1 length><key1 bytes><value1 length><value1 bytes><key2 length>...
+
+	Full keys include this server's instance ID and local version IDs, so a receiver must
+	map them to its own IDs.  The "X-Key-Count" trailer gives the number of pairs sent.
+
+	Query-string Options:
+
+	after         Hexadecimal full key; the stream begins with the first key past it, so
+	                an interrupted stream can be resumed from the last key received.
+	keysonly      If "true", only keys are sent, each with its length prefix.
+
   GET /api/repo/{uuid}/log
  POST /api/repo/{uuid}/log
 
@@ -446,6 +614,24 @@ Node-Level REST endpoints
 
 	Note that POST /blobstore will not be logged in any associated kafka system.
 
+ GET /api/node/{uuid}/{data name}/quota
+
+	Returns JSON with the write quota in bytes for the data instance, where zero means
+	unlimited, and the bytes written against the quota:
+
+	{ "Quota": 1000000000, "Used": 2048 }
+
+ POST /api/node/{uuid}/{data name}/pause
+ POST /api/node/{uuid}/{data name}/resume
+
+	Pauses or resumes writes to the data instance, e.g., to quiesce it for a consistent
+	backup without taking down the server.  While paused, requests that would mutate the
+	instance return status code 503 with a "Retry-After" header, while reads continue
+	normally.  The pause state is shown as "Paused" in the instance info, is kept in memory,
+	and is cleared if the server restarts.  Returns JSON with the new state:
+
+	{ "Paused": true }
+
 		</pre>
 
 		<h4>Data type commands</h4>
@@ -506,6 +692,7 @@ var (
 func init() {
 	webMux.Mux = web.New()
 	webMux.Use(middleware.RequestID)
+	webMux.Use(traceHandler)
 }
 
 // ThrottledHTTP checks if a request can continue under throttling.  If so, it returns
@@ -574,8 +761,11 @@ func serveHTTP() {
 		WriteTimeout: WriteTimeout,
 		ReadTimeout:  ReadTimeout,
 	}
+	registerHTTPServer(s)
 	httpAvail = true
-	log.Fatal(s.ListenAndServe())
+	if err := s.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
 
 	// graceful.HandleSignals()
 	// if err := graceful.ListenAndServe(address, http.DefaultServeMux); err != nil {
@@ -603,6 +793,7 @@ func initRoutes() {
 	mainMux.Use(httpAvailHandler)
 	mainMux.Use(recoverHandler)
 	mainMux.Use(corsHandler)
+	mainMux.Use(concurrencyHandler)
 
 	// Handle RAML interface
 	mainMux.Get("/interface", interfaceHandler)
@@ -624,6 +815,10 @@ func initRoutes() {
 	mainMux.Get("/api/server/compiled-types/", serverCompiledTypesHandler)
 	mainMux.Get("/api/server/groupcache", serverGroupcacheHandler)
 	mainMux.Get("/api/server/groupcache/", serverGroupcacheHandler)
+	mainMux.Get("/api/server/pool-stats", serverPoolStatsHandler)
+	mainMux.Get("/api/server/pool-stats/", serverPoolStatsHandler)
+	mainMux.Get("/api/server/kafka-backlog", serverKafkaBacklogHandler)
+	mainMux.Get("/api/server/kafka-backlog/", serverKafkaBacklogHandler)
 	mainMux.Post("/api/server/settings", serverSettingsHandler)
 	mainMux.Post("/api/server/reload-metadata", serverReload)
 	mainMux.Post("/api/server/reload-metadata/", serverReload)
@@ -642,11 +837,19 @@ func initRoutes() {
 	mainMux.Handle("/api/repo/:uuid/:action", repoMux)
 	repoMux.Use(repoSelector)
 	repoMux.Get("/api/repo/:uuid/info", repoInfoHandler)
+	repoMux.Get("/api/repo/:uuid/instances", repoInstancesHandler)
 	repoMux.Post("/api/repo/:uuid/instance", repoNewDataHandler)
 	repoMux.Get("/api/repo/:uuid/log", getRepoLogHandler)
 	repoMux.Post("/api/repo/:uuid/log", postRepoLogHandler)
 	repoMux.Post("/api/repo/:uuid/merge", repoMergeHandler)
 	repoMux.Post("/api/repo/:uuid/resolve", repoResolveHandler)
+	repoMux.Post("/api/repo/:uuid/batch", repoBatchHandler)
+
+	mainMux.Handle("/api/repo/:uuid/instance/:dataname/:action", repoMux)
+	repoMux.Post("/api/repo/:uuid/instance/:dataname/clone", repoCloneDataHandler)
+	repoMux.Post("/api/repo/:uuid/instance/:dataname/rebuild-counters", repoRebuildCountersHandler)
+	repoMux.Post("/api/repo/:uuid/instance/:dataname/flatten", repoFlattenDataHandler)
+	repoMux.Get("/api/repo/:uuid/instance/:dataname/rawrange", repoRawRangeHandler)
 
 	nodeMux := web.New()
 	mainMux.Handle("/api/node/:uuid", nodeMux)
@@ -714,18 +917,34 @@ func wrapResponseWriter(w http.ResponseWriter) *wrappedResponseWriter {
 	return &wr
 }
 
+type activityLoggedKey struct{}
+
+// MarkActivityLogged records that the handler of a request logs its own structured
+// activity event, so the request's generic activity message isn't also sent.
+func MarkActivityLogged(r *http.Request) {
+	if logged, ok := r.Context().Value(activityLoggedKey{}).(*int32); ok {
+		atomic.StoreInt32(logged, 1)
+	}
+}
+
 // Middleware that prevents any web requests if httpAvail is false, and logs activity
-// to kafka if available.  Allows draconian shutdown of server when doing critical reorg
-// of internals.
+// to kafka if available and the handler didn't log its own activity event.  Allows
+// draconian shutdown of server when doing critical reorg of internals.
 func httpAvailHandler(c *web.C, h http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		if httpUnavailable(w) {
 			return
 		}
+		atomic.AddInt64(&httpInFlight, 1)
+		defer atomic.AddInt64(&httpInFlight, -1)
 		t0 := time.Now()
 		myw := wrapResponseWriter(w)
-		h.ServeHTTP(myw, r)
-		if KafkaAvailable() {
+		logged := new(int32)
+		h.ServeHTTP(myw, r.WithContext(context.WithValue(r.Context(), activityLoggedKey{}, logged)))
+		if atomic.LoadInt32(logged) == 1 {
+			return
+		}
+		if KafkaAvailable() && storage.ActivitySampled(r.Method) {
 			user := r.URL.Query().Get("u")
 			app := r.URL.Query().Get("app")
 			t := time.Since(t0)
@@ -740,6 +959,10 @@ func httpAvailHandler(c *web.C, h http.Handler) http.Handler {
 				"bytes_in":    r.ContentLength,
 				"bytes_out":   myw.bytes,
 				"remote_addr": r.RemoteAddr,
+				"trace_id":    middleware.GetReqID(*c),
+			}
+			if rate := storage.ActivitySampleRate(r.Method); rate > 1 {
+				activity["sample_rate"] = rate
 			}
 			storage.LogActivityToKafka(activity)
 		}
@@ -790,6 +1013,16 @@ func BadAPIRequest(w http.ResponseWriter, r *http.Request, d dvid.Data) {
 
 // BadRequest writes an error message out to the http.ResponseWriter using format similar to fmt.Printf.
 func BadRequest(w http.ResponseWriter, r *http.Request, format interface{}, args ...interface{}) {
+	errorResponse(w, r, http.StatusBadRequest, format, args...)
+}
+
+// InsufficientStorage is like BadRequest but with status code 507, for writes rejected
+// because they would exceed a write quota or key limit.
+func InsufficientStorage(w http.ResponseWriter, r *http.Request, format interface{}, args ...interface{}) {
+	errorResponse(w, r, http.StatusInsufficientStorage, format, args...)
+}
+
+func errorResponse(w http.ResponseWriter, r *http.Request, status int, format interface{}, args ...interface{}) {
 	var message string
 	switch v := format.(type) {
 	case string:
@@ -807,7 +1040,7 @@ func BadRequest(w http.ResponseWriter, r *http.Request, format interface{}, args
 	}
 	errorMsg := fmt.Sprintf("%s (%s).", message, r.URL.Path)
 	dvid.Errorf(errorMsg + "\n")
-	http.Error(w, errorMsg, http.StatusBadRequest)
+	http.Error(w, errorMsg, status)
 }
 
 // DecodeJSON decodes JSON passed in a request into a dvid.Config.
@@ -821,6 +1054,40 @@ func DecodeJSON(r *http.Request) (dvid.Config, error) {
 
 // ---- Middleware -------------
 
+// maxTraceIDLength is the longest client-supplied trace ID that is accepted.
+const maxTraceIDLength = 128
+
+// traceIDFromRequest returns the trace ID supplied by the client in either a X-Request-ID
+// header or the trace-id field of a W3C traceparent header, or the empty string if none.
+func traceIDFromRequest(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); id != "" && len(id) <= maxTraceIDLength {
+		return id
+	}
+	// traceparent is "{version}-{trace-id}-{parent-id}-{flags}" with 32 hex digit trace-id.
+	fields := strings.Split(r.Header.Get("traceparent"), "-")
+	if len(fields) < 4 || len(fields[1]) != 32 || fields[1] == strings.Repeat("0", 32) {
+		return ""
+	}
+	if _, err := hex.DecodeString(fields[1]); err != nil {
+		return ""
+	}
+	return fields[1]
+}
+
+// traceHandler replaces the generated request ID with any trace ID supplied by the client,
+// so the ID propagated to request contexts, logs, and activity messages ties DVID operations
+// to upstream requests.  The ID is echoed in the X-Request-ID response header.
+func traceHandler(c *web.C, h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if id := traceIDFromRequest(r); id != "" {
+			c.Env[middleware.RequestIDKey] = id
+		}
+		w.Header().Set("X-Request-ID", middleware.GetReqID(*c))
+		h.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
 // corsHandler adds CORS support via header
 func corsHandler(c *web.C, h http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
@@ -902,6 +1169,16 @@ func repoSelector(c *web.C, h http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// PausedRetryAfter is the number of seconds clients are told to wait before retrying
+// writes to data whose writes are paused.
+const PausedRetryAfter = 10
+
+// pausable is implemented by data whose HTTP writes can be temporarily paused.
+type pausable interface {
+	IsPaused() bool
+	SetPaused(bool)
+}
+
 // instanceSelector retrieves the data instance given its complete string name and
 // forwards the request to that instance's HTTP handler.
 func instanceSelector(c *web.C, h http.Handler) http.Handler {
@@ -921,6 +1198,13 @@ func instanceSelector(c *web.C, h http.Handler) http.Handler {
 		}
 		method := strings.ToLower(r.Method)
 
+		if op, ok := data.(interface {
+			OperationAllowed(method, endpoint string) bool
+		}); ok && !op.OperationAllowed(r.Method, c.URLParams["keyword"]) {
+			http.Error(w, fmt.Sprintf("Data %q does not allow %s on endpoint %q", dataname, r.Method, c.URLParams["keyword"]), http.StatusForbidden)
+			return
+		}
+
 		// handle all blobstore requests
 		if c.URLParams["keyword"] == "blobstore" {
 			switch method {
@@ -967,6 +1251,58 @@ func instanceSelector(c *web.C, h http.Handler) http.Handler {
 			return
 		}
 
+		// handle quota usage requests
+		if c.URLParams["keyword"] == "quota" {
+			if method != "get" {
+				BadRequest(w, r, "can only do GET action on quota endpoint")
+				return
+			}
+			quota, used, err := datastore.GetQuotaUsage(data)
+			if err != nil {
+				BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"Quota": %d, "Used": %d}`, quota, used)
+			return
+		}
+
+		// handle pausing and resuming of writes
+		if keyword := c.URLParams["keyword"]; keyword == "pause" || keyword == "resume" {
+			if method != "post" {
+				BadRequest(w, r, "can only do POST action on %s endpoint", keyword)
+				return
+			}
+			pauser, ok := data.(pausable)
+			if !ok {
+				BadRequest(w, r, "data %q does not support pausing writes", dataname)
+				return
+			}
+			pauser.SetPaused(keyword == "pause")
+			dvid.Infof("Writes to data %q set to paused = %t\n", dataname, pauser.IsPaused())
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"Paused": %t}`, pauser.IsPaused())
+			return
+		}
+		// the path after the endpoint keyword lets data types treat some POSTs as reads.
+		var subpath string
+		if parts := strings.SplitN(strings.Trim(r.URL.Path[len(WebAPIPath):], "/"), "/", 5); len(parts) == 5 {
+			subpath = strings.Trim(parts[4], "/")
+		}
+		isMutation := datastore.IsMutation(data, r.Method, c.URLParams["keyword"], subpath)
+		if pauser, ok := data.(pausable); ok && pauser.IsPaused() && isMutation {
+			w.Header().Set("Retry-After", strconv.Itoa(PausedRetryAfter))
+			http.Error(w, fmt.Sprintf("Writes to data %q are paused for maintenance", dataname), http.StatusServiceUnavailable)
+			return
+		}
+
+		if ro, ok := data.(interface {
+			IsReadOnly() bool
+		}); ok && ro.IsReadOnly() && isMutation {
+			http.Error(w, fmt.Sprintf("Data %q is read-only and cannot accept %s on endpoint %q", dataname, r.Method, c.URLParams["keyword"]), http.StatusForbidden)
+			return
+		}
+
 		v, err := datastore.VersionFromUUID(uuid)
 		if err != nil {
 			BadRequest(w, r, err)
@@ -979,7 +1315,7 @@ func instanceSelector(c *web.C, h http.Handler) http.Handler {
 				BadRequest(w, r, err)
 				return
 			}
-			if !fullwrite && locked && data.IsMutationRequest(r.Method, c.URLParams["keyword"]) {
+			if !fullwrite && locked && isMutation {
 				BadRequest(w, r, "Cannot do %s on endpoint %q of locked node %s", r.Method, c.URLParams["keyword"], uuid)
 				return
 			}
@@ -1233,6 +1569,39 @@ func serverGroupcacheHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, string(m))
 }
 
+func serverPoolStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := storage.GetPoolStats()
+	m, err := json.Marshal(stats)
+	if err != nil {
+		BadRequest(w, r, fmt.Sprintf("Cannot marshal JSON connection pool stats: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, string(m))
+}
+
+func serverKafkaBacklogHandler(w http.ResponseWriter, r *http.Request) {
+	backlog, err := storage.GetKafkaBacklog()
+	if err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	if r.URL.Query().Get("format") == "prometheus" {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := backlog.WritePrometheus(w); err != nil {
+			BadRequest(w, r, err)
+		}
+		return
+	}
+	m, err := json.Marshal(backlog)
+	if err != nil {
+		BadRequest(w, r, fmt.Sprintf("Cannot marshal JSON kafka backlog: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(m))
+}
+
 func serverSettingsHandler(c web.C, w http.ResponseWriter, r *http.Request) {
 	config := dvid.NewConfig()
 	if err := config.SetByJSON(r.Body); err != nil {
@@ -1363,6 +1732,170 @@ func repoInfoHandler(c web.C, w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, jsonStr)
 }
 
+// instanceSummary is the per-instance description returned by the repo instances endpoint.
+type instanceSummary struct {
+	Name        dvid.InstanceName
+	TypeName    dvid.TypeString
+	TypeVersion string
+	DataUUID    dvid.UUID
+	Versioned   bool
+	Compression string `json:",omitempty"`
+	Tags        map[string]string
+}
+
+func repoInstancesHandler(c web.C, w http.ResponseWriter, r *http.Request) {
+	uuid := (c.Env["uuid"]).(dvid.UUID)
+	instances, err := datastore.GetDataInstances(uuid)
+	if err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	summaries := make([]instanceSummary, len(instances))
+	for i, d := range instances {
+		summaries[i] = instanceSummary{
+			Name:        d.DataName(),
+			TypeName:    d.TypeName(),
+			TypeVersion: d.TypeVersion(),
+			DataUUID:    d.DataUUID(),
+			Versioned:   d.Versioned(),
+			Tags:        d.Tags(),
+		}
+		if compressor, ok := d.(interface {
+			Compression() dvid.Compression
+		}); ok {
+			summaries[i].Compression = compressor.Compression().String()
+		}
+	}
+	jsonBytes, err := json.Marshal(summaries)
+	if err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonBytes)
+}
+
+func repoCloneDataHandler(c web.C, w http.ResponseWriter, r *http.Request) {
+	if err := datastore.MetadataUniversalLock(); err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	defer datastore.MetadataUniversalUnlock()
+
+	uuid := c.Env["uuid"].(dvid.UUID)
+	locked, err := datastore.LockedUUID(uuid)
+	if err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	if !fullwrite && locked {
+		BadRequest(w, r, "Cloned data instance cannot be created on locked node %s", uuid)
+		return
+	}
+
+	source := dvid.InstanceName(c.URLParams["dataname"])
+	target := dvid.InstanceName(r.URL.Query().Get("to"))
+	if target == "" {
+		BadRequest(w, r, "clone of data %q requires a 'to' query string with the new instance name", source)
+		return
+	}
+	if err := datastore.CloneInstance(uuid, source, target); err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{%q: "Started clone of %s to %s at node %s"}`, "result", source, target, uuid)
+}
+
+func repoRebuildCountersHandler(c web.C, w http.ResponseWriter, r *http.Request) {
+	uuid := c.Env["uuid"].(dvid.UUID)
+	dataname := dvid.InstanceName(c.URLParams["dataname"])
+	data, err := datastore.GetDataByUUIDName(uuid, dataname)
+	if err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	rebuild, err := datastore.RebuildCounters(data)
+	if err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	jsonBytes, err := json.Marshal(rebuild)
+	if err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	dvid.Infof("Rebuilt counters of data %q: keys %d -> %d, %d bytes stored\n", dataname,
+		rebuild.Before.Keys, rebuild.After.Keys, rebuild.StoredBytes)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonBytes))
+}
+
+func repoFlattenDataHandler(c web.C, w http.ResponseWriter, r *http.Request) {
+	uuid := c.Env["uuid"].(dvid.UUID)
+	dataname := dvid.InstanceName(c.URLParams["dataname"])
+	data, err := datastore.GetDataByUUIDName(uuid, dataname)
+	if err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	if r.URL.Query().Get("imsure") != "true" {
+		BadRequest(w, r, "flatten permanently deletes ancestor data of %q and requires 'imsure=true'", dataname)
+		return
+	}
+	if pauser, ok := data.(pausable); ok && pauser.IsPaused() {
+		w.Header().Set("Retry-After", strconv.Itoa(PausedRetryAfter))
+		http.Error(w, fmt.Sprintf("Writes to data %q are paused for maintenance", dataname), http.StatusServiceUnavailable)
+		return
+	}
+	stats, err := datastore.FlattenInstance(uuid, data)
+	if err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	jsonBytes, err := json.Marshal(stats)
+	if err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	dvid.Infof("Flattened data %q at node %s: copied %d, deleted %d key-value pairs, reclaimed %d bytes\n",
+		dataname, uuid, stats.Copied, stats.Deleted, stats.BytesReclaimed)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonBytes))
+}
+
+func repoRawRangeHandler(c web.C, w http.ResponseWriter, r *http.Request) {
+	uuid := c.Env["uuid"].(dvid.UUID)
+	dataname := dvid.InstanceName(c.URLParams["dataname"])
+	data, err := datastore.GetDataByUUIDName(uuid, dataname)
+	if err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	var after storage.Key
+	if afterStr := r.URL.Query().Get("after"); afterStr != "" {
+		if after, err = hex.DecodeString(afterStr); err != nil {
+			BadRequest(w, r, "bad 'after' key %q: %v", afterStr, err)
+			return
+		}
+	}
+	keysOnly := r.URL.Query().Get("keysonly") == "true"
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Trailer", "X-Key-Count")
+	n, err := datastore.WriteRawRange(w, data, after, keysOnly)
+	if err != nil && n == 0 {
+		BadRequest(w, r, err)
+		return
+	}
+	if err != nil {
+		// headers have been sent, so the truncated stream is only logged.
+		dvid.Errorf("raw range of data %q after %x: %v\n", dataname, after, err)
+		return
+	}
+	w.Header().Set("X-Key-Count", strconv.Itoa(n))
+	dvid.Infof("Streamed %d raw key-value pairs of data %q\n", n, dataname)
+}
+
 func repoNewDataHandler(c web.C, w http.ResponseWriter, r *http.Request) {
 	// Apply a global lock (if relevant) and reloads meta
 	if err := datastore.MetadataUniversalLock(); err != nil {
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"regexp"
 	"sync"
 	"testing"
@@ -12,6 +14,8 @@ import (
 
 	"github.com/janelia-flyem/dvid/datastore"
 	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+	"github.com/zenazn/goji/web"
 )
 
 func testLog(t *testing.T, got, expect string) {
@@ -192,6 +196,81 @@ func TestLog(t *testing.T) {
 	testLog(t, data[4], "line5")
 }
 
+func TestKafkaBacklog(t *testing.T) {
+	if err := OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer CloseTest()
+
+	s, err := storage.DefaultLogStore()
+	if err != nil {
+		t.Skipf("no default log store: %v\n", err)
+	}
+	wl, ok := s.(storage.WriteLog)
+	if !ok {
+		t.Skipf("default log store %s is not a write log\n", s)
+	}
+	for _, msg := range []string{"first failed", "second"} {
+		if err := wl.TopicAppend("kafka-mytopic", storage.LogMessage{Data: []byte(msg)}); err != nil {
+			t.Fatalf("unable to append failed message: %v\n", err)
+		}
+	}
+
+	apiStr := fmt.Sprintf("%sserver/kafka-backlog", WebAPIPath)
+	r := TestHTTP(t, "GET", apiStr, nil)
+	var backlog storage.KafkaBacklog
+	if err := json.Unmarshal(r, &backlog); err != nil {
+		t.Fatalf("Unable to unmarshal kafka backlog response: %s\n", string(r))
+	}
+	if len(backlog) != 1 || backlog["mytopic"] != (storage.TopicStats{Messages: 2, Bytes: 18}) {
+		t.Errorf("bad kafka backlog: %v\n", backlog)
+	}
+
+	r = TestHTTP(t, "GET", apiStr+"?format=prometheus", nil)
+	expected := `# TYPE dvid_kafka_failed_messages gauge
+dvid_kafka_failed_messages{topic="mytopic"} 2
+# TYPE dvid_kafka_failed_bytes gauge
+dvid_kafka_failed_bytes{topic="mytopic"} 18
+`
+	if string(r) != expected {
+		t.Errorf("bad prometheus kafka backlog:\n%s\n", string(r))
+	}
+
+	if trimmer, ok := s.(storage.TopicTrimmer); ok {
+		err := trimmer.TopicTrim("kafka-mytopic", func(msgs []storage.LogMessage) []storage.LogMessage {
+			return msgs[1:]
+		})
+		if err != nil {
+			t.Fatalf("unable to trim failed messages: %v\n", err)
+		}
+		if err := wl.TopicAppend("kafka-mytopic", storage.LogMessage{Data: []byte("third")}); err != nil {
+			t.Fatalf("unable to append failed message after trim: %v\n", err)
+		}
+		r = TestHTTP(t, "GET", apiStr, nil)
+		if err := json.Unmarshal(r, &backlog); err != nil {
+			t.Fatalf("Unable to unmarshal kafka backlog response: %s\n", string(r))
+		}
+		if backlog["mytopic"] != (storage.TopicStats{Messages: 2, Bytes: 11}) {
+			t.Errorf("bad kafka backlog after trim: %v\n", backlog)
+		}
+	}
+
+	drainer, ok := s.(storage.TopicDrainer)
+	if !ok {
+		return
+	}
+	if _, err := drainer.TopicDrain("kafka-mytopic"); err != nil {
+		t.Fatalf("unable to drain failed messages: %v\n", err)
+	}
+	r = TestHTTP(t, "GET", apiStr, nil)
+	if err := json.Unmarshal(r, &backlog); err != nil {
+		t.Fatalf("Unable to unmarshal kafka backlog response: %s\n", string(r))
+	}
+	if backlog["mytopic"] != (storage.TopicStats{}) {
+		t.Errorf("expected empty backlog after drain, got %v\n", backlog)
+	}
+}
+
 func TestCommitBranchMergeDelete(t *testing.T) {
 	if err := OpenTest(); err != nil {
 		t.Fatalf("can't open test server: %v\n", err)
@@ -408,3 +487,102 @@ func TestStressConcurrentMetadataOps(t *testing.T) {
 	close(done)
 	wg.Wait()
 }
+
+func TestTraceID(t *testing.T) {
+	if err := OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer CloseTest()
+
+	apiStr := fmt.Sprintf("%sserver/info", WebAPIPath)
+	get := func(header, value string) string {
+		req, err := http.NewRequest("GET", apiStr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		ServeSingleHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("bad status %d for server info\n", w.Code)
+		}
+		return w.Header().Get("X-Request-ID")
+	}
+
+	if id := get("X-Request-ID", "client-id-123"); id != "client-id-123" {
+		t.Errorf("expected client request ID echoed, got %q\n", id)
+	}
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if id := get("traceparent", traceparent); id != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected trace-id from traceparent, got %q\n", id)
+	}
+	if id := get("", ""); id == "" {
+		t.Errorf("expected generated request ID in response\n")
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	defer func(old int) { MaxConcurrentPerClient = old }(MaxConcurrentPerClient)
+	MaxConcurrentPerClient = 1
+
+	started, finish := make(chan struct{}), make(chan struct{})
+	blocking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+	})
+	serve := func(c *web.C, remoteAddr string) int {
+		req := httptest.NewRequest("GET", "/api/server/info", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		concurrencyHandler(c, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, req)
+		return w.Code
+	}
+
+	c := &web.C{Env: map[interface{}]interface{}{}}
+	done := make(chan struct{})
+	go func() {
+		req := httptest.NewRequest("GET", "/api/server/info", nil)
+		req.RemoteAddr = "10.0.0.1:5000"
+		concurrencyHandler(c, blocking).ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+	<-started
+	if code := serve(c, "10.0.0.1:5001"); code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 for second request from same IP, got %d\n", code)
+	}
+	if code := serve(c, "10.0.0.2:5000"); code != http.StatusOK {
+		t.Errorf("expected request from another IP to succeed, got %d\n", code)
+	}
+	userC := &web.C{Env: map[interface{}]interface{}{"user": "alice"}}
+	if code := serve(userC, "10.0.0.1:5002"); code != http.StatusOK {
+		t.Errorf("expected authenticated request to be counted by user, got %d\n", code)
+	}
+	close(finish)
+	<-done
+	if code := serve(c, "10.0.0.1:5003"); code != http.StatusOK {
+		t.Errorf("expected request to succeed after first finished, got %d\n", code)
+	}
+}
+
+func TestServerTimingHeader(t *testing.T) {
+	var disabled *ServerTiming
+	disabled.Mark("storage")
+	w := httptest.NewRecorder()
+	disabled.SetHeader(w)
+	if h := w.Header().Get("Server-Timing"); h != "" {
+		t.Errorf("expected no Server-Timing header from nil timing, got %q\n", h)
+	}
+
+	now := time.Now()
+	timing := &ServerTiming{start: now, last: now}
+	timing.Mark("storage")
+	timing.Mark("deserialize")
+	timing.SetHeader(w)
+	h := w.Header().Get("Server-Timing")
+	re := regexp.MustCompile(`^storage;dur=[0-9.]+, deserialize;dur=[0-9.]+, total;dur=[0-9.]+$`)
+	if !re.MatchString(h) {
+		t.Errorf("bad Server-Timing header: %q\n", h)
+	}
+}
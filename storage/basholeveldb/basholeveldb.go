@@ -9,6 +9,7 @@ import (
 	"hash/fnv"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/storage"
@@ -440,6 +441,19 @@ func (db *LevelDB) metadataExists() (bool, error) {
 	return false, nil
 }
 
+// ---- Compactor interface ------
+
+// Compact compacts the entire key range of the database.
+func (db *LevelDB) Compact() error {
+	if db == nil || db.ldb == nil {
+		return fmt.Errorf("Can't call Compact() on nil LevelDB")
+	}
+	dvid.StartCgo()
+	db.ldb.CompactRange(levigo.Range{})
+	dvid.StopCgo()
+	return nil
+}
+
 // ---- KeyValueChecker interface ------
 
 // Exists returns true if the key exists.
@@ -1373,6 +1387,7 @@ type goBatch struct {
 	*levigo.WriteBatch
 	wo  *levigo.WriteOptions
 	ldb *levigo.DB
+	storage.BatchStatsTracker
 }
 
 // NewBatch returns an implementation that allows batch writes
@@ -1394,7 +1409,7 @@ func (db *LevelDB) NewBatch(ctx storage.Context) storage.Batch {
 	if !ok {
 		vctx = nil
 	}
-	return &goBatch{ctx, vctx, levigo.NewWriteBatch(), db.options.WriteOptions, db.ldb}
+	return &goBatch{ctx, vctx, levigo.NewWriteBatch(), db.options.WriteOptions, db.ldb, storage.BatchStatsTracker{}}
 }
 
 // --- Batch interface ---
@@ -1413,6 +1428,7 @@ func (batch *goBatch) Delete(tk storage.TKey) {
 		batch.WriteBatch.Put(tombstone, dvid.EmptyValue())
 	}
 	batch.WriteBatch.Delete(key)
+	batch.TrackDelete(tk)
 }
 
 func (batch *goBatch) Put(tk storage.TKey, v []byte) {
@@ -1431,6 +1447,14 @@ func (batch *goBatch) Put(tk storage.TKey, v []byte) {
 	storage.StoreKeyBytesWritten <- len(key)
 	storage.StoreValueBytesWritten <- len(v)
 	batch.WriteBatch.Put(key, v)
+	batch.TrackPut(tk, v)
+}
+
+// SetContext sets the context of later operations.  Implements the
+// storage.MultiContextBatch interface.
+func (batch *goBatch) SetContext(ctx storage.Context) {
+	batch.ctx = ctx
+	batch.vctx, _ = ctx.(storage.VersionedCtx)
 }
 
 func (batch *goBatch) Commit() error {
@@ -1440,7 +1464,9 @@ func (batch *goBatch) Commit() error {
 	dvid.StartCgo()
 	defer dvid.StopCgo()
 
+	t0 := time.Now()
 	err := batch.ldb.Write(batch.wo, batch.WriteBatch)
+	batch.TrackCommit(t0)
 	batch.WriteBatch.Close()
 	return err
 }
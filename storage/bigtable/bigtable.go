@@ -8,6 +8,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/storage"
@@ -1024,6 +1025,7 @@ type goBatch struct {
 	db  *BigTable
 	ctx storage.Context
 	kvs []storage.TKeyValue
+	storage.BatchStatsTracker
 }
 
 // NewBatch returns an implementation that allows batch writes
@@ -1032,7 +1034,7 @@ func (db *BigTable) NewBatch(ctx storage.Context) storage.Batch {
 		dvid.Criticalf("Received nil context in NewBatch()")
 		return nil
 	}
-	return &goBatch{db, ctx, []storage.TKeyValue{}}
+	return &goBatch{db, ctx, []storage.TKeyValue{}, storage.BatchStatsTracker{}}
 }
 
 // --- Batch interface ---
@@ -1040,6 +1042,7 @@ func (db *BigTable) NewBatch(ctx storage.Context) storage.Batch {
 func (batch *goBatch) Delete(tkey storage.TKey) {
 
 	batch.db.Delete(batch.ctx, tkey)
+	batch.TrackDelete(tkey)
 }
 
 func (batch *goBatch) Put(tkey storage.TKey, value []byte) {
@@ -1053,10 +1056,12 @@ func (batch *goBatch) Put(tkey storage.TKey, value []byte) {
 	batch.kvs = append(batch.kvs, storage.TKeyValue{tkey, value})
 	storage.StoreKeyBytesWritten <- len(tkey)
 	storage.StoreValueBytesWritten <- len(value)
+	batch.TrackPut(tkey, value)
 }
 
 func (batch *goBatch) Commit() error {
-
-	return batch.db.PutRange(batch.ctx, batch.kvs)
-
+	t0 := time.Now()
+	err := batch.db.PutRange(batch.ctx, batch.kvs)
+	batch.TrackCommit(t0)
+	return err
 }
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+const (
+	// DefaultCompactionMaxOps is the default maximum key-value gets and puts per second
+	// for a scheduled compaction to start.
+	DefaultCompactionMaxOps = 100
+
+	// DefaultCompactionInterval is the default minimum time between scheduled compactions.
+	DefaultCompactionInterval = 24 * time.Hour
+
+	// compactionCheckPeriod is how often a compaction scheduler checks if it should run.
+	compactionCheckPeriod = time.Minute
+)
+
+// CompactionSchedule specifies when a Compactor store is compacted in the background and
+// is set via the store configuration:
+//
+//	compaction_window = "02:00-05:00"  # daily local time window, required to enable
+//	compaction_max_ops = 100           # max gets + puts per second to start compaction
+//	compaction_interval = 24           # min hours between compactions
+//
+// A window whose end is earlier than its start wraps past midnight.
+type CompactionSchedule struct {
+	Start, End time.Duration // offsets of window from local midnight
+	MaxOps     int
+	Interval   time.Duration
+}
+
+// parseClock parses an "HH:MM" time of day into an offset from midnight.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("bad time of day %q, expected HH:MM: %v", s, err)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// ParseCompactionSchedule returns the background compaction schedule from a store
+// configuration.  If no compaction window is configured, the returned schedule is nil.
+func ParseCompactionSchedule(config dvid.StoreConfig) (*CompactionSchedule, error) {
+	window, found, err := config.GetString("compaction_window")
+	if err != nil || !found {
+		return nil, err
+	}
+	parts := strings.Split(window, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("compaction_window %q must be of form HH:MM-HH:MM", window)
+	}
+	cs := &CompactionSchedule{MaxOps: DefaultCompactionMaxOps, Interval: DefaultCompactionInterval}
+	if cs.Start, err = parseClock(parts[0]); err != nil {
+		return nil, err
+	}
+	if cs.End, err = parseClock(parts[1]); err != nil {
+		return nil, err
+	}
+	if cs.Start == cs.End {
+		return nil, fmt.Errorf("compaction_window %q is empty", window)
+	}
+	c := config.GetAll()
+	getInt := func(key string) (int64, bool, error) {
+		v, found := c[key]
+		if !found {
+			return 0, false, nil
+		}
+		i, ok := v.(int64)
+		if !ok {
+			return 0, true, fmt.Errorf("%q setting must be an int64, not %s (%v)", key, reflect.TypeOf(v), v)
+		}
+		if i < 0 {
+			return 0, true, fmt.Errorf("%q setting must be non-negative, not %d", key, i)
+		}
+		return i, true, nil
+	}
+	maxOps, found, err := getInt("compaction_max_ops")
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		cs.MaxOps = int(maxOps)
+	}
+	hours, found, err := getInt("compaction_interval")
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		cs.Interval = time.Duration(hours) * time.Hour
+	}
+	return cs, nil
+}
+
+// InWindow returns true if the given time lies in the daily compaction window.
+func (cs *CompactionSchedule) InWindow(t time.Time) bool {
+	y, m, d := t.Date()
+	offset := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+	if cs.Start < cs.End {
+		return offset >= cs.Start && offset < cs.End
+	}
+	return offset >= cs.Start || offset < cs.End
+}
+
+// due returns true if a compaction should start at the given time under the given load.
+func (cs *CompactionSchedule) due(now, last time.Time, opsPerSec int) bool {
+	if !cs.InWindow(now) || opsPerSec > cs.MaxOps {
+		return false
+	}
+	return last.IsZero() || now.Sub(last) >= cs.Interval
+}
+
+var (
+	compactionMu   sync.Mutex
+	compactionDone chan struct{}
+)
+
+// startCompaction runs the schedule for a store in the background until
+// stopCompaction is called.
+func startCompaction(alias Alias, store Compactor, cs *CompactionSchedule) {
+	compactionMu.Lock()
+	if compactionDone == nil {
+		compactionDone = make(chan struct{})
+	}
+	done := compactionDone
+	compactionMu.Unlock()
+
+	dvid.Infof("Store %q will be compacted during daily window starting %s for %s when under %d ops/sec\n",
+		alias, cs.Start, (cs.End-cs.Start+24*time.Hour)%(24*time.Hour), cs.MaxOps)
+	go func() {
+		ticker := time.NewTicker(compactionCheckPeriod)
+		defer ticker.Stop()
+		var last time.Time
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if !cs.due(now, last, GetsPerSec+PutsPerSec) {
+					continue
+				}
+				dvid.Infof("Starting scheduled compaction of store %q...\n", alias)
+				if err := store.Compact(); err != nil {
+					dvid.Errorf("scheduled compaction of store %q: %v\n", alias, err)
+				} else {
+					dvid.Infof("Finished scheduled compaction of store %q in %s\n", alias, time.Since(now))
+				}
+				last = now
+			}
+		}
+	}()
+}
+
+// stopCompaction stops all compaction schedulers.
+func stopCompaction() {
+	compactionMu.Lock()
+	defer compactionMu.Unlock()
+	if compactionDone != nil {
+		close(compactionDone)
+		compactionDone = nil
+	}
+}
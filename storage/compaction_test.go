@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+func TestCompactionSchedule(t *testing.T) {
+	var config dvid.StoreConfig
+	config.Config = dvid.NewConfig()
+	cs, err := ParseCompactionSchedule(config)
+	if err != nil || cs != nil {
+		t.Fatalf("expected no schedule without compaction_window, got %v, %v\n", cs, err)
+	}
+
+	config.Set("compaction_window", "23:00-02:30")
+	config.Set("compaction_max_ops", int64(10))
+	if cs, err = ParseCompactionSchedule(config); err != nil {
+		t.Fatalf("unable to parse compaction schedule: %v\n", err)
+	}
+	if cs.MaxOps != 10 || cs.Interval != DefaultCompactionInterval {
+		t.Errorf("bad compaction schedule: %v\n", cs)
+	}
+
+	day := time.Date(2020, 3, 1, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		offset time.Duration
+		in     bool
+	}{
+		{22 * time.Hour, false},
+		{23 * time.Hour, true},
+		{time.Hour, true},
+		{2*time.Hour + 30*time.Minute, false},
+		{12 * time.Hour, false},
+	}
+	for _, tc := range tests {
+		if in := cs.InWindow(day.Add(tc.offset)); in != tc.in {
+			t.Errorf("expected InWindow %t at %s, got %t\n", tc.in, tc.offset, in)
+		}
+	}
+
+	now := day.Add(time.Hour)
+	if !cs.due(now, time.Time{}, 5) {
+		t.Errorf("expected first compaction to be due in window under low load\n")
+	}
+	if cs.due(now, time.Time{}, 50) {
+		t.Errorf("expected no compaction under high load\n")
+	}
+	if cs.due(now, now.Add(-time.Hour), 5) {
+		t.Errorf("expected no compaction within interval of last compaction\n")
+	}
+
+	config.Set("compaction_window", "02:00")
+	if _, err = ParseCompactionSchedule(config); err == nil {
+		t.Errorf("expected error on malformed compaction_window\n")
+	}
+}
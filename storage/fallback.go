@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// PrimaryTier is the name of the store that answers reads by default, and FallbackTier
+// is the name of the read fallback of a store.
+const (
+	PrimaryTier  = "primary"
+	FallbackTier = "fallback"
+)
+
+// TierReader is implemented by stores that keep data in more than one store, allowing reads
+// to be directed to one of them, e.g., for debugging replication or reading the
+// authoritative copy.
+type TierReader interface {
+	// ReadTiers returns the names of the stores that can answer reads, the default first.
+	ReadTiers() []string
+
+	// ReadTier returns the named store or nil if there is none.
+	ReadTier(name string) OrderedKeyValueDB
+}
+
+// GetReadTier returns the store answering reads of the named tier of a store.  Every
+// ordered key-value store is its own PrimaryTier.
+func GetReadTier(store dvid.Store, tier string) (OrderedKeyValueDB, error) {
+	if tr, ok := store.(TierReader); ok {
+		if db := tr.ReadTier(tier); db != nil {
+			return db, nil
+		}
+		return nil, fmt.Errorf("store %s has no tier %q, only %v", store, tier, tr.ReadTiers())
+	}
+	db, ok := store.(OrderedKeyValueDB)
+	if !ok {
+		return nil, fmt.Errorf("store %s is not an ordered key-value store", store)
+	}
+	if tier != PrimaryTier {
+		return nil, fmt.Errorf("store %s has no tier %q, only %q", store, tier, PrimaryTier)
+	}
+	return db, nil
+}
+
+// NewFallbackOrderedKeyValueDB returns an OrderedKeyValueDB that serves reads from a fallback
+// store, e.g., a read-only replica, when a read on the primary store fails.  Each use of the
+// fallback is logged since its data may be stale.  Writes only go to the primary, so they
+// fail while the primary is unavailable.  Streaming range reads (ProcessRange, SendKeysInRange,
+// RawRangeQuery) are not retried on the fallback since results may already have been sent.
+func NewFallbackOrderedKeyValueDB(primary, fallback OrderedKeyValueDB) OrderedKeyValueDB {
+	return fallbackOrderedStore{OrderedKeyValueDB: primary, fallback: fallback}
+}
+
+type fallbackOrderedStore struct {
+	OrderedKeyValueDB // primary store
+	fallback          OrderedKeyValueDB
+}
+
+func (db fallbackOrderedStore) String() string {
+	return fmt.Sprintf("%s with read fallback %s", db.OrderedKeyValueDB, db.fallback)
+}
+
+func (db fallbackOrderedStore) Get(ctx Context, tk TKey) ([]byte, error) {
+	v, err := db.OrderedKeyValueDB.Get(ctx, tk)
+	if err != nil {
+		dvid.Warningf("Get on primary store %s failed, reading possibly stale data from fallback %s: %v\n", db.OrderedKeyValueDB, db.fallback, err)
+		return db.fallback.Get(ctx, tk)
+	}
+	return v, nil
+}
+
+func (db fallbackOrderedStore) GetRange(ctx Context, kStart, kEnd TKey) ([]*TKeyValue, error) {
+	kvs, err := db.OrderedKeyValueDB.GetRange(ctx, kStart, kEnd)
+	if err != nil {
+		dvid.Warningf("GetRange on primary store %s failed, reading possibly stale data from fallback %s: %v\n", db.OrderedKeyValueDB, db.fallback, err)
+		return db.fallback.GetRange(ctx, kStart, kEnd)
+	}
+	return kvs, nil
+}
+
+func (db fallbackOrderedStore) KeysInRange(ctx Context, kStart, kEnd TKey) ([]TKey, error) {
+	tks, err := db.OrderedKeyValueDB.KeysInRange(ctx, kStart, kEnd)
+	if err != nil {
+		dvid.Warningf("KeysInRange on primary store %s failed, reading possibly stale data from fallback %s: %v\n", db.OrderedKeyValueDB, db.fallback, err)
+		return db.fallback.KeysInRange(ctx, kStart, kEnd)
+	}
+	return tks, nil
+}
+
+// ReadTiers returns the primary and fallback tiers.
+func (db fallbackOrderedStore) ReadTiers() []string {
+	return []string{PrimaryTier, FallbackTier}
+}
+
+// ReadTier returns the primary or fallback store without falling back on failed reads.
+func (db fallbackOrderedStore) ReadTier(name string) OrderedKeyValueDB {
+	switch name {
+	case PrimaryTier:
+		return db.OrderedKeyValueDB
+	case FallbackTier:
+		return db.fallback
+	}
+	return nil
+}
+
+// Close is a no-op since the primary and fallback stores are closed by the storage manager.
+func (db fallbackOrderedStore) Close() {}
+
+// NewBatch returns a batch on the primary store or, if the primary doesn't support
+// batching, a batch that fails on commit.
+func (db fallbackOrderedStore) NewBatch(ctx Context) Batch {
+	batcher, ok := db.OrderedKeyValueDB.(KeyValueBatcher)
+	if !ok {
+		return errBatch{fmt.Errorf("store %s is not able to batch key-value ops", db.OrderedKeyValueDB)}
+	}
+	return batcher.NewBatch(ctx)
+}
@@ -1,12 +1,14 @@
 package filelog
 
 import (
+	"bufio"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/janelia-flyem/dvid/dvid"
@@ -357,6 +359,147 @@ func (flogs *fileLogs) TopicAppend(topic string, msg storage.LogMessage) error {
 	return err
 }
 
+// TopicDrain returns all messages appended to a topic and truncates its log, holding off
+// appends to the topic until done.
+func (flogs *fileLogs) TopicDrain(topic string) ([]storage.LogMessage, error) {
+	fl, err := flogs.getWriteLog(topic)
+	if err != nil {
+		return nil, fmt.Errorf("drain log %q: %v", flogs, err)
+	}
+	fl.Lock()
+	defer fl.Unlock()
+	f, err := os.Open(fl.Name())
+	if err != nil {
+		return nil, fmt.Errorf("drain log %q: %v", flogs, err)
+	}
+	reader := &fileLog{File: f}
+	msgs, err := reader.readAll()
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("bad read of log topic %q: %v", topic, err)
+	}
+	if err := fl.Truncate(0); err != nil {
+		return nil, fmt.Errorf("unable to truncate log topic %q: %v", topic, err)
+	}
+	return msgs, nil
+}
+
+// TopicTrim rewrites a topic log with the messages returned by keep, holding off appends
+// to the topic until done.  The kept messages are written to a temporary file that then
+// replaces the log, so a crash leaves either the old or the trimmed log.
+func (flogs *fileLogs) TopicTrim(topic string, keep func([]storage.LogMessage) []storage.LogMessage) error {
+	fl, err := flogs.getWriteLog(topic)
+	if err != nil {
+		return fmt.Errorf("trim log %q: %v", flogs, err)
+	}
+	fl.Lock()
+	defer fl.Unlock()
+	f, err := os.Open(fl.Name())
+	if err != nil {
+		return fmt.Errorf("trim log %q: %v", flogs, err)
+	}
+	reader := &fileLog{File: f}
+	msgs, err := reader.readAll()
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("bad read of log topic %q: %v", topic, err)
+	}
+	kept := keep(msgs)
+	if len(kept) == len(msgs) {
+		return nil
+	}
+
+	// the temporary file name doesn't share a prefix with topics.
+	tmpName := filepath.Join(flogs.path, ".trim-"+topic)
+	tmp, err := os.OpenFile(tmpName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("trim log topic %q: %v", topic, err)
+	}
+	writer := &fileLog{File: tmp}
+	for _, msg := range kept {
+		if err = writer.writeHeader(msg); err != nil {
+			break
+		}
+		if _, err = tmp.Write(msg.Data); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpName, fl.Name())
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("unable to write trimmed log topic %q: %v", topic, err)
+	}
+
+	// appends must go to the trimmed log.
+	f2, err := os.OpenFile(fl.Name(), os.O_WRONLY|os.O_CREATE|os.O_APPEND|os.O_SYNC, 0755)
+	if err != nil {
+		return fmt.Errorf("unable to reopen trimmed log topic %q: %v", topic, err)
+	}
+	fl.File.Close()
+	fl.File = f2
+	return nil
+}
+
+// TopicsWithPrefix returns the names of topic logs in the log directory that begin with
+// the given prefix.
+func (flogs *fileLogs) TopicsWithPrefix(prefix string) ([]string, error) {
+	infos, err := ioutil.ReadDir(flogs.path)
+	if err != nil {
+		return nil, fmt.Errorf("list topics of log %q: %v", flogs, err)
+	}
+	topics := []string{}
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasPrefix(info.Name(), prefix) {
+			topics = append(topics, info.Name())
+		}
+	}
+	return topics, nil
+}
+
+// TopicStats counts the messages of a topic log by reading their headers, holding off
+// appends to the topic until done.
+func (flogs *fileLogs) TopicStats(topic string) (stats storage.TopicStats, err error) {
+	flogs.RLock()
+	fl, found := flogs.files[topic]
+	flogs.RUnlock()
+	if found {
+		fl.RLock()
+		defer fl.RUnlock()
+	}
+	f, err := os.Open(filepath.Join(flogs.path, topic))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	hdrbuf := make([]byte, 6)
+	for {
+		if _, err = io.ReadFull(r, hdrbuf); err == io.EOF {
+			return stats, nil
+		}
+		if err != nil {
+			return stats, fmt.Errorf("bad read of log topic %q: %v", topic, err)
+		}
+		size := binary.LittleEndian.Uint32(hdrbuf[2:])
+		if _, err = r.Discard(int(size)); err != nil {
+			return stats, fmt.Errorf("bad read of log topic %q: %v", topic, err)
+		}
+		stats.Messages++
+		stats.Bytes += uint64(size)
+	}
+}
+
 func (flogs *fileLogs) TopicClose(topic string) error {
 	return flogs.closeWriteLog(topic)
 }
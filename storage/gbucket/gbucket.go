@@ -2069,6 +2069,7 @@ func (db *GBucket) Equal(c dvid.StoreConfig) bool {
 type goBatch struct {
 	db  storage.RequestBuffer
 	ctx storage.Context
+	storage.BatchStatsTracker
 }
 
 // NewBatch returns an implementation that allows batch writes
@@ -2077,7 +2078,7 @@ func (db *GBucket) NewBatch(ctx storage.Context) storage.Batch {
 		dvid.Criticalf("Received nil context in NewBatch()")
 		return nil
 	}
-	return &goBatch{db.NewBuffer(ctx), ctx}
+	return &goBatch{db.NewBuffer(ctx), ctx, storage.BatchStatsTracker{}}
 }
 
 // --- Batch interface ---
@@ -2085,6 +2086,7 @@ func (db *GBucket) NewBatch(ctx storage.Context) storage.Batch {
 func (batch *goBatch) Delete(tkey storage.TKey) {
 
 	batch.db.Delete(batch.ctx, tkey)
+	batch.TrackDelete(tkey)
 }
 
 func (batch *goBatch) Put(tkey storage.TKey, value []byte) {
@@ -2094,11 +2096,15 @@ func (batch *goBatch) Put(tkey storage.TKey, value []byte) {
 	}
 
 	batch.db.Put(batch.ctx, tkey, value)
+	batch.TrackPut(tkey, value)
 }
 
 // Commit flushes the buffer
 func (batch *goBatch) Commit() error {
-	return batch.db.Flush()
+	t0 := time.Now()
+	err := batch.db.Flush()
+	batch.TrackCommit(t0)
+	return err
 }
 
 // --- Buffer interface ----
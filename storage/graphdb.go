@@ -21,6 +21,11 @@ type GraphSetter interface {
 	// SetEdgeWeight modifies the weight of the edge defined by id1 and id2
 	SetEdgeWeight(ctx Context, id1 dvid.VertexID, id2 dvid.VertexID, weight float64) error
 
+	// SetEdgeWeights atomically sets the weights of the edges given by the vertex pairs
+	// of the updates to their weights.  Edges that don't exist are skipped if skipMissing
+	// is true, and otherwise no weights are changed and an error is returned.
+	SetEdgeWeights(ctx Context, updates []dvid.GraphEdge, skipMissing bool) error
+
 	// SetVertexProperty adds arbitrary data to a vertex using a string key
 	SetVertexProperty(ctx Context, id dvid.VertexID, key string, value []byte) error
 	// SetEdgeProperty adds arbitrary data to an edge using a string key
@@ -51,6 +56,22 @@ type GraphGetter interface {
 	GetVertexProperty(ctx Context, id dvid.VertexID, key string) ([]byte, error)
 	// GetEdgeProperty retrieves a property as a byte array given an edge defined by id1 and id2
 	GetEdgeProperty(ctx Context, id1 dvid.VertexID, id2 dvid.VertexID, key string) ([]byte, error)
+	// GetSubgraph retrieves the given vertices and only those edges with both vertices in
+	// the given set.  Vertex ids that are not in the graph are skipped.
+	GetSubgraph(ctx Context, ids []dvid.VertexID) ([]dvid.GraphVertex, []dvid.GraphEdge, error)
+}
+
+// GraphTxn groups graph modifications so they are applied together on Commit.
+// Setter methods should use the context the transaction began with.
+type GraphTxn interface {
+	GraphSetter
+
+	// Commit atomically applies all modifications if the backend supports atomic batches.
+	// It is an error to commit a transaction in which any modification failed.
+	Commit() error
+
+	// Abort discards all modifications made in the transaction.
+	Abort()
 }
 
 // GraphDB defines the entire interface that a graph database should support
@@ -58,4 +79,7 @@ type GraphDB interface {
 	GraphSetter
 	GraphGetter
 	Close()
+
+	// BeginGraphTxn starts a transaction for a sequence of graph modifications.
+	BeginGraphTxn(ctx Context) (GraphTxn, error)
 }
@@ -473,6 +473,36 @@ func (db *GraphKeyValueDB) SetEdgeWeight(ctx Context, id1 dvid.VertexID, id2 dvi
 	return err
 }
 
+// SetEdgeWeights modifies the weights of many edges in one batch (1 read per edge,
+// 1 batch write)
+func (db *GraphKeyValueDB) SetEdgeWeights(ctx Context, updates []dvid.GraphEdge, skipMissing bool) error {
+	batcher := db.dbbatch.NewBatch(ctx)
+	for _, update := range updates {
+		if update.GraphElement == nil {
+			return fmt.Errorf("no weight given for edge (%d, %d)", update.Vertexpair.Vertex1, update.Vertexpair.Vertex2)
+		}
+		id1, id2 := update.Vertexpair.Vertex1, update.Vertexpair.Vertex2
+		edgeIndex := &graphIndex{keyEdge, id1, id2, ""}
+		data, err := db.Get(ctx, edgeIndex.Bytes())
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			if skipMissing {
+				continue
+			}
+			return fmt.Errorf("edge (%d, %d) does not exist", id1, id2)
+		}
+		edge, err := db.deserializeEdge(data)
+		if err != nil {
+			return err
+		}
+		edge.Weight = update.Weight
+		batcher.Put(edgeIndex.Bytes(), db.serializeEdge(edge))
+	}
+	return batcher.Commit()
+}
+
 // SetVertexProperty modifies the vertex and adds a property vertex key (1 read, 2 writes)
 func (db *GraphKeyValueDB) SetVertexProperty(ctx Context, id dvid.VertexID, key string, value []byte) error {
 	// load data
@@ -758,6 +788,55 @@ func (db *GraphKeyValueDB) GetEdges(ctx Context) ([]dvid.GraphEdge, error) {
 	return edgelist, nil
 }
 
+// GetSubgraph reads each requested vertex and then only the edges between requested
+// vertices using the vertex adjacency lists (#reads = #vertices + #subgraph edges).
+// Vertex ids not found in the graph are skipped with a warning.
+func (db *GraphKeyValueDB) GetSubgraph(ctx Context, ids []dvid.VertexID) ([]dvid.GraphVertex, []dvid.GraphEdge, error) {
+	var vertexlist []dvid.GraphVertex
+	var edgelist []dvid.GraphEdge
+
+	inSet := make(map[dvid.VertexID]struct{}, len(ids))
+	for _, id := range ids {
+		if _, found := inSet[id]; found {
+			continue
+		}
+		vertexIndex := &graphIndex{keyVertex, id, 0, ""}
+		data, err := db.Get(ctx, vertexIndex.Bytes())
+		if err != nil {
+			return vertexlist, edgelist, err
+		}
+		if data == nil {
+			dvid.Warningf("Skipping vertex %d in subgraph request since it is not in graph\n", id)
+			continue
+		}
+		vertex, err := db.deserializeVertex(data)
+		if err != nil {
+			return vertexlist, edgelist, err
+		}
+		inSet[id] = struct{}{}
+		vertexlist = append(vertexlist, vertex)
+	}
+
+	// only read edges where both vertices are in the set, reading each edge once
+	for _, vertex := range vertexlist {
+		for _, partner := range vertex.Vertices {
+			if partner < vertex.Id {
+				continue
+			}
+			if _, found := inSet[partner]; !found {
+				continue
+			}
+			edge, err := db.GetEdge(ctx, vertex.Id, partner)
+			if err != nil {
+				return vertexlist, edgelist, err
+			}
+			edgelist = append(edgelist, edge)
+		}
+	}
+
+	return vertexlist, edgelist, nil
+}
+
 // GetVertexProperty performs 1 read (property name with vertex id encoded in key)
 func (db *GraphKeyValueDB) GetVertexProperty(ctx Context, id dvid.VertexID, key string) ([]byte, error) {
 	// load data
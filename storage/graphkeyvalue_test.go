@@ -73,3 +73,249 @@ func TestBasicGraph(t *testing.T) {
 		t.Errorf("Error removing graph: %v\n", err)
 	}
 }
+
+func TestGraphSubgraph(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	graphDB, err := storage.GraphStore()
+	if err != nil {
+		t.Fatalf("Can't open graph store: %v\n", err)
+	}
+
+	ctx := storage.GetTestDataContext(storage.TestUUID1, "subgraph", dvid.InstanceID(14))
+
+	for id := dvid.VertexID(1); id <= 4; id++ {
+		if err = graphDB.AddVertex(ctx, id, float64(id)); err != nil {
+			t.Fatalf("Can't add vertex %d: %v\n", id, err)
+		}
+	}
+	edges := [][2]dvid.VertexID{{1, 2}, {2, 3}, {3, 4}, {1, 4}}
+	for _, e := range edges {
+		if err = graphDB.AddEdge(ctx, e[0], e[1], 0.5); err != nil {
+			t.Fatalf("Can't add edge %v: %v\n", e, err)
+		}
+	}
+
+	// vertex 9 doesn't exist and should be skipped.
+	vertices, subedges, err := graphDB.GetSubgraph(ctx, []dvid.VertexID{1, 2, 4, 9})
+	if err != nil {
+		t.Fatalf("Can't get subgraph: %v\n", err)
+	}
+	if len(vertices) != 3 {
+		t.Errorf("Expected 3 vertices in subgraph, got %d: %v\n", len(vertices), vertices)
+	}
+	if len(subedges) != 2 {
+		t.Fatalf("Expected 2 edges in subgraph, got %d\n", len(subedges))
+	}
+	for _, edge := range subedges {
+		pair := edge.Vertexpair
+		if pair.Vertex1 == 3 || pair.Vertex2 == 3 {
+			t.Errorf("Subgraph included edge to vertex outside set: %v\n", pair)
+		}
+	}
+
+	if err = graphDB.RemoveGraph(ctx); err != nil {
+		t.Errorf("Error removing graph: %v\n", err)
+	}
+}
+
+// addChainGraph adds vertices 1 to n and edges between consecutive vertices.
+func addChainGraph(tb testing.TB, graphDB storage.GraphDB, ctx storage.Context, n int) {
+	for id := dvid.VertexID(1); id <= dvid.VertexID(n); id++ {
+		if err := graphDB.AddVertex(ctx, id, 1); err != nil {
+			tb.Fatalf("Can't add vertex %d: %v\n", id, err)
+		}
+		if id > 1 {
+			if err := graphDB.AddEdge(ctx, id-1, id, 0.5); err != nil {
+				tb.Fatalf("Can't add edge (%d, %d): %v\n", id-1, id, err)
+			}
+		}
+	}
+}
+
+// weightUpdates returns new weights for the edges of a chain graph of n vertices.
+func weightUpdates(n int) []dvid.GraphEdge {
+	var updates []dvid.GraphEdge
+	for id := dvid.VertexID(2); id <= dvid.VertexID(n); id++ {
+		updates = append(updates, dvid.GraphEdge{
+			GraphElement: &dvid.GraphElement{Weight: float64(id)},
+			Vertexpair:   dvid.VertexPairID{Vertex1: id, Vertex2: id - 1},
+		})
+	}
+	return updates
+}
+
+func TestGraphSetEdgeWeights(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	graphDB, err := storage.GraphStore()
+	if err != nil {
+		t.Fatalf("Can't open graph store: %v\n", err)
+	}
+	ctx := storage.GetTestDataContext(storage.TestUUID1, "edgeweights", dvid.InstanceID(21))
+	addChainGraph(t, graphDB, ctx, 4)
+
+	// a missing edge fails the whole batch unless skipped.
+	updates := append(weightUpdates(4), dvid.GraphEdge{
+		GraphElement: &dvid.GraphElement{Weight: 9},
+		Vertexpair:   dvid.VertexPairID{Vertex1: 1, Vertex2: 4},
+	})
+	if err = graphDB.SetEdgeWeights(ctx, updates, false); err == nil {
+		t.Errorf("Expected error setting weight of missing edge\n")
+	}
+	if edge, err := graphDB.GetEdge(ctx, 1, 2); err != nil || edge.Weight != 0.5 {
+		t.Errorf("Expected no weights changed by failed batch, got %v (err %v)\n", edge.GraphElement, err)
+	}
+	if err = graphDB.SetEdgeWeights(ctx, updates, true); err != nil {
+		t.Fatalf("Can't set edge weights: %v\n", err)
+	}
+	for id := dvid.VertexID(2); id <= 4; id++ {
+		edge, err := graphDB.GetEdge(ctx, id-1, id)
+		if err != nil {
+			t.Fatalf("Can't get edge: %v\n", err)
+		}
+		if edge.Weight != float64(id) {
+			t.Errorf("Bad weight for edge (%d, %d).  Should be %f, was %f\n", id-1, id, float64(id), edge.Weight)
+		}
+	}
+	if _, err := graphDB.GetEdge(ctx, 1, 4); err == nil {
+		t.Errorf("Expected skipped missing edge not to be created\n")
+	}
+
+	if err = graphDB.RemoveGraph(ctx); err != nil {
+		t.Errorf("Error removing graph: %v\n", err)
+	}
+}
+
+func BenchmarkSetEdgeWeights(b *testing.B) {
+	if err := server.OpenTest(); err != nil {
+		b.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	graphDB, err := storage.GraphStore()
+	if err != nil {
+		b.Fatalf("Can't open graph store: %v\n", err)
+	}
+	ctx := storage.GetTestDataContext(storage.TestUUID1, "benchweights", dvid.InstanceID(22))
+	const n = 1000
+	addChainGraph(b, graphDB, ctx, n)
+	updates := weightUpdates(n)
+
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := graphDB.SetEdgeWeights(ctx, updates, false); err != nil {
+				b.Fatalf("Can't set edge weights: %v\n", err)
+			}
+		}
+	})
+	b.Run("per-edge", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, update := range updates {
+				pair := update.Vertexpair
+				if err := graphDB.SetEdgeWeight(ctx, pair.Vertex1, pair.Vertex2, update.Weight); err != nil {
+					b.Fatalf("Can't set edge weight: %v\n", err)
+				}
+			}
+		}
+	})
+}
+
+func TestGraphTxn(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	graphDB, err := storage.GraphStore()
+	if err != nil {
+		t.Fatalf("Can't open graph store: %v\n", err)
+	}
+	ctx := storage.GetTestDataContext(storage.TestUUID1, "graphtxn", dvid.InstanceID(18))
+
+	// Aborted transactions leave no trace.
+	txn, err := graphDB.BeginGraphTxn(ctx)
+	if err != nil {
+		t.Fatalf("Can't begin graph transaction: %v\n", err)
+	}
+	if err = txn.AddVertex(ctx, 1, 5); err != nil {
+		t.Errorf("Can't add vertex in transaction: %v\n", err)
+	}
+	txn.Abort()
+	if vertices, err := graphDB.GetVertices(ctx); err != nil || len(vertices) != 0 {
+		t.Errorf("Expected no vertices after abort, got %v (err %v)\n", vertices, err)
+	}
+	if err = txn.AddVertex(ctx, 2, 5); err == nil {
+		t.Errorf("Expected error modifying aborted transaction\n")
+	}
+
+	// Modifications within a transaction see earlier ones and only appear on commit.
+	txn, err = graphDB.BeginGraphTxn(ctx)
+	if err != nil {
+		t.Fatalf("Can't begin graph transaction: %v\n", err)
+	}
+	if err = txn.AddVertex(ctx, 1, 5); err != nil {
+		t.Errorf("Can't add vertex in transaction: %v\n", err)
+	}
+	if err = txn.AddVertex(ctx, 2, 11); err != nil {
+		t.Errorf("Can't add vertex in transaction: %v\n", err)
+	}
+	if err = txn.AddEdge(ctx, 1, 2, 0.3); err != nil {
+		t.Errorf("Can't add edge in transaction: %v\n", err)
+	}
+	if err = txn.SetVertexProperty(ctx, 1, "foo", []byte("bar")); err != nil {
+		t.Errorf("Can't set vertex property in transaction: %v\n", err)
+	}
+	if vertices, err := graphDB.GetVertices(ctx); err != nil || len(vertices) != 0 {
+		t.Errorf("Expected no vertices before commit, got %v (err %v)\n", vertices, err)
+	}
+	if err = txn.Commit(); err != nil {
+		t.Fatalf("Can't commit graph transaction: %v\n", err)
+	}
+
+	vert1, err := graphDB.GetVertex(ctx, 1)
+	if err != nil {
+		t.Fatalf("Can't get vertex: %v\n", err)
+	}
+	if len(vert1.Vertices) != 1 || vert1.Vertices[0] != 2 {
+		t.Errorf("Expected vertex 1 to have edge to 2, got %v\n", vert1.Vertices)
+	}
+	if _, found := vert1.Properties["foo"]; !found {
+		t.Errorf("Expected vertex 1 to have property foo after commit\n")
+	}
+	edge, err := graphDB.GetEdge(ctx, 2, 1)
+	if err != nil {
+		t.Fatalf("Can't get edge: %v\n", err)
+	}
+	if edge.Weight != 0.3 {
+		t.Errorf("Bad edge.  Should be %f, was %f\n", 0.3, edge.Weight)
+	}
+
+	// A failed modification prevents the commit of the whole transaction.
+	txn, err = graphDB.BeginGraphTxn(ctx)
+	if err != nil {
+		t.Fatalf("Can't begin graph transaction: %v\n", err)
+	}
+	if err = txn.RemoveEdge(ctx, 1, 2); err != nil {
+		t.Errorf("Can't remove edge in transaction: %v\n", err)
+	}
+	if err = txn.AddEdge(ctx, 1, 3, 0.5); err == nil {
+		t.Errorf("Expected error adding edge to missing vertex\n")
+	}
+	if err = txn.Commit(); err == nil {
+		t.Errorf("Expected commit of failed transaction to return error\n")
+	}
+	if _, err = graphDB.GetEdge(ctx, 1, 2); err != nil {
+		t.Errorf("Expected edge to remain after failed transaction: %v\n", err)
+	}
+
+	if err = graphDB.RemoveGraph(ctx); err != nil {
+		t.Errorf("Error removing graph: %v\n", err)
+	}
+}
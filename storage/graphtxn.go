@@ -0,0 +1,357 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// BeginGraphTxn starts a transaction whose graph modifications are buffered in memory,
+// visible to the transaction's own reads, and written as one batch on Commit.  Since nothing
+// reaches the key-value store before Commit, a failure mid-sequence never leaves a
+// half-applied update.
+func (db *GraphKeyValueDB) BeginGraphTxn(ctx Context) (GraphTxn, error) {
+	if db.dbbatch == nil {
+		return nil, fmt.Errorf("graph transactions require a key-value store that supports batch writes")
+	}
+	store := &graphTxnStore{OrderedKeyValueDB: db.OrderedKeyValueDB, pending: make(map[string]txnWrite)}
+	txn := &graphKeyValueTxn{
+		GraphKeyValueDB: &GraphKeyValueDB{store, store},
+		db:              db,
+		ctx:             ctx,
+		store:           store,
+	}
+	return txn, nil
+}
+
+// txnWrite is a buffered put or delete of a key.
+type txnWrite struct {
+	v       []byte
+	deleted bool
+}
+
+// graphTxnStore overlays buffered writes on an ordered key-value store so the graph
+// operations of GraphKeyValueDB can run unchanged within a transaction.
+type graphTxnStore struct {
+	OrderedKeyValueDB // store holding the committed graph
+
+	sync.RWMutex
+	pending map[string]txnWrite
+}
+
+func (s *graphTxnStore) String() string {
+	return "graph transaction on " + s.OrderedKeyValueDB.String()
+}
+
+func (s *graphTxnStore) Get(ctx Context, tk TKey) ([]byte, error) {
+	s.RLock()
+	w, found := s.pending[string(tk)]
+	s.RUnlock()
+	if found {
+		if w.deleted {
+			return nil, nil
+		}
+		return w.v, nil
+	}
+	return s.OrderedKeyValueDB.Get(ctx, tk)
+}
+
+func (s *graphTxnStore) GetRange(ctx Context, kStart, kEnd TKey) ([]*TKeyValue, error) {
+	committed, err := s.OrderedKeyValueDB.GetRange(ctx, kStart, kEnd)
+	if err != nil {
+		return nil, err
+	}
+	s.RLock()
+	defer s.RUnlock()
+
+	var kvs TKeyValues
+	seen := make(map[string]struct{}, len(committed))
+	for _, kv := range committed {
+		seen[string(kv.K)] = struct{}{}
+		if w, found := s.pending[string(kv.K)]; found {
+			if !w.deleted {
+				kvs = append(kvs, TKeyValue{kv.K, w.v})
+			}
+			continue
+		}
+		kvs = append(kvs, *kv)
+	}
+	for k, w := range s.pending {
+		if _, found := seen[k]; found || w.deleted {
+			continue
+		}
+		tk := TKey(k)
+		if bytes.Compare(tk, kStart) >= 0 && bytes.Compare(tk, kEnd) <= 0 {
+			kvs = append(kvs, TKeyValue{tk, w.v})
+		}
+	}
+	sort.Sort(kvs)
+
+	out := make([]*TKeyValue, len(kvs))
+	for i := range kvs {
+		out[i] = &kvs[i]
+	}
+	return out, nil
+}
+
+func (s *graphTxnStore) KeysInRange(ctx Context, kStart, kEnd TKey) ([]TKey, error) {
+	kvs, err := s.GetRange(ctx, kStart, kEnd)
+	if err != nil {
+		return nil, err
+	}
+	tks := make([]TKey, len(kvs))
+	for i, kv := range kvs {
+		tks[i] = kv.K
+	}
+	return tks, nil
+}
+
+func (s *graphTxnStore) Put(ctx Context, tk TKey, v []byte) error {
+	s.Lock()
+	s.pending[string(tk)] = txnWrite{v: v}
+	s.Unlock()
+	return nil
+}
+
+func (s *graphTxnStore) Delete(ctx Context, tk TKey) error {
+	s.Lock()
+	s.pending[string(tk)] = txnWrite{deleted: true}
+	s.Unlock()
+	return nil
+}
+
+func (s *graphTxnStore) PutRange(ctx Context, kvs []TKeyValue) error {
+	s.Lock()
+	for _, kv := range kvs {
+		s.pending[string(kv.K)] = txnWrite{v: kv.V}
+	}
+	s.Unlock()
+	return nil
+}
+
+func (s *graphTxnStore) DeleteRange(ctx Context, kStart, kEnd TKey) error {
+	tks, err := s.KeysInRange(ctx, kStart, kEnd)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	for _, tk := range tks {
+		s.pending[string(tk)] = txnWrite{deleted: true}
+	}
+	s.Unlock()
+	return nil
+}
+
+func (s *graphTxnStore) RawPut(Key, []byte) error {
+	return fmt.Errorf("raw puts are not supported within a graph transaction")
+}
+
+func (s *graphTxnStore) RawDelete(Key) error {
+	return fmt.Errorf("raw deletes are not supported within a graph transaction")
+}
+
+func (s *graphTxnStore) DeleteAll(Context, bool) error {
+	return fmt.Errorf("deletion of all data is not supported within a graph transaction")
+}
+
+// Close is a no-op since the underlying store is not owned by the transaction.
+func (s *graphTxnStore) Close() {}
+
+// NewBatch returns a batch that adds its operations to the transaction on Commit.
+func (s *graphTxnStore) NewBatch(ctx Context) Batch {
+	return &graphTxnBatch{store: s, ops: make(map[string]txnWrite)}
+}
+
+// graphTxnBatch groups operations within a transaction.
+type graphTxnBatch struct {
+	BatchStatsTracker
+	store *graphTxnStore
+	order []string
+	ops   map[string]txnWrite
+}
+
+func (b *graphTxnBatch) add(tk TKey, w txnWrite) {
+	if _, found := b.ops[string(tk)]; !found {
+		b.order = append(b.order, string(tk))
+	}
+	b.ops[string(tk)] = w
+}
+
+func (b *graphTxnBatch) Delete(tk TKey) {
+	b.add(tk, txnWrite{deleted: true})
+	b.TrackDelete(tk)
+}
+
+func (b *graphTxnBatch) Put(tk TKey, v []byte) {
+	b.add(tk, txnWrite{v: v})
+	b.TrackPut(tk, v)
+}
+
+func (b *graphTxnBatch) Commit() error {
+	defer b.TrackCommit(time.Now())
+	b.store.Lock()
+	for _, k := range b.order {
+		b.store.pending[k] = b.ops[k]
+	}
+	b.store.Unlock()
+	return nil
+}
+
+// graphKeyValueTxn runs graph modifications against a graphTxnStore and records the
+// first error so a partially failed sequence cannot be committed.
+type graphKeyValueTxn struct {
+	*GraphKeyValueDB // graph operations on the transaction overlay
+
+	db    *GraphKeyValueDB
+	ctx   Context
+	store *graphTxnStore
+	err   error
+	done  bool
+}
+
+// check records the first error of a transaction's modifications.
+func (txn *graphKeyValueTxn) check(err error) error {
+	if err != nil && txn.err == nil {
+		txn.err = err
+	}
+	return err
+}
+
+// active returns an error if the transaction has been committed or aborted.
+func (txn *graphKeyValueTxn) active() error {
+	if txn.done {
+		return fmt.Errorf("graph transaction has already been committed or aborted")
+	}
+	return nil
+}
+
+func (txn *graphKeyValueTxn) CreateGraph(ctx Context) error {
+	if err := txn.active(); err != nil {
+		return err
+	}
+	return txn.check(txn.GraphKeyValueDB.CreateGraph(ctx))
+}
+
+func (txn *graphKeyValueTxn) AddVertex(ctx Context, id dvid.VertexID, weight float64) error {
+	if err := txn.active(); err != nil {
+		return err
+	}
+	return txn.check(txn.GraphKeyValueDB.AddVertex(ctx, id, weight))
+}
+
+func (txn *graphKeyValueTxn) AddEdge(ctx Context, id1 dvid.VertexID, id2 dvid.VertexID, weight float64) error {
+	if err := txn.active(); err != nil {
+		return err
+	}
+	return txn.check(txn.GraphKeyValueDB.AddEdge(ctx, id1, id2, weight))
+}
+
+func (txn *graphKeyValueTxn) SetVertexWeight(ctx Context, id dvid.VertexID, weight float64) error {
+	if err := txn.active(); err != nil {
+		return err
+	}
+	return txn.check(txn.GraphKeyValueDB.SetVertexWeight(ctx, id, weight))
+}
+
+func (txn *graphKeyValueTxn) SetEdgeWeight(ctx Context, id1 dvid.VertexID, id2 dvid.VertexID, weight float64) error {
+	if err := txn.active(); err != nil {
+		return err
+	}
+	return txn.check(txn.GraphKeyValueDB.SetEdgeWeight(ctx, id1, id2, weight))
+}
+
+func (txn *graphKeyValueTxn) SetEdgeWeights(ctx Context, updates []dvid.GraphEdge, skipMissing bool) error {
+	if err := txn.active(); err != nil {
+		return err
+	}
+	return txn.check(txn.GraphKeyValueDB.SetEdgeWeights(ctx, updates, skipMissing))
+}
+
+func (txn *graphKeyValueTxn) SetVertexProperty(ctx Context, id dvid.VertexID, key string, value []byte) error {
+	if err := txn.active(); err != nil {
+		return err
+	}
+	return txn.check(txn.GraphKeyValueDB.SetVertexProperty(ctx, id, key, value))
+}
+
+func (txn *graphKeyValueTxn) SetEdgeProperty(ctx Context, id1 dvid.VertexID, id2 dvid.VertexID, key string, value []byte) error {
+	if err := txn.active(); err != nil {
+		return err
+	}
+	return txn.check(txn.GraphKeyValueDB.SetEdgeProperty(ctx, id1, id2, key, value))
+}
+
+func (txn *graphKeyValueTxn) RemoveVertex(ctx Context, id dvid.VertexID) error {
+	if err := txn.active(); err != nil {
+		return err
+	}
+	return txn.check(txn.GraphKeyValueDB.RemoveVertex(ctx, id))
+}
+
+func (txn *graphKeyValueTxn) RemoveEdge(ctx Context, id1 dvid.VertexID, id2 dvid.VertexID) error {
+	if err := txn.active(); err != nil {
+		return err
+	}
+	return txn.check(txn.GraphKeyValueDB.RemoveEdge(ctx, id1, id2))
+}
+
+func (txn *graphKeyValueTxn) RemoveGraph(ctx Context) error {
+	if err := txn.active(); err != nil {
+		return err
+	}
+	return txn.check(txn.GraphKeyValueDB.RemoveGraph(ctx))
+}
+
+func (txn *graphKeyValueTxn) RemoveVertexProperty(ctx Context, id dvid.VertexID, key string) error {
+	if err := txn.active(); err != nil {
+		return err
+	}
+	return txn.check(txn.GraphKeyValueDB.RemoveVertexProperty(ctx, id, key))
+}
+
+func (txn *graphKeyValueTxn) RemoveEdgeProperty(ctx Context, id1 dvid.VertexID, id2 dvid.VertexID, key string) error {
+	if err := txn.active(); err != nil {
+		return err
+	}
+	return txn.check(txn.GraphKeyValueDB.RemoveEdgeProperty(ctx, id1, id2, key))
+}
+
+// Commit writes all buffered modifications to the graph's store in one batch.
+func (txn *graphKeyValueTxn) Commit() error {
+	if err := txn.active(); err != nil {
+		return err
+	}
+	txn.done = true
+	if txn.err != nil {
+		return fmt.Errorf("graph transaction not committed due to earlier error: %v", txn.err)
+	}
+
+	txn.store.RLock()
+	keys := make([]string, 0, len(txn.store.pending))
+	for k := range txn.store.pending {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	batch := txn.db.dbbatch.NewBatch(txn.ctx)
+	for _, k := range keys {
+		if w := txn.store.pending[k]; w.deleted {
+			batch.Delete(TKey(k))
+		} else {
+			batch.Put(TKey(k), w.v)
+		}
+	}
+	txn.store.RUnlock()
+	return batch.Commit()
+}
+
+// Abort discards all buffered modifications.
+func (txn *graphKeyValueTxn) Abort() {
+	txn.done = true
+	txn.store.Lock()
+	txn.store.pending = make(map[string]txnWrite)
+	txn.store.Unlock()
+}
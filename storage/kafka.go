@@ -1,10 +1,19 @@
 package storage
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/janelia-flyem/dvid/dvid"
@@ -14,18 +23,139 @@ import (
 
 var (
 	// global producer
-	kafkaProducer *kafka.Producer
+	kafkaProducer   *kafka.Producer
+	kafkaProducerMu sync.RWMutex // protects kafkaProducer, held for reading while producing
 
 	// the kafka topic for activity logging
 	kafkaActivityTopic string
 
+	// the host ID given at initialization, included in structured activity events
+	kafkaHostID string
+
 	// the kafka topic prefix for mutation logging
 	KafkaTopicPrefix string
 
 	// topic suffixes per data UUID for mutation logging
 	kafkaTopicSuffixes map[dvid.UUID]string
+
+	// activity sampling per operation type, set at initialization and read-only after.
+	activitySamplers map[string]*activitySampler
+
+	// circuit breaker around message production, nil if disabled.
+	kafkaProducerBreaker *kafkaBreaker
+
+	// closed to stop the periodic flushing of the producer.
+	kafkaFlushDone chan struct{}
+
+	// done when the periodic flushing of the producer has stopped.
+	kafkaFlushWG sync.WaitGroup
+
+	// closed to stop the periodic retry of failed activities.
+	kafkaRetryDone chan struct{}
+
+	// closed to stop the periodic trimming of failed logs.
+	kafkaTrimDone chan struct{}
+
+	// retention of failed messages, set at initialization and read-only after.
+	kafkaFailedRetention failedRetention
+
+	// messages of at least this many bytes are gzipped individually, 0 if disabled.
+	kafkaCompressMinBytes int
 )
 
+// activitySampler allows 1 in every rate activities of a given operation type.  Structured
+// activity events are counted separately so they are sampled independently of the
+// per-request activity logged by the server.
+type activitySampler struct {
+	rate       uint64
+	count      uint64
+	eventCount uint64
+}
+
+// DefaultKafkaFlushIntervalSecs is the default seconds between flushes of in-flight kafka
+// messages.
+const DefaultKafkaFlushIntervalSecs = 5
+
+// DefaultFailedLogTrimSecs is the default seconds between trims of failed logs when a
+// retention is set.
+const DefaultFailedLogTrimSecs = 300
+
+// kafkaShutdownFlushTimeout is the time allowed to deliver in-flight messages on shutdown.
+const kafkaShutdownFlushTimeout = 10 * time.Second
+
+// ErrKafkaBreakerOpen is returned when a message isn't produced because the kafka circuit
+// breaker is open.  The message is stored in the failed log instead.
+var ErrKafkaBreakerOpen = errors.New("kafka circuit breaker is open, message stored in failed log")
+
+// DefaultKafkaBreakerCooldownSecs is the default seconds a tripped circuit breaker waits
+// before probing kafka again.
+const DefaultKafkaBreakerCooldownSecs = 60
+
+// kafkaBreaker stops production of kafka messages after a number of consecutive failures.
+// After a cooldown, a single probe message is allowed, which closes the breaker if it is
+// delivered or restarts the cooldown if it fails.
+type kafkaBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int       // consecutive failures
+	openUntil time.Time // end of the current cooldown if the breaker is open
+	probing   bool      // true if a probe message is outstanding
+}
+
+// allow returns true if a message should be produced.
+func (b *kafkaBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// success records a delivered message, closing the breaker if it was open.
+func (b *kafkaBreaker) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures >= b.threshold {
+		dvid.Infof("Kafka circuit breaker closed after successful delivery\n")
+	}
+	b.failures = 0
+	b.probing = false
+}
+
+// failure records a failed message, opening the breaker for a cooldown if the threshold
+// of consecutive failures is reached.  Returns true if the breaker was just opened.
+func (b *kafkaBreaker) failure() (opened bool) {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.failures < b.threshold {
+		return false
+	}
+	b.openUntil = time.Now().Add(b.cooldown)
+	if b.failures == b.threshold {
+		dvid.Errorf("Kafka circuit breaker opened after %d consecutive failures; messages will go to the failed log for %s between probes\n", b.failures, b.cooldown)
+		return true
+	}
+	return false
+}
+
 // assume very low throughput needed and therefore always one partition
 const partitionID = 0
 
@@ -36,6 +166,91 @@ type KafkaConfig struct {
 	TopicPrefix   string   // if supplied, will be prefixed to any mutation logging
 	TopicSuffixes []string // optional topic suffixes per data UUID
 	Servers       []string
+
+	// ActivitySampling maps a read operation type, e.g., "GET" or "HEAD", to N where only
+	// 1 in N activities of that type are logged.  Mutations are always logged.
+	ActivitySampling map[string]int
+
+	// BreakerFailures, if nonzero, is the number of consecutive failed messages after which
+	// production stops and messages go directly to the failed log until a probe message is
+	// delivered.  BreakerCooldownSecs is the seconds between probes.
+	BreakerFailures     int
+	BreakerCooldownSecs int
+
+	// FlushIntervalSecs is the seconds between flushes of in-flight messages, which bounds
+	// the messages that can be lost in a crash.  If zero, DefaultKafkaFlushIntervalSecs is
+	// used, and if negative, messages are only flushed on shutdown.
+	FlushIntervalSecs int
+
+	// Compression is the producer's batch compression codec: "none" (default), "gzip",
+	// "snappy", "lz4", or "zstd".  Consumers decompress batches transparently.
+	Compression string
+
+	// CompressMinBytes, if nonzero, is the size at or above which an individual message
+	// value is gzipped before production.  Such messages have a "Content-Encoding" header
+	// of "gzip" so consumers know to decompress them.
+	CompressMinBytes int
+
+	// ActivityRetrySecs, if positive, is the seconds between retries of activities that
+	// couldn't be produced or delivered, which are kept in the failed log of the activity
+	// topic.  Requires a default log store that can be drained, e.g., filelog.
+	ActivityRetrySecs int
+
+	// FailedLogMaxAgeSecs, if positive, is the seconds failed messages are kept in the
+	// failed logs of their topics before being purged, and FailedLogMaxBytes, if positive,
+	// is the maximum bytes of messages kept per failed log, with the oldest purged first.
+	// Failed logs are trimmed every FailedLogTrimSecs, DefaultFailedLogTrimSecs if not
+	// positive.  Requires a default log store that can be trimmed, e.g., filelog.
+	FailedLogMaxAgeSecs int
+	FailedLogMaxBytes   int
+	FailedLogTrimSecs   int
+}
+
+// kafkaCompressionCodecs are the producer compression codecs supported by kafka.
+var kafkaCompressionCodecs = map[string]bool{
+	"none":   true,
+	"gzip":   true,
+	"snappy": true,
+	"lz4":    true,
+	"zstd":   true,
+}
+
+// mutations are always logged to the activity topic regardless of sampling configuration.
+func isMutationOp(op string) bool {
+	switch op {
+	case "POST", "PUT", "DELETE", "PATCH":
+		return true
+	}
+	return false
+}
+
+// ActivitySampleRate returns N if only 1 in N activities of the given operation type
+// are logged, or 1 if all are logged.
+func ActivitySampleRate(op string) int {
+	sampler, found := activitySamplers[strings.ToUpper(op)]
+	if !found {
+		return 1
+	}
+	return int(sampler.rate)
+}
+
+// ActivitySampled returns true if an activity of the given operation type should be
+// logged given any configured sampling.  It is safe for concurrent use.
+func ActivitySampled(op string) bool {
+	sampler, found := activitySamplers[strings.ToUpper(op)]
+	if !found {
+		return true
+	}
+	return (atomic.AddUint64(&sampler.count, 1)-1)%sampler.rate == 0
+}
+
+// ActivityEventSampled is like ActivitySampled but for structured activity events.
+func ActivityEventSampled(op string) bool {
+	sampler, found := activitySamplers[strings.ToUpper(op)]
+	if !found {
+		return true
+	}
+	return (atomic.AddUint64(&sampler.eventCount, 1)-1)%sampler.rate == 0
 }
 
 // KafkaTopicSuffix returns any configured suffix for the given data UUID or the empty string.
@@ -55,6 +270,7 @@ func (kc KafkaConfig) Initialize(hostID string) error {
 	if len(kc.Servers) == 0 {
 		return nil
 	}
+	kafkaHostID = hostID
 	kafkaTopicSuffixes = make(map[dvid.UUID]string)
 	for _, spec := range kc.TopicSuffixes {
 		parts := strings.Split(spec, ":")
@@ -69,6 +285,32 @@ func (kc KafkaConfig) Initialize(hostID string) error {
 		KafkaTopicPrefix = kc.TopicPrefix
 	}
 
+	activitySamplers = make(map[string]*activitySampler)
+	for op, rate := range kc.ActivitySampling {
+		op = strings.ToUpper(op)
+		switch {
+		case isMutationOp(op):
+			dvid.Infof("Ignored kafka activity sampling for %s since mutations are always logged\n", op)
+		case rate < 1:
+			dvid.Infof("Ignored bad kafka activity sampling rate %d for %s\n", rate, op)
+		case rate > 1:
+			activitySamplers[op] = &activitySampler{rate: uint64(rate)}
+			dvid.Infof("Logging 1 in %d %s activities to kafka\n", rate, op)
+		}
+	}
+
+	if kc.BreakerFailures > 0 {
+		cooldownSecs := kc.BreakerCooldownSecs
+		if cooldownSecs <= 0 {
+			cooldownSecs = DefaultKafkaBreakerCooldownSecs
+		}
+		kafkaProducerBreaker = &kafkaBreaker{
+			threshold: kc.BreakerFailures,
+			cooldown:  time.Duration(cooldownSecs) * time.Second,
+		}
+		dvid.Infof("Kafka circuit breaker opens after %d consecutive failures with %d sec cooldown\n", kc.BreakerFailures, cooldownSecs)
+	}
+
 	if kc.TopicActivity != "" {
 		kafkaActivityTopic = kc.TopicActivity
 	} else {
@@ -84,16 +326,71 @@ func (kc KafkaConfig) Initialize(hostID string) error {
 		"client.id":         "dvid-kafkaclient",
 		"bootstrap.servers": strings.Join(kc.Servers, ","),
 	}
-	if kafkaProducer, err = kafka.NewProducer(configMap); err != nil {
+	if kc.Compression != "" {
+		codec := strings.ToLower(kc.Compression)
+		if !kafkaCompressionCodecs[codec] {
+			return fmt.Errorf("unknown kafka compression %q, expected none, gzip, snappy, lz4, or zstd", kc.Compression)
+		}
+		(*configMap)["compression.codec"] = codec
+		dvid.Infof("Kafka messages compressed with %s\n", codec)
+	}
+	if kc.CompressMinBytes > 0 {
+		kafkaCompressMinBytes = kc.CompressMinBytes
+		dvid.Infof("Kafka messages of at least %d bytes gzipped individually\n", kc.CompressMinBytes)
+	}
+	producer, err := kafka.NewProducer(configMap)
+	if err != nil {
 		return err
 	}
+	kafkaProducerMu.Lock()
+	kafkaProducer = producer
+	kafkaProducerMu.Unlock()
+
+	flushSecs := kc.FlushIntervalSecs
+	if flushSecs == 0 {
+		flushSecs = DefaultKafkaFlushIntervalSecs
+	}
+	if flushSecs > 0 {
+		kafkaFlushDone = make(chan struct{})
+		kafkaFlushWG.Add(1)
+		go flushKafkaLoop(producer, time.Duration(flushSecs)*time.Second, kafkaFlushDone)
+	}
+
+	if kc.ActivityRetrySecs > 0 {
+		kafkaRetryDone = make(chan struct{})
+		go retryActivityLoop(time.Duration(kc.ActivityRetrySecs)*time.Second, kafkaRetryDone)
+		dvid.Infof("Retrying failed kafka activities every %d seconds\n", kc.ActivityRetrySecs)
+	}
+
+	if kc.FailedLogMaxAgeSecs > 0 || kc.FailedLogMaxBytes > 0 {
+		if kc.FailedLogMaxAgeSecs > 0 {
+			kafkaFailedRetention.maxAge = time.Duration(kc.FailedLogMaxAgeSecs) * time.Second
+		}
+		if kc.FailedLogMaxBytes > 0 {
+			kafkaFailedRetention.maxBytes = kc.FailedLogMaxBytes
+		}
+		trimSecs := kc.FailedLogTrimSecs
+		if trimSecs <= 0 {
+			trimSecs = DefaultFailedLogTrimSecs
+		}
+		kafkaTrimDone = make(chan struct{})
+		go trimFailedLoop(time.Duration(trimSecs)*time.Second, kafkaTrimDone)
+		dvid.Infof("Trimming failed kafka logs every %d seconds to %d seconds and %d bytes (0 is unlimited)\n",
+			trimSecs, kc.FailedLogMaxAgeSecs, kc.FailedLogMaxBytes)
+	}
 
 	go func() {
-		for e := range kafkaProducer.Events() {
+		for e := range producer.Events() {
 			switch ev := e.(type) {
 			case *kafka.Message:
 				if ev.TopicPartition.Error != nil {
 					dvid.Errorf("Delivery failed to kafka servers: %v\n", ev.TopicPartition)
+					kafkaProducerBreaker.failure()
+					if kafkaRetryDone != nil && ev.TopicPartition.Topic != nil && *ev.TopicPartition.Topic == kafkaActivityTopic {
+						storeFailedMsg("kafka-"+kafkaActivityTopic, undeliveredValue(ev))
+					}
+				} else {
+					kafkaProducerBreaker.success()
 				}
 			}
 		}
@@ -101,15 +398,389 @@ func (kc KafkaConfig) Initialize(hostID string) error {
 	return nil
 }
 
+// flushKafkaLoop flushes in-flight messages of the producer on the given interval, waiting
+// at most the interval for delivery.
+func flushKafkaLoop(producer *kafka.Producer, interval time.Duration, done <-chan struct{}) {
+	defer kafkaFlushWG.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if remaining := producer.Flush(int(interval / time.Millisecond)); remaining > 0 {
+				dvid.Errorf("%d kafka messages still in flight after flush\n", remaining)
+			}
+		}
+	}
+}
+
+// undeliveredValue returns the value of a message as given for production, i.e., before
+// any gzipping of the individual message.
+func undeliveredValue(msg *kafka.Message) []byte {
+	for _, h := range msg.Headers {
+		if h.Key == "Content-Encoding" && string(h.Value) == "gzip" {
+			zr, err := gzip.NewReader(bytes.NewReader(msg.Value))
+			if err != nil {
+				break
+			}
+			value, err := ioutil.ReadAll(zr)
+			if err != nil {
+				break
+			}
+			return value
+		}
+	}
+	return msg.Value
+}
+
+// retryActivityLoop retries failed activities on the given interval.
+func retryActivityLoop(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			produced, err := RetryFailedActivity()
+			if produced > 0 {
+				dvid.Infof("Produced %d previously failed activities to kafka topic %q\n", produced, kafkaActivityTopic)
+			}
+			if err != nil && err != ErrKafkaBreakerOpen {
+				dvid.Errorf("unable to retry failed kafka activities: %v\n", err)
+			}
+		}
+	}
+}
+
+// RetryFailedActivity produces the activities stored in the failed log of the activity
+// topic, returning the number produced.  Retrying stops at the first activity that fails
+// again, which along with the remaining activities is kept in the failed log.
+func RetryFailedActivity() (produced int, err error) {
+	kafkaProducerMu.RLock()
+	noProducer := kafkaProducer == nil
+	kafkaProducerMu.RUnlock()
+	if noProducer || kafkaActivityTopic == "" {
+		return 0, nil
+	}
+	s, err := DefaultLogStore()
+	if err != nil {
+		return 0, err
+	}
+	drainer, ok := s.(TopicDrainer)
+	if !ok {
+		return 0, fmt.Errorf("default log store %s can't replay failed messages", s)
+	}
+	topic := "kafka-" + kafkaActivityTopic
+	msgs, err := drainer.TopicDrain(topic)
+	if err != nil {
+		return 0, err
+	}
+	for i, msg := range msgs {
+		value, _ := failedMsgValue(msg)
+		if !json.Valid(value) {
+			dvid.Errorf("dropping failed kafka activity that isn't valid JSON: %q\n", value)
+			continue
+		}
+		// failed production stores the message again.
+		if err := KafkaProduceMsg(value, kafkaActivityTopic); err != nil {
+			for _, rest := range msgs[i+1:] {
+				appendFailedMsg(topic, rest)
+			}
+			return produced, err
+		}
+		produced++
+	}
+	return produced, nil
+}
+
+// failedRetention limits the failed messages kept per failed log, where zero values are
+// unlimited.
+type failedRetention struct {
+	maxAge   time.Duration
+	maxBytes int
+}
+
+// keep returns the messages of a failed log that are within the retention at the given
+// time.  Messages stored without a time are only purged to keep within maxBytes.
+func (r failedRetention) keep(msgs []LogMessage, now time.Time) []LogMessage {
+	kept := msgs
+	if r.maxAge > 0 {
+		kept = make([]LogMessage, 0, len(msgs))
+		for _, msg := range msgs {
+			if _, stored := failedMsgValue(msg); stored.IsZero() || now.Sub(stored) <= r.maxAge {
+				kept = append(kept, msg)
+			}
+		}
+	}
+	if r.maxBytes > 0 {
+		var size int
+		for i := len(kept) - 1; i >= 0; i-- {
+			if size += len(kept[i].Data); size > r.maxBytes {
+				return kept[i+1:]
+			}
+		}
+	}
+	return kept
+}
+
+// TrimFailedMessages purges the failed messages of all topics that are beyond the
+// retention set at initialization, returning the number purged.
+func TrimFailedMessages() (purged int, err error) {
+	if kafkaFailedRetention == (failedRetention{}) {
+		return 0, nil
+	}
+	s, err := DefaultLogStore()
+	if err != nil {
+		return 0, err
+	}
+	counter, ok := s.(TopicCounter)
+	if !ok {
+		return 0, fmt.Errorf("default log store %s can't list failed logs", s)
+	}
+	trimmer, ok := s.(TopicTrimmer)
+	if !ok {
+		return 0, fmt.Errorf("default log store %s can't trim failed logs", s)
+	}
+	topics, err := counter.TopicsWithPrefix("kafka-")
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	for _, topic := range topics {
+		err = trimmer.TopicTrim(topic, func(msgs []LogMessage) []LogMessage {
+			kept := kafkaFailedRetention.keep(msgs, now)
+			purged += len(msgs) - len(kept)
+			return kept
+		})
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// trimFailedLoop trims failed logs on the given interval.
+func trimFailedLoop(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			purged, err := TrimFailedMessages()
+			if purged > 0 {
+				dvid.Infof("Purged %d failed kafka messages beyond retention\n", purged)
+			}
+			if err != nil {
+				dvid.Errorf("unable to trim failed kafka logs: %v\n", err)
+			}
+		}
+	}
+}
+
+// KafkaBacklog gives the failed kafka messages awaiting replay, keyed by kafka topic.
+type KafkaBacklog map[string]TopicStats
+
+// GetKafkaBacklog returns the failed kafka messages stored in the default log store, which
+// grow while kafka servers are unreachable or reject messages.
+func GetKafkaBacklog() (KafkaBacklog, error) {
+	s, err := DefaultLogStore()
+	if err != nil {
+		return nil, err
+	}
+	counter, ok := s.(TopicCounter)
+	if !ok {
+		return nil, fmt.Errorf("default log store %s can't count failed messages", s)
+	}
+	topics, err := counter.TopicsWithPrefix("kafka-")
+	if err != nil {
+		return nil, err
+	}
+	backlog := make(KafkaBacklog, len(topics))
+	for _, topic := range topics {
+		stats, err := counter.TopicStats(topic)
+		if err != nil {
+			return nil, err
+		}
+		backlog[strings.TrimPrefix(topic, "kafka-")] = stats
+	}
+	return backlog, nil
+}
+
+// WritePrometheus writes the backlog as gauges of failed messages and bytes per topic in
+// the Prometheus text format.
+func (b KafkaBacklog) WritePrometheus(w io.Writer) error {
+	topics := make([]string, 0, len(b))
+	for topic := range b {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	if _, err := fmt.Fprintf(w, "# TYPE dvid_kafka_failed_messages gauge\n"); err != nil {
+		return err
+	}
+	for _, topic := range topics {
+		if _, err := fmt.Fprintf(w, "dvid_kafka_failed_messages{topic=%q} %d\n", topic, b[topic].Messages); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "# TYPE dvid_kafka_failed_bytes gauge\n"); err != nil {
+		return err
+	}
+	for _, topic := range topics {
+		if _, err := fmt.Fprintf(w, "dvid_kafka_failed_bytes{topic=%q} %d\n", topic, b[topic].Bytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ShutdownKafka stops periodic flushing and retries, then flushes in-flight messages and
+// closes the producer once messages being produced are queued.
+func ShutdownKafka() {
+	kafkaProducerMu.RLock()
+	noProducer := kafkaProducer == nil
+	kafkaProducerMu.RUnlock()
+	if noProducer {
+		return
+	}
+	if kafkaFlushDone != nil {
+		close(kafkaFlushDone)
+		kafkaFlushDone = nil
+		kafkaFlushWG.Wait()
+	}
+	if kafkaRetryDone != nil {
+		close(kafkaRetryDone)
+		kafkaRetryDone = nil
+	}
+	if kafkaTrimDone != nil {
+		close(kafkaTrimDone)
+		kafkaTrimDone = nil
+	}
+	kafkaProducerMu.Lock()
+	defer kafkaProducerMu.Unlock()
+	if kafkaProducer == nil {
+		return
+	}
+	if remaining := kafkaProducer.Flush(int(kafkaShutdownFlushTimeout / time.Millisecond)); remaining > 0 {
+		dvid.Errorf("%d kafka messages were not delivered before shutdown\n", remaining)
+	}
+	kafkaProducer.Close()
+	kafkaProducer = nil
+}
+
+// ActivityEvent is a structured activity message with a stable schema across datatypes.
+// Use LogActivityToKafka with a map for custom activity instead.
+type ActivityEvent struct {
+	Time     int64             `json:"time"`     // start of the activity in Unix seconds
+	HostID   string            `json:"host"`     // the host ID of this server
+	User     string            `json:"user"`     // user given in the request, if any
+	UUID     dvid.UUID         `json:"uuid"`     // version of the activity
+	Instance dvid.InstanceName `json:"instance"` // data instance name
+	Datatype dvid.TypeString   `json:"datatype"` // name of the data instance's type
+	Op       string            `json:"op"`       // operation, e.g., "GET key"
+	Duration float64           `json:"duration"` // milliseconds
+	Bytes    int64             `json:"bytes"`    // bytes received and sent
+
+	start time.Time
+}
+
+// NewActivityEvent starts an activity event for an operation at the current time.  The
+// event's fields are set by chained calls and its duration by Done, e.g.,
+//
+//	e := storage.NewActivityEvent("GET key").ForData(uuid, name, typename).WithUser(user)
+//	...
+//	e.WithBytes(n).Done().Log()
+func NewActivityEvent(op string) *ActivityEvent {
+	now := time.Now()
+	return &ActivityEvent{
+		Time:   now.Unix(),
+		HostID: kafkaHostID,
+		Op:     op,
+		start:  now,
+	}
+}
+
+// ForData sets the version, instance, and datatype of the event.
+func (e *ActivityEvent) ForData(uuid dvid.UUID, name dvid.InstanceName, typename dvid.TypeString) *ActivityEvent {
+	e.UUID, e.Instance, e.Datatype = uuid, name, typename
+	return e
+}
+
+// WithUser sets the user of the event.
+func (e *ActivityEvent) WithUser(user string) *ActivityEvent {
+	e.User = user
+	return e
+}
+
+// WithOp replaces the operation of the event, e.g., once a request has been parsed.
+func (e *ActivityEvent) WithOp(op string) *ActivityEvent {
+	e.Op = op
+	return e
+}
+
+// WithBytes sets the bytes received and sent for the event.
+func (e *ActivityEvent) WithBytes(n int64) *ActivityEvent {
+	e.Bytes = n
+	return e
+}
+
+// Done sets the duration of the event to the time since it was started.
+func (e *ActivityEvent) Done() *ActivityEvent {
+	e.Duration = time.Since(e.start).Seconds() * 1000.0
+	return e
+}
+
+// Log publishes the event to the kafka activity topic if one is configured.
+func (e *ActivityEvent) Log() {
+	if kafkaActivityTopic == "" {
+		return
+	}
+	jsonmsg, err := json.Marshal(e)
+	if err != nil {
+		dvid.Errorf("unable to marshal activity event for kafka logging: %v\n", err)
+		return
+	}
+	go func() {
+		if err := KafkaProduceMsg(jsonmsg, kafkaActivityTopic); err != nil && err != ErrKafkaBreakerOpen {
+			dvid.Errorf("unable to publish activity event to kafka activity topic: %v\n", err)
+		}
+	}()
+}
+
+// marshalActivity returns the JSON of an activity.  If the activity can't be marshaled,
+// e.g., because of a channel or NaN value, such values are replaced by their formatted
+// strings so the activity isn't lost.
+func marshalActivity(activity map[string]interface{}) ([]byte, error) {
+	jsonmsg, err := json.Marshal(activity)
+	if err == nil {
+		return jsonmsg, nil
+	}
+	dvid.Errorf("unable to marshal activity for kafka logging, formatting bad values: %v\n", err)
+	sanitized := make(map[string]interface{}, len(activity))
+	for k, v := range activity {
+		if _, err := json.Marshal(v); err != nil {
+			sanitized[k] = fmt.Sprintf("%v", v)
+		} else {
+			sanitized[k] = v
+		}
+	}
+	return json.Marshal(sanitized)
+}
+
 // LogActivityToKafka publishes activity
 func LogActivityToKafka(activity map[string]interface{}) {
 	if kafkaActivityTopic != "" {
 		go func() {
-			jsonmsg, err := json.Marshal(activity)
+			jsonmsg, err := marshalActivity(activity)
 			if err != nil {
 				dvid.Errorf("unable to marshal activity for kafka logging: %v\n", err)
+				return
 			}
-			if err := KafkaProduceMsg(jsonmsg, kafkaActivityTopic); err != nil {
+			if err := KafkaProduceMsg(jsonmsg, kafkaActivityTopic); err != nil && err != ErrKafkaBreakerOpen {
 				dvid.Errorf("unable to publish activity to kafka activity topic: %v\n", err)
 			}
 		}()
@@ -118,13 +789,30 @@ func LogActivityToKafka(activity map[string]interface{}) {
 
 // KafkaProduceMsg sends a message to kafka
 func KafkaProduceMsg(value []byte, topic string) error {
+	kafkaProducerMu.RLock()
+	defer kafkaProducerMu.RUnlock()
 	if kafkaProducer != nil {
+		if !kafkaProducerBreaker.allow() {
+			storeFailedMsg("kafka-"+topic, value)
+			return ErrKafkaBreakerOpen
+		}
 		kafkaMsg := &kafka.Message{
 			TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
 			Value:          value,
 			Timestamp:      time.Now(),
 		}
+		if kafkaCompressMinBytes > 0 && len(value) >= kafkaCompressMinBytes {
+			compressed, err := gzipKafkaMsg(value)
+			if err != nil {
+				dvid.Errorf("unable to gzip %d byte kafka message, sending uncompressed: %v\n", len(value), err)
+			} else {
+				kafkaMsg.Value = compressed
+				kafkaMsg.Headers = []kafka.Header{{Key: "Content-Encoding", Value: []byte("gzip")}}
+			}
+		}
 		if err := kafkaProducer.Produce(kafkaMsg, nil); err != nil {
+			kafkaProducerBreaker.failure()
+
 			// Store data in append-only log
 			storeFailedMsg("kafka-"+topic, value)
 
@@ -140,8 +828,42 @@ func KafkaProduceMsg(value []byte, topic string) error {
 	return nil
 }
 
+// gzipKafkaMsg returns the gzipped message value.
+func gzipKafkaMsg(value []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(value); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// failedMsgTimed is the entry type of failed messages stored with the time they failed.
+// Messages stored before times were kept have entry type 0 and only the message value.
+const failedMsgTimed = 1
+
+// failedMsgValue returns the value of a stored failed message and the time it was stored,
+// which is zero if not known.
+func failedMsgValue(msg LogMessage) (value []byte, stored time.Time) {
+	if msg.EntryType != failedMsgTimed || len(msg.Data) < 8 {
+		return msg.Data, time.Time{}
+	}
+	return msg.Data[8:], time.Unix(0, int64(binary.LittleEndian.Uint64(msg.Data[:8])))
+}
+
 // if we have default log store, save the failed messages
 func storeFailedMsg(topic string, msg []byte) {
+	data := make([]byte, 8+len(msg))
+	binary.LittleEndian.PutUint64(data[:8], uint64(time.Now().UnixNano()))
+	copy(data[8:], msg)
+	appendFailedMsg(topic, LogMessage{EntryType: failedMsgTimed, Data: data})
+}
+
+// appendFailedMsg appends a failed message as stored to the failed log of a topic.
+func appendFailedMsg(topic string, msg LogMessage) {
 	s, err := DefaultLogStore()
 	if err != nil {
 		dvid.Criticalf("unable to store failed kafka message to topic %q because no log store\n", topic)
@@ -152,7 +874,7 @@ func storeFailedMsg(topic string, msg []byte) {
 		dvid.Criticalf("unable to store failed kafka message to topic %q because log store is not WriteLog\n", topic)
 		return
 	}
-	if err := wl.TopicAppend(topic, LogMessage{Data: msg}); err != nil {
+	if err := wl.TopicAppend(topic, msg); err != nil {
 		dvid.Criticalf("unable to store failed kafka message to topic %q: %v\n", topic, err)
 	}
 }
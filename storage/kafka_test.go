@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+func TestKafkaBreaker(t *testing.T) {
+	b := &kafkaBreaker{threshold: 3, cooldown: 20 * time.Millisecond}
+	for i := 0; i < 2; i++ {
+		if !b.allow() {
+			t.Fatalf("expected breaker to allow messages before threshold\n")
+		}
+		if b.failure() {
+			t.Fatalf("expected breaker to stay closed after %d failures\n", i+1)
+		}
+	}
+	if !b.failure() {
+		t.Fatalf("expected breaker to open at threshold\n")
+	}
+	if b.allow() {
+		t.Fatalf("expected open breaker to reject messages during cooldown\n")
+	}
+
+	// after the cooldown, only a single probe is allowed.
+	time.Sleep(30 * time.Millisecond)
+	if !b.allow() {
+		t.Fatalf("expected probe after cooldown\n")
+	}
+	if b.allow() {
+		t.Fatalf("expected only one outstanding probe\n")
+	}
+	if b.failure() {
+		t.Fatalf("expected failed probe not to count as newly opened\n")
+	}
+	if b.allow() {
+		t.Fatalf("expected failed probe to restart cooldown\n")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !b.allow() {
+		t.Fatalf("expected probe after second cooldown\n")
+	}
+	b.success()
+	for i := 0; i < 3; i++ {
+		if !b.allow() {
+			t.Fatalf("expected closed breaker after successful probe\n")
+		}
+	}
+
+	var disabled *kafkaBreaker
+	if !disabled.allow() || disabled.failure() {
+		t.Errorf("expected nil breaker to always allow messages\n")
+	}
+}
+
+func TestGzipKafkaMsg(t *testing.T) {
+	msg := bytes.Repeat([]byte(`{"Action": "delete", "Key": "abc"}`), 100)
+	compressed, err := gzipKafkaMsg(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compressed) >= len(msg) {
+		t.Errorf("expected repetitive message to compress, got %d bytes from %d\n", len(compressed), len(msg))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompressed, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decompressed, msg) {
+		t.Errorf("gzipped message didn't round trip\n")
+	}
+}
+
+func TestUndeliveredValue(t *testing.T) {
+	msg := bytes.Repeat([]byte(`{"Action": "delete", "Key": "abc"}`), 100)
+	compressed, err := gzipKafkaMsg(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzipped := &kafka.Message{
+		Value:   compressed,
+		Headers: []kafka.Header{{Key: "Content-Encoding", Value: []byte("gzip")}},
+	}
+	if value := undeliveredValue(gzipped); !bytes.Equal(value, msg) {
+		t.Errorf("expected gzipped message to be restored, got %d bytes\n", len(value))
+	}
+	if value := undeliveredValue(&kafka.Message{Value: msg}); !bytes.Equal(value, msg) {
+		t.Errorf("expected uncompressed message as is, got %d bytes\n", len(value))
+	}
+}
+
+func TestFailedRetention(t *testing.T) {
+	now := time.Now()
+	timed := func(value string, age time.Duration) LogMessage {
+		data := make([]byte, 8+len(value))
+		binary.LittleEndian.PutUint64(data[:8], uint64(now.Add(-age).UnixNano()))
+		copy(data[8:], value)
+		return LogMessage{EntryType: failedMsgTimed, Data: data}
+	}
+	msgs := []LogMessage{
+		{Data: []byte("untimed")},
+		timed("old", 2*time.Hour),
+		timed("recent", 10*time.Minute),
+		timed("new", time.Minute),
+	}
+	if value, stored := failedMsgValue(msgs[2]); string(value) != "recent" || !stored.Equal(now.Add(-10*time.Minute)) {
+		t.Errorf("bad timed failed message value %q at %v\n", value, stored)
+	}
+	if value, stored := failedMsgValue(msgs[0]); string(value) != "untimed" || !stored.IsZero() {
+		t.Errorf("bad untimed failed message value %q at %v\n", value, stored)
+	}
+
+	values := func(msgs []LogMessage) string {
+		var vals []string
+		for _, msg := range msgs {
+			value, _ := failedMsgValue(msg)
+			vals = append(vals, string(value))
+		}
+		return strings.Join(vals, ",")
+	}
+	tests := []struct {
+		retention failedRetention
+		expected  string
+	}{
+		{failedRetention{}, "untimed,old,recent,new"},
+		{failedRetention{maxAge: time.Hour}, "untimed,recent,new"},
+		{failedRetention{maxBytes: 8 + 6 + 8 + 3}, "recent,new"},
+		{failedRetention{maxAge: 5 * time.Minute, maxBytes: 100}, "untimed,new"},
+		{failedRetention{maxBytes: 1}, ""},
+	}
+	for _, tc := range tests {
+		if got := values(tc.retention.keep(msgs, now)); got != tc.expected {
+			t.Errorf("expected %+v to keep %q, got %q\n", tc.retention, tc.expected, got)
+		}
+	}
+}
+
+func TestMarshalActivity(t *testing.T) {
+	activity := map[string]interface{}{
+		"Action": "post",
+		"Bytes":  1024,
+		"Bad":    make(chan int),
+	}
+	jsonmsg, err := marshalActivity(activity)
+	if err != nil {
+		t.Fatalf("expected activity with bad value to be marshaled: %v\n", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(jsonmsg, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["Action"] != "post" || decoded["Bytes"] != 1024.0 {
+		t.Errorf("expected good values to be kept, got %v\n", decoded)
+	}
+	if bad, ok := decoded["Bad"].(string); !ok || bad == "" {
+		t.Errorf("expected bad value to be formatted as a string, got %v\n", decoded["Bad"])
+	}
+}
+
+func TestActivityEvent(t *testing.T) {
+	e := NewActivityEvent("GET key").ForData("abc123", "kv", "keyvalue").WithUser("someone")
+	e.WithOp("POST key").WithBytes(42).Done()
+	jsonBytes, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(jsonBytes, &fields); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"user":     "someone",
+		"uuid":     "abc123",
+		"instance": "kv",
+		"datatype": "keyvalue",
+		"op":       "POST key",
+		"bytes":    42.0,
+	}
+	for name, value := range expected {
+		if fields[name] != value {
+			t.Errorf("expected activity event %q to be %v, got %v\n", name, value, fields[name])
+		}
+	}
+	for _, name := range []string{"time", "host", "duration"} {
+		if _, found := fields[name]; !found {
+			t.Errorf("expected activity event to have %q field\n", name)
+		}
+	}
+	if len(fields) != 9 {
+		t.Errorf("expected 9 fields in activity event, got %d: %s\n", len(fields), string(jsonBytes))
+	}
+}
+
+func TestActivityEventSampling(t *testing.T) {
+	activitySamplers = map[string]*activitySampler{"GET": {rate: 2}}
+	defer func() { activitySamplers = nil }()
+
+	// request activity sampling shouldn't affect which events are sampled.
+	ActivitySampled("GET")
+	var sampled int
+	for i := 0; i < 4; i++ {
+		if ActivityEventSampled("get") {
+			sampled++
+		}
+		ActivitySampled("GET")
+	}
+	if sampled != 2 {
+		t.Errorf("expected 2 of 4 events sampled, got %d\n", sampled)
+	}
+	if !ActivityEventSampled("POST") {
+		t.Errorf("expected unsampled operation to always be logged\n")
+	}
+}
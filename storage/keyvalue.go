@@ -106,6 +106,19 @@ func MaxTKey(class TKeyClass) TKey {
 	return TKey([]byte{byte(class), tkeyMaxByte})
 }
 
+// PrefixRange returns the lexicographically smallest and largest TKey of the given class
+// whose type-specific component begins with the given prefix.  Like the max key returned
+// by DataContext.TKeyRange(), the end key is not the theoretical maximum but bounds any
+// key with 128 bytes or less following the prefix.
+func PrefixRange(class TKeyClass, prefix []byte) (kStart, kEnd TKey) {
+	kStart = NewTKey(class, prefix)
+	end := make([]byte, len(prefix)+len(maxTKey))
+	copy(end, prefix)
+	copy(end[len(prefix):], maxTKey)
+	kEnd = NewTKey(class, end)
+	return
+}
+
 // Class returns the TKeyClass of a TKey.
 func (tk TKey) Class() (TKeyClass, error) {
 	if len(tk) == 0 {
@@ -211,6 +224,12 @@ type KeyValueChecker interface {
 	Exists(ctx Context, k TKey) (bool, error)
 }
 
+// Compactor stores can compact their stored data, e.g., to reclaim space of deleted and
+// overwritten key-value pairs and reduce read amplification of LSM engines.
+type Compactor interface {
+	Compact() error
+}
+
 type KeyValueGetter interface {
 	// Get returns a value given a key.
 	Get(ctx Context, k TKey) ([]byte, error)
@@ -309,6 +328,15 @@ type KeyValueBatcher interface {
 	NewBatch(ctx Context) Batch
 }
 
+// MultiContextBatch is a Batch whose operations can use different contexts, so writes to
+// several data instances in the same store can be committed atomically.
+type MultiContextBatch interface {
+	Batch
+
+	// SetContext sets the context used to construct keys of later operations.
+	SetContext(ctx Context)
+}
+
 // KeyValueRequester allows operations to be queued so that
 // they can be handled as a batch job.  (See RequestBuffer for
 // more information.)
@@ -379,6 +407,107 @@ type Batch interface {
 
 	// Commits a batch of operations and closes the write batch.
 	Commit() error
+
+	// Stats returns the number of operations and bytes added to the batch and,
+	// after Commit, the commit duration.
+	Stats() BatchStats
+}
+
+// BatchStats describes the size and timing of a Batch for performance tuning.
+type BatchStats struct {
+	Puts       int           // number of puts
+	Deletes    int           // number of deletes
+	Bytes      int           // total bytes of type-specific keys and values
+	CommitTime time.Duration // time to commit, zero if not yet committed
+}
+
+// String returns a loggable description of the batch stats.
+func (s BatchStats) String() string {
+	return fmt.Sprintf("%d puts, %d deletes, %d bytes, commit %s", s.Puts, s.Deletes, s.Bytes, s.CommitTime)
+}
+
+// BatchStatsTracker can be embedded in Batch implementations to accumulate BatchStats.
+type BatchStatsTracker struct {
+	stats BatchStats
+}
+
+// TrackPut records a put of the given key-value.
+func (t *BatchStatsTracker) TrackPut(tk TKey, v []byte) {
+	t.stats.Puts++
+	t.stats.Bytes += len(tk) + len(v)
+}
+
+// TrackDelete records a delete of the given key.
+func (t *BatchStatsTracker) TrackDelete(tk TKey) {
+	t.stats.Deletes++
+	t.stats.Bytes += len(tk)
+}
+
+// TrackCommit records the duration of a commit that started at the given time.
+func (t *BatchStatsTracker) TrackCommit(start time.Time) {
+	t.stats.CommitTime = time.Since(start)
+}
+
+// Stats returns the accumulated batch stats.
+func (t *BatchStatsTracker) Stats() BatchStats {
+	return t.stats
+}
+
+// ValuePredicate returns true if a key-value pair should be selected.
+type ValuePredicate func(*TKeyValue) (bool, error)
+
+// DeleteRangeIfBatchSize is the maximum number of deletions committed in one batch by
+// DeleteRangeIf.
+const DeleteRangeIfBatchSize = 1000
+
+// DeleteRangeIf deletes the key-value pairs in the range [kStart, kEnd] whose values satisfy
+// the given predicate and returns the matched keys.  Unlike a blind DeleteRange, each value
+// in the range must be read and checked, so this is considerably more expensive.  Deletions
+// are committed in batches of up to DeleteRangeIfBatchSize keys, each batch being atomic.
+// If a batch fails, the keys deleted by earlier batches are returned with the error.  If
+// dryRun is true, the matching keys are returned but nothing is deleted.
+func DeleteRangeIf(ctx Context, db OrderedKeyValueDB, kStart, kEnd TKey, pred ValuePredicate, dryRun bool) ([]TKey, error) {
+	var matched []TKey
+	err := db.ProcessRange(ctx, kStart, kEnd, nil, func(c *Chunk) error {
+		if c == nil || c.TKeyValue == nil {
+			return nil
+		}
+		ok, err := pred(c.TKeyValue)
+		if err != nil {
+			return err
+		}
+		if ok {
+			tk := make(TKey, len(c.K))
+			copy(tk, c.K)
+			matched = append(matched, tk)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dryRun || len(matched) == 0 {
+		return matched, nil
+	}
+	batcher, ok := db.(KeyValueBatcher)
+	if !ok {
+		return nil, fmt.Errorf("conditional range delete requires a batch-capable store, not %s", db)
+	}
+	for start := 0; start < len(matched); start += DeleteRangeIfBatchSize {
+		end := start + DeleteRangeIfBatchSize
+		if end > len(matched) {
+			end = len(matched)
+		}
+		batch := batcher.NewBatch(ctx)
+		for _, tk := range matched[start:end] {
+			batch.Delete(tk)
+		}
+		if err := batch.Commit(); err != nil {
+			return matched[:start], err
+		}
+		dvid.Debugf("Conditional range delete batch: %s\n", batch.Stats())
+	}
+	return matched, nil
 }
 
 func getNextInstance(db OrderedKeyValueGetter, curID dvid.InstanceID) (nextID dvid.InstanceID, finished bool, err error) {
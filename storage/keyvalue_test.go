@@ -0,0 +1,339 @@
+package storage_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+func TestBatchStats(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	store, err := storage.DefaultKVStore()
+	if err != nil {
+		t.Fatalf("can't get default store: %v\n", err)
+	}
+	batcher, ok := store.(storage.KeyValueBatcher)
+	if !ok {
+		t.Fatalf("default store %s is not a batcher\n", store)
+	}
+	ctx := storage.GetTestDataContext(storage.TestUUID1, "batchstats", dvid.InstanceID(15))
+
+	batch := batcher.NewBatch(ctx)
+	tk1 := storage.NewTKey(23, []byte("key1"))
+	tk2 := storage.NewTKey(23, []byte("key2"))
+	batch.Put(tk1, []byte("value1"))
+	batch.Put(tk2, []byte("another value"))
+	batch.Delete(tk1)
+
+	stats := batch.Stats()
+	if stats.Puts != 2 || stats.Deletes != 1 {
+		t.Errorf("expected 2 puts and 1 delete, got %s\n", stats)
+	}
+	expectedBytes := 3*len(tk1) + len("value1") + len("another value")
+	if stats.Bytes != expectedBytes {
+		t.Errorf("expected %d bytes in batch, got %d\n", expectedBytes, stats.Bytes)
+	}
+	if stats.CommitTime != 0 {
+		t.Errorf("expected no commit time before commit, got %s\n", stats.CommitTime)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("unable to commit batch: %v\n", err)
+	}
+	if batch.Stats().CommitTime == 0 {
+		t.Errorf("expected commit time after commit\n")
+	}
+}
+
+func TestTieredStore(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	db, err := storage.DefaultOrderedKVDB()
+	if err != nil {
+		t.Fatalf("can't get default ordered store: %v\n", err)
+	}
+	// Route key class 31 to a read-only view so we can tell which tier handled a write.
+	tiers := map[storage.TKeyClass]storage.OrderedKeyValueDB{
+		31: storage.NewReadOnlyOrderedKeyValueDB(db),
+	}
+	tiered := storage.NewTieredOrderedKeyValueDB(db, tiers)
+	ctx := storage.GetTestDataContext(storage.TestUUID1, "tiered", dvid.InstanceID(16))
+
+	defaultTK := storage.NewTKey(30, []byte("key"))
+	tierTK := storage.NewTKey(31, []byte("key"))
+	if err := tiered.Put(ctx, defaultTK, []byte("hot")); err != nil {
+		t.Fatalf("expected put to default tier to succeed: %v\n", err)
+	}
+	if err := tiered.Put(ctx, tierTK, []byte("cold")); err != storage.ErrReadOnly {
+		t.Errorf("expected put to key class 31 to be routed to read-only tier, got %v\n", err)
+	}
+	value, err := tiered.Get(ctx, defaultTK)
+	if err != nil {
+		t.Fatalf("unable to get key from default tier: %v\n", err)
+	}
+	if string(value) != "hot" {
+		t.Errorf("expected value %q, got %q\n", "hot", string(value))
+	}
+	if _, err := tiered.GetRange(ctx, defaultTK, tierTK); err == nil {
+		t.Errorf("expected error on range spanning tiered stores\n")
+	}
+}
+
+// abortingStore fails range queries after sending one key-value without the nil that ends
+// a successful query.
+type abortingStore struct {
+	storage.OrderedKeyValueDB
+}
+
+func (db abortingStore) RawRangeQuery(kStart, kEnd storage.Key, keysOnly bool, out chan *storage.KeyValue, cancel <-chan struct{}) error {
+	out <- &storage.KeyValue{K: kStart}
+	return errUnavailable
+}
+
+func TestTieredRawRangeQueryError(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	db, err := storage.DefaultOrderedKVDB()
+	if err != nil {
+		t.Fatalf("can't get default ordered store: %v\n", err)
+	}
+	tiers := map[storage.TKeyClass]storage.OrderedKeyValueDB{31: abortingStore{db}}
+	tiered := storage.NewTieredOrderedKeyValueDB(db, tiers)
+	ctx := storage.GetTestDataContext(storage.TestUUID1, "tieredraw", dvid.InstanceID(21))
+
+	kStart := ctx.ConstructKey(storage.NewTKey(30, []byte("a")))
+	kEnd := ctx.ConstructKey(storage.NewTKey(31, []byte("z")))
+	out := make(chan *storage.KeyValue, 100)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- tiered.RawRangeQuery(kStart, kEnd, true, out, nil)
+	}()
+	select {
+	case err := <-errCh:
+		if err != errUnavailable {
+			t.Errorf("expected error from failed tier, got %v\n", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("range query spanning a failed tier didn't return\n")
+	}
+}
+
+func TestShardedStore(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	db, err := storage.DefaultOrderedKVDB()
+	if err != nil {
+		t.Fatalf("can't get default ordered store: %v\n", err)
+	}
+	// The second shard is a read-only view of the same store so we can tell which shard
+	// handled a write, and a range query sees each stored key once from each shard.
+	sharded, err := storage.NewShardedOrderedKeyValueDB([]storage.OrderedKeyValueDB{db, storage.NewReadOnlyOrderedKeyValueDB(db)})
+	if err != nil {
+		t.Fatalf("can't create sharded store: %v\n", err)
+	}
+	ctx := storage.GetTestDataContext(storage.TestUUID1, "sharded", dvid.InstanceID(17))
+
+	var stored, rejected int
+	for i := 0; i < 100; i++ {
+		tk := storage.NewTKey(30, []byte(fmt.Sprintf("key%03d", i)))
+		err := sharded.Put(ctx, tk, []byte("value"))
+		switch err {
+		case nil:
+			stored++
+		case storage.ErrReadOnly:
+			rejected++
+		default:
+			t.Fatalf("unexpected error on sharded put: %v\n", err)
+		}
+		if err2 := sharded.Put(ctx, tk, []byte("value")); err2 != err {
+			t.Fatalf("key %s routed inconsistently: %v then %v\n", tk, err, err2)
+		}
+	}
+	if stored == 0 || rejected == 0 {
+		t.Fatalf("expected keys on both shards, got %d stored and %d rejected\n", stored, rejected)
+	}
+
+	kvs, err := sharded.GetRange(ctx, storage.NewTKey(30, []byte("key")), storage.NewTKey(30, []byte("key999")))
+	if err != nil {
+		t.Fatalf("error on sharded range query: %v\n", err)
+	}
+	if len(kvs) != 2*stored {
+		t.Errorf("expected %d key-values from both shards, got %d\n", 2*stored, len(kvs))
+	}
+	for i := 1; i < len(kvs); i++ {
+		if bytes.Compare(kvs[i-1].K, kvs[i].K) > 0 {
+			t.Fatalf("sharded range not in key order: %s after %s\n", kvs[i].K, kvs[i-1].K)
+		}
+	}
+}
+
+func TestTieredShardedStore(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	db, err := storage.DefaultOrderedKVDB()
+	if err != nil {
+		t.Fatalf("can't get default ordered store: %v\n", err)
+	}
+	sharded, err := storage.NewShardedOrderedKeyValueDB([]storage.OrderedKeyValueDB{db})
+	if err != nil {
+		t.Fatalf("can't create sharded store: %v\n", err)
+	}
+	// backends with both shards and tiers wrap the sharded store in a tiered store, which
+	// must be able to compare the stores it routes to.
+	tiered := storage.NewTieredOrderedKeyValueDB(sharded, map[storage.TKeyClass]storage.OrderedKeyValueDB{31: sharded})
+	ctx := storage.GetTestDataContext(storage.TestUUID1, "tieredsharded", dvid.InstanceID(20))
+
+	tk1 := storage.NewTKey(30, []byte("key1"))
+	tk2 := storage.NewTKey(31, []byte("key2"))
+	batch := tiered.(storage.KeyValueBatcher).NewBatch(ctx)
+	batch.Put(tk1, []byte("value1"))
+	batch.Put(tk2, []byte("value2"))
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("unable to commit batch to tiered sharded store: %v\n", err)
+	}
+	kvs, err := tiered.GetRange(ctx, tk1, tk2)
+	if err != nil {
+		t.Fatalf("error on range query of tiered sharded store: %v\n", err)
+	}
+	if len(kvs) != 2 {
+		t.Errorf("expected 2 key-values, got %d\n", len(kvs))
+	}
+	if err := tiered.DeleteAll(ctx, true); err != nil {
+		t.Errorf("unable to delete all from tiered sharded store: %v\n", err)
+	}
+}
+
+// labeledStore is a store wrapper whose values can't be compared.
+type labeledStore struct {
+	storage.OrderedKeyValueDB
+	labels []string
+}
+
+func TestTieredUncomparableStore(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	db, err := storage.DefaultOrderedKVDB()
+	if err != nil {
+		t.Fatalf("can't get default ordered store: %v\n", err)
+	}
+	tier := labeledStore{db, []string{"cold"}}
+	tiers := map[storage.TKeyClass]storage.OrderedKeyValueDB{30: tier, 31: tier}
+	tiered := storage.NewTieredOrderedKeyValueDB(labeledStore{db, nil}, tiers)
+	ctx := storage.GetTestDataContext(storage.TestUUID1, "tieredlabeled", dvid.InstanceID(22))
+
+	tk1 := storage.NewTKey(29, []byte("key1"))
+	tk2 := storage.NewTKey(31, []byte("key2"))
+	batch := tiered.(storage.KeyValueBatcher).NewBatch(ctx)
+	batch.Put(tk1, []byte("value1"))
+	batch.Put(tk2, []byte("value2"))
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("unable to commit batch to tiered store: %v\n", err)
+	}
+	if err := tiered.PutRange(ctx, []storage.TKeyValue{{K: tk1, V: []byte("a")}, {K: tk2, V: []byte("b")}}); err != nil {
+		t.Fatalf("unable to put range to tiered store: %v\n", err)
+	}
+	value, err := tiered.Get(ctx, tk2)
+	if err != nil || string(value) != "b" {
+		t.Errorf("expected value %q from tier, got %q (err %v)\n", "b", string(value), err)
+	}
+	if err := tiered.DeleteAll(ctx, true); err != nil {
+		t.Errorf("unable to delete all from tiered store: %v\n", err)
+	}
+}
+
+// failingStore simulates an unavailable store by failing all reads and writes.
+type failingStore struct {
+	storage.OrderedKeyValueDB
+}
+
+var errUnavailable = errors.New("store unavailable")
+
+func (db failingStore) Get(storage.Context, storage.TKey) ([]byte, error) {
+	return nil, errUnavailable
+}
+
+func (db failingStore) KeysInRange(storage.Context, storage.TKey, storage.TKey) ([]storage.TKey, error) {
+	return nil, errUnavailable
+}
+
+func (db failingStore) Put(storage.Context, storage.TKey, []byte) error {
+	return errUnavailable
+}
+
+func TestFallbackStore(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	db, err := storage.DefaultOrderedKVDB()
+	if err != nil {
+		t.Fatalf("can't get default ordered store: %v\n", err)
+	}
+	ctx := storage.GetTestDataContext(storage.TestUUID1, "fallback", dvid.InstanceID(19))
+	tk := storage.NewTKey(30, []byte("key"))
+	if err := db.Put(ctx, tk, []byte("replica")); err != nil {
+		t.Fatalf("unable to put key: %v\n", err)
+	}
+
+	store := storage.NewFallbackOrderedKeyValueDB(failingStore{db}, db)
+	value, err := store.Get(ctx, tk)
+	if err != nil {
+		t.Fatalf("expected get to use fallback: %v\n", err)
+	}
+	if string(value) != "replica" {
+		t.Errorf("expected value %q from fallback, got %q\n", "replica", string(value))
+	}
+	tks, err := store.KeysInRange(ctx, tk, tk)
+	if err != nil || len(tks) != 1 {
+		t.Errorf("expected one key from fallback range query, got %v (err %v)\n", tks, err)
+	}
+	if err := store.Put(ctx, tk, []byte("new")); err != errUnavailable {
+		t.Errorf("expected put to go only to failed primary, got %v\n", err)
+	}
+
+	primary, err := storage.GetReadTier(store, storage.PrimaryTier)
+	if err != nil {
+		t.Fatalf("unable to get primary tier: %v\n", err)
+	}
+	if _, err := primary.Get(ctx, tk); err != errUnavailable {
+		t.Errorf("expected read of primary tier not to fall back, got %v\n", err)
+	}
+	fallback, err := storage.GetReadTier(store, storage.FallbackTier)
+	if err != nil {
+		t.Fatalf("unable to get fallback tier: %v\n", err)
+	}
+	if value, err := fallback.Get(ctx, tk); err != nil || string(value) != "replica" {
+		t.Errorf("expected value %q from fallback tier, got %q (err %v)\n", "replica", value, err)
+	}
+	if _, err := storage.GetReadTier(store, "cache"); err == nil {
+		t.Errorf("expected error reading unknown tier\n")
+	}
+	if _, err := storage.GetReadTier(db, storage.FallbackTier); err == nil {
+		t.Errorf("expected error reading fallback tier of store without fallback\n")
+	}
+}
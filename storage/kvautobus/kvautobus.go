@@ -117,10 +117,16 @@ func (e Engine) NewStore(config dvid.StoreConfig) (dvid.Store, bool, error) {
 	if err != nil {
 		return nil, false, err
 	}
+	pool, err := storage.ParsePoolConfig(config)
+	if err != nil {
+		return nil, false, err
+	}
+	transport := storage.NewPooledTransport(fmt.Sprintf("KVAutobus @ %s (collection %s)", path, collection), pool)
 	kv := &KVAutobus{
 		host:       path,
 		config:     config,
-		client:     http.Client{Timeout: timeout},
+		client:     http.Client{Timeout: timeout, Transport: transport},
+		transport:  transport,
 		owner:      owner,
 		collection: collection,
 	}
@@ -151,6 +157,9 @@ type KVAutobus struct {
 	// http client for KVAutobus service
 	client http.Client
 
+	// pooled connections used by client
+	transport *storage.PooledTransport
+
 	// owner id for billing
 	owner string
 
@@ -210,7 +219,7 @@ func (db *KVAutobus) String() string {
 }
 
 func (db *KVAutobus) Close() {
-	// no op
+	db.transport.Close()
 }
 
 func (db *KVAutobus) Equal(c dvid.StoreConfig) bool {
@@ -825,6 +834,7 @@ type goBatch struct {
 	ctx  storage.Context
 	vctx storage.VersionedCtx
 	kvs  []storage.KeyValue
+	storage.BatchStatsTracker
 }
 
 // NewBatch returns an implementation that allows batch writes
@@ -839,7 +849,7 @@ func (db *KVAutobus) NewBatch(ctx storage.Context) storage.Batch {
 	if !ok {
 		vctx = nil
 	}
-	return &goBatch{db, ctx, vctx, []storage.KeyValue{}}
+	return &goBatch{db, ctx, vctx, []storage.KeyValue{}, storage.BatchStatsTracker{}}
 }
 
 // --- Batch interface ---
@@ -855,8 +865,12 @@ func (batch *goBatch) Put(tk storage.TKey, v []byte) {
 	}
 	key := batch.ctx.ConstructKey(tk)
 	batch.kvs = append(batch.kvs, storage.KeyValue{key, v})
+	batch.TrackPut(tk, v)
 }
 
 func (batch *goBatch) Commit() error {
-	return batch.db.putRange(batch.kvs)
+	t0 := time.Now()
+	err := batch.db.putRange(batch.kvs)
+	batch.TrackCommit(t0)
+	return err
 }
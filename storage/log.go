@@ -25,6 +25,38 @@ type WriteLog interface {
 	TopicClose(topic string) error
 }
 
+// TopicDrainer is a WriteLog whose topics can be read and emptied, e.g., to replay
+// failed kafka messages.
+type TopicDrainer interface {
+	// TopicDrain returns all messages appended to a topic and removes them from the log.
+	TopicDrain(topic string) ([]LogMessage, error)
+}
+
+// TopicStats gives the number of messages stored in a topic and the bytes of their data.
+type TopicStats struct {
+	Messages uint64
+	Bytes    uint64
+}
+
+// TopicCounter is a WriteLog whose topics can be listed and counted without removing their
+// messages, e.g., to monitor the backlog of failed kafka messages.
+type TopicCounter interface {
+	// TopicsWithPrefix returns the names of stored topics that begin with the given prefix.
+	TopicsWithPrefix(prefix string) ([]string, error)
+
+	// TopicStats returns the number and bytes of messages stored in a topic.
+	TopicStats(topic string) (TopicStats, error)
+}
+
+// TopicTrimmer is a WriteLog whose topics can be trimmed in place, e.g., to enforce the
+// retention of failed kafka messages.
+type TopicTrimmer interface {
+	// TopicTrim replaces the messages of a topic with those returned by keep, which is given
+	// all messages of the topic in the order they were appended.  Appends to the topic are
+	// held off until done.
+	TopicTrim(topic string, keep func([]LogMessage) []LogMessage) error
+}
+
 type ReadLog interface {
 	dvid.Store
 	ReadBinary(dataID, version dvid.UUID) ([]byte, error)
@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// DefaultPoolSize is the default number of idle connections kept per host for
+// network-backed stores.
+const DefaultPoolSize = 16
+
+// PoolConfig specifies connection pooling for network-backed stores and is set via
+// the store configuration:
+//
+//	pool_size = 32           # max idle connections kept per host
+//	pool_idle_timeout = 90   # seconds an idle connection is kept, 0 for no limit
+//	pool_max_lifetime = 600  # seconds before idle connections are recycled, 0 for no limit
+type PoolConfig struct {
+	Size        int
+	IdleTimeout time.Duration
+	MaxLifetime time.Duration
+}
+
+// ParsePoolConfig returns the connection pool configuration from a store configuration.
+func ParsePoolConfig(config dvid.StoreConfig) (pc PoolConfig, err error) {
+	pc.Size = DefaultPoolSize
+	c := config.GetAll()
+	getInt := func(key string) (int64, bool, error) {
+		v, found := c[key]
+		if !found {
+			return 0, false, nil
+		}
+		i, ok := v.(int64)
+		if !ok {
+			return 0, true, fmt.Errorf("%q setting must be an int64, not %s (%v)", key, reflect.TypeOf(v), v)
+		}
+		if i < 0 {
+			return 0, true, fmt.Errorf("%q setting must be non-negative, not %d", key, i)
+		}
+		return i, true, nil
+	}
+	size, found, err := getInt("pool_size")
+	if err != nil {
+		return
+	}
+	if found && size != 0 {
+		pc.Size = int(size)
+	}
+	secs, _, err := getInt("pool_idle_timeout")
+	if err != nil {
+		return
+	}
+	pc.IdleTimeout = time.Duration(secs) * time.Second
+	secs, _, err = getInt("pool_max_lifetime")
+	if err != nil {
+		return
+	}
+	pc.MaxLifetime = time.Duration(secs) * time.Second
+	return
+}
+
+// PoolStats gives connection pool statistics for a network-backed store.
+type PoolStats struct {
+	Requests    uint64 // # of requests
+	NewConns    uint64 // # of connections dialed
+	ReusedConns uint64 // # of requests that reused a pooled connection
+	OpenConns   int64  // # of currently open connections
+	Recycles    uint64 // # of times idle connections were recycled due to max lifetime
+}
+
+// PooledTransport is an http.RoundTripper that reuses connections per its PoolConfig
+// and tracks PoolStats.
+type PooledTransport struct {
+	name      string
+	config    PoolConfig
+	transport *http.Transport
+	stats     PoolStats
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+var (
+	poolsMu sync.RWMutex
+	pools   = make(map[string]*PooledTransport)
+)
+
+// NewPooledTransport returns a transport for a store that will be reported under the
+// given name in GetPoolStats().  The transport should be closed when the store is closed.
+func NewPooledTransport(name string, pc PoolConfig) *PooledTransport {
+	t := &PooledTransport{
+		name:   name,
+		config: pc,
+		done:   make(chan struct{}),
+	}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	t.transport = &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		Dial: func(network, addr string) (net.Conn, error) {
+			conn, err := dialer.Dial(network, addr)
+			if err != nil {
+				return nil, err
+			}
+			atomic.AddUint64(&t.stats.NewConns, 1)
+			atomic.AddInt64(&t.stats.OpenConns, 1)
+			return &countedConn{Conn: conn, open: &t.stats.OpenConns}, nil
+		},
+		MaxIdleConns:        pc.Size,
+		MaxIdleConnsPerHost: pc.Size,
+		IdleConnTimeout:     pc.IdleTimeout,
+	}
+	if pc.MaxLifetime != 0 {
+		go t.recycle()
+	}
+
+	poolsMu.Lock()
+	pools[name] = t
+	poolsMu.Unlock()
+	return t
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *PooledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddUint64(&t.stats.Requests, 1)
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddUint64(&t.stats.ReusedConns, 1)
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	return t.transport.RoundTrip(req)
+}
+
+// Stats returns the current connection pool statistics.
+func (t *PooledTransport) Stats() PoolStats {
+	return PoolStats{
+		Requests:    atomic.LoadUint64(&t.stats.Requests),
+		NewConns:    atomic.LoadUint64(&t.stats.NewConns),
+		ReusedConns: atomic.LoadUint64(&t.stats.ReusedConns),
+		OpenConns:   atomic.LoadInt64(&t.stats.OpenConns),
+		Recycles:    atomic.LoadUint64(&t.stats.Recycles),
+	}
+}
+
+// Close closes idle connections and stops reporting stats for this transport.
+func (t *PooledTransport) Close() {
+	t.closeOnce.Do(func() {
+		close(t.done)
+		t.transport.CloseIdleConnections()
+		poolsMu.Lock()
+		if pools[t.name] == t {
+			delete(pools, t.name)
+		}
+		poolsMu.Unlock()
+	})
+}
+
+// recycle periodically closes idle connections so no connection is reused much
+// beyond the max lifetime, e.g., to pick up DNS changes behind load balancers.
+func (t *PooledTransport) recycle() {
+	ticker := time.NewTicker(t.config.MaxLifetime)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			t.transport.CloseIdleConnections()
+			atomic.AddUint64(&t.stats.Recycles, 1)
+		}
+	}
+}
+
+// countedConn decrements the count of open connections on close.
+type countedConn struct {
+	net.Conn
+	open   *int64
+	closed int32
+}
+
+func (c *countedConn) Close() error {
+	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		atomic.AddInt64(c.open, -1)
+	}
+	return c.Conn.Close()
+}
+
+// GetPoolStats returns the connection pool statistics for all network-backed stores
+// keyed by store name.
+func GetPoolStats() map[string]PoolStats {
+	poolsMu.RLock()
+	defer poolsMu.RUnlock()
+	stats := make(map[string]PoolStats, len(pools))
+	for name, t := range pools {
+		stats[name] = t.Stats()
+	}
+	return stats
+}
@@ -0,0 +1,46 @@
+package storage_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+func TestPooledTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "ok")
+	}))
+	defer ts.Close()
+
+	var config dvid.StoreConfig
+	config.Config = dvid.NewConfig()
+	config.Set("pool_size", int64(4))
+	pc, err := storage.ParsePoolConfig(config)
+	if err != nil {
+		t.Fatalf("unable to parse pool config: %v\n", err)
+	}
+	if pc.Size != 4 {
+		t.Errorf("expected pool size 4, got %d\n", pc.Size)
+	}
+
+	transport := storage.NewPooledTransport("test pool", pc)
+	defer transport.Close()
+	client := http.Client{Transport: transport}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatalf("request %d failed: %v\n", i, err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	stats := storage.GetPoolStats()["test pool"]
+	if stats.Requests != 3 || stats.NewConns != 1 || stats.ReusedConns != 2 {
+		t.Errorf("expected 3 requests over 1 reused connection, got %+v\n", stats)
+	}
+}
@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrQuotaExceeded is returned by any write operation that would exceed a store's quota.
+var ErrQuotaExceeded = errors.New("write quota exceeded")
+
+// QuotaReserver accounts for bytes written against a quota.
+type QuotaReserver interface {
+	// Reserve records the given number of bytes as written or returns ErrQuotaExceeded
+	// without recording if the write would exceed the quota.
+	Reserve(bytes uint64) error
+}
+
+// NewQuotaKeyValueDB returns a KeyValueDB where puts are rejected with ErrQuotaExceeded
+// once the bytes written exceed the quota.
+func NewQuotaKeyValueDB(db KeyValueDB, q QuotaReserver) KeyValueDB {
+	return quotaKeyValueDB{db, q}
+}
+
+// NewQuotaOrderedKeyValueDB returns an OrderedKeyValueDB where puts and batch commits
+// are rejected with ErrQuotaExceeded once the bytes written exceed the quota.
+func NewQuotaOrderedKeyValueDB(db OrderedKeyValueDB, q QuotaReserver) OrderedKeyValueDB {
+	return quotaOrderedKeyValueDB{db, q}
+}
+
+// NewQuotaBatcher returns a KeyValueBatcher whose batch commits are rejected with
+// ErrQuotaExceeded once the bytes written exceed the quota.
+func NewQuotaBatcher(db KeyValueBatcher, q QuotaReserver) KeyValueBatcher {
+	return quotaBatcher{db, q}
+}
+
+type quotaKeyValueDB struct {
+	KeyValueDB
+	quota QuotaReserver
+}
+
+func (db quotaKeyValueDB) Put(ctx Context, tk TKey, v []byte) error {
+	if err := db.quota.Reserve(uint64(len(tk) + len(v))); err != nil {
+		return err
+	}
+	return db.KeyValueDB.Put(ctx, tk, v)
+}
+
+func (db quotaKeyValueDB) RawPut(k Key, v []byte) error {
+	if err := db.quota.Reserve(uint64(len(k) + len(v))); err != nil {
+		return err
+	}
+	return db.KeyValueDB.RawPut(k, v)
+}
+
+func (db quotaKeyValueDB) NewBatch(ctx Context) Batch {
+	batcher, ok := db.KeyValueDB.(KeyValueBatcher)
+	if !ok {
+		return errBatch{fmt.Errorf("store %s is not able to batch key-value ops", db.KeyValueDB)}
+	}
+	return newQuotaBatch(batcher.NewBatch(ctx), db.quota)
+}
+
+type quotaOrderedKeyValueDB struct {
+	OrderedKeyValueDB
+	quota QuotaReserver
+}
+
+func (db quotaOrderedKeyValueDB) Put(ctx Context, tk TKey, v []byte) error {
+	if err := db.quota.Reserve(uint64(len(tk) + len(v))); err != nil {
+		return err
+	}
+	return db.OrderedKeyValueDB.Put(ctx, tk, v)
+}
+
+func (db quotaOrderedKeyValueDB) RawPut(k Key, v []byte) error {
+	if err := db.quota.Reserve(uint64(len(k) + len(v))); err != nil {
+		return err
+	}
+	return db.OrderedKeyValueDB.RawPut(k, v)
+}
+
+func (db quotaOrderedKeyValueDB) PutRange(ctx Context, kvs []TKeyValue) error {
+	var size int
+	for _, kv := range kvs {
+		size += len(kv.K) + len(kv.V)
+	}
+	if err := db.quota.Reserve(uint64(size)); err != nil {
+		return err
+	}
+	return db.OrderedKeyValueDB.PutRange(ctx, kvs)
+}
+
+func (db quotaOrderedKeyValueDB) NewBatch(ctx Context) Batch {
+	batcher, ok := db.OrderedKeyValueDB.(KeyValueBatcher)
+	if !ok {
+		return errBatch{fmt.Errorf("store %s is not able to batch key-value ops", db.OrderedKeyValueDB)}
+	}
+	return newQuotaBatch(batcher.NewBatch(ctx), db.quota)
+}
+
+type quotaBatcher struct {
+	KeyValueBatcher
+	quota QuotaReserver
+}
+
+func (b quotaBatcher) NewBatch(ctx Context) Batch {
+	return newQuotaBatch(b.KeyValueBatcher.NewBatch(ctx), b.quota)
+}
+
+// newQuotaBatch returns a batch reserving the bytes of its puts on commit, which keeps
+// support for multiple contexts if the given batch has it.
+func newQuotaBatch(b Batch, quota QuotaReserver) Batch {
+	qb := &quotaBatch{Batch: b, quota: quota}
+	if _, ok := b.(MultiContextBatch); ok {
+		return quotaMultiContextBatch{qb}
+	}
+	return qb
+}
+
+// quotaBatch reserves the bytes of all puts on commit.
+type quotaBatch struct {
+	Batch
+	quota QuotaReserver
+	bytes uint64
+}
+
+// quotaMultiContextBatch is a quotaBatch whose operations can use different contexts.
+type quotaMultiContextBatch struct {
+	*quotaBatch
+}
+
+func (b quotaMultiContextBatch) SetContext(ctx Context) {
+	b.quotaBatch.Batch.(MultiContextBatch).SetContext(ctx)
+}
+
+func (b *quotaBatch) Put(tk TKey, v []byte) {
+	b.bytes += uint64(len(tk) + len(v))
+	b.Batch.Put(tk, v)
+}
+
+func (b *quotaBatch) Commit() error {
+	if err := b.quota.Reserve(b.bytes); err != nil {
+		return err
+	}
+	return b.Batch.Commit()
+}
+
+// Unmetered returns a store whose writes aren't charged to any quota of the given store,
+// for internal bookkeeping like timestamps, tombstones, and index entries that shouldn't
+// count as bytes written by users.
+func Unmetered(db OrderedKeyValueDB) OrderedKeyValueDB {
+	if q, ok := db.(quotaOrderedKeyValueDB); ok {
+		return q.OrderedKeyValueDB
+	}
+	return db
+}
+
+// PutUnmetered adds a put of internal bookkeeping to a batch without charging it to any
+// quota of the batch, as with Unmetered stores.
+func PutUnmetered(b Batch, tk TKey, v []byte) {
+	switch q := b.(type) {
+	case *quotaBatch:
+		q.Batch.Put(tk, v)
+	case quotaMultiContextBatch:
+		q.Batch.Put(tk, v)
+	default:
+		b.Put(tk, v)
+	}
+}
+
+// ChargedBatch returns a batch that adds operations to the given batch, which may be
+// shared with other stores, and a function that reserves the bytes put through it from
+// any quota of the given store.  The function should be called before the shared batch
+// is committed.
+func ChargedBatch(db OrderedKeyValueDB, b Batch) (Batch, func() error) {
+	q, ok := db.(quotaOrderedKeyValueDB)
+	if !ok {
+		return b, func() error { return nil }
+	}
+	qb := &quotaBatch{Batch: b, quota: q.quota}
+	return qb, func() error { return q.quota.Reserve(qb.bytes) }
+}
+
+// errBatch discards any operations and returns an error on commit.
+type errBatch struct {
+	err error
+}
+
+func (b errBatch) Delete(TKey)          {}
+func (b errBatch) Put(k TKey, v []byte) {}
+func (b errBatch) Commit() error        { return b.err }
+func (b errBatch) Stats() BatchStats    { return BatchStats{} }
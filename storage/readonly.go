@@ -0,0 +1,73 @@
+package storage
+
+import "errors"
+
+// ErrReadOnly is returned by any write operation on a read-only store.
+var ErrReadOnly = errors.New("data is read-only and cannot be modified")
+
+// NewReadOnlyKeyValueDB returns a KeyValueDB where all KeyValueSetter operations
+// return ErrReadOnly without reaching the underlying store.
+func NewReadOnlyKeyValueDB(db KeyValueDB) KeyValueDB {
+	return readOnlyKeyValueDB{db}
+}
+
+// NewReadOnlyOrderedKeyValueDB returns an OrderedKeyValueDB where all setter and batch
+// operations return ErrReadOnly without reaching the underlying store.
+func NewReadOnlyOrderedKeyValueDB(db OrderedKeyValueDB) OrderedKeyValueDB {
+	return readOnlyOrderedKeyValueDB{db}
+}
+
+type readOnlyKeyValueDB struct {
+	KeyValueDB
+}
+
+func (db readOnlyKeyValueDB) String() string {
+	return "read-only " + db.KeyValueDB.String()
+}
+
+func (db readOnlyKeyValueDB) Put(Context, TKey, []byte) error { return ErrReadOnly }
+func (db readOnlyKeyValueDB) Delete(Context, TKey) error      { return ErrReadOnly }
+func (db readOnlyKeyValueDB) RawPut(Key, []byte) error        { return ErrReadOnly }
+func (db readOnlyKeyValueDB) RawDelete(Key) error             { return ErrReadOnly }
+
+func (db readOnlyKeyValueDB) NewBatch(ctx Context) Batch {
+	return readOnlyBatch{}
+}
+
+type readOnlyOrderedKeyValueDB struct {
+	OrderedKeyValueDB
+}
+
+func (db readOnlyOrderedKeyValueDB) String() string {
+	return "read-only " + db.OrderedKeyValueDB.String()
+}
+
+func (db readOnlyOrderedKeyValueDB) Put(Context, TKey, []byte) error       { return ErrReadOnly }
+func (db readOnlyOrderedKeyValueDB) Delete(Context, TKey) error            { return ErrReadOnly }
+func (db readOnlyOrderedKeyValueDB) RawPut(Key, []byte) error              { return ErrReadOnly }
+func (db readOnlyOrderedKeyValueDB) RawDelete(Key) error                   { return ErrReadOnly }
+func (db readOnlyOrderedKeyValueDB) PutRange(Context, []TKeyValue) error   { return ErrReadOnly }
+func (db readOnlyOrderedKeyValueDB) DeleteRange(Context, TKey, TKey) error { return ErrReadOnly }
+func (db readOnlyOrderedKeyValueDB) DeleteAll(Context, bool) error         { return ErrReadOnly }
+func (db readOnlyOrderedKeyValueDB) DeleteTKeyClass(Context, TKeyClass, bool) error {
+	return ErrReadOnly
+}
+
+func (db readOnlyOrderedKeyValueDB) NewBatch(ctx Context) Batch {
+	return readOnlyBatch{}
+}
+
+// ReadOnlyBatcher is a KeyValueBatcher whose batches always fail to commit.
+type ReadOnlyBatcher struct{}
+
+func (b ReadOnlyBatcher) NewBatch(ctx Context) Batch {
+	return readOnlyBatch{}
+}
+
+// readOnlyBatch discards any operations and fails on commit.
+type readOnlyBatch struct{}
+
+func (b readOnlyBatch) Delete(TKey)          {}
+func (b readOnlyBatch) Put(k TKey, v []byte) {}
+func (b readOnlyBatch) Commit() error        { return ErrReadOnly }
+func (b readOnlyBatch) Stats() BatchStats    { return BatchStats{} }
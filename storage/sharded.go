@@ -0,0 +1,407 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// ShardReplicas is the number of points each shard occupies on the consistent hash ring.
+const ShardReplicas = 64
+
+// errShardMergeStopped is returned by a shard's range function when the merge of shard
+// results has terminated early.
+var errShardMergeStopped = errors.New("sharded range merge stopped")
+
+// NewShardedOrderedKeyValueDB returns an OrderedKeyValueDB that distributes type-specific
+// keys across the given stores using a consistent hash of each key, so all versions of a
+// key reside on the same shard.  Point operations touch a single shard, but range queries
+// and range deletes must fan out to every shard, with results merged in key order.  Range
+// scans therefore get slower as shards are added.  Since shards are placed on the hash
+// ring by their position, new shards should only be appended so existing keys stay put.
+// Batches that span shards are committed per shard and are not atomic.
+func NewShardedOrderedKeyValueDB(shards []OrderedKeyValueDB) (OrderedKeyValueDB, error) {
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("sharded store requires at least one shard")
+	}
+	db := &shardedOrderedStore{shards: shards}
+	for i := range shards {
+		for r := 0; r < ShardReplicas; r++ {
+			point := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + "-" + strconv.Itoa(r)))
+			db.ring = append(db.ring, ringPoint{point, i})
+		}
+	}
+	sort.Sort(db.ring)
+	return db, nil
+}
+
+type ringPoint struct {
+	hash  uint32
+	shard int
+}
+
+type hashRing []ringPoint
+
+func (r hashRing) Len() int           { return len(r) }
+func (r hashRing) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r hashRing) Less(i, j int) bool { return r[i].hash < r[j].hash }
+
+type shardedOrderedStore struct {
+	shards []OrderedKeyValueDB
+	ring   hashRing
+}
+
+func (db shardedOrderedStore) String() string {
+	return fmt.Sprintf("sharded store over %d stores starting with %s", len(db.shards), db.shards[0])
+}
+
+// Equal returns true if any shard matches the given store configuration.
+func (db shardedOrderedStore) Equal(config dvid.StoreConfig) bool {
+	for _, store := range db.shards {
+		if store.Equal(config) {
+			return true
+		}
+	}
+	return false
+}
+
+// shardForTKey returns the index of the shard holding the given type-specific key.
+func (db shardedOrderedStore) shardForTKey(tk TKey) (int, error) {
+	if len(tk) == 0 {
+		return 0, fmt.Errorf("can't determine shard for empty key")
+	}
+	h := crc32.ChecksumIEEE(tk)
+	i := sort.Search(len(db.ring), func(i int) bool { return db.ring[i].hash >= h })
+	if i == len(db.ring) {
+		i = 0
+	}
+	return db.ring[i].shard, nil
+}
+
+// storeForTKey returns the shard holding the given type-specific key.
+func (db shardedOrderedStore) storeForTKey(tk TKey) (OrderedKeyValueDB, error) {
+	i, err := db.shardForTKey(tk)
+	if err != nil {
+		return nil, err
+	}
+	return db.shards[i], nil
+}
+
+// storeForKey returns the shard holding the given full key.
+func (db shardedOrderedStore) storeForKey(k Key) (OrderedKeyValueDB, error) {
+	tk, err := TKeyFromKey(k)
+	if err != nil {
+		return nil, err
+	}
+	return db.storeForTKey(tk)
+}
+
+// shardItem is one result of a shard's range query with the key used for ordering.
+type shardItem struct {
+	key   []byte
+	kv    *KeyValue
+	tkv   *TKeyValue
+	chunk *Chunk
+}
+
+// shardRangeFunc runs a range query on one shard, calling send for each result in key
+// order.  If send returns false, the merge has stopped and no more results are needed.
+type shardRangeFunc func(store OrderedKeyValueDB, done <-chan struct{}, send func(shardItem) bool) error
+
+// mergeShards runs a range query concurrently on all shards and calls f on the results
+// in ascending key order.  If f returns an error, the merge stops and the error is returned.
+func (db shardedOrderedStore) mergeShards(run shardRangeFunc, f func(shardItem) error) error {
+	done := make(chan struct{})
+	chs := make([]chan shardItem, len(db.shards))
+	errs := make([]error, len(db.shards))
+	wg := new(sync.WaitGroup)
+	for i, store := range db.shards {
+		chs[i] = make(chan shardItem, 100)
+		wg.Add(1)
+		go func(i int, store OrderedKeyValueDB) {
+			defer wg.Done()
+			send := func(item shardItem) bool {
+				select {
+				case chs[i] <- item:
+					return true
+				case <-done:
+					return false
+				}
+			}
+			errs[i] = run(store, done, send)
+			close(chs[i])
+		}(i, store)
+	}
+
+	heads := make([]*shardItem, len(db.shards))
+	for i, ch := range chs {
+		if item, ok := <-ch; ok {
+			heads[i] = &item
+		}
+	}
+	var err error
+	for {
+		next := -1
+		for i, head := range heads {
+			if head != nil && (next < 0 || bytes.Compare(head.key, heads[next].key) < 0) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		if err = f(*heads[next]); err != nil {
+			break
+		}
+		if item, ok := <-chs[next]; ok {
+			heads[next] = &item
+		} else {
+			heads[next] = nil
+		}
+	}
+	close(done)
+	for _, ch := range chs {
+		go func(ch chan shardItem) {
+			for range ch {
+			}
+		}(ch)
+	}
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	for _, shardErr := range errs {
+		if shardErr != nil {
+			return shardErr
+		}
+	}
+	return nil
+}
+
+func (db shardedOrderedStore) Get(ctx Context, tk TKey) ([]byte, error) {
+	store, err := db.storeForTKey(tk)
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(ctx, tk)
+}
+
+func (db shardedOrderedStore) GetRange(ctx Context, kStart, kEnd TKey) ([]*TKeyValue, error) {
+	var kvs []*TKeyValue
+	run := func(store OrderedKeyValueDB, done <-chan struct{}, send func(shardItem) bool) error {
+		shardKVs, err := store.GetRange(ctx, kStart, kEnd)
+		if err != nil {
+			return err
+		}
+		for _, kv := range shardKVs {
+			if !send(shardItem{key: kv.K, tkv: kv}) {
+				break
+			}
+		}
+		return nil
+	}
+	err := db.mergeShards(run, func(item shardItem) error {
+		kvs = append(kvs, item.tkv)
+		return nil
+	})
+	return kvs, err
+}
+
+func (db shardedOrderedStore) KeysInRange(ctx Context, kStart, kEnd TKey) ([]TKey, error) {
+	var tks []TKey
+	run := func(store OrderedKeyValueDB, done <-chan struct{}, send func(shardItem) bool) error {
+		shardTKs, err := store.KeysInRange(ctx, kStart, kEnd)
+		if err != nil {
+			return err
+		}
+		for _, tk := range shardTKs {
+			if !send(shardItem{key: tk}) {
+				break
+			}
+		}
+		return nil
+	}
+	err := db.mergeShards(run, func(item shardItem) error {
+		tks = append(tks, TKey(item.key))
+		return nil
+	})
+	return tks, err
+}
+
+func (db shardedOrderedStore) SendKeysInRange(ctx Context, kStart, kEnd TKey, ch KeyChan) error {
+	run := func(store OrderedKeyValueDB, done <-chan struct{}, send func(shardItem) bool) error {
+		shardCh := make(KeyChan, 100)
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- store.SendKeysInRange(ctx, kStart, kEnd, shardCh)
+			close(shardCh)
+		}()
+		stopped := false
+		for k := range shardCh {
+			if k == nil || stopped {
+				continue
+			}
+			stopped = !send(shardItem{key: k})
+		}
+		return <-errCh
+	}
+	err := db.mergeShards(run, func(item shardItem) error {
+		ch <- Key(item.key)
+		return nil
+	})
+	ch <- nil
+	return err
+}
+
+func (db shardedOrderedStore) ProcessRange(ctx Context, kStart, kEnd TKey, op *ChunkOp, f ChunkFunc) error {
+	run := func(store OrderedKeyValueDB, done <-chan struct{}, send func(shardItem) bool) error {
+		err := store.ProcessRange(ctx, kStart, kEnd, op, func(c *Chunk) error {
+			if !send(shardItem{key: c.K, chunk: c}) {
+				return errShardMergeStopped
+			}
+			return nil
+		})
+		if err == errShardMergeStopped {
+			return nil
+		}
+		return err
+	}
+	return db.mergeShards(run, func(item shardItem) error {
+		return f(item.chunk)
+	})
+}
+
+// RawRangeQuery queries a range of full keys across all shards, merging results in key order.
+func (db shardedOrderedStore) RawRangeQuery(kStart, kEnd Key, keysOnly bool, out chan *KeyValue, cancel <-chan struct{}) error {
+	run := func(store OrderedKeyValueDB, done <-chan struct{}, send func(shardItem) bool) error {
+		shardCh := make(chan *KeyValue, 100)
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- store.RawRangeQuery(kStart, kEnd, keysOnly, shardCh, done)
+			close(shardCh)
+		}()
+		stopped := false
+		for kv := range shardCh {
+			if kv == nil || stopped {
+				continue
+			}
+			stopped = !send(shardItem{key: kv.K, kv: kv})
+		}
+		return <-errCh
+	}
+	var cancelled bool
+	err := db.mergeShards(run, func(item shardItem) error {
+		select {
+		case out <- item.kv:
+			return nil
+		case <-cancel:
+			cancelled = true
+			return errShardMergeStopped
+		}
+	})
+	if cancelled {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	out <- nil
+	return nil
+}
+
+func (db shardedOrderedStore) Put(ctx Context, tk TKey, v []byte) error {
+	store, err := db.storeForTKey(tk)
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, tk, v)
+}
+
+func (db shardedOrderedStore) Delete(ctx Context, tk TKey) error {
+	store, err := db.storeForTKey(tk)
+	if err != nil {
+		return err
+	}
+	return store.Delete(ctx, tk)
+}
+
+func (db shardedOrderedStore) RawPut(k Key, v []byte) error {
+	store, err := db.storeForKey(k)
+	if err != nil {
+		return err
+	}
+	return store.RawPut(k, v)
+}
+
+func (db shardedOrderedStore) RawDelete(k Key) error {
+	store, err := db.storeForKey(k)
+	if err != nil {
+		return err
+	}
+	return store.RawDelete(k)
+}
+
+func (db shardedOrderedStore) PutRange(ctx Context, kvs []TKeyValue) error {
+	perShard := make([][]TKeyValue, len(db.shards))
+	for _, kv := range kvs {
+		i, err := db.shardForTKey(kv.K)
+		if err != nil {
+			return err
+		}
+		perShard[i] = append(perShard[i], kv)
+	}
+	for i, store := range db.shards {
+		if len(perShard[i]) != 0 {
+			if err := store.PutRange(ctx, perShard[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (db shardedOrderedStore) DeleteRange(ctx Context, kStart, kEnd TKey) error {
+	for _, store := range db.shards {
+		if err := store.DeleteRange(ctx, kStart, kEnd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db shardedOrderedStore) DeleteAll(ctx Context, allVersions bool) error {
+	for _, store := range db.shards {
+		if err := store.DeleteAll(ctx, allVersions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db shardedOrderedStore) DeleteTKeyClass(ctx Context, tkc TKeyClass, allVersions bool) error {
+	for _, store := range db.shards {
+		deleter, ok := store.(TKeyClassDeleter)
+		if !ok {
+			return fmt.Errorf("store %s does not support deletion of a key class", store)
+		}
+		if err := deleter.DeleteTKeyClass(ctx, tkc, allVersions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close is a no-op since the shards are closed by the storage manager.
+func (db shardedOrderedStore) Close() {}
+
+// NewBatch returns a batch that routes operations to a batch for each shard.
+// If any shard doesn't support batching, the returned batch fails on commit.
+func (db shardedOrderedStore) NewBatch(ctx Context) Batch {
+	return newRoutedBatch(ctx, db.shards, db.shardForTKey)
+}
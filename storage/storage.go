@@ -27,9 +27,15 @@ type Backend struct {
 	Stores      map[Alias]dvid.StoreConfig
 	KVStore     DataMap
 	LogStore    DataMap
+	KVTiers     map[dvid.DataSpecifier]TierMap
+	KVShards    map[dvid.DataSpecifier][]Alias
+	KVFallback  DataMap
 	Groupcache  GroupcacheConfig
 }
 
+// TierMap routes classes of type-specific keys to stores other than the assigned store.
+type TierMap map[TKeyClass]Alias
+
 // StoreConfig returns a data specifier's assigned store configuration.
 // The DataSpecifier can be "default" or "metadata" as well as datatype names
 // and data instance specifications.
@@ -58,6 +64,21 @@ type Requirements struct {
 	GraphDB    bool
 }
 
+// Check returns an error if the store doesn't implement the batching or graph interfaces
+// required.
+func (r *Requirements) Check(store dvid.Store) error {
+	if r == nil {
+		return nil
+	}
+	if _, ok := store.(KeyValueBatcher); r.Batcher && !ok {
+		return fmt.Errorf("store %s is not able to batch key-value ops", store)
+	}
+	if _, ok := store.(GraphDB); r.GraphDB && !ok {
+		return fmt.Errorf("store %s is not a graph store", store)
+	}
+	return nil
+}
+
 // Engine is a storage engine that can create a storage instance, dvid.Store, which could be
 // a database directory in the case of an embedded database Engine implementation.
 // Engine implementations can fulfill a variety of interfaces, checkable by runtime cast checks,
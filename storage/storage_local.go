@@ -28,6 +28,15 @@ type managerT struct {
 	instanceLog map[dvid.DataSpecifier]dvid.Store
 	datatypeLog map[dvid.TypeString]dvid.Store
 
+	instanceTiers map[dvid.DataSpecifier]map[TKeyClass]OrderedKeyValueDB
+	datatypeTiers map[dvid.TypeString]map[TKeyClass]OrderedKeyValueDB
+
+	instanceShards map[dvid.DataSpecifier][]OrderedKeyValueDB
+	datatypeShards map[dvid.TypeString][]OrderedKeyValueDB
+
+	instanceFallback map[dvid.DataSpecifier]OrderedKeyValueDB
+	datatypeFallback map[dvid.TypeString]OrderedKeyValueDB
+
 	// Cached type-asserted interfaces
 	graphEngine Engine
 	graphDB     GraphDB
@@ -146,6 +155,43 @@ func GetAssignedStore(dataname dvid.InstanceName, root dvid.UUID, tags map[strin
 		}
 	}
 
+	// See if keys are sharded across other stores or some key classes are routed to other stores.
+	var shards []OrderedKeyValueDB
+	var tiers map[TKeyClass]OrderedKeyValueDB
+	var fallback OrderedKeyValueDB
+	if found {
+		shards = manager.instanceShards[dataid]
+		tiers = manager.instanceTiers[dataid]
+		fallback = manager.instanceFallback[dataid]
+	} else {
+		shards = manager.datatypeShards[typename]
+		tiers = manager.datatypeTiers[typename]
+		fallback = manager.datatypeFallback[typename]
+	}
+	if len(shards) != 0 {
+		okvstore, ok := store.(OrderedKeyValueDB)
+		if !ok {
+			return nil, fmt.Errorf("can't shard store %s for data %q: not an ordered key-value store", store, dataname)
+		}
+		if store, err = NewShardedOrderedKeyValueDB(append([]OrderedKeyValueDB{okvstore}, shards...)); err != nil {
+			return nil, err
+		}
+	}
+	if len(tiers) != 0 {
+		okvstore, ok := store.(OrderedKeyValueDB)
+		if !ok {
+			return nil, fmt.Errorf("can't tier store %s for data %q: not an ordered key-value store", store, dataname)
+		}
+		store = NewTieredOrderedKeyValueDB(okvstore, tiers)
+	}
+	if fallback != nil {
+		okvstore, ok := store.(OrderedKeyValueDB)
+		if !ok {
+			return nil, fmt.Errorf("can't add read fallback to store %s for data %q: not an ordered key-value store", store, dataname)
+		}
+		store = NewFallbackOrderedKeyValueDB(okvstore, fallback)
+	}
+
 	// See if this is using caching and if so, establish a wrapper around it.
 	if _, supported := manager.gcache.supported[dataid]; supported {
 		store, err = wrapGroupcache(store, manager.gcache.cache)
@@ -213,9 +259,52 @@ func assignedLogByType(typename dvid.TypeString) (dvid.Store, error) {
 	return store, nil
 }
 
+// getTierStores returns the ordered key-value stores for a data specification's key class tiers.
+func getTierStores(dataspec dvid.DataSpecifier, tierMap TierMap) (map[TKeyClass]OrderedKeyValueDB, error) {
+	if len(tierMap) == 0 {
+		return nil, nil
+	}
+	tiers := make(map[TKeyClass]OrderedKeyValueDB, len(tierMap))
+	for class, alias := range tierMap {
+		store, found := manager.stores[alias]
+		if !found {
+			return nil, fmt.Errorf("bad backend tier store alias for %s key class %d: %q", dataspec, class, alias)
+		}
+		okvstore, ok := store.(OrderedKeyValueDB)
+		if !ok {
+			return nil, fmt.Errorf("backend tier store %q for %s is not an ordered key-value store", alias, dataspec)
+		}
+		tiers[class] = okvstore
+		dvid.Infof("Key class %d of %s assigned to store %s\n", class, dataspec, store)
+	}
+	return tiers, nil
+}
+
+// getShardStores returns the ordered key-value stores for a data specification's additional shards.
+func getShardStores(dataspec dvid.DataSpecifier, aliases []Alias) ([]OrderedKeyValueDB, error) {
+	if len(aliases) == 0 {
+		return nil, nil
+	}
+	shards := make([]OrderedKeyValueDB, len(aliases))
+	for i, alias := range aliases {
+		store, found := manager.stores[alias]
+		if !found {
+			return nil, fmt.Errorf("bad backend shard store alias for %s: %q", dataspec, alias)
+		}
+		okvstore, ok := store.(OrderedKeyValueDB)
+		if !ok {
+			return nil, fmt.Errorf("backend shard store %q for %s is not an ordered key-value store", alias, dataspec)
+		}
+		shards[i] = okvstore
+		dvid.Infof("Store %s added as shard %d of %s\n", store, i+1, dataspec)
+	}
+	return shards, nil
+}
+
 // Shutdown handles any storage-specific shutdown procedures.
 func Shutdown() {
 	if manager.setup {
+		stopCompaction()
 		for alias, store := range manager.stores {
 			dvid.Infof("Closing store %q: %s...\n", alias, store)
 			store.Close()
@@ -246,6 +335,17 @@ func Initialize(cmdline dvid.Config, backend *Backend) (createdMetadata bool, er
 			dvid.TimeErrorf("dbconfig: %v\n", dbconfig)
 			return false, fmt.Errorf("bad store %q: %v", alias, err)
 		}
+		schedule, err := ParseCompactionSchedule(dbconfig)
+		if err != nil {
+			return false, fmt.Errorf("bad store %q: %v", alias, err)
+		}
+		if schedule != nil {
+			compactor, ok := store.(Compactor)
+			if !ok {
+				return false, fmt.Errorf("store %q has a compaction_window but its engine %q can't be compacted", alias, dbconfig.Engine)
+			}
+			startCompaction(alias, compactor, schedule)
+		}
 		if alias == backend.Metadata {
 			gotMetadata = true
 			createdMetadata = created
@@ -291,6 +391,12 @@ func Initialize(cmdline dvid.Config, backend *Backend) (createdMetadata bool, er
 	// Make all data instance, tag-specific, or datatype-specific store assignments.
 	manager.instanceStore = make(map[dvid.DataSpecifier]dvid.Store)
 	manager.datatypeStore = make(map[dvid.TypeString]dvid.Store)
+	manager.instanceTiers = make(map[dvid.DataSpecifier]map[TKeyClass]OrderedKeyValueDB)
+	manager.datatypeTiers = make(map[dvid.TypeString]map[TKeyClass]OrderedKeyValueDB)
+	manager.instanceShards = make(map[dvid.DataSpecifier][]OrderedKeyValueDB)
+	manager.datatypeShards = make(map[dvid.TypeString][]OrderedKeyValueDB)
+	manager.instanceFallback = make(map[dvid.DataSpecifier]OrderedKeyValueDB)
+	manager.datatypeFallback = make(map[dvid.TypeString]OrderedKeyValueDB)
 	for dataspec, alias := range backend.KVStore {
 		if dataspec == "default" || dataspec == "metadata" {
 			continue
@@ -304,15 +410,64 @@ func Initialize(cmdline dvid.Config, backend *Backend) (createdMetadata bool, er
 		s := strings.Trim(string(dataspec), "\"")
 		instanceParts := strings.Split(s, ":")
 		tagParts := strings.Split(s, "=")
+		var tiers map[TKeyClass]OrderedKeyValueDB
+		if tiers, err = getTierStores(dataspec, backend.KVTiers[dataspec]); err != nil {
+			return
+		}
+		var shards []OrderedKeyValueDB
+		if shards, err = getShardStores(dataspec, backend.KVShards[dataspec]); err != nil {
+			return
+		}
+		var fallback OrderedKeyValueDB
+		if fallbackAlias, found := backend.KVFallback[dataspec]; found {
+			fallbackStore, found := manager.stores[fallbackAlias]
+			if !found {
+				err = fmt.Errorf("bad backend fallback store alias for %s: %q", dataspec, fallbackAlias)
+				return
+			}
+			var ok bool
+			if fallback, ok = fallbackStore.(OrderedKeyValueDB); !ok {
+				err = fmt.Errorf("backend fallback store %q for %s is not an ordered key-value store", fallbackAlias, dataspec)
+				return
+			}
+			dvid.Infof("Store %s assigned as read fallback of %s\n", fallbackStore, dataspec)
+		}
 		switch {
 		case len(instanceParts) == 1 && len(tagParts) == 1:
 			manager.datatypeStore[dvid.TypeString(s)] = store
+			if tiers != nil {
+				manager.datatypeTiers[dvid.TypeString(s)] = tiers
+			}
+			if shards != nil {
+				manager.datatypeShards[dvid.TypeString(s)] = shards
+			}
+			if fallback != nil {
+				manager.datatypeFallback[dvid.TypeString(s)] = fallback
+			}
 		case len(instanceParts) == 2:
 			dataid := dvid.GetDataSpecifier(dvid.InstanceName(instanceParts[0]), dvid.UUID(instanceParts[1]))
 			manager.instanceStore[dataid] = store
+			if tiers != nil {
+				manager.instanceTiers[dataid] = tiers
+			}
+			if shards != nil {
+				manager.instanceShards[dataid] = shards
+			}
+			if fallback != nil {
+				manager.instanceFallback[dataid] = fallback
+			}
 		case len(tagParts) == 2:
 			dataid := dvid.GetDataSpecifierByTag(tagParts[0], tagParts[1])
 			manager.instanceStore[dataid] = store
+			if tiers != nil {
+				manager.instanceTiers[dataid] = tiers
+			}
+			if shards != nil {
+				manager.instanceShards[dataid] = shards
+			}
+			if fallback != nil {
+				manager.instanceFallback[dataid] = fallback
+			}
 		default:
 			err = fmt.Errorf("bad backend data specification: %s", dataspec)
 			return
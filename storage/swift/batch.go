@@ -28,6 +28,9 @@ type Batch struct {
 
 	// The "delete" operations.
 	deletes map[string]struct{} // A set of Swift objet names.
+
+	// Size and timing of the batch.
+	storage.BatchStatsTracker
 }
 
 // newBatch returns a new batch.
@@ -60,6 +63,7 @@ func (b *Batch) Delete(typeKey storage.TKey) {
 
 	delete(b.puts, name)
 	b.deletes[name] = struct{}{}
+	b.TrackDelete(typeKey)
 
 	if b.versionedContext != nil {
 		// Add a tombstone.
@@ -86,6 +90,7 @@ func (b *Batch) Put(typeKey storage.TKey, value []byte) {
 	}
 
 	b.puts[name] = value
+	b.TrackPut(typeKey, value)
 }
 
 // Commits a batch of operations and closes the write batch.
@@ -93,6 +98,7 @@ func (b *Batch) Commit() error {
 	b.Lock()
 	defer b.Unlock()
 	b.store.lockBatch(b)
+	defer b.TrackCommit(time.Now())
 
 	// Clean up at the end.
 	defer func() {
@@ -37,6 +37,9 @@ type Store struct {
 	// The Swift connection.
 	conn *swift.Connection
 
+	// Pooled connections used by the Swift connection.
+	transport *storage.PooledTransport
+
 	// Locks held by batch commits.
 	batchLocks         map[string]int // Maps Swift object names to number of locks held.
 	batchLocksReleased chan struct{}  // One-time-use channel which signals the release of locks of a batch.
@@ -49,7 +52,9 @@ func (s *Store) String() string {
 
 // Close closes the store.
 func (s *Store) Close() {
-	// Nothing to close.
+	if s.transport != nil {
+		s.transport.Close()
+	}
 }
 
 // Equal returns true if this store matches the given store configuration.
@@ -124,6 +129,14 @@ func NewStore(config dvid.StoreConfig) (*Store, bool, error) {
 		return nil, false, err
 	}
 
+	// Reuse connections across requests.
+	pool, err := storage.ParsePoolConfig(config)
+	if err != nil {
+		return nil, false, err
+	}
+	s.transport = storage.NewPooledTransport(fmt.Sprintf("Swift %s/%s", s.conn.AuthUrl, s.container), pool)
+	s.conn.Transport = s.transport
+
 	// Authenticate with Swift.
 	if err := s.conn.Authenticate(); err != nil {
 		return nil, false, fmt.Errorf(`Unable to authenticate with the Swift database: %s`, err)
@@ -0,0 +1,352 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// NewTieredOrderedKeyValueDB returns an OrderedKeyValueDB that routes each type-specific key
+// to a store based on its TKeyClass.  Classes not in the tiers map use the default store.
+// This allows, for example, a data instance's index keys to reside on a fast store while its
+// bulk data resides on a cheaper store.  Ranges that span classes on different stores are
+// only supported by DeleteAll and RawRangeQuery, and batches that span stores are committed
+// per store and are not atomic.
+func NewTieredOrderedKeyValueDB(defaultDB OrderedKeyValueDB, tiers map[TKeyClass]OrderedKeyValueDB) OrderedKeyValueDB {
+	db := tieredOrderedStore{
+		OrderedKeyValueDB: defaultDB,
+		stores:            []OrderedKeyValueDB{defaultDB},
+		tiers:             make(map[TKeyClass]int, len(tiers)),
+	}
+	for class, tier := range tiers {
+		i := 0
+		for i < len(db.stores) && !sameStore(db.stores[i], tier) {
+			i++
+		}
+		if i == len(db.stores) {
+			db.stores = append(db.stores, tier)
+		}
+		db.tiers[class] = i
+	}
+	return db
+}
+
+// sameStore returns true if two stores are identical.  Stores whose values can't be
+// compared, e.g., wrappers holding slices or maps, are treated as distinct.
+func sameStore(a, b OrderedKeyValueDB) (same bool) {
+	defer func() {
+		if recover() != nil {
+			same = false
+		}
+	}()
+	return a == b
+}
+
+// tieredOrderedStore routes by index into its distinct stores, since stores can't be
+// compared or used as map keys in general.
+type tieredOrderedStore struct {
+	OrderedKeyValueDB                     // default tier
+	stores            []OrderedKeyValueDB // distinct stores starting with the default tier
+	tiers             map[TKeyClass]int   // index of the store for each tiered key class
+}
+
+func (db tieredOrderedStore) String() string {
+	return fmt.Sprintf("%s with %d tiered key classes", db.OrderedKeyValueDB, len(db.tiers))
+}
+
+// tierForTKey returns the index of the store holding the given type-specific key.
+func (db tieredOrderedStore) tierForTKey(tk TKey) (int, error) {
+	class, err := tk.Class()
+	if err != nil {
+		return 0, err
+	}
+	return db.tiers[class], nil
+}
+
+// storeForTKey returns the store holding the given type-specific key.
+func (db tieredOrderedStore) storeForTKey(tk TKey) (OrderedKeyValueDB, error) {
+	i, err := db.tierForTKey(tk)
+	if err != nil {
+		return nil, err
+	}
+	return db.stores[i], nil
+}
+
+// tierForKey returns the index of the store holding the given full key.
+func (db tieredOrderedStore) tierForKey(k Key) (int, error) {
+	tk, err := TKeyFromKey(k)
+	if err != nil {
+		return 0, err
+	}
+	return db.tierForTKey(tk)
+}
+
+// storeForKey returns the store holding the given full key.
+func (db tieredOrderedStore) storeForKey(k Key) (OrderedKeyValueDB, error) {
+	i, err := db.tierForKey(k)
+	if err != nil {
+		return nil, err
+	}
+	return db.stores[i], nil
+}
+
+// storeForRange returns the store holding a range of type-specific keys, which must not
+// span stores.
+func (db tieredOrderedStore) storeForRange(kStart, kEnd TKey) (OrderedKeyValueDB, error) {
+	tier1, err := db.tierForTKey(kStart)
+	if err != nil {
+		return nil, err
+	}
+	tier2, err := db.tierForTKey(kEnd)
+	if err != nil {
+		return nil, err
+	}
+	if tier1 != tier2 {
+		return nil, fmt.Errorf("key range %v -> %v spans tiered stores %s and %s", kStart, kEnd, db.stores[tier1], db.stores[tier2])
+	}
+	return db.stores[tier1], nil
+}
+
+func (db tieredOrderedStore) Get(ctx Context, tk TKey) ([]byte, error) {
+	store, err := db.storeForTKey(tk)
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(ctx, tk)
+}
+
+func (db tieredOrderedStore) GetRange(ctx Context, kStart, kEnd TKey) ([]*TKeyValue, error) {
+	store, err := db.storeForRange(kStart, kEnd)
+	if err != nil {
+		return nil, err
+	}
+	return store.GetRange(ctx, kStart, kEnd)
+}
+
+func (db tieredOrderedStore) KeysInRange(ctx Context, kStart, kEnd TKey) ([]TKey, error) {
+	store, err := db.storeForRange(kStart, kEnd)
+	if err != nil {
+		return nil, err
+	}
+	return store.KeysInRange(ctx, kStart, kEnd)
+}
+
+func (db tieredOrderedStore) SendKeysInRange(ctx Context, kStart, kEnd TKey, ch KeyChan) error {
+	store, err := db.storeForRange(kStart, kEnd)
+	if err != nil {
+		return err
+	}
+	return store.SendKeysInRange(ctx, kStart, kEnd, ch)
+}
+
+func (db tieredOrderedStore) ProcessRange(ctx Context, kStart, kEnd TKey, op *ChunkOp, f ChunkFunc) error {
+	store, err := db.storeForRange(kStart, kEnd)
+	if err != nil {
+		return err
+	}
+	return store.ProcessRange(ctx, kStart, kEnd, op, f)
+}
+
+// RawRangeQuery queries a range of full keys.  If the range spans stores, each store is
+// queried in turn so keys are only ordered within each store.
+func (db tieredOrderedStore) RawRangeQuery(kStart, kEnd Key, keysOnly bool, out chan *KeyValue, cancel <-chan struct{}) error {
+	tier1, err := db.tierForKey(kStart)
+	if err != nil {
+		return err
+	}
+	tier2, err := db.tierForKey(kEnd)
+	if err != nil {
+		return err
+	}
+	if tier1 == tier2 {
+		return db.stores[tier1].RawRangeQuery(kStart, kEnd, keysOnly, out, cancel)
+	}
+	for _, store := range db.stores {
+		select {
+		case <-cancel:
+			return nil
+		default:
+		}
+		// stores needn't send a nil on cancellation or error, so the channel is closed once
+		// the store's query returns and drained so the query is never blocked.
+		ch := make(chan *KeyValue, cap(out))
+		errCh := make(chan error, 1)
+		go func(store OrderedKeyValueDB) {
+			errCh <- store.RawRangeQuery(kStart, kEnd, keysOnly, ch, cancel)
+			close(ch)
+		}(store)
+		var cancelled bool
+		for kv := range ch {
+			if kv == nil || cancelled {
+				continue
+			}
+			select {
+			case out <- kv:
+			case <-cancel:
+				cancelled = true
+			}
+		}
+		if err := <-errCh; err != nil {
+			return err
+		}
+		if cancelled {
+			return nil
+		}
+	}
+	out <- nil
+	return nil
+}
+
+func (db tieredOrderedStore) Put(ctx Context, tk TKey, v []byte) error {
+	store, err := db.storeForTKey(tk)
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, tk, v)
+}
+
+func (db tieredOrderedStore) Delete(ctx Context, tk TKey) error {
+	store, err := db.storeForTKey(tk)
+	if err != nil {
+		return err
+	}
+	return store.Delete(ctx, tk)
+}
+
+func (db tieredOrderedStore) RawPut(k Key, v []byte) error {
+	store, err := db.storeForKey(k)
+	if err != nil {
+		return err
+	}
+	return store.RawPut(k, v)
+}
+
+func (db tieredOrderedStore) RawDelete(k Key) error {
+	store, err := db.storeForKey(k)
+	if err != nil {
+		return err
+	}
+	return store.RawDelete(k)
+}
+
+func (db tieredOrderedStore) PutRange(ctx Context, kvs []TKeyValue) error {
+	var order []int
+	perTier := make(map[int][]TKeyValue)
+	for _, kv := range kvs {
+		i, err := db.tierForTKey(kv.K)
+		if err != nil {
+			return err
+		}
+		if _, found := perTier[i]; !found {
+			order = append(order, i)
+		}
+		perTier[i] = append(perTier[i], kv)
+	}
+	for _, i := range order {
+		if err := db.stores[i].PutRange(ctx, perTier[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db tieredOrderedStore) DeleteRange(ctx Context, kStart, kEnd TKey) error {
+	store, err := db.storeForRange(kStart, kEnd)
+	if err != nil {
+		return err
+	}
+	return store.DeleteRange(ctx, kStart, kEnd)
+}
+
+func (db tieredOrderedStore) DeleteAll(ctx Context, allVersions bool) error {
+	for _, store := range db.stores {
+		if err := store.DeleteAll(ctx, allVersions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db tieredOrderedStore) DeleteTKeyClass(ctx Context, tkc TKeyClass, allVersions bool) error {
+	store := db.stores[db.tiers[tkc]]
+	deleter, ok := store.(TKeyClassDeleter)
+	if !ok {
+		return fmt.Errorf("store %s does not support deletion of a key class", store)
+	}
+	return deleter.DeleteTKeyClass(ctx, tkc, allVersions)
+}
+
+// Close is a no-op since the tiered stores are closed by the storage manager.
+func (db tieredOrderedStore) Close() {}
+
+// NewBatch returns a batch that routes operations to a batch for each tiered store.
+// If any store doesn't support batching, the returned batch fails on commit.
+func (db tieredOrderedStore) NewBatch(ctx Context) Batch {
+	return newRoutedBatch(ctx, db.stores, db.tierForTKey)
+}
+
+// routedBatch sends each operation to a batch for the store whose index is chosen by a
+// routing function.  The per-store batches are committed in turn, so the batch as a whole
+// is not atomic.
+type routedBatch struct {
+	BatchStatsTracker
+	ctx     Context
+	stores  []OrderedKeyValueDB
+	route   func(TKey) (int, error)
+	order   []int
+	batches map[int]Batch
+	err     error
+}
+
+func newRoutedBatch(ctx Context, stores []OrderedKeyValueDB, route func(TKey) (int, error)) *routedBatch {
+	return &routedBatch{ctx: ctx, stores: stores, route: route, batches: make(map[int]Batch)}
+}
+
+func (b *routedBatch) batchForTKey(tk TKey) Batch {
+	i, err := b.route(tk)
+	if err != nil {
+		b.err = err
+		return nil
+	}
+	batch, found := b.batches[i]
+	if !found {
+		batcher, ok := b.stores[i].(KeyValueBatcher)
+		if !ok {
+			b.err = fmt.Errorf("store %s does not support batching", b.stores[i])
+			return nil
+		}
+		batch = batcher.NewBatch(b.ctx)
+		b.batches[i] = batch
+		b.order = append(b.order, i)
+	}
+	return batch
+}
+
+func (b *routedBatch) Delete(tk TKey) {
+	if batch := b.batchForTKey(tk); batch != nil {
+		batch.Delete(tk)
+		b.TrackDelete(tk)
+	}
+}
+
+func (b *routedBatch) Put(tk TKey, v []byte) {
+	if batch := b.batchForTKey(tk); batch != nil {
+		batch.Put(tk, v)
+		b.TrackPut(tk, v)
+	}
+}
+
+func (b *routedBatch) Commit() error {
+	defer b.TrackCommit(time.Now())
+	if b.err != nil {
+		return b.err
+	}
+	for n, i := range b.order {
+		if err := b.batches[i].Commit(); err != nil {
+			dvid.Errorf("routed batch commit to store %s failed after %d of %d stores committed\n", b.stores[i], n, len(b.order))
+			return err
+		}
+	}
+	return nil
+}